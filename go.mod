@@ -3,7 +3,7 @@ module github.com/emitter-io/emitter
 go 1.16
 
 require (
-	github.com/aws/aws-sdk-go v1.31.4 // indirect
+	github.com/aws/aws-sdk-go v1.31.4
 	github.com/axiomhq/hyperloglog v0.0.0-20191112132149-a4c4c47bc57f
 	github.com/coocood/freecache v1.1.1
 	github.com/dgraph-io/badger/v3 v3.2103.0
@@ -12,22 +12,40 @@ require (
 	github.com/emitter-io/address v1.0.1
 	github.com/emitter-io/config v1.0.0
 	github.com/emitter-io/stats v1.0.3
+	github.com/fatih/color v1.9.0 // indirect
+	github.com/gocql/gocql v1.6.0
 	github.com/golang/snappy v0.0.3
+	github.com/gomodule/redigo v1.8.9
 	github.com/gorilla/websocket v1.4.2
+	github.com/hashicorp/go-hclog v0.14.1
+	github.com/hashicorp/go-plugin v1.4.3
+	github.com/hashicorp/yamux v0.0.0-20181012175058-2f1d1f20f75d // indirect
 	github.com/jawher/mow.cli v1.1.0
 	github.com/kelindar/binary v1.0.10
 	github.com/kelindar/rate v1.0.0
 	github.com/kelindar/tcp v1.0.0
 	github.com/klauspost/compress v1.10.6 // indirect
 	github.com/kr/pretty v0.2.0 // indirect
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-colorable v0.1.7 // indirect
+	github.com/mattn/go-isatty v0.0.13 // indirect
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/mitchellh/go-testing-interface v1.0.4 // indirect
 	github.com/prometheus/client_golang v1.11.0
-	github.com/stretchr/testify v1.7.0
+	github.com/stretchr/testify v1.7.1
 	github.com/tidwall/buntdb v1.2.4
 	github.com/tidwall/pretty v1.2.0 // indirect
 	github.com/tidwall/rtree v0.0.0-20180113144539-6cd427091e0e // indirect
 	github.com/valyala/fasthttp v1.12.0
 	github.com/weaveworks/mesh v0.0.0-20191105120815-58dbcc3e8e63
+	github.com/yuin/gopher-lua v1.1.0
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.7.0 // indirect
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
 	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e
 	golang.org/x/net v0.0.0-20210614182718-04defd469f4e // indirect
 	gopkg.in/alexcesaro/statsd.v2 v2.0.0
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -25,6 +25,12 @@ import (
 
 // Repeat performs an action asynchronously on a predetermined interval.
 func Repeat(ctx context.Context, interval time.Duration, action func()) context.CancelFunc {
+	return RepeatOn(ctx, interval, nil, action)
+}
+
+// RepeatOn performs an action asynchronously on a predetermined interval, as well as every
+// time the signal is received.
+func RepeatOn(ctx context.Context, interval time.Duration, signal <-chan struct{}, action func()) context.CancelFunc {
 
 	// Create cancellation context first
 	ctx, cancel := context.WithCancel(ctx)
@@ -45,6 +51,8 @@ func Repeat(ctx context.Context, interval time.Duration, action func()) context.
 				return
 			case <-timer.C:
 				safeAction()
+			case <-signal:
+				safeAction()
 			}
 		}
 	}()
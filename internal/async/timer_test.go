@@ -37,6 +37,23 @@ func TestRepeat(t *testing.T) {
 	})
 }
 
+func TestRepeatOn(t *testing.T) {
+	var counter int32
+	signal := make(chan struct{})
+	cancel := RepeatOn(context.TODO(), time.Hour, signal, func() {
+		atomic.AddInt32(&counter, 1)
+	})
+	defer cancel()
+
+	// The action is performed right away, then on every signal
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counter))
+	signal <- struct{}{}
+	signal <- struct{}{}
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&counter) == 3
+	}, time.Second, time.Millisecond)
+}
+
 func TestRepeatFirstActionPanic(t *testing.T) {
 	assert.NotPanics(t, func() {
 		cancel := Repeat(context.TODO(), time.Nanosecond*10, func() {
@@ -0,0 +1,85 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"net"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/network/listener"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/service/access"
+)
+
+// accessPolicies returns the access policies of the listeners, by name.
+func accessPolicies(c *config.AccessConfig) (map[string]*access.Policy, error) {
+	policies := make(map[string]*access.Policy)
+	if c == nil {
+		return policies, nil
+	}
+
+	for _, name := range []string{"tcp", "tls"} {
+		allow, deny, err := c.Lists(name == "tls")
+		if err != nil {
+			return nil, err
+		}
+
+		policies[name] = &access.Policy{Allow: allow, Deny: deny}
+	}
+	return policies, nil
+}
+
+// configureAccess configures the access control of the listeners.
+func (s *Service) configureAccess(c *config.AccessConfig) error {
+	policies, err := accessPolicies(c)
+	if err != nil {
+		return err
+	}
+
+	if c == nil {
+		c = new(config.AccessConfig)
+	}
+
+	s.access.Configure(policies, c.MaxPerIP, c.MaxPerContract)
+	return nil
+}
+
+// admitOf returns the admission of the connections of a listener, which enforces its
+// access policy and the maximum number of connections per address.
+func (s *Service) admitOf(name string) listener.AdmitFunc {
+	return func(addr net.Addr) (func(), error) {
+		release, err := s.access.Admit(name, addr)
+		switch err {
+		case access.ErrDenied:
+			s.measurer.Measure("conn.denied", 1)
+			logging.LogDebug("service", "denied a connection", logging.Remote(addr.String()))
+		case access.ErrLimited:
+			s.measurer.Measure("conn.limited", 1)
+			logging.LogDebug("service", "too many connections from the address", logging.Remote(addr.String()))
+		}
+		return release, err
+	}
+}
+
+// admitContract admits a connection for its contract, once the contract is known, and
+// returns whether it can stay connected.
+func (s *Service) admitContract(contract uint32) bool {
+	if s.access == nil || s.access.AdmitContract(contract) {
+		return true
+	}
+
+	s.measurer.Measure("conn.limited", 1)
+	return false
+}
@@ -0,0 +1,51 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"net"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/service/access"
+	"github.com/emitter-io/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccess(t *testing.T) {
+	s := &Service{
+		access:   access.New(),
+		measurer: stats.NewNoop(),
+	}
+
+	assert.Error(t, s.configureAccess(&config.AccessConfig{Allow: "invalid"}))
+	assert.NoError(t, s.configureAccess(&config.AccessConfig{
+		SecureAllow:    "10.0.0.0/8",
+		MaxPerContract: 1,
+	}))
+
+	_, err := s.admitOf("tls")(&net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	assert.Equal(t, access.ErrDenied, err)
+
+	release, err := s.admitOf("tcp")(&net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	assert.NoError(t, err)
+	release()
+
+	assert.True(t, s.admitContract(1))
+	assert.False(t, s.admitContract(1))
+
+	// Without any access control, the contracts are admitted
+	assert.True(t, (&Service{}).admitContract(1))
+}
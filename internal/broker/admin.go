@@ -0,0 +1,82 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/emitter-io/emitter/internal/service/audit"
+)
+
+// authorizeAdmin checks whether the HTTP request carries a valid master (secret) key of
+// the license this broker is running with. The key can be provided either through the
+// "Authorization" header or the "key" query parameter.
+func (s *Service) authorizeAdmin(r *http.Request) bool {
+	secret := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if secret == "" {
+		secret = r.URL.Query().Get("key")
+	}
+
+	// Attempt to parse the key
+	key, err := s.keygen.DecryptKey(secret)
+	if err != nil || !key.IsMaster() || key.IsExpired() || key.Contract() != s.License.Contract() {
+		return false
+	}
+
+	// Attempt to fetch the contract using the key. Underneath, it's cached.
+	contract, contractFound := s.contracts.Get(key.Contract())
+	return contractFound && contract.Validate(key)
+}
+
+// admin wraps an HTTP handler of the administrative API, making sure that only the
+// requests which are authorized with the master key reach the handler.
+func (s *Service) admin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorizeAdmin(r) {
+			s.Audit(audit.KindAuthFailed, 0, r.RemoteAddr, r.Method+" "+r.URL.Path)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		s.Audit(audit.KindAdmin, s.License.Contract(), r.RemoteAddr, r.Method+" "+r.URL.Path)
+		handler(w, r)
+	}
+}
+
+// Occurs when a new HTTP cluster topology request is received.
+func (s *Service) onTopology(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" || s.cluster == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	resp, _ := json.Marshal(s.cluster.Topology())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// Occurs when a new HTTP scheduler delays request is received.
+func (s *Service) onScheduler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" || s.scheduler == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	resp, _ := json.Marshal(s.scheduler.Delays())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
@@ -0,0 +1,104 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	"github.com/emitter-io/emitter/internal/provider/usage"
+	"github.com/emitter-io/emitter/internal/security/license"
+	"github.com/emitter-io/emitter/internal/service/keygen"
+	"github.com/emitter-io/emitter/internal/service/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestAdmin creates a service capable of authorizing admin requests and returns
+// its master key.
+func newTestAdmin(t *testing.T) (*Service, string) {
+	license, _ := license.Parse(testLicense)
+	cipher, err := license.Cipher()
+	assert.NoError(t, err)
+
+	s := &Service{
+		License:   license,
+		contracts: contract.NewSingleContractProvider(license, usage.NewNoop()),
+	}
+	s.keygen = keygen.New(cipher, s.contracts, s)
+
+	master, err := license.NewMasterKey(1)
+	assert.NoError(t, err)
+	secret, err := cipher.EncryptKey(master)
+	assert.NoError(t, err)
+	return s, secret
+}
+
+func TestAdmin(t *testing.T) {
+	s, secret := newTestAdmin(t)
+	tests := []struct {
+		header string
+		query  string
+		code   int
+	}{
+		{code: 401},
+		{header: "invalid", code: 401},
+		{header: "w07Jv3TMhYTg6lLk6fQoVG2KCe7gjFPk", code: 401}, // not a master key
+		{header: secret, code: 200},
+		{header: "Bearer " + secret, code: 200},
+		{query: "?key=" + secret, code: 200},
+	}
+
+	handler := s.admin(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, tc := range tests {
+		req, _ := http.NewRequest("GET", "/admin/test"+tc.query, nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, tc.code, rr.Code)
+	}
+}
+
+func TestOnTopology_NoCluster(t *testing.T) {
+	s := new(Service)
+	rr := httptest.NewRecorder()
+	s.onTopology(rr, httptest.NewRequest("GET", "/admin/cluster", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestOnScheduler(t *testing.T) {
+	s := &Service{scheduler: scheduler.New(1, func(uint32) int { return 1 })}
+	defer s.scheduler.Close()
+
+	done := make(chan bool)
+	s.scheduler.Schedule(5, func() { close(done) })
+	<-done
+
+	rr := httptest.NewRecorder()
+	s.onScheduler(rr, httptest.NewRequest("GET", "/admin/scheduler", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"contract":5`)
+
+	rr = httptest.NewRecorder()
+	s.onScheduler(rr, httptest.NewRequest("POST", "/admin/scheduler", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
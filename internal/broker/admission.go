@@ -0,0 +1,58 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+)
+
+// isThrottled returns whether a new connection should be throttled as too many clients are
+// connecting at once and, if so, the delay after which the client should retry.
+func (s *Service) isThrottled() (bool, time.Duration) {
+	if s.admission == nil {
+		return false, 0
+	}
+
+	ok, delay := s.admission.Admit()
+	return !ok, delay
+}
+
+// throttle refuses a new connection during a storm of connections. The client is told that
+// the server is unavailable and, since the acknowledgement can not carry any retry delay,
+// the error with the jittered delay is then sent on the "emitter/error/" channel.
+func (s *Service) throttle(t net.Conn, delay time.Duration) {
+	s.measurer.Measure("conn.throttled", 1)
+	defer t.Close()
+
+	t.SetWriteDeadline(time.Now().Add(refuseTimeout))
+	ack := mqtt.Connack{ReturnCode: 0x03} // Server unavailable
+	if _, err := ack.EncodeTo(t); err != nil {
+		return
+	}
+
+	retryAfter := int(math.Ceil(delay.Seconds()))
+	payload, _ := json.Marshal(errors.ErrThrottled.WithRetry(retryAfter, s.advice().Endpoints))
+	packet := mqtt.Publish{
+		Topic:   []byte("emitter/error/"),
+		Payload: payload,
+	}
+	packet.EncodeTo(t)
+}
@@ -0,0 +1,63 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"bufio"
+	"encoding/json"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	netmock "github.com/emitter-io/emitter/internal/network/mock"
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/service/overload"
+	"github.com/emitter-io/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmission_Throttle(t *testing.T) {
+	s := &Service{
+		measurer:  stats.NewNoop(),
+		admission: overload.NewAdmission(1, nil),
+	}
+
+	// The first connection uses up the admitted rate
+	throttled, _ := s.isThrottled()
+	assert.False(t, throttled)
+
+	// The MQTT client is told that the server is unavailable, then when to retry
+	pipe := netmock.NewConn()
+	go s.onAcceptConn(pipe.Client, "tcp")
+
+	reader := bufio.NewReader(pipe.Server)
+	ack, err := mqtt.DecodePacket(reader, 65536)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0x03), ack.(*mqtt.Connack).ReturnCode)
+
+	msg, err := mqtt.DecodePacket(reader, 65536)
+	assert.NoError(t, err)
+	assert.Equal(t, "emitter/error/", string(msg.(*mqtt.Publish).Topic))
+
+	var resp errors.Error
+	assert.NoError(t, json.Unmarshal(msg.(*mqtt.Publish).Payload, &resp))
+	assert.Equal(t, errors.ErrThrottled.Message, resp.Message)
+	assert.True(t, resp.RetryAfter >= 1 && resp.RetryAfter <= 2)
+}
+
+func TestAdmission_Disabled(t *testing.T) {
+	s := &Service{measurer: stats.NewNoop()}
+	throttled, _ := s.isThrottled()
+	assert.False(t, throttled)
+}
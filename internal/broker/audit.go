@@ -0,0 +1,71 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service/audit"
+)
+
+// configureAudit creates the audit trail with the sinks configured.
+func (s *Service) configureAudit(cfg *config.AuditConfig, node string) error {
+	var sinks []audit.Sink
+	if cfg.File != "" {
+		file, err := audit.NewFile(cfg.File)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, file)
+	}
+
+	if cfg.Channel != "" {
+		sinks = append(sinks, audit.NewChannel(s.publishAudit(cfg.Channel)))
+	}
+
+	if cfg.URL != "" {
+		sinks = append(sinks, audit.NewHTTP(cfg.URL))
+	}
+
+	if len(sinks) > 0 {
+		s.audit = audit.New(node, sinks...)
+		logging.LogAction("service", "configured the audit trail")
+	}
+	return nil
+}
+
+// publishAudit returns the function which publishes the audited events on the channel,
+// under the contract of the license.
+func (s *Service) publishAudit(name string) func([]byte) {
+	channel := security.ParseChannel([]byte("emitter/" + name))
+	return func(event []byte) {
+		if channel.ChannelType == security.ChannelStatic && s.pubsub != nil {
+			s.pubsub.Publish(message.New(
+				message.NewSsid(s.License.Contract(), channel.Query),
+				channel.Channel,
+				event,
+			), nil)
+		}
+	}
+}
+
+// Audit records a security-relevant event in the audit trail, if enabled.
+func (s *Service) Audit(kind string, contract uint32, actor, detail string) {
+	if s.audit != nil {
+		s.audit.Audit(kind, contract, actor, detail)
+	}
+}
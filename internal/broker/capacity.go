@@ -0,0 +1,58 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/service/capacity"
+)
+
+const (
+	capacityInterval = time.Minute // The interval between the samples of the capacity planner.
+	capacitySamples  = 10080       // The number of samples kept by the capacity planner, a week.
+)
+
+// sampleCapacity samples the usage of the resources of the node.
+func (s *Service) sampleCapacity() capacity.Sample {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	sample := capacity.Sample{
+		Time:        time.Now(),
+		Connections: atomic.LoadInt64(&s.connections),
+		Memory:      memory.HeapInuse,
+	}
+
+	if measured, ok := s.storage.(*storage.Measured); ok {
+		sample.Stored = measured.Written()
+	}
+	return sample
+}
+
+// capacityLimits returns the resources the node can use.
+func (s *Service) capacityLimits() (limits capacity.Limits) {
+	limits.Memory, _ = config.HostMemory()
+	if s.descriptors != nil {
+		if used, allowed, ok := s.descriptors.Usage(); ok && allowed > used {
+			limits.Descriptors = allowed - used
+		}
+	}
+	return
+}
@@ -0,0 +1,62 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"bytes"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/emitter-io/emitter/internal/message"
+)
+
+// EnableChunks sets the size of the chunks the large messages delivered to the connection are
+// split into, or disables the chunking if the size is zero.
+func (c *Conn) EnableChunks(size int) {
+	atomic.StoreUint32(&c.chunks, uint32(size))
+	if size > 0 {
+		c.negotiate(featureChunks)
+	}
+}
+
+// sendChunks sends a large message to the client in chunks. Since MQTT 3.1.1 has no message
+// properties, the metadata needed to reassemble the message is appended to the channel of
+// each chunk as options.
+func (c *Conn) sendChunks(id message.ID, topic, payload []byte, size int) error {
+	c.measurer.Measure("send.chunked", 1)
+	parts := (len(payload) + size - 1) / size
+	for i := 0; i < parts; i++ {
+		end := (i + 1) * size
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		if err := c.write(chunkTopic(topic, id, i+1, parts, len(payload)), payload[i*size:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkTopic returns the topic of a chunk of a message (e.g: 'a/b/?chunk=...&part=1&parts=4&size=1000'),
+// which identifies the message, the position of the chunk and the size of the whole payload.
+func chunkTopic(topic []byte, id message.ID, part, parts, size int) []byte {
+	separator := "?"
+	if bytes.IndexByte(topic, '?') >= 0 {
+		separator = "&"
+	}
+
+	return []byte(fmt.Sprintf("%s%schunk=%x&part=%d&parts=%d&size=%d", topic, separator, []byte(id), part, parts, size))
+}
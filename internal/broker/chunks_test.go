@@ -0,0 +1,57 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkTopic(t *testing.T) {
+	id := message.ID{0x01, 0xab}
+	assert.Equal(t, "a/b/?chunk=01ab&part=1&parts=3&size=300",
+		string(chunkTopic([]byte("a/b/"), id, 1, 3, 300)))
+	assert.Equal(t, "a/b/?h-trace=abc&chunk=01ab&part=3&parts=3&size=300",
+		string(chunkTopic([]byte("a/b/?h-trace=abc"), id, 3, 3, 300)))
+}
+
+func TestConn_SendChunks(t *testing.T) {
+	pipe, conn := newTestConn()
+	conn.EnableChunks(4)
+
+	msg := message.New(message.Ssid{1, 2, 3}, []byte("a/b/c/"), []byte("hello world"))
+	go func() {
+		conn.Send(msg)
+		conn.Close()
+	}()
+
+	// The payload is split in chunks, in order
+	var payload bytes.Buffer
+	reader := bufio.NewReader(pipe.Server)
+	for i := 0; i < 3; i++ {
+		packet, err := mqtt.DecodePacket(reader, 65536)
+		assert.NoError(t, err)
+
+		publish := packet.(*mqtt.Publish)
+		assert.Contains(t, string(publish.Topic), "a/b/c/?chunk=")
+		payload.Write(publish.Payload)
+	}
+	assert.Equal(t, "hello world", payload.String())
+}
@@ -0,0 +1,237 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/security/hash"
+	"github.com/emitter-io/emitter/internal/service/audit"
+)
+
+const maxListed = 1000 // The maximum number of connections or subscriptions listed.
+
+// ClientInfo represents the information about a client connected to the node.
+type ClientInfo struct {
+	ID        string   `json:"id"`                 // The unique identifier of the connection.
+	Contract  uint32   `json:"contract,omitempty"` // The contract of the client, once tracked.
+	Username  string   `json:"username,omitempty"` // The username provided on connect.
+	Remote    string   `json:"remote,omitempty"`   // The remote address of the client.
+	Connected int64    `json:"connected"`          // The unix time the client connected.
+	Channels  []string `json:"channels"`           // The channels the client is subscribed to.
+	Features  []string `json:"features,omitempty"` // The protocol features negotiated.
+	Queued    int      `json:"queued,omitempty"`   // The number of messages in the outbound queue.
+	Dropped   int64    `json:"dropped,omitempty"`  // The number of messages dropped from the outbound queue.
+}
+
+// info returns the information about the connection.
+func (c *Conn) info() ClientInfo {
+	c.Lock()
+	contract := c.contract
+	c.Unlock()
+
+	info := ClientInfo{
+		ID:        c.ID(),
+		Contract:  contract,
+		Username:  c.username,
+		Connected: c.started,
+		Channels:  make([]string, 0, 4),
+		Features:  c.Features(),
+		Remote:    c.remoteAddr(),
+	}
+
+	if c.outbox != nil {
+		info.Queued = c.outbox.Len()
+		info.Dropped = c.outbox.Dropped()
+	}
+
+	for _, sub := range c.subs.All() {
+		info.Channels = append(info.Channels, string(sub.Channel))
+	}
+	sort.Strings(info.Channels)
+	return info
+}
+
+// Clients returns the clients connected to the node, optionally only of a contract, in the
+// order they connected.
+func (s *Service) Clients(contract uint32, limit int) []ClientInfo {
+	out := make([]ClientInfo, 0, 64)
+	s.conns.Range(func(_, v interface{}) bool {
+		if info := v.(*Conn).info(); contract == 0 || info.Contract == contract {
+			out = append(out, info)
+		}
+		return true
+	})
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Connected != out[j].Connected {
+			return out[i].Connected < out[j].Connected
+		}
+		return out[i].ID < out[j].ID
+	})
+
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// Kick disconnects a client connected to the node, and returns whether it was found.
+func (s *Service) Kick(id string) (found bool) {
+	s.conns.Range(func(_, v interface{}) bool {
+		if c := v.(*Conn); c.ID() == id {
+			c.Close()
+			found = true
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// ------------------------------------------------------------------------------------
+
+// SubscriptionInfo represents a subscription of the trie of the node.
+type SubscriptionInfo struct {
+	Ssid       message.Ssid `json:"ssid"`              // The SSID of the subscription.
+	Channel    string       `json:"channel,omitempty"` // The channel, if subscribed by a client of the node.
+	Subscriber string       `json:"subscriber"`        // The identifier of the subscriber.
+	Remote     bool         `json:"remote,omitempty"`  // Whether the subscriber is a peer of the cluster.
+}
+
+// Subscriptions returns the subscriptions of the trie whose channel falls under the pattern,
+// optionally only of a contract. Only the channels of the clients connected to the node are
+// known, since the trie keeps the hashes of the channels.
+func (s *Service) Subscriptions(contract uint32, pattern *security.Channel, limit int) []SubscriptionInfo {
+	prefix := message.NewSsid(contract, pattern.Query)
+	if contract == 0 {
+		prefix[0] = hash.OfString("+") // Any of the contracts
+	}
+
+	out := make([]SubscriptionInfo, 0, 64)
+	s.subscriptions.Walk(prefix, func(ssid message.Ssid, sub message.Subscriber) {
+		info := SubscriptionInfo{
+			Ssid:       ssid,
+			Subscriber: sub.ID(),
+			Remote:     sub.Type() == message.SubscriberRemote,
+		}
+
+		if c, ok := sub.(*Conn); ok {
+			if counter, ok := c.subs.Get(ssid); ok {
+				info.Channel = string(counter.Channel)
+			}
+		}
+		out = append(out, info)
+	})
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Channel != out[j].Channel {
+			return out[i].Channel < out[j].Channel
+		}
+		return out[i].Subscriber < out[j].Subscriber
+	})
+
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// ------------------------------------------------------------------------------------
+
+// Occurs when a new HTTP request for the connected clients is received. The clients are
+// listed with a GET, optionally for a single 'contract', and one of them is disconnected
+// with a DELETE specifying its 'id'.
+func (s *Service) onClients(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		contract, limit, ok := parseListing(r)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		respond(w, s.Clients(contract, limit))
+	case "DELETE":
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !s.Kick(id) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		s.Audit(audit.KindAdmin, s.License.Contract(), r.RemoteAddr, "disconnected "+id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Occurs when a new HTTP request for the subscriptions of the trie is received. The
+// subscriptions are listed for a 'pattern' (e.g: "a/+/"), optionally for a single 'contract'.
+func (s *Service) onTrie(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	pattern := security.ParseChannel([]byte("emitter/" + r.URL.Query().Get("pattern")))
+	contract, limit, ok := parseListing(r)
+	if !ok || pattern.ChannelType == security.ChannelInvalid {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	respond(w, s.Subscriptions(contract, pattern, limit))
+}
+
+// parseListing parses the optional 'contract' and 'limit' of a listing request.
+func parseListing(r *http.Request) (contract uint32, limit int, ok bool) {
+	limit = maxListed
+	if v := r.URL.Query().Get("contract"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return 0, 0, false
+		}
+		contract = uint32(n)
+	}
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+	return contract, limit, true
+}
+
+// respond writes the response as JSON.
+func respond(w http.ResponseWriter, v interface{}) {
+	resp, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
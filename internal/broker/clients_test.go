@@ -0,0 +1,149 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/message"
+	netmock "github.com/emitter-io/emitter/internal/network/mock"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/security/license"
+	"github.com/emitter-io/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClientsService() (*Service, *Conn, *Conn) {
+	license, _ := license.Parse(testLicense)
+	s := &Service{
+		subscriptions: message.NewTrie(),
+		License:       license,
+		measurer:      stats.NewNoop(),
+	}
+
+	c1 := s.newConn(netmock.NewConn().Client, 0)
+	c2 := s.newConn(netmock.NewConn().Client, 0)
+	c2.contract = 2
+
+	for _, name := range []string{"a/b/", "a/c/d/", "b/"} {
+		channel := security.ParseChannel([]byte("key/" + name))
+		ssid := message.NewSsid(1, channel.Query)
+		c1.subs.Increment(ssid, channel.Channel)
+		s.subscriptions.Subscribe(ssid, c1)
+	}
+	return s, c1, c2
+}
+
+func TestClients(t *testing.T) {
+	s, c1, c2 := newClientsService()
+
+	clients := s.Clients(0, maxListed)
+	assert.Len(t, clients, 2)
+	assert.Len(t, s.Clients(0, 1), 1)
+
+	clients = s.Clients(2, maxListed)
+	assert.Len(t, clients, 1)
+	assert.Equal(t, c2.ID(), clients[0].ID)
+	assert.Empty(t, clients[0].Channels)
+
+	for _, info := range s.Clients(0, maxListed) {
+		if info.ID == c1.ID() {
+			assert.Equal(t, []string{"a/b/", "a/c/d/", "b/"}, info.Channels)
+			assert.NotZero(t, info.Connected)
+		}
+	}
+
+	assert.False(t, s.Kick("unknown"))
+	assert.True(t, s.Kick(c2.ID()))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&s.connections))
+}
+
+func TestSubscriptions(t *testing.T) {
+	s, c1, _ := newClientsService()
+
+	tests := []struct {
+		contract uint32
+		pattern  string
+		channels []string
+	}{
+		{pattern: "a/", channels: []string{"a/b/", "a/c/d/"}},
+		{contract: 1, pattern: "a/+/", channels: []string{"a/b/", "a/c/d/"}},
+		{contract: 1, pattern: "a/c/", channels: []string{"a/c/d/"}},
+		{contract: 2, pattern: "a/", channels: nil},
+	}
+
+	for _, tc := range tests {
+		var channels []string
+		for _, sub := range s.Subscriptions(tc.contract, security.ParseChannel([]byte("emitter/"+tc.pattern)), maxListed) {
+			assert.Equal(t, c1.ID(), sub.Subscriber)
+			channels = append(channels, sub.Channel)
+		}
+		assert.Equal(t, tc.channels, channels, tc.pattern)
+	}
+}
+
+func TestOnClients(t *testing.T) {
+	s, _, c2 := newClientsService()
+	tests := []struct {
+		method string
+		url    string
+		code   int
+	}{
+		{method: "POST", url: "/admin/connections", code: 404},
+		{method: "GET", url: "/admin/connections?contract=abc", code: 400},
+		{method: "GET", url: "/admin/connections?limit=0", code: 400},
+		{method: "GET", url: "/admin/connections?contract=2", code: 200},
+		{method: "DELETE", url: "/admin/connections", code: 400},
+		{method: "DELETE", url: "/admin/connections?id=unknown", code: 404},
+		{method: "DELETE", url: "/admin/connections?id=" + c2.ID(), code: 204},
+	}
+
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		s.onClients(rr, httptest.NewRequest(tc.method, tc.url, nil))
+		assert.Equal(t, tc.code, rr.Code, tc.url)
+	}
+}
+
+func TestOnTrie(t *testing.T) {
+	s, _, _ := newClientsService()
+	tests := []struct {
+		method string
+		url    string
+		code   int
+		count  int
+	}{
+		{method: "POST", url: "/admin/trie?pattern=a/", code: 404},
+		{method: "GET", url: "/admin/trie", code: 400},
+		{method: "GET", url: "/admin/trie?pattern=a/&contract=abc", code: 400},
+		{method: "GET", url: "/admin/trie?pattern=a/", code: 200, count: 2},
+		{method: "GET", url: "/admin/trie?pattern=b/&contract=1", code: 200, count: 1},
+	}
+
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		s.onTrie(rr, httptest.NewRequest(tc.method, tc.url, nil))
+		assert.Equal(t, tc.code, rr.Code, tc.url)
+		if tc.code == http.StatusOK {
+			var out []SubscriptionInfo
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &out))
+			assert.Len(t, out, tc.count)
+		}
+	}
+}
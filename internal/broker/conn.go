@@ -16,6 +16,7 @@ package broker
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -23,23 +24,37 @@ import (
 	"runtime/debug"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/emitter-io/emitter/internal/errors"
 	"github.com/emitter-io/emitter/internal/event"
 	"github.com/emitter-io/emitter/internal/message"
 	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/pool"
 	"github.com/emitter-io/emitter/internal/provider/contract"
 	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/provider/tracing"
 	"github.com/emitter-io/emitter/internal/security"
 	"github.com/emitter-io/emitter/internal/service/keygen"
+	"github.com/emitter-io/emitter/internal/service/presence"
+	"github.com/emitter-io/emitter/internal/service/session"
 	"github.com/emitter-io/stats"
 	"github.com/kelindar/binary"
 	"github.com/kelindar/binary/nocopy"
 	"github.com/kelindar/rate"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-const defaultReadRate = 100000
+const (
+	defaultReadRate = 100000
+	idleTimeout     = 120 * time.Second // The time after which a silent connection is closed.
+)
+
+// readers are the reusable read buffers of the connections.
+var readers = pool.New("conn.readers", func() interface{} {
+	return new(bufio.Reader)
+})
 
 type response interface {
 	ForRequest(uint16)
@@ -49,6 +64,11 @@ type response interface {
 type Conn struct {
 	sync.Mutex
 	tracked  uint32            // Whether the connection was already tracked or not.
+	closed   uint32            // Whether the connection was already closed or not.
+	signed   uint32            // Whether the delivered messages are signed or not.
+	headers  uint32            // Whether the delivered messages carry their headers or not.
+	chunks   uint32            // The size of the chunks of the large delivered messages, if enabled.
+	expiry   int64             // The time before the keys expire to warn the client at, in nanoseconds, if enabled.
 	socket   net.Conn          // The transport used to read and write messages.
 	luid     security.ID       // The locally unique id of the connection.
 	guid     string            // The globally unique id of the connection.
@@ -59,7 +79,19 @@ type Conn struct {
 	keys     *keygen.Service   // The key generation provider.
 	connect  *event.Connection // The associated connection event.
 	username string            // The username provided by the client during MQTT connect.
+	meta     map[string]string // The presence metadata provided along with the username.
 	links    map[string]string // The map of all pre-authorized links.
+	session  string            // The key of the durable session, if the clean session flag is off.
+	identity string            // The identity the client is registered with, if it has a client ID.
+	contract uint32            // The contract of the connection, once tracked.
+	features feature           // The protocol features negotiated by the connection.
+	started  int64             // The unix time the connection was opened.
+	admitted uint32            // Whether the connection was admitted for its contract.
+	maxSize  int64             // The maximum size of a packet set by the contract, once tracked.
+	maxBody  int64             // The maximum size of a payload set by the contract, once tracked.
+	timeout  int64             // The read timeout, in nanoseconds, derived from the liveness.
+	live     liveness          // The liveness settings of the listener and of the contract.
+	outbox   *outbox           // The outbound queue of the messages, if enabled.
 }
 
 // NewConn creates a new connection.
@@ -73,6 +105,7 @@ func (s *Service) newConn(t net.Conn, readRate int) *Conn {
 		measurer: s.measurer,
 		links:    map[string]string{},
 		keys:     s.keygen,
+		started:  time.Now().Unix(),
 	}
 
 	// Generate a globally unique id as well
@@ -82,9 +115,16 @@ func (s *Service) newConn(t net.Conn, readRate int) *Conn {
 	}
 
 	c.limit = rate.New(readRate, time.Second)
+	if s.Config != nil && s.Config.Limit.OutboundQueue > 0 {
+		c.outbox = newOutbox(t, &s.Config.Limit, &s.queued, func() {
+			c.Close()
+		})
+	}
 
-	// Increment the connection counter
+	// Increment the connection counter and register the connection
 	atomic.AddInt64(&s.connections, 1)
+	s.conns.Store(c.luid, c)
+	s.measurer.Measure("conn.opened", 1)
 	return c
 }
 
@@ -103,6 +143,11 @@ func (c *Conn) Username() string {
 	return c.username
 }
 
+// Meta returns the presence metadata the client provided along with its username.
+func (c *Conn) Meta() map[string]string {
+	return c.meta
+}
+
 // GetLink checks if the topic is a registered shortcut and expands it.
 func (c *Conn) GetLink(topic []byte) []byte {
 	if len(topic) <= 2 && c.links != nil {
@@ -114,6 +159,28 @@ func (c *Conn) GetLink(topic []byte) []byte {
 // AddLink adds a link alias for a channel.
 func (c *Conn) AddLink(alias string, channel *security.Channel) {
 	c.links[alias] = channel.String()
+	c.negotiate(featureLinks)
+}
+
+// EnableSigning sets whether the messages delivered to the connection are signed.
+func (c *Conn) EnableSigning(enabled bool) {
+	if enabled {
+		atomic.StoreUint32(&c.signed, 1)
+		c.negotiate(featureSigning)
+	} else {
+		atomic.StoreUint32(&c.signed, 0)
+	}
+}
+
+// EnableHeaders sets whether the messages delivered to the connection carry their headers,
+// appended to their channel as options.
+func (c *Conn) EnableHeaders(enabled bool) {
+	if enabled {
+		atomic.StoreUint32(&c.headers, 1)
+		c.negotiate(featureHeaders)
+	} else {
+		atomic.StoreUint32(&c.headers, 0)
+	}
 }
 
 // Links returns a map of all links registered.
@@ -128,7 +195,7 @@ func (c *Conn) Type() message.SubscriberType {
 
 // MeasureElapsed measures elapsed time since
 func (c *Conn) MeasureElapsed(name string, since time.Time) {
-	c.measurer.MeasureElapsed(name, time.Now())
+	c.measurer.MeasureElapsed(name, since)
 }
 
 // Track tracks the connection by adding it to the metering.
@@ -143,6 +210,35 @@ func (c *Conn) Track(contract contract.Contract) {
 
 		// Add the device to the stats and mark as done
 		contract.Stats().AddDevice(addr)
+
+		// Count the protocol features negotiated so far for the contract
+		c.Lock()
+		c.contract = contract.Stats().GetContract()
+		features := c.features
+		c.Unlock()
+
+		// Apply the packet size limit and the liveness settings of the contract
+		limits := contract.Limits()
+		if limits.MaxPacketSize > 0 {
+			atomic.StoreInt64(&c.maxSize, int64(limits.MaxPacketSize))
+		}
+		if limits.MaxMessageSize > 0 {
+			atomic.StoreInt64(&c.maxBody, int64(limits.MaxMessageSize))
+		}
+		c.tune(func(l *liveness) {
+			l.override(limits)
+		})
+
+		// Close the connection if its contract has too many of them already
+		if !c.service.admitContract(c.contract) {
+			logging.LogWarn("conn", "too many connections for the contract, closing", c.fields()...)
+			c.socket.Close()
+			return
+		}
+		atomic.StoreUint32(&c.admitted, 1)
+		if c.service.protocols != nil {
+			c.service.protocols.onConnection(c.contract, features)
+		}
 	}
 }
 
@@ -157,31 +253,141 @@ func (c *Conn) Decrement(ssid message.Ssid) bool {
 }
 
 // Process processes the messages.
-func (c *Conn) Process() error {
-	defer c.Close()
-	reader := bufio.NewReaderSize(c.socket, 65536)
+func (c *Conn) Process() (err error) {
+	parked := false
+	defer func() {
+		if r := recover(); r != nil {
+			logging.LogError("conn", "processing", fmt.Errorf("panic recovered: %s \n %s", r, debug.Stack()), c.fields()...)
+			parked = false
+		}
+
+		if !parked {
+			c.Close()
+		}
+	}()
+
+	parked, err = c.process()
+	return
+}
+
+// process reads and handles the incoming packets until the connection fails, or until it
+// is parked once idle.
+func (c *Conn) process() (parked bool, err error) {
+	size := c.service.Config.Limit.ReadBufferSize()
+	reader := readers.Get().(*bufio.Reader)
+	if reader.Size() != size {
+		reader = bufio.NewReaderSize(nil, size)
+	}
+
+	reader.Reset(c.socket)
+	defer func() {
+		reader.Reset(nil)
+		readers.Put(reader)
+	}()
+
 	maxSize := c.service.Config.MaxMessageBytes()
+	idle := c.idlePeriod()
 	for {
 		// Set read/write deadlines so we can close dangling connections
-		c.socket.SetDeadline(time.Now().Add(time.Second * 120))
+		timeout := c.readTimeout()
+		c.socket.SetDeadline(time.Now().Add(timeout))
 		if c.limit.Limit() {
 			time.Sleep(50 * time.Millisecond)
 			continue
 		}
 
-		// Decode an incoming MQTT packet
-		msg, err := mqtt.DecodePacket(reader, maxSize)
-		if err != nil {
-			return err
+		// Wait for the next packet and park the connection if it stays idle
+		if idle > 0 && idle < timeout && reader.Buffered() == 0 {
+			idled, err := c.awaitPacket(reader, idle, timeout)
+			switch {
+			case err != nil:
+				return false, err
+			case idled && c.service.poller.Wait(c.socket, timeout-idle, c.onReadable) == nil:
+				return true, nil
+			case idled:
+				idle = 0 // The connection can not be polled
+			}
+		}
+
+		// Decode an incoming MQTT packet, skipping the publications whose payload is larger
+		// than the contract allows before they are read into memory
+		limit, maxBody := c.packetLimit(maxSize), atomic.LoadInt64(&c.maxBody)
+		msg, err := mqtt.DecodePacketLimited(reader, limit, maxBody)
+		switch err {
+		case nil:
+		case mqtt.ErrPayloadTooLarge:
+			c.onOversized(int(maxBody))
+			continue
+		case mqtt.ErrMessageTooLarge:
+			c.notifyError(errors.ErrPacketTooLarge.WithMaxSize(int(limit)), 0)
+			return false, err
+		default:
+			return false, err
 		}
 
 		// Handle the receive
 		if err := c.onReceive(msg); err != nil {
-			return err
+			return false, err
 		}
 	}
 }
 
+// packetLimit returns the maximum size of the next packet, which is the smallest of the
+// limit of the broker and the one of the contract of the connection.
+func (c *Conn) packetLimit(limit int64) int64 {
+	if max := atomic.LoadInt64(&c.maxSize); max > 0 && (limit <= 0 || max < limit) {
+		return max
+	}
+	return limit
+}
+
+// onOversized occurs when a publication whose payload is larger than the maximum size allowed
+// by the contract was skipped. The client is notified and the rejection is counted, so that
+// the tenants pushing the large messages can be found.
+func (c *Conn) onOversized(maxSize int) {
+	c.measurer.Measure("publish.oversized", 1)
+	logging.LogWarn("conn", "message too large for the contract, skipped", c.fields()...)
+	c.notifyError(errors.ErrMessageTooLarge.WithMaxSize(maxSize), 0)
+}
+
+// awaitPacket waits for the next packet without reading it, and returns whether nothing was
+// received within the idle period.
+func (c *Conn) awaitPacket(reader *bufio.Reader, idle, timeout time.Duration) (bool, error) {
+	c.socket.SetReadDeadline(time.Now().Add(idle))
+	defer c.socket.SetReadDeadline(time.Now().Add(timeout))
+
+	_, err := reader.Peek(1)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return true, nil
+	}
+	return false, err
+}
+
+// idlePeriod returns the time after which the connection is parked, or zero if it is
+// never parked.
+func (c *Conn) idlePeriod() time.Duration {
+	if c.service.poller == nil {
+		return 0
+	}
+
+	idle := c.service.Config.Limit.IdlePeriod()
+	if _, ok := c.socket.(syscall.Conn); !ok || idle >= c.readTimeout() {
+		return 0
+	}
+	return idle
+}
+
+// onReadable occurs when a parked connection becomes readable again, or stayed idle until
+// it timed out.
+func (c *Conn) onReadable(ready bool) {
+	if !ready {
+		c.Close()
+		return
+	}
+
+	c.Process()
+}
+
 // onReceive handles an MQTT receive.
 func (c *Conn) onReceive(msg mqtt.Message) error {
 	defer c.MeasureElapsed("rcv."+msg.String(), time.Now())
@@ -189,17 +395,29 @@ func (c *Conn) onReceive(msg mqtt.Message) error {
 
 	// We got an attempt to connect to MQTT.
 	case mqtt.TypeOfConnect:
-		var result uint8
-		if !c.onConnect(msg.(*mqtt.Connect)) {
-			result = 0x05 // Unauthorized
+		result := c.onConnect(msg.(*mqtt.Connect))
+		if result != 0 {
+			ack := mqtt.Connack{ReturnCode: result}
+			ack.EncodeTo(c.socket)
+			return fmt.Errorf("connection refused with the code %d", result)
 		}
 
-		// Write the ack
-		ack := mqtt.Connack{ReturnCode: result}
+		// Write the ack, along with whether an offline session is present
+		var offline *session.Offline
+		var present bool
+		if c.session != "" {
+			offline, present = c.service.sessions.Take(c.session)
+		}
+		ack := mqtt.Connack{ReturnCode: result, SessionPresent: present}
 		if _, err := ack.EncodeTo(c.socket); err != nil {
 			return err
 		}
 
+		// Restore the offline session once the client knows that it is present
+		if present {
+			c.service.sessions.Restore(offline, c)
+		}
+
 	// We got an attempt to subscribe to a channel.
 	case mqtt.TypeOfSubscribe:
 		packet := msg.(*mqtt.Subscribe)
@@ -210,6 +428,7 @@ func (c *Conn) onReceive(msg mqtt.Message) error {
 
 		// Subscribe for each subscription
 		for _, sub := range packet.Subscriptions {
+			c.negotiate(featureOfQoS(sub.Qos))
 			if err := c.service.pubsub.OnSubscribe(c, sub.Topic); err != nil {
 				ack.Qos = append(ack.Qos, 0x80) // 0x80 indicate subscription failure
 				c.notifyError(err, packet.MessageID)
@@ -254,8 +473,16 @@ func (c *Conn) onReceive(msg mqtt.Message) error {
 
 	case mqtt.TypeOfPublish:
 		packet := msg.(*mqtt.Publish)
+		c.negotiate(featureOfQoS(packet.Header.QOS))
+		atomic.AddInt64(&c.service.received, 1)
+		atomic.AddInt64(&c.service.ingress, int64(len(packet.Payload)))
 		if err := c.service.pubsub.OnPublish(c, packet); err != nil {
-			logging.LogError("conn", "publish received", err)
+			if err.Status == errors.ErrMessageTooLarge.Status { // Too large for the contract or the reassembly
+				c.measurer.Measure("publish.oversized", 1)
+			}
+			if err != errors.ErrNoSubscribers { // Not a failure, but the notification the publisher asked for
+				logging.LogError("conn", "publish received", err, c.fields()...)
+			}
 			c.notifyError(err, packet.MessageID)
 		}
 
@@ -274,13 +501,61 @@ func (c *Conn) onReceive(msg mqtt.Message) error {
 // Send forwards the message to the underlying client.
 func (c *Conn) Send(m *message.Message) (err error) {
 	defer c.MeasureElapsed("send.pub", time.Now())
+
+	// Skip the messages which none of the filtered subscriptions select (e.g: 'filter=temp>50')
+	if !c.subs.Selects(m.ID, m.Payload) {
+		return nil
+	}
+
+	c.subs.Attribute(m.ID)
+	payload := m.Payload
+	if atomic.LoadUint32(&c.signed) == 1 && c.service.signing != nil {
+		payload = c.service.signing.Sign(m.Channel, m.Payload)
+	}
+
+	topic := m.Channel
+	if len(m.Headers) > 0 && atomic.LoadUint32(&c.headers) == 1 {
+		topic = []byte(string(m.Channel) + "?" + m.Headers.Options())
+	}
+
+	// Deliver the large messages in chunks, if the client asked for it
+	if size := int(atomic.LoadUint32(&c.chunks)); size > 0 && len(payload) > size {
+		return c.sendChunks(m.ID, topic, payload, size)
+	}
+	return c.write(topic, payload)
+}
+
+// write writes a publish packet to the client, or queues it if the outbound queue is enabled.
+func (c *Conn) write(topic, payload []byte) (err error) {
 	packet := mqtt.Publish{
 		Header:  mqtt.Header{QOS: 0},
-		Topic:   m.Channel, // The channel for this message.
-		Payload: m.Payload, // The payload for this message.
+		Topic:   topic,   // The channel for this message.
+		Payload: payload, // The payload for this message.
+	}
+
+	atomic.AddInt64(&c.service.sent, 1)
+	atomic.AddInt64(&c.service.egress, int64(len(payload)))
+	if c.outbox == nil {
+		_, err = packet.EncodeTo(c.socket)
+		return
 	}
 
-	_, err = packet.EncodeTo(c.socket)
+	// Queue the packet, so the publisher does not wait for a slow client
+	buffer := getPacket()
+	if _, err = packet.EncodeTo(buffer); err != nil {
+		putPacket(buffer)
+		return
+	}
+
+	switch c.outbox.Push(buffer) {
+	case pushDropped:
+		c.measurer.Measure("conn.dropped", 1)
+	case pushOverflow:
+		c.measurer.Measure("conn.overflow", 1)
+		go c.Close()
+	case pushSlow:
+		go c.evict(reasonSlowConsumer)
+	}
 	return
 }
 
@@ -292,7 +567,7 @@ func (c *Conn) notifyError(err *errors.Error, requestID uint16) {
 func (c *Conn) sendResponse(topic string, resp response, requestID uint16) {
 	switch m := resp.(type) {
 	case *errors.Error:
-		cpy := m.Copy()
+		cpy := c.service.withAdvice(m)
 		cpy.ForRequest(requestID)
 		resp = cpy
 	default:
@@ -316,6 +591,11 @@ func (c *Conn) CanSubscribe(ssid message.Ssid, channel []byte) bool {
 	return c.subs.Increment(ssid, channel)
 }
 
+// Subscriptions returns the subscriptions of this connection.
+func (c *Conn) Subscriptions() *message.Counters {
+	return c.subs
+}
+
 // CanUnsubscribe decrements the internal counters and checks if the cluster
 // needs to be notified.
 func (c *Conn) CanUnsubscribe(ssid message.Ssid, channel []byte) bool {
@@ -324,9 +604,27 @@ func (c *Conn) CanUnsubscribe(ssid message.Ssid, channel []byte) bool {
 	return c.subs.Decrement(ssid)
 }
 
-// onConnect handles the connection authorization
-func (c *Conn) onConnect(packet *mqtt.Connect) bool {
-	c.username = string(packet.Username)
+// onConnect handles the connection authorization and returns the return code of the
+// acknowledgement, which is zero if the connection is accepted.
+func (c *Conn) onConnect(packet *mqtt.Connect) uint8 {
+	_, span := tracing.Start(context.Background(), "connect", attribute.String("client", string(packet.ClientID)))
+	defer span.End()
+
+	// The username can be followed by the presence metadata (e.g: 'alice?status=away')
+	c.username, c.meta = presence.SplitUsername(string(packet.Username))
+	c.tune(func(l *liveness) {
+		l.keepalive = time.Duration(packet.KeepAlive) * time.Second
+	})
+
+	// Apply the takeover policy if the client is already connected
+	var identity string
+	if len(packet.ClientID) > 0 {
+		identity = session.Key(packet.ClientID, []byte(c.username), packet.Password)
+		if !c.takeover(string(packet.ClientID), identity) {
+			return 0x02 // Identifier rejected
+		}
+	}
+
 	c.connect = &event.Connection{
 		Peer:        c.service.ID(),
 		Conn:        c.luid,
@@ -339,17 +637,81 @@ func (c *Conn) onConnect(packet *mqtt.Connect) bool {
 		Username:    packet.Username,
 	}
 
+	logging.LogDebug("conn", "connected", logging.Conn(c.guid), logging.Client(string(packet.ClientID)), logging.Remote(c.remoteAddr()))
+
+	// Record the protocol level and the options the client connected with
+	features := featureOfLevel(packet.Version)
+	if packet.WillFlag {
+		features |= featureWill
+	}
+	if len(packet.ClientID) > 0 && !packet.CleanSeshFlag {
+		features |= featureSession
+	}
+	c.negotiate(features)
+
+	// Keep the session while the client is offline, unless it asks for a clean one
+	if identity != "" && c.service.sessions != nil {
+		if packet.CleanSeshFlag {
+			c.service.sessions.Discard(identity)
+		} else {
+			c.session = identity
+		}
+	}
+
 	if c.service.cluster != nil {
 		c.service.cluster.Notify(c.connect, true)
 	}
-	return true
+	return 0
+}
+
+// remoteAddr returns the address of the client, which is the one sent by the load balancer
+// in front of the broker if the PROXY protocol is enabled.
+func (c *Conn) remoteAddr() string {
+	if c.socket != nil && c.socket.RemoteAddr() != nil {
+		return c.socket.RemoteAddr().String()
+	}
+	return ""
+}
+
+// fields returns the identifiers of the connection, attached to its log entries.
+func (c *Conn) fields() []logging.Field {
+	c.Lock()
+	defer c.Unlock()
+
+	fields := []logging.Field{logging.Conn(c.guid)}
+	if c.connect != nil && len(c.connect.ClientID) > 0 {
+		fields = append(fields, logging.Client(string(c.connect.ClientID)))
+	}
+	if c.contract != 0 {
+		fields = append(fields, logging.Contract(c.contract))
+	}
+	return fields
 }
 
 // Close terminates the connection.
 func (c *Conn) Close() error {
-	atomic.AddInt64(&c.service.connections, -1)
 	if r := recover(); r != nil {
-		logging.LogAction("closing", fmt.Sprintf("panic recovered: %s \n %s", r, debug.Stack()))
+		logging.LogError("conn", "closing", fmt.Errorf("panic recovered: %s \n %s", r, debug.Stack()), c.fields()...)
+	}
+
+	// The connection might be closed by the service while it's still processing
+	if !atomic.CompareAndSwapUint32(&c.closed, 0, 1) {
+		return nil
+	}
+
+	atomic.AddInt64(&c.service.connections, -1)
+	c.measurer.Measure("conn.closed", 1)
+	c.service.conns.Delete(c.luid)
+	if c.identity != "" {
+		c.service.clients.Unregister(c.identity, c)
+	}
+	if atomic.LoadUint32(&c.admitted) == 1 {
+		c.service.access.ReleaseContract(c.contract)
+	}
+
+	// Keep the subscriptions of a durable session while the client is offline
+	if c.session != "" {
+		c.service.sessions.Park(c.session, c, c.sessionExpiry())
 	}
 
 	// Unsubscribe from everything, no need to lock since each Unsubscribe is
@@ -367,6 +729,11 @@ func (c *Conn) Close() error {
 	// Publish last will
 	c.service.pubsub.OnLastWill(c, c.connect)
 
-	//logging.LogTarget("conn", "closed", c.guid)
+	// Stop waiting for the connection if it was parked, before its descriptor can be reused
+	if c.service.poller != nil {
+		c.service.poller.Remove(c.socket)
+	}
+
+	logging.LogDebug("conn", "closed", c.fields()...)
 	return c.socket.Close()
 }
@@ -15,13 +15,24 @@
 package broker
 
 import (
+	"bufio"
+	"crypto/ed25519"
+	"io"
 	"io/ioutil"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/emitter-io/emitter/internal/config"
 	"github.com/emitter-io/emitter/internal/errors"
 	"github.com/emitter-io/emitter/internal/message"
 	netmock "github.com/emitter-io/emitter/internal/network/mock"
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/network/poll"
 	"github.com/emitter-io/emitter/internal/security/license"
+	"github.com/emitter-io/emitter/internal/security/sign"
+	"github.com/emitter-io/emitter/internal/service/signing"
 	"github.com/emitter-io/stats"
 	"github.com/stretchr/testify/assert"
 )
@@ -52,3 +63,149 @@ func TestNotifyError(t *testing.T) {
 	assert.Contains(t, string(b), errors.ErrUnauthorized.Message)
 	assert.NoError(t, err)
 }
+
+func TestConn_SendSigned(t *testing.T) {
+	pipe, conn := newTestConn()
+	signer, err := sign.New(1, "")
+	assert.NoError(t, err)
+	conn.service.signing = signing.New(signer, nil)
+	conn.EnableSigning(true)
+
+	go func() {
+		conn.Send(message.New(message.Ssid{1, 2, 3}, []byte("a/b/c/"), []byte("hello")))
+		conn.Close()
+	}()
+
+	b, err := ioutil.ReadAll(pipe.Server)
+	assert.NoError(t, err)
+	assert.True(t, len(b) > sign.TrailerSize)
+
+	// The signed payload is at the end of the packet
+	payload, node, _, err := sign.Verify([]byte("a/b/c/"), b[len(b)-5-sign.TrailerSize:], func(uint64) ed25519.PublicKey {
+		return signer.PublicKey()
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), node)
+	assert.Equal(t, "hello", string(payload))
+}
+
+func TestConn_SendHeaders(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		pipe, conn := newTestConn()
+		conn.EnableHeaders(enabled)
+
+		msg := message.New(message.Ssid{1, 2, 3}, []byte("a/b/c/"), []byte("hello"))
+		msg.Headers = message.Headers{"trace": "abc"}
+		go func() {
+			conn.Send(msg)
+			conn.Close()
+		}()
+
+		b, err := ioutil.ReadAll(pipe.Server)
+		assert.NoError(t, err)
+		assert.Equal(t, enabled, strings.Contains(string(b), "a/b/c/?h-trace=abc"))
+		assert.Equal(t, "a/b/c/", string(msg.Channel))
+	}
+}
+
+func TestConn_Meta(t *testing.T) {
+	_, conn := newTestConn()
+	conn.onConnect(&mqtt.Connect{Version: 4, Username: []byte("alice?status=away&device=mobile")})
+
+	assert.Equal(t, "alice", conn.Username())
+	assert.Equal(t, map[string]string{"status": "away", "device": "mobile"}, conn.Meta())
+}
+
+func TestConn_SessionDisabled(t *testing.T) {
+	_, conn := newTestConn()
+
+	// Without the sessions configured, the session of the client is not kept
+	assert.Equal(t, uint8(0), conn.onConnect(&mqtt.Connect{Version: 4, ClientID: []byte("a")}))
+	assert.Empty(t, conn.session)
+}
+
+func TestConn_PacketLimit(t *testing.T) {
+	tests := []struct {
+		broker   int64
+		contract int64
+		expect   int64
+	}{
+		{broker: 1024, contract: 0, expect: 1024},
+		{broker: 1024, contract: 512, expect: 512},
+		{broker: 1024, contract: 2048, expect: 1024},
+		{broker: 0, contract: 512, expect: 512},
+	}
+
+	for _, tc := range tests {
+		_, conn := newTestConn()
+		conn.maxSize = tc.contract
+		assert.Equal(t, tc.expect, conn.packetLimit(tc.broker))
+	}
+}
+
+func TestConn_Oversized(t *testing.T) {
+	pipe, conn := newTestConn()
+	conn.service.Config = new(config.Config)
+	conn.maxBody = 5
+	go conn.Process()
+	defer conn.Close()
+
+	go func() {
+		(&mqtt.Publish{Topic: []byte("a/b/c/"), Payload: []byte("hello world")}).EncodeTo(pipe.Server)
+		(&mqtt.Pingreq{}).EncodeTo(pipe.Server)
+	}()
+
+	// The message too large is refused, while the connection carries on
+	reader := bufio.NewReader(pipe.Server)
+	msg, err := mqtt.DecodePacket(reader, 65536)
+	assert.NoError(t, err)
+	assert.Equal(t, "emitter/error/", string(msg.(*mqtt.Publish).Topic))
+	assert.Contains(t, string(msg.(*mqtt.Publish).Payload), `"maxSize":5`)
+
+	msg, err = mqtt.DecodePacket(reader, 65536)
+	assert.NoError(t, err)
+	assert.Equal(t, mqtt.TypeOfPingresp, msg.Type())
+}
+
+func TestConn_Park(t *testing.T) {
+	poller, err := poll.New()
+	if err == poll.ErrUnsupported {
+		t.Skip(err)
+	}
+	defer poller.Close()
+
+	s := &Service{
+		Config:        &config.Config{Limit: config.LimitConfig{IdleAfter: 1}},
+		subscriptions: message.NewTrie(),
+		measurer:      stats.NewNoop(),
+		poller:        poller,
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	server, err := l.Accept()
+	assert.NoError(t, err)
+	conn := s.newConn(server, 0)
+	go conn.Process()
+
+	// The idle connection is parked
+	assert.Eventually(t, func() bool {
+		return poller.Len() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A parked connection is resumed once a packet is received
+	_, err = client.Write([]byte{0xc0, 0x00}) // PINGREQ
+	assert.NoError(t, err)
+
+	resp := make([]byte, 2)
+	_, err = io.ReadFull(client, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xd0, 0x00}, resp) // PINGRESP
+	assert.Equal(t, 0, poller.Len())
+}
@@ -0,0 +1,75 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+)
+
+const refuseTimeout = time.Second // The time given to write the refusal of a connection.
+
+// isExhausted returns whether the file descriptors are exhausted and the new connections
+// should be refused.
+func (s *Service) isExhausted() bool {
+	return s.descriptors != nil && s.descriptors.Exhausted()
+}
+
+// refuse refuses a new connection while the file descriptors are exhausted. Since nothing
+// was read yet, the client is told right away that the server is unavailable, which is the
+// acknowledgement an MQTT client expects to its connection request.
+func (s *Service) refuse(t net.Conn) {
+	s.measurer.Measure("conn.refused", 1)
+	defer t.Close()
+
+	t.SetWriteDeadline(time.Now().Add(refuseTimeout))
+	ack := mqtt.Connack{ReturnCode: 0x03} // Server unavailable
+	ack.EncodeTo(t)
+}
+
+// Occurs when the file descriptors become exhausted or are available again.
+func (s *Service) onDescriptors(exhausted bool, used, limit int) {
+	switch {
+	case exhausted && limit > 0:
+		logging.LogWarn("service", fmt.Sprintf("running out of file descriptors (%d of %d used), refusing the new connections", used, limit))
+	case exhausted:
+		logging.LogWarn("service", "ran out of file descriptors, refusing the new connections")
+	default:
+		logging.LogAction("service", fmt.Sprintf("file descriptors available again (%d of %d used), accepting the new connections", used, limit))
+	}
+}
+
+// onListenerErrorOf returns the error handler of a listener, which counts its errors.
+func (s *Service) onListenerErrorOf(name string) func(error) bool {
+	return func(err error) bool {
+		s.measurer.Measure("listener.error."+name, 1)
+		return s.onListenerError(err)
+	}
+}
+
+// Occurs when the listener fails to accept a connection. If the process ran out of file
+// descriptors, the new connections are refused until some of them are closed.
+func (s *Service) onListenerError(err error) bool {
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) {
+		s.descriptors.Exhaust()
+	}
+	return true
+}
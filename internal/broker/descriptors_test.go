@@ -0,0 +1,69 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	netmock "github.com/emitter-io/emitter/internal/network/mock"
+	"github.com/emitter-io/emitter/internal/service/overload"
+	"github.com/emitter-io/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestExhausted(t *testing.T) *Service {
+	descriptors := overload.NewDescriptors(0.9, nil)
+	descriptors.Close()
+
+	s := &Service{
+		measurer:    stats.NewNoop(),
+		descriptors: descriptors,
+	}
+
+	// Running out of descriptors while accepting exhausts them
+	assert.True(t, s.onListenerErrorOf("tcp")(fmt.Errorf("accept: %w", syscall.EMFILE)))
+	return s
+}
+
+func TestDescriptors_Refuse(t *testing.T) {
+	s := &Service{measurer: stats.NewNoop()}
+	assert.False(t, s.isExhausted())
+
+	s = newTestExhausted(t)
+	assert.True(t, s.isExhausted())
+
+	// The MQTT client is told that the server is unavailable
+	pipe := netmock.NewConn()
+	go s.onAcceptConn(pipe.Client, "tcp")
+
+	b, err := ioutil.ReadAll(pipe.Server)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x20, 0x02, 0x00, 0x03}, b)
+}
+
+func TestDescriptors_RefuseHTTP(t *testing.T) {
+	s := newTestExhausted(t)
+	rr := httptest.NewRecorder()
+	s.onRequest(rr, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), errors.ErrExhausted.Message)
+}
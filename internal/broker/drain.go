@@ -0,0 +1,129 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/provider/logging"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second // The default time given to the clients to leave.
+	drainFlushTimeout   = 5 * time.Second  // The maximum time given to the in-flight messages.
+)
+
+// drainNotice represents a notice sent to the connected clients when the node is drained.
+type drainNotice struct {
+	Request    uint16   `json:"req,omitempty"`       // The corresponding request ID.
+	Status     int      `json:"status"`              // The status of the notice.
+	Message    string   `json:"message"`             // The message of the notice.
+	Redirect   string   `json:"redirect,omitempty"`  // The address of the server to reconnect to.
+	RetryAfter int      `json:"retryAfter"`          // The number of seconds to wait before reconnecting.
+	Endpoints  []string `json:"endpoints,omitempty"` // The alternate endpoints to reconnect to.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *drainNotice) ForRequest(id uint16) {
+	r.Request = id
+}
+
+// isDraining returns whether the service is being drained.
+func (s *Service) isDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// Drain gracefully drains the node. It stops accepting new connections, asks all of the
+// connected clients to reconnect elsewhere and waits for them to leave. The clients which
+// are still connected once the timeout elapses are disconnected. Finally, the node leaves
+// the cluster. This returns false if the node is already being drained.
+func (s *Service) Drain(redirect string, timeout time.Duration) bool {
+	if !atomic.CompareAndSwapInt32(&s.draining, 0, 1) {
+		return false
+	}
+
+	// Ask every connected client to reconnect elsewhere
+	logging.LogTarget("service", "draining the node, redirecting to", redirect)
+	advice := s.advice()
+	notice := &drainNotice{
+		Status:     http.StatusServiceUnavailable,
+		Message:    "the server is shutting down, please reconnect",
+		Redirect:   redirect,
+		RetryAfter: advice.RetryAfter,
+		Endpoints:  advice.Endpoints,
+	}
+
+	s.conns.Range(func(_, v interface{}) bool {
+		v.(*Conn).sendResponse("emitter/drain/", notice, 0)
+		return true
+	})
+
+	// Wait for the clients to leave on their own
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		if atomic.LoadInt64(&s.connections) <= 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Disconnect the remaining clients
+	s.conns.Range(func(_, v interface{}) bool {
+		v.(*Conn).Close()
+		return true
+	})
+
+	// Wait for the in-flight messages to be delivered, flush them along with the
+	// unsubscriptions to the peers, then leave the cluster.
+	if s.scheduler != nil && !s.scheduler.Wait(drainFlushTimeout) {
+		logging.LogAction("service", "in-flight messages still queued after the drain timeout")
+	}
+
+	if s.cluster != nil {
+		s.cluster.Flush()
+		dispose(s.cluster)
+	}
+
+	logging.LogAction("service", "node drained")
+	return true
+}
+
+// Occurs when a new HTTP drain request is received.
+func (s *Service) onDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	timeout := defaultDrainTimeout
+	if v := r.FormValue("timeout"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	if s.isDraining() {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	go s.Drain(r.FormValue("redirect"), timeout)
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,98 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	netmock "github.com/emitter-io/emitter/internal/network/mock"
+	"github.com/emitter-io/emitter/internal/security/license"
+	"github.com/emitter-io/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrain(t *testing.T) {
+	license, _ := license.Parse(testLicense)
+	s := &Service{
+		subscriptions: message.NewTrie(),
+		License:       license,
+		measurer:      stats.NewNoop(),
+	}
+
+	pipe := netmock.NewConn()
+	s.newConn(pipe.Client, 0)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&s.connections))
+
+	received := make(chan string, 1)
+	go func() {
+		b, _ := ioutil.ReadAll(pipe.Server)
+		received <- string(b)
+	}()
+
+	assert.True(t, s.Drain("10.0.0.1:8080", 100*time.Millisecond))
+	assert.False(t, s.Drain("10.0.0.1:8080", 0))
+	assert.Equal(t, int64(0), atomic.LoadInt64(&s.connections))
+
+	out := <-received
+	assert.Contains(t, out, "emitter/drain/")
+	assert.Contains(t, out, `"redirect":"10.0.0.1:8080"`)
+	assert.Contains(t, out, `"retryAfter":5`)
+
+	// New connections must be rejected
+	pipe = netmock.NewConn()
+	s.onAcceptConn(pipe.Client, "tcp")
+	assert.Equal(t, int64(0), atomic.LoadInt64(&s.connections))
+
+	// Health must be reported as unavailable
+	rr := httptest.NewRecorder()
+	s.onHealth(rr, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+func TestOnDrain(t *testing.T) {
+	tests := []struct {
+		method   string
+		body     string
+		draining int32
+		code     int
+	}{
+		{method: "GET", code: 404},
+		{method: "POST", body: "timeout=abc", code: 400},
+		{method: "POST", body: "timeout=-1", code: 400},
+		{method: "POST", draining: 1, code: 409},
+		{method: "POST", body: "timeout=0&redirect=host", code: 202},
+	}
+
+	for _, tc := range tests {
+		s := &Service{
+			subscriptions: message.NewTrie(),
+			measurer:      stats.NewNoop(),
+			draining:      tc.draining,
+		}
+
+		req := httptest.NewRequest(tc.method, "/admin/drain", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		s.onDrain(rr, req)
+		assert.Equal(t, tc.code, rr.Code)
+	}
+}
@@ -0,0 +1,48 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"net"
+
+	"github.com/emitter-io/emitter/internal/network/listener"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+)
+
+// inprocName is the name of the connections opened from within the process, for which no
+// listener settings apply.
+const inprocName = "inproc"
+
+// Serve serves the HTTP and the MQTT connections accepted by a listener created by the
+// program embedding the broker, under the name given to it in the configuration (e.g: the
+// liveness settings). The listener is closed along with the service.
+func (s *Service) Serve(name string, l net.Listener) error {
+	options, err := s.listenerConfig(name, nil)
+	if err != nil {
+		return err
+	}
+
+	logging.LogTarget("service", "serving the listener", l.Addr())
+	s.serve(name, listener.Wrap(l, options))
+	return nil
+}
+
+// Dial opens a connection to the broker from within the process, which bypasses the network
+// and the listeners while speaking MQTT as any other client.
+func (s *Service) Dial() net.Conn {
+	client, server := net.Pipe()
+	s.onAcceptConn(server, inprocName)
+	return client
+}
@@ -0,0 +1,62 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbedded(t *testing.T) {
+	cfg := config.NewDefault().(*config.Config)
+	cfg.License = testLicense
+	cfg.ListenAddr = "127.0.0.1:0"
+	cfg.TLS = nil
+	cfg.Cluster = nil
+
+	s, err := NewService(context.Background(), cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+
+	// Serve the clients on a listener of the embedding program as well
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Serve("tcp", l))
+
+	remote, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	defer remote.Close()
+
+	for i, conn := range []net.Conn{s.Dial(), remote} {
+		connect := mqtt.Connect{ClientID: []byte{'a' + byte(i)}}
+		_, err := connect.EncodeTo(conn)
+		assert.NoError(t, err)
+
+		pkt, err := mqtt.DecodePacket(bufio.NewReader(conn), 65536)
+		assert.NoError(t, err)
+		assert.Equal(t, mqtt.TypeOfConnack, pkt.Type())
+	}
+
+	// The listeners are closed along with the service
+	s.Close()
+	_, err = net.Dial("tcp", l.Addr().String())
+	assert.Error(t, err)
+}
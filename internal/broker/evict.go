@@ -0,0 +1,64 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/provider/logging"
+)
+
+// The reasons a client is evicted for.
+const (
+	reasonSlowConsumer = "slow consumer" // The client does not read its messages fast enough.
+)
+
+// Eviction represents the event published on the "emitter/conn/evicted/" channel when a
+// client is disconnected by the broker.
+type Eviction struct {
+	ID       string `json:"id"`                 // The unique identifier of the connection.
+	Contract uint32 `json:"contract,omitempty"` // The contract of the client, once tracked.
+	Username string `json:"username,omitempty"` // The username provided on connect.
+	Remote   string `json:"remote,omitempty"`   // The remote address of the client.
+	Reason   string `json:"reason"`             // The reason of the eviction.
+	Queued   int    `json:"queued,omitempty"`   // The number of messages in the outbound queue.
+	Dropped  int64  `json:"dropped,omitempty"`  // The number of messages dropped from the outbound queue.
+	Time     int64  `json:"time"`               // The unix time of the eviction.
+}
+
+// evict disconnects the client for a reason, which is logged and published on the system
+// channel so the operators know why the client was disconnected.
+func (c *Conn) evict(reason string) {
+	info := c.info()
+	ev := Eviction{
+		ID:       info.ID,
+		Contract: info.Contract,
+		Username: info.Username,
+		Remote:   info.Remote,
+		Reason:   reason,
+		Queued:   info.Queued,
+		Dropped:  info.Dropped,
+		Time:     time.Now().Unix(),
+	}
+
+	c.measurer.Measure("conn.evicted", 1)
+	logging.LogWarn("conn", "evicted, "+reason, c.fields()...)
+	if payload, err := json.Marshal(ev); err == nil && c.service.pubsub != nil {
+		c.service.selfPublish("conn/evicted/", payload)
+	}
+
+	c.Close()
+}
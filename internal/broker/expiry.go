@@ -0,0 +1,72 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const expiryInterval = 15 * time.Second // The interval between the checks of the expiring keys.
+
+// expiryNotice represents a notice sent to a client before the key of one of its
+// subscriptions expires.
+type expiryNotice struct {
+	Request   uint16 `json:"req,omitempty"` // The corresponding request ID.
+	Status    int    `json:"status"`        // The status of the notice.
+	Channel   string `json:"channel"`       // The channel of the subscription.
+	Expires   int64  `json:"expires"`       // The unix time the key expires at.
+	Remaining int64  `json:"remaining"`     // The number of seconds left before the key expires.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *expiryNotice) ForRequest(id uint16) {
+	r.Request = id
+}
+
+// WarnExpiry sets how long before the keys of the subscriptions expire the client is warned
+// about it on the 'emitter/expiry/' channel, or disables the warnings if zero.
+func (c *Conn) WarnExpiry(before time.Duration) {
+	atomic.StoreInt64(&c.expiry, int64(before))
+	if before > 0 {
+		c.negotiate(featureExpiry)
+	}
+}
+
+// warnExpiring warns the clients which asked for it about the keys of their subscriptions
+// which are about to expire, once per key.
+func (s *Service) warnExpiring() {
+	now := time.Now()
+	s.conns.Range(func(_, v interface{}) bool {
+		c := v.(*Conn)
+		if before := time.Duration(atomic.LoadInt64(&c.expiry)); before > 0 {
+			for _, sub := range c.subs.Expiring(now.Add(before).Unix()) {
+				remaining := sub.Expires - now.Unix()
+				if remaining < 0 {
+					remaining = 0
+				}
+
+				s.measurer.Measure("key.expiring", 1)
+				c.sendResponse("emitter/expiry/", &expiryNotice{
+					Status:    200,
+					Channel:   string(sub.Channel),
+					Expires:   sub.Expires,
+					Remaining: remaining,
+				}, 0)
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,55 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarnExpiring(t *testing.T) {
+	pipe, conn := newTestConn()
+	expires := time.Now().Add(2 * time.Minute).Unix()
+	conn.subs.Increment(message.Ssid{1, 2}, []byte("a/b/"))
+	conn.subs.SetExpires(message.Ssid{1, 2}, expires)
+	conn.subs.Increment(message.Ssid{1, 3}, []byte("c/"))
+	conn.subs.SetExpires(message.Ssid{1, 3}, time.Now().Add(time.Hour).Unix())
+
+	// Nothing is sent unless the client asked for it
+	conn.service.warnExpiring()
+	assert.Len(t, conn.subs.Expiring(expires), 1)
+	conn.subs.SetExpires(message.Ssid{1, 2}, expires)
+
+	conn.WarnExpiry(5 * time.Minute)
+	assert.NotZero(t, conn.features&featureExpiry)
+	go func() {
+		conn.service.warnExpiring()
+		conn.service.warnExpiring()
+		conn.Close()
+	}()
+
+	// The client is warned once about the key which expires within the window
+	b, err := ioutil.ReadAll(pipe.Server)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "emitter/expiry/")
+	assert.Contains(t, string(b), `"channel":"a/b/"`)
+	assert.NotContains(t, string(b), `"channel":"c/"`)
+	assert.Equal(t, 1, strings.Count(string(b), "emitter/expiry/"))
+}
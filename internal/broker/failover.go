@@ -0,0 +1,132 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/errors"
+)
+
+const defaultRetryAfter = 5 // The default number of seconds to wait before retrying.
+
+// retryAdvice represents the retry guidance given to the clients which are rejected
+// because the node is overloaded or under maintenance.
+type retryAdvice struct {
+	RetryAfter int      `json:"retryAfter"` // The number of seconds to wait before retrying.
+	Endpoints  []string `json:"endpoints"`  // The alternate endpoints to reconnect to.
+}
+
+// newRetryAdvice creates the retry guidance from the configuration.
+func newRetryAdvice(cfg *config.FailoverConfig) *retryAdvice {
+	advice := &retryAdvice{
+		RetryAfter: defaultRetryAfter,
+		Endpoints:  []string{},
+	}
+
+	if cfg != nil {
+		advice.Endpoints = splitList(cfg.Endpoints)
+		if cfg.RetryAfter > 0 {
+			advice.RetryAfter = cfg.RetryAfter
+		}
+	}
+	return advice
+}
+
+// advice returns the current retry guidance.
+func (s *Service) advice() *retryAdvice {
+	if v, ok := s.failover.Load().(*retryAdvice); ok {
+		return v
+	}
+	return newRetryAdvice(nil)
+}
+
+// withAdvice attaches the retry guidance to the errors telling the client that the
+// service is unavailable.
+func (s *Service) withAdvice(err *errors.Error) *errors.Error {
+	if err.Status != http.StatusServiceUnavailable {
+		return err.Copy()
+	}
+
+	advice := s.advice()
+	return err.WithRetry(advice.RetryAfter, advice.Endpoints)
+}
+
+// reject rejects an HTTP request as the service is unavailable, along with the retry
+// guidance in both the headers and the body.
+func (s *Service) reject(w http.ResponseWriter, err *errors.Error) {
+	resp, _ := json.Marshal(s.withAdvice(err))
+	w.Header().Set("Retry-After", strconv.Itoa(s.advice().RetryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(resp)
+}
+
+// unavailable rejects an HTTP request while the node is under maintenance.
+func (s *Service) unavailable(w http.ResponseWriter) {
+	s.reject(w, errors.ErrUnavailable)
+}
+
+// exhausted rejects an HTTP request while the file descriptors of the node are exhausted.
+func (s *Service) exhausted(w http.ResponseWriter) {
+	s.measurer.Measure("conn.refused", 1)
+	s.reject(w, errors.ErrExhausted)
+}
+
+// Occurs when a new HTTP failover request is received. This returns the retry guidance
+// and allows to replace the alternate endpoints or the retry delay at runtime.
+func (s *Service) onFailover(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		advice := &retryAdvice{
+			RetryAfter: s.advice().RetryAfter,
+			Endpoints:  splitList(r.FormValue("endpoints")),
+		}
+
+		if v := r.FormValue("retryAfter"); v != "" {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			advice.RetryAfter = seconds
+		}
+
+		s.failover.Store(advice)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	resp, _ := json.Marshal(s.advice())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// splitList splits a comma-separated list, ignoring the empty values.
+func splitList(list string) []string {
+	out := []string{}
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRetryAdvice(t *testing.T) {
+	tests := []struct {
+		cfg       *config.FailoverConfig
+		after     int
+		endpoints []string
+	}{
+		{cfg: nil, after: 5, endpoints: []string{}},
+		{cfg: &config.FailoverConfig{RetryAfter: -1}, after: 5, endpoints: []string{}},
+		{cfg: &config.FailoverConfig{RetryAfter: 10, Endpoints: "a:8080, ,b:8080"}, after: 10, endpoints: []string{"a:8080", "b:8080"}},
+	}
+
+	for _, tc := range tests {
+		advice := newRetryAdvice(tc.cfg)
+		assert.Equal(t, tc.after, advice.RetryAfter)
+		assert.Equal(t, tc.endpoints, advice.Endpoints)
+	}
+}
+
+func TestWithAdvice(t *testing.T) {
+	s := new(Service)
+	s.failover.Store(newRetryAdvice(&config.FailoverConfig{
+		Endpoints: "eu.example.com:8080",
+	}))
+
+	err := s.withAdvice(errors.ErrOverloaded)
+	assert.Equal(t, 5, err.RetryAfter)
+	assert.Equal(t, []string{"eu.example.com:8080"}, err.Endpoints)
+
+	err = s.withAdvice(errors.ErrUnauthorized)
+	assert.Equal(t, 0, err.RetryAfter)
+	assert.Nil(t, err.Endpoints)
+}
+
+func TestReject(t *testing.T) {
+	s := new(Service)
+	rr := httptest.NewRecorder()
+	s.unavailable(rr)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "5", rr.Header().Get("Retry-After"))
+	assert.Contains(t, rr.Body.String(), `"retryAfter":5`)
+}
+
+func TestOnFailover(t *testing.T) {
+	tests := []struct {
+		method string
+		body   string
+		code   int
+		expect string
+	}{
+		{method: "PUT", code: 404},
+		{method: "GET", code: 200, expect: `{"retryAfter":5,"endpoints":[]}`},
+		{method: "POST", body: "retryAfter=abc", code: 400},
+		{method: "POST", body: "retryAfter=0", code: 400},
+		{method: "POST", body: "endpoints=a:8080,b:8080", code: 200, expect: `{"retryAfter":5,"endpoints":["a:8080","b:8080"]}`},
+		{method: "POST", body: "endpoints=a:8080&retryAfter=30", code: 200, expect: `{"retryAfter":30,"endpoints":["a:8080"]}`},
+	}
+
+	for _, tc := range tests {
+		s := new(Service)
+		req := httptest.NewRequest(tc.method, "/admin/failover", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		s.onFailover(rr, req)
+		assert.Equal(t, tc.code, rr.Code)
+		if tc.expect != "" {
+			assert.Equal(t, tc.expect, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	"github.com/kelindar/tcp"
+)
+
+// listenerKey is the key of the name of the listener in the context of an HTTP request.
+type listenerKey struct{}
+
+// liveness represents the liveness of a connection: the keepalive requested by its client,
+// along with the settings of its listener which are overridden by its contract.
+type liveness struct {
+	keepalive     time.Duration // The keepalive requested by the client.
+	minKeepAlive  time.Duration // The minimum keepalive enforced.
+	maxKeepAlive  time.Duration // The maximum keepalive enforced.
+	idleTimeout   time.Duration // The timeout of a connection without keepalive.
+	sessionExpiry time.Duration // The expiry of the offline session, or zero for the default.
+}
+
+// newLiveness creates the liveness settings of a listener.
+func newLiveness(c config.LivenessConfig) liveness {
+	return liveness{
+		minKeepAlive:  time.Duration(c.MinKeepAlive) * time.Second,
+		maxKeepAlive:  time.Duration(c.MaxKeepAlive) * time.Second,
+		idleTimeout:   time.Duration(c.IdleTimeout) * time.Second,
+		sessionExpiry: time.Duration(c.SessionExpiry) * time.Second,
+	}
+}
+
+// livenessOf returns the liveness settings of the listeners, by name.
+func livenessOf(c *config.LivenessConfig) (map[string]liveness, error) {
+	listeners, err := c.PerListener()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]liveness, len(listeners))
+	for name, v := range listeners {
+		out[name] = newLiveness(v)
+	}
+	return out, nil
+}
+
+// override overrides the settings with the ones of the contract, where they are set.
+func (l *liveness) override(limits contract.Limits) {
+	overrideSeconds(&l.minKeepAlive, limits.MinKeepAlive)
+	overrideSeconds(&l.maxKeepAlive, limits.MaxKeepAlive)
+	overrideSeconds(&l.idleTimeout, limits.IdleTimeout)
+	overrideSeconds(&l.sessionExpiry, limits.SessionExpiry)
+}
+
+// overrideSeconds overrides a duration with a number of seconds, unless it is zero.
+func overrideSeconds(d *time.Duration, seconds int) {
+	if seconds > 0 {
+		*d = time.Duration(seconds) * time.Second
+	}
+}
+
+// timeout returns the time without any packet after which the connection is closed. As per
+// MQTT spec, this is one and a half times the keepalive, which is kept within the minimum
+// and the maximum enforced.
+func (l *liveness) timeout() time.Duration {
+	keepalive := l.keepalive
+	switch {
+	case keepalive > 0 && keepalive < l.minKeepAlive:
+		keepalive = l.minKeepAlive
+	case l.maxKeepAlive > 0 && (keepalive == 0 || keepalive > l.maxKeepAlive):
+		keepalive = l.maxKeepAlive
+	}
+
+	switch {
+	case keepalive > 0:
+		return keepalive * 3 / 2
+	case l.idleTimeout > 0:
+		return l.idleTimeout
+	default:
+		return idleTimeout
+	}
+}
+
+// ------------------------------------------------------------------------------------
+
+// tune updates the liveness of the connection along with its read timeout.
+func (c *Conn) tune(update func(*liveness)) {
+	c.Lock()
+	defer c.Unlock()
+
+	update(&c.live)
+	atomic.StoreInt64(&c.timeout, int64(c.live.timeout()))
+}
+
+// readTimeout returns the time without any packet after which the connection is closed.
+func (c *Conn) readTimeout() time.Duration {
+	if timeout := atomic.LoadInt64(&c.timeout); timeout > 0 {
+		return time.Duration(timeout)
+	}
+	return idleTimeout
+}
+
+// sessionExpiry returns the expiry of the offline session of the connection, or zero if the
+// default one applies.
+func (c *Conn) sessionExpiry() time.Duration {
+	c.Lock()
+	defer c.Unlock()
+	return c.live.sessionExpiry
+}
+
+// ------------------------------------------------------------------------------------
+
+// tcpOf returns the server of the MQTT connections of a listener.
+func (s *Service) tcpOf(name string) *tcp.Server {
+	return &tcp.Server{
+		OnAccept: func(t net.Conn) {
+			s.onAcceptConn(t, name)
+		},
+	}
+}
+
+// httpOf returns the server of the HTTP requests of a listener, which carry the name of the
+// listener so that the websocket connections get its liveness settings.
+func (s *Service) httpOf(name string) *http.Server {
+	return &http.Server{
+		Handler: s.http.Handler,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(s.context, listenerKey{}, name)
+		},
+	}
+}
+
+// listenerOf returns the name of the listener an HTTP request was received on.
+func listenerOf(r *http.Request) string {
+	if name, ok := r.Context().Value(listenerKey{}).(string); ok {
+		return name
+	}
+	return "tcp"
+}
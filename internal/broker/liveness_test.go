@@ -0,0 +1,96 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveness_Timeout(t *testing.T) {
+	tests := []struct {
+		keepalive int
+		config    config.LivenessConfig
+		expect    time.Duration
+	}{
+		{keepalive: 0, expect: idleTimeout},
+		{keepalive: 0, config: config.LivenessConfig{IdleTimeout: 30}, expect: 30 * time.Second},
+		{keepalive: 60, expect: 90 * time.Second},
+		{keepalive: 10, config: config.LivenessConfig{MinKeepAlive: 60}, expect: 90 * time.Second},
+		{keepalive: 600, config: config.LivenessConfig{MaxKeepAlive: 60}, expect: 90 * time.Second},
+		{keepalive: 0, config: config.LivenessConfig{MaxKeepAlive: 60, IdleTimeout: 30}, expect: 90 * time.Second},
+		{keepalive: 0, config: config.LivenessConfig{MinKeepAlive: 60}, expect: idleTimeout},
+	}
+
+	for _, tc := range tests {
+		l := newLiveness(tc.config)
+		l.keepalive = time.Duration(tc.keepalive) * time.Second
+		assert.Equal(t, tc.expect, l.timeout())
+	}
+}
+
+func TestLiveness_Override(t *testing.T) {
+	l := newLiveness(config.LivenessConfig{MinKeepAlive: 10, MaxKeepAlive: 60, SessionExpiry: 3600})
+	l.override(contract.Limits{MaxKeepAlive: 1800, SessionExpiry: 86400})
+
+	assert.Equal(t, 10*time.Second, l.minKeepAlive)
+	assert.Equal(t, 1800*time.Second, l.maxKeepAlive)
+	assert.Equal(t, 24*time.Hour, l.sessionExpiry)
+}
+
+func TestLiveness_Of(t *testing.T) {
+	listeners, err := livenessOf(&config.LivenessConfig{
+		IdleTimeout: 30,
+		Listeners: map[string]*config.LivenessConfig{
+			"tls": {IdleTimeout: 600},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, listeners["tcp"].idleTimeout)
+	assert.Equal(t, 600*time.Second, listeners["tls"].idleTimeout)
+
+	_, err = livenessOf(&config.LivenessConfig{IdleTimeout: -1})
+	assert.Error(t, err)
+}
+
+func TestConn_Tune(t *testing.T) {
+	_, conn := newTestConn()
+	assert.Equal(t, idleTimeout, conn.readTimeout())
+
+	conn.tune(func(l *liveness) {
+		*l = newLiveness(config.LivenessConfig{MaxKeepAlive: 60, SessionExpiry: 600})
+	})
+	assert.Equal(t, 90*time.Second, conn.readTimeout())
+	assert.Equal(t, 10*time.Minute, conn.sessionExpiry())
+
+	// The keepalive of the client is kept within the maximum
+	conn.onConnect(&mqtt.Connect{Version: 4, KeepAlive: 30})
+	assert.Equal(t, 45*time.Second, conn.readTimeout())
+}
+
+func TestListenerOf(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	assert.Equal(t, "tcp", listenerOf(r))
+
+	r = r.WithContext(context.WithValue(r.Context(), listenerKey{}, "tls"))
+	assert.Equal(t, "tls", listenerOf(r))
+}
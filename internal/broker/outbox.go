@@ -0,0 +1,231 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/pool"
+)
+
+// The policies applied when the outbound queue of a connection is full.
+const (
+	dropOldest = "drop-oldest" // Drops the oldest packet queued.
+	dropNewest = "drop-newest" // Drops the packet being sent.
+	disconnect = "disconnect"  // Closes the connection.
+)
+
+// The outcomes of a packet pushed to an outbound queue.
+const (
+	pushQueued   = iota // The packet was queued.
+	pushDropped         // A packet was dropped, since the queue is full.
+	pushOverflow        // The queue is full and the connection should be closed.
+	pushSlow            // The queue stayed full for too long and the client should be evicted.
+	pushClosed          // The connection is being closed, so the packet was discarded.
+)
+
+// maxPooled is the capacity of the largest packet buffer returned to the pool, so that a
+// few large messages do not keep their memory around.
+const maxPooled = 64 * 1024
+
+// packets are the reusable buffers the queued packets are encoded into, which are returned
+// to the pool once written or dropped.
+var packets = pool.New("broker.packets", func() interface{} {
+	return new(bytes.Buffer)
+})
+
+// getPacket takes an empty buffer from the pool to encode a packet into.
+func getPacket() *bytes.Buffer {
+	packet := packets.Get().(*bytes.Buffer)
+	packet.Reset()
+	return packet
+}
+
+// putPacket returns the buffer of a packet to the pool, unless it grew too large.
+func putPacket(packet *bytes.Buffer) {
+	if packet.Cap() <= maxPooled {
+		packets.Put(packet)
+	}
+}
+
+// outbox represents the bounded queue of the packets sent to a connection. The packets are
+// written by a goroutine which only runs while the queue is not empty, so a slow client
+// does not hold up the publishers delivering to the other clients.
+type outbox struct {
+	sync.Mutex
+	socket  io.Writer       // The socket the packets are written to.
+	queue   []*bytes.Buffer // The encoded packets waiting to be written.
+	batch   net.Buffers     // The packets being written, reused by the writer.
+	limit   int             // The maximum number of packets queued.
+	policy  string          // The policy applied once the queue is full.
+	writing bool            // Whether the writer goroutine is running.
+	failed  bool            // Whether the connection is being closed.
+	dropped int64           // The number of packets dropped.
+	queued  *int64          // The number of packets queued for all of the connections.
+	onError func()          // The function called when the socket can no longer be written.
+	full    time.Time       // The time since which the queue is full, if it is.
+	slow    time.Duration   // The time the queue may stay full before the client is evicted.
+}
+
+// newOutbox creates a new outbound queue for a socket.
+func newOutbox(socket io.Writer, cfg *config.LimitConfig, queued *int64, onError func()) *outbox {
+	return &outbox{
+		socket:  socket,
+		limit:   cfg.OutboundQueue,
+		policy:  cfg.OverflowPolicy(),
+		slow:    cfg.SlowConsumerPeriod(),
+		queued:  queued,
+		onError: onError,
+	}
+}
+
+// Push queues an encoded packet, applying the policy if the queue is full, and returns the
+// outcome. Once the connection should be closed, the next packets are discarded. The outbox
+// takes over the buffer of the packet, which is returned to the pool once no longer needed.
+func (o *outbox) Push(packet *bytes.Buffer) int {
+	o.Lock()
+	defer o.Unlock()
+
+	outcome := o.push(packet)
+	if outcome != pushQueued && outcome != pushDropped {
+		putPacket(packet)
+	}
+	return outcome
+}
+
+// push queues an encoded packet, applying the policy if the queue is full.
+func (o *outbox) push(packet *bytes.Buffer) int {
+	if o.failed {
+		return pushClosed
+	}
+
+	outcome := pushQueued
+	if len(o.queue) >= o.limit {
+		if o.isSlow(time.Now()) {
+			o.failed = true
+			return pushSlow
+		}
+
+		switch o.policy {
+		case disconnect:
+			o.failed = true
+			return pushOverflow
+		case dropNewest:
+			o.dropped++
+			putPacket(packet)
+			return pushDropped
+		default:
+			putPacket(o.queue[0])
+			o.queue[0] = nil
+			o.queue = o.queue[1:]
+			o.dropped++
+			atomic.AddInt64(o.queued, -1)
+			outcome = pushDropped
+		}
+	}
+
+	o.queue = append(o.queue, packet)
+	atomic.AddInt64(o.queued, 1)
+	if !o.writing {
+		o.writing = true
+		go o.drain()
+	}
+	return outcome
+}
+
+// isSlow records the time since which the queue is full, and returns whether it stayed
+// full for too long, since the writer took nothing from it meanwhile.
+func (o *outbox) isSlow(now time.Time) bool {
+	if o.full.IsZero() {
+		o.full = now
+		return false
+	}
+	return o.slow > 0 && now.Sub(o.full) >= o.slow
+}
+
+// Len returns the number of packets queued.
+func (o *outbox) Len() int {
+	o.Lock()
+	defer o.Unlock()
+	return len(o.queue)
+}
+
+// Dropped returns the number of packets dropped.
+func (o *outbox) Dropped() int64 {
+	o.Lock()
+	defer o.Unlock()
+	return o.dropped
+}
+
+// drain writes the queued packets until the queue is empty.
+func (o *outbox) drain() {
+	for {
+		o.Lock()
+		queue := o.queue
+		o.queue = nil
+		o.full = time.Time{}
+		if len(queue) == 0 {
+			o.writing = false
+			o.Unlock()
+			return
+		}
+		o.Unlock()
+
+		// The packets keep being queued while the batch is written
+		atomic.AddInt64(o.queued, -int64(len(queue)))
+		if err := o.write(queue); err != nil {
+			o.fail()
+			return
+		}
+	}
+}
+
+// write writes a batch of packets to the socket and returns their buffers to the pool.
+func (o *outbox) write(queue []*bytes.Buffer) error {
+	for _, packet := range queue {
+		o.batch = append(o.batch, packet.Bytes())
+	}
+
+	batch := o.batch
+	_, err := batch.WriteTo(o.socket)
+	for i, packet := range queue {
+		putPacket(packet)
+		o.batch[i] = nil
+	}
+
+	o.batch = o.batch[:0]
+	return err
+}
+
+// fail drops the queued packets once the socket failed, and stops queuing them.
+func (o *outbox) fail() {
+	o.Lock()
+	atomic.AddInt64(o.queued, -int64(len(o.queue)))
+	for _, packet := range o.queue {
+		putPacket(packet)
+	}
+
+	o.queue = nil
+	o.failed = true
+	o.writing = false
+	o.Unlock()
+	o.onError()
+}
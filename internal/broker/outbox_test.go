@@ -0,0 +1,124 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingWriter represents a socket which blocks the writes until released.
+type blockingWriter struct {
+	sync.Mutex
+	buffer  bytes.Buffer
+	release chan struct{}
+	err     error
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.Lock()
+	defer w.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.buffer.Write(p)
+}
+
+func (w *blockingWriter) String() string {
+	w.Lock()
+	defer w.Unlock()
+	return w.buffer.String()
+}
+
+func TestOutbox_Policies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		written string
+		dropped int64
+		outcome int
+	}{
+		{policy: dropOldest, written: "acd", dropped: 1, outcome: pushDropped},
+		{policy: dropNewest, written: "abc", dropped: 1, outcome: pushDropped},
+		{policy: disconnect, written: "abc", outcome: pushOverflow},
+	}
+
+	for _, tc := range tests {
+		var queued int64
+		w := &blockingWriter{release: make(chan struct{})}
+		o := newOutbox(w, &config.LimitConfig{OutboundQueue: 2, OutboundPolicy: tc.policy}, &queued, func() {})
+
+		// The first packet is being written while the others are queued
+		o.Push(bytes.NewBufferString("a"))
+		assert.Eventually(t, func() bool { return o.Len() == 0 }, time.Second, time.Millisecond)
+		o.Push(bytes.NewBufferString("b"))
+		o.Push(bytes.NewBufferString("c"))
+		assert.Equal(t, int64(2), queued)
+
+		assert.Equal(t, tc.outcome, o.Push(bytes.NewBufferString("d")), tc.policy)
+		assert.Equal(t, tc.dropped, o.Dropped(), tc.policy)
+
+		// The queue is written once the socket is available
+		close(w.release)
+		assert.Eventually(t, func() bool {
+			return w.String() == tc.written
+		}, time.Second, time.Millisecond, tc.policy)
+		assert.Equal(t, int64(0), queued)
+	}
+}
+
+func TestOutbox_Error(t *testing.T) {
+	var queued int64
+	failed := make(chan struct{})
+	w := &blockingWriter{release: make(chan struct{}), err: errors.New("closed")}
+	o := newOutbox(w, &config.LimitConfig{OutboundQueue: 10}, &queued, func() {
+		close(failed)
+	})
+
+	o.Push(bytes.NewBufferString("a"))
+	o.Push(bytes.NewBufferString("b"))
+	close(w.release)
+	<-failed
+
+	// The packets are no longer queued once the socket failed
+	assert.Equal(t, pushClosed, o.Push(bytes.NewBufferString("c")))
+	assert.Equal(t, 0, o.Len())
+	assert.Equal(t, int64(0), queued)
+}
+
+func TestOutbox_Slow(t *testing.T) {
+	var queued int64
+	w := &blockingWriter{release: make(chan struct{})}
+	o := newOutbox(w, &config.LimitConfig{OutboundQueue: 1, SlowConsumer: 1}, &queued, func() {})
+	o.slow = 10 * time.Millisecond
+	defer close(w.release)
+
+	// The queue becomes full while the first packet is being written
+	assert.Equal(t, pushQueued, o.Push(bytes.NewBufferString("a")))
+	assert.Eventually(t, func() bool { return o.Len() == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, pushQueued, o.Push(bytes.NewBufferString("b")))
+	assert.Equal(t, pushDropped, o.Push(bytes.NewBufferString("c")))
+
+	// The client is evicted once the queue stayed full for too long
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, pushSlow, o.Push(bytes.NewBufferString("d")))
+	assert.Equal(t, pushClosed, o.Push(bytes.NewBufferString("e")))
+}
@@ -0,0 +1,47 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"net/http"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+// shed wraps an emitter request handler, rejecting the requests while the work of the
+// specified priority is being shed due to overload.
+func (s *Service) shed(priority uint8, handler service.Handler) service.Handler {
+	return func(c service.Conn, payload []byte) (service.Response, bool) {
+		if s.guard.Shed(priority) {
+			return s.withAdvice(errors.ErrOverloaded), false
+		}
+
+		return handler(c, payload)
+	}
+}
+
+// shedHTTP wraps an HTTP handler, rejecting the requests while the work of the specified
+// priority is being shed due to overload.
+func (s *Service) shedHTTP(priority uint8, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.guard.Shed(priority) {
+			s.reject(w, errors.ErrOverloaded)
+			return
+		}
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,64 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/emitter-io/emitter/internal/service/overload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShed(t *testing.T) {
+	tests := []struct {
+		threshold time.Duration
+		shed      bool
+	}{
+		{threshold: 0, shed: false},
+		{threshold: time.Hour, shed: false},
+		{threshold: time.Nanosecond, shed: true},
+	}
+
+	for _, tc := range tests {
+		s := &Service{guard: overload.New(tc.threshold)}
+		defer s.guard.Close()
+		time.Sleep(120 * time.Millisecond)
+
+		handler := s.shed(overload.PriorityPresence, func(service.Conn, []byte) (service.Response, bool) {
+			return nil, true
+		})
+
+		resp, ok := handler(nil, nil)
+		assert.Equal(t, !tc.shed, ok)
+		if tc.shed {
+			assert.Equal(t, errors.ErrOverloaded.WithRetry(defaultRetryAfter, []string{}), resp)
+		}
+
+		rr := httptest.NewRecorder()
+		s.shedHTTP(overload.PriorityPresence, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})(rr, httptest.NewRequest("GET", "/presence", nil))
+		if tc.shed {
+			assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		} else {
+			assert.Equal(t, http.StatusOK, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/emitter-io/emitter/internal/provider/logging"
+)
+
+// feature represents a protocol feature negotiated by a connection.
+type feature uint32
+
+// The protocol features negotiated by the connections.
+const (
+	featureMQTT31   feature = 1 << iota // The client speaks MQTT 3.1.
+	featureMQTT311                      // The client speaks MQTT 3.1.1.
+	featureMQTT5                        // The client speaks MQTT 5.
+	featureMQTTElse                     // The client speaks another level of MQTT.
+	featureQoS1                         // The client asked for the QoS 1.
+	featureQoS2                         // The client asked for the QoS 2, downgraded to 1.
+	featureSession                      // The client asked for a durable session.
+	featureWill                         // The client specified a last will.
+	featureLinks                        // The client uses links or channel aliases.
+	featureHeaders                      // The client receives the headers of the messages.
+	featureSigning                      // The client receives signed messages.
+	featureChunks                       // The client receives the large messages in chunks.
+	featureExpiry                       // The client is warned before its keys expire.
+)
+
+// The names of the features, as reported.
+var featureNames = map[feature]string{
+	featureMQTT31:   "mqtt-3.1",
+	featureMQTT311:  "mqtt-3.1.1",
+	featureMQTT5:    "mqtt-5",
+	featureMQTTElse: "mqtt-other",
+	featureQoS1:     "qos-1",
+	featureQoS2:     "qos-2",
+	featureSession:  "session",
+	featureWill:     "will",
+	featureLinks:    "links",
+	featureHeaders:  "headers",
+	featureSigning:  "signing",
+	featureChunks:   "chunks",
+	featureExpiry:   "expiry",
+}
+
+// featureOfLevel returns the feature of the MQTT protocol level of a connect packet.
+func featureOfLevel(level uint8) feature {
+	switch level {
+	case 3:
+		return featureMQTT31
+	case 4:
+		return featureMQTT311
+	case 5:
+		return featureMQTT5
+	default:
+		return featureMQTTElse
+	}
+}
+
+// featureOfQoS returns the feature of a requested QoS, or zero for the QoS 0.
+func featureOfQoS(qos uint8) feature {
+	switch {
+	case qos == 1:
+		return featureQoS1
+	case qos > 1:
+		return featureQoS2
+	default:
+		return 0
+	}
+}
+
+// names returns the names of the features of the set, sorted.
+func (f feature) names() []string {
+	out := make([]string, 0, 4)
+	for v, name := range featureNames {
+		if f&v != 0 {
+			out = append(out, name)
+		}
+	}
+
+	sort.Strings(out)
+	return out
+}
+
+// ------------------------------------------------------------------------------------
+
+// ProtocolUsage represents the protocol features negotiated by the connections of a
+// contract on this node, since it has started.
+type ProtocolUsage struct {
+	Contract    uint32           `json:"contract"`    // The contract of the connections.
+	Connections int64            `json:"connections"` // The number of connections of the contract.
+	Features    map[string]int64 `json:"features"`    // The number of connections per feature.
+}
+
+// protocols aggregates the protocol features negotiated by the connections, per contract.
+type protocols struct {
+	sync.Mutex
+	contracts map[uint32]*ProtocolUsage // The usage of each contract.
+}
+
+// newProtocols creates a new protocol usage aggregator.
+func newProtocols() *protocols {
+	return &protocols{
+		contracts: make(map[uint32]*ProtocolUsage),
+	}
+}
+
+// onConnection records a new connection of the contract, along with the features it has
+// negotiated so far.
+func (p *protocols) onConnection(contract uint32, features feature) {
+	p.Lock()
+	defer p.Unlock()
+
+	usage := p.fetch(contract)
+	usage.Connections++
+	p.add(usage, features)
+}
+
+// onFeature records the features newly negotiated by a connection of the contract.
+func (p *protocols) onFeature(contract uint32, features feature) {
+	p.Lock()
+	defer p.Unlock()
+	p.add(p.fetch(contract), features)
+}
+
+// fetch gets or creates the usage of a contract, must be called under the lock.
+func (p *protocols) fetch(contract uint32) *ProtocolUsage {
+	usage, ok := p.contracts[contract]
+	if !ok {
+		usage = &ProtocolUsage{
+			Contract: contract,
+			Features: make(map[string]int64),
+		}
+		p.contracts[contract] = usage
+	}
+	return usage
+}
+
+// add counts the features for the contract, must be called under the lock. The first use
+// of a feature by a contract is logged, so the clients still relying on the legacy paths
+// can be found.
+func (p *protocols) add(usage *ProtocolUsage, features feature) {
+	for _, name := range features.names() {
+		if usage.Features[name] == 0 {
+			logging.LogAction("conn", "negotiated "+name, logging.Contract(usage.Contract))
+		}
+		usage.Features[name]++
+	}
+}
+
+// Usage returns the usage of the contract, or of all of the contracts if zero.
+func (p *protocols) Usage(contract uint32) []ProtocolUsage {
+	p.Lock()
+	defer p.Unlock()
+
+	out := make([]ProtocolUsage, 0, len(p.contracts))
+	for id, usage := range p.contracts {
+		if contract != 0 && contract != id {
+			continue
+		}
+
+		features := make(map[string]int64, len(usage.Features))
+		for k, v := range usage.Features {
+			features[k] = v
+		}
+
+		out = append(out, ProtocolUsage{
+			Contract:    id,
+			Connections: usage.Connections,
+			Features:    features,
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Contract < out[j].Contract })
+	return out
+}
+
+// ------------------------------------------------------------------------------------
+
+// negotiate records the protocol features negotiated by the connection. They are counted
+// for its contract only once per connection and once its contract is known.
+func (c *Conn) negotiate(features feature) {
+	c.Lock()
+	defer c.Unlock()
+
+	added := features &^ c.features
+	if added == 0 {
+		return
+	}
+
+	c.features |= added
+	if c.contract != 0 && c.service.protocols != nil {
+		c.service.protocols.onFeature(c.contract, added)
+	}
+}
+
+// Features returns the names of the protocol features negotiated by the connection.
+func (c *Conn) Features() []string {
+	c.Lock()
+	defer c.Unlock()
+	return c.features.names()
+}
+
+// Occurs when a new HTTP request for the protocol features negotiated by the connections
+// is received, optionally for a single 'contract'.
+func (s *Service) onProtocols(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var contract uint64
+	if v := r.URL.Query().Get("contract"); v != "" {
+		var err error
+		if contract, err = strconv.ParseUint(v, 10, 32); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp, _ := json.Marshal(s.protocols.Usage(uint32(contract)))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
@@ -0,0 +1,90 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeature_Names(t *testing.T) {
+	assert.Equal(t, []string{}, feature(0).names())
+	assert.Equal(t, []string{"mqtt-3.1.1"}, featureOfLevel(4).names())
+	assert.Equal(t, []string{"headers", "mqtt-3.1", "qos-2"}, (featureOfLevel(3) | featureOfQoS(2) | featureHeaders).names())
+	assert.Equal(t, feature(0), featureOfQoS(0))
+	assert.Equal(t, featureMQTTElse, featureOfLevel(7))
+}
+
+func TestConn_Negotiate(t *testing.T) {
+	_, conn := newTestConn()
+	conn.service.protocols = newProtocols()
+
+	// The features negotiated before the contract is known are counted once it is
+	conn.onConnect(&mqtt.Connect{Version: 4, ClientID: []byte("a"), WillFlag: true})
+	conn.EnableHeaders(true)
+	assert.Empty(t, conn.service.protocols.Usage(0))
+
+	conn.Track(new(fake.Contract))
+	conn.EnableHeaders(true)
+	conn.negotiate(featureOfQoS(1))
+	conn.Track(new(fake.Contract))
+	assert.Equal(t, []string{"headers", "mqtt-3.1.1", "qos-1", "session", "will"}, conn.Features())
+	assert.Equal(t, []ProtocolUsage{{
+		Contract:    1,
+		Connections: 1,
+		Features: map[string]int64{
+			"headers":    1,
+			"mqtt-3.1.1": 1,
+			"qos-1":      1,
+			"session":    1,
+			"will":       1,
+		},
+	}}, conn.service.protocols.Usage(0))
+	assert.Empty(t, conn.service.protocols.Usage(2))
+}
+
+func TestOnProtocols(t *testing.T) {
+	s := &Service{protocols: newProtocols()}
+	s.protocols.onConnection(1, featureMQTT31)
+	s.protocols.onConnection(2, featureMQTT311)
+
+	tests := []struct {
+		method string
+		query  string
+		code   int
+		count  int
+	}{
+		{method: "POST", code: 404},
+		{method: "GET", query: "?contract=abc", code: 400},
+		{method: "GET", code: 200, count: 2},
+		{method: "GET", query: "?contract=2", code: 200, count: 1},
+	}
+
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		s.onProtocols(rr, httptest.NewRequest(tc.method, "/admin/protocols"+tc.query, nil))
+		assert.Equal(t, tc.code, rr.Code)
+		if tc.code == 200 {
+			var resp []ProtocolUsage
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Len(t, resp, tc.count)
+		}
+	}
+}
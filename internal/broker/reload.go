@@ -0,0 +1,179 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/emitter-io/config"
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+)
+
+// Reload reloads the parts of the configuration which can be changed while the broker is
+// running, without dropping the connections: the TLS certificates, the rate limits and the
+// access control of the listeners, which apply to the new connections, and the logging.
+// This returns the parts reloaded.
+func (s *Service) Reload() ([]string, error) {
+	next, err := s.Config.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply the same resource profile, so the defaults do not change
+	if profile, ok := config.LookupProfile(next.Profile); ok {
+		profile.Apply(next)
+	}
+
+	// Load the logger and the access policies first, so a configuration error leaves
+	// everything untouched
+	var logger logging.Logging
+	if next.Logging != nil {
+		if logger, err = loadLogger(next.Logging); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := accessPolicies(next.Access); err != nil {
+		return nil, err
+	}
+
+	// Serve the new TLS connections with the certificates configured
+	var reloaded []string
+	if s.certs.Load() != nil {
+		if conf, _, ok := next.Certificate(); ok {
+			s.certs.Store(conf)
+			reloaded = append(reloaded, "tls")
+		}
+	}
+
+	// Limit the new connections with the rates configured
+	atomic.StoreInt64(&s.readRate, int64(next.Limit.ReadRate))
+	if s.admission != nil {
+		s.admission.SetRate(next.Limit.ConnectRateLimit())
+	}
+	reloaded = append(reloaded, "limits")
+
+	// Control the access of the new connections with the lists configured
+	if s.access != nil {
+		s.configureAccess(next.Access)
+		reloaded = append(reloaded, "access")
+	}
+
+	if logger != nil {
+		logging.Logger = logger
+		reloaded = append(reloaded, "logging")
+	}
+
+	logging.LogTarget("service", "reloaded the configuration", strings.Join(reloaded, ", "))
+	return reloaded, nil
+}
+
+// loadLogger loads the logging provider configured, returning the configuration errors
+// instead of panicking.
+func loadLogger(conf *cfg.ProviderConfig) (logger logging.Logging, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unable to load the logging provider: %v", r)
+		}
+	}()
+
+	logger = config.LoadProvider(conf, logging.NewStdErr()).(logging.Logging)
+	return
+}
+
+// reloadableTLS returns the TLS configuration of the secure listener, which serves each of
+// the new connections with the latest certificates loaded.
+func (s *Service) reloadableTLS() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return s.certs.Load().(*tls.Config), nil
+		},
+	}
+}
+
+// watchCertificates periodically checks the certificate and key files of the secure listener,
+// including the ones served per hostname, and loads them again for the new handshakes once
+// they changed, for instance once renewed.
+func (s *Service) watchCertificates() {
+	period := s.Config.TLSPolicy.ReloadPeriod()
+	if period == 0 || len(s.certificateFiles()) == 0 {
+		return
+	}
+
+	modified := lastModified(s.certificateFiles()...)
+	async.Repeat(s.context, period, func() {
+		if m := lastModified(s.certificateFiles()...); m.After(modified) {
+			modified = m
+			if conf, _, ok := s.Config.Certificate(); ok {
+				s.certs.Store(conf)
+				logging.LogAction("tls", "reloaded the certificates")
+			}
+		}
+	})
+}
+
+// certificateFiles returns the certificate and key files of the secure listener.
+func (s *Service) certificateFiles() []string {
+	files := s.Config.SNI.Files()
+	if s.Config.TLS.Certificate != "" {
+		files = append(files, s.Config.TLS.Certificate, s.Config.TLS.PrivateKey)
+	}
+	return files
+}
+
+// lastModified returns the time of the last modification of the files.
+func lastModified(files ...string) (last time.Time) {
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return
+}
+
+// Occurs when the secrets of a watched secret store change.
+func (s *Service) onConfigChange() {
+	if _, err := s.Reload(); err != nil {
+		logging.LogError("service", "reloading the configuration", err)
+	}
+}
+
+// Occurs when a new HTTP configuration reload request is received.
+func (s *Service) onReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	reloaded, err := s.Reload()
+	if err != nil {
+		logging.LogError("service", "reloading the configuration", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp, _ := json.Marshal(map[string][]string{"reloaded": reloaded})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
@@ -0,0 +1,66 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	cfg, err := config.New("reload.conf")
+	assert.NoError(t, err)
+	defer os.Remove("reload.conf")
+
+	s := &Service{Config: cfg}
+
+	assert.NoError(t, ioutil.WriteFile("reload.conf", []byte(`{"listen":":8080","limit":{"readRate":10}}`), 0644))
+	reloaded, err := s.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"limits"}, reloaded)
+	assert.Equal(t, int64(10), s.readRate)
+}
+
+func TestOnReload(t *testing.T) {
+	s := &Service{Config: config.NewDefault().(*config.Config)}
+
+	// Only a POST reloads the configuration
+	w := httptest.NewRecorder()
+	s.onReload(w, httptest.NewRequest("GET", "/admin/reload", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// The default configuration was not read from a file
+	w = httptest.NewRecorder()
+	s.onReload(w, httptest.NewRequest("POST", "/admin/reload", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestLastModified(t *testing.T) {
+	assert.True(t, lastModified("missing.crt").IsZero())
+
+	assert.NoError(t, ioutil.WriteFile("reload.crt", []byte("cert"), 0644))
+	defer os.Remove("reload.crt")
+
+	modified := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes("reload.crt", modified, modified))
+	assert.Equal(t, modified.Unix(), lastModified("missing.crt", "reload.crt").Unix())
+}
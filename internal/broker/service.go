@@ -17,6 +17,8 @@ package broker
 import (
 	"context"
 	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -26,54 +28,115 @@ import (
 	"os"
 	"os/signal"
 	"reflect"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/emitter-io/address"
+	"github.com/emitter-io/emitter/internal/async"
 	"github.com/emitter-io/emitter/internal/config"
 	"github.com/emitter-io/emitter/internal/event"
 	"github.com/emitter-io/emitter/internal/message"
 	"github.com/emitter-io/emitter/internal/network/listener"
-	"github.com/emitter-io/emitter/internal/network/websocket"
+	"github.com/emitter-io/emitter/internal/network/poll"
+	"github.com/emitter-io/emitter/internal/network/quic"
 	"github.com/emitter-io/emitter/internal/provider/contract"
 	"github.com/emitter-io/emitter/internal/provider/logging"
 	"github.com/emitter-io/emitter/internal/provider/monitor"
 	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/provider/tracing"
 	"github.com/emitter-io/emitter/internal/provider/usage"
 	"github.com/emitter-io/emitter/internal/security"
 	"github.com/emitter-io/emitter/internal/security/license"
+	"github.com/emitter-io/emitter/internal/security/sign"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/emitter-io/emitter/internal/service/access"
+	"github.com/emitter-io/emitter/internal/service/analytics"
+	"github.com/emitter-io/emitter/internal/service/audit"
+	"github.com/emitter-io/emitter/internal/service/capacity"
 	"github.com/emitter-io/emitter/internal/service/cluster"
+	"github.com/emitter-io/emitter/internal/service/dashboard"
+	"github.com/emitter-io/emitter/internal/service/delay"
+	"github.com/emitter-io/emitter/internal/service/federation"
+	"github.com/emitter-io/emitter/internal/service/history"
+	"github.com/emitter-io/emitter/internal/service/hook"
 	"github.com/emitter-io/emitter/internal/service/keyban"
 	"github.com/emitter-io/emitter/internal/service/keygen"
+	"github.com/emitter-io/emitter/internal/service/kv"
 	"github.com/emitter-io/emitter/internal/service/link"
 	"github.com/emitter-io/emitter/internal/service/me"
+	"github.com/emitter-io/emitter/internal/service/overload"
+	"github.com/emitter-io/emitter/internal/service/plugins"
 	"github.com/emitter-io/emitter/internal/service/presence"
 	"github.com/emitter-io/emitter/internal/service/pubsub"
+	"github.com/emitter-io/emitter/internal/service/reply"
+	"github.com/emitter-io/emitter/internal/service/rules"
+	"github.com/emitter-io/emitter/internal/service/scan"
+	"github.com/emitter-io/emitter/internal/service/scheduler"
+	"github.com/emitter-io/emitter/internal/service/session"
+	"github.com/emitter-io/emitter/internal/service/shadow"
+	"github.com/emitter-io/emitter/internal/service/signing"
+	"github.com/emitter-io/emitter/internal/service/snapshot"
 	"github.com/emitter-io/emitter/internal/service/survey"
+	"github.com/emitter-io/emitter/internal/service/synthetic"
 	"github.com/emitter-io/stats"
-	"github.com/kelindar/tcp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Service represents the main structure.
 type Service struct {
-	connections   int64              // The number of currently open connections.
-	context       context.Context    // The context for the service.
-	cancel        context.CancelFunc // The cancellation function.
-	License       license.License    // The licence for this emitter server.
-	Config        *config.Config     // The configuration for the service.
-	subscriptions *message.Trie      // The subscription matching trie.
-	http          *http.Server       // The underlying HTTP server.
-	tcp           *tcp.Server        // The underlying TCP server.
-	cluster       *cluster.Swarm     // The gossip-based cluster mechanism.
-	surveyor      *survey.Surveyor   // The generic query manager.
-	contracts     contract.Provider  // The contract provider for the service.
-	storage       storage.Storage    // The storage provider for the service.
-	monitor       monitor.Storage    // The storage provider for stats.
-	measurer      stats.Measurer     // The monitoring registry for the service.
-	metering      usage.Metering     // The usage storage for metering contracts.
-	pubsub        *pubsub.Service    // The publish/subscribe service.
-	presence      *presence.Service  // The presence service.
-	keygen        *keygen.Service    // The key generation provider.
+	connections   int64                 // The number of currently open connections.
+	received      int64                 // The number of messages received from the clients.
+	sent          int64                 // The number of messages sent to the clients.
+	ingress       int64                 // The number of bytes received from the clients.
+	egress        int64                 // The number of bytes sent to the clients.
+	queued        int64                 // The number of messages queued for the clients.
+	draining      int32                 // Whether the service is being drained or not.
+	readRate      int64                 // The read rate of the new connections, reloadable.
+	certs         atomic.Value          // The TLS configuration of the secure listener, reloadable.
+	conns         sync.Map              // The currently open connections, keyed by their local ID.
+	clients       registry              // The connected clients, keyed by their identity.
+	takeover      string                // The policy applied when a connected client connects again.
+	liveness      map[string]liveness   // The liveness settings of the connections, per listener.
+	websockets    upgraders             // The upgraders of the websocket connections, per listener.
+	failover      atomic.Value          // The retry guidance given to the rejected clients.
+	context       context.Context       // The context for the service.
+	cancel        context.CancelFunc    // The cancellation function.
+	License       license.License       // The licence for this emitter server.
+	Config        *config.Config        // The configuration for the service.
+	subscriptions *message.Trie         // The subscription matching trie.
+	http          *http.Server          // The underlying HTTP server.
+	cluster       *cluster.Swarm        // The gossip-based cluster mechanism.
+	federation    *federation.Service   // The federation with the remote clusters.
+	surveyor      *survey.Surveyor      // The generic query manager.
+	contracts     contract.Provider     // The contract provider for the service.
+	storage       storage.Storage       // The storage provider for the service.
+	monitor       monitor.Storage       // The storage provider for stats.
+	measurer      stats.Measurer        // The monitoring registry for the service.
+	metering      usage.Metering        // The usage storage for metering contracts.
+	pubsub        *pubsub.Service       // The publish/subscribe service.
+	presence      *presence.Service     // The presence service.
+	keygen        *keygen.Service       // The key generation provider.
+	analytics     *analytics.Service    // The channel analytics service.
+	capacity      *capacity.Planner     // The capacity planner of the node.
+	protocols     *protocols            // The protocol features negotiated per contract.
+	snapshots     *snapshot.Service     // The subscription snapshots, if enabled.
+	guard         *overload.Guard       // The load shedding guard.
+	descriptors   *overload.Descriptors // The watcher of the file descriptors.
+	admission     *overload.Admission   // The admission control of the new connections.
+	poller        *poll.Poller          // The poller of the idle connections, if enabled.
+	access        *access.Guard         // The access control of the listeners.
+	scheduler     *scheduler.Scheduler  // The fair scheduler of the contracts' work.
+	signing       *signing.Service      // The message signing service, if enabled.
+	sessions      *session.Durable      // The offline sessions of the clients.
+	kv            *kv.Service           // The key-value store of the contracts.
+	tracing       io.Closer             // The exporter of the traces, if enabled.
+	audit         *audit.Log            // The security audit trail, if enabled.
+	plugins       *plugins.Service      // The external plugins, if configured.
+	lock          sync.Mutex            // The lock of the listeners.
+	listeners     []io.Closer           // The listeners accepting the clients.
 }
 
 // NewService creates a new service.
@@ -91,17 +154,21 @@ func NewService(ctx context.Context, cfg *config.Config) (s *Service, err error)
 		Config:        cfg,
 		subscriptions: trie,
 		http:          new(http.Server),
-		tcp:           new(tcp.Server),
 		storage:       new(storage.Noop),
 		measurer:      stats.New(),
+		analytics:     analytics.New(),
+		protocols:     newProtocols(),
+		readRate:      int64(cfg.Limit.ReadRate),
 	}
 
+	// Setup the retry guidance given to the rejected clients
+	s.failover.Store(newRetryAdvice(cfg.Failover))
+
 	// Create a new HTTP request multiplexer
 	mux := http.NewServeMux()
 
 	// Attach handlers
 	s.http.Handler = mux
-	s.tcp.OnAccept = s.onAcceptConn
 
 	// Parse the license
 	if s.License, err = license.Parse(cfg.License); err != nil {
@@ -112,10 +179,57 @@ func NewService(ctx context.Context, cfg *config.Config) (s *Service, err error)
 	logging.Logger = config.LoadProvider(cfg.Logging, logging.NewStdErr()).(logging.Logging)
 	logging.LogTarget("service", "configured logging provider", logging.Logger.Name())
 
+	// Apply the resource profile, which sets the defaults suited to the class of the host
+	if cfg.Profile != "" {
+		profile, ok := config.LookupProfile(cfg.Profile)
+		if !ok {
+			return nil, fmt.Errorf("unknown resource profile '%s'", cfg.Profile)
+		}
+
+		profile.Apply(cfg)
+		debug.SetGCPercent(profile.GCPercent)
+		if memory, ok := config.HostMemory(); ok {
+			for _, warning := range profile.Verify(memory) {
+				logging.LogAction("service", warning)
+			}
+		}
+		logging.LogTarget("service", "configured resource profile", profile.Name)
+	}
+
+	// Start the plugins, which may register their stores as storage providers
+	if len(cfg.Plugins) > 0 {
+		if s.plugins, err = plugins.New(cfg.Plugins); err != nil {
+			return nil, err
+		}
+
+		// Stop the plugin processes if the service fails to be created afterwards
+		started := s.plugins
+		defer func() {
+			if err != nil {
+				started.Close()
+			}
+		}()
+		logging.LogTarget("service", "configured plugins", s.plugins.Len())
+	}
+
 	// Load the storage provider
-	ssdstore := storage.NewSSD(s)
-	memstore := storage.NewInMemory(s)
-	s.storage = config.LoadProvider(cfg.Storage, storage.NewNoop(), memstore, ssdstore).(storage.Storage)
+	stores := append([]config.Provider{storage.NewNoop()}, storage.Providers(s)...)
+	s.storage = config.LoadProvider(cfg.Storage, stores...).(storage.Storage)
+	provider, _ := s.storage.(presence.CacheProvider)
+	if cfg.History != nil && cfg.History.Compact != "" {
+		s.storage = storage.NewCompacted(s.storage, cfg.History.Compact)
+	}
+
+	// Archive the stored messages into an object storage, if configured
+	if cfg.Archive != nil && cfg.Archive.Bucket != "" {
+		objects, err := storage.NewS3(cfg.Archive.Bucket, cfg.Archive.Region, cfg.Archive.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		s.storage = storage.NewArchived(s.storage, objects, cfg.Archive.Prefix, cfg.Archive.FlushPeriod(), cfg.Archive.FlushSize())
+		logging.LogTarget("service", "configured message archive", cfg.Archive.Bucket)
+	}
 	logging.LogTarget("service", "configured message storage", s.storage.Name())
 
 	// Load the metering provider
@@ -125,38 +239,176 @@ func NewService(ctx context.Context, cfg *config.Config) (s *Service, err error)
 	// Load the contract provider
 	s.contracts = config.LoadProvider(cfg.Contract,
 		contract.NewSingleContractProvider(s.License, s.metering),
-		contract.NewHTTPContractProvider(s.License, s.metering)).(contract.Provider)
+		contract.NewHTTPContractProvider(s.License, s.metering),
+		contract.NewFileContractProvider(s.License, s.metering)).(contract.Provider)
 	logging.LogTarget("service", "configured contracts provider", s.contracts.Name())
 
+	// Enforce the retention rules of the contracts on the stored messages
+	if contracts, ok := s.contracts.(contract.Lister); ok {
+		s.storage = storage.NewBounded(s.storage, contracts, cfg.History.EnforceInterval())
+	}
+
+	// Only store the messages of the contracts which can reside in the region
+	if cfg.Federation != nil && cfg.Federation.Region != "" {
+		s.storage = storage.NewResident(s.storage, s.contracts, cfg.Federation.Region)
+		logging.LogTarget("service", "configured region", cfg.Federation.Region)
+	}
+
+	// Measure the operations of the storage
+	s.storage = storage.NewMeasured(s.storage, s.measurer)
+
+	// Retain the statistics of the channels in the storage, if configured
+	if cfg.Analytics != nil {
+		s.analytics.UseStorage(s.storage, cfg.Analytics.Period(), cfg.Analytics.MaxAge())
+		logging.LogTarget("service", "configured channel statistics retention", cfg.Analytics.MaxAge())
+	}
+
 	// Attach the pubsub service
-	s.pubsub = pubsub.New(s, s.storage, s, s.subscriptions)
+	s.guard = overload.New(cfg.Limit.SchedulerLagThreshold())
+	s.descriptors = overload.NewDescriptors(cfg.Limit.DescriptorThreshold(), s.onDescriptors)
+	s.admission = overload.NewAdmission(cfg.Limit.ConnectRateLimit(), s.guard)
+	if cfg.Limit.IdlePeriod() > 0 {
+		if p, err := poll.New(); err == nil {
+			s.poller = p
+		} else {
+			logging.LogError("service", "unable to park the idle connections", err)
+		}
+	}
+	s.access = access.New()
+	if err := s.configureAccess(cfg.Access); err != nil {
+		return nil, err
+	}
+	s.scheduler = scheduler.New(cfg.Limit.SchedulerWorkers, s.weightOf)
+	s.pubsub = pubsub.New(s, s.storage, s, s.guard, s.scheduler, s.subscriptions)
+	s.pubsub.UseContracts(s.contracts)
+	s.pubsub.UseChunks(int(cfg.MaxMessageBytes()), cfg.Limit.LargeMessageSize)
+	if cfg.History != nil && cfg.History.RewindWindow() > 0 {
+		s.pubsub.UseRewind(cfg.History.RewindWindow(), cfg.History.RewindBuffer())
+	}
+	if cfg.Dedup != nil {
+		s.pubsub.UseDedup(cfg.Dedup.WindowPeriod(), cfg.Dedup.MaxSize(), cfg.Dedup.Channels)
+	}
+	if cfg.Scan != nil {
+		scanner, err := scan.New(cfg.Scan)
+		if err != nil {
+			return nil, err
+		}
+
+		s.pubsub.UseScanner(scanner)
+		logging.LogTarget("service", "configured content scanner", cfg.Scan.URL)
+	}
+	s.kv = kv.New(s.storage)
+	if len(cfg.Hooks) > 0 {
+		hooks, err := hook.New(cfg.Hooks, s.kv)
+		if err != nil {
+			return nil, err
+		}
+
+		s.pubsub.UseHooks(hooks)
+		logging.LogTarget("service", "configured publish hooks", hooks.Len())
+	}
+	var connectors map[string]service.Connector
+	if s.plugins != nil {
+		s.pubsub.UseHooks(s.plugins)
+		connectors = s.plugins.Connectors()
+	}
+	if len(cfg.Rules) > 0 {
+		router, err := rules.New(s.pubsub, cfg.Rules, connectors)
+		if err != nil {
+			return nil, err
+		}
+
+		s.pubsub.UseRouter(router)
+		logging.LogTarget("service", "configured routing rules", len(cfg.Rules))
+	}
+	if cfg.Delay != nil {
+		queue, err := delay.New(s.context, cfg.Delay.Dir, cfg.Delay.MaxPeriod(), cfg.Delay.MaxCount(), s.onDelivery)
+		if err != nil {
+			return nil, err
+		}
+
+		s.pubsub.UseDelay(queue)
+		logging.LogTarget("service", "configured delayed delivery", queue.Len())
+	}
+	if len(cfg.Synthetic) > 0 {
+		channels, err := synthetic.New(s.context, s.pubsub, cfg.Synthetic)
+		if err != nil {
+			return nil, err
+		}
+
+		s.pubsub.UseObserver(channels)
+		logging.LogTarget("service", "configured synthetic channels", len(cfg.Synthetic))
+	}
+	if cfg.DeadLetter != nil {
+		s.pubsub.UseDeadLetter(cfg.DeadLetter.Prefix(), cfg.DeadLetter.StoredFor())
+		logging.LogTarget("service", "configured dead-letter channels", cfg.DeadLetter.Prefix())
+	}
+	if cfg.Snapshot != nil {
+		if s.snapshots, err = snapshot.New(s.context, cfg.Snapshot.Dir, cfg.Snapshot.Period(), cfg.Snapshot.MaxCount()); err != nil {
+			return nil, err
+		}
+		logging.LogTarget("service", "configured subscription snapshots", cfg.Snapshot.Period())
+	}
 
 	// Load the monitor storage provider
 	nodeName := address.Fingerprint(s.ID()).String()
 	sampler := newSampler(s, s.measurer)
-	s.monitor = config.LoadProvider(cfg.Monitor,
+	monitors := append([]config.Provider{
 		monitor.NewSelf(sampler, s.selfPublish),
 		monitor.NewNoop(),
 		monitor.NewHTTP(sampler),
 		monitor.NewStatsd(sampler, nodeName),
-		monitor.NewPrometheus(sampler, mux),
-	).(monitor.Storage)
+	}, monitor.Providers(sampler, mux)...)
+	s.monitor = config.LoadProvider(cfg.Monitor, monitors...).(monitor.Storage)
 	logging.LogTarget("service", "configured monitoring sink", s.monitor.Name())
 
+	// Trace the publications with OpenTelemetry, if configured
+	if cfg.Tracing != nil && cfg.Tracing.Endpoint != "" {
+		if s.tracing, err = tracing.Configure(cfg.Tracing.Endpoint, cfg.Tracing.Insecure, cfg.Tracing.SampleRatio(), nodeName); err != nil {
+			return nil, err
+		}
+		logging.LogTarget("service", "configured tracing", cfg.Tracing.Endpoint)
+	}
+
+	// Record the security-relevant events in the audit trail, if configured
+	if cfg.Audit != nil {
+		if err := s.configureAudit(cfg.Audit, nodeName); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create a new cluster if we have this configured
 	if cfg.Cluster != nil {
-		s.cluster = cluster.NewSwarm(cfg.Cluster)
+		s.cluster = cluster.NewSwarm(cfg.Cluster, cfg.ClusterKey())
 		s.cluster.OnMessage = s.onPeerMessage
 		s.cluster.OnSubscribe = s.pubsub.Subscribe
 		s.cluster.OnUnsubscribe = s.pubsub.Unsubscribe
 		s.cluster.OnDisconnect = s.pubsub.OnLastWill
+		s.cluster.OnHeal = s.onClusterHeal
+	}
+
+	// Create a federation with remote clusters if we have this configured
+	if cfg.Federation != nil {
+		if s.federation, err = federation.New(cfg.Federation, cfg.FederationKey()); err != nil {
+			return nil, err
+		}
+		s.federation.OnMessage = s.onFederatedMessage
 	}
 
 	// Attach survey handlers
 	s.surveyor = survey.New(s.pubsub, s.cluster)
 	s.presence = presence.New(s, s.pubsub, s.surveyor, s.subscriptions)
+	if provider != nil && provider.Presence() != nil {
+		s.presence.UseCache(provider.Presence())
+		logging.LogTarget("service", "configured presence cache", s.storage.Name())
+	}
+	s.capacity = capacity.New(nodeName, capacityInterval, capacitySamples, s.sampleCapacity, s.capacityLimits)
 	if s.cluster != nil {
-		s.surveyor.HandleFunc(s.presence, ssdstore, memstore)
+		s.capacity.UseSurvey(s.surveyor)
+		s.surveyor.HandleFunc(s.presence, s.capacity)
+		if surveyee, ok := s.storage.(survey.Surveyee); ok {
+			s.surveyor.HandleFunc(surveyee)
+		}
 	}
 
 	// Create a new cipher from the licence provided
@@ -167,6 +419,10 @@ func NewService(ctx context.Context, cfg *config.Config) (s *Service, err error)
 
 	// Attach handlers
 	s.keygen = keygen.New(cipher, s.contracts, s)
+	s.keygen.UseAuditor(s)
+	if cfg.Federation != nil && cfg.Federation.Region != "" {
+		s.keygen.UseRegion(cfg.Federation.Region, cfg.Federation.RegionEndpoints())
+	}
 	if cfg.Debug {
 		mux.HandleFunc("/debug/pprof/", pprof.Index)
 		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
@@ -176,15 +432,95 @@ func NewService(ctx context.Context, cfg *config.Config) (s *Service, err error)
 	}
 	mux.HandleFunc("/health", s.onHealth)
 	mux.HandleFunc("/keygen", s.keygen.HTTP())
-	mux.HandleFunc("/presence", s.presence.OnHTTP)
+	mux.HandleFunc("/presence", s.shedHTTP(overload.PriorityPresence, s.presence.OnHTTP))
+	mux.HandleFunc("/admin/analytics", s.admin(s.analytics.OnHTTP))
+	mux.HandleFunc("/admin/drain", s.admin(s.onDrain))
+	mux.HandleFunc("/admin/cluster", s.admin(s.onTopology))
+	mux.HandleFunc("/admin/scheduler", s.admin(s.onScheduler))
+	mux.HandleFunc("/admin/failover", s.admin(s.onFailover))
+	mux.HandleFunc("/admin/capacity", s.admin(s.capacity.OnHTTP))
+	mux.HandleFunc("/admin/protocols", s.admin(s.onProtocols))
+	mux.HandleFunc("/admin/connections", s.admin(s.onClients))
+	mux.HandleFunc("/admin/trie", s.admin(s.onTrie))
+	mux.HandleFunc("/admin/keygen", s.admin(s.keygen.OnHTTP))
+	mux.HandleFunc("/admin/reload", s.admin(s.onReload))
+	if cfg.Dashboard {
+		board := dashboard.New(s.storage, s.License.Contract(), s.dashboardStats)
+		mux.HandleFunc("/admin/dashboard", s.admin(board.OnHTTP))
+		mux.HandleFunc("/admin/dashboard/stats", s.admin(board.OnStats))
+		mux.HandleFunc("/admin/inspect", s.admin(board.OnInspect))
+	}
+	if s.snapshots != nil {
+		mux.HandleFunc("/admin/subscriptions", s.admin(s.snapshots.OnHTTP))
+	}
 	mux.HandleFunc("/", s.onRequest)
 
 	// Attach "emitter/..." handlers
-	s.pubsub.Handle("presence", s.presence.OnRequest)
+	s.pubsub.Handle("presence", s.shed(overload.PriorityPresence, s.presence.OnRequest))
 	s.pubsub.Handle("keygen", s.keygen.OnRequest)
 	s.pubsub.Handle("keyban", keyban.New(s, s.keygen, s.cluster).OnRequest)
+	s.pubsub.Handle("keyrenew", s.keygen.OnRenew)
+	s.pubsub.Handle("request", reply.New(s, s.keygen, s.pubsub).OnRequest)
 	s.pubsub.Handle("link", link.New(s, s.pubsub).OnRequest)
 	s.pubsub.Handle("me", me.New().OnRequest)
+	s.pubsub.Handle("subscribe", s.pubsub.OnSubscribeRequest)
+	s.pubsub.Handle("unsubscribe", s.pubsub.OnUnsubscribeRequest)
+	s.pubsub.Handle("subscriptions", s.pubsub.OnSubscriptionsRequest)
+	s.pubsub.Handle("headers", s.pubsub.OnHeadersRequest)
+	s.pubsub.Handle("chunks", s.pubsub.OnChunksRequest)
+	s.pubsub.Handle("expiry", s.pubsub.OnExpiryRequest)
+
+	// Decide what happens when a client connects again while it is still connected
+	if s.takeover, err = cfg.Session.TakeoverPolicy(); err != nil {
+		return nil, err
+	}
+
+	// Tune the liveness of the connections of each listener
+	if s.liveness, err = livenessOf(cfg.Liveness); err != nil {
+		return nil, err
+	}
+
+	// Negotiate the compression and the subprotocols of the websockets of each listener
+	if s.websockets, err = websocketsOf(cfg.Websocket); err != nil {
+		return nil, err
+	}
+
+	// The QUIC listener is secured with the certificates of the secure listener
+	if cfg.QUIC != nil && cfg.TLS == nil {
+		return nil, errors.New("the quic listener requires the tls listener to be configured")
+	}
+
+	// Keep the sessions of the clients which connect with the clean session flag off, if configured
+	if cfg.Session != nil {
+		count, size := cfg.Session.QueueLimits()
+		s.sessions = session.NewDurable(s.context, s.pubsub, cfg.Session.ExpiryPeriod(), count, size)
+		if cfg.DeadLetter != nil {
+			s.sessions.UseDeadLetter(s.pubsub)
+		}
+	}
+
+	states := session.New(s, s.pubsub, s.storage)
+	s.pubsub.Handle("export", states.OnExport)
+	s.pubsub.Handle("import", states.OnImport)
+	s.pubsub.Handle("shadow", shadow.New(s, s.pubsub, s.storage).OnRequest)
+	s.pubsub.Handle("history", s.shed(overload.PriorityHistory, history.New(s, s.storage).OnRequest))
+
+	// Sign the delivered messages if we have this configured
+	if cfg.Signing != nil {
+		signer, err := sign.New(s.ID(), cfg.Signing.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		var directory signing.Directory
+		if s.cluster != nil {
+			directory = s.cluster
+		}
+
+		s.signing = signing.New(signer, directory)
+		s.pubsub.Handle("sign", s.signing.OnRequest)
+		logging.LogTarget("service", "configured message signing", base64.StdEncoding.EncodeToString(signer.PublicKey()))
+	}
 
 	// Addresses and things
 	logging.LogTarget("service", "configured node name", nodeName)
@@ -209,16 +545,32 @@ func (s *Service) NumPeers() int {
 	return 0
 }
 
-// Listen starts the service.
+// Listen starts the service and blocks, until a signal makes the process exit.
 func (s *Service) Listen() (err error) {
 	defer s.Close()
 	s.hookSignals()
+	if err = s.Start(); err != nil {
+		return err
+	}
+
+	// Block
+	select {}
+}
+
+// Start starts the cluster, the federation and the listeners configured, then returns while
+// the service keeps running in the background, until it is closed.
+func (s *Service) Start() error {
+	return s.StartOn(nil)
+}
+
+// StartOn starts the service as Start does, except that the default listener accepts the
+// connections of the listener given, if any, instead of listening on the address configured.
+func (s *Service) StartOn(l net.Listener) error {
+	s.Config.Watch(s.context, s.onConfigChange)
 
 	// Create the cluster if required
 	if s.cluster != nil {
-		if s.cluster.Listen(s.context); err != nil {
-			panic(err)
-		}
+		s.cluster.Listen(s.context)
 
 		// Join our seed
 		s.Join(s.Config.Cluster.Seed)
@@ -227,8 +579,22 @@ func (s *Service) Listen() (err error) {
 		s.surveyor.Start()
 	}
 
+	// Accept the links from the federated clusters
+	if s.federation != nil {
+		if err := s.federation.Listen(s.context); err != nil {
+			return err
+		}
+	}
+
 	// Setup the listeners on both default and a secure addresses
-	s.listen(s.Config.Addr(), nil)
+	if l != nil {
+		if err := s.Serve("tcp", l); err != nil {
+			return err
+		}
+	} else if err := s.listen(s.Config.Addr(), nil); err != nil {
+		return err
+	}
+
 	if tls, tlsValidator, ok := s.Config.Certificate(); ok {
 
 		// If we need to validate certificate, spin up a listener on port 80
@@ -239,48 +605,189 @@ func (s *Service) Listen() (err error) {
 		}
 
 		if tlsAddr, err := address.Parse(s.Config.TLS.ListenAddr, 443); err == nil {
-			s.listen(tlsAddr, tls)
+			s.certs.Store(tls)
+			if err := s.listen(tlsAddr, s.reloadableTLS()); err != nil {
+				return err
+			}
+			if err := s.listenQUIC(s.Config.QUIC); err != nil {
+				return err
+			}
+			s.watchCertificates()
 		}
+	} else if s.Config.QUIC != nil {
+		logging.LogWarn("service", "unable to start the QUIC listener without the TLS certificates")
+	}
+
+	// Accept the clients running on the same host through a Unix domain socket
+	if s.Config.Unix != nil {
+		if err := s.listenUnix(s.Config.Unix); err != nil {
+			return err
+		}
+	}
+
+	// Accept the publishers running on the same host through the shared memory
+	if s.Config.Shared != nil {
+		go s.listenShared(s.Config.Shared.Directory())
+	}
+
+	// Warn the clients which asked for it before the keys of their subscriptions expire
+	async.Repeat(s.context, expiryInterval, s.warnExpiring)
+
+	// Publish the live statistics of the broker on the system channels
+	if s.Config.System != nil {
+		async.Repeat(s.context, s.Config.System.Period(), newSystem(s, s.selfPublish).write)
 	}
 
-	// Block
 	logging.LogAction("service", "service started")
-	select {}
+	return nil
+}
+
+// listenerConfig returns the configuration of a listener.
+func (s *Service) listenerConfig(name string, conf *tls.Config) (listener.Config, error) {
+	options := listener.Config{
+		FlushRate: s.Config.Limit.FlushRate,
+		TLS:       conf,
+		Admit:     s.admitOf(name),
+	}
+
+	// Read the address of the clients sent by the load balancers, if enabled
+	if s.Config.Proxy != nil {
+		trusted, err := s.Config.Proxy.Networks()
+		if err != nil {
+			return options, err
+		}
+
+		options.Proxy = true
+		options.Trusted = trusted
+	}
+	return options, nil
 }
 
 // listen configures an main listener on a specified address.
-func (s *Service) listen(addr *net.TCPAddr, conf *tls.Config) {
+func (s *Service) listen(addr *net.TCPAddr, conf *tls.Config) error {
+	name := "tcp"
+	if conf != nil {
+		name = "tls"
+	}
+
+	options, err := s.listenerConfig(name, conf)
+	if err != nil {
+		return err
+	}
 
 	// Create new listener
 	logging.LogTarget("service", "starting the listener", addr)
-	l, err := listener.New(addr.String(), listener.Config{
+	l, err := listener.New(addr.String(), options)
+	if err != nil {
+		return err
+	}
+
+	s.serve(name, l)
+	return nil
+}
+
+// listenUnix configures a listener on a Unix domain socket, for the local clients.
+func (s *Service) listenUnix(c *config.UnixConfig) error {
+	mode, err := c.FileMode()
+	if err != nil {
+		return err
+	}
+
+	// The access to the socket is granted by its permissions rather than by address
+	logging.LogTarget("service", "starting the listener", c.SocketPath())
+	l, err := listener.NewUnix(c.SocketPath(), mode, listener.Config{
 		FlushRate: s.Config.Limit.FlushRate,
-		TLS:       conf,
 	})
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	s.serve("unix", l)
+	return nil
+}
+
+// listenQUIC configures the experimental listener of the MQTT connections over QUIC, which
+// is secured with the certificates of the secure listener and shares its access policy.
+func (s *Service) listenQUIC(c *config.QUICConfig) error {
+	if c == nil {
+		return nil
+	}
+
+	addr, err := address.Parse(c.ListenAddr, 443)
+	if err != nil {
+		return err
+	}
+
+	logging.LogTarget("service", "starting the QUIC listener", addr)
+	l, err := quic.Listen(addr.String(), quic.Config{
+		TLS:   s.reloadableTLS(),
+		Admit: s.admitOf("tls"),
+	})
+	if err != nil {
+		return err
 	}
 
+	s.track(l)
+	go s.tcpOf("quic").Serve(l)
+	return nil
+}
+
+// serve serves both the HTTP and the MQTT connections of a listener.
+func (s *Service) serve(name string, l *listener.Listener) {
+
 	// Set the read timeout on our mux listener
 	l.SetReadTimeout(120 * time.Second)
+	l.HandleError(s.onListenerErrorOf(name))
 
 	// Configure the matchers
-	l.ServeAsync(listener.MatchHTTP(), s.http.Serve)
-	l.ServeAsync(listener.MatchAny(), s.tcp.Serve)
+	l.ServeAsync(listener.MatchHTTP(), s.httpOf(name).Serve)
+	l.ServeAsync(listener.MatchAny(), s.tcpOf(name).Serve)
+	s.track(l)
 	go l.Serve()
 }
 
+// track keeps a listener, so that it is closed along with the service.
+func (s *Service) track(l io.Closer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.listeners = append(s.listeners, l)
+}
+
 // Join attempts to join a set of existing peers.
 func (s *Service) Join(peers ...string) []error {
 	return s.cluster.Join(peers...)
 }
 
+// NotifyPublish notifies the analytics and the federated clusters when a message was
+// published on this node.
+func (s *Service) NotifyPublish(m *message.Message, subscribers int) {
+	s.measurer.Measure("fanout.msg", int32(subscribers))
+	if subscribers == 0 {
+		s.measurer.Measure("pubsub.orphaned", 1)
+	}
+
+	if s.analytics != nil {
+		s.analytics.OnPublish(m, subscribers)
+	}
+
+	if s.federation != nil {
+		s.federation.Forward(m)
+	}
+}
+
 // NotifySubscribe notifies the swarm when a subscription occurs.
 func (s *Service) NotifySubscribe(sub message.Subscriber, ev *event.Subscription) {
 	ev.Peer = s.ID()
 
 	// Broadcast direct subscriptions
 	if sub.Type() == message.SubscriberDirect {
+		s.measurer.Measure("pubsub.subscribe", 1)
+		if s.analytics != nil {
+			s.analytics.OnSubscribe(ev)
+		}
+		if s.snapshots != nil {
+			s.snapshots.OnSubscribe(ev)
+		}
 
 		// If we have a new direct subscriber, issue presence message and publish it
 		if ev.Channel != nil {
@@ -299,6 +806,14 @@ func (s *Service) NotifyUnsubscribe(sub message.Subscriber, ev *event.Subscripti
 	ev.Peer = s.ID()
 	switch sub.Type() {
 	case message.SubscriberDirect:
+		s.measurer.Measure("pubsub.unsubscribe", 1)
+		if s.analytics != nil {
+			s.analytics.OnUnsubscribe(ev)
+		}
+		if s.snapshots != nil {
+			s.snapshots.OnUnsubscribe(ev)
+		}
+
 		if ev.Channel != nil { // If we have a new direct subscriber, issue presence message and publish it
 			s.presence.Notify(presence.EventTypeUnsubscribe, ev, nil)
 		}
@@ -315,38 +830,84 @@ func (s *Service) NotifyUnsubscribe(sub message.Subscriber, ev *event.Subscripti
 	}
 }
 
-// Occurs when a new client connection is accepted.
-func (s *Service) onAcceptConn(t net.Conn) {
-	conn := s.newConn(t, s.Config.Limit.ReadRate)
+// Occurs when a new client connection is accepted on a listener.
+func (s *Service) onAcceptConn(t net.Conn, name string) {
+	if s.isDraining() {
+		t.Close()
+		return
+	}
+
+	if s.isExhausted() {
+		s.refuse(t)
+		return
+	}
+
+	if throttled, delay := s.isThrottled(); throttled {
+		s.throttle(t, delay)
+		return
+	}
+
+	conn := s.newConn(t, int(atomic.LoadInt64(&s.readRate)))
+	conn.tune(func(l *liveness) {
+		*l = s.liveness[name]
+	})
 	go conn.Process()
 }
 
 // Occurs when a new HTTP request is received.
 func (s *Service) onRequest(w http.ResponseWriter, r *http.Request) {
-	if ws, ok := websocket.TryUpgrade(w, r); ok {
-		s.onAcceptConn(ws)
+	if s.isDraining() {
+		s.unavailable(w)
+		return
+	}
+
+	if s.isExhausted() {
+		s.exhausted(w)
+		return
+	}
+
+	if ws, ok := s.upgrade(w, r); ok {
+		s.onAcceptConn(ws, listenerOf(r))
 		return
 	}
 }
 
 // Occurs when a new HTTP health check is received.
 func (s *Service) onHealth(w http.ResponseWriter, r *http.Request) {
+	if s.isDraining() {
+		s.unavailable(w)
+		return
+	}
+
 	w.WriteHeader(200)
 }
 
+// Occurs when a held message reaches its delivery time.
+func (s *Service) onDelivery(m *message.Message, stored bool) {
+	if contract, ok := s.contracts.Get(m.Contract()); ok {
+		s.pubsub.Deliver(contract, m, stored)
+	}
+}
+
 // Occurs when a message is received from a peer.
 func (s *Service) onPeerMessage(m *message.Message) {
 	defer s.measurer.MeasureElapsed("peer.msg", time.Now())
-	size, n := len(m.Payload), 0
 	filter := func(s message.Subscriber) bool {
 		return s.Type() == message.SubscriberDirect // only local subscribers
 	}
 
 	// Iterate through all subscribers and send them the message
-	for _, subscriber := range s.subscriptions.Lookup(m.Ssid(), filter) {
-		subscriber.Send(m)
-		n += size
-	}
+	_, span := tracing.Continue(m, "peer.deliver", attribute.String("channel", string(m.Channel)))
+	subscribers := s.subscriptions.LookupID(m.ID, filter)
+	span.SetAttributes(attribute.Int("subscribers", len(subscribers)))
+	n := len(m.Payload) * len(subscribers)
+	s.scheduler.Schedule(m.Contract(), func() {
+		for _, subscriber := range subscribers {
+			subscriber.Send(m)
+		}
+		span.End()
+		subscribers.Release()
+	})
 
 	// Get the contract
 	contract, contractFound := s.contracts.Get(m.Contract())
@@ -355,6 +916,45 @@ func (s *Service) onPeerMessage(m *message.Message) {
 	}
 }
 
+// Occurs when a partition of the cluster has healed, the operators are notified through
+// the "emitter/cluster/heal/" channel.
+func (s *Service) onClusterHeal(heal *cluster.Heal) {
+	s.measurer.Measure("cluster.heal", 1)
+	if payload, err := json.Marshal(heal); err == nil {
+		s.selfPublish("cluster/heal/", payload)
+	}
+}
+
+// Occurs when a message is received from a federated cluster.
+func (s *Service) onFederatedMessage(m *message.Message) {
+	defer s.measurer.MeasureElapsed("federation.msg", time.Now())
+
+	// Only accept the messages of the contracts this cluster serves
+	contract, contractFound := s.contracts.Get(m.Contract())
+	if !contractFound {
+		return
+	}
+
+	// Store the message if needed, since each of the clusters has its own storage
+	if m.Stored() {
+		s.scheduler.Schedule(m.Contract(), func() {
+			s.storage.Store(m)
+		})
+	}
+
+	// Publish to everyone in our cluster, without forwarding it back to the federation
+	size := s.pubsub.Publish(m, nil)
+	contract.Stats().AddEgress(size)
+}
+
+// weightOf returns the scheduling weight of a contract.
+func (s *Service) weightOf(id uint32) int {
+	if contract, ok := s.contracts.Get(id); ok {
+		return contract.Weight()
+	}
+	return 1
+}
+
 // Query is a mechanism where a message from one node is broadcasted to the
 // entire cluster and each node in the group responds to the message.
 func (s *Service) Query(query string, payload []byte) (message.Awaiter, error) {
@@ -374,18 +974,33 @@ func (s *Service) Authorize(channel *security.Channel, permission uint8) (contra
 	// Check if the key is blacklisted
 	channelKey := string(channel.Key)
 	if s.cluster != nil && s.cluster.Contains((*event.Ban)(&channelKey)) {
+		s.Audit(audit.KindAuthFailed, 0, "", "banned key for "+string(channel.Channel))
 		return nil, nil, false
 	}
 
 	// Attempt to parse the key
 	key, err := s.keygen.DecryptKey(channelKey)
 	if err != nil || key.IsExpired() {
+		s.Audit(audit.KindAuthFailed, 0, "", "invalid or expired key for "+string(channel.Channel))
 		return nil, nil, false
 	}
 
 	// Attempt to fetch the contract using the key. Underneath, it's cached.
 	contract, contractFound := s.contracts.Get(key.Contract())
-	if !contractFound || !contract.Validate(key) || !key.HasPermission(permission) || !key.ValidateChannel(channel) {
+	if !contractFound || !contract.Validate(key) {
+		s.Audit(audit.KindAuthFailed, key.Contract(), "", "invalid contract for "+string(channel.Channel))
+		return nil, nil, false
+	}
+
+	// Make sure the key grants the permission on the channel
+	if !key.HasPermission(permission) || !key.ValidateChannel(channel) {
+		s.Audit(audit.KindDenied, key.Contract(), "", "no permission on "+string(channel.Channel))
+		return nil, nil, false
+	}
+
+	// Let the authorizer plugins approve the request as well
+	if s.plugins != nil && !s.plugins.Authorize(key.Contract(), channel.Channel, permission) {
+		s.Audit(audit.KindDenied, key.Contract(), "", "refused by the plugins on "+string(channel.Channel))
 		return nil, nil, false
 	}
 
@@ -408,6 +1023,8 @@ func (s *Service) selfPublish(channelName string, payload []byte) {
 // OnSignal will be called when a OS-level signal is received.
 func (s *Service) onSignal(sig os.Signal) {
 	switch sig {
+	case syscall.SIGHUP:
+		s.onConfigChange()
 	case syscall.SIGTERM:
 		fallthrough
 	case syscall.SIGINT:
@@ -420,7 +1037,7 @@ func (s *Service) onSignal(sig os.Signal) {
 // OnSignal starts the signal processing and makes su
 func (s *Service) hookSignals() {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
 		for sig := range c {
 			s.onSignal(sig)
@@ -434,9 +1051,33 @@ func (s *Service) Close() {
 		s.cancel()
 	}
 
+	// Stop accepting the clients and disconnect the ones still connected
+	s.lock.Lock()
+	listeners := s.listeners
+	s.listeners = nil
+	s.lock.Unlock()
+	for _, l := range listeners {
+		dispose(l)
+	}
+
+	s.conns.Range(func(_, v interface{}) bool {
+		v.(*Conn).Close()
+		return true
+	})
+
 	// Gracefully dispose all of our resources
+	dispose(s.scheduler)
 	dispose(s.cluster)
+	dispose(s.federation)
 	dispose(s.storage)
+	dispose(s.analytics)
+	dispose(s.capacity)
+	dispose(s.guard)
+	dispose(s.descriptors)
+	dispose(s.poller)
+	dispose(s.tracing)
+	dispose(s.audit)
+	dispose(s.plugins)
 }
 
 func dispose(resource io.Closer) {
@@ -15,10 +15,23 @@
 package broker
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/message"
 	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/provider/usage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/security/license"
+	"github.com/emitter-io/emitter/internal/service/cluster"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/emitter-io/emitter/internal/service/pubsub"
+	"github.com/emitter-io/emitter/internal/service/scheduler"
+	"github.com/emitter-io/stats"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -241,3 +254,86 @@ func TestPubsub(t *testing.T) {
 	}
 
 }
+
+func TestOnFederatedMessage(t *testing.T) {
+	license, _ := license.Parse(testLicense)
+	store := storage.NewInMemory(nil)
+	store.Configure(nil)
+
+	s := &Service{
+		subscriptions: message.NewTrie(),
+		License:       license,
+		measurer:      stats.NewNoop(),
+		storage:       store,
+		contracts:     contract.NewSingleContractProvider(license, usage.NewNoop()),
+		scheduler:     scheduler.New(0, nil),
+	}
+	s.pubsub = pubsub.New(s, s.storage, s, new(fake.Shedder), s.scheduler, s.subscriptions)
+
+	ssid := message.Ssid{license.Contract(), 1, 2}
+	conn := new(fake.Conn)
+	s.subscriptions.Subscribe(ssid, conn)
+
+	msg := message.New(ssid, []byte("a/b/"), []byte("hello"))
+	msg.TTL = 30
+	s.onFederatedMessage(msg)
+	assert.Len(t, conn.Outgoing, 1)
+
+	stored, err := store.Query(ssid, time.Unix(0, 0), time.Now(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, stored, 1)
+
+	// The messages of the other contracts are dropped
+	other := message.Ssid{license.Contract() + 1, 1, 2}
+	s.subscriptions.Subscribe(other, conn)
+	s.onFederatedMessage(message.New(other, []byte("a/b/"), []byte("hello")))
+	assert.Len(t, conn.Outgoing, 1)
+}
+
+func TestOnClusterHeal(t *testing.T) {
+	license, _ := license.Parse(testLicense)
+	s := &Service{
+		subscriptions: message.NewTrie(),
+		License:       license,
+		measurer:      stats.NewNoop(),
+		storage:       new(storage.Noop),
+		contracts:     contract.NewSingleContractProvider(license, usage.NewNoop()),
+	}
+	s.pubsub = pubsub.New(s, s.storage, s, new(fake.Shedder), new(fake.Scheduler), s.subscriptions)
+
+	channel := security.ParseChannel([]byte("emitter/cluster/heal/"))
+	conn := new(fake.Conn)
+	s.subscriptions.Subscribe(message.NewSsid(license.Contract(), channel.Query), conn)
+
+	s.onClusterHeal(&cluster.Heal{Peer: "00:00:00:00:00:02", Policy: cluster.MergeNewer})
+	assert.Len(t, conn.Outgoing, 1)
+	assert.Contains(t, string(conn.Outgoing[0].Payload), `"policy":"newer"`)
+}
+
+func TestListenerConfig(t *testing.T) {
+	s := &Service{Config: config.NewDefault().(*config.Config)}
+	options, err := s.listenerConfig("tcp", nil)
+	assert.NoError(t, err)
+	assert.False(t, options.Proxy)
+
+	s.Config.Proxy = &config.ProxyConfig{Trusted: "10.0.0.0/8"}
+	options, err = s.listenerConfig("tcp", nil)
+	assert.NoError(t, err)
+	assert.True(t, options.Proxy)
+	assert.Len(t, options.Trusted, 1)
+
+	s.Config.Proxy.Trusted = "invalid"
+	_, err = s.listenerConfig("tcp", nil)
+	assert.Error(t, err)
+}
+
+func TestNewService_QUICWithoutTLS(t *testing.T) {
+	cfg := config.NewDefault().(*config.Config)
+	cfg.License = testLicense
+	cfg.TLS = nil
+	cfg.Cluster = nil
+	cfg.QUIC = &config.QUICConfig{ListenAddr: ":0"}
+
+	_, err := NewService(context.Background(), cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/pkg/shm"
+)
+
+const sharedInterval = time.Second // The interval between the scans for new ring buffers.
+
+// listenShared watches the directory for the ring buffers of the co-located publishers
+// and processes each of them as a connection, until the service is closed.
+func (s *Service) listenShared(dir string) {
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		logging.LogError("service", "creating the shared memory directory", err)
+		return
+	}
+
+	logging.LogTarget("service", "watching for shared memory publishers", dir)
+	var lock sync.Mutex
+	rings := make(map[string]struct{})
+	ticker := time.NewTicker(sharedInterval)
+	defer ticker.Stop()
+	for {
+		paths, err := shm.List(dir)
+		if err != nil {
+			logging.LogError("service", "listing the shared memory publishers", err)
+		}
+
+		for _, path := range paths {
+			lock.Lock()
+			_, ok := rings[path]
+			lock.Unlock()
+			if ok {
+				continue
+			}
+
+			// A ring which can't be opened yet might still be created, so retry it later
+			ring, err := shm.Open(path)
+			if err != nil {
+				continue
+			}
+
+			lock.Lock()
+			rings[path] = struct{}{}
+			lock.Unlock()
+
+			conn := s.newConn(ring, 0)
+			go func(path string) {
+				conn.Process()
+				lock.Lock()
+				delete(rings, path)
+				lock.Unlock()
+			}(path)
+		}
+
+		select {
+		case <-s.context.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
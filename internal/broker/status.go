@@ -16,15 +16,22 @@ package broker
 
 import (
 	"sync/atomic"
+	"time"
 
 	"github.com/emitter-io/address"
+	"github.com/emitter-io/emitter/internal/pool"
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	"github.com/emitter-io/emitter/internal/service/dashboard"
 	"github.com/emitter-io/stats"
 )
 
 // sampler reads statistics of the service and creates a snapshot
 type sampler struct {
-	service  *Service       // The service to use for stats collection.
-	measurer stats.Measurer // The measurer to use for snapshotting.
+	service   *Service              // The service to use for stats collection.
+	measurer  stats.Measurer        // The measurer to use for snapshotting.
+	forwarded int64                 // The number of messages forwarded to the peers, at the previous snapshot.
+	pools     map[string]pool.Stats // The statistics of the pools, at the previous snapshot.
+	contracts contract.CacheStats   // The statistics of the contract cache, at the previous snapshot.
 }
 
 // newSampler creates a stats sampler.
@@ -49,7 +56,36 @@ func (s *sampler) Snapshot() (snapshot []byte) {
 	stat.Measure("node.id", int32(node))
 	stat.Measure("node.peers", int32(serv.NumPeers()))
 	stat.Measure("node.conns", int32(atomic.LoadInt64(&serv.connections)))
+	stat.Measure("node.queued", int32(atomic.LoadInt64(&serv.queued)))
+	if serv.poller != nil {
+		stat.Measure("node.parked", int32(serv.poller.Len()))
+	}
 	stat.Measure("node.subs", int32(serv.subscriptions.Count()))
+	if serv.cluster != nil {
+		stat.Measure("node.state", int32(serv.cluster.StateLen()))
+
+		// Count the messages forwarded to the peers since the previous snapshot
+		forwarded := serv.cluster.Forwarded()
+		stat.Measure("cluster.forwarded", int32(forwarded-s.forwarded))
+		s.forwarded = forwarded
+	}
+	if serv.guard != nil {
+		stat.Measure("node.lag", int32(serv.guard.Lag()/time.Microsecond))
+	}
+	if serv.admission != nil {
+		stat.Measure("node.backlog", int32(serv.admission.Backlog()))
+	}
+	if serv.scheduler != nil {
+		if delays := serv.scheduler.Delays(); len(delays) > 0 {
+			stat.Measure("scheduler.delay", int32(delays[0].Delay*1000))
+		}
+	}
+
+	// Count the values taken from the pools and the ones allocated since the previous snapshot
+	s.measurePools(stat)
+	if cached, ok := serv.contracts.(contract.Cached); ok {
+		s.measureContracts(stat, cached.CacheStats())
+	}
 
 	// Add node tags
 	stat.Tag("node.id", node.String())
@@ -61,3 +97,44 @@ func (s *sampler) Snapshot() (snapshot []byte) {
 	}
 	return
 }
+
+// measurePools measures the use of the pools since the previous snapshot.
+func (s *sampler) measurePools(stat stats.Measurer) {
+	pools := make(map[string]pool.Stats, len(s.pools))
+	for _, p := range pool.Snapshot() {
+		last := s.pools[p.Name]
+		stat.Measure("pool."+p.Name+".gets", int32(p.Gets-last.Gets))
+		stat.Measure("pool."+p.Name+".allocs", int32(p.Allocs-last.Allocs))
+		pools[p.Name] = p
+	}
+	s.pools = pools
+}
+
+// measureContracts measures the use of the contract cache since the previous snapshot.
+func (s *sampler) measureContracts(stat stats.Measurer, cache contract.CacheStats) {
+	last := s.contracts
+	stat.Measure("contract.hit", int32(cache.Hits-last.Hits))
+	stat.Measure("contract.miss", int32(cache.Misses-last.Misses))
+	stat.Measure("contract.stale", int32(cache.Stale-last.Stale))
+	stat.Measure("contract.error", int32(cache.Errors-last.Errors))
+	if cache.Open {
+		stat.Measure("contract.open", 1)
+	} else {
+		stat.Measure("contract.open", 0)
+	}
+	s.contracts = cache
+}
+
+// dashboardStats reads the live counters of the node shown on the dashboard.
+func (s *Service) dashboardStats() dashboard.Stats {
+	return dashboard.Stats{
+		Node:          address.Fingerprint(s.ID()).String(),
+		Connections:   atomic.LoadInt64(&s.connections),
+		Subscriptions: s.subscriptions.Count(),
+		Peers:         s.NumPeers(),
+		Received:      atomic.LoadInt64(&s.received),
+		Sent:          atomic.LoadInt64(&s.sent),
+		Ingress:       atomic.LoadInt64(&s.ingress),
+		Egress:        atomic.LoadInt64(&s.egress),
+	}
+}
@@ -19,6 +19,8 @@ import (
 
 	"github.com/emitter-io/emitter/internal/config"
 	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/pool"
+	"github.com/emitter-io/emitter/internal/provider/contract"
 	"github.com/emitter-io/emitter/internal/security/license"
 	"github.com/emitter-io/stats"
 	"github.com/stretchr/testify/assert"
@@ -44,3 +46,39 @@ func Test_sendStats(t *testing.T) {
 
 	})
 }
+
+func Test_measurePools(t *testing.T) {
+	p := pool.New("test.sampler", func() interface{} { return new(int) })
+	p.Get()
+
+	m := stats.New()
+	s := &sampler{measurer: m}
+	s.measurePools(m)
+	assert.Equal(t, int64(1), s.pools["test.sampler"].Gets)
+
+	p.Get()
+	s.measurePools(m)
+	assert.Equal(t, int64(2), s.pools["test.sampler"].Gets)
+
+	snapshots, err := stats.Restore(m.Snapshot())
+	assert.NoError(t, err)
+	metrics := snapshots.ToMap()
+	assert.Equal(t, int32(2), metrics["pool.test.sampler.gets"].Amount)
+	assert.Equal(t, int32(2), metrics["pool.message.subscribers.allocs"].Amount)
+}
+
+func Test_measureContracts(t *testing.T) {
+	m := stats.New()
+	s := &sampler{measurer: m}
+	s.measureContracts(m, contract.CacheStats{Hits: 5, Misses: 2})
+	s.measureContracts(m, contract.CacheStats{Hits: 8, Misses: 2, Errors: 1, Open: true})
+	assert.Equal(t, int64(8), s.contracts.Hits)
+
+	snapshots, err := stats.Restore(m.Snapshot())
+	assert.NoError(t, err)
+	metrics := snapshots.ToMap()
+	assert.Equal(t, int32(8), metrics["contract.hit"].Amount)
+	assert.Equal(t, int32(2), metrics["contract.miss"].Amount)
+	assert.Equal(t, int32(1), metrics["contract.error"].Amount)
+	assert.Equal(t, int32(1), metrics["contract.open"].Amount)
+}
@@ -0,0 +1,102 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/address"
+)
+
+// system publishes the live statistics of the broker on the "emitter/sys/<node>/" channels,
+// in the spirit of the $SYS topics of the other brokers. Since these channels belong to
+// the contract of the license, only the keys generated with its master key can read them.
+type system struct {
+	service  *Service             // The service to read the statistics of.
+	publish  func(string, []byte) // The publish function to use.
+	prefix   string               // The prefix of the channels of this node.
+	started  time.Time            // The time at which the broker has started.
+	last     time.Time            // The time of the previous sample.
+	received int64                // The number of messages received, at the previous sample.
+	sent     int64                // The number of messages sent, at the previous sample.
+}
+
+// newSystem creates a new publisher of the system channels.
+func newSystem(s *Service, publish func(string, []byte)) *system {
+	now := time.Now()
+	return &system{
+		service: s,
+		publish: publish,
+		prefix:  "sys/" + address.Fingerprint(s.ID()).String() + "/",
+		started: now,
+		last:    now,
+	}
+}
+
+// write samples the statistics and publishes them, one value per channel.
+func (y *system) write() {
+	now := time.Now()
+	serv := y.service
+	received := atomic.LoadInt64(&serv.received)
+	sent := atomic.LoadInt64(&serv.sent)
+
+	// Compute the message rates since the previous sample
+	elapsed := now.Sub(y.last).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	y.emit("uptime", int64(now.Sub(y.started)/time.Second))
+	y.emit("clients/connected", atomic.LoadInt64(&serv.connections))
+	y.emit("subscriptions", int64(serv.subscriptions.Count()))
+	y.emit("messages/received", received)
+	y.emit("messages/sent", sent)
+	y.emit("load/received", perSecond(received-y.received, elapsed))
+	y.emit("load/sent", perSecond(sent-y.sent, elapsed))
+	y.emit("bytes/received", atomic.LoadInt64(&serv.ingress))
+	y.emit("bytes/sent", atomic.LoadInt64(&serv.egress))
+	y.emit("memory/heap", int64(memory.HeapAlloc))
+	y.emit("memory/sys", int64(memory.Sys))
+	y.emit("goroutines", int64(runtime.NumGoroutine()))
+	y.emit("cluster/peers", int64(serv.NumPeers()))
+
+	y.last = now
+	y.received = received
+	y.sent = sent
+}
+
+// emit publishes a value on a system channel.
+func (y *system) emit(name string, value interface{}) {
+	var text string
+	switch v := value.(type) {
+	case int64:
+		text = strconv.FormatInt(v, 10)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', 2, 64)
+	}
+
+	y.publish(y.prefix+name+"/", []byte(text))
+}
+
+// perSecond returns the number of events per second.
+func perSecond(count int64, seconds float64) float64 {
+	return float64(count) / seconds
+}
@@ -0,0 +1,65 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystem_Write(t *testing.T) {
+	s := &Service{
+		subscriptions: message.NewTrie(),
+		connections:   3,
+		received:      10,
+		sent:          20,
+		ingress:       100,
+	}
+
+	published := map[string]string{}
+	sys := newSystem(s, func(channel string, payload []byte) {
+		published[channel] = string(payload)
+	})
+
+	// Pretend the first sample was taken 10 seconds ago
+	sys.last = sys.last.Add(-10 * time.Second)
+	sys.write()
+
+	assert.Len(t, published, 13)
+	for channel := range published {
+		assert.True(t, strings.HasPrefix(channel, sys.prefix))
+		assert.True(t, strings.HasSuffix(channel, "/"))
+	}
+
+	assert.Equal(t, "3", published[sys.prefix+"clients/connected/"])
+	assert.Equal(t, "10", published[sys.prefix+"messages/received/"])
+	assert.Equal(t, "1.00", published[sys.prefix+"load/received/"])
+	assert.Equal(t, "2.00", published[sys.prefix+"load/sent/"])
+	assert.Equal(t, "100", published[sys.prefix+"bytes/received/"])
+	assert.Equal(t, "0", published[sys.prefix+"cluster/peers/"])
+	assert.NotEqual(t, "0", published[sys.prefix+"memory/heap/"])
+
+	// The rates only account for the messages since the previous sample
+	s.received = 15
+	sys.last = sys.last.Add(-5 * time.Second)
+	sys.write()
+	assert.Equal(t, "15", published[sys.prefix+"messages/received/"])
+	assert.Equal(t, "1.00", published[sys.prefix+"load/received/"])
+	assert.Equal(t, "0.00", published[sys.prefix+"load/sent/"])
+}
@@ -0,0 +1,113 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+)
+
+// Takeover represents the event published on the "emitter/conn/takeover/" channel when a
+// client connects with the client ID of a client which is already connected.
+type Takeover struct {
+	ID       string `json:"id"`                 // The unique identifier of the new connection.
+	Previous string `json:"previous"`           // The unique identifier of the connection already open.
+	Client   string `json:"client"`             // The client ID of both connections.
+	Username string `json:"username,omitempty"` // The username provided on connect.
+	Remote   string `json:"remote,omitempty"`   // The remote address of the new connection.
+	Policy   string `json:"policy"`             // The policy applied, either "kick", "reject" or "allow".
+	Time     int64  `json:"time"`               // The unix time of the takeover.
+}
+
+// takeover applies the takeover policy when the client connects with the identity of a
+// connected client, and returns whether the connection is accepted. The identity is the
+// client ID along with the credentials, so that the clients of different contracts do not
+// take over each other.
+func (c *Conn) takeover(clientID, identity string) bool {
+	policy := c.service.takeover
+	if policy == "" {
+		policy = config.TakeoverAllow
+	}
+
+	c.identity = identity
+	previous := c.service.clients.Register(identity, c, policy != config.TakeoverReject)
+	if previous == nil {
+		return true
+	}
+
+	ev := Takeover{
+		ID:       c.ID(),
+		Previous: previous.ID(),
+		Client:   clientID,
+		Username: c.username,
+		Remote:   c.remoteAddr(),
+		Policy:   policy,
+		Time:     time.Now().Unix(),
+	}
+
+	c.measurer.Measure("conn.takeover."+policy, 1)
+	logging.LogDebug("conn", "client already connected, applying the "+policy+" policy", c.fields()...)
+	if payload, err := json.Marshal(ev); err == nil && c.service.pubsub != nil {
+		c.service.selfPublish("conn/takeover/", payload)
+	}
+
+	switch policy {
+	case config.TakeoverReject:
+		return false
+	case config.TakeoverKick:
+		previous.Close()
+	}
+	return true
+}
+
+// ------------------------------------------------------------------------------------
+
+// registry represents the connected clients, keyed by their identity.
+type registry struct {
+	sync.Mutex
+	conns map[string]*Conn
+}
+
+// Register registers the connection of a client and returns the connection the client
+// already had, if any. Unless the connection replaces it, the previous one stays registered.
+func (r *registry) Register(identity string, c *Conn, replace bool) *Conn {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.conns == nil {
+		r.conns = make(map[string]*Conn)
+	}
+
+	previous := r.conns[identity]
+	if previous == nil || replace {
+		r.conns[identity] = c
+	}
+	return previous
+}
+
+// Unregister removes the connection of a client, unless another connection of the client
+// replaced it already.
+func (r *registry) Unregister(identity string, c *Conn) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.conns[identity] == c {
+		delete(r.conns, identity)
+	}
+}
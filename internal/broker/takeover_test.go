@@ -0,0 +1,81 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/message"
+	netmock "github.com/emitter-io/emitter/internal/network/mock"
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/emitter-io/emitter/internal/service/session"
+	"github.com/emitter-io/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn_Takeover(t *testing.T) {
+	tests := []struct {
+		policy   string
+		code     uint8
+		previous bool // Whether the previous connection is still open.
+	}{
+		{policy: "", code: 0x00, previous: true},
+		{policy: config.TakeoverAllow, code: 0x00, previous: true},
+		{policy: config.TakeoverKick, code: 0x00, previous: false},
+		{policy: config.TakeoverReject, code: 0x02, previous: true},
+	}
+
+	for _, tc := range tests {
+		s := &Service{
+			subscriptions: message.NewTrie(),
+			measurer:      stats.NewNoop(),
+			sessions:      session.NewDurable(context.Background(), new(fake.PubSub), time.Hour, 10, 100),
+			takeover:      tc.policy,
+		}
+
+		connect := &mqtt.Connect{Version: 4, ClientID: []byte("a"), CleanSeshFlag: true}
+		previous := s.newConn(netmock.NewConn().Client, 0)
+		assert.Equal(t, uint8(0), previous.onConnect(connect))
+
+		// A client with the same client ID, but different credentials, is another client
+		other := s.newConn(netmock.NewConn().Client, 0)
+		assert.Equal(t, uint8(0), other.onConnect(&mqtt.Connect{Version: 4, ClientID: []byte("a"), Username: []byte("bob")}))
+
+		conn := s.newConn(netmock.NewConn().Client, 0)
+		assert.Equal(t, tc.code, conn.onConnect(connect), tc.policy)
+		assert.Equal(t, tc.previous, atomic.LoadUint32(&previous.closed) == 0, tc.policy)
+		assert.Equal(t, uint32(0), atomic.LoadUint32(&other.closed), tc.policy)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	var r registry
+	c1, c2 := new(Conn), new(Conn)
+
+	assert.Nil(t, r.Register("a", c1, true))
+	assert.Equal(t, c1, r.Register("a", c2, false))
+	assert.Equal(t, c1, r.Register("a", c2, true))
+
+	// Only the connection registered last is removed
+	r.Unregister("a", c1)
+	assert.Equal(t, c2, r.conns["a"])
+	r.Unregister("a", c2)
+	assert.Empty(t, r.conns)
+}
@@ -0,0 +1,55 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/network/websocket"
+)
+
+// upgraders represents the upgraders of the websocket connections of the listeners, by name.
+type upgraders map[string]*websocket.Upgrader
+
+// websocketsOf returns the upgraders of the websocket connections of the listeners.
+func websocketsOf(c *config.WebsocketConfig) (upgraders, error) {
+	listeners, err := c.PerListener()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(upgraders, len(listeners))
+	for name, v := range listeners {
+		out[name] = websocket.NewUpgrader(websocket.Options{
+			Compression:  v.Compression,
+			Level:        v.CompressionLevel,
+			Threshold:    v.CompressionThreshold,
+			Subprotocols: v.SubprotocolList(),
+			Strict:       v.Strict,
+		})
+	}
+	return out, nil
+}
+
+// upgrade attempts to upgrade an HTTP request to MQTT over websocket, with the options of
+// the listener it was received on.
+func (s *Service) upgrade(w http.ResponseWriter, r *http.Request) (net.Conn, bool) {
+	if u, ok := s.websockets[listenerOf(r)]; ok {
+		return u.TryUpgrade(w, r)
+	}
+	return websocket.TryUpgrade(w, r)
+}
@@ -0,0 +1,262 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/broker"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/service/cluster"
+	"github.com/emitter-io/emitter/internal/service/keygen"
+	"github.com/emitter-io/emitter/internal/service/presence"
+	"github.com/jawher/mow.cli"
+)
+
+var output io.Writer = os.Stdout
+
+// Register registers the administration commands, which talk to the admin API of a broker.
+func Register(cmd *cli.Cmd) {
+	cmd.Command("keygen", "Generates a key for a channel.", Keygen)
+	cmd.Command("presence", "Prints the subscribers present on a channel.", Presence)
+	cmd.Command("connections", "Prints the clients connected to the broker.", Connections)
+	cmd.Command("kick", "Disconnects a client from the broker.", Kick)
+	cmd.Command("drain", "Drains the broker, asking its clients to reconnect elsewhere.", Drain)
+	cmd.Command("cluster", "Prints the peers of the broker in the cluster.", Cluster)
+}
+
+// client represents a client of the admin API of a broker.
+type client struct {
+	url string // The address of the broker.
+	key string // The master key of the license of the broker.
+}
+
+// options registers the options shared by the commands, which are the address of the broker
+// and the master key.
+func options(cmd *cli.Cmd) (addr, key *string) {
+	key = cmd.StringOpt("k key", "", "Specifies the master key of the license of the broker.")
+	addr = cmd.StringOpt("u url", "http://127.0.0.1:8080", "Specifies the address of the broker.")
+	return
+}
+
+// call issues a request on the admin API and decodes the response, if any is expected.
+func (c *client) call(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.url, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.key)
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("the broker responded with %s", resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ------------------------------------------------------------------------------------
+
+// Keygen generates a key for a channel and prints it.
+func Keygen(cmd *cli.Cmd) {
+	cmd.Spec = "-k=<key> [ -u=<url> ] -c=<channel> [ -t=<type> ] [ --ttl=<seconds> ]"
+	var (
+		addr, key = options(cmd)
+		channel   = cmd.StringOpt("c channel", "", "Specifies the channel to generate the key for.")
+		access    = cmd.StringOpt("t type", "rwls", "Specifies the permissions of the key (r, w, s, l, p, e, x).")
+		ttl       = cmd.IntOpt("ttl", 0, "Specifies the number of seconds the key is valid for, or 0 for no expiry.")
+	)
+	cmd.Action = func() {
+		var resp keygen.Response
+		if err := (&client{*addr, *key}).call("POST", "/admin/keygen", &keygen.Request{
+			Key:     *key,
+			Channel: *channel,
+			Type:    *access,
+			TTL:     int32(*ttl),
+		}, &resp); err != nil {
+			logging.LogError("admin", "generating a key", err)
+			return
+		}
+
+		fmt.Fprintf(output, "channel: %s\nkey    : %s\n", resp.Channel, resp.Key)
+	}
+}
+
+// Presence prints the subscribers present on a channel.
+func Presence(cmd *cli.Cmd) {
+	cmd.Spec = "-k=<key> [ -u=<url> ] -c=<channel> [ -s ]"
+	var (
+		addr    = cmd.StringOpt("u url", "http://127.0.0.1:8080", "Specifies the address of the broker.")
+		key     = cmd.StringOpt("k key", "", "Specifies a key of the channel with the presence permission.")
+		channel = cmd.StringOpt("c channel", "", "Specifies the channel.")
+		strong  = cmd.BoolOpt("s strong", false, "Queries every node live and fails unless all of them respond.")
+	)
+	cmd.Action = func() {
+		consistency := presence.ConsistencyEventual
+		if *strong {
+			consistency = presence.ConsistencyStrong
+		}
+
+		var resp presence.Response
+		if err := (&client{*addr, ""}).call("POST", "/presence", &presence.Request{
+			Key:         *key,
+			Channel:     *channel,
+			Consistency: consistency,
+		}, &resp); err != nil {
+			logging.LogError("admin", "querying the presence", err)
+			return
+		}
+
+		w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ID\tUSERNAME\n")
+		for _, who := range resp.Who {
+			fmt.Fprintf(w, "%s\t%s\n", who.ID, who.Username)
+		}
+		w.Flush()
+	}
+}
+
+// Connections prints the clients connected to the broker.
+func Connections(cmd *cli.Cmd) {
+	cmd.Spec = "-k=<key> [ -u=<url> ] [ -n=<contract> ]"
+	var (
+		addr, key = options(cmd)
+		contract  = cmd.IntOpt("n contract", 0, "Specifies the contract of the clients, or 0 for all of them.")
+	)
+	cmd.Action = func() {
+		query := url.Values{}
+		if *contract > 0 {
+			query.Set("contract", strconv.Itoa(*contract))
+		}
+
+		var clients []broker.ClientInfo
+		if err := (&client{*addr, *key}).call("GET", "/admin/connections?"+query.Encode(), nil, &clients); err != nil {
+			logging.LogError("admin", "listing the connections", err)
+			return
+		}
+
+		w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ID\tCONTRACT\tUSERNAME\tREMOTE\tCONNECTED\tCHANNELS\n")
+		for _, c := range clients {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n",
+				c.ID,
+				c.Contract,
+				c.Username,
+				c.Remote,
+				time.Unix(c.Connected, 0).UTC().Format(time.RFC3339),
+				strings.Join(c.Channels, " "),
+			)
+		}
+		w.Flush()
+	}
+}
+
+// Kick disconnects a client from the broker.
+func Kick(cmd *cli.Cmd) {
+	cmd.Spec = "-k=<key> [ -u=<url> ] -i=<id>"
+	var (
+		addr, key = options(cmd)
+		id        = cmd.StringOpt("i id", "", "Specifies the identifier of the connection.")
+	)
+	cmd.Action = func() {
+		if err := (&client{*addr, *key}).call("DELETE", "/admin/connections?id="+url.QueryEscape(*id), nil, nil); err != nil {
+			logging.LogError("admin", "disconnecting the client", err)
+			return
+		}
+
+		fmt.Fprintf(output, "disconnected %s\n", *id)
+	}
+}
+
+// Drain drains the broker, asking its clients to reconnect elsewhere.
+func Drain(cmd *cli.Cmd) {
+	cmd.Spec = "-k=<key> [ -u=<url> ] [ -r=<redirect> ] [ -t=<timeout> ]"
+	var (
+		addr, key = options(cmd)
+		redirect  = cmd.StringOpt("r redirect", "", "Specifies the address of the server the clients should reconnect to.")
+		timeout   = cmd.IntOpt("t timeout", 30, "Specifies the number of seconds given to the clients to leave.")
+	)
+	cmd.Action = func() {
+		query := url.Values{}
+		query.Set("timeout", strconv.Itoa(*timeout))
+		if *redirect != "" {
+			query.Set("redirect", *redirect)
+		}
+
+		if err := (&client{*addr, *key}).call("POST", "/admin/drain?"+query.Encode(), nil, nil); err != nil {
+			logging.LogError("admin", "draining the broker", err)
+			return
+		}
+
+		fmt.Fprintf(output, "draining, the clients are given %ds to leave\n", *timeout)
+	}
+}
+
+// Cluster prints the peers of the broker in the cluster, along with their health.
+func Cluster(cmd *cli.Cmd) {
+	cmd.Spec = "-k=<key> [ -u=<url> ]"
+	addr, key := options(cmd)
+	cmd.Action = func() {
+		var topology cluster.Topology
+		if err := (&client{*addr, *key}).call("GET", "/admin/cluster", nil, &topology); err != nil {
+			logging.LogError("admin", "fetching the cluster topology", err)
+			return
+		}
+
+		fmt.Fprintf(output, "node %s, %d events in the state\n", topology.Node, topology.State)
+		w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "PEER\tADDRESS\tSTATE\tCONNECTIONS\tSUBSCRIPTIONS\tLAST SEEN\tSENT/S\tRECEIVED/S\n")
+		for _, p := range topology.Peers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%.1f\t%.1f\n",
+				p.Name,
+				p.Addr,
+				p.State,
+				p.Connections,
+				p.Subscriptions,
+				time.Unix(p.LastSeen, 0).UTC().Format(time.RFC3339),
+				p.SentRate,
+				p.ReceivedRate,
+			)
+		}
+		w.Flush()
+	}
+}
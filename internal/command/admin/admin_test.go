@@ -0,0 +1,121 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/broker"
+	"github.com/emitter-io/emitter/internal/service/cluster"
+	"github.com/emitter-io/emitter/internal/service/keygen"
+	"github.com/emitter-io/emitter/internal/service/presence"
+	"github.com/jawher/mow.cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBroker(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	authorized := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			handler(w, r)
+		}
+	}
+
+	mux.HandleFunc("/admin/keygen", authorized(func(w http.ResponseWriter, r *http.Request) {
+		var req keygen.Request
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "rw", req.Type)
+		json.NewEncoder(w).Encode(&keygen.Response{Status: 200, Key: "generated", Channel: req.Channel})
+	}))
+	mux.HandleFunc("/presence", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&presence.Response{Who: []presence.Info{{ID: "client-1", Username: "alice"}}})
+	})
+	mux.HandleFunc("/admin/connections", authorized(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			assert.Equal(t, "2", r.URL.Query().Get("contract"))
+			json.NewEncoder(w).Encode([]broker.ClientInfo{{ID: "conn-1", Contract: 2, Channels: []string{"a/", "b/"}}})
+		case "DELETE":
+			assert.Equal(t, "conn-1", r.URL.Query().Get("id"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	mux.HandleFunc("/admin/drain", authorized(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "5", r.URL.Query().Get("timeout"))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	mux.HandleFunc("/admin/cluster", authorized(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&cluster.Topology{Node: "node-a", Peers: []cluster.PeerInfo{{Name: "node-b", State: "alive"}}})
+	}))
+	return httptest.NewServer(mux)
+}
+
+func TestCommands(t *testing.T) {
+	server := newTestBroker(t)
+	defer server.Close()
+
+	tests := []struct {
+		command  func(*cli.Cmd)
+		args     []string
+		contains []string
+	}{
+		{command: Keygen, args: []string{"-c", "a/b/", "-t", "rw"}, contains: []string{"generated", "a/b/"}},
+		{command: Presence, args: []string{"-c", "a/b/"}, contains: []string{"client-1", "alice"}},
+		{command: Connections, args: []string{"-n", "2"}, contains: []string{"conn-1", "a/ b/"}},
+		{command: Kick, args: []string{"-i", "conn-1"}, contains: []string{"disconnected conn-1"}},
+		{command: Drain, args: []string{"-t", "5"}, contains: []string{"5s"}},
+		{command: Cluster, contains: []string{"node-a", "node-b", "alive"}},
+	}
+
+	for _, tc := range tests {
+		var buffer bytes.Buffer
+		output = &buffer
+		assert.NotPanics(t, func() {
+			runCommand(tc.command, append([]string{"-k", "secret", "-u", server.URL}, tc.args...)...)
+		})
+
+		for _, v := range tc.contains {
+			assert.Contains(t, buffer.String(), v)
+		}
+	}
+}
+
+func TestCommands_Unauthorized(t *testing.T) {
+	server := newTestBroker(t)
+	defer server.Close()
+
+	var buffer bytes.Buffer
+	output = &buffer
+	assert.NotPanics(t, func() {
+		runCommand(Cluster, "-k", "wrong", "-u", server.URL)
+	})
+	assert.Empty(t, buffer.String())
+}
+
+func runCommand(f func(cmd *cli.Cmd), args ...string) {
+	app := cli.App("emitter", "")
+	app.Command("test", "", f)
+	v := []string{"emitter", "test"}
+	v = append(v, args...)
+	app.Run(v)
+}
@@ -0,0 +1,110 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/jawher/mow.cli"
+)
+
+var output io.Writer = os.Stdout
+
+// Record represents an archived message, as printed by the query.
+type Record struct {
+	Channel string `json:"channel"` // The channel of the message.
+	Time    int64  `json:"time"`    // The unix time of the message.
+	Payload string `json:"payload"` // The payload of the message.
+}
+
+// Query queries the messages archived into an object storage and prints them, one JSON
+// record per line.
+func Query(cmd *cli.Cmd) {
+	cmd.Spec = "-b=<bucket> [ --prefix=<prefix> ] [ --region=<region> ] [ --endpoint=<endpoint> ] [ -c=<channel> ] [ --from=<time> ] [ --until=<time> ] CONTRACT"
+	var (
+		contract = cmd.IntArg("CONTRACT", 0, "Specifies the contract of the messages.")
+		bucket   = cmd.StringOpt("b bucket", "", "Specifies the bucket the messages are archived to.")
+		prefix   = cmd.StringOpt("prefix", "", "Specifies the prefix of the archived segments.")
+		region   = cmd.StringOpt("region", "", "Specifies the region of the bucket.")
+		endpoint = cmd.StringOpt("endpoint", "", "Specifies the endpoint of the object storage, if not AWS S3.")
+		channel  = cmd.StringOpt("c channel", "", "Specifies the channel of the messages, including its sub-channels.")
+		from     = cmd.StringOpt("from", "", "Specifies the beginning of the time window (RFC3339), by default a day ago.")
+		until    = cmd.StringOpt("until", "", "Specifies the end of the time window (RFC3339), by default now.")
+	)
+	cmd.Action = func() {
+		t0, t1, err := parseWindow(*from, *until, time.Now())
+		if err != nil {
+			logging.LogError("archive", "parsing the time window", err)
+			return
+		}
+
+		objects, err := storage.NewS3(*bucket, *region, *endpoint)
+		if err != nil {
+			logging.LogError("archive", "connecting to the object storage", err)
+			return
+		}
+
+		if err := run(objects, *prefix, uint32(*contract), *channel, t0, t1); err != nil {
+			logging.LogError("archive", "reading the archive", err)
+		}
+	}
+}
+
+// run reads the archive and prints the messages of the channel.
+func run(objects storage.ObjectStore, prefix string, contract uint32, channel string, from, until time.Time) error {
+	if channel != "" && !strings.HasSuffix(channel, "/") {
+		channel += "/"
+	}
+
+	encoder := json.NewEncoder(output)
+	return storage.ReadArchive(objects, prefix, contract, from, until, func(m *message.Message) {
+		if strings.HasPrefix(string(m.Channel), channel) {
+			encoder.Encode(&Record{
+				Channel: string(m.Channel),
+				Time:    m.Time(),
+				Payload: string(m.Payload),
+			})
+		}
+	})
+}
+
+// parseWindow parses the time window, which defaults to the last day.
+func parseWindow(from, until string, now time.Time) (t0, t1 time.Time, err error) {
+	t0, t1 = now.Add(-24*time.Hour), now
+	if from != "" {
+		if t0, err = time.Parse(time.RFC3339, from); err != nil {
+			return
+		}
+	}
+
+	if until != "" {
+		if t1, err = time.Parse(time.RFC3339, until); err != nil {
+			return
+		}
+	}
+
+	if t1.Before(t0) {
+		err = fmt.Errorf("the end of the window %v is before its beginning %v", t1, t0)
+	}
+	return
+}
@@ -0,0 +1,94 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/jawher/mow.cli"
+	"github.com/stretchr/testify/assert"
+)
+
+// objects represents an in-memory object storage.
+type objects map[string][]byte
+
+func (o objects) Put(key string, data []byte) error { o[key] = data; return nil }
+func (o objects) Get(key string) ([]byte, error)    { return o[key], nil }
+func (o objects) List(prefix string) ([]string, error) {
+	var keys []string
+	for key := range o {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func TestQuery(t *testing.T) {
+	assert.NotPanics(t, func() {
+		runCommand(Query, "-b", "bucket", "--from", "invalid", "1")
+	})
+}
+
+func TestRun(t *testing.T) {
+	now := time.Now()
+	frame := message.Frame{
+		*message.New(message.Ssid{1, 2}, []byte("a/b/"), []byte("1")),
+		*message.New(message.Ssid{1, 3}, []byte("c/"), []byte("2")),
+	}
+
+	out := new(bytes.Buffer)
+	output = out
+	archive := objects{"x/1/" + now.UTC().Format("2006/01/02") + "/1-a.frame": frame.Encode()}
+	assert.NoError(t, run(archive, "x", 1, "a", now.Add(-time.Hour), now.Add(time.Hour)))
+	assert.Equal(t, fmt.Sprintf(`{"channel":"a/b/","time":%d,"payload":"1"}`+"\n", frame[0].Time()), out.String())
+}
+
+func TestParseWindow(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		from, until string
+		t0, t1      time.Time
+		err         bool
+	}{
+		{t0: now.Add(-24 * time.Hour), t1: now},
+		{from: "2020-04-01T00:00:00Z", t0: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), t1: now},
+		{from: "2020-04-01T00:00:00Z", until: "2020-03-01T00:00:00Z", err: true},
+		{from: "yesterday", err: true},
+		{until: "tomorrow", err: true},
+	}
+
+	for _, tc := range tests {
+		t0, t1, err := parseWindow(tc.from, tc.until, now)
+		assert.Equal(t, tc.err, err != nil)
+		if !tc.err {
+			assert.Equal(t, tc.t0, t0)
+			assert.Equal(t, tc.t1, t1)
+		}
+	}
+}
+
+func runCommand(f func(cmd *cli.Cmd), args ...string) {
+	app := cli.App("emitter", "")
+	app.Command("test", "", f)
+	v := []string{"emitter", "test"}
+	v = append(v, args...)
+	app.Run(v)
+}
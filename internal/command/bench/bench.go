@@ -0,0 +1,412 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/jawher/mow.cli"
+)
+
+const (
+	minPayloadSize = 8                     // The size of the timestamp carried by each payload.
+	maxPayloadSize = 64000                 // The maximum size of a payload.
+	pacingSlack    = time.Millisecond      // How far ahead of its schedule a publisher may run.
+	drainTimeout   = 2 * time.Second       // How long to wait for the deliveries once they stop.
+	drainInterval  = 10 * time.Millisecond // How often the deliveries are checked while draining.
+	reportInterval = time.Second           // How often the progress is logged.
+)
+
+var output io.Writer = os.Stdout
+
+// Run runs the benchmark command.
+func Run(cmd *cli.Cmd) {
+	cmd.Spec = "KEY [ -h=<host> ] [ -c=<channel> ] [ -p=<publishers> ] [ -s=<subscribers> ] [ -n=<channels> ] [ -r=<rate> ] [ -z=<size> ] [ -d=<duration> ] [ -j ]"
+	var (
+		key         = cmd.StringArg("KEY", "", "Specifies the key for the channel, which must allow to read and write its sub-channels.")
+		host        = cmd.StringOpt("h host", "127.0.0.1:8080", "Specifies the broker host name and port. This must follow the <ip:port> format.")
+		channel     = cmd.StringOpt("c channel", "bench/", "Specifies the channel under which the benchmark publishes.")
+		publishers  = cmd.IntOpt("p publishers", 1, "Specifies the number of publishing connections.")
+		subscribers = cmd.IntOpt("s subscribers", 1, "Specifies the number of subscribing connections.")
+		channels    = cmd.IntOpt("n channels", 1, "Specifies the number of channels the subscribers are spread over, one channel gives the highest fan-out.")
+		rate        = cmd.IntOpt("r rate", 1000, "Specifies the number of messages published per second by each publisher, or 0 to publish as fast as possible.")
+		size        = cmd.IntOpt("z size", 64, "Specifies the size of the messages in bytes, at least 8 for the timestamp they carry.")
+		duration    = cmd.StringOpt("d duration", "10s", "Specifies how long to publish for, e.g: 30s or 5m.")
+		asJSON      = cmd.BoolOpt("j json", false, "Prints the report as JSON.")
+	)
+	cmd.Action = func() {
+		period, err := time.ParseDuration(*duration)
+		if err != nil {
+			logging.LogError("bench", "parsing the duration", err)
+			return
+		}
+
+		b, err := newBench(options{
+			host:        *host,
+			key:         *key,
+			channel:     *channel,
+			publishers:  *publishers,
+			subscribers: *subscribers,
+			channels:    *channels,
+			rate:        *rate,
+			size:        *size,
+			duration:    period,
+		})
+		if err != nil {
+			logging.LogError("bench", "validating the options", err)
+			return
+		}
+
+		r, err := b.Run()
+		if err != nil {
+			logging.LogError("bench", "running the benchmark", err)
+			return
+		}
+
+		if *asJSON {
+			json.NewEncoder(output).Encode(r)
+			return
+		}
+		print(r)
+	}
+}
+
+// ------------------------------------------------------------------------------------
+
+// options represents the options of a benchmark.
+type options struct {
+	host        string        // The address of the broker.
+	key         string        // The key of the channel.
+	channel     string        // The channel under which the benchmark publishes.
+	publishers  int           // The number of publishing connections.
+	subscribers int           // The number of subscribing connections.
+	channels    int           // The number of channels the subscribers are spread over.
+	rate        int           // The number of messages per second of each publisher.
+	size        int           // The size of the messages.
+	duration    time.Duration // How long to publish for.
+}
+
+// bench represents a benchmark. The subscriber of index i subscribes to the channel of
+// index i modulo the number of channels, and each publisher goes through all of them in
+// turn, so the number of channels shapes the fan-out of the messages.
+type bench struct {
+	options
+	topics    [][]byte // The topics of the channels, prefixed by the key.
+	fanout    []uint64 // The number of subscribers of each channel.
+	conns     []*conn  // The connections opened.
+	readers   sync.WaitGroup
+	published uint64 // The number of messages published.
+	expected  uint64 // The number of deliveries expected.
+	received  uint64 // The number of deliveries received.
+	errors    uint64 // The number of errors sent by the broker.
+}
+
+// newBench creates a new benchmark.
+func newBench(o options) (*bench, error) {
+	switch {
+	case o.publishers < 1:
+		return nil, errors.New("at least one publisher is required")
+	case o.subscribers < 0:
+		return nil, errors.New("the number of subscribers cannot be negative")
+	case o.channels < 1:
+		return nil, errors.New("at least one channel is required")
+	case o.rate < 0:
+		return nil, errors.New("the rate cannot be negative")
+	case o.size < minPayloadSize || o.size > maxPayloadSize:
+		return nil, fmt.Errorf("the size must be between %d and %d bytes", minPayloadSize, maxPayloadSize)
+	case o.duration <= 0:
+		return nil, errors.New("the duration must be positive")
+	}
+
+	b := &bench{
+		options: o,
+		topics:  make([][]byte, o.channels),
+		fanout:  make([]uint64, o.channels),
+	}
+
+	prefix := strings.Trim(o.channel, "/")
+	for i := range b.topics {
+		b.topics[i] = []byte(fmt.Sprintf("%s/%s/%d/", o.key, prefix, i))
+	}
+	for i := 0; i < o.subscribers; i++ {
+		b.fanout[i%o.channels]++
+	}
+	return b, nil
+}
+
+// Run connects the subscribers, then the publishers, publishes for the duration of the
+// benchmark and waits for the deliveries before reporting.
+func (b *bench) Run() (*report, error) {
+	defer b.close()
+
+	logging.LogTarget("bench", "connecting the subscribers", b.subscribers)
+	subscribers := make([]*conn, 0, b.subscribers)
+	for i := 0; i < b.subscribers; i++ {
+		c, err := b.connect(fmt.Sprintf("bench-sub-%d", i))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.Subscribe(b.topics[i%b.channels]); err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, c)
+	}
+
+	logging.LogTarget("bench", "connecting the publishers", b.publishers)
+	publishers := make([]*conn, 0, b.publishers)
+	for i := 0; i < b.publishers; i++ {
+		c, err := b.connect(fmt.Sprintf("bench-pub-%d", i))
+		if err != nil {
+			return nil, err
+		}
+		publishers = append(publishers, c)
+	}
+
+	// Start reading once everyone is connected, since the replies to the connection and
+	// subscription requests are read synchronously
+	for _, c := range b.conns {
+		b.readers.Add(1)
+		go func(c *conn) {
+			defer b.readers.Done()
+			c.Receive(b.onReceive, b.onError)
+		}(c)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	async.Repeat(ctx, reportInterval, func() {
+		logging.LogAction("bench", fmt.Sprintf("published %d messages, received %d of %d",
+			atomic.LoadUint64(&b.published), atomic.LoadUint64(&b.received), atomic.LoadUint64(&b.expected)))
+	})
+	defer cancel()
+
+	logging.LogTarget("bench", "publishing for", b.duration)
+	start := time.Now()
+	errs := make(chan error, len(publishers))
+	for i, c := range publishers {
+		go func(i int, c *conn) {
+			errs <- b.publish(i, c, start)
+		}(i, c)
+	}
+
+	var err error
+	for range publishers {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+
+	elapsed := time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+
+	b.drain()
+	b.close()
+	return b.report(elapsed), nil
+}
+
+// connect opens a new connection to the broker.
+func (b *bench) connect(clientID string) (*conn, error) {
+	c, err := newConn(b.host, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	b.conns = append(b.conns, c)
+	return c, nil
+}
+
+// publish publishes messages until the end of the benchmark, at the configured rate. If
+// the publisher falls behind its schedule, the latency of its messages is measured from
+// the time they were due, so a saturated broker is not hidden by a slower publisher.
+func (b *bench) publish(index int, c *conn, start time.Time) error {
+	msg := &mqtt.Publish{
+		Payload: make([]byte, b.size),
+	}
+
+	var interval time.Duration
+	if b.rate > 0 {
+		interval = time.Second / time.Duration(b.rate)
+	}
+
+	end := start.Add(b.duration)
+	for i := 0; ; i++ {
+		now := time.Now()
+		if !now.Before(end) {
+			return nil
+		}
+
+		stamp := now
+		if interval > 0 {
+			due := start.Add(time.Duration(i) * interval)
+			switch ahead := due.Sub(now); {
+			case ahead > pacingSlack:
+				time.Sleep(ahead)
+				stamp = time.Now()
+			case ahead < 0:
+				stamp = due
+			}
+		}
+
+		channel := (index + i) % b.channels
+		msg.Topic = b.topics[channel]
+		if err := c.Publish(msg, stamp); err != nil {
+			return err
+		}
+
+		atomic.AddUint64(&b.published, 1)
+		atomic.AddUint64(&b.expected, b.fanout[channel])
+	}
+}
+
+// drain waits until every delivery is received, or until they stop arriving.
+func (b *bench) drain() {
+	last, idle := atomic.LoadUint64(&b.received), time.Duration(0)
+	for idle < drainTimeout {
+		received := atomic.LoadUint64(&b.received)
+		if received >= atomic.LoadUint64(&b.expected) {
+			return
+		}
+
+		if received != last {
+			last, idle = received, 0
+		}
+
+		time.Sleep(drainInterval)
+		idle += drainInterval
+	}
+}
+
+// close closes the connections and waits for their readers to stop.
+func (b *bench) close() {
+	for _, c := range b.conns {
+		c.Close()
+	}
+	b.readers.Wait()
+}
+
+// onReceive occurs when a message is received.
+func (b *bench) onReceive() {
+	atomic.AddUint64(&b.received, 1)
+}
+
+// onError occurs when the broker sends an error. Only the first one is logged, since the
+// same error is usually sent for each message.
+func (b *bench) onError(msg *mqtt.Publish) {
+	if atomic.AddUint64(&b.errors, 1) == 1 {
+		logging.LogTarget("bench", "received an error", string(msg.Payload))
+	}
+}
+
+// report computes the report of the benchmark, once the connections are closed.
+func (b *bench) report(elapsed time.Duration) *report {
+	var latency histogram
+	for _, c := range b.conns {
+		latency.Merge(&c.latency)
+	}
+
+	r := &report{
+		Publishers:  b.publishers,
+		Subscribers: b.subscribers,
+		Channels:    b.channels,
+		Size:        b.size,
+		Rate:        b.rate,
+		Duration:    elapsed.Seconds(),
+		Published:   b.published,
+		Expected:    b.expected,
+		Received:    b.received,
+		Errors:      b.errors,
+		Latency: latencyReport{
+			Mean: latency.Mean().Microseconds(),
+			P50:  latency.Percentile(50).Microseconds(),
+			P90:  latency.Percentile(90).Microseconds(),
+			P99:  latency.Percentile(99).Microseconds(),
+			P999: latency.Percentile(99.9).Microseconds(),
+			Max:  latency.Max().Microseconds(),
+		},
+	}
+
+	if r.Received < r.Expected {
+		r.Lost = r.Expected - r.Received
+	}
+	if elapsed > 0 {
+		r.PublishRate = float64(r.Published) / elapsed.Seconds()
+		r.ReceiveRate = float64(r.Received) / elapsed.Seconds()
+	}
+	return r
+}
+
+// ------------------------------------------------------------------------------------
+
+// report represents the outcome of a benchmark.
+type report struct {
+	Publishers  int           `json:"publishers"`  // The number of publishing connections.
+	Subscribers int           `json:"subscribers"` // The number of subscribing connections.
+	Channels    int           `json:"channels"`    // The number of channels.
+	Size        int           `json:"size"`        // The size of the messages in bytes.
+	Rate        int           `json:"rate"`        // The target rate of each publisher.
+	Duration    float64       `json:"duration"`    // How long the publishers ran for, in seconds.
+	Published   uint64        `json:"published"`   // The number of messages published.
+	Expected    uint64        `json:"expected"`    // The number of deliveries expected.
+	Received    uint64        `json:"received"`    // The number of deliveries received.
+	Lost        uint64        `json:"lost"`        // The number of deliveries not received.
+	Errors      uint64        `json:"errors"`      // The number of errors sent by the broker.
+	PublishRate float64       `json:"publishRate"` // The number of messages published per second.
+	ReceiveRate float64       `json:"receiveRate"` // The number of deliveries received per second.
+	Latency     latencyReport `json:"latency"`     // The latency of the deliveries.
+}
+
+// latencyReport represents the latency of the deliveries, in microseconds.
+type latencyReport struct {
+	Mean int64 `json:"mean"`
+	P50  int64 `json:"p50"`
+	P90  int64 `json:"p90"`
+	P99  int64 `json:"p99"`
+	P999 int64 `json:"p999"`
+	Max  int64 `json:"max"`
+}
+
+// print prints the report as a table.
+func print(r *report) {
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "SHAPE\t%d publishers, %d subscribers, %d channels, %d bytes\n", r.Publishers, r.Subscribers, r.Channels, r.Size)
+	fmt.Fprintf(w, "DURATION\t%.1fs\n", r.Duration)
+	fmt.Fprintf(w, "PUBLISHED\t%d (%.1f/s)\n", r.Published, r.PublishRate)
+	fmt.Fprintf(w, "RECEIVED\t%d of %d (%.1f/s), %d lost\n", r.Received, r.Expected, r.ReceiveRate, r.Lost)
+	fmt.Fprintf(w, "ERRORS\t%d\n", r.Errors)
+	fmt.Fprintf(w, "LATENCY\tmean %s, p50 %s, p90 %s, p99 %s, p99.9 %s, max %s\n",
+		micros(r.Latency.Mean), micros(r.Latency.P50), micros(r.Latency.P90),
+		micros(r.Latency.P99), micros(r.Latency.P999), micros(r.Latency.Max))
+	w.Flush()
+}
+
+// micros formats a number of microseconds as a duration.
+func micros(v int64) string {
+	return (time.Duration(v) * time.Microsecond).String()
+}
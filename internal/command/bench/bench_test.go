@@ -0,0 +1,165 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/jawher/mow.cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	broker := newFakeBroker()
+	dial = broker.dial
+
+	var buffer bytes.Buffer
+	output = &buffer
+	assert.NotPanics(t, func() {
+		runCommand("emitter", "test", "key", "-p", "2", "-s", "3", "-n", "2", "-r", "500", "-d", "100ms", "-j")
+	})
+
+	var r report
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &r))
+	assert.Equal(t, 2, r.Publishers)
+	assert.Equal(t, 3, r.Subscribers)
+	assert.NotZero(t, r.Published)
+	assert.True(t, r.Expected > r.Published)
+	assert.Equal(t, r.Expected, r.Received)
+	assert.Zero(t, r.Lost)
+	assert.True(t, r.Latency.Max >= r.Latency.P50)
+	assert.Equal(t, []string{"key/bench/0/", "key/bench/1/", "key/bench/0/"}, broker.subscribed)
+}
+
+func TestRun_Table(t *testing.T) {
+	dial = newFakeBroker().dial
+
+	var buffer bytes.Buffer
+	output = &buffer
+	assert.NotPanics(t, func() {
+		runCommand("emitter", "test", "key", "-r", "0", "-d", "50ms")
+	})
+
+	assert.Contains(t, buffer.String(), "1 publishers, 1 subscribers, 1 channels, 64 bytes")
+	assert.Contains(t, buffer.String(), "LATENCY")
+}
+
+func TestRun_Error(t *testing.T) {
+	dial = func(string, string) (net.Conn, error) {
+		return nil, io.EOF
+	}
+
+	var buffer bytes.Buffer
+	output = &buffer
+	assert.NotPanics(t, func() {
+		runCommand("emitter", "test", "key", "-d", "50ms")
+		runCommand("emitter", "test", "key", "-d", "invalid")
+		runCommand("emitter", "test", "key", "-z", "1")
+	})
+	assert.Empty(t, buffer.String())
+}
+
+func TestNewBench(t *testing.T) {
+	valid := options{key: "key", channel: "/a/b/", publishers: 1, subscribers: 5, channels: 2, rate: 10, size: 8, duration: 1}
+	b, err := newBench(valid)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{3, 2}, b.fanout)
+	assert.Equal(t, "key/a/b/1/", string(b.topics[1]))
+
+	for _, f := range []func(*options){
+		func(o *options) { o.publishers = 0 },
+		func(o *options) { o.subscribers = -1 },
+		func(o *options) { o.channels = 0 },
+		func(o *options) { o.rate = -1 },
+		func(o *options) { o.size = 7 },
+		func(o *options) { o.size = maxPayloadSize + 1 },
+		func(o *options) { o.duration = 0 },
+	} {
+		o := valid
+		f(&o)
+		_, err := newBench(o)
+		assert.Error(t, err)
+	}
+}
+
+func TestOnError(t *testing.T) {
+	b := new(bench)
+	b.onError(&mqtt.Publish{Payload: []byte("unauthorized")})
+	b.onError(&mqtt.Publish{Payload: []byte("unauthorized")})
+	assert.Equal(t, uint64(2), b.errors)
+}
+
+func runCommand(args ...string) {
+	app := cli.App("emitter", "")
+	app.Command("test", "", Run)
+	app.Run(args)
+}
+
+// ------------------------------------------------------------------------------------
+
+// fakeBroker represents an in-memory broker which delivers the messages to the
+// connections subscribed to their exact topic.
+type fakeBroker struct {
+	sync.Mutex
+	subs       map[string][]net.Conn
+	subscribed []string
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		subs: make(map[string][]net.Conn),
+	}
+}
+
+func (f *fakeBroker) dial(string, string) (net.Conn, error) {
+	client, server := net.Pipe()
+	go f.serve(server)
+	return client, nil
+}
+
+func (f *fakeBroker) serve(c net.Conn) {
+	reader := bufio.NewReader(c)
+	for {
+		pkt, err := mqtt.DecodePacket(reader, maxPacketSize)
+		if err != nil {
+			return
+		}
+
+		switch p := pkt.(type) {
+		case *mqtt.Connect:
+			(&mqtt.Connack{}).EncodeTo(c)
+		case *mqtt.Subscribe:
+			f.Lock()
+			topic := string(p.Subscriptions[0].Topic)
+			f.subs[topic] = append(f.subs[topic], c)
+			f.subscribed = append(f.subscribed, topic)
+			f.Unlock()
+			(&mqtt.Suback{}).EncodeTo(c)
+		case *mqtt.Publish:
+			f.Lock()
+			for _, sub := range f.subs[string(p.Topic)] {
+				p.EncodeTo(sub)
+			}
+			f.Unlock()
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+)
+
+const maxPacketSize = 65536 // The maximum size of the packets read from the broker.
+
+var dial = net.Dial
+
+// conn represents a connection to the broker, either of a publisher or of a subscriber.
+type conn struct {
+	net.Conn
+	reader  *bufio.Reader // The buffered reader of the connection.
+	latency histogram     // The latencies of the messages received.
+}
+
+// newConn opens a new connection to the broker and waits for it to be acknowledged.
+func newConn(host, clientID string) (*conn, error) {
+	socket, err := dial("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{
+		Conn:   socket,
+		reader: bufio.NewReader(socket),
+	}
+
+	connect := mqtt.Connect{ClientID: []byte(clientID)}
+	if _, err := connect.EncodeTo(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	pkt, err := c.expect(mqtt.TypeOfConnack)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	if code := pkt.(*mqtt.Connack).ReturnCode; code != 0 {
+		c.Close()
+		return nil, fmt.Errorf("the broker refused the connection with code %d", code)
+	}
+	return c, nil
+}
+
+// Subscribe subscribes to a topic and waits for the subscription to be acknowledged.
+func (c *conn) Subscribe(topic []byte) error {
+	sub := mqtt.Subscribe{
+		Subscriptions: []mqtt.TopicQOSTuple{
+			{Topic: topic, Qos: 0},
+		},
+	}
+
+	if _, err := sub.EncodeTo(c); err != nil {
+		return err
+	}
+
+	_, err := c.expect(mqtt.TypeOfSuback)
+	return err
+}
+
+// Publish publishes a message, stamped with the time it was sent at.
+func (c *conn) Publish(msg *mqtt.Publish, stamp time.Time) error {
+	binary.BigEndian.PutUint64(msg.Payload, uint64(stamp.UnixNano()))
+	_, err := msg.EncodeTo(c)
+	return err
+}
+
+// Receive reads the messages until the connection is closed, recording their latency.
+// The messages published by the broker itself, such as the errors, are passed to the
+// handler instead.
+func (c *conn) Receive(onReceive func(), onError func(*mqtt.Publish)) {
+	for {
+		pkt, err := mqtt.DecodePacket(c.reader, maxPacketSize)
+		if err != nil {
+			return
+		}
+
+		msg, ok := pkt.(*mqtt.Publish)
+		switch {
+		case !ok:
+			continue
+		case bytes.HasPrefix(msg.Topic, []byte("emitter/")):
+			onError(msg)
+		case len(msg.Payload) >= 8:
+			sent := int64(binary.BigEndian.Uint64(msg.Payload))
+			c.latency.Record(time.Duration(time.Now().UnixNano() - sent))
+			onReceive()
+		}
+	}
+}
+
+// expect reads the next packet and returns an error if it is not of the expected type.
+func (c *conn) expect(mqttType uint8) (mqtt.Message, error) {
+	pkt, err := mqtt.DecodePacket(c.reader, maxPacketSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if pkt.Type() != mqttType {
+		return nil, fmt.Errorf("mqtt type is %v instead of %v", pkt.Type(), mqttType)
+	}
+	return pkt, nil
+}
@@ -0,0 +1,131 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package bench
+
+import (
+	"math/bits"
+	"time"
+)
+
+const (
+	subBits    = 6                                      // The number of sub-buckets per power of two, as bits.
+	maxLatency = uint64(1) << 36                        // The maximum latency recorded, in microseconds.
+	numBuckets = (36-subBits)<<subBits + (1 << subBits) // The number of buckets of a histogram.
+)
+
+// histogram represents a log-linear histogram of the latencies, with a microsecond
+// resolution. Each power of two is split into 64 buckets, which keeps the error of the
+// percentiles below 2% while using a fixed amount of memory.
+type histogram struct {
+	buckets [numBuckets]uint64 // The number of latencies recorded in each bucket.
+	count   uint64             // The number of latencies recorded.
+	sum     uint64             // The sum of the latencies recorded, in microseconds.
+	max     uint64             // The highest latency recorded, in microseconds.
+}
+
+// Record records a latency.
+func (h *histogram) Record(latency time.Duration) {
+	v := uint64(0)
+	if latency > 0 {
+		v = uint64(latency / time.Microsecond)
+	}
+	if v >= maxLatency {
+		v = maxLatency - 1
+	}
+
+	h.buckets[bucketOf(v)]++
+	h.count++
+	h.sum += v
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Merge adds the latencies recorded by another histogram.
+func (h *histogram) Merge(other *histogram) {
+	for i, n := range other.buckets {
+		h.buckets[i] += n
+	}
+
+	h.count += other.count
+	h.sum += other.sum
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// Count returns the number of latencies recorded.
+func (h *histogram) Count() uint64 {
+	return h.count
+}
+
+// Mean returns the mean of the latencies recorded.
+func (h *histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/h.count) * time.Microsecond
+}
+
+// Max returns the highest latency recorded.
+func (h *histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Percentile returns the latency below which the specified percentage of the latencies
+// recorded fall, which is the upper bound of the bucket it lands in.
+func (h *histogram) Percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(p / 100 * float64(h.count))
+	if rank >= h.count {
+		rank = h.count - 1
+	}
+
+	seen := uint64(0)
+	for i, n := range h.buckets {
+		if seen += n; seen > rank {
+			v := valueOf(i+1) - 1
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return h.Max()
+}
+
+// bucketOf returns the bucket of a value. The values below 64 have a bucket each, and
+// the higher ones share a bucket with the values of the same top 7 bits.
+func bucketOf(v uint64) int {
+	if v < 1<<subBits {
+		return int(v)
+	}
+
+	shift := bits.Len64(v) - subBits - 1
+	return shift<<subBits + int(v>>uint(shift))
+}
+
+// valueOf returns the lowest value of a bucket.
+func valueOf(i int) uint64 {
+	if i < 1<<subBits {
+		return uint64(i)
+	}
+
+	shift := i>>subBits - 1
+	return uint64(i-shift<<subBits) << uint(shift)
+}
@@ -0,0 +1,64 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	assert.Equal(t, uint64(1000), h.Count())
+	assert.Equal(t, 500500*time.Microsecond, h.Mean())
+	assert.Equal(t, time.Second, h.Max())
+	assert.InEpsilon(t, float64(500*time.Millisecond), float64(h.Percentile(50)), 0.02)
+	assert.InEpsilon(t, float64(990*time.Millisecond), float64(h.Percentile(99)), 0.02)
+	assert.Equal(t, time.Second, h.Percentile(100))
+}
+
+func TestHistogram_Empty(t *testing.T) {
+	var h histogram
+	assert.Equal(t, time.Duration(0), h.Mean())
+	assert.Equal(t, time.Duration(0), h.Percentile(99))
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	var a, b histogram
+	a.Record(10 * time.Microsecond)
+	b.Record(20 * time.Microsecond)
+	b.Record(-time.Second)
+	b.Record(1000 * time.Hour)
+
+	a.Merge(&b)
+	assert.Equal(t, uint64(4), a.Count())
+	assert.Equal(t, time.Duration(maxLatency-1)*time.Microsecond, a.Max())
+	assert.Equal(t, 10*time.Microsecond, a.Percentile(25))
+}
+
+func TestBucketOf(t *testing.T) {
+	for _, v := range []uint64{0, 1, 63, 64, 65, 127, 128, 1000, 123456789, maxLatency - 1} {
+		i := bucketOf(v)
+		assert.True(t, valueOf(i) <= v, "value %d", v)
+		assert.True(t, valueOf(i+1) > v, "value %d", v)
+		assert.True(t, i < numBuckets, "value %d", v)
+	}
+}
@@ -0,0 +1,115 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package capacity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/service/capacity"
+	"github.com/jawher/mow.cli"
+)
+
+var output io.Writer = os.Stdout
+
+// Report fetches the capacity report of the cluster from a broker and prints it, one line
+// per node.
+func Report(cmd *cli.Cmd) {
+	cmd.Spec = "-k=<key> [ -u=<url> ] [ -d=<days> ]"
+	var (
+		key  = cmd.StringOpt("k key", "", "Specifies the master key of the license of the broker.")
+		url  = cmd.StringOpt("u url", "http://127.0.0.1:8080", "Specifies the address of the broker.")
+		days = cmd.IntOpt("d days", 30, "Specifies the number of days the growth is projected over.")
+	)
+	cmd.Action = func() {
+		reports, err := fetch(*url, *key, *days)
+		if err != nil {
+			logging.LogError("capacity", "fetching the report", err)
+			return
+		}
+
+		print(reports, *days)
+	}
+}
+
+// fetch requests the capacity report of the cluster from the admin endpoint of a broker.
+func fetch(url, key string, days int) ([]capacity.Report, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/admin/capacity?days=%d", strings.TrimSuffix(url, "/"), days), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+key)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the broker responded with %s", resp.Status)
+	}
+
+	var reports []capacity.Report
+	err = json.NewDecoder(resp.Body).Decode(&reports)
+	return reports, err
+}
+
+// print prints the reports as a table.
+func print(reports []capacity.Report, days int) {
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "NODE\tHISTORY\tCONNECTIONS\tGROWTH/DAY\tIN %d DAYS\tMEMORY/CONN\tSTORAGE/DAY\tMEMORY LEFT\tCONNECTIONS LEFT\tDAYS LEFT\n", days)
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.1f\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			r.Node,
+			time.Duration(r.Window)*time.Second,
+			r.Connections,
+			r.Growth,
+			r.Projected,
+			bytesOf(float64(r.PerConnection)),
+			bytesOf(r.Storage),
+			orUnknown(r.Headroom.Memory > 0, bytesOf(float64(r.Headroom.Memory))),
+			orUnknown(r.Headroom.Connections > 0, fmt.Sprintf("%d", r.Headroom.Connections)),
+			orUnknown(r.Headroom.Days > 0, fmt.Sprintf("%.0f", r.Headroom.Days)),
+		)
+	}
+	w.Flush()
+}
+
+// bytesOf formats a number of bytes in a human-readable way.
+func bytesOf(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for ; n >= 1024 && i < len(units)-1; i++ {
+		n /= 1024
+	}
+	return fmt.Sprintf("%.1f%s", n, units[i])
+}
+
+// orUnknown returns the value if it is known, or a dash otherwise.
+func orUnknown(known bool, value string) string {
+	if !known {
+		return "-"
+	}
+	return value
+}
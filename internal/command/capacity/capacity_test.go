@@ -0,0 +1,86 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package capacity
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/service/capacity"
+	"github.com/jawher/mow.cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		assert.Equal(t, "/admin/capacity", r.URL.Path)
+		assert.Equal(t, "7", r.URL.Query().Get("days"))
+		resp, _ := json.Marshal([]capacity.Report{{
+			Node:          "node-a",
+			Window:        3600,
+			Connections:   120,
+			Growth:        12.5,
+			Horizon:       7,
+			Projected:     207,
+			PerConnection: 2048,
+			Headroom: capacity.Headroom{
+				Memory:      1 << 30,
+				Connections: 5000,
+				Days:        400,
+			},
+		}})
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	var buffer bytes.Buffer
+	output = &buffer
+	assert.NotPanics(t, func() {
+		runCommand(Report, "-k", "secret", "-u", server.URL, "-d", "7")
+	})
+
+	assert.Contains(t, buffer.String(), "IN 7 DAYS")
+	assert.Contains(t, buffer.String(), "node-a")
+	assert.Contains(t, buffer.String(), "2.0KB")
+	assert.Contains(t, buffer.String(), "1.0GB")
+
+	buffer.Reset()
+	assert.NotPanics(t, func() {
+		runCommand(Report, "-k", "wrong", "-u", server.URL)
+	})
+	assert.Empty(t, buffer.String())
+}
+
+func TestBytesOf(t *testing.T) {
+	assert.Equal(t, "512.0B", bytesOf(512))
+	assert.Equal(t, "1.5KB", bytesOf(1536))
+	assert.Equal(t, "2.0TB", bytesOf(2<<40))
+}
+
+func runCommand(f func(cmd *cli.Cmd), args ...string) {
+	app := cli.App("emitter", "")
+	app.Command("test", "", f)
+	v := []string{"emitter", "test"}
+	v = append(v, args...)
+	app.Run(v)
+}
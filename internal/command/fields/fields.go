@@ -0,0 +1,41 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package fields
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/emitter-io/emitter/internal/config"
+	cli "github.com/jawher/mow.cli"
+)
+
+var output io.Writer = os.Stdout
+
+// Print prints the configuration fields, along with the environment variable and the
+// command line assignment overriding each of them.
+func Print(cmd *cli.Cmd) {
+	cmd.Spec = ""
+	cmd.Action = func() {
+		w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FIELD\tTYPE\tENVIRONMENT\tFLAG")
+		for _, f := range config.Fields() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t--set %s=<value>\n", f.Path, f.Type, f.Env, f.Path)
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,65 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package migrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emitter-io/emitter/internal/migrate"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/jawher/mow.cli"
+)
+
+// Run migrates a data directory to the current version of its on-disk format, which is
+// otherwise done when the broker starts.
+func Run(cmd *cli.Cmd) {
+	cmd.Spec = "[ --dry-run ] [ --no-backup ] FORMAT DIR"
+	var (
+		dryRun   = cmd.BoolOpt("dry-run", false, "Only prints the migrations which would be applied.")
+		noBackup = cmd.BoolOpt("no-backup", false, "Does not copy the directory before migrating it.")
+		name     = cmd.StringArg("FORMAT", "", "The on-disk format of the directory ("+strings.Join(migrate.Formats(), ", ")+").")
+		dir      = cmd.StringArg("DIR", "", "The data directory to migrate.")
+	)
+	cmd.Action = func() {
+		format, ok := migrate.Lookup(*name)
+		if !ok {
+			logging.LogAction("migrate", fmt.Sprintf("unknown format '%s', expected one of %s", *name, strings.Join(migrate.Formats(), ", ")))
+			return
+		}
+
+		result, err := format.Migrate(*dir, migrate.Options{
+			DryRun: *dryRun,
+			Backup: !*noBackup,
+		})
+		if err != nil {
+			logging.LogError("migrate", "migrating "+*dir, err)
+			return
+		}
+
+		for _, m := range result.Pending {
+			logging.LogAction("migrate", fmt.Sprintf("%s v%d: %s", format.Name, m.Version, m.Description))
+		}
+
+		switch {
+		case *dryRun:
+			logging.LogAction("migrate", fmt.Sprintf("%s would be migrated from v%d to v%d", *dir, result.From, result.To))
+		case result.Backup != "":
+			logging.LogAction("migrate", fmt.Sprintf("%s migrated from v%d to v%d, backed up to %s", *dir, result.From, result.To, result.Backup))
+		default:
+			logging.LogAction("migrate", fmt.Sprintf("%s is at v%d", *dir, result.To))
+		}
+	}
+}
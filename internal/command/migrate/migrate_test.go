@@ -0,0 +1,66 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package migrate
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/migrate"
+	"github.com/jawher/mow.cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	var applied int
+	migrate.Register(&migrate.Format{
+		Name: "test",
+		Migrations: []migrate.Migration{{
+			Version:     1,
+			Description: "test",
+			Apply: func(string) error {
+				applied++
+				return nil
+			},
+		}},
+	})
+
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "data"), []byte("legacy"), 0666))
+
+	assert.NotPanics(t, func() {
+		runCommand(Run, "missing", dir)
+		runCommand(Run, "--dry-run", "test", dir)
+	})
+	assert.Equal(t, 0, applied)
+
+	assert.NotPanics(t, func() {
+		runCommand(Run, "--no-backup", "test", dir)
+		runCommand(Run, "test", dir)
+	})
+	assert.Equal(t, 1, applied)
+
+	backups, _ := filepath.Glob(dir + ".v0-*.bak")
+	assert.Empty(t, backups)
+}
+
+func runCommand(f func(cmd *cli.Cmd), args ...string) {
+	app := cli.App("emitter", "")
+	app.Command("test", "", f)
+	v := []string{"emitter", "test"}
+	v = append(v, args...)
+	app.Run(v)
+}
@@ -0,0 +1,64 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package secret
+
+import (
+	"fmt"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/jawher/mow.cli"
+)
+
+// NewKey generates a new data key for encrypting the configuration values, which is only
+// printed to the standard output so it does not end up in the logs.
+func NewKey(cmd *cli.Cmd) {
+	cmd.Spec = ""
+	cmd.Action = func() {
+		key, err := config.NewKey()
+		if err != nil {
+			logging.LogError("secret", "generating the key", err)
+			return
+		}
+
+		fmt.Println(key)
+	}
+}
+
+// Encrypt encrypts a configuration value with the data key.
+func Encrypt(cmd *cli.Cmd) {
+	cmd.Spec = "-k=<key file> [ --kms-region=<region> ] VALUE"
+	keyFile := cmd.StringOpt("k key", "", "Specifies the file containing the data key.")
+	region := cmd.StringOpt("kms-region", "", "Specifies the AWS region of the KMS which protects the data key.")
+	value := cmd.StringArg("VALUE", "", "The configuration value to encrypt.")
+	cmd.Action = func() {
+		key, err := config.LoadKey(&config.EncryptionConfig{
+			KeyFile:   *keyFile,
+			KMSRegion: *region,
+		})
+		if err != nil {
+			logging.LogError("secret", "loading the key", err)
+			return
+		}
+
+		encrypted, err := config.Encrypt(key, *value)
+		if err != nil {
+			logging.LogError("secret", "encrypting the value", err)
+			return
+		}
+
+		fmt.Println(encrypted)
+	}
+}
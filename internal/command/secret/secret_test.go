@@ -0,0 +1,55 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/jawher/mow.cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKey(t *testing.T) {
+	assert.NotPanics(t, func() {
+		runCommand(NewKey)
+	})
+}
+
+func TestEncrypt(t *testing.T) {
+	key, err := config.NewKey()
+	assert.NoError(t, err)
+
+	f, err := ioutil.TempFile("", "emitter-key")
+	assert.NoError(t, err)
+	f.WriteString(key)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	assert.NotPanics(t, func() {
+		runCommand(Encrypt, "-k", f.Name(), "hello")
+		runCommand(Encrypt, "-k", "missing.key", "hello")
+	})
+}
+
+func runCommand(f func(cmd *cli.Cmd), args ...string) {
+	app := cli.App("emitter", "")
+	app.Command("test", "", f)
+	v := []string{"emitter", "test"}
+	v = append(v, args...)
+	app.Run(v)
+}
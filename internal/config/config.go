@@ -15,22 +15,35 @@
 package config
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/emitter-io/address"
 	cfg "github.com/emitter-io/config"
 	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/pkg/shm"
 )
 
 // Constants used throughout the service.
 const (
-	ChannelSeparator = '/'   // The separator character.
-	maxMessageSize   = 65536 // Default Maximum message size allowed from/to the peer.
+	ChannelSeparator  = '/'   // The separator character.
+	maxMessageSize    = 65536 // Default Maximum message size allowed from/to the peer.
+	defaultReadBuffer = 65536 // Default size of the read buffer of a connection.
 )
 
+// errNoSource is returned when reloading a configuration which was not read from a file.
+var errNoSource = errors.New("config: the configuration was not read from a file")
+
 // VaultUser is the vault user to use for authentication
 var VaultUser = toUsername(address.GetExternalOrDefault(address.Loopback))
 
@@ -62,7 +75,7 @@ func NewDefault() cfg.Config {
 }
 
 // New reads or creates a configuration.
-func New(filename string, stores ...cfg.SecretStore) *Config {
+func New(filename string, stores ...cfg.SecretStore) (*Config, error) {
 	readers := []cfg.SecretReader{cfg.NewEnvironmentProvider()}
 	caches := []cfg.CertCacher{}
 	for _, store := range stores {
@@ -70,35 +83,125 @@ func New(filename string, stores ...cfg.SecretStore) *Config {
 		caches = append(caches, store)
 	}
 
+	conf, err := load(filename, readers)
+	if err != nil {
+		return nil, err
+	}
+
+	conf.certCaches = caches
+	return conf, nil
+}
+
+// load reads and decrypts the configuration.
+func load(filename string, readers []cfg.SecretReader) (*Config, error) {
 	c, err := cfg.ReadOrCreate("emitter", filename, NewDefault, readers...)
 	if err != nil {
-		panic("Unable to parse configuration, due to " + err.Error())
+		return nil, errors.New("Unable to parse configuration, due to " + err.Error())
 	}
 
 	conf := c.(*Config)
-	conf.certCaches = caches
-	return conf
+	if err := conf.applyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+
+	if err := conf.Decrypt(); err != nil {
+		return nil, errors.New("Unable to decrypt configuration, due to " + err.Error())
+	}
+
+	conf.source = filename
+	conf.readers = readers
+	return conf, nil
+}
+
+// Reload reads the configuration again from the file it was read from, along with the
+// secrets of the same stores and the assignments set.
+func (c *Config) Reload() (*Config, error) {
+	if c.source == "" {
+		return nil, errNoSource
+	}
+
+	conf, err := load(c.source, c.readers)
+	if err != nil {
+		return nil, err
+	}
+
+	conf.certCaches = c.certCaches
+	if err := conf.Set(c.assignments...); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// watcher represents a secret store which watches its secrets for changes.
+type watcher interface {
+	Watch(ctx context.Context, onChange func())
+}
+
+// Watch watches the secret stores which support it until the context is cancelled, calling
+// the function whenever their secrets change, typically to reload the configuration.
+func (c *Config) Watch(ctx context.Context, onChange func()) {
+	for _, reader := range c.readers {
+		if w, ok := reader.(watcher); ok {
+			w.Watch(ctx, onChange)
+		}
+	}
 }
 
 // Config represents main configuration.
 type Config struct {
-	ListenAddr string              `json:"listen"`             // The API port used for TCP & Websocket communication.
-	License    string              `json:"license"`            // The license file to use for the broker.
-	Matcher    string              `json:"matcher,omitempty"`  // If "mqtt", then topic matching would follow MQTT specification.
-	Debug      bool                `json:"debug,omitempty"`    // The debug mode flag.
-	Limit      LimitConfig         `json:"limit,omitempty"`    // Configuration for various limits such as message size.
-	TLS        *cfg.TLSConfig      `json:"tls,omitempty"`      // The API port used for Secure TCP & Websocket communication.
-	Cluster    *ClusterConfig      `json:"cluster,omitempty"`  // The configuration for the clustering.
-	Storage    *cfg.ProviderConfig `json:"storage,omitempty"`  // The configuration for the storage provider.
-	Contract   *cfg.ProviderConfig `json:"contract,omitempty"` // The configuration for the contract provider.
-	Metering   *cfg.ProviderConfig `json:"metering,omitempty"` // The configuration for the usage storage for metering.
-	Logging    *cfg.ProviderConfig `json:"logging,omitempty"`  // The configuration for the logger.
-	Monitor    *cfg.ProviderConfig `json:"monitor,omitempty"`  // The configuration for the monitoring storage.
-	Vault      secretStoreConfig   `json:"vault,omitempty"`    // The configuration for the Hashicorp Vault Secret Store.
-	Dynamo     secretStoreConfig   `json:"dynamodb,omitempty"` // The configuration for the AWS DynamoDB Secret Store.
-
-	listenAddr *net.TCPAddr     // The listen address, parsed.
-	certCaches []cfg.CertCacher // The certificate caches configured.
+	ListenAddr string              `json:"listen"`               // The API port used for TCP & Websocket communication.
+	License    string              `json:"license"`              // The license file to use for the broker.
+	Matcher    string              `json:"matcher,omitempty"`    // If "mqtt", then topic matching would follow MQTT specification.
+	Debug      bool                `json:"debug,omitempty"`      // The debug mode flag.
+	Dashboard  bool                `json:"dashboard,omitempty"`  // Whether the web dashboard is served on the admin API.
+	Profile    string              `json:"profile,omitempty"`    // The resource profile (tiny, edge, standard or large).
+	Limit      LimitConfig         `json:"limit,omitempty"`      // Configuration for various limits such as message size.
+	TLS        *cfg.TLSConfig      `json:"tls,omitempty"`        // The API port used for Secure TCP & Websocket communication.
+	TLSPolicy  *TLSPolicyConfig    `json:"tlsPolicy,omitempty"`  // The policy of the TLS handshakes, such as the minimum version.
+	SNI        *SNIConfig          `json:"sni,omitempty"`        // The certificates served per hostname on the secure listener.
+	Proxy      *ProxyConfig        `json:"proxy,omitempty"`      // The configuration of the PROXY protocol of the listeners.
+	Access     *AccessConfig       `json:"access,omitempty"`     // The access control of the listeners.
+	Cluster    *ClusterConfig      `json:"cluster,omitempty"`    // The configuration for the clustering.
+	Federation *FederationConfig   `json:"federation,omitempty"` // The configuration for the federation of clusters.
+	Storage    *cfg.ProviderConfig `json:"storage,omitempty"`    // The configuration for the storage provider.
+	Contract   *cfg.ProviderConfig `json:"contract,omitempty"`   // The configuration for the contract provider.
+	Metering   *cfg.ProviderConfig `json:"metering,omitempty"`   // The configuration for the usage storage for metering.
+	Logging    *cfg.ProviderConfig `json:"logging,omitempty"`    // The configuration for the logger.
+	Monitor    *cfg.ProviderConfig `json:"monitor,omitempty"`    // The configuration for the monitoring storage.
+	Vault      secretStoreConfig   `json:"vault,omitempty"`      // The configuration for the Hashicorp Vault Secret Store.
+	Dynamo     secretStoreConfig   `json:"dynamodb,omitempty"`   // The configuration for the AWS DynamoDB Secret Store.
+	Consul     secretStoreConfig   `json:"consul,omitempty"`     // The configuration for the Consul key-value store.
+	Etcd       secretStoreConfig   `json:"etcd,omitempty"`       // The configuration for the etcd key-value store.
+	Encryption *EncryptionConfig   `json:"encryption,omitempty"` // The configuration for decrypting the encrypted values.
+	Failover   *FailoverConfig     `json:"failover,omitempty"`   // The retry guidance given to the rejected clients.
+	History    *HistoryConfig      `json:"history,omitempty"`    // The configuration of the message history.
+	Archive    *ArchiveConfig      `json:"archive,omitempty"`    // The configuration of the message archival.
+	Scan       *ScanConfig         `json:"scan,omitempty"`       // The configuration of the content scanning.
+	Hooks      []HookConfig        `json:"hooks,omitempty"`      // The scripts run on the messages published.
+	Rules      []RuleConfig        `json:"rules,omitempty"`      // The routing rules applied to the messages published.
+	Plugins    []PluginConfig      `json:"plugins,omitempty"`    // The external plugins extending the broker.
+	Signing    *SigningConfig      `json:"signing,omitempty"`    // The configuration of the message signing.
+	Session    *SessionConfig      `json:"session,omitempty"`    // The configuration of the offline sessions, disabled if not specified.
+	Liveness   *LivenessConfig     `json:"liveness,omitempty"`   // The liveness settings of the connections, per listener.
+	Websocket  *WebsocketConfig    `json:"websocket,omitempty"`  // The configuration of the websocket connections, per listener.
+	Dedup      *DedupConfig        `json:"dedup,omitempty"`      // The configuration of the publish deduplication.
+	Delay      *DelayConfig        `json:"delay,omitempty"`      // The configuration of the delayed delivery.
+	DeadLetter *DeadLetterConfig   `json:"deadLetter,omitempty"` // The configuration of the dead-letter channels.
+	Synthetic  []SyntheticConfig   `json:"synthetic,omitempty"`  // The synthetic channels.
+	Snapshot   *SnapshotConfig     `json:"snapshot,omitempty"`   // The configuration of the subscription snapshots.
+	Shared     *SharedConfig       `json:"shared,omitempty"`     // The configuration of the shared memory transport.
+	Unix       *UnixConfig         `json:"unix,omitempty"`       // The configuration of the Unix domain socket listener.
+	QUIC       *QUICConfig         `json:"quic,omitempty"`       // The configuration of the experimental QUIC listener.
+	Analytics  *AnalyticsConfig    `json:"analytics,omitempty"`  // The configuration of the retention of the channel statistics.
+	Tracing    *TracingConfig      `json:"tracing,omitempty"`    // The configuration of the tracing of the publications.
+	System     *SystemConfig       `json:"system,omitempty"`     // The configuration of the system channels.
+	Audit      *AuditConfig        `json:"audit,omitempty"`      // The configuration of the security audit trail.
+
+	listenAddr  *net.TCPAddr       // The listen address, parsed.
+	certCaches  []cfg.CertCacher   // The certificate caches configured.
+	source      string             // The file the configuration was read from.
+	readers     []cfg.SecretReader // The readers of the secrets configured.
+	assignments []string           // The assignments set on the command line.
 }
 
 // MaxMessageBytes returns the configured max message size, must be smaller than 64K.
@@ -128,6 +231,16 @@ func (c *Config) Certificate() (*tls.Config, http.Handler, bool) {
 
 	// Attempt to configure
 	if tls, validator, cache := cfg.TLS(c.TLS, c.certCaches...); cache != nil {
+		if err := c.TLSPolicy.Apply(tls); err != nil {
+			logging.LogError("tls", "applying the policy", err)
+			return nil, nil, false
+		}
+
+		if err := c.SNI.Apply(tls); err != nil {
+			logging.LogError("tls", "loading the certificates of the hostnames", err)
+			return nil, nil, false
+		}
+
 		logging.LogAction("tls", "setting up certificates with "+cache.Name()+" cache")
 		return tls, validator, true
 	}
@@ -136,6 +249,29 @@ func (c *Config) Certificate() (*tls.Config, http.Handler, bool) {
 	return nil, nil, false
 }
 
+// ClusterKey returns the pre-shared key used to encrypt and authenticate the inter-node
+// traffic. The key is derived from the license and the optional cluster passphrase, so
+// only the nodes which share both are able to join the cluster.
+func (c *Config) ClusterKey() []byte {
+	mac := hmac.New(sha256.New, []byte(c.License))
+	if c.Cluster != nil {
+		mac.Write([]byte(c.Cluster.Passphrase))
+	}
+	return mac.Sum(nil)
+}
+
+// FederationKey returns the pre-shared key used to encrypt and authenticate the links
+// between the federated clusters. The key is derived from the license and the optional
+// federation passphrase, independently of the key used within each of the clusters.
+func (c *Config) FederationKey() []byte {
+	mac := hmac.New(sha256.New, []byte(c.License))
+	mac.Write([]byte("federation"))
+	if c.Federation != nil {
+		mac.Write([]byte(c.Federation.Passphrase))
+	}
+	return mac.Sum(nil)
+}
+
 // ClusterConfig represents the configuration for the cluster.
 type ClusterConfig struct {
 
@@ -154,12 +290,915 @@ type ClusterConfig struct {
 	// The seed address (or a domain name) for cluster join.
 	Seed string `json:"seed,omitempty"`
 
-	// Passphrase is used to initialize the primary encryption key in a keyring. This key
-	// is used for encrypting all the gossip messages (message-level encryption).
+	// Passphrase is combined with the license to derive the pre-shared cluster key. This key
+	// is used for encrypting and authenticating all the inter-node traffic, both gossip and
+	// forwarded messages.
 	Passphrase string `json:"passphrase,omitempty"`
 
 	// Directory specifies the directory where the cluster state will be stored.
 	Directory string `json:"dir,omitempty"`
+
+	// The interval, in seconds, of the full state exchange (anti-entropy) between the peers,
+	// the changes are gossiped as deltas in between. Defaults to 30 seconds.
+	SyncInterval int `json:"syncInterval,omitempty"`
+
+	// The interval, in milliseconds, during which the subscription changes are batched into
+	// a single delta before being gossiped. If not specified, every change is gossiped as
+	// soon as it happens.
+	DeltaInterval int `json:"deltaInterval,omitempty"`
+
+	// The maximum number of channels aliased per peer. The messages forwarded to the peers
+	// refer to these channels by a small integer once the channel was sent, cutting the
+	// bandwidth used by the long channels. This must only be enabled once every node of the
+	// cluster supports it. Defaults to 0, which disables it.
+	Aliases int `json:"aliases,omitempty"`
+
+	// The maximum size, in bytes, of a single message of the full state exchange. A larger
+	// state is split into several messages. If not specified, the state is not split.
+	MaxStateSize int `json:"maxStateSize,omitempty"`
+
+	// The policy applied when a partition of the cluster heals: "newer" re-asserts the
+	// subscriptions of this node and removes the stale ones, "replay" also gossips the
+	// complete state right away and "none" only emits the heal event. Defaults to "newer".
+	MergePolicy string `json:"mergePolicy,omitempty"`
+
+	// The interval, in milliseconds, during which the messages forwarded to a peer are
+	// batched into a single frame. Defaults to 5 milliseconds.
+	FlushInterval int `json:"flushInterval,omitempty"`
+
+	// The size, in bytes, of the payloads batched for a peer above which the frame is sent
+	// right away rather than at the end of the interval. If not specified, the frames are
+	// only sent on the interval.
+	FlushSize int `json:"flushSize,omitempty"`
+
+	// The compression of the frames forwarded to the peers: "snappy" or "none", which saves
+	// the processing on a fast network or with incompressible payloads. This must only be
+	// disabled once every node of the cluster supports it. Defaults to "snappy".
+	Compression string `json:"compression,omitempty"`
+}
+
+// SyncPeriod returns the configured interval of the full state exchange.
+func (c *ClusterConfig) SyncPeriod() time.Duration {
+	if c.SyncInterval <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(c.SyncInterval) * time.Second
+}
+
+// DeltaPeriod returns the configured interval of the delta batching.
+func (c *ClusterConfig) DeltaPeriod() time.Duration {
+	if c.DeltaInterval <= 0 {
+		return 0
+	}
+	return time.Duration(c.DeltaInterval) * time.Millisecond
+}
+
+// FlushPeriod returns the configured interval of the batching of the forwarded messages.
+func (c *ClusterConfig) FlushPeriod() time.Duration {
+	if c.FlushInterval <= 0 {
+		return 5 * time.Millisecond
+	}
+	return time.Duration(c.FlushInterval) * time.Millisecond
+}
+
+// Compressed returns whether the frames forwarded to the peers are compressed.
+func (c *ClusterConfig) Compressed() bool {
+	return c.Compression != "none"
+}
+
+// FederationConfig represents the configuration for the federation of independent clusters,
+// typically running in different regions.
+type FederationConfig struct {
+
+	// The IP address and port that is used to accept the links from the remote clusters. If
+	// this is not set, this node does not accept any incoming federated messages.
+	ListenAddr string `json:"listen,omitempty"`
+
+	// The comma-separated list of addresses of the remote clusters the messages should be
+	// replicated to.
+	Remotes string `json:"remotes,omitempty"`
+
+	// The comma-separated list of channel patterns (e.g: "sensor/+/temperature/") which
+	// should be replicated to the remote clusters, and accepted from them.
+	Channels string `json:"channels,omitempty"`
+
+	// Passphrase is combined with the license to derive the pre-shared federation key, all
+	// of the federated clusters must share the same license and passphrase.
+	Passphrase string `json:"passphrase,omitempty"`
+
+	// The interval, in milliseconds, at which the batched messages are sent to the remote
+	// clusters. Defaults to 50 milliseconds.
+	FlushInterval int `json:"flushInterval,omitempty"`
+
+	// The name of the region of this cluster, matched against the placement of the contracts.
+	Region string `json:"region,omitempty"`
+
+	// The comma-separated list of the regions along with their public endpoint (e.g:
+	// "eu=eu.example.com:8080,us=us.example.com:8080"), where the clients are redirected to
+	// for the requests which can only be served by the home region of their contract.
+	Regions string `json:"regions,omitempty"`
+
+	// The comma-separated list of the message headers replicated to the remote clusters,
+	// each optionally renamed (e.g: "trace,zone=region"). If not set, all of the headers
+	// are replicated unchanged.
+	Headers string `json:"headers,omitempty"`
+}
+
+// RegionEndpoints returns the public endpoints of the configured regions.
+func (c *FederationConfig) RegionEndpoints() map[string]string {
+	endpoints := make(map[string]string)
+	for _, v := range strings.Split(c.Regions, ",") {
+		if kv := strings.SplitN(strings.TrimSpace(v), "=", 2); len(kv) == 2 {
+			endpoints[kv[0]] = kv[1]
+		}
+	}
+	return endpoints
+}
+
+// HistoryConfig represents the configuration of the message history.
+type HistoryConfig struct {
+
+	// The comma-separated list of channel patterns (e.g: "devices/+/state/") of the last-value
+	// channels. Only the newest message of each partition, the part of the channel matched
+	// by the pattern, is retained and returned by the history queries.
+	Compact string `json:"compact,omitempty"`
+
+	// The maximum number of seconds a subscriber can rewind with the 'rewind' option, to receive
+	// the messages published shortly before it subscribed. Defaults to 0, which disables it.
+	Rewind int `json:"rewind,omitempty"`
+
+	// The maximum number of recent messages kept per channel for the rewinds. Defaults to 16.
+	RewindSize int `json:"rewindSize,omitempty"`
+
+	// The interval, in seconds, at which the retention rules of the contracts are enforced on
+	// the stored messages. Defaults to 300.
+	Enforce int `json:"enforce,omitempty"`
+}
+
+// RewindWindow returns the configured window of the rewinds.
+func (c *HistoryConfig) RewindWindow() time.Duration {
+	if c.Rewind <= 0 {
+		return 0
+	}
+	return time.Duration(c.Rewind) * time.Second
+}
+
+// RewindBuffer returns the configured number of recent messages kept per channel.
+func (c *HistoryConfig) RewindBuffer() int {
+	if c.RewindSize <= 0 {
+		return 16
+	}
+	return c.RewindSize
+}
+
+// EnforceInterval returns the configured interval of the retention enforcement, which
+// applies even when the history is not configured.
+func (c *HistoryConfig) EnforceInterval() time.Duration {
+	if c == nil || c.Enforce <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(c.Enforce) * time.Second
+}
+
+// SessionConfig represents the configuration of the offline sessions of the clients which
+// connect with the clean session flag off.
+type SessionConfig struct {
+
+	// The number of seconds an offline session is kept before it expires. Defaults to 3600.
+	Expiry int `json:"expiry,omitempty"`
+
+	// The maximum number of messages queued for an offline session. Defaults to 1000.
+	MaxMessages int `json:"maxMessages,omitempty"`
+
+	// The maximum size, in bytes, of the payloads queued for an offline session. Defaults to 1MB.
+	MaxBytes int `json:"maxBytes,omitempty"`
+
+	// The policy applied when a client connects with the client ID of a connected client:
+	// "kick" the connected client, "reject" the new connection or "allow" both. Defaults to
+	// "allow".
+	Takeover string `json:"takeover,omitempty"`
+}
+
+// The takeover policies, applied when a client connects with the client ID of a connected
+// client.
+const (
+	TakeoverAllow  = "allow"  // Both of the connections are kept.
+	TakeoverKick   = "kick"   // The connected client is disconnected, as in the MQTT specification.
+	TakeoverReject = "reject" // The new connection is refused.
+)
+
+// TakeoverPolicy returns the configured policy applied when a client connects with the
+// client ID of a connected client.
+func (c *SessionConfig) TakeoverPolicy() (string, error) {
+	if c == nil || c.Takeover == "" {
+		return TakeoverAllow, nil
+	}
+
+	switch c.Takeover {
+	case TakeoverAllow, TakeoverKick, TakeoverReject:
+		return c.Takeover, nil
+	}
+	return "", fmt.Errorf("invalid takeover policy '%s'", c.Takeover)
+}
+
+// ExpiryPeriod returns the configured expiry of the offline sessions.
+func (c *SessionConfig) ExpiryPeriod() time.Duration {
+	if c == nil || c.Expiry <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.Expiry) * time.Second
+}
+
+// QueueLimits returns the configured maximum count and size of the queued messages of an
+// offline session.
+func (c *SessionConfig) QueueLimits() (count int, size int) {
+	count, size = 1000, 1<<20
+	if c != nil && c.MaxMessages > 0 {
+		count = c.MaxMessages
+	}
+	if c != nil && c.MaxBytes > 0 {
+		size = c.MaxBytes
+	}
+	return
+}
+
+// Listeners are the names of the listeners whose connections can be given their own
+// liveness settings.
+var Listeners = []string{"tcp", "tls", "unix", "quic"}
+
+// LivenessConfig represents the liveness settings of the connections, which can be tuned for
+// each of the listeners since a fleet of mobile devices and a fleet of servers need very
+// different ones.
+type LivenessConfig struct {
+
+	// The minimum keepalive, in seconds, enforced on the clients requesting a shorter one.
+	MinKeepAlive int `json:"minKeepAlive,omitempty"`
+
+	// The maximum keepalive, in seconds, enforced on the clients requesting a longer one or
+	// none at all. If not specified, the keepalive requested by the clients is used.
+	MaxKeepAlive int `json:"maxKeepAlive,omitempty"`
+
+	// The number of seconds without any packet after which a connection without keepalive
+	// is closed. Defaults to 120.
+	IdleTimeout int `json:"idleTimeout,omitempty"`
+
+	// The number of seconds the offline sessions of the clients are kept, overriding the
+	// expiry of the sessions.
+	SessionExpiry int `json:"sessionExpiry,omitempty"`
+
+	// The settings of each listener ("tcp", "tls", "unix" or "quic"), overriding the ones
+	// above.
+	Listeners map[string]*LivenessConfig `json:"listeners,omitempty"`
+}
+
+// PerListener returns the liveness settings of each listener, where the settings of the
+// listener override the ones shared by all of them.
+func (c *LivenessConfig) PerListener() (map[string]LivenessConfig, error) {
+	out := make(map[string]LivenessConfig, len(Listeners))
+	if c == nil {
+		return out, nil
+	}
+
+	for _, name := range Listeners {
+		v := LivenessConfig{
+			MinKeepAlive:  c.MinKeepAlive,
+			MaxKeepAlive:  c.MaxKeepAlive,
+			IdleTimeout:   c.IdleTimeout,
+			SessionExpiry: c.SessionExpiry,
+		}
+
+		if o := c.Listeners[name]; o != nil {
+			v.MinKeepAlive = overrideInt(v.MinKeepAlive, o.MinKeepAlive)
+			v.MaxKeepAlive = overrideInt(v.MaxKeepAlive, o.MaxKeepAlive)
+			v.IdleTimeout = overrideInt(v.IdleTimeout, o.IdleTimeout)
+			v.SessionExpiry = overrideInt(v.SessionExpiry, o.SessionExpiry)
+		}
+
+		if v.MinKeepAlive < 0 || v.MaxKeepAlive < 0 || v.IdleTimeout < 0 || v.SessionExpiry < 0 ||
+			(v.MaxKeepAlive > 0 && v.MinKeepAlive > v.MaxKeepAlive) {
+			return nil, fmt.Errorf("invalid liveness settings of the listener '%s'", name)
+		}
+		out[name] = v
+	}
+
+	for name := range c.Listeners {
+		if _, ok := out[name]; !ok {
+			return nil, fmt.Errorf("invalid listener '%s'", name)
+		}
+	}
+	return out, nil
+}
+
+// overrideInt returns the value, unless it is overridden by a non-zero one.
+func overrideInt(value, override int) int {
+	if override != 0 {
+		return override
+	}
+	return value
+}
+
+// WebsocketConfig represents the configuration of the websocket connections, which can be
+// given to each of the listeners.
+type WebsocketConfig struct {
+
+	// Whether the messages are compressed with the permessage-deflate extension, for the
+	// clients supporting it. Defaults to false.
+	Compression bool `json:"compression,omitempty"`
+
+	// The compression level, from 1 (fastest) to 9 (smallest). Defaults to 1.
+	CompressionLevel int `json:"compressionLevel,omitempty"`
+
+	// The minimum size, in bytes, of the compressed messages, the smaller ones being sent as
+	// they are. Defaults to 128.
+	CompressionThreshold int `json:"compressionThreshold,omitempty"`
+
+	// The comma-separated list of the subprotocols supported. Defaults to "mqtt,mqttv3.1,mqttv3".
+	Subprotocols string `json:"subprotocols,omitempty"`
+
+	// Whether the clients must ask for one of the subprotocols, as the MQTT specification
+	// requires. Defaults to false.
+	Strict bool `json:"strict,omitempty"`
+
+	// The configuration of each listener ("tcp", "tls" or "unix"), replacing the one above.
+	Listeners map[string]*WebsocketConfig `json:"listeners,omitempty"`
+}
+
+// PerListener returns the configuration of the websocket connections of each listener.
+func (c *WebsocketConfig) PerListener() (map[string]WebsocketConfig, error) {
+	out := make(map[string]WebsocketConfig, len(Listeners))
+	if c == nil {
+		return out, nil
+	}
+
+	for _, name := range Listeners {
+		v := *c
+		if o := c.Listeners[name]; o != nil {
+			v = *o
+		}
+
+		v.Listeners = nil
+		if v.CompressionLevel < 0 || v.CompressionLevel > 9 || v.CompressionThreshold < 0 {
+			return nil, fmt.Errorf("invalid websocket compression of the listener '%s'", name)
+		}
+		if v.CompressionThreshold == 0 {
+			v.CompressionThreshold = 128
+		}
+		out[name] = v
+	}
+
+	for name := range c.Listeners {
+		if _, ok := out[name]; !ok {
+			return nil, fmt.Errorf("invalid listener '%s'", name)
+		}
+	}
+	return out, nil
+}
+
+// SubprotocolList returns the subprotocols supported, or nil for the default ones.
+func (c *WebsocketConfig) SubprotocolList() (out []string) {
+	for _, v := range strings.Split(c.Subprotocols, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return
+}
+
+// DedupConfig represents the configuration of the deduplication of the retried publishes.
+type DedupConfig struct {
+
+	// The number of seconds a message identifier is remembered for. Defaults to 60.
+	Window int `json:"window,omitempty"`
+
+	// The maximum number of message identifiers remembered. Defaults to 100000.
+	Size int `json:"size,omitempty"`
+
+	// The comma-separated list of channel patterns (e.g: "orders/+/") whose publishes are
+	// deduplicated. If not specified, every channel is.
+	Channels string `json:"channels,omitempty"`
+}
+
+// WindowPeriod returns the configured deduplication window.
+func (c *DedupConfig) WindowPeriod() time.Duration {
+	if c.Window <= 0 {
+		return time.Minute
+	}
+	return time.Duration(c.Window) * time.Second
+}
+
+// MaxSize returns the configured maximum number of message identifiers remembered.
+func (c *DedupConfig) MaxSize() int {
+	if c.Size <= 0 {
+		return 100000
+	}
+	return c.Size
+}
+
+// DelayConfig represents the configuration of the messages held until their delivery time.
+type DelayConfig struct {
+
+	// The directory where the held messages are written so they survive restarts. If not
+	// specified, the messages are only held in memory.
+	Dir string `json:"dir,omitempty"`
+
+	// The maximum number of messages held by the node. Defaults to 100000.
+	MaxPending int `json:"maxPending,omitempty"`
+
+	// The maximum number of seconds a message can be held for. Defaults to 7 days.
+	MaxDelay int64 `json:"maxDelay,omitempty"`
+}
+
+// MaxCount returns the configured maximum number of messages held.
+func (c *DelayConfig) MaxCount() int {
+	if c.MaxPending <= 0 {
+		return 100000
+	}
+	return c.MaxPending
+}
+
+// MaxPeriod returns the configured maximum delay of a message.
+func (c *DelayConfig) MaxPeriod() time.Duration {
+	if c.MaxDelay <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(c.MaxDelay) * time.Second
+}
+
+// DeadLetterConfig represents the configuration of the dead-letter channels, where the
+// messages which could not be delivered are republished.
+type DeadLetterConfig struct {
+
+	// The prefix of the dead-letter channels, which is followed by the original channel of
+	// the message. Defaults to "deadletter/".
+	Channel string `json:"channel,omitempty"`
+
+	// The number of seconds the dead letters are stored for. Defaults to 86400.
+	TTL int `json:"ttl,omitempty"`
+}
+
+// Prefix returns the configured prefix of the dead-letter channels.
+func (c *DeadLetterConfig) Prefix() string {
+	if c.Channel == "" {
+		return "deadletter/"
+	}
+	return c.Channel
+}
+
+// StoredFor returns the configured time-to-live of the dead letters, in seconds.
+func (c *DeadLetterConfig) StoredFor() uint32 {
+	if c.TTL <= 0 {
+		return 86400
+	}
+	return uint32(c.TTL)
+}
+
+// SyntheticConfig represents a synthetic channel, whose messages are computed by the broker
+// from the messages published on its source channels.
+type SyntheticConfig struct {
+
+	// The synthetic channel the aggregates are published on (e.g: "fleet/summary/").
+	Channel string `json:"channel"`
+
+	// The pattern of the source channels (e.g: "fleet/+/status/").
+	Source string `json:"source"`
+
+	// The aggregate computed over the source channels, which is either "count" for the number
+	// of messages, "distinct" for the number of distinct channels matched by the pattern or
+	// "bytes" for the size of the payloads.
+	Aggregate string `json:"aggregate"`
+
+	// The duration of a window, in seconds. Defaults to 60.
+	Interval int `json:"interval,omitempty"`
+}
+
+// Window returns the configured duration of a window.
+func (c *SyntheticConfig) Window() time.Duration {
+	if c.Interval <= 0 {
+		return time.Minute
+	}
+	return time.Duration(c.Interval) * time.Second
+}
+
+// SnapshotConfig represents the configuration of the periodic snapshots of the subscriptions
+// of the node, which can be compared for the analysis of the mass disconnects.
+type SnapshotConfig struct {
+
+	// The directory where the snapshots are persisted. If not specified, the snapshots are
+	// only kept in memory.
+	Dir string `json:"dir,omitempty"`
+
+	// The number of seconds between the snapshots. Defaults to 300 seconds.
+	Interval int `json:"interval,omitempty"`
+
+	// The number of snapshots kept, the oldest ones are removed. Defaults to 288.
+	Retain int `json:"retain,omitempty"`
+}
+
+// Period returns the configured interval between the snapshots.
+func (c *SnapshotConfig) Period() time.Duration {
+	if c.Interval <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(c.Interval) * time.Second
+}
+
+// MaxCount returns the configured number of snapshots kept.
+func (c *SnapshotConfig) MaxCount() int {
+	if c.Retain <= 0 {
+		return 288
+	}
+	return c.Retain
+}
+
+// AnalyticsConfig represents the configuration of the retention of the statistics of the
+// channels, which are periodically sampled and kept in the message storage.
+type AnalyticsConfig struct {
+
+	// The number of seconds between the samples of the statistics. Defaults to 60 seconds.
+	Interval int `json:"interval,omitempty"`
+
+	// The number of seconds the samples are kept for. Defaults to 7 days.
+	Retention int `json:"retention,omitempty"`
+}
+
+// Period returns the configured interval between the samples.
+func (c *AnalyticsConfig) Period() time.Duration {
+	if c.Interval <= 0 {
+		return time.Minute
+	}
+	return time.Duration(c.Interval) * time.Second
+}
+
+// MaxAge returns the configured duration the samples are kept for.
+func (c *AnalyticsConfig) MaxAge() time.Duration {
+	if c.Retention <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(c.Retention) * time.Second
+}
+
+// SharedConfig represents the configuration of the experimental shared memory transport,
+// for the publishers running on the same host as the broker.
+type SharedConfig struct {
+
+	// The directory watched for the ring buffers of the publishers. Defaults to
+	// "/dev/shm/emitter".
+	Dir string `json:"dir,omitempty"`
+}
+
+// Directory returns the configured directory of the ring buffers.
+func (c *SharedConfig) Directory() string {
+	if c.Dir == "" {
+		return shm.DefaultDir
+	}
+	return c.Dir
+}
+
+// UnixConfig represents the configuration of the listener on a Unix domain socket, for the
+// clients running on the same host.
+type UnixConfig struct {
+
+	// The path of the socket. Defaults to "emitter.sock".
+	Path string `json:"path,omitempty"`
+
+	// The permissions of the socket, in octal, which grant the access to it. Defaults to
+	// "0660", the owner and the group of the broker.
+	Mode string `json:"mode,omitempty"`
+}
+
+// SocketPath returns the configured path of the socket.
+func (c *UnixConfig) SocketPath() string {
+	if c.Path == "" {
+		return "emitter.sock"
+	}
+	return c.Path
+}
+
+// FileMode returns the configured permissions of the socket.
+func (c *UnixConfig) FileMode() (os.FileMode, error) {
+	if c.Mode == "" {
+		return 0660, nil
+	}
+
+	mode, err := strconv.ParseUint(c.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket permissions '%s'", c.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// QUICConfig represents the configuration of the experimental listener of the MQTT
+// connections over QUIC, which shares the certificates of the secure listener.
+type QUICConfig struct {
+
+	// The UDP address to listen on. Defaults to ":443".
+	ListenAddr string `json:"listen,omitempty"`
+}
+
+// SystemConfig represents the configuration of the system channels, on which the live
+// statistics of the broker are published.
+type SystemConfig struct {
+
+	// The number of seconds between the publications of the statistics. Defaults to 10 seconds.
+	Interval int `json:"interval,omitempty"`
+}
+
+// Period returns the configured interval between the publications of the statistics.
+func (c *SystemConfig) Period() time.Duration {
+	if c.Interval <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.Interval) * time.Second
+}
+
+// AuditConfig represents the configuration of the audit trail of the security-relevant
+// events, such as the generation of the keys, the rejected keys and the administrative
+// requests. The trail is written to each of the sinks configured.
+type AuditConfig struct {
+
+	// The file the events are appended to, one JSON document per line.
+	File string `json:"file,omitempty"`
+
+	// The channel the events are published on, under the contract of the license (e.g: "audit/").
+	Channel string `json:"channel,omitempty"`
+
+	// The URL of an HTTP endpoint each of the events is posted to.
+	URL string `json:"url,omitempty"`
+}
+
+// ProxyConfig represents the configuration of the PROXY protocol, with which the load
+// balancers in front of the broker send the address of the clients.
+type ProxyConfig struct {
+
+	// The comma-separated list of the networks (e.g: "10.0.0.0/8") or addresses of the load
+	// balancers allowed to send a PROXY protocol header, which is required.
+	Trusted string `json:"trusted,omitempty"`
+}
+
+// Networks returns the networks of the trusted load balancers. Since any client could
+// otherwise choose its own address, at least one of them is required.
+func (c *ProxyConfig) Networks() ([]*net.IPNet, error) {
+	networks, err := parseNetworks(c.Trusted)
+	if err == nil && len(networks) == 0 {
+		err = errors.New("config: proxy.trusted must list the load balancers allowed to send a PROXY protocol header")
+	}
+	return networks, err
+}
+
+// AccessConfig represents the configuration of the access control of the listeners.
+type AccessConfig struct {
+
+	// The comma-separated list of the networks (e.g: "10.0.0.0/8") or addresses allowed to
+	// connect. If not specified, any address which is not denied is allowed.
+	Allow string `json:"allow,omitempty"`
+
+	// The comma-separated list of the networks or addresses denied, which take precedence
+	// over the allowed ones.
+	Deny string `json:"deny,omitempty"`
+
+	// The networks or addresses allowed to connect to the secure listener, replacing the
+	// ones of "allow" on it if specified.
+	SecureAllow string `json:"secureAllow,omitempty"`
+
+	// The networks or addresses denied on the secure listener, replacing the ones of "deny"
+	// on it if specified.
+	SecureDeny string `json:"secureDeny,omitempty"`
+
+	// The maximum number of connections from a single address. If not specified, the
+	// connections are not limited per address.
+	MaxPerIP int `json:"maxPerIP,omitempty"`
+
+	// The maximum number of connections of a single contract. If not specified, the
+	// connections are not limited per contract.
+	MaxPerContract int `json:"maxPerContract,omitempty"`
+}
+
+// Lists returns the networks allowed and denied on a listener.
+func (c *AccessConfig) Lists(secure bool) (allow, deny []*net.IPNet, err error) {
+	allowed, denied := c.Allow, c.Deny
+	if secure && c.SecureAllow != "" {
+		allowed = c.SecureAllow
+	}
+	if secure && c.SecureDeny != "" {
+		denied = c.SecureDeny
+	}
+
+	if allow, err = parseNetworks(allowed); err == nil {
+		deny, err = parseNetworks(denied)
+	}
+	return
+}
+
+// parseNetworks parses a comma-separated list of networks or addresses, or returns nil if
+// the list is empty.
+func parseNetworks(list string) ([]*net.IPNet, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var networks []*net.IPNet
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// TracingConfig represents the configuration of the tracing of the publications with
+// OpenTelemetry, whose spans are exported to a collector over OTLP/HTTP.
+type TracingConfig struct {
+
+	// The address of the collector (e.g. "localhost:4318").
+	Endpoint string `json:"endpoint"`
+
+	// Whether the collector is reached over plain HTTP rather than HTTPS.
+	Insecure bool `json:"insecure,omitempty"`
+
+	// The fraction of the publications which are traced, between 0 and 1. Defaults to 1.
+	Ratio float64 `json:"ratio,omitempty"`
+}
+
+// SampleRatio returns the configured fraction of the publications which are traced.
+func (c *TracingConfig) SampleRatio() float64 {
+	if c.Ratio <= 0 || c.Ratio > 1 {
+		return 1
+	}
+	return c.Ratio
+}
+
+// ArchiveConfig represents the configuration of the archival of the stored messages into
+// an object storage, for long-term retention.
+type ArchiveConfig struct {
+
+	// The bucket to archive the messages to.
+	Bucket string `json:"bucket"`
+
+	// The prefix of the keys of the archived segments.
+	Prefix string `json:"prefix,omitempty"`
+
+	// The region of the bucket, if not specified by the environment.
+	Region string `json:"region,omitempty"`
+
+	// The endpoint of the object storage, for the ones other than AWS S3 (e.g: MinIO).
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// The number of seconds between the flushes of the messages. Defaults to 60 seconds.
+	Interval int `json:"interval,omitempty"`
+
+	// The number of pending messages which triggers a flush. Defaults to 10000.
+	BatchSize int `json:"batchSize,omitempty"`
+}
+
+// FlushPeriod returns the configured interval of the flushes.
+func (c *ArchiveConfig) FlushPeriod() time.Duration {
+	if c.Interval <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(c.Interval) * time.Second
+}
+
+// FlushSize returns the configured number of messages which triggers a flush.
+func (c *ArchiveConfig) FlushSize() int {
+	if c.BatchSize <= 0 {
+		return 10000
+	}
+	return c.BatchSize
+}
+
+// ScanConfig represents the configuration of the content scanning, which submits the
+// messages published on some channels to an external scanner (e.g: an antivirus).
+type ScanConfig struct {
+
+	// The HTTP endpoint the payloads are posted to. A 2xx status means that the content is
+	// clean, while 403, 406 or 451 mean that it was rejected.
+	URL string `json:"url"`
+
+	// The comma-separated list of channel patterns (e.g: "uploads/+/") carrying user content
+	// which needs to be scanned.
+	Channels string `json:"channels"`
+
+	// The policy of the scanning, either "retract" to deliver the messages right away and
+	// retract the rejected ones with a tombstone, or "hold" to deliver them once scanned.
+	Policy string `json:"policy,omitempty"`
+
+	// The number of seconds to wait for a verdict. Defaults to 10 seconds.
+	Timeout int `json:"timeout,omitempty"`
+
+	// The maximum number of messages scanned at once. Defaults to 16.
+	Concurrency int `json:"concurrency,omitempty"`
+
+	// Whether the messages are considered clean when the scanner fails to respond.
+	FailOpen bool `json:"failOpen,omitempty"`
+
+	// The comma-separated list of the message headers sent to the scanner, each optionally
+	// renamed (e.g: "trace,zone=region"). If not set, all of the headers are sent unchanged.
+	Headers string `json:"headers,omitempty"`
+}
+
+// HookConfig represents a script run on the messages published on some channels, which can
+// validate, transform, enrich or reject them before they are delivered.
+type HookConfig struct {
+
+	// The path of the Lua script, which defines an 'on_publish(msg)' function.
+	Script string `json:"script"`
+
+	// The comma-separated list of channel patterns (e.g: "sensors/+/") the script runs on.
+	Channels string `json:"channels"`
+
+	// The contract the script is restricted to. If not specified, it runs for all of them.
+	Contract uint32 `json:"contract,omitempty"`
+
+	// The number of milliseconds the script may run for each message. Defaults to 50.
+	Timeout int `json:"timeout,omitempty"`
+
+	// Whether the messages are published unchanged when the script fails, instead of being
+	// refused.
+	FailOpen bool `json:"failOpen,omitempty"`
+}
+
+// RuleConfig represents a routing rule, which applies an action to the messages published
+// on some channels: republishing them on another channel, forwarding them to an HTTP
+// endpoint, dropping them, tagging them with headers or sending them to a connector plugin.
+type RuleConfig struct {
+
+	// The comma-separated list of channel patterns (e.g: "sensors/+/") the rule applies to.
+	Channels string `json:"channels"`
+
+	// The contract the rule is restricted to. If not specified, it applies to all of them.
+	Contract uint32 `json:"contract,omitempty"`
+
+	// The action of the rule, either "republish", "forward", "drop", "tag" or "connector".
+	Action string `json:"action"`
+
+	// The static channel the messages are republished on (e.g: "alerts/sensors/").
+	Target string `json:"target,omitempty"`
+
+	// The HTTP endpoint the messages are forwarded to.
+	URL string `json:"url,omitempty"`
+
+	// The comma-separated list of the headers the messages are tagged with (e.g: "zone=eu").
+	Headers string `json:"headers,omitempty"`
+
+	// The name of the connector plugin the messages are sent to.
+	Connector string `json:"connector,omitempty"`
+
+	// Whether the following rules are skipped for the messages matching this one.
+	Final bool `json:"final,omitempty"`
+}
+
+// PluginConfig represents an external plugin binary, which extends the broker with any of an
+// authorizer, a message store, a connector and a hook.
+type PluginConfig struct {
+
+	// The name of the plugin, which the storage provider and the routing rules refer to.
+	Name string `json:"name"`
+
+	// The path of the plugin binary, which the broker starts and stops.
+	Path string `json:"path"`
+
+	// The hex-encoded SHA-256 checksum of the plugin binary, verified before it is started.
+	Checksum string `json:"checksum,omitempty"`
+
+	// The comma-separated list of channel patterns (e.g: "sensors/+/") the hook of the plugin
+	// runs on. If not specified, it runs on all of them.
+	Channels string `json:"channels,omitempty"`
+
+	// Whether the messages are published unchanged when the hook of the plugin fails, instead
+	// of being refused.
+	FailOpen bool `json:"failOpen,omitempty"`
+}
+
+// SigningConfig represents the configuration of the message signing, which lets the
+// subscribers verify that the messages they receive have transited the broker unmodified.
+type SigningConfig struct {
+
+	// The base64-encoded 32-byte ed25519 seed of the key of this node. If not specified, a
+	// new key is generated every time the node starts.
+	Key string `json:"key,omitempty"`
+}
+
+// FailoverConfig represents the retry guidance given to the clients when their connections
+// or requests are rejected because the node is overloaded or under maintenance.
+type FailoverConfig struct {
+
+	// The comma-separated list of alternate endpoints (e.g: other regions) the clients can
+	// reconnect to. This can also be changed at runtime through the administrative API.
+	Endpoints string `json:"endpoints,omitempty"`
+
+	// The number of seconds the clients should wait before retrying. Defaults to 5 seconds.
+	RetryAfter int `json:"retryAfter,omitempty"`
 }
 
 // LimitConfig represents various limit configurations - such as message size.
@@ -168,6 +1207,11 @@ type LimitConfig struct {
 	// Maximum message size allowed from/to the client. Default if not specified is 64kB.
 	MessageSize int `json:"messageSize,omitempty"`
 
+	// The maximum size, in bytes, of a message published in chunks, which is reassembled by
+	// the broker before being published. If not specified, the messages can not be published
+	// in chunks.
+	LargeMessageSize int `json:"largeMessageSize,omitempty"`
+
 	// The maximum messages per second allowed to be processed per client connection. This
 	// effectively restricts the QpS for an individual connection.
 	ReadRate int `json:"readRate,omitempty"`
@@ -175,8 +1219,125 @@ type LimitConfig struct {
 	// The maximum socket write rate per connection. This does not limit QpS but instead
 	// can be used to scale throughput. Defaults to 60.
 	FlushRate int `json:"flushRate,omitempty"`
+
+	// The scheduler lag, in milliseconds, above which the node starts shedding the low
+	// priority work: history queries first, then presence and finally the low priority
+	// publishes. If not specified, the load shedding is disabled.
+	SchedulerLag int `json:"schedulerLag,omitempty"`
+
+	// The number of workers delivering and storing the messages, shared fairly between the
+	// contracts in proportion to their tier. If not specified, the work is done inline.
+	SchedulerWorkers int `json:"schedulerWorkers,omitempty"`
+
+	// The size, in bytes, of the read buffer of each connection. Defaults to 64kB.
+	ReadBuffer int `json:"readBuffer,omitempty"`
+
+	// The percentage of the file descriptor limit of the process above which the new
+	// connections are refused, leaving the rest for the cluster links and the storage.
+	// Defaults to 90, while a negative value disables it.
+	Descriptors int `json:"descriptors,omitempty"`
+
+	// The number of new connections admitted per second before throttling them, which is
+	// halved for every overload level of the node. Defaults to 1000, while a negative value
+	// disables it.
+	ConnectRate int `json:"connectRate,omitempty"`
+
+	// The number of seconds without any incoming packet after which a connection is parked:
+	// its goroutine and read buffer are released while a single poller (epoll or kqueue)
+	// waits for it to become readable again. This only applies to the connections without
+	// TLS, on Linux and BSD. If not specified, the connections are never parked.
+	IdleAfter int `json:"idleAfter,omitempty"`
+
+	// The maximum number of messages queued for each connection while its socket is busy, so
+	// a slow client does not hold up the delivery to the others. If not specified, the
+	// messages are written to the socket by the publisher.
+	OutboundQueue int `json:"outboundQueue,omitempty"`
+
+	// The policy applied when the outbound queue of a connection is full: "drop-oldest" drops
+	// the oldest message queued, "drop-newest" the message being sent and "disconnect" closes
+	// the connection. Defaults to "drop-oldest".
+	OutboundPolicy string `json:"outboundPolicy,omitempty"`
+
+	// The number of seconds the outbound queue of a connection may stay full, without the
+	// client reading any of it, before the client is evicted as a slow consumer. This needs
+	// the outbound queue. If not specified, the slow consumers are not evicted.
+	SlowConsumer int `json:"slowConsumer,omitempty"`
+}
+
+// ReadBufferSize returns the configured size of the read buffer of a connection.
+func (c *LimitConfig) ReadBufferSize() int {
+	if c.ReadBuffer <= 0 {
+		return defaultReadBuffer
+	}
+	return c.ReadBuffer
+}
+
+// IdlePeriod returns the configured time after which an idle connection is parked, or zero
+// if disabled.
+func (c *LimitConfig) IdlePeriod() time.Duration {
+	if c.IdleAfter <= 0 {
+		return 0
+	}
+	return time.Duration(c.IdleAfter) * time.Second
+}
+
+// OverflowPolicy returns the configured policy applied when the outbound queue of a
+// connection is full.
+func (c *LimitConfig) OverflowPolicy() string {
+	switch c.OutboundPolicy {
+	case "drop-newest", "disconnect":
+		return c.OutboundPolicy
+	default:
+		return "drop-oldest"
+	}
 }
 
+// SlowConsumerPeriod returns the configured time the outbound queue of a connection may stay
+// full before the client is evicted, or zero if disabled.
+func (c *LimitConfig) SlowConsumerPeriod() time.Duration {
+	if c.SlowConsumer <= 0 {
+		return 0
+	}
+	return time.Duration(c.SlowConsumer) * time.Second
+}
+
+// DescriptorThreshold returns the configured share of the file descriptor limit above which
+// the new connections are refused, or zero if disabled.
+func (c *LimitConfig) DescriptorThreshold() float64 {
+	switch {
+	case c.Descriptors < 0:
+		return 0
+	case c.Descriptors == 0 || c.Descriptors > 100:
+		return 0.9
+	default:
+		return float64(c.Descriptors) / 100
+	}
+}
+
+// ConnectRateLimit returns the configured number of new connections admitted per second, or
+// zero if disabled.
+func (c *LimitConfig) ConnectRateLimit() int {
+	switch {
+	case c.ConnectRate < 0:
+		return 0
+	case c.ConnectRate == 0:
+		return 1000
+	default:
+		return c.ConnectRate
+	}
+}
+
+// SchedulerLagThreshold returns the configured scheduler lag threshold.
+func (c *LimitConfig) SchedulerLagThreshold() time.Duration {
+	if c.SchedulerLag <= 0 {
+		return 0
+	}
+	return time.Duration(c.SchedulerLag) * time.Millisecond
+}
+
+// Provider represents a provider which can be loaded from the configuration.
+type Provider = cfg.Provider
+
 // LoadProvider loads a provider from the configuration or panics if the configuration is
 // specified, but the provider was not found or not able to configure. This uses the first
 // provider as a default value.
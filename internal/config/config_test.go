@@ -15,9 +15,11 @@
 package config
 
 import (
+	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/emitter-io/config/dynamo"
 	"github.com/stretchr/testify/assert"
@@ -50,8 +52,278 @@ func Test_AddrInvalid(t *testing.T) {
 }
 
 func Test_New(t *testing.T) {
-	c := New("test.conf", dynamo.NewProvider())
+	c, err := New("test.conf", dynamo.NewProvider())
 	defer os.Remove("test.conf")
 
+	assert.NoError(t, err)
 	assert.NotNil(t, c)
 }
+
+func Test_New_Encrypted(t *testing.T) {
+	assert.NoError(t, ioutil.WriteFile("encrypted.conf", []byte(`{"license":"enc:abc"}`), 0644))
+	defer os.Remove("encrypted.conf")
+
+	// The values which can not be decrypted fail the configuration, without panicking
+	c, err := New("encrypted.conf")
+	assert.Error(t, err)
+	assert.Nil(t, c)
+}
+
+func Test_Reload(t *testing.T) {
+	c, err := New("reload.conf")
+	defer os.Remove("reload.conf")
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile("reload.conf", []byte(`{"listen":":8080","limit":{"readRate":10}}`), 0644))
+	next, err := c.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, 10, next.Limit.ReadRate)
+
+	_, err = NewDefault().(*Config).Reload()
+	assert.Equal(t, errNoSource, err)
+}
+
+func Test_ClusterKey(t *testing.T) {
+	c1 := &Config{License: "license-1", Cluster: &ClusterConfig{}}
+	c2 := &Config{License: "license-2", Cluster: &ClusterConfig{}}
+	c3 := &Config{License: "license-1", Cluster: &ClusterConfig{Passphrase: "secret"}}
+
+	assert.Len(t, c1.ClusterKey(), 32)
+	assert.Equal(t, c1.ClusterKey(), c1.ClusterKey())
+	assert.NotEqual(t, c1.ClusterKey(), c2.ClusterKey())
+	assert.NotEqual(t, c1.ClusterKey(), c3.ClusterKey())
+}
+
+func Test_FederationKey(t *testing.T) {
+	c1 := &Config{License: "license-1", Cluster: &ClusterConfig{}}
+	c2 := &Config{License: "license-1", Federation: &FederationConfig{Passphrase: "secret"}}
+
+	assert.Len(t, c1.FederationKey(), 32)
+	assert.Equal(t, c1.FederationKey(), c1.FederationKey())
+	assert.NotEqual(t, c1.FederationKey(), c1.ClusterKey())
+	assert.NotEqual(t, c1.FederationKey(), c2.FederationKey())
+}
+
+func Test_SchedulerLagThreshold(t *testing.T) {
+	assert.Equal(t, time.Duration(0), (&LimitConfig{}).SchedulerLagThreshold())
+	assert.Equal(t, time.Duration(0), (&LimitConfig{SchedulerLag: -5}).SchedulerLagThreshold())
+	assert.Equal(t, 150*time.Millisecond, (&LimitConfig{SchedulerLag: 150}).SchedulerLagThreshold())
+}
+
+func Test_HistoryRewind(t *testing.T) {
+	assert.Equal(t, time.Duration(0), (&HistoryConfig{}).RewindWindow())
+	assert.Equal(t, 5*time.Second, (&HistoryConfig{Rewind: 5}).RewindWindow())
+	assert.Equal(t, 16, (&HistoryConfig{RewindSize: -1}).RewindBuffer())
+	assert.Equal(t, 100, (&HistoryConfig{RewindSize: 100}).RewindBuffer())
+	assert.Equal(t, 5*time.Minute, (*HistoryConfig)(nil).EnforceInterval())
+	assert.Equal(t, 5*time.Minute, (&HistoryConfig{Enforce: -1}).EnforceInterval())
+	assert.Equal(t, 10*time.Second, (&HistoryConfig{Enforce: 10}).EnforceInterval())
+}
+
+func TestDedupConfig(t *testing.T) {
+	assert.Equal(t, time.Minute, (&DedupConfig{}).WindowPeriod())
+	assert.Equal(t, 5*time.Second, (&DedupConfig{Window: 5}).WindowPeriod())
+	assert.Equal(t, 100000, (&DedupConfig{Size: -1}).MaxSize())
+	assert.Equal(t, 10, (&DedupConfig{Size: 10}).MaxSize())
+}
+
+func TestFederationConfig_RegionEndpoints(t *testing.T) {
+	c := &FederationConfig{Regions: "eu=eu.example.com:8080, us=us.example.com:8080,invalid"}
+	assert.Equal(t, map[string]string{
+		"eu": "eu.example.com:8080",
+		"us": "us.example.com:8080",
+	}, c.RegionEndpoints())
+	assert.Empty(t, (&FederationConfig{}).RegionEndpoints())
+}
+
+func TestDeadLetterConfig(t *testing.T) {
+	assert.Equal(t, "deadletter/", (&DeadLetterConfig{}).Prefix())
+	assert.Equal(t, "dead/", (&DeadLetterConfig{Channel: "dead/"}).Prefix())
+	assert.Equal(t, uint32(86400), (&DeadLetterConfig{}).StoredFor())
+	assert.Equal(t, uint32(60), (&DeadLetterConfig{TTL: 60}).StoredFor())
+}
+
+func TestSyntheticConfig(t *testing.T) {
+	assert.Equal(t, time.Minute, (&SyntheticConfig{}).Window())
+	assert.Equal(t, 5*time.Second, (&SyntheticConfig{Interval: 5}).Window())
+}
+
+func TestLimitConfig_DescriptorThreshold(t *testing.T) {
+	assert.Equal(t, 0.9, (&LimitConfig{}).DescriptorThreshold())
+	assert.Equal(t, 0.8, (&LimitConfig{Descriptors: 80}).DescriptorThreshold())
+	assert.Equal(t, 0.9, (&LimitConfig{Descriptors: 200}).DescriptorThreshold())
+	assert.Equal(t, 0.0, (&LimitConfig{Descriptors: -1}).DescriptorThreshold())
+}
+
+func TestLimitConfig_ConnectRateLimit(t *testing.T) {
+	assert.Equal(t, 1000, (&LimitConfig{}).ConnectRateLimit())
+	assert.Equal(t, 50, (&LimitConfig{ConnectRate: 50}).ConnectRateLimit())
+	assert.Equal(t, 0, (&LimitConfig{ConnectRate: -1}).ConnectRateLimit())
+}
+
+func TestAnalyticsConfig(t *testing.T) {
+	assert.Equal(t, time.Minute, (&AnalyticsConfig{}).Period())
+	assert.Equal(t, 10*time.Second, (&AnalyticsConfig{Interval: 10}).Period())
+	assert.Equal(t, 7*24*time.Hour, (&AnalyticsConfig{}).MaxAge())
+	assert.Equal(t, time.Hour, (&AnalyticsConfig{Retention: 3600}).MaxAge())
+}
+
+func TestSystemConfig(t *testing.T) {
+	assert.Equal(t, 10*time.Second, (&SystemConfig{}).Period())
+	assert.Equal(t, time.Minute, (&SystemConfig{Interval: 60}).Period())
+}
+
+func TestTracingConfig(t *testing.T) {
+	assert.Equal(t, 1.0, (&TracingConfig{}).SampleRatio())
+	assert.Equal(t, 1.0, (&TracingConfig{Ratio: 2}).SampleRatio())
+	assert.Equal(t, 0.1, (&TracingConfig{Ratio: 0.1}).SampleRatio())
+}
+
+func TestSharedConfig(t *testing.T) {
+	assert.Equal(t, "/dev/shm/emitter", (&SharedConfig{}).Directory())
+	assert.Equal(t, "/tmp/rings", (&SharedConfig{Dir: "/tmp/rings"}).Directory())
+}
+
+func TestSnapshotConfig(t *testing.T) {
+	assert.Equal(t, 5*time.Minute, (&SnapshotConfig{}).Period())
+	assert.Equal(t, time.Minute, (&SnapshotConfig{Interval: 60}).Period())
+	assert.Equal(t, 288, (&SnapshotConfig{}).MaxCount())
+	assert.Equal(t, 10, (&SnapshotConfig{Retain: 10}).MaxCount())
+}
+
+func TestDelayConfig(t *testing.T) {
+	assert.Equal(t, 100000, (&DelayConfig{}).MaxCount())
+	assert.Equal(t, 10, (&DelayConfig{MaxPending: 10}).MaxCount())
+	assert.Equal(t, 7*24*time.Hour, (&DelayConfig{MaxDelay: -1}).MaxPeriod())
+	assert.Equal(t, time.Minute, (&DelayConfig{MaxDelay: 60}).MaxPeriod())
+}
+
+func TestSessionConfig(t *testing.T) {
+	assert.Equal(t, time.Hour, (*SessionConfig)(nil).ExpiryPeriod())
+	assert.Equal(t, time.Minute, (&SessionConfig{Expiry: 60}).ExpiryPeriod())
+
+	count, size := (*SessionConfig)(nil).QueueLimits()
+	assert.Equal(t, 1000, count)
+	assert.Equal(t, 1<<20, size)
+
+	count, size = (&SessionConfig{MaxMessages: 10, MaxBytes: 100}).QueueLimits()
+	assert.Equal(t, 10, count)
+	assert.Equal(t, 100, size)
+
+	policy, err := (*SessionConfig)(nil).TakeoverPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, TakeoverAllow, policy)
+
+	policy, err = (&SessionConfig{Takeover: "kick"}).TakeoverPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, TakeoverKick, policy)
+
+	_, err = (&SessionConfig{Takeover: "steal"}).TakeoverPolicy()
+	assert.Error(t, err)
+}
+
+func Test_LivenessPerListener(t *testing.T) {
+	listeners, err := (*LivenessConfig)(nil).PerListener()
+	assert.NoError(t, err)
+	assert.Empty(t, listeners)
+
+	listeners, err = (&LivenessConfig{
+		MaxKeepAlive: 60,
+		IdleTimeout:  30,
+		Listeners: map[string]*LivenessConfig{
+			"tls": {MaxKeepAlive: 600, SessionExpiry: 86400},
+		},
+	}).PerListener()
+	assert.NoError(t, err)
+	assert.Len(t, listeners, 4)
+	assert.Equal(t, LivenessConfig{MaxKeepAlive: 60, IdleTimeout: 30}, listeners["tcp"])
+	assert.Equal(t, LivenessConfig{MaxKeepAlive: 600, IdleTimeout: 30, SessionExpiry: 86400}, listeners["tls"])
+
+	_, err = (&LivenessConfig{MinKeepAlive: 60, MaxKeepAlive: 30}).PerListener()
+	assert.Error(t, err)
+
+	_, err = (&LivenessConfig{Listeners: map[string]*LivenessConfig{"ssl": {}}}).PerListener()
+	assert.Error(t, err)
+}
+
+func Test_WebsocketPerListener(t *testing.T) {
+	listeners, err := (*WebsocketConfig)(nil).PerListener()
+	assert.NoError(t, err)
+	assert.Empty(t, listeners)
+
+	listeners, err = (&WebsocketConfig{
+		Compression: true,
+		Listeners: map[string]*WebsocketConfig{
+			"tls": {Subprotocols: "mqtt", Strict: true},
+		},
+	}).PerListener()
+	assert.NoError(t, err)
+	assert.Equal(t, WebsocketConfig{Compression: true, CompressionThreshold: 128}, listeners["tcp"])
+	assert.Equal(t, WebsocketConfig{Subprotocols: "mqtt", Strict: true, CompressionThreshold: 128}, listeners["tls"])
+
+	_, err = (&WebsocketConfig{CompressionLevel: 10}).PerListener()
+	assert.Error(t, err)
+
+	_, err = (&WebsocketConfig{Listeners: map[string]*WebsocketConfig{"ssl": {}}}).PerListener()
+	assert.Error(t, err)
+
+	assert.Nil(t, (&WebsocketConfig{}).SubprotocolList())
+	assert.Equal(t, []string{"mqtt", "mqttv3.1"}, (&WebsocketConfig{Subprotocols: "mqtt, mqttv3.1"}).SubprotocolList())
+}
+
+func Test_ArchiveFlush(t *testing.T) {
+	assert.Equal(t, 60*time.Second, (&ArchiveConfig{}).FlushPeriod())
+	assert.Equal(t, 5*time.Second, (&ArchiveConfig{Interval: 5}).FlushPeriod())
+	assert.Equal(t, 10000, (&ArchiveConfig{BatchSize: -1}).FlushSize())
+	assert.Equal(t, 100, (&ArchiveConfig{BatchSize: 100}).FlushSize())
+}
+
+func Test_ProxyNetworks(t *testing.T) {
+	_, err := (&ProxyConfig{}).Networks()
+	assert.Error(t, err)
+
+	networks, err := (&ProxyConfig{Trusted: "10.0.0.0/8, 192.168.0.1,::1"}).Networks()
+	assert.NoError(t, err)
+	assert.Len(t, networks, 3)
+	assert.Equal(t, "10.0.0.0/8", networks[0].String())
+	assert.Equal(t, "192.168.0.1/32", networks[1].String())
+	assert.Equal(t, "::1/128", networks[2].String())
+
+	_, err = (&ProxyConfig{Trusted: "invalid"}).Networks()
+	assert.Error(t, err)
+}
+
+func Test_AccessLists(t *testing.T) {
+	c := &AccessConfig{Allow: "10.0.0.0/8", Deny: "10.0.0.1", SecureDeny: "192.168.0.0/16"}
+	allow, deny, err := c.Lists(false)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/8", allow[0].String())
+	assert.Equal(t, "10.0.0.1/32", deny[0].String())
+
+	allow, deny, err = c.Lists(true)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/8", allow[0].String())
+	assert.Equal(t, "192.168.0.0/16", deny[0].String())
+
+	_, _, err = (&AccessConfig{Deny: "invalid"}).Lists(false)
+	assert.Error(t, err)
+}
+
+func Test_UnixSocket(t *testing.T) {
+	c := &UnixConfig{}
+	mode, err := c.FileMode()
+	assert.NoError(t, err)
+	assert.Equal(t, "emitter.sock", c.SocketPath())
+	assert.Equal(t, os.FileMode(0660), mode)
+
+	c = &UnixConfig{Path: "/run/emitter.sock", Mode: "0600"}
+	mode, err = c.FileMode()
+	assert.NoError(t, err)
+	assert.Equal(t, "/run/emitter.sock", c.SocketPath())
+	assert.Equal(t, os.FileMode(0600), mode)
+
+	_, err = (&UnixConfig{Mode: "rw"}).FileMode()
+	assert.Error(t, err)
+	_, err = (&UnixConfig{Mode: "1777"}).FileMode()
+	assert.Error(t, err)
+}
@@ -0,0 +1,266 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "EMITTER_" // The prefix of the environment variables overriding the configuration.
+
+var (
+	errUnknownField = errors.New("no such field")
+	errNotValue     = errors.New("the field is a section, not a value")
+)
+
+// Field represents a configuration field, along with the ways of overriding it.
+type Field struct {
+	Path string // The path of the field, e.g: "limit.readRate".
+	Env  string // The environment variable which overrides the field.
+	Type string // The type of the value of the field.
+}
+
+// Fields returns every field of the configuration which can be overridden, generated from
+// the configuration structures. The entries of the provider configurations are named with
+// a "<key>" placeholder.
+func Fields() []Field {
+	var fields []Field
+	collectFields(reflect.TypeOf(Config{}), "", &fields)
+	return fields
+}
+
+// collectFields appends the fields of a configuration structure.
+func collectFields(t reflect.Type, prefix string, fields *[]Field) {
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonName(t.Field(i))
+		if name == "" {
+			continue
+		}
+
+		path, typ := prefix+name, t.Field(i).Type
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+
+		switch typ.Kind() {
+		case reflect.Struct:
+			collectFields(typ, path+".", fields)
+		case reflect.Map:
+			*fields = append(*fields, newField(path, "json"), newField(path+".<key>", "any"))
+		case reflect.Slice:
+			*fields = append(*fields, newField(path, "json"))
+		case reflect.Int, reflect.Int64:
+			*fields = append(*fields, newField(path, "int"))
+		case reflect.Float64:
+			*fields = append(*fields, newField(path, "float"))
+		default:
+			*fields = append(*fields, newField(path, typ.Kind().String()))
+		}
+	}
+}
+
+// newField creates a new field description for a path.
+func newField(path, typ string) Field {
+	return Field{
+		Path: path,
+		Env:  envPrefix + strings.ToUpper(strings.Replace(path, ".", "_", -1)),
+		Type: typ,
+	}
+}
+
+// Set overrides the configuration with assignments of the form "path=value", for example
+// "limit.readRate=1000" or "storage.config.dir=/data". The sections and the maps are set
+// from JSON values. The assignments are kept and applied again when the configuration is
+// reloaded.
+func (c *Config) Set(assignments ...string) error {
+	for _, assignment := range assignments {
+		i := strings.IndexByte(assignment, '=')
+		if i <= 0 {
+			return fmt.Errorf("config: invalid assignment '%s', expected 'path=value'", assignment)
+		}
+
+		path := strings.Split(assignment[:i], ".")
+		if err := assign(reflect.ValueOf(c).Elem(), path, ".", assignment[i+1:]); err != nil {
+			return fmt.Errorf("config: unable to set '%s', due to %s", assignment[:i], err.Error())
+		}
+	}
+
+	c.assignments = append(c.assignments, assignments...)
+	return c.Decrypt()
+}
+
+// applyEnv overrides the configuration with the environment variables prefixed with
+// "EMITTER_", which name the path of a field in upper case with the dots replaced by
+// underscores, e.g: "EMITTER_LIMIT_READRATE". The variables which do not name a field
+// are ignored, as well as the strings, integers and whole maps which were already read
+// along with the secret stores, so that the stores keep overriding them.
+func (c *Config) applyEnv(environ []string) error {
+	for _, kv := range environ {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 || !strings.HasPrefix(kv, envPrefix) {
+			continue
+		}
+
+		path := strings.Split(kv[len(envPrefix):i], "_")
+		switch kindOf(reflect.TypeOf(c), path) {
+		case reflect.String, reflect.Int, reflect.Map:
+			continue
+		}
+
+		switch err := assign(reflect.ValueOf(c).Elem(), path, "_", kv[i+1:]); err {
+		case nil, errUnknownField, errNotValue:
+		default:
+			return fmt.Errorf("config: unable to apply '%s', due to %s", kv[:i], err.Error())
+		}
+	}
+	return nil
+}
+
+// kindOf returns the kind of the field at the path, matched case-insensitively. The entries
+// of the maps are of the interface kind.
+func kindOf(typ reflect.Type, path []string) reflect.Kind {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch {
+	case len(path) == 0:
+		return typ.Kind()
+	case typ.Kind() == reflect.Map:
+		return reflect.Interface
+	case typ.Kind() == reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if name := jsonName(typ.Field(i)); name != "" && strings.EqualFold(name, path[0]) {
+				return kindOf(typ.Field(i).Type, path[1:])
+			}
+		}
+	}
+	return reflect.Invalid
+}
+
+// assign sets the field at the path, matched case-insensitively, to the value parsed. The
+// sections are only created once a field within them is set.
+func assign(value reflect.Value, path []string, sep, raw string) error {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			return assign(value.Elem(), path, sep, raw)
+		}
+
+		created := reflect.New(value.Type().Elem())
+		if err := assign(created.Elem(), path, sep, raw); err != nil {
+			return err
+		}
+
+		value.Set(created)
+		return nil
+
+	case reflect.Struct:
+		if len(path) == 0 {
+			return errNotValue
+		}
+
+		for i := 0; i < value.NumField(); i++ {
+			if name := jsonName(value.Type().Field(i)); name != "" && strings.EqualFold(name, path[0]) {
+				return assign(value.Field(i), path[1:], sep, raw)
+			}
+		}
+		return errUnknownField
+
+	case reflect.Map:
+		if len(path) > 0 {
+			return assignEntry(value, strings.Join(path, sep), raw)
+		}
+	}
+
+	if len(path) > 0 {
+		return errUnknownField
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(v)
+	case reflect.Int, reflect.Int64:
+		v, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(v)
+	case reflect.Float64:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(v)
+	case reflect.Slice, reflect.Map:
+		parsed := reflect.New(value.Type())
+		if err := json.Unmarshal([]byte(raw), parsed.Interface()); err != nil {
+			return err
+		}
+		value.Set(parsed.Elem())
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// assignEntry sets an entry of a provider configuration. Since the environment variables
+// are upper case, an existing entry is matched case-insensitively and a new upper case
+// entry is lowered. The value is parsed as JSON if possible, so numbers and booleans keep
+// their type, or kept as a string.
+func assignEntry(value reflect.Value, key, raw string) error {
+	if value.IsNil() {
+		value.Set(reflect.MakeMap(value.Type()))
+	}
+
+	if key == strings.ToUpper(key) {
+		key = strings.ToLower(key)
+	}
+
+	for _, k := range value.MapKeys() {
+		if strings.EqualFold(k.String(), key) {
+			key = k.String()
+		}
+	}
+
+	var entry interface{} = raw
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		entry = raw
+	}
+
+	value.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(&entry).Elem())
+	return nil
+}
+
+// jsonName returns the name of a field in the configuration file, or an empty string if
+// the field is not part of it.
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,87 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFields(t *testing.T) {
+	fields := Fields()
+	assert.Contains(t, fields, Field{Path: "limit.readRate", Env: "EMITTER_LIMIT_READRATE", Type: "int"})
+	assert.Contains(t, fields, Field{Path: "debug", Env: "EMITTER_DEBUG", Type: "bool"})
+	assert.Contains(t, fields, Field{Path: "tls.certificate", Env: "EMITTER_TLS_CERTIFICATE", Type: "string"})
+	assert.Contains(t, fields, Field{Path: "storage.config.<key>", Env: "EMITTER_STORAGE_CONFIG_<KEY>", Type: "any"})
+	assert.Contains(t, fields, Field{Path: "synthetic", Env: "EMITTER_SYNTHETIC", Type: "json"})
+}
+
+func TestSet(t *testing.T) {
+	c := NewDefault().(*Config)
+	assert.NoError(t, c.Set(
+		"debug=true",
+		"limit.readRate=42",
+		"storage.config.dir=/data",
+		"storage.config.maxItems=10",
+		"failover.endpoints=a:8080,b:8080",
+		`synthetic=[{"channel":"a/"}]`,
+	))
+
+	assert.True(t, c.Debug)
+	assert.Equal(t, 42, c.Limit.ReadRate)
+	assert.Equal(t, "/data", c.Storage.Config["dir"])
+	assert.Equal(t, float64(10), c.Storage.Config["maxItems"])
+	assert.Equal(t, "a:8080,b:8080", c.Failover.Endpoints)
+	assert.Len(t, c.Synthetic, 1)
+	assert.Equal(t, []string{"debug=true", "limit.readRate=42", "storage.config.dir=/data",
+		"storage.config.maxItems=10", "failover.endpoints=a:8080,b:8080", `synthetic=[{"channel":"a/"}]`}, c.assignments)
+
+	// The sections are only created when a field within them is set
+	assert.Nil(t, c.Audit)
+	assert.Error(t, c.Set("audit.unknown=1"))
+	assert.Nil(t, c.Audit)
+
+	assert.Error(t, c.Set("limit.readRate=fast"))
+	assert.Error(t, c.Set("limit"))
+	assert.Error(t, c.Set("limit=1"))
+}
+
+func TestApplyEnv(t *testing.T) {
+	c := NewDefault().(*Config)
+	c.Storage.Config = map[string]interface{}{"maxItems": 1}
+	assert.NoError(t, c.applyEnv([]string{
+		"PATH=/bin",
+		"EMITTER_DEBUG=1",
+		"EMITTER_LIMIT_MESSAGESIZE=1024",
+		"EMITTER_DELAY_MAXDELAY=60",
+		"EMITTER_TRACING_RATIO=0.5",
+		"EMITTER_STORAGE_CONFIG_MAXITEMS=5",
+		"EMITTER_STORAGE_CONFIG_DIR=/data",
+		"EMITTER_UNKNOWN=1",
+		"EMITTER_CLUSTER=1",
+	}))
+
+	assert.True(t, c.Debug)
+	assert.Equal(t, int64(60), c.Delay.MaxDelay)
+	assert.Equal(t, 0.5, c.Tracing.Ratio)
+
+	// The strings and integers were already read in the order of the secret stores
+	assert.Equal(t, 0, c.Limit.MessageSize)
+	assert.Equal(t, float64(5), c.Storage.Config["maxItems"])
+	assert.Equal(t, "/data", c.Storage.Config["dir"])
+
+	assert.Error(t, c.applyEnv([]string{"EMITTER_DEBUG=maybe"}))
+}
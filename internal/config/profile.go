@@ -0,0 +1,148 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	mb = 1 << 20
+	gb = 1 << 30
+)
+
+// Profile represents a predefined set of resource settings suited to a class of hosts,
+// from the Raspberry-Pi-class gateways to the large dedicated servers.
+type Profile struct {
+	Name             string // The name of the profile.
+	ReadBuffer       int    // The size of the read buffer of each connection, in bytes.
+	SchedulerWorkers int    // The number of workers of the scheduler.
+	RewindSize       int    // The number of recent messages kept per channel for the rewinds.
+	StorageSize      int    // The maximum size of the SSD storage, in megabytes.
+	GCPercent        int    // The garbage collection target percentage.
+	MinMemory        uint64 // The minimum memory of the host the profile is suited to.
+	MaxMemory        uint64 // The maximum memory of the host the profile is suited to.
+}
+
+// The predefined resource profiles.
+var profiles = map[string]Profile{
+	"tiny": {
+		Name:             "tiny",
+		ReadBuffer:       4096,
+		SchedulerWorkers: 1,
+		RewindSize:       4,
+		StorageSize:      64,
+		GCPercent:        50,
+		MaxMemory:        512 * mb,
+	},
+	"edge": {
+		Name:             "edge",
+		ReadBuffer:       16384,
+		SchedulerWorkers: 2,
+		RewindSize:       8,
+		StorageSize:      512,
+		GCPercent:        75,
+		MinMemory:        256 * mb,
+		MaxMemory:        4 * gb,
+	},
+	"standard": {
+		Name:       "standard",
+		ReadBuffer: defaultReadBuffer,
+		RewindSize: 16,
+		GCPercent:  100,
+		MinMemory:  1 * gb,
+	},
+	"large": {
+		Name:             "large",
+		ReadBuffer:       defaultReadBuffer,
+		SchedulerWorkers: 32,
+		RewindSize:       64,
+		GCPercent:        200,
+		MinMemory:        8 * gb,
+	},
+}
+
+// LookupProfile returns the predefined resource profile of the specified name.
+func LookupProfile(name string) (Profile, bool) {
+	p, ok := profiles[strings.ToLower(strings.TrimSpace(name))]
+	return p, ok
+}
+
+// Apply sets the settings of the profile which were not explicitly configured, so the
+// configuration always overrides the profile.
+func (p *Profile) Apply(c *Config) {
+	if c.Limit.ReadBuffer <= 0 {
+		c.Limit.ReadBuffer = p.ReadBuffer
+	}
+	if c.Limit.SchedulerWorkers <= 0 {
+		c.Limit.SchedulerWorkers = p.SchedulerWorkers
+	}
+	if c.History != nil && c.History.RewindSize <= 0 {
+		c.History.RewindSize = p.RewindSize
+	}
+
+	// Bound the size of the local storage, unless specified
+	if c.Storage != nil && c.Storage.Provider == "ssd" && p.StorageSize > 0 {
+		if c.Storage.Config == nil {
+			c.Storage.Config = make(map[string]interface{})
+		}
+		if _, ok := c.Storage.Config["maxSize"]; !ok {
+			c.Storage.Config["maxSize"] = float64(p.StorageSize)
+		}
+	}
+}
+
+// Verify checks whether the memory of the host matches the profile and returns the
+// warnings to report if it does not.
+func (p *Profile) Verify(memory uint64) (warnings []string) {
+	if p.MinMemory > 0 && memory < p.MinMemory {
+		warnings = append(warnings, fmt.Sprintf("the host has %dMB of memory while the '%s' profile expects at least %dMB, consider a smaller profile",
+			memory/mb, p.Name, p.MinMemory/mb))
+	}
+	if p.MaxMemory > 0 && memory > p.MaxMemory {
+		warnings = append(warnings, fmt.Sprintf("the host has %dMB of memory while the '%s' profile is meant for up to %dMB, consider a larger profile",
+			memory/mb, p.Name, p.MaxMemory/mb))
+	}
+	return
+}
+
+// HostMemory returns the total memory of the host, if it can be determined.
+func HostMemory() (uint64, bool) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+
+	defer f.Close()
+	return parseMemInfo(f)
+}
+
+// parseMemInfo parses the total memory out of the content of /proc/meminfo.
+func parseMemInfo(r io.Reader) (uint64, bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			return kb * 1024, err == nil
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,88 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	cfg "github.com/emitter-io/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupProfile(t *testing.T) {
+	for _, name := range []string{"tiny", "edge", "standard", "large", " Edge "} {
+		p, ok := LookupProfile(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, strings.ToLower(strings.TrimSpace(name)), p.Name)
+		assert.NotZero(t, p.ReadBuffer)
+		assert.NotZero(t, p.GCPercent)
+	}
+
+	_, ok := LookupProfile("huge")
+	assert.False(t, ok)
+}
+
+func TestProfile_Apply(t *testing.T) {
+	c := &Config{
+		Limit:   LimitConfig{SchedulerWorkers: 4},
+		History: &HistoryConfig{},
+		Storage: &cfg.ProviderConfig{Provider: "ssd"},
+	}
+
+	p, _ := LookupProfile("tiny")
+	p.Apply(c)
+	assert.Equal(t, 4096, c.Limit.ReadBufferSize())
+	assert.Equal(t, 4, c.Limit.SchedulerWorkers)
+	assert.Equal(t, 4, c.History.RewindBuffer())
+	assert.Equal(t, float64(64), c.Storage.Config["maxSize"])
+
+	// The explicit settings are kept
+	c.Storage.Config["maxSize"] = float64(10)
+	p, _ = LookupProfile("large")
+	p.Apply(c)
+	assert.Equal(t, 4096, c.Limit.ReadBufferSize())
+	assert.Equal(t, 4, c.Limit.SchedulerWorkers)
+	assert.Equal(t, float64(10), c.Storage.Config["maxSize"])
+}
+
+func TestProfile_Verify(t *testing.T) {
+	tests := []struct {
+		profile  string
+		memory   uint64
+		warnings int
+	}{
+		{profile: "tiny", memory: 256 * mb},
+		{profile: "tiny", memory: 16 * gb, warnings: 1},
+		{profile: "edge", memory: 128 * mb, warnings: 1},
+		{profile: "edge", memory: 2 * gb},
+		{profile: "standard", memory: 512 * mb, warnings: 1},
+		{profile: "large", memory: 64 * gb},
+	}
+
+	for _, tc := range tests {
+		p, _ := LookupProfile(tc.profile)
+		assert.Len(t, p.Verify(tc.memory), tc.warnings, tc.profile)
+	}
+}
+
+func TestParseMemInfo(t *testing.T) {
+	memory, ok := parseMemInfo(strings.NewReader("MemTotal:        3884376 kB\nMemFree:          140592 kB\n"))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3884376*1024), memory)
+
+	_, ok = parseMemInfo(strings.NewReader("MemFree:          140592 kB\n"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,158 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const consulWait = 5 * time.Minute // The maximum time a watch of Consul blocks for.
+
+// Consul represents a secret store which reads the configuration from the key-value store
+// of Consul, for example "emitter/limit/readRate" for the read rate limit. The changes are
+// watched with blocking queries.
+type Consul struct {
+	noCache
+	sync.Mutex
+	values  values       // The values read from the store.
+	client  *http.Client // The HTTP client to use.
+	address string       // The address of the Consul agent.
+	token   string       // The ACL token, if any.
+	index   uint64       // The index of the last blocking query.
+}
+
+// NewConsul creates a new Consul secret store.
+func NewConsul() *Consul {
+	return &Consul{
+		client: new(http.Client),
+	}
+}
+
+// Name returns the name of the secret store.
+func (p *Consul) Name() string {
+	return "consul"
+}
+
+// Configure configures the secret store and reads the keys of its prefix.
+func (p *Consul) Configure(config map[string]interface{}) error {
+	if config == nil {
+		return errors.New("unable to configure Consul provider, no configuration provided")
+	}
+
+	p.Lock()
+	p.address = stringOf(config, "address", "http://127.0.0.1:8500")
+	p.token = stringOf(config, "token", "")
+	p.index = 0
+	p.Unlock()
+
+	p.values.Lock()
+	p.values.prefix = stringOf(config, "prefix", defaultPrefix)
+	p.values.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	_, err := p.refresh(ctx)
+	return err
+}
+
+// GetSecret retrieves a secret from the store.
+func (p *Consul) GetSecret(secretName string) (string, bool) {
+	return p.values.get(secretName)
+}
+
+// Watch watches the keys of the store until the context is cancelled, calling the function
+// whenever they change.
+func (p *Consul) Watch(ctx context.Context, onChange func()) {
+	p.Lock()
+	address := p.address
+	p.Unlock()
+	if address == "" {
+		return // Not configured
+	}
+
+	watch(ctx, p.Name(), time.Second, func(ctx context.Context) (bool, error) {
+		ctx, cancel := context.WithTimeout(ctx, consulWait+fetchTimeout)
+		defer cancel()
+		return p.refresh(ctx)
+	}, onChange)
+}
+
+// refresh reads the keys of the prefix, blocking until they change once they were read.
+func (p *Consul) refresh(ctx context.Context) (bool, error) {
+	p.Lock()
+	address, token, index := p.address, p.token, p.index
+	p.Unlock()
+
+	query := url.Values{"recurse": {"true"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWait.String())
+	}
+
+	req, err := http.NewRequest("GET", address+"/v1/kv/"+p.values.root()+"?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	// No key under the prefix is not an error, the configuration is simply not overridden
+	var pairs []struct {
+		Key   string
+		Value []byte
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+			return false, err
+		}
+	case http.StatusNotFound:
+	default:
+		return false, fmt.Errorf("consul responded with %s", resp.Status)
+	}
+
+	// Keep the index for the next blocking query, which starts over if it went backwards
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if next < index {
+		next = 0
+	}
+
+	p.Lock()
+	p.index = next
+	p.Unlock()
+
+	entries := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		entries[pair.Key] = string(pair.Value)
+	}
+	return p.values.replace(entries), nil
+}
@@ -0,0 +1,198 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var errUnauthorized = errors.New("etcd responded with 401 Unauthorized")
+
+// Etcd represents a secret store which reads the configuration from etcd through its v3
+// JSON gateway, for example "emitter/limit/readRate" for the read rate limit. The changes
+// are watched by reading the keys periodically.
+type Etcd struct {
+	noCache
+	sync.Mutex
+	values   values        // The values read from the store.
+	client   *http.Client  // The HTTP client to use.
+	address  string        // The address of the etcd gateway.
+	username string        // The username, if authentication is enabled.
+	password string        // The password, if authentication is enabled.
+	token    string        // The authentication token, once authenticated.
+	interval time.Duration // The interval between the reads of a watch.
+}
+
+// NewEtcd creates a new etcd secret store.
+func NewEtcd() *Etcd {
+	return &Etcd{
+		client: new(http.Client),
+	}
+}
+
+// Name returns the name of the secret store.
+func (p *Etcd) Name() string {
+	return "etcd"
+}
+
+// Configure configures the secret store and reads the keys of its prefix.
+func (p *Etcd) Configure(config map[string]interface{}) error {
+	if config == nil {
+		return errors.New("unable to configure etcd provider, no configuration provided")
+	}
+
+	p.Lock()
+	p.address = stringOf(config, "address", "http://127.0.0.1:2379")
+	p.username = stringOf(config, "username", "")
+	p.password = stringOf(config, "password", "")
+	p.token = ""
+	p.interval = 10 * time.Second
+	if v, ok := config["interval"].(float64); ok && v > 0 {
+		p.interval = time.Duration(v) * time.Second
+	}
+	p.Unlock()
+
+	p.values.Lock()
+	p.values.prefix = stringOf(config, "prefix", defaultPrefix)
+	p.values.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	_, err := p.refresh(ctx)
+	return err
+}
+
+// GetSecret retrieves a secret from the store.
+func (p *Etcd) GetSecret(secretName string) (string, bool) {
+	return p.values.get(secretName)
+}
+
+// Watch watches the keys of the store until the context is cancelled, calling the function
+// whenever they change.
+func (p *Etcd) Watch(ctx context.Context, onChange func()) {
+	p.Lock()
+	address, interval := p.address, p.interval
+	p.Unlock()
+	if address == "" {
+		return // Not configured
+	}
+
+	watch(ctx, p.Name(), interval, func(ctx context.Context) (bool, error) {
+		ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+		return p.refresh(ctx)
+	}, onChange)
+}
+
+// refresh reads the keys of the prefix, returning whether they changed.
+func (p *Etcd) refresh(ctx context.Context) (bool, error) {
+	root := p.values.root()
+	var out struct {
+		Kvs []struct {
+			Key   []byte `json:"key"`
+			Value []byte `json:"value"`
+		} `json:"kvs"`
+	}
+
+	// The range of the prefix ends right after it, with its last byte incremented
+	end := []byte(root)
+	end[len(end)-1]++
+	if err := p.call(ctx, "/v3/kv/range", map[string][]byte{
+		"key":       []byte(root),
+		"range_end": end,
+	}, &out); err != nil {
+		return false, err
+	}
+
+	entries := make(map[string]string, len(out.Kvs))
+	for _, kv := range out.Kvs {
+		entries[string(kv.Key)] = string(kv.Value)
+	}
+	return p.values.replace(entries), nil
+}
+
+// call posts a request to the gateway, authenticating first if required.
+func (p *Etcd) call(ctx context.Context, path string, in, out interface{}) error {
+	p.Lock()
+	address, username, password, token := p.address, p.username, p.password, p.token
+	p.Unlock()
+
+	if username != "" && token == "" {
+		var auth struct {
+			Token string `json:"token"`
+		}
+
+		if err := p.post(ctx, address+"/v3/auth/authenticate", "", map[string]string{
+			"name":     username,
+			"password": password,
+		}, &auth); err != nil {
+			return err
+		}
+
+		token = auth.Token
+		p.Lock()
+		p.token = token
+		p.Unlock()
+	}
+
+	// An expired token is dropped, so the next call authenticates again
+	err := p.post(ctx, address+path, token, in, out)
+	if err == errUnauthorized {
+		p.Lock()
+		p.token = ""
+		p.Unlock()
+	}
+	return err
+}
+
+// post posts a JSON request and decodes its JSON response.
+func (p *Etcd) post(ctx context.Context, endpoint, token string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(resp.Body).Decode(out)
+	case http.StatusUnauthorized:
+		return errUnauthorized
+	default:
+		return fmt.Errorf("etcd responded with %s", resp.Status)
+	}
+}
@@ -0,0 +1,146 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	defaultPrefix = "emitter"        // The prefix of the keys, which is the prefix of the secrets.
+	retryInterval = 5 * time.Second  // The interval between the attempts of a failed watch.
+	fetchTimeout  = 10 * time.Second // The timeout of a single read of the keys.
+)
+
+// values represents the keys read from a remote key-value store, shared by the providers.
+// The whole prefix is read at once, so the configuration does not issue a request for
+// each of its fields.
+type values struct {
+	sync.RWMutex
+	prefix  string            // The prefix of the keys, replacing the "emitter" of the secret names.
+	entries map[string]string // The values, by their lower case key.
+	version string            // The version of the values, which changes with any of them.
+}
+
+// root returns the prefix of the keys, to be read along with everything under it.
+func (v *values) root() string {
+	v.RLock()
+	defer v.RUnlock()
+	return strings.TrimSuffix(v.prefix, "/") + "/"
+}
+
+// key returns the lower case key of a secret in the store.
+func (v *values) key(secretName string) string {
+	name := strings.TrimPrefix(strings.TrimPrefix(secretName, defaultPrefix), "/")
+	return strings.ToLower(v.root() + name)
+}
+
+// get returns the value of a secret.
+func (v *values) get(secretName string) (string, bool) {
+	key := v.key(secretName)
+
+	v.RLock()
+	defer v.RUnlock()
+	value, ok := v.entries[key]
+	return value, ok
+}
+
+// replace replaces the values, returning whether they changed since the last time.
+func (v *values) replace(entries map[string]string) bool {
+	normalized := make(map[string]string, len(entries))
+	for k, value := range entries {
+		normalized[strings.ToLower(k)] = value
+	}
+
+	version := versionOf(normalized)
+	v.Lock()
+	defer v.Unlock()
+	changed := v.entries != nil && v.version != version
+	v.entries = normalized
+	v.version = version
+	return changed
+}
+
+// versionOf computes a hash of the entries, which changes with any of them.
+func versionOf(entries map[string]string) string {
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(entries[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// watch repeatedly refreshes the values until the context is cancelled, calling the
+// function whenever they change. A refresh may block until a change happens.
+func watch(ctx context.Context, name string, interval time.Duration, refresh func(context.Context) (bool, error), onChange func()) {
+	go func() {
+		for ctx.Err() == nil {
+			changed, err := refresh(ctx)
+			switch {
+			case err != nil && ctx.Err() == nil:
+				logging.LogError(name, "watching the configuration", err)
+				sleep(ctx, retryInterval)
+				continue
+			case changed:
+				logging.LogAction(name, "configuration changed")
+				onChange()
+			}
+
+			sleep(ctx, interval)
+		}
+	}()
+}
+
+// sleep waits for the duration or until the context is cancelled.
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// noCache is embedded by the providers, which do not cache the certificates.
+type noCache struct{}
+
+// GetCache returns no certificate cache, the providers only read the secrets.
+func (noCache) GetCache() (autocert.Cache, bool) {
+	return nil, false
+}
+
+// stringOf reads a string of the provider configuration, or returns the default value.
+func stringOf(config map[string]interface{}, key, defaultValue string) string {
+	if v, ok := config[key].(string); ok && v != "" {
+		return v
+	}
+	return defaultValue
+}
@@ -0,0 +1,328 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newConsulServer creates a fake Consul agent serving the keys.
+func newConsulServer(keys *sync.Map) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if r.URL.Path != "/v1/kv/fleet/" || r.URL.Query().Get("recurse") != "true" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var pairs []map[string]interface{}
+		keys.Range(func(k, v interface{}) bool {
+			pairs = append(pairs, map[string]interface{}{"Key": k, "Value": []byte(v.(string))})
+			return true
+		})
+
+		w.Header().Set("X-Consul-Index", "7")
+		json.NewEncoder(w).Encode(pairs)
+	}))
+}
+
+func TestConsul(t *testing.T) {
+	keys := new(sync.Map)
+	keys.Store("fleet/license", "abc")
+	keys.Store("fleet/limit/readRate", "100")
+	server := newConsulServer(keys)
+	defer server.Close()
+
+	p := NewConsul()
+	assert.Equal(t, "consul", p.Name())
+	assert.Error(t, p.Configure(nil))
+	assert.Error(t, p.Configure(map[string]interface{}{"address": server.URL, "prefix": "fleet"}))
+	assert.NoError(t, p.Configure(map[string]interface{}{
+		"address": server.URL,
+		"prefix":  "fleet",
+		"token":   "secret",
+	}))
+
+	v, ok := p.GetSecret("emitter/license")
+	assert.True(t, ok)
+	assert.Equal(t, "abc", v)
+
+	v, ok = p.GetSecret("emitter/limit/readRate")
+	assert.True(t, ok)
+	assert.Equal(t, "100", v)
+
+	_, ok = p.GetSecret("emitter/cluster/seed")
+	assert.False(t, ok)
+
+	_, ok = p.GetCache()
+	assert.False(t, ok)
+
+	// The next query blocks from the index returned
+	assert.Equal(t, uint64(7), p.index)
+	keys.Store("fleet/limit/readRate", "200")
+	changed, err := p.refresh(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	v, _ = p.GetSecret("emitter/limit/readRate")
+	assert.Equal(t, "200", v)
+}
+
+func TestEtcd(t *testing.T) {
+	keys := map[string]string{"emitter/limit/readRate": "100"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/auth/authenticate":
+			json.NewEncoder(w).Encode(map[string]string{"token": "token-1"})
+		case "/v3/kv/range":
+			if r.Header.Get("Authorization") != "token-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			var in map[string][]byte
+			json.NewDecoder(r.Body).Decode(&in)
+			assert.Equal(t, "emitter/", string(in["key"]))
+			assert.Equal(t, "emitter0", string(in["range_end"]))
+
+			var kvs []map[string][]byte
+			for k, v := range keys {
+				kvs = append(kvs, map[string][]byte{"key": []byte(k), "value": []byte(v)})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"kvs": kvs})
+		}
+	}))
+	defer server.Close()
+
+	p := NewEtcd()
+	assert.Equal(t, "etcd", p.Name())
+	assert.Error(t, p.Configure(map[string]interface{}{"address": server.URL}))
+	assert.NoError(t, p.Configure(map[string]interface{}{
+		"address":  server.URL,
+		"username": "emitter",
+		"password": "secret",
+		"interval": float64(1),
+	}))
+
+	v, ok := p.GetSecret("emitter/limit/readRate")
+	assert.True(t, ok)
+	assert.Equal(t, "100", v)
+
+	changed, err := p.refresh(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+// newVaultServer creates a fake Vault server with an AppRole and a version 2 key-value
+// secrets engine, counting the renewals of its token.
+func newVaultServer(secrets *sync.Map, renewals *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		login := map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": "token-1", "lease_duration": 60, "renewable": true},
+		}
+
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login":
+			var in map[string]string
+			json.NewDecoder(r.Body).Decode(&in)
+			if in["role_id"] != "emitter" || in["secret_id"] != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(login)
+			return
+		case r.Header.Get("X-Vault-Token") != "token-1":
+			w.WriteHeader(http.StatusForbidden)
+			return
+		case r.URL.Path == "/v1/auth/token/renew-self":
+			atomic.AddInt32(renewals, 1)
+			json.NewEncoder(w).Encode(login)
+			return
+		}
+
+		// Listing the metadata returns the keys and the sub-paths under a path
+		if path := strings.TrimPrefix(r.URL.Path, "/v1/kv/metadata/"); path != r.URL.Path {
+			keys := map[string]bool{}
+			secrets.Range(func(k, _ interface{}) bool {
+				if name := strings.TrimPrefix(k.(string), path+"/"); name != k.(string) {
+					if i := strings.Index(name, "/"); i >= 0 {
+						name = name[:i+1]
+					}
+					keys[name] = true
+				}
+				return true
+			})
+
+			if len(keys) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			var list []string
+			for k := range keys {
+				list = append(list, k)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": list}})
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/v1/kv/data/")
+		switch r.Method {
+		case "POST":
+			var in struct {
+				Data map[string]string `json:"data"`
+			}
+			json.NewDecoder(r.Body).Decode(&in)
+			secrets.Store(path, in.Data["value"])
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			value, ok := secrets.Load(path)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"data": map[string]interface{}{"value": value}},
+			})
+		}
+	}))
+}
+
+func TestVault(t *testing.T) {
+	renewals := int32(0)
+	secrets := new(sync.Map)
+	secrets.Store("emitter/license", "abc")
+	secrets.Store("emitter/limit/readRate", "100")
+	server := newVaultServer(secrets, &renewals)
+	defer server.Close()
+
+	p := NewVault("")
+	assert.Equal(t, "vault", p.Name())
+	assert.Error(t, p.Configure(nil))
+	assert.Error(t, p.Configure(map[string]interface{}{"address": server.URL}))
+	assert.Error(t, p.Configure(map[string]interface{}{"address": server.URL, "roleId": "emitter"}))
+	assert.NoError(t, p.Configure(map[string]interface{}{
+		"address":  server.URL,
+		"mount":    "kv",
+		"version":  float64(2),
+		"roleId":   "emitter",
+		"secretId": "secret",
+	}))
+
+	v, ok := p.GetSecret("emitter/license")
+	assert.True(t, ok)
+	assert.Equal(t, "abc", v)
+
+	v, ok = p.GetSecret("emitter/limit/readRate")
+	assert.True(t, ok)
+	assert.Equal(t, "100", v)
+
+	_, ok = p.GetSecret("emitter/cluster/seed")
+	assert.False(t, ok)
+
+	// The token is only renewed once half of its lease elapsed
+	assert.NoError(t, p.renew(context.Background()))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&renewals))
+	p.expires = time.Now().Add(10 * time.Second)
+	assert.NoError(t, p.renew(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&renewals))
+	assert.True(t, time.Until(p.expires) > 50*time.Second)
+
+	// A token which was revoked is obtained again
+	p.token = "revoked"
+	secrets.Store("emitter/limit/readRate", "200")
+	changed, err := p.refresh(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "token-1", p.token)
+
+	v, _ = p.GetSecret("emitter/limit/readRate")
+	assert.Equal(t, "200", v)
+
+	// The certificates are kept under the certs path
+	cache, ok := p.GetCache()
+	assert.True(t, ok)
+	_, err = cache.Get(context.Background(), "example.com")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.NoError(t, cache.Put(context.Background(), "example.com", []byte("cert")))
+	cert, err := cache.Get(context.Background(), "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "cert", string(cert))
+	assert.NoError(t, cache.Delete(context.Background(), "example.com"))
+	_, err = cache.Get(context.Background(), "example.com")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+}
+
+func TestVaultAddress(t *testing.T) {
+	assert.Equal(t, "http://127.0.0.1:8200", vaultAddress("127.0.0.1"))
+	assert.Equal(t, "https://vault.local:8200", vaultAddress("https://vault.local:8200/"))
+}
+
+func TestWatch(t *testing.T) {
+	var calls, changes int
+	var lock sync.Mutex
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watch(ctx, "test", time.Millisecond, func(context.Context) (bool, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+		return calls == 2, nil
+	}, func() {
+		lock.Lock()
+		defer lock.Unlock()
+		changes++
+	})
+
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return calls > 3
+	}, time.Second, time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 1, changes)
+}
+
+func TestValues(t *testing.T) {
+	v := values{prefix: "emitter/"}
+	assert.Equal(t, "emitter/", v.root())
+	assert.Equal(t, "emitter/limit/readrate", v.key("emitter/limit/readRate"))
+
+	assert.False(t, v.replace(map[string]string{"emitter/Debug": "true"}))
+	assert.False(t, v.replace(map[string]string{"emitter/debug": "true"}))
+	assert.True(t, v.replace(map[string]string{"emitter/debug": "false"}))
+
+	value, ok := v.get("emitter/debug")
+	assert.True(t, ok)
+	assert.Equal(t, "false", value)
+}
@@ -0,0 +1,464 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const vaultJWTPath = "/var/run/secrets/kubernetes.io/serviceaccount/token" // The token of the Kubernetes service account.
+
+var (
+	errVaultDenied   = errors.New("vault responded with 403 Forbidden")
+	errVaultNotFound = errors.New("vault responded with 404 Not Found")
+)
+
+// Vault represents a secret store which reads the configuration from the key-value secrets
+// engine of HashiCorp Vault, for example the "value" of "secret/emitter/license" for the
+// license. The token of the store is renewed before its lease expires, or obtained again
+// if it can no longer be renewed, and the secrets are read again periodically.
+type Vault struct {
+	sync.Mutex
+	values    values        // The values read from the store.
+	client    *http.Client  // The HTTP client to use.
+	user      string        // The user ID of the legacy app-id authentication.
+	address   string        // The address of the Vault server.
+	namespace string        // The namespace of the secrets, if any.
+	mount     string        // The mount path of the key-value secrets engine.
+	version   int           // The version of the key-value secrets engine (1 or 2).
+	auth      vaultLogin    // The authentication method of the store.
+	token     string        // The token of the store, once authenticated.
+	lease     time.Duration // The lease of the token, zero if it does not expire.
+	expires   time.Time     // The time the token expires at, if it has a lease.
+	renewable bool          // Whether the token can be renewed.
+	interval  time.Duration // The interval between the reads of a watch.
+}
+
+// vaultLogin represents the authentication of the store, using either a token, an AppRole,
+// the Kubernetes service account or the legacy application ID.
+type vaultLogin struct {
+	token    string // The static token to use.
+	roleID   string // The role ID of the AppRole.
+	secretID string // The secret ID of the AppRole.
+	role     string // The role of the Kubernetes authentication.
+	jwtPath  string // The path of the token of the Kubernetes service account.
+	app      string // The application ID of the legacy authentication.
+}
+
+// vaultResponse represents a response of Vault.
+type vaultResponse struct {
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+// NewVault creates a new Vault secret store, with the user ID of the legacy application ID
+// authentication.
+func NewVault(user string) *Vault {
+	return &Vault{
+		client: &http.Client{Timeout: fetchTimeout},
+		user:   user,
+	}
+}
+
+// Name returns the name of the secret store.
+func (p *Vault) Name() string {
+	return "vault"
+}
+
+// Configure configures the secret store, authenticates and reads the secrets of its prefix.
+func (p *Vault) Configure(config map[string]interface{}) error {
+	if config == nil {
+		return errors.New("unable to configure Vault provider, no configuration provided")
+	}
+
+	p.Lock()
+	p.address = vaultAddress(stringOf(config, "address", "http://127.0.0.1:8200"))
+	p.namespace = stringOf(config, "namespace", "")
+	p.mount = strings.Trim(stringOf(config, "mount", "secret"), "/")
+	p.version = 1
+	if v, ok := config["version"].(float64); ok && v == 2 {
+		p.version = 2
+	}
+	p.auth = vaultLogin{
+		token:    stringOf(config, "token", ""),
+		roleID:   stringOf(config, "roleId", ""),
+		secretID: stringOf(config, "secretId", ""),
+		role:     stringOf(config, "role", ""),
+		jwtPath:  stringOf(config, "jwtPath", vaultJWTPath),
+		app:      stringOf(config, "app", ""),
+	}
+	p.token = ""
+	p.interval = time.Minute
+	if v, ok := config["interval"].(float64); ok && v > 0 {
+		p.interval = time.Duration(v) * time.Second
+	}
+	p.Unlock()
+
+	p.values.Lock()
+	p.values.prefix = stringOf(config, "prefix", defaultPrefix)
+	p.values.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	if err := p.authenticate(ctx); err != nil {
+		return err
+	}
+
+	_, err := p.refresh(ctx)
+	return err
+}
+
+// vaultAddress returns the URL of a Vault server, which may be given as an IP address.
+func vaultAddress(address string) string {
+	if ip := net.ParseIP(address); ip != nil {
+		return fmt.Sprintf("http://%v:8200", ip.String())
+	}
+	return strings.TrimSuffix(address, "/")
+}
+
+// GetSecret retrieves a secret from the store.
+func (p *Vault) GetSecret(secretName string) (string, bool) {
+	return p.values.get(secretName)
+}
+
+// GetCache returns a certificate cache which keeps the certificates in Vault.
+func (p *Vault) GetCache() (autocert.Cache, bool) {
+	p.Lock()
+	defer p.Unlock()
+	if p.address == "" || p.token == "" {
+		return nil, false
+	}
+
+	return &vaultCache{store: p}, true
+}
+
+// Watch renews the token and reads the secrets of the store again until the context is
+// cancelled, calling the function whenever they change.
+func (p *Vault) Watch(ctx context.Context, onChange func()) {
+	p.Lock()
+	address, interval := p.address, p.interval
+	if p.lease > 0 && p.lease/3 < interval {
+		interval = p.lease / 3
+	}
+	p.Unlock()
+	if address == "" {
+		return // Not configured
+	}
+
+	watch(ctx, p.Name(), interval, func(ctx context.Context) (bool, error) {
+		ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		defer cancel()
+		if err := p.renew(ctx); err != nil {
+			return false, err
+		}
+		return p.refresh(ctx)
+	}, onChange)
+}
+
+// authenticate obtains a new token with the authentication method configured.
+func (p *Vault) authenticate(ctx context.Context) error {
+	p.Lock()
+	auth, user := p.auth, p.user
+	p.Unlock()
+
+	var out vaultResponse
+	switch {
+	case auth.token != "":
+		if err := p.call(ctx, "GET", "/v1/auth/token/lookup-self", auth.token, nil, &out); err != nil {
+			return err
+		}
+
+		// A static token carries its lease in the data of the lookup
+		ttl, _ := out.Data["ttl"].(float64)
+		renewable, _ := out.Data["renewable"].(bool)
+		p.setToken(auth.token, int(ttl), renewable)
+		return nil
+
+	case auth.roleID != "":
+		if err := p.call(ctx, "POST", "/v1/auth/approle/login", "", map[string]string{
+			"role_id":   auth.roleID,
+			"secret_id": auth.secretID,
+		}, &out); err != nil {
+			return err
+		}
+
+	case auth.role != "":
+		jwt, err := ioutil.ReadFile(auth.jwtPath)
+		if err != nil {
+			return err
+		}
+
+		if err := p.call(ctx, "POST", "/v1/auth/kubernetes/login", "", map[string]string{
+			"role": auth.role,
+			"jwt":  strings.TrimSpace(string(jwt)),
+		}, &out); err != nil {
+			return err
+		}
+
+	case auth.app != "":
+		if err := p.call(ctx, "POST", "/v1/auth/app-id/login", "", map[string]string{
+			"app_id":  auth.app,
+			"user_id": user,
+		}, &out); err != nil {
+			return err
+		}
+
+	default:
+		return errors.New("unable to configure Vault provider, no token, roleId, role or app provided")
+	}
+
+	if out.Auth == nil || out.Auth.ClientToken == "" {
+		return errors.New("unable to perform vault authentication, no token was returned")
+	}
+
+	p.setToken(out.Auth.ClientToken, out.Auth.LeaseDuration, out.Auth.Renewable)
+	return nil
+}
+
+// setToken sets the token of the store along with its lease, in seconds.
+func (p *Vault) setToken(token string, lease int, renewable bool) {
+	p.Lock()
+	defer p.Unlock()
+	p.token = token
+	p.lease = time.Duration(lease) * time.Second
+	p.expires = time.Now().Add(p.lease)
+	p.renewable = renewable
+}
+
+// renew renews the token once half of its lease elapsed, or authenticates again if it can
+// not be renewed.
+func (p *Vault) renew(ctx context.Context) error {
+	p.Lock()
+	token, lease, expires, renewable := p.token, p.lease, p.expires, p.renewable
+	p.Unlock()
+
+	switch {
+	case token == "":
+		return p.authenticate(ctx)
+	case lease == 0 || time.Until(expires) > lease/2:
+		return nil
+	case renewable:
+		var out vaultResponse
+		err := p.call(ctx, "POST", "/v1/auth/token/renew-self", token, map[string]string{}, &out)
+		if err == nil && out.Auth != nil {
+			p.setToken(token, out.Auth.LeaseDuration, out.Auth.Renewable)
+			return nil
+		}
+
+		logging.LogError(p.Name(), "renewing the token", err)
+	}
+
+	return p.authenticate(ctx)
+}
+
+// refresh reads the secrets of the prefix, returning whether they changed.
+func (p *Vault) refresh(ctx context.Context) (bool, error) {
+	entries := make(map[string]string)
+	if err := p.readAll(ctx, strings.TrimSuffix(p.values.root(), "/"), entries); err != nil {
+		return false, err
+	}
+
+	return p.values.replace(entries), nil
+}
+
+// readAll reads the secrets under a path, recursively.
+func (p *Vault) readAll(ctx context.Context, path string, entries map[string]string) error {
+	var out vaultResponse
+	err := p.request(ctx, "GET", p.pathOf("metadata", path)+"?list=true", nil, &out)
+	switch {
+	case err == errVaultNotFound:
+		return nil // Nothing under this path
+	case err != nil:
+		return err
+	}
+
+	keys, _ := out.Data["keys"].([]interface{})
+	for _, k := range keys {
+		name, _ := k.(string)
+		switch {
+		case name == "":
+			continue
+		case strings.HasSuffix(name, "/"):
+			if err := p.readAll(ctx, path+"/"+strings.TrimSuffix(name, "/"), entries); err != nil {
+				return err
+			}
+		default:
+			value, err := p.read(ctx, path+"/"+name)
+			switch {
+			case err == errVaultNotFound:
+				continue
+			case err != nil:
+				return err
+			case value != "":
+				entries[path+"/"+name] = value
+			}
+		}
+	}
+	return nil
+}
+
+// read reads the value of a secret.
+func (p *Vault) read(ctx context.Context, path string) (string, error) {
+	var out vaultResponse
+	if err := p.request(ctx, "GET", p.pathOf("data", path), nil, &out); err != nil {
+		return "", err
+	}
+
+	// The version 2 of the engine wraps the secret along with its metadata
+	data := out.Data
+	if p.version == 2 {
+		data, _ = data["data"].(map[string]interface{})
+	}
+
+	value, _ := data["value"].(string)
+	return value, nil
+}
+
+// write writes the value of a secret.
+func (p *Vault) write(ctx context.Context, path, value string) error {
+	var in interface{} = map[string]string{"value": value}
+	if p.version == 2 {
+		in = map[string]interface{}{"data": in}
+	}
+
+	return p.request(ctx, "POST", p.pathOf("data", path), in, nil)
+}
+
+// pathOf returns the API path of a secret, where the version 2 of the engine has different
+// paths for the data and the metadata (e.g: listing).
+func (p *Vault) pathOf(kind, path string) string {
+	if p.version == 2 {
+		return "/v1/" + p.mount + "/" + kind + "/" + path
+	}
+	return "/v1/" + p.mount + "/" + path
+}
+
+// request sends a request with the token of the store, authenticating again once if the
+// token was refused.
+func (p *Vault) request(ctx context.Context, method, path string, in, out interface{}) error {
+	p.Lock()
+	token := p.token
+	p.Unlock()
+
+	err := p.call(ctx, method, path, token, in, out)
+	if err == errVaultDenied {
+		if err := p.authenticate(ctx); err != nil {
+			return err
+		}
+
+		p.Lock()
+		token = p.token
+		p.Unlock()
+		return p.call(ctx, method, path, token, in, out)
+	}
+	return err
+}
+
+// call sends a JSON request and decodes its JSON response, if any.
+func (p *Vault) call(ctx context.Context, method, path, token string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	p.Lock()
+	address, namespace := p.address, p.namespace
+	p.Unlock()
+
+	req, err := http.NewRequest(method, address+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if out != nil {
+			return json.NewDecoder(resp.Body).Decode(out)
+		}
+		return nil
+	case http.StatusNoContent:
+		return nil
+	case http.StatusForbidden:
+		return errVaultDenied
+	case http.StatusNotFound:
+		return errVaultNotFound
+	default:
+		return fmt.Errorf("vault responded with %s", resp.Status)
+	}
+}
+
+// ------------------------------------------------------------------------------------
+
+// vaultCache represents a certificate cache which keeps the certificates in Vault, under the
+// "certs/" path of the secrets engine.
+type vaultCache struct {
+	store *Vault // The store of the certificates.
+}
+
+// Get returns the certificate data of the key, or autocert.ErrCacheMiss if there is none.
+func (c *vaultCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.store.read(ctx, "certs/"+key)
+	if err != nil || value == "" {
+		return nil, autocert.ErrCacheMiss
+	}
+
+	return base64.StdEncoding.DecodeString(value)
+}
+
+// Put stores the certificate data under the key.
+func (c *vaultCache) Put(ctx context.Context, key string, data []byte) error {
+	return c.store.write(ctx, "certs/"+key, base64.StdEncoding.EncodeToString(data))
+}
+
+// Delete removes the certificate data of the key.
+func (c *vaultCache) Delete(ctx context.Context, key string) error {
+	return c.store.write(ctx, "certs/"+key, "")
+}
@@ -0,0 +1,228 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// The prefix of the encrypted configuration values.
+const encryptedPrefix = "enc:"
+
+var (
+	errNoDecryptionKey = errors.New("config: encrypted values found, but no 'encryption.keyFile' is configured")
+	errInvalidValue    = errors.New("config: unable to decrypt a value, make sure it was encrypted with the configured key")
+)
+
+// EncryptionConfig represents the configuration of the key used to decrypt the values of
+// the configuration prefixed with "enc:".
+type EncryptionConfig struct {
+
+	// The path to the file which contains the base64-encoded data key (AES-256).
+	KeyFile string `json:"keyFile,omitempty"`
+
+	// The AWS region of the KMS. If this is set, the key file contains the data key which was
+	// encrypted by KMS (envelope encryption) and is decrypted through KMS at startup.
+	KMSRegion string `json:"kmsRegion,omitempty"`
+}
+
+// kmsDecrypt decrypts the data key using AWS KMS.
+var kmsDecrypt = func(region string, blob []byte) ([]byte, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(region),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := kms.New(sess).Decrypt(&kms.DecryptInput{
+		CiphertextBlob: blob,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+// LoadKey loads the data key used for encrypting and decrypting the configuration values.
+func LoadKey(c *EncryptionConfig) ([]byte, error) {
+	if c == nil || c.KeyFile == "" {
+		return nil, errNoDecryptionKey
+	}
+
+	b, err := ioutil.ReadFile(c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	// If the key is protected by KMS, decrypt it first
+	if c.KMSRegion != "" {
+		return kmsDecrypt(c.KMSRegion, key)
+	}
+	return key, nil
+}
+
+// NewKey generates a new base64-encoded data key for encrypting the configuration values.
+func NewKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Encrypt encrypts a configuration value with the data key provided.
+func Encrypt(key []byte, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt decrypts a configuration value, which must carry the "enc:" prefix.
+func decrypt(aead cipher.AEAD, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errInvalidValue
+	}
+
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errInvalidValue
+	}
+	return string(plain), nil
+}
+
+// newAEAD creates a new AES-GCM cipher for the data key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ------------------------------------------------------------------------------------
+
+// Decrypt replaces all of the encrypted values of the configuration with their decrypted
+// values. The key is only loaded if the configuration contains encrypted values.
+func (c *Config) Decrypt() error {
+	if !hasEncrypted(reflect.ValueOf(c)) {
+		return nil
+	}
+
+	key, err := LoadKey(c.Encryption)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	return decryptRecursive(aead, reflect.ValueOf(c))
+}
+
+// hasEncrypted checks whether the value contains any encrypted strings.
+func hasEncrypted(value reflect.Value) (found bool) {
+	walkStrings(value, func(v string) string {
+		found = found || strings.HasPrefix(v, encryptedPrefix)
+		return v
+	})
+	return
+}
+
+// decryptRecursive traverses the value and decrypts all of the encrypted strings.
+func decryptRecursive(aead cipher.AEAD, value reflect.Value) (err error) {
+	walkStrings(value, func(v string) string {
+		if err != nil || !strings.HasPrefix(v, encryptedPrefix) {
+			return v
+		}
+
+		var plain string
+		plain, err = decrypt(aead, v)
+		return plain
+	})
+	return
+}
+
+// walkStrings traverses the exported fields, maps and slices of a value and replaces each
+// of the strings with the result of the function.
+func walkStrings(value reflect.Value, f func(string) string) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			walkStrings(value.Elem(), f)
+		}
+
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).PkgPath == "" { // Only exported fields
+				walkStrings(value.Field(i), f)
+			}
+		}
+
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			v := value.Index(i)
+			if s, ok := v.Interface().(string); ok && v.Kind() == reflect.Interface {
+				v.Set(reflect.ValueOf(f(s)))
+				continue
+			}
+			walkStrings(v, f)
+		}
+
+	case reflect.Map:
+		for _, k := range value.MapKeys() {
+			v := value.MapIndex(k)
+			if s, ok := v.Interface().(string); ok {
+				value.SetMapIndex(k, reflect.ValueOf(f(s)))
+				continue
+			}
+			walkStrings(v, f)
+		}
+
+	case reflect.String:
+		if s := f(value.String()); value.CanSet() {
+			value.SetString(s)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	cfg "github.com/emitter-io/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeKey writes a key file for testing.
+func writeKey(t *testing.T, key string) string {
+	f, err := ioutil.TempFile("", "emitter-key")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	f.WriteString(key + "\n")
+	return f.Name()
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	encoded, err := NewKey()
+	assert.NoError(t, err)
+
+	key, _ := base64.StdEncoding.DecodeString(encoded)
+	enc, err := Encrypt(key, "secret")
+	assert.NoError(t, err)
+	assert.Contains(t, enc, encryptedPrefix)
+
+	aead, err := newAEAD(key)
+	assert.NoError(t, err)
+
+	dec, err := decrypt(aead, enc)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", dec)
+
+	_, err = decrypt(aead, "enc:invalid")
+	assert.Equal(t, errInvalidValue, err)
+
+	_, err = decrypt(aead, encryptedPrefix+base64.StdEncoding.EncodeToString([]byte("too short")))
+	assert.Equal(t, errInvalidValue, err)
+}
+
+func TestConfig_Decrypt(t *testing.T) {
+	encoded, _ := NewKey()
+	path := writeKey(t, encoded)
+	defer os.Remove(path)
+
+	key, _ := base64.StdEncoding.DecodeString(encoded)
+	license, _ := Encrypt(key, "my-license")
+	password, _ := Encrypt(key, "my-password")
+	nested, _ := Encrypt(key, "my-nested")
+
+	c := &Config{
+		License:    license,
+		ListenAddr: ":8080",
+		Cluster:    &ClusterConfig{Passphrase: license},
+		Storage: &cfg.ProviderConfig{
+			Provider: "inmemory",
+			Config: map[string]interface{}{
+				"password": password,
+				"nested":   map[string]interface{}{"value": nested},
+				"list":     []interface{}{nested},
+				"size":     1,
+			},
+		},
+		Encryption: &EncryptionConfig{KeyFile: path},
+	}
+
+	assert.NoError(t, c.Decrypt())
+	assert.Equal(t, "my-license", c.License)
+	assert.Equal(t, "my-license", c.Cluster.Passphrase)
+	assert.Equal(t, ":8080", c.ListenAddr)
+	assert.Equal(t, "my-password", c.Storage.Config["password"])
+	assert.Equal(t, "my-nested", c.Storage.Config["nested"].(map[string]interface{})["value"])
+	assert.Equal(t, "my-nested", c.Storage.Config["list"].([]interface{})[0])
+	assert.Equal(t, 1, c.Storage.Config["size"])
+}
+
+func TestConfig_DecryptNoKey(t *testing.T) {
+	assert.NoError(t, (&Config{License: "plain"}).Decrypt())
+	assert.Equal(t, errNoDecryptionKey, (&Config{License: "enc:abc"}).Decrypt())
+	assert.Error(t, (&Config{
+		License:    "enc:abc",
+		Encryption: &EncryptionConfig{KeyFile: "missing.key"},
+	}).Decrypt())
+}
+
+func TestLoadKey_KMS(t *testing.T) {
+	defer func(f func(string, []byte) ([]byte, error)) { kmsDecrypt = f }(kmsDecrypt)
+	kmsDecrypt = func(region string, blob []byte) ([]byte, error) {
+		if region != "eu-west-1" {
+			return nil, errors.New("invalid region")
+		}
+		return append([]byte("plain-"), blob...), nil
+	}
+
+	path := writeKey(t, base64.StdEncoding.EncodeToString([]byte("key")))
+	defer os.Remove(path)
+
+	key, err := LoadKey(&EncryptionConfig{KeyFile: path, KMSRegion: "eu-west-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "plain-key", string(key))
+
+	_, err = LoadKey(&EncryptionConfig{KeyFile: path, KMSRegion: "us-east-1"})
+	assert.Error(t, err)
+}
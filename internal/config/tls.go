@@ -0,0 +1,240 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The TLS versions which can be configured as the minimum.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// The elliptic curves which can be configured, by their name.
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// TLSPolicyConfig represents the policy applied to the handshakes of the TLS listeners.
+type TLSPolicyConfig struct {
+
+	// The minimum version of TLS accepted: "1.0", "1.1", "1.2" or "1.3". Defaults to "1.2".
+	MinVersion string `json:"minVersion,omitempty"`
+
+	// The comma-separated list of the cipher suites allowed for TLS 1.2 and below, by their
+	// standard name (e.g: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"). The cipher suites of
+	// TLS 1.3 are not configurable. If not specified, the secure defaults of Go are used.
+	Ciphers string `json:"ciphers,omitempty"`
+
+	// The comma-separated list of the elliptic curves, by order of preference, among
+	// "X25519", "P256", "P384" and "P521". If not specified, the defaults of Go are used.
+	Curves string `json:"curves,omitempty"`
+
+	// The interval, in seconds, at which the certificate and key files are checked for
+	// changes, which are then loaded for the new handshakes. Defaults to 60 seconds, and
+	// a negative value disables it.
+	ReloadInterval int `json:"reloadInterval,omitempty"`
+}
+
+// Apply applies the policy to a TLS configuration, which is hardened with the defaults
+// if no policy was configured.
+func (c *TLSPolicyConfig) Apply(conf *tls.Config) error {
+	if c == nil {
+		c = new(TLSPolicyConfig)
+	}
+
+	conf.MinVersion = tls.VersionTLS12
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return fmt.Errorf("unknown TLS version '%s'", c.MinVersion)
+		}
+		conf.MinVersion = version
+	}
+
+	ciphers, err := cipherSuitesOf(c.Ciphers)
+	if err != nil {
+		return err
+	}
+
+	curves, err := curvesOf(c.Curves)
+	if err != nil {
+		return err
+	}
+
+	conf.CipherSuites = ciphers
+	conf.CurvePreferences = curves
+	return nil
+}
+
+// ReloadPeriod returns the configured interval of the checks of the certificate files, or
+// zero if disabled.
+func (c *TLSPolicyConfig) ReloadPeriod() time.Duration {
+	switch {
+	case c == nil || c.ReloadInterval == 0:
+		return time.Minute
+	case c.ReloadInterval < 0:
+		return 0
+	default:
+		return time.Duration(c.ReloadInterval) * time.Second
+	}
+}
+
+// cipherSuitesOf parses a comma-separated list of cipher suites. The insecure ones are
+// accepted, since they can only be enabled explicitly.
+func cipherSuitesOf(list string) ([]uint16, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite.ID
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(list, ",") {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite '%s'", strings.TrimSpace(name))
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// curvesOf parses a comma-separated list of elliptic curves.
+func curvesOf(list string) ([]tls.CurveID, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var curves []tls.CurveID
+	for _, name := range strings.Split(list, ",") {
+		curve, ok := tlsCurves[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown elliptic curve '%s'", strings.TrimSpace(name))
+		}
+		curves = append(curves, curve)
+	}
+	return curves, nil
+}
+
+// SNIConfig represents the additional certificates of the secure listener, each served to
+// the clients asking for one of the hostnames it is valid for.
+type SNIConfig struct {
+
+	// The directory of the certificates, as pairs of "<name>.crt" (or "<name>.pem") and
+	// "<name>.key" files. The hostnames are the ones of the certificates themselves.
+	Dir string `json:"dir,omitempty"`
+
+	// The certificates, along with their private key.
+	Certificates []SNICertificate `json:"certificates,omitempty"`
+}
+
+// SNICertificate represents a certificate served through SNI.
+type SNICertificate struct {
+	Certificate string `json:"certificate"` // The file of the certificate.
+	PrivateKey  string `json:"private"`     // The file of the private key.
+}
+
+// Files returns the certificate and key files, along with their directory, so the changes
+// can be detected.
+func (c *SNIConfig) Files() []string {
+	if c == nil {
+		return nil
+	}
+
+	var files []string
+	if c.Dir != "" {
+		files = append(files, c.Dir)
+	}
+
+	for _, pair := range c.pairs() {
+		files = append(files, pair.Certificate, pair.PrivateKey)
+	}
+	return files
+}
+
+// Apply loads the certificates and serves them to the clients asking for one of their
+// hostnames. The other clients are served the certificate of the configuration.
+func (c *SNIConfig) Apply(conf *tls.Config) error {
+	if c == nil {
+		return nil
+	}
+
+	var certs []tls.Certificate
+	for _, pair := range c.pairs() {
+		cert, err := tls.LoadX509KeyPair(pair.Certificate, pair.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("unable to load the certificate '%s', due to %s", pair.Certificate, err.Error())
+		}
+
+		// Parse the certificate once, rather than for every handshake
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	// Without a certificate of its own, the configuration falls back to its certificates
+	fallback := conf.GetCertificate
+	conf.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		for i := range certs {
+			if hello.SupportsCertificate(&certs[i]) == nil {
+				return &certs[i], nil
+			}
+		}
+
+		if fallback != nil {
+			return fallback(hello)
+		}
+		return nil, nil
+	}
+	return nil
+}
+
+// pairs returns the certificates configured, along with the ones of the directory.
+func (c *SNIConfig) pairs() []SNICertificate {
+	pairs := append([]SNICertificate{}, c.Certificates...)
+	if c.Dir == "" {
+		return pairs
+	}
+
+	files, _ := ioutil.ReadDir(c.Dir)
+	for _, f := range files {
+		switch ext := filepath.Ext(f.Name()); ext {
+		case ".crt", ".pem":
+			pairs = append(pairs, SNICertificate{
+				Certificate: filepath.Join(c.Dir, f.Name()),
+				PrivateKey:  filepath.Join(c.Dir, strings.TrimSuffix(f.Name(), ext)+".key"),
+			})
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,133 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSPolicy_Apply(t *testing.T) {
+	var none *TLSPolicyConfig
+	conf := new(tls.Config)
+	assert.NoError(t, none.Apply(conf))
+	assert.Equal(t, uint16(tls.VersionTLS12), conf.MinVersion)
+	assert.Nil(t, conf.CipherSuites)
+	assert.Nil(t, conf.CurvePreferences)
+
+	policy := &TLSPolicyConfig{
+		MinVersion: "1.3",
+		Ciphers:    "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+		Curves:     "x25519,P384",
+	}
+	assert.NoError(t, policy.Apply(conf))
+	assert.Equal(t, uint16(tls.VersionTLS13), conf.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, conf.CipherSuites)
+	assert.Equal(t, []tls.CurveID{tls.X25519, tls.CurveP384}, conf.CurvePreferences)
+
+	assert.Error(t, (&TLSPolicyConfig{MinVersion: "2.0"}).Apply(conf))
+	assert.Error(t, (&TLSPolicyConfig{Ciphers: "TLS_NONE"}).Apply(conf))
+	assert.Error(t, (&TLSPolicyConfig{Curves: "P128"}).Apply(conf))
+}
+
+func TestTLSPolicy_ReloadPeriod(t *testing.T) {
+	var none *TLSPolicyConfig
+	assert.Equal(t, time.Minute, none.ReloadPeriod())
+	assert.Equal(t, time.Duration(0), (&TLSPolicyConfig{ReloadInterval: -1}).ReloadPeriod())
+	assert.Equal(t, 5*time.Second, (&TLSPolicyConfig{ReloadInterval: 5}).ReloadPeriod())
+}
+
+// writeCertificate writes a self-signed certificate for a hostname, along with its key.
+func writeCertificate(t *testing.T, dir, name, host string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func TestSNI_Apply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sni")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeCertificate(t, dir, "a", "a.example.com")
+	other, err := ioutil.TempDir("", "sni")
+	assert.NoError(t, err)
+	defer os.RemoveAll(other)
+	writeCertificate(t, other, "b", "b.example.com")
+
+	sni := &SNIConfig{
+		Dir: dir,
+		Certificates: []SNICertificate{{
+			Certificate: filepath.Join(other, "b.crt"),
+			PrivateKey:  filepath.Join(other, "b.key"),
+		}},
+	}
+	assert.Len(t, sni.Files(), 5)
+
+	conf := new(tls.Config)
+	assert.NoError(t, sni.Apply(conf))
+
+	for _, host := range []string{"a.example.com", "b.example.com"} {
+		cert, err := conf.GetCertificate(&tls.ClientHelloInfo{
+			ServerName:        host,
+			SupportedVersions: []uint16{tls.VersionTLS12},
+			SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+			SupportedCurves:   []tls.CurveID{tls.CurveP256},
+			SupportedPoints:   []uint8{0},
+			CipherSuites:      []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{host}, cert.Leaf.DNSNames)
+	}
+
+	// An unknown hostname falls back to the certificates of the configuration
+	cert, err := conf.GetCertificate(&tls.ClientHelloInfo{ServerName: "c.example.com"})
+	assert.NoError(t, err)
+	assert.Nil(t, cert)
+
+	// A missing key fails
+	os.Remove(filepath.Join(dir, "a.key"))
+	assert.Error(t, sni.Apply(new(tls.Config)))
+
+	var none *SNIConfig
+	assert.NoError(t, none.Apply(conf))
+	assert.Empty(t, none.Files())
+}
@@ -24,9 +24,12 @@ func New(msg string) *Error {
 
 // Error represents an event code which provides a more details.
 type Error struct {
-	Request uint16 `json:"req,omitempty"`
-	Status  int    `json:"status"`
-	Message string `json:"message"`
+	Request    uint16   `json:"req,omitempty"`
+	Status     int      `json:"status"`
+	Message    string   `json:"message"`
+	RetryAfter int      `json:"retryAfter,omitempty"` // The number of seconds to wait before retrying.
+	Endpoints  []string `json:"endpoints,omitempty"`  // The alternate endpoints to retry with.
+	MaxSize    int      `json:"maxSize,omitempty"`    // The maximum size of a packet, if it was exceeded.
 }
 
 // Error implements error interface.
@@ -38,6 +41,23 @@ func (e *Error) Copy() *Error {
 	return &copyErr
 }
 
+// WithRetry returns a copy of the error carrying the retry guidance, so the clients
+// know when to retry and where they could reconnect to.
+func (e *Error) WithRetry(after int, endpoints []string) *Error {
+	copyErr := *e
+	copyErr.RetryAfter = after
+	copyErr.Endpoints = endpoints
+	return &copyErr
+}
+
+// WithMaxSize returns a copy of the error advertising the maximum size of a packet, so the
+// clients know how large their packets can be.
+func (e *Error) WithMaxSize(size int) *Error {
+	copyErr := *e
+	copyErr.MaxSize = size
+	return &copyErr
+}
+
 // ForRequest returns an error for a specific request.
 func (e *Error) ForRequest(requestID uint16) {
 	e.Request = requestID
@@ -50,10 +70,24 @@ var (
 	ErrPaymentRequired = &Error{Status: 402, Message: "the request can not be served, as the payment is required to proceed"}
 	ErrForbidden       = &Error{Status: 403, Message: "the request is understood, but it has been refused or access is not allowed"}
 	ErrNotFound        = &Error{Status: 404, Message: "the resource requested does not exist"}
+	ErrConflict        = &Error{Status: 409, Message: "the request conflicts with the current version of the resource"}
 	ErrServerError     = &Error{Status: 500, Message: "an unexpected condition was encountered and no more specific message is suitable"}
 	ErrNotImplemented  = &Error{Status: 501, Message: "the server either does not recognize the request method, or it lacks the ability to fulfill the request"}
 	ErrTargetInvalid   = &Error{Status: 400, Message: "channel should end with `/` for strict types or `/#/` for wildcards"}
 	ErrTargetTooLong   = &Error{Status: 400, Message: "channel can not have more than 23 parts"}
 	ErrLinkInvalid     = &Error{Status: 400, Message: "the link must be an alphanumeric string of 1 or 2 characters"}
 	ErrUnauthorizedExt = &Error{Status: 401, Message: "the security key with extend permission can only be used for private links"}
+	ErrOverloaded      = &Error{Status: 503, Message: "the server is overloaded and the request was shed, please retry later"}
+	ErrUnavailable     = &Error{Status: 503, Message: "the server is unavailable, please retry later or reconnect elsewhere"}
+	ErrExhausted       = &Error{Status: 503, Message: "the server can not accept more connections, please retry later or reconnect elsewhere"}
+	ErrThrottled       = &Error{Status: 503, Message: "too many clients are connecting at once, please retry after the delay specified"}
+	ErrNoSubscribers   = &Error{Status: 404, Message: "the message was published, but there was no subscriber to receive it"}
+	ErrTimeout         = &Error{Status: 408, Message: "the request timed out before a response was received"}
+	ErrWrongRegion     = &Error{Status: 421, Message: "the request can only be served by the home region of the contract, please retry there"}
+	ErrTooManySubs     = &Error{Status: 429, Message: "the connection has reached the maximum number of subscriptions allowed by the contract"}
+	ErrTooManyInflight = &Error{Status: 429, Message: "the connection has reached the maximum number of publishes in flight allowed by the contract"}
+	ErrPacketTooLarge  = &Error{Status: 413, Message: "the packet exceeds the maximum size allowed"}
+	ErrMessageTooLarge = &Error{Status: 413, Message: "the message exceeds the maximum size allowed by the contract"}
+	ErrQuotaExceeded   = &Error{Status: 429, Message: "the contract has reached the maximum number of messages allowed per day"}
+	ErrRejected        = &Error{Status: 422, Message: "the message was rejected by a hook"}
 )
@@ -27,4 +27,10 @@ func TestErrors(t *testing.T) {
 	cpy := ErrBadRequest.Copy()
 	cpy.ForRequest(15)
 	assert.Equal(t, uint16(15), cpy.Request)
+
+	retry := ErrOverloaded.WithRetry(5, []string{"eu.example.com:8080"})
+	assert.Equal(t, 5, retry.RetryAfter)
+	assert.Equal(t, []string{"eu.example.com:8080"}, retry.Endpoints)
+	assert.Equal(t, 0, ErrOverloaded.RetryAfter)
+	assert.Nil(t, ErrOverloaded.Endpoints)
 }
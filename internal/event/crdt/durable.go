@@ -195,9 +195,9 @@ func (s *Durable) Range(prefix []byte, tombstones bool, f func(string, Value) bo
 
 // Count returns the number of items in the set.
 func (s *Durable) Count() (count int) {
-	s.Range(nil, true, func(k string, v Value) bool {
-		count++
-		return true
+	s.db.View(func(tx *buntdb.Tx) error {
+		count, _ = tx.Len()
+		return nil
 	})
 	return
 }
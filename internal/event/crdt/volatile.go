@@ -74,6 +74,15 @@ func (s *Volatile) Del(item string) {
 	}
 }
 
+// Put sets the value of an item as-is, along with its add and delete times. This is
+// used to build partial copies of another set.
+func (s *Volatile) Put(item string, value Value) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data[item] = value
+}
+
 // Has checks if a value is present in the set.
 func (s *Volatile) Has(item string) bool {
 	s.lock.Lock()
@@ -109,3 +109,23 @@ func TestTempMarshal(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, state, dec)
 }
+
+func TestVolatile_Put(t *testing.T) {
+	defer restoreClock(Now)
+	setClock(10)
+
+	src := NewVolatile()
+	src.Add("A", []byte("a"))
+	src.Del("B")
+
+	dst := NewVolatile()
+	src.Range(nil, true, func(k string, v Value) bool {
+		dst.Put(k, v)
+		return true
+	})
+
+	assert.Equal(t, src.Get("A"), dst.Get("A"))
+	assert.Equal(t, src.Get("B"), dst.Get("B"))
+	assert.True(t, dst.Has("A"))
+	assert.False(t, dst.Has("B"))
+}
@@ -26,6 +26,7 @@ const (
 	typeSub = uint8(iota)
 	typeBan
 	typeConn
+	typeSigner
 )
 
 // Event represents an encodable event that happened at some point in time.
@@ -39,11 +40,12 @@ type Event interface {
 
 // Subscription represents a subscription event.
 type Subscription struct {
-	Peer    uint64        `binary:"-"` // The name of the peer. This must be first, since we're doing prefix search.
-	Conn    security.ID   `binary:"-"` // The connection identifier.
-	Ssid    message.Ssid  `binary:"-"` // The SSID for the subscription.
-	User    nocopy.String // The connection username.
-	Channel nocopy.Bytes  // The channel string.
+	Peer    uint64            `binary:"-"` // The name of the peer. This must be first, since we're doing prefix search.
+	Conn    security.ID       `binary:"-"` // The connection identifier.
+	Ssid    message.Ssid      `binary:"-"` // The SSID for the subscription.
+	User    nocopy.String     // The connection username.
+	Channel nocopy.Bytes      // The channel string.
+	Meta    map[string]string `binary:"-"` // The presence metadata of the subscriber.
 }
 
 // Type retuns the unit type.
@@ -162,3 +164,36 @@ func decodeConnection(k string, v []byte) (e Connection, err error) {
 	e.Conn = security.ID(binary.BigEndian.Uint64(buffer[8:16]))
 	return e, err
 }
+
+// ------------------------------------------------------------------------------------
+
+// Signer represents the public key a peer signs the delivered messages with.
+type Signer struct {
+	Peer      uint64 `binary:"-"` // The name of the peer.
+	PublicKey []byte // The ed25519 public key of the peer.
+}
+
+// Type retuns the unit type.
+func (e *Signer) unitType() uint8 {
+	return typeSigner
+}
+
+// Key returns the event key.
+func (e Signer) Key() string {
+	buffer := make([]byte, 8)
+	binary.BigEndian.PutUint64(buffer[0:8], e.Peer)
+	return binary.ToString(&buffer)
+}
+
+// Val returns the event value.
+func (e Signer) Val() []byte {
+	return e.PublicKey
+}
+
+// decodeSigner decodes the event
+func decodeSigner(k string, v []byte) (e Signer, err error) {
+	buffer := binary.ToBytes(k)
+	e.Peer = binary.BigEndian.Uint64(buffer[0:8])
+	e.PublicKey = v
+	return e, nil
+}
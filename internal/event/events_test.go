@@ -102,6 +102,24 @@ func TestEncodeConnection(t *testing.T) {
 	assert.Equal(t, ev, dec)
 }
 
+func TestEncodeSigner(t *testing.T) {
+	ev := Signer{
+		Peer:      657,
+		PublicKey: []byte{1, 2, 3},
+	}
+
+	// Encode
+	k, v := ev.Key(), ev.Val()
+	assert.Equal(t, typeSigner, ev.unitType())
+	assert.Equal(t, []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2, 0x91}, []byte(k))
+	assert.Equal(t, []byte{1, 2, 3}, v)
+
+	// Decode
+	dec, err := decodeSigner(k, v)
+	assert.NoError(t, err)
+	assert.Equal(t, ev, dec)
+}
+
 // Benchmark_Subscription/encode-8         	 5939726	       199 ns/op	     160 B/op	       3 allocs/op
 // Benchmark_Subscription/decode-8         	 6665554	       178 ns/op	     112 B/op	       2 allocs/op
 func Benchmark_Subscription(b *testing.B) {
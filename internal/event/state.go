@@ -19,6 +19,7 @@ import (
 	"path"
 
 	"github.com/emitter-io/emitter/internal/event/crdt"
+	"github.com/emitter-io/emitter/internal/migrate"
 	"github.com/golang/snappy"
 	"github.com/kelindar/binary"
 	"github.com/weaveworks/mesh"
@@ -27,6 +28,21 @@ import (
 // Value represents an event time & value.
 type Value = crdt.Value
 
+// Format is the on-disk format of the durable state. Any change to the encoding of the
+// durable subsets must come with a migration of the existing directories.
+var Format = &migrate.Format{
+	Name: "cluster",
+	Migrations: []migrate.Migration{{
+		Version:     1,
+		Description: "version the cluster state",
+		Apply:       func(string) error { return nil },
+	}},
+}
+
+func init() {
+	migrate.Register(Format)
+}
+
 // State represents globally synchronised state.
 type State struct {
 	durable bool               // Whether the state is durable or not.
@@ -39,9 +55,10 @@ func NewState(dir string) *State {
 	return &State{
 		durable: durable,
 		subsets: map[uint8]crdt.Map{
-			typeSub:  crdt.New(durable, ""),
-			typeBan:  crdt.New(durable, fileOf(dir, "ban.db")),
-			typeConn: crdt.New(durable, ""),
+			typeSub:    crdt.New(durable, ""),
+			typeBan:    crdt.New(durable, fileOf(dir, "ban.db")),
+			typeConn:   crdt.New(durable, ""),
+			typeSigner: crdt.New(durable, ""),
 		},
 	}
 }
@@ -95,6 +112,58 @@ func (st *State) Encode() [][]byte {
 	return [][]byte{snappy.Encode(nil, encoded)}
 }
 
+// EncodeChunks serializes our complete state into a set of chunks, each of which can be
+// decoded independently and contains at most the specified number of bytes of events
+// (measured before compression). A single event larger than the limit is sent alone.
+func (st *State) EncodeChunks(maxSize int) [][]byte {
+	if maxSize <= 0 {
+		return st.Encode()
+	}
+
+	var out [][]byte
+	chunk, size := make(map[uint8]crdt.Volatile), 0
+	flush := func() {
+		if size > 0 {
+			encoded, _ := binary.Marshal(chunk)
+			out = append(out, snappy.Encode(nil, encoded))
+			chunk, size = make(map[uint8]crdt.Volatile), 0
+		}
+	}
+
+	for typ, set := range st.subsets {
+		set.Range(nil, true, func(k string, v Value) bool {
+			n := len(k) + len(v) + 20 // with the length prefixes
+			if size > 0 && size+n > maxSize {
+				flush()
+			}
+
+			subset, ok := chunk[typ]
+			if !ok {
+				subset = *crdt.NewVolatile()
+				chunk[typ] = subset
+			}
+
+			subset.Put(k, v)
+			size += n
+			return true
+		})
+	}
+
+	flush()
+	if len(out) == 0 {
+		return st.Encode()
+	}
+	return out
+}
+
+// Len returns the number of events in the state, including the removed ones.
+func (st *State) Len() (n int) {
+	for _, set := range st.subsets {
+		n += set.Count()
+	}
+	return
+}
+
 // Merge merges the other GossipData into this one,
 // and returns our resulting, complete state.
 func (st *State) Merge(other mesh.GossipData) mesh.GossipData {
@@ -163,6 +232,15 @@ func (st *State) ConnectionsOf(name mesh.PeerName, f func(*Connection)) {
 	}
 }
 
+// Signers iterates through the public keys the peers sign the messages with.
+func (st *State) Signers(f func(*Signer)) {
+	for k, v := range st.findEventsOf(typeSigner, nil, false) {
+		if ev, err := decodeSigner(k, v.Value()); err == nil {
+			f(&ev)
+		}
+	}
+}
+
 // findEventsOf ranges over the events of a specific type and copies them for concurrent usage.
 func (st *State) findEventsOf(typ uint8, prefix []byte, tombstones bool) map[string]Value {
 	events := make(map[string]Value)
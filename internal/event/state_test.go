@@ -22,6 +22,7 @@ import (
 
 	"github.com/emitter-io/emitter/internal/event/crdt"
 	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
 	"github.com/kelindar/binary/nocopy"
 	"github.com/stretchr/testify/assert"
 )
@@ -175,6 +176,19 @@ func TestConnections(t *testing.T) {
 	assert.Equal(t, 1, count)
 }
 
+func TestSigners(t *testing.T) {
+	state := NewState("")
+	state.Add(&Signer{Peer: 1, PublicKey: []byte{1}})
+	state.Add(&Signer{Peer: 2, PublicKey: []byte{2}})
+	state.Add(&Signer{Peer: 1, PublicKey: []byte{3}})
+
+	keys := make(map[uint64][]byte)
+	state.Signers(func(ev *Signer) {
+		keys[ev.Peer] = ev.PublicKey
+	})
+	assert.Equal(t, map[uint64][]byte{1: {3}, 2: {2}}, keys)
+}
+
 func countAdded(state *State) (added int) {
 	set := state.subsets[typeSub]
 	set.Range(nil, false, func(_ string, v Value) bool {
@@ -183,3 +197,34 @@ func countAdded(state *State) (added int) {
 	})
 	return
 }
+
+func TestEncodeChunks(t *testing.T) {
+	state := NewState("")
+	for i := 0; i < 100; i++ {
+		state.Add(&Subscription{
+			Peer:    1,
+			Conn:    security.ID(i),
+			Ssid:    message.Ssid{1, 2, 3},
+			Channel: nocopy.Bytes("a/b/c/"),
+		})
+	}
+
+	ban := Ban("key")
+	state.Add(&ban)
+	assert.Equal(t, 101, state.Len())
+	assert.Len(t, state.EncodeChunks(0), 1)
+
+	// Every chunk must be decodable and, together, they contain the whole state
+	chunks := state.EncodeChunks(1000)
+	assert.True(t, len(chunks) > 1)
+
+	merged := NewState("")
+	for _, chunk := range chunks {
+		dec, err := DecodeState(chunk)
+		assert.NoError(t, err)
+		merged.Merge(dec)
+	}
+
+	assert.Equal(t, 101, merged.Len())
+	assert.True(t, merged.Has(&ban))
+}
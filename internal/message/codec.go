@@ -16,18 +16,21 @@ package message
 
 import (
 	"bytes"
+	"errors"
 	"reflect"
-	"sync"
 
+	"github.com/emitter-io/emitter/internal/pool"
 	"github.com/kelindar/binary"
 )
 
+var errInvalidHeaders = errors.New("message: invalid headers")
+
 // Reusable long-lived encoder pool.
-var encoders = &sync.Pool{New: func() interface{} {
+var encoders = pool.New("message.encoders", func() interface{} {
 	return binary.NewEncoder(
 		bytes.NewBuffer(make([]byte, 0, 8*1024)),
 	)
-}}
+})
 
 type messageCodec struct{}
 
@@ -37,6 +40,7 @@ func (c *messageCodec) EncodeTo(e *binary.Encoder, rv reflect.Value) (err error)
 	channel := rv.Field(1).Bytes()
 	payload := rv.Field(2).Bytes()
 	ttl := rv.Field(3).Uint()
+	headers := rv.Field(4).Interface().(Headers)
 
 	e.WriteUvarint(uint64(len(id)))
 	e.Write(id)
@@ -44,7 +48,21 @@ func (c *messageCodec) EncodeTo(e *binary.Encoder, rv reflect.Value) (err error)
 	e.Write(channel)
 	e.WriteUvarint(uint64(len(payload)))
 	e.Write(payload)
-	e.WriteUvarint(ttl)
+	if len(headers) == 0 {
+		e.WriteUvarint(ttl)
+		return
+	}
+
+	// The headers follow the time-to-live, flagged so the messages encoded without any
+	// headers are still decoded as they used to be.
+	e.WriteUvarint(ttl | headersFlag)
+	e.WriteUvarint(uint64(len(headers)))
+	for _, k := range headers.Names() {
+		e.WriteUvarint(uint64(len(k)))
+		e.Write([]byte(k))
+		e.WriteUvarint(uint64(len(headers[k])))
+		e.Write([]byte(headers[k]))
+	}
 	return
 }
 
@@ -56,6 +74,12 @@ func (c *messageCodec) DecodeTo(d *binary.Decoder, rv reflect.Value) (err error)
 			if v.Payload, err = readBytes(d); err == nil {
 				if ttl, err := d.ReadUvarint(); err == nil {
 					v.TTL = uint32(ttl)
+					if ttl&headersFlag != 0 {
+						if v.Headers, err = readHeaders(d); err != nil {
+							return err
+						}
+					}
+
 					rv.Set(reflect.ValueOf(v))
 					return nil
 				}
@@ -72,3 +96,26 @@ func readBytes(d *binary.Decoder) (buffer []byte, err error) {
 	}
 	return
 }
+
+func readHeaders(d *binary.Decoder) (Headers, error) {
+	n, err := d.ReadUvarint()
+	if err != nil || n > MaxHeaders {
+		return nil, errInvalidHeaders
+	}
+
+	headers := make(Headers, n)
+	for i := uint64(0); i < n; i++ {
+		k, err := readBytes(d)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := readBytes(d)
+		if err != nil {
+			return nil, err
+		}
+
+		headers[string(k)] = string(v)
+	}
+	return headers, nil
+}
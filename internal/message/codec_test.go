@@ -56,6 +56,23 @@ func TestCodec_HappyPath(t *testing.T) {
 	assert.Equal(t, frame, output)
 }
 
+func TestCodec_Headers(t *testing.T) {
+	withHeaders := newTestMessage(Ssid{1, 2, 3}, "a/b/c/", "hello abc")
+	withHeaders.TTL = 30
+	withHeaders.Headers = Headers{"trace": "abc", "zone": "eu"}
+	frame := Frame{
+		withHeaders,
+		newTestMessage(Ssid{1, 2, 3}, "a/b/", "hello ab"),
+	}
+
+	// Decode
+	output, err := DecodeFrame(frame.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, frame, output)
+	assert.Equal(t, uint32(30), output[0].TTL)
+	assert.Nil(t, output[1].Headers)
+}
+
 func TestCodec_Corrupt(t *testing.T) {
 	_, err := DecodeFrame([]byte{121, 4, 3, 2, 2, 1, 5, 3, 2})
 	assert.Equal(t, "snappy: corrupt input", err.Error())
@@ -0,0 +1,109 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package message
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxHeaders is the maximum number of headers a message can carry.
+	MaxHeaders = 8
+
+	// HeaderPrefix is the prefix of the channel options which carry the headers.
+	HeaderPrefix = "h-"
+
+	// headersFlag is set in the encoded time-to-live when the headers follow it.
+	headersFlag = 1 << 32
+)
+
+// Headers represents the small key-value properties a publisher has attached to a message,
+// such as routing metadata, which are carried along with its payload.
+type Headers map[string]string
+
+// Names returns the names of the headers, sorted.
+func (h Headers) Names() []string {
+	names := make([]string, 0, len(h))
+	for k := range h {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Options returns the headers formatted as channel options (e.g: 'h-trace=abc&h-zone=eu').
+func (h Headers) Options() string {
+	var sb strings.Builder
+	for i, k := range h.Names() {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+
+		sb.WriteString(HeaderPrefix)
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(h[k])
+	}
+	return sb.String()
+}
+
+// ------------------------------------------------------------------------------------
+
+// HeaderMapping represents the headers a bridge carries across, along with the names they
+// are carried under on the other side. A nil mapping carries all of the headers unchanged.
+type HeaderMapping map[string]string
+
+// ParseHeaderMapping parses a comma-separated list of header names, each optionally renamed
+// (e.g: 'trace,zone=region'). An empty list returns a nil mapping.
+func ParseHeaderMapping(list string) HeaderMapping {
+	var mapping HeaderMapping
+	for _, v := range strings.Split(list, ",") {
+		kv := strings.SplitN(strings.TrimSpace(v), "=", 2)
+		if kv[0] == "" {
+			continue
+		}
+
+		if mapping == nil {
+			mapping = make(HeaderMapping)
+		}
+
+		mapping[kv[0]] = kv[0]
+		if len(kv) == 2 && kv[1] != "" {
+			mapping[kv[0]] = kv[1]
+		}
+	}
+	return mapping
+}
+
+// Apply returns the headers carried across, renamed. The headers which are not part of
+// the mapping are dropped.
+func (m HeaderMapping) Apply(h Headers) Headers {
+	if m == nil || len(h) == 0 {
+		return h
+	}
+
+	var out Headers
+	for k, v := range h {
+		if name, ok := m[k]; ok {
+			if out == nil {
+				out = make(Headers, len(h))
+			}
+			out[name] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaders_Options(t *testing.T) {
+	tests := []struct {
+		headers Headers
+		options string
+	}{
+		{headers: nil, options: ""},
+		{headers: Headers{"trace": "abc"}, options: "h-trace=abc"},
+		{headers: Headers{"zone": "eu", "trace": "abc"}, options: "h-trace=abc&h-zone=eu"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.options, tc.headers.Options())
+	}
+}
+
+func TestHeaderMapping(t *testing.T) {
+	headers := Headers{"trace": "abc", "zone": "eu", "user": "bob"}
+	tests := []struct {
+		list   string
+		output Headers
+	}{
+		{list: "", output: headers},
+		{list: " , ", output: headers},
+		{list: "trace", output: Headers{"trace": "abc"}},
+		{list: "trace, zone=region", output: Headers{"trace": "abc", "region": "eu"}},
+		{list: "zone=", output: Headers{"zone": "eu"}},
+		{list: "missing", output: nil},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.output, ParseHeaderMapping(tc.list).Apply(headers), tc.list)
+	}
+}
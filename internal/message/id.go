@@ -15,6 +15,7 @@
 package message
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/binary"
 	"math"
@@ -48,15 +49,22 @@ type ID []byte
 
 // NewID creates a new message identifier for the current time.
 func NewID(ssid Ssid) ID {
-	id := make(ID, len(ssid)*4+fixed)
+	return newID(ssid[0], ssid[1:])
+}
+
+// newID creates a new message identifier for the SSID made of a contract and a query,
+// without the SSID itself being allocated.
+func newID(contract uint32, query []uint32) ID {
+	id := make(ID, (len(query)+1)*4+fixed)
 	now := uint32(time.Now().Unix() - offset)
 
-	binary.BigEndian.PutUint32(id[0:4], ssid[0]^ssid[1])
+	binary.BigEndian.PutUint32(id[0:4], contract^query[0])
 	binary.BigEndian.PutUint32(id[4:8], math.MaxUint32-now)
 	binary.BigEndian.PutUint32(id[8:12], math.MaxUint32-atomic.AddUint32(&next, 1)) // Reverse order
 	binary.BigEndian.PutUint32(id[12:16], unique)
-	for i, v := range ssid {
-		binary.BigEndian.PutUint32(id[fixed+i*4:fixed+4+i*4], v)
+	binary.BigEndian.PutUint32(id[fixed:fixed+4], contract)
+	for i, v := range query {
+		binary.BigEndian.PutUint32(id[fixed+4+i*4:fixed+8+i*4], v)
 	}
 
 	return id
@@ -80,18 +88,51 @@ func (id ID) Time() int64 {
 	return int64(math.MaxUint32-binary.BigEndian.Uint32(id[4:8])) + offset
 }
 
+// Before returns whether the message was published before the other one. The messages
+// published within the same second are ordered by their sequence, which makes the order
+// of a set of messages deterministic.
+func (id ID) Before(other ID) bool {
+	if t0, t1 := id.Time(), other.Time(); t0 != t1 {
+		return t0 < t1
+	}
+
+	// The sequence is reversed, so the earlier messages have a greater ID
+	return bytes.Compare(id[8:], other[8:]) > 0
+}
+
 // Contract retrieves the contract from the message ID.
 func (id ID) Contract() uint32 {
 	return binary.BigEndian.Uint32(id[fixed : fixed+4])
 }
 
+// matches checks whether the SSID of the message ID matches the query.
+func (id ID) matches(query Ssid) bool {
+	if (len(query) * 4) > len(id)-fixed {
+		return false
+	}
+
+	// Same thing here, we iterate backwards as per assumption that the
+	// likelihood of having last element of SSID matching decreases with
+	// the depth of the SSID.
+	for i := len(query) - 1; i >= 0; i-- {
+		if query[i] != binary.BigEndian.Uint32(id[fixed+i*4:fixed+4+i*4]) && query[i] != wildcard && query[i] != multiWildcard {
+			return false
+		}
+	}
+	return true
+}
+
 // Ssid retrieves the SSID from the message ID.
 func (id ID) Ssid() Ssid {
-	ssid := make(Ssid, (len(id)-fixed)/4)
-	for i := 0; i < len(ssid); i++ {
-		ssid[i] = binary.BigEndian.Uint32(id[fixed+i*4 : fixed+4+i*4])
+	return id.appendSsid(make(Ssid, 0, (len(id)-fixed)/4))
+}
+
+// appendSsid decodes the SSID of the message identifier at the end of a buffer.
+func (id ID) appendSsid(dst Ssid) Ssid {
+	for i := fixed; i+4 <= len(id); i += 4 {
+		dst = append(dst, binary.BigEndian.Uint32(id[i:i+4]))
 	}
-	return ssid
+	return dst
 }
 
 // HasPrefix matches the prefix with the cutoff time.
@@ -101,19 +142,10 @@ func (id ID) HasPrefix(ssid Ssid, cutoff int64) bool {
 
 // Match matches the mesage ID with SSID and time bounds.
 func (id ID) Match(query Ssid, from, until int64) bool {
-	if (len(query) * 4) > len(id)-fixed {
+	if !id.matches(query) {
 		return false
 	}
 
-	// Same thing here, we iterate backwards as per assumption that the
-	// likelihood of having last element of SSID matching decreases with
-	// the depth of the SSID.
-	for i := len(query) - 1; i >= 0; i-- {
-		if query[i] != binary.BigEndian.Uint32(id[fixed+i*4:fixed+4+i*4]) && query[i] != wildcard && query[i] != multiWildcard {
-			return false
-		}
-	}
-
 	// Match time bounds at the end, as we assume that the storage starts seeking
 	// at the appropriate end and HasPrefix is called and will stop at the cutoff.
 	t := id.Time()
@@ -48,6 +48,21 @@ func TestID_HasPrefix(t *testing.T) {
 	assert.False(t, id.HasPrefix(Ssid{1, 3}, 0))
 }
 
+func TestID_Before(t *testing.T) {
+	id1 := NewID(Ssid{1, 2, 3})
+	id2 := NewID(Ssid{1, 2, 3})
+	id3 := NewID(Ssid{1, 2, 3})
+	id1.SetTime(offset + 10)
+	id2.SetTime(offset + 10)
+	id3.SetTime(offset + 5)
+
+	assert.True(t, id1.Before(id2))
+	assert.False(t, id2.Before(id1))
+	assert.False(t, id1.Before(id1))
+	assert.True(t, id3.Before(id1))
+	assert.False(t, id2.Before(id3))
+}
+
 func TestID_Match(t *testing.T) {
 	id := NewID(Ssid{1, 2, 3, 4})
 
@@ -25,10 +25,11 @@ import (
 
 // Message represents a message which has to be forwarded or stored.
 type Message struct {
-	ID      ID     `json:"id,omitempty"`   // The ID of the message
-	Channel []byte `json:"chan,omitempty"` // The channel of the message
-	Payload []byte `json:"data,omitempty"` // The payload of the message
-	TTL     uint32 `json:"ttl,omitempty"`  // The time-to-live of the message
+	ID      ID      `json:"id,omitempty"`      // The ID of the message
+	Channel []byte  `json:"chan,omitempty"`    // The channel of the message
+	Payload []byte  `json:"data,omitempty"`    // The payload of the message
+	TTL     uint32  `json:"ttl,omitempty"`     // The time-to-live of the message
+	Headers Headers `json:"headers,omitempty"` // The headers of the message
 }
 
 // New creates a new message structure from the provided SSID, channel and payload.
@@ -40,6 +41,16 @@ func New(ssid Ssid, channel, payload []byte) *Message {
 	}
 }
 
+// NewOf creates a new message structure in a contract from the query of its channel, the
+// SSID being only encoded in the identifier of the message rather than allocated.
+func NewOf(contract uint32, query []uint32, channel, payload []byte) *Message {
+	return &Message{
+		ID:      newID(contract, query),
+		Channel: channel,
+		Payload: payload,
+	}
+}
+
 // Size returns the byte size of the message.
 func (m *Message) Size() int64 {
 	return int64(len(m.Payload))
@@ -120,7 +131,7 @@ func NewFrame(capacity int) Frame {
 
 // Sort sorts the frame
 func (f Frame) Sort() {
-	sort.Slice(f, func(i, j int) bool { return f[i].Time() < f[j].Time() })
+	sort.Slice(f, func(i, j int) bool { return f[i].ID.Before(f[j].ID) })
 }
 
 // Split splits the frame by a specified number of bytes into two slices.
@@ -53,6 +53,14 @@ func TestNewMessage(t *testing.T) {
 	assert.False(t, m.Stored())
 }
 
+func TestNewMessageOf(t *testing.T) {
+	m := NewOf(1, []uint32{2, 3}, []byte("a/b/c/"), []byte("hello abc"))
+	assert.Equal(t, Ssid{1, 2, 3}, m.Ssid())
+	assert.Equal(t, uint32(1), m.Contract())
+	assert.True(t, m.ID.HasPrefix(Ssid{1, 2, 3}, 0))
+	assert.Len(t, m.ID, len(NewID(Ssid{1, 2, 3})))
+}
+
 func TestNewFrame(t *testing.T) {
 	f := NewFrame(64)
 	assert.Len(t, f, 0)
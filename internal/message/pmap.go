@@ -0,0 +1,207 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package message
+
+import (
+	"math/bits"
+)
+
+const (
+	pmapBits  = 5             // The number of bits of a key consumed by each level.
+	pmapWidth = 1 << pmapBits // The maximum number of entries of a node.
+	pmapMask  = pmapWidth - 1 // The mask of the bits of a key consumed by each level.
+)
+
+// pmap represents a persistent map of 32-bit keys, implemented as a hash array mapped trie.
+// A map is never modified once built: an update copies the branch leading to the entry it
+// changes and returns a new map, so the previous one can still be read without a lock.
+type pmap struct {
+	root *pnode // The root node, or nil if the map is empty.
+	size int    // The number of entries of the map.
+}
+
+// pnode represents a node of a persistent map, which only stores the entries whose bit is
+// set in the bitmap.
+type pnode struct {
+	bitmap  uint32
+	entries []pentry
+}
+
+// pentry represents either a value or a branch of a persistent map.
+type pentry struct {
+	key   uint32
+	value interface{}
+	next  *pnode // The branch of the entry, or nil if the entry is a value.
+}
+
+// Len returns the number of entries of the map.
+func (m pmap) Len() int {
+	return m.size
+}
+
+// Get returns the value of a key.
+func (m pmap) Get(key uint32) (interface{}, bool) {
+	for n, shift := m.root, uint(0); n != nil; shift += pmapBits {
+		bit := uint32(1) << ((key >> shift) & pmapMask)
+		if n.bitmap&bit == 0 {
+			return nil, false
+		}
+
+		e := &n.entries[n.indexOf(bit)]
+		if e.next == nil {
+			return e.value, e.key == key
+		}
+		n = e.next
+	}
+	return nil, false
+}
+
+// Has returns whether the map contains a key.
+func (m pmap) Has(key uint32) bool {
+	_, ok := m.Get(key)
+	return ok
+}
+
+// Set returns a copy of the map where the key is set to the value.
+func (m pmap) Set(key uint32, value interface{}) pmap {
+	root := m.root
+	if root == nil {
+		root = new(pnode)
+	}
+
+	root, added := root.set(0, key, value)
+	if added {
+		return pmap{root: root, size: m.size + 1}
+	}
+	return pmap{root: root, size: m.size}
+}
+
+// Delete returns a copy of the map without the key, and whether the key was found.
+func (m pmap) Delete(key uint32) (pmap, bool) {
+	if m.root == nil {
+		return m, false
+	}
+
+	root, ok := m.root.delete(0, key)
+	if !ok {
+		return m, false
+	}
+	return pmap{root: root, size: m.size - 1}, true
+}
+
+// Range calls the function for every entry of the map, until it returns false.
+func (m pmap) Range(fn func(uint32, interface{}) bool) {
+	if m.root != nil {
+		m.root.each(fn)
+	}
+}
+
+// indexOf returns the index of the entry of a bit, among the entries which are set.
+func (n *pnode) indexOf(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// set returns a copy of the node where the key is set, and whether the key was added.
+func (n *pnode) set(shift uint, key uint32, value interface{}) (*pnode, bool) {
+	bit := uint32(1) << ((key >> shift) & pmapMask)
+	i := n.indexOf(bit)
+	if n.bitmap&bit == 0 {
+		c := &pnode{bitmap: n.bitmap | bit, entries: make([]pentry, len(n.entries)+1)}
+		copy(c.entries, n.entries[:i])
+		copy(c.entries[i+1:], n.entries[i:])
+		c.entries[i] = pentry{key: key, value: value}
+		return c, true
+	}
+
+	e, added := n.entries[i], false
+	switch {
+	case e.next != nil:
+		e.next, added = e.next.set(shift+pmapBits, key, value)
+	case e.key == key:
+		e.value = value
+	default: // Another key shares the bits, both are moved to a new branch
+		next, _ := new(pnode).set(shift+pmapBits, e.key, e.value)
+		next, _ = next.set(shift+pmapBits, key, value)
+		e, added = pentry{next: next}, true
+	}
+	return n.replace(i, e), added
+}
+
+// delete returns a copy of the node without the key, and whether the key was found. The
+// node returned is nil once it no longer has any entry.
+func (n *pnode) delete(shift uint, key uint32) (*pnode, bool) {
+	bit := uint32(1) << ((key >> shift) & pmapMask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+
+	i := n.indexOf(bit)
+	e := n.entries[i]
+	if e.next == nil {
+		if e.key != key {
+			return n, false
+		}
+		return n.remove(i, bit), true
+	}
+
+	next, ok := e.next.delete(shift+pmapBits, key)
+	switch {
+	case !ok:
+		return n, false
+	case next == nil:
+		return n.remove(i, bit), true
+	case len(next.entries) == 1 && next.entries[0].next == nil: // A single value moves up
+		return n.replace(i, next.entries[0]), true
+	default:
+		e.next = next
+		return n.replace(i, e), true
+	}
+}
+
+// replace returns a copy of the node where an entry is replaced.
+func (n *pnode) replace(i int, e pentry) *pnode {
+	c := &pnode{bitmap: n.bitmap, entries: make([]pentry, len(n.entries))}
+	copy(c.entries, n.entries)
+	c.entries[i] = e
+	return c
+}
+
+// remove returns a copy of the node without an entry, or nil if it was the last one.
+func (n *pnode) remove(i int, bit uint32) *pnode {
+	if len(n.entries) == 1 {
+		return nil
+	}
+
+	c := &pnode{bitmap: n.bitmap &^ bit, entries: make([]pentry, len(n.entries)-1)}
+	copy(c.entries, n.entries[:i])
+	copy(c.entries[i:], n.entries[i+1:])
+	return c
+}
+
+// each calls the function for every value of the node and its branches, until it returns
+// false.
+func (n *pnode) each(fn func(uint32, interface{}) bool) bool {
+	for i := range n.entries {
+		e := &n.entries[i]
+		if e.next != nil {
+			if !e.next.each(fn) {
+				return false
+			}
+		} else if !fn(e.key, e.value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package message
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPmap(t *testing.T) {
+	var m pmap
+	m = m.Set(1, "a")
+	m = m.Set(1<<5|1, "b")  // Shares the bits of the first level
+	m = m.Set(1<<30|1, "c") // Only differs on the last level
+	m = m.Set(1, "d")
+
+	assert.Equal(t, 3, m.Len())
+	for key, value := range map[uint32]string{1: "d", 1<<5 | 1: "b", 1<<30 | 1: "c"} {
+		v, ok := m.Get(key)
+		assert.True(t, ok)
+		assert.Equal(t, value, v)
+	}
+
+	// A deletion leaves the previous map untouched
+	d, ok := m.Delete(1<<5 | 1)
+	assert.True(t, ok)
+	assert.Equal(t, 2, d.Len())
+	assert.False(t, d.Has(1<<5|1))
+	assert.True(t, m.Has(1<<5|1))
+
+	_, ok = d.Delete(2)
+	assert.False(t, ok)
+	assert.False(t, d.Has(1<<10|1))
+}
+
+func TestPmap_Random(t *testing.T) {
+	var m pmap
+	expect := make(map[uint32]int)
+	for i := 0; i < 20000; i++ {
+		key := rand.Uint32() % 5000
+		if i%3 == 0 {
+			var ok bool
+			m, ok = m.Delete(key)
+			_, found := expect[key]
+			assert.Equal(t, found, ok)
+			delete(expect, key)
+			continue
+		}
+
+		m = m.Set(key, i)
+		expect[key] = i
+	}
+
+	actual := make(map[uint32]int)
+	m.Range(func(key uint32, v interface{}) bool {
+		actual[key] = v.(int)
+		return true
+	})
+
+	assert.Equal(t, len(expect), m.Len())
+	assert.Equal(t, expect, actual)
+
+	// Deleting everything empties the map
+	for key := range expect {
+		m, _ = m.Delete(key)
+	}
+	assert.Equal(t, 0, m.Len())
+	assert.Nil(t, m.root)
+}
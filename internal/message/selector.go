@@ -0,0 +1,394 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package message
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxSelectorSize  = 256 // The maximum length of the text of a selector.
+	maxSelectorDepth = 16  // The maximum nesting of the conditions of a selector.
+)
+
+var errInvalidSelector = errors.New("message: invalid selector")
+
+// Selector represents an SQL-like condition on the fields of the JSON payloads, such as
+// "temperature>50 and unit='c'", which selects the messages delivered to a subscription.
+// The fields are compared with the =, !=, <>, <, <=, > and >= operators to a number, a
+// 'quoted' string, true, false or null, and the comparisons are combined with 'and', 'or',
+// 'not' and parentheses. A comparison on a missing field or on a value of another type is
+// false, as are all of them when the payload is not a JSON object.
+type Selector struct {
+	text string    // The text of the selector.
+	root condition // The condition the payloads must meet.
+}
+
+// ParseSelector parses the text of a selector.
+func ParseSelector(text string) (*Selector, error) {
+	if len(text) == 0 || len(text) > maxSelectorSize {
+		return nil, errInvalidSelector
+	}
+
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &selectorParser{tokens: tokens}
+	root, err := p.parseOr(0)
+	if err != nil || p.pos != len(p.tokens) {
+		return nil, errInvalidSelector
+	}
+
+	return &Selector{text: text, root: root}, nil
+}
+
+// String returns the text of the selector.
+func (s *Selector) String() string {
+	return s.text
+}
+
+// Matches checks whether the JSON payload meets the condition of the selector.
+func (s *Selector) Matches(payload []byte) bool {
+	var document interface{}
+	if err := json.Unmarshal(payload, &document); err != nil {
+		return false
+	}
+
+	return s.root.eval(document)
+}
+
+// ------------------------------------------------------------------------------------
+
+// condition represents a condition of a selector, evaluated on a decoded JSON document.
+type condition interface {
+	eval(document interface{}) bool
+}
+
+// andCondition is met when both of its conditions are.
+type andCondition struct{ left, right condition }
+
+func (c *andCondition) eval(doc interface{}) bool { return c.left.eval(doc) && c.right.eval(doc) }
+
+// orCondition is met when either of its conditions is.
+type orCondition struct{ left, right condition }
+
+func (c *orCondition) eval(doc interface{}) bool { return c.left.eval(doc) || c.right.eval(doc) }
+
+// notCondition is met when its condition is not.
+type notCondition struct{ inner condition }
+
+func (c *notCondition) eval(doc interface{}) bool { return !c.inner.eval(doc) }
+
+// comparison compares a field of the document to a value.
+type comparison struct {
+	path  []string    // The path of the field (e.g: 'sensor.temp').
+	op    string      // The comparison operator.
+	value interface{} // The value compared to, as decoded from JSON.
+}
+
+// eval compares the field of the document to the value.
+func (c *comparison) eval(doc interface{}) bool {
+	field, ok := lookup(doc, c.path)
+	if !ok {
+		return false
+	}
+
+	order, ok := compare(field, c.value)
+	switch {
+	case !ok:
+		return false
+	case c.op == "=":
+		return order == 0
+	case c.op == "!=":
+		return order != 0
+	}
+
+	// The values without an order can only be compared for equality
+	if _, ordered := c.value.(bool); ordered || c.value == nil {
+		return false
+	}
+
+	switch c.op {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+// lookup returns the field of the document at the path, the parts of which are the keys of
+// the objects or the indices of the arrays.
+func lookup(doc interface{}, path []string) (interface{}, bool) {
+	for _, part := range path {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			field, ok := v[part]
+			if !ok {
+				return nil, false
+			}
+			doc = field
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// compare compares two decoded JSON values and returns their order, or false if they are
+// of different types or can not be compared.
+func compare(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			if x == y {
+				return 0, true
+			}
+			return 1, true
+		}
+	case nil:
+		if b == nil {
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// ------------------------------------------------------------------------------------
+
+// tokenKind represents the kind of a token of a selector.
+type tokenKind uint8
+
+const (
+	tokenField tokenKind = iota
+	tokenValue
+	tokenOperator
+	tokenKeyword
+	tokenOpen
+	tokenClose
+)
+
+// token represents a token of a selector.
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+}
+
+// tokenize splits the text of a selector into its tokens.
+func tokenize(text string) (tokens []token, err error) {
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose})
+			i++
+		case strings.IndexByte("=!<>", c) >= 0:
+			j := i + 1
+			for j < len(text) && strings.IndexByte("=<>", text[j]) >= 0 {
+				j++
+			}
+
+			op := text[i:j]
+			switch op {
+			case "=", "==":
+				op = "="
+			case "!=", "<>":
+				op = "!="
+			case "<", "<=", ">", ">=":
+			default:
+				return nil, errInvalidSelector
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op})
+			i = j
+		case c == '\'':
+			j := strings.IndexByte(text[i+1:], '\'')
+			if j < 0 {
+				return nil, errInvalidSelector
+			}
+			tokens = append(tokens, token{kind: tokenValue, value: text[i+1 : i+1+j]})
+			i += j + 2
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(text) && (text[j] == '.' || (text[j] >= '0' && text[j] <= '9')) {
+				j++
+			}
+
+			number, err := strconv.ParseFloat(text[i:j], 64)
+			if err != nil {
+				return nil, errInvalidSelector
+			}
+			tokens = append(tokens, token{kind: tokenValue, value: number})
+			i = j
+		case isFieldChar(c):
+			j := i + 1
+			for j < len(text) && (isFieldChar(text[j]) || text[j] == '.' || (text[j] >= '0' && text[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, wordOf(text[i:j]))
+			i = j
+		default:
+			return nil, errInvalidSelector
+		}
+	}
+	return
+}
+
+// wordOf returns the token of a word, which is either a keyword, a constant or a field.
+func wordOf(word string) token {
+	switch strings.ToLower(word) {
+	case "and", "or", "not":
+		return token{kind: tokenKeyword, text: strings.ToLower(word)}
+	case "true":
+		return token{kind: tokenValue, value: true}
+	case "false":
+		return token{kind: tokenValue, value: false}
+	case "null":
+		return token{kind: tokenValue, value: nil}
+	default:
+		return token{kind: tokenField, text: word}
+	}
+}
+
+// isFieldChar checks whether the byte can start the name of a field.
+func isFieldChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+// ------------------------------------------------------------------------------------
+
+// selectorParser parses the tokens of a selector, by order of precedence of the operators.
+type selectorParser struct {
+	tokens []token
+	pos    int
+}
+
+// next returns the next token without consuming it.
+func (p *selectorParser) next() (token, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return token{}, false
+}
+
+// accept consumes the next token if it is of the specified kind and text.
+func (p *selectorParser) accept(kind tokenKind, text string) bool {
+	if t, ok := p.next(); ok && t.kind == kind && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// parseOr parses a disjunction of conjunctions.
+func (p *selectorParser) parseOr(depth int) (condition, error) {
+	left, err := p.parseAnd(depth)
+	for err == nil && p.accept(tokenKeyword, "or") {
+		var right condition
+		if right, err = p.parseAnd(depth); err == nil {
+			left = &orCondition{left, right}
+		}
+	}
+	return left, err
+}
+
+// parseAnd parses a conjunction of negations.
+func (p *selectorParser) parseAnd(depth int) (condition, error) {
+	left, err := p.parseNot(depth)
+	for err == nil && p.accept(tokenKeyword, "and") {
+		var right condition
+		if right, err = p.parseNot(depth); err == nil {
+			left = &andCondition{left, right}
+		}
+	}
+	return left, err
+}
+
+// parseNot parses a negation, a comparison or a parenthesized condition.
+func (p *selectorParser) parseNot(depth int) (condition, error) {
+	if depth > maxSelectorDepth {
+		return nil, errInvalidSelector
+	}
+
+	if p.accept(tokenKeyword, "not") {
+		inner, err := p.parseNot(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &notCondition{inner}, nil
+	}
+
+	if p.accept(tokenOpen, "") {
+		inner, err := p.parseOr(depth + 1)
+		if err != nil || !p.accept(tokenClose, "") {
+			return nil, errInvalidSelector
+		}
+		return inner, nil
+	}
+
+	return p.parseComparison()
+}
+
+// parseComparison parses the comparison of a field to a value.
+func (p *selectorParser) parseComparison() (condition, error) {
+	if p.pos+3 > len(p.tokens) {
+		return nil, errInvalidSelector
+	}
+
+	field, op, value := p.tokens[p.pos], p.tokens[p.pos+1], p.tokens[p.pos+2]
+	if field.kind != tokenField || op.kind != tokenOperator || value.kind != tokenValue {
+		return nil, errInvalidSelector
+	}
+
+	p.pos += 3
+	return &comparison{
+		path:  strings.Split(field.text, "."),
+		op:    op.text,
+		value: value.value,
+	}, nil
+}
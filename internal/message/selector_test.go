@@ -0,0 +1,93 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package message
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		text string
+		ok   bool
+	}{
+		{text: "temp>50", ok: true},
+		{text: "temp >= -2.5 and unit = 'celsius'", ok: true},
+		{text: "not (a.b == true or c <> null)", ok: true},
+		{text: "NOT a=1 AND b!=2", ok: true},
+		{text: ""},
+		{text: "temp"},
+		{text: "temp>"},
+		{text: "50>temp"},
+		{text: "temp=>50"},
+		{text: "temp>50 and"},
+		{text: "(temp>50"},
+		{text: "temp>50)"},
+		{text: "unit='celsius"},
+		{text: "temp>1.2.3"},
+		{text: "temp>50 & hum<30"},
+		{text: strings.Repeat("(", 20) + "a=1" + strings.Repeat(")", 20)},
+		{text: "a=" + strings.Repeat("1", 300)},
+	}
+
+	for _, tc := range tests {
+		s, err := ParseSelector(tc.text)
+		assert.Equal(t, tc.ok, err == nil, tc.text)
+		if tc.ok {
+			assert.Equal(t, tc.text, s.String())
+		}
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	payload := []byte(`{"temp":60.5,"unit":"celsius","ok":true,"tag":null,"sensor":{"id":"s1"},"values":[1,2,3]}`)
+	tests := []struct {
+		text  string
+		match bool
+	}{
+		{text: "temp>50", match: true},
+		{text: "temp>60.5", match: false},
+		{text: "temp>=60.5", match: true},
+		{text: "temp<=-1", match: false},
+		{text: "temp=60.5 and unit='celsius'", match: true},
+		{text: "unit<'d'", match: true},
+		{text: "unit!='celsius' or temp<0", match: false},
+		{text: "not unit='kelvin'", match: true},
+		{text: "ok=true", match: true},
+		{text: "ok>false", match: false},
+		{text: "tag=null", match: true},
+		{text: "tag!=null", match: false},
+		{text: "sensor.id='s1'", match: true},
+		{text: "values.1=2", match: true},
+		{text: "values.5=2", match: false},
+		{text: "missing=1", match: false},
+		{text: "missing!=1", match: false},
+		{text: "unit>50", match: false},
+		{text: "(temp>100 or ok=true) and (unit='celsius')", match: true},
+	}
+
+	for _, tc := range tests {
+		s, err := ParseSelector(tc.text)
+		assert.NoError(t, err, tc.text)
+		assert.Equal(t, tc.match, s.Matches(payload), tc.text)
+	}
+
+	s, _ := ParseSelector("temp>50")
+	assert.False(t, s.Matches([]byte("not json")))
+	assert.False(t, s.Matches([]byte(`[{"temp":60}]`)))
+}
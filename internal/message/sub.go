@@ -18,12 +18,20 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
+	"github.com/emitter-io/emitter/internal/pool"
 	"github.com/emitter-io/emitter/internal/security/hash"
 )
 
+// The parameters of the 32-bit FNV-1a hash of the SSIDs.
+const (
+	fnvOffset = 2166136261
+	fnvPrime  = 16777619
+)
+
 // Various constant parts of the SSID.
 const (
 	system        = uint32(0)
@@ -32,6 +40,9 @@ const (
 	wildcard      = uint32(1815237614) // +
 	multiWildcard = uint32(4285801373) // #
 	share         = uint32(1480642916)
+	shadow        = uint32(2573690252) // $shadow
+	stats         = uint32(3983931205) // $stats
+	kv            = uint32(4238512124) // $kv
 )
 
 // Query represents a constant SSID for a query.
@@ -67,20 +78,62 @@ func NewSsidForShare(original Ssid) Ssid {
 	return ssid
 }
 
+// NewSsidForShadow creates a new SSID for the shadow document of a channel. The SSID is
+// terminated by the shadow part as well, so the documents of the sub-channels do not match.
+func NewSsidForShadow(original Ssid) Ssid {
+	ssid := make([]uint32, 0, len(original)+2)
+	ssid = append(ssid, original[0])
+	ssid = append(ssid, shadow)
+	ssid = append(ssid, original[1:]...)
+	ssid = append(ssid, shadow)
+	return ssid
+}
+
+// NewSsidForStats creates a new SSID for the retained statistics of a channel or of a
+// subscription pattern. The channel is hashed as a whole, so that the statistics of the
+// patterns and of the sub-channels do not match each other.
+func NewSsidForStats(contract uint32, channel []byte) Ssid {
+	return Ssid{contract, stats, hash.Of(channel), stats}
+}
+
+// NewSsidForKey creates a new SSID for a key of the key-value store of a contract. The key
+// is hashed as a whole, so the keys which hash the same must be told apart by the caller.
+func NewSsidForKey(contract uint32, key string) Ssid {
+	return Ssid{contract, kv, hash.OfString(key), kv}
+}
+
 // Contract gets the contract part from SSID.
 func (s Ssid) Contract() uint32 {
 	return uint32(s[0])
 }
 
-// GetHashCode combines the SSID into a single hash.
+// GetHashCode combines the SSID into a single FNV-1a hash. The hash depends on the order
+// of the parts, so the permutations of a channel (e.g: "a/b/" and "b/a/") do not collide.
 func (s Ssid) GetHashCode() uint32 {
-	h := s[0]
-	for _, i := range s[1:] {
-		h ^= i
+	h := uint32(fnvOffset)
+	for _, v := range s {
+		h = (h ^ (v & 0xff)) * fnvPrime
+		h = (h ^ (v >> 8 & 0xff)) * fnvPrime
+		h = (h ^ (v >> 16 & 0xff)) * fnvPrime
+		h = (h ^ (v >> 24)) * fnvPrime
 	}
 	return h
 }
 
+// Equals returns whether both SSIDs are made of the same parts.
+func (s Ssid) Equals(other Ssid) bool {
+	if len(s) != len(other) {
+		return false
+	}
+
+	for i, v := range s {
+		if other[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
 // Encode encodes the SSID to a binary format
 func (s Ssid) Encode() string {
 	bin := make([]byte, 4)
@@ -114,6 +167,7 @@ func unsafeToString(bs []byte) string {
 // Awaiter represents an asynchronously awaiting response channel.
 type Awaiter interface {
 	Gather(time.Duration) [][]byte
+	Expected() int
 }
 
 // ------------------------------------------------------------------------------------
@@ -137,18 +191,41 @@ type Subscriber interface {
 
 // ------------------------------------------------------------------------------------
 
-// Subscribers represents a subscriber set which can contain only unique values.
-type Subscribers map[uint32]Subscriber
+// Subscribers represents a subscriber set which can contain only unique values, by their
+// identifier.
+type Subscribers map[string]Subscriber
 
 // NewSubscribers creates a new set of subscribers.
 func newSubscribers() Subscribers {
 	return make(Subscribers, 16)
 }
 
+// maxReleased is the size above which a released set of subscribers is left to the GC
+// rather than kept in the pool.
+const maxReleased = 1024
+
+// lookups are the reusable sets of subscribers returned by the lookups.
+var lookups = pool.New("message.subscribers", func() interface{} {
+	return newSubscribers()
+})
+
+// Release clears the set of subscribers and returns it to the pool, once the lookup which
+// returned it is no longer used.
+func (s Subscribers) Release() {
+	if len(s) > maxReleased {
+		return
+	}
+
+	for k := range s {
+		delete(s, k)
+	}
+	lookups.Put(s)
+}
+
 // AddUnique adds a subscriber to the set.
 func (s *Subscribers) AddUnique(value Subscriber) bool {
 	if value != nil {
-		key := hash.OfString(value.ID())
+		key := value.ID()
 		if _, found := (*s)[key]; !found {
 			(*s)[key] = value
 			return true
@@ -166,10 +243,22 @@ func (s *Subscribers) AddRange(from Subscribers, filter func(s Subscriber) bool)
 	}
 }
 
+// addFrom adds the subscribers of the buckets of a persistent map, with filter applied.
+func (s *Subscribers) addFrom(from pmap, filter func(s Subscriber) bool) {
+	from.Range(func(_ uint32, v interface{}) bool {
+		for _, e := range v.(bucket) {
+			if filter == nil || filter(e.sub) {
+				(*s)[e.id] = e.sub // This would simply overwrite duplicates
+			}
+		}
+		return true
+	})
+}
+
 // Remove removes a subscriber from the set.
 func (s *Subscribers) Remove(value Subscriber) bool {
 	if value != nil {
-		key := hash.OfString(value.ID())
+		key := value.ID()
 		if _, ok := (*s)[key]; ok {
 			delete(*s, key)
 			return true
@@ -206,8 +295,7 @@ func (s *Subscribers) Random(rnd uint32) (v Subscriber) {
 
 // Contains checks whether a subscriber is in the set.
 func (s *Subscribers) Contains(value Subscriber) (ok bool) {
-	key := hash.OfString(value.ID())
-	_, ok = (*s)[key]
+	_, ok = (*s)[value.ID()]
 	return
 }
 
@@ -219,48 +307,112 @@ type Subscription struct {
 
 // ------------------------------------------------------------------------------------
 
-// Counters represents a subscription counting map.
+const (
+	counterShards = 16   // The number of shards of the subscription counters.
+	maxRoutes     = 1024 // The maximum number of channels whose routes are kept.
+)
+
+// Counters represents a subscription counting map. The counters are sharded by the hash of
+// their SSID, so the subscriptions to different channels do not contend on a single lock.
 type Counters struct {
+	shards [counterShards]counterShard
+	routes routes // The subscriptions matched by the channels of the delivered messages.
+	next   uint32 // The last subscription identifier assigned.
+}
+
+// counterShard represents a shard of the subscription counters. The shard keeps a copy of
+// its counters, only rebuilt once they changed, so that listing them does not need to
+// wait for the lock. The counters are keyed by the hash of their SSID, along with the
+// other counters whose SSID hashes the same.
+type counterShard struct {
 	sync.Mutex
-	m map[uint32]*Counter
+	m     map[uint32][]*Counter
+	size  int32        // The number of counters, readable without the lock.
+	clone atomic.Value // The copy of the counters as a *[]Counter, or nil once changed.
 }
 
 // Counter represents a single subscription counter.
 type Counter struct {
-	Ssid    Ssid
-	Channel []byte
-	Counter int
+	ID        uint32 // The identifier of the subscription, stable while subscribed.
+	Ssid      Ssid
+	Channel   []byte
+	Counter   int
+	Delivered int64             // The number of messages attributed to this subscription.
+	Offset    int64             // The unix time of the last message attributed to this subscription.
+	NoEcho    bool              // Whether the messages published by the subscriber itself are excluded.
+	Meta      map[string]string // The presence metadata attached to the subscription, if any.
+	Filter    *Selector         // The selector of the messages delivered, if any.
+	Expires   int64             // The unix time the key of the subscription expires at, zero if it does not.
+	Warned    bool              // Whether the subscriber was warned about the expiry of the key.
+	delivery  *delivery         // The messages attributed to this subscription, updated atomically.
+}
+
+// delivery represents the messages attributed to a subscription, which are counted
+// atomically as they are delivered, without taking the lock of the counters.
+type delivery struct {
+	count  int64 // The number of messages attributed.
+	offset int64 // The unix time of the last message attributed.
+}
+
+// attribute attributes a message published at the specified unix time.
+func (d *delivery) attribute(t int64) {
+	atomic.AddInt64(&d.count, 1)
+	for {
+		offset := atomic.LoadInt64(&d.offset)
+		if t <= offset || atomic.CompareAndSwapInt64(&d.offset, offset, t) {
+			return
+		}
+	}
+}
+
+// snapshot returns a copy of the counter, along with the messages attributed to it.
+func (c *Counter) snapshot() Counter {
+	out := *c
+	if c.delivery != nil {
+		out.Delivered = atomic.LoadInt64(&c.delivery.count)
+		out.Offset = atomic.LoadInt64(&c.delivery.offset)
+	}
+	return out
 }
 
 // NewCounters creates a new container.
 func NewCounters() *Counters {
-	return &Counters{
-		m: make(map[uint32]*Counter),
+	s := new(Counters)
+	for i := range s.shards {
+		s.shards[i].m = make(map[uint32][]*Counter)
+		s.shards[i].clone.Store((*[]Counter)(nil))
 	}
+	return s
 }
 
 // Increment increments the subscription counter.
 func (s *Counters) Increment(ssid Ssid, channel []byte) (first bool) {
-	s.Lock()
-	defer s.Unlock()
+	key := ssid.GetHashCode()
+	shard := s.shardOf(key)
+	shard.Lock()
+	defer shard.Unlock()
 
-	m := s.getOrCreate(ssid, channel)
+	m := s.getOrCreate(shard, key, ssid, channel)
 	m.Counter++
+	shard.changed()
 	return m.Counter == 1
 }
 
 // Decrement decrements a subscription counter.
 func (s *Counters) Decrement(ssid Ssid) (last bool) {
-	s.Lock()
-	defer s.Unlock()
-
 	key := ssid.GetHashCode()
-	if m, exists := s.m[key]; exists {
+	shard := s.shardOf(key)
+	shard.Lock()
+	defer shard.Unlock()
+
+	if m := shard.find(key, ssid); m != nil {
 		m.Counter--
+		shard.changed()
 
 		// Remove if there's no subscribers left
 		if m.Counter <= 0 {
-			delete(s.m, ssid.GetHashCode())
+			shard.remove(key, m)
+			s.routes.reset()
 			return true
 		}
 	}
@@ -268,31 +420,355 @@ func (s *Counters) Decrement(ssid Ssid) (last bool) {
 	return false
 }
 
-// All returns all counters.
-func (s *Counters) All() []Counter {
-	s.Lock()
-	defer s.Unlock()
+// Get returns the counter of the subscription with the specified SSID.
+func (s *Counters) Get(ssid Ssid) (Counter, bool) {
+	key := ssid.GetHashCode()
+	shard := s.shardOf(key)
+	shard.Lock()
+	defer shard.Unlock()
 
-	clone := make([]Counter, 0, len(s.m))
-	for _, m := range s.m {
-		clone = append(clone, *m)
+	if m := shard.find(key, ssid); m != nil {
+		return m.snapshot(), true
 	}
+	return Counter{}, false
+}
 
-	return clone
+// GetByID returns the counter of the subscription with the specified identifier.
+func (s *Counters) GetByID(id uint32) (counter Counter, found bool) {
+	s.each(func(_ *counterShard, m *Counter) bool {
+		if m.ID == id {
+			counter, found = m.snapshot(), true
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// SetMeta sets the presence metadata attached to the subscription with the specified SSID.
+func (s *Counters) SetMeta(ssid Ssid, meta map[string]string) {
+	key := ssid.GetHashCode()
+	shard := s.shardOf(key)
+	shard.Lock()
+	defer shard.Unlock()
+
+	if m := shard.find(key, ssid); m != nil {
+		m.Meta = meta
+		shard.changed()
+	}
 }
 
-// getOrCreate retrieves a single subscription meter or creates a new one.
-func (s *Counters) getOrCreate(ssid Ssid, channel []byte) (meter *Counter) {
+// SetNoEcho sets whether the messages published by the subscriber itself are excluded
+// from the subscription with the specified SSID.
+func (s *Counters) SetNoEcho(ssid Ssid, noEcho bool) {
 	key := ssid.GetHashCode()
-	if m, exists := s.m[key]; exists {
+	shard := s.shardOf(key)
+	shard.Lock()
+	defer shard.Unlock()
+
+	if m := shard.find(key, ssid); m != nil {
+		m.NoEcho = noEcho
+		shard.changed()
+		s.routes.reset()
+	}
+}
+
+// Echoes returns whether a message published by the subscriber itself should be delivered
+// back to it, which is the case unless all of the subscriptions it matches exclude it.
+func (s *Counters) Echoes(id ID) bool {
+	r := s.route(id)
+	return len(r.matched) == 0 || r.echoes
+}
+
+// SetFilter sets the selector of the messages delivered through the subscription with the
+// specified SSID, or removes it if nil.
+func (s *Counters) SetFilter(ssid Ssid, filter *Selector) {
+	key := ssid.GetHashCode()
+	shard := s.shardOf(key)
+	shard.Lock()
+	defer shard.Unlock()
+
+	if m := shard.find(key, ssid); m != nil {
+		m.Filter = filter
+		shard.changed()
+		s.routes.reset()
+	}
+}
+
+// SetExpires sets the unix time the key of the subscription with the specified SSID expires
+// at, or zero if it does not. Since the key may have been renewed, the subscriber can be
+// warned about its expiry again.
+func (s *Counters) SetExpires(ssid Ssid, expires int64) {
+	key := ssid.GetHashCode()
+	shard := s.shardOf(key)
+	shard.Lock()
+	defer shard.Unlock()
+
+	if m := shard.find(key, ssid); m != nil {
+		m.Expires = expires
+		m.Warned = false
+		shard.changed()
+	}
+}
+
+// Expiring returns the subscriptions whose key expires before the deadline and whose
+// subscriber was not warned about it yet, marking them as warned.
+func (s *Counters) Expiring(deadline int64) (expiring []Counter) {
+	s.each(func(shard *counterShard, m *Counter) bool {
+		if m.Expires > 0 && m.Expires <= deadline && !m.Warned {
+			m.Warned = true
+			expiring = append(expiring, m.snapshot())
+			shard.changed()
+		}
+		return true
+	})
+	return
+}
+
+// Selects returns whether a message should be delivered to the subscriber, which is the case
+// unless all of the subscriptions it matches have a selector its payload does not meet.
+func (s *Counters) Selects(id ID, payload []byte) bool {
+	r := s.route(id)
+	if len(r.matched) == 0 || r.unfiltered {
+		return true
+	}
+
+	for _, filter := range r.filters {
+		if filter.Matches(payload) {
+			return true
+		}
+	}
+	return false
+}
+
+// Attribute attributes a delivered message to the subscriptions it matched.
+func (s *Counters) Attribute(id ID) {
+	r := s.route(id)
+	if len(r.matched) == 0 {
+		return
+	}
+
+	t := id.Time()
+	for _, d := range r.matched {
+		d.attribute(t)
+	}
+}
+
+// route returns the subscriptions matched by the channel of the message, which are only
+// looked up once per channel until the subscriptions change.
+func (s *Counters) route(id ID) *route {
+	if len(id) < fixed {
+		return noRoute
+	}
+
+	key := id[fixed:]
+	if r, ok := s.routes.get(key); ok {
+		return r
+	}
+
+	gen := s.routes.generation()
+	r := new(route)
+	s.each(func(_ *counterShard, m *Counter) bool {
+		if id.matches(m.Ssid) {
+			r.matched = append(r.matched, m.delivery)
+			r.echoes = r.echoes || !m.NoEcho
+			if m.Filter == nil {
+				r.unfiltered = true
+			} else {
+				r.filters = append(r.filters, m.Filter)
+			}
+		}
+		return true
+	})
+
+	s.routes.put(key, r, gen)
+	return r
+}
+
+// All returns all counters. The counters of the shards which did not change since they
+// were last listed are copied without taking their lock, along with the messages which
+// were attributed to them.
+func (s *Counters) All() []Counter {
+	clone := make([]Counter, 0, s.Count())
+	for i := range s.shards {
+		for _, c := range s.shards[i].all() {
+			clone = append(clone, c.snapshot())
+		}
+	}
+
+	return clone
+}
+
+// Count returns the number of subscriptions counted.
+func (s *Counters) Count() (n int) {
+	for i := range s.shards {
+		n += int(atomic.LoadInt32(&s.shards[i].size))
+	}
+	return
+}
+
+// shardOf returns the shard of the counter with the specified key.
+func (s *Counters) shardOf(key uint32) *counterShard {
+	return &s.shards[key%counterShards]
+}
+
+// each calls the function on each of the counters, under the lock of their shard, until
+// it returns false. The shards which are empty are skipped without taking their lock.
+func (s *Counters) each(fn func(*counterShard, *Counter) bool) {
+	for i := range s.shards {
+		shard := &s.shards[i]
+		if atomic.LoadInt32(&shard.size) == 0 {
+			continue
+		}
+
+		shard.Lock()
+		next := shard.each(fn)
+		shard.Unlock()
+		if !next {
+			return
+		}
+	}
+}
+
+// getOrCreate retrieves a single subscription meter or creates a new one, must be called
+// under the lock of the shard.
+func (s *Counters) getOrCreate(shard *counterShard, key uint32, ssid Ssid, channel []byte) (meter *Counter) {
+	if m := shard.find(key, ssid); m != nil {
 		return m
 	}
 
 	meter = &Counter{
-		Ssid:    ssid,
-		Channel: channel,
-		Counter: 0,
+		ID:       atomic.AddUint32(&s.next, 1),
+		Ssid:     ssid,
+		Channel:  channel,
+		Counter:  0,
+		delivery: new(delivery),
 	}
-	s.m[key] = meter
+	shard.m[key] = append(shard.m[key], meter)
+	atomic.AddInt32(&shard.size, 1)
+	shard.changed()
+	s.routes.reset()
 	return
 }
+
+// find returns the counter of the SSID with the specified hash, or nil if there is none.
+func (c *counterShard) find(key uint32, ssid Ssid) *Counter {
+	for _, m := range c.m[key] {
+		if m.Ssid.Equals(ssid) {
+			return m
+		}
+	}
+	return nil
+}
+
+// remove removes a counter from the shard, keeping the others whose SSID hashes the same.
+func (c *counterShard) remove(key uint32, counter *Counter) {
+	chain := c.m[key]
+	for i, m := range chain {
+		if m == counter {
+			chain = append(chain[:i], chain[i+1:]...)
+			break
+		}
+	}
+
+	if len(chain) == 0 {
+		delete(c.m, key)
+	} else {
+		c.m[key] = chain
+	}
+	atomic.AddInt32(&c.size, -1)
+}
+
+// each calls the function on each of the counters of the shard until it returns false,
+// and returns whether it went through all of them.
+func (c *counterShard) each(fn func(*counterShard, *Counter) bool) bool {
+	for _, chain := range c.m {
+		for _, m := range chain {
+			if !fn(c, m) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// changed discards the copy of the counters of the shard, must be called under its lock.
+func (c *counterShard) changed() {
+	c.clone.Store((*[]Counter)(nil))
+}
+
+// all returns a copy of the counters of the shard, which is only rebuilt once they changed.
+func (c *counterShard) all() []Counter {
+	if clone := c.clone.Load().(*[]Counter); clone != nil {
+		return *clone
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	clone := make([]Counter, 0, atomic.LoadInt32(&c.size))
+	c.each(func(_ *counterShard, m *Counter) bool {
+		clone = append(clone, *m)
+		return true
+	})
+
+	c.clone.Store(&clone)
+	return clone
+}
+
+// ------------------------------------------------------------------------------------
+
+// noRoute represents the route of a message which matches none of the subscriptions.
+var noRoute = new(route)
+
+// route represents the subscriptions matched by a channel.
+type route struct {
+	matched    []*delivery // The deliveries of the subscriptions matched.
+	filters    []*Selector // The selectors of the subscriptions matched.
+	unfiltered bool        // Whether one of the subscriptions matched has no selector.
+	echoes     bool        // Whether one of the subscriptions matched does not exclude echoes.
+}
+
+// routes represents the routes of the channels, discarded once the subscriptions change.
+type routes struct {
+	sync.RWMutex
+	m   map[string]*route // The routes, keyed by the SSID of the channel.
+	gen uint64            // The generation of the routes, incremented once discarded.
+}
+
+// get returns the route of the SSID of a channel.
+func (r *routes) get(key []byte) (*route, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	v, ok := r.m[string(key)]
+	return v, ok
+}
+
+// generation returns the current generation of the routes.
+func (r *routes) generation() uint64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.gen
+}
+
+// put stores the route of the SSID of a channel, unless the routes were discarded since the
+// route was looked up.
+func (r *routes) put(key []byte, v *route, gen uint64) {
+	r.Lock()
+	defer r.Unlock()
+	if r.gen != gen {
+		return
+	}
+
+	if r.m == nil || len(r.m) >= maxRoutes {
+		r.m = make(map[string]*route)
+	}
+	r.m[string(key)] = v
+}
+
+// reset discards all of the routes.
+func (r *routes) reset() {
+	r.Lock()
+	defer r.Unlock()
+	r.m = nil
+	r.gen++
+}
@@ -16,10 +16,13 @@ package message
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
+	"sync"
 	"testing"
 
 	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/security/hash"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,6 +48,32 @@ func TestSsidShare(t *testing.T) {
 	assert.EqualValues(t, Ssid{1, share, 2, 3}, ssid)
 }
 
+func TestSsidShadow(t *testing.T) {
+	ssid := NewSsidForShadow(Ssid{1, 2, 3})
+	assert.EqualValues(t, Ssid{1, shadow, 2, 3, shadow}, ssid)
+
+	// The documents of the sub-channels must not match
+	id := NewID(NewSsidForShadow(Ssid{1, 2, 3, 4}))
+	assert.False(t, id.Match(ssid, 0, math.MaxInt64))
+	assert.True(t, NewID(ssid).Match(ssid, 0, math.MaxInt64))
+}
+
+func TestSsidStats(t *testing.T) {
+	ssid := NewSsidForStats(1, []byte("a/b/"))
+	assert.EqualValues(t, Ssid{1, stats, hash.OfString("a/b/"), stats}, ssid)
+
+	// The statistics of the sub-channels must not match
+	id := NewID(NewSsidForStats(1, []byte("a/b/c/")))
+	assert.False(t, id.Match(ssid, 0, math.MaxInt64))
+	assert.True(t, NewID(ssid).Match(ssid, 0, math.MaxInt64))
+}
+
+func TestSsidKey(t *testing.T) {
+	ssid := NewSsidForKey(1, "counter")
+	assert.EqualValues(t, Ssid{1, kv, hash.OfString("counter"), kv}, ssid)
+	assert.NotEqual(t, ssid, NewSsidForKey(2, "counter"))
+}
+
 func TestSsid(t *testing.T) {
 	c := security.Channel{
 		Key:         []byte("key"),
@@ -56,7 +85,21 @@ func TestSsid(t *testing.T) {
 
 	ssid := NewSsid(0, c.Query)
 	assert.Equal(t, uint32(0), ssid.Contract())
-	assert.Equal(t, uint32(0x2c), ssid.GetHashCode())
+	assert.Equal(t, uint32(0x75694589), ssid.GetHashCode())
+}
+
+func TestSsid_GetHashCode(t *testing.T) {
+	a, b := hash.OfString("a"), hash.OfString("b")
+	assert.NotEqual(t, Ssid{1, a, b}.GetHashCode(), Ssid{1, b, a}.GetHashCode())
+	assert.NotEqual(t, Ssid{1, a, a}.GetHashCode(), Ssid{1, b, b}.GetHashCode())
+	assert.NotEqual(t, Ssid{1, a}.GetHashCode(), Ssid{1, a, 0}.GetHashCode())
+	assert.Equal(t, Ssid{1, a, b}.GetHashCode(), NewSsid(1, []uint32{a, b}).GetHashCode())
+}
+
+func TestSsid_Equals(t *testing.T) {
+	assert.True(t, Ssid{1, 2}.Equals(Ssid{1, 2}))
+	assert.False(t, Ssid{1, 2}.Equals(Ssid{2, 1}))
+	assert.False(t, Ssid{1, 2}.Equals(Ssid{1, 2, 3}))
 }
 
 func TestSsidEncode(t *testing.T) {
@@ -82,8 +125,9 @@ func TestSsidEncode(t *testing.T) {
 
 func TestSub_NewCounters(t *testing.T) {
 	counters := NewCounters()
-	assert.NotNil(t, counters.m)
-	assert.Empty(t, counters.m)
+	assert.NotNil(t, counters.shards[0].m)
+	assert.Empty(t, counters.shards[0].m)
+	assert.Equal(t, 0, counters.Count())
 }
 
 func TestSub_getOrCreate(t *testing.T) {
@@ -93,12 +137,13 @@ func TestSub_getOrCreate(t *testing.T) {
 	key := (Ssid(ssid)).GetHashCode()
 
 	// Call.
-	createdCounter := counters.getOrCreate(ssid, []byte("test"))
+	createdCounter := counters.getOrCreate(counters.shardOf(key), key, ssid, []byte("test"))
 
 	// Assertions.
-	assert.NotEmpty(t, counters.m)
+	assert.NotEmpty(t, counters.shardOf(key).m)
+	assert.Equal(t, 1, counters.Count())
 
-	counter := counters.m[key]
+	counter := counters.shardOf(key).find(key, ssid)
 	assert.NotEmpty(t, counter)
 	assert.Equal(t, counter, createdCounter)
 
@@ -107,6 +152,151 @@ func TestSub_getOrCreate(t *testing.T) {
 	assert.Equal(t, counter.Ssid, Ssid(ssid))
 }
 
+func TestSub_CountersByID(t *testing.T) {
+	counters := NewCounters()
+	counters.Increment(Ssid{1, 2}, []byte("a/"))
+	counters.Increment(Ssid{1, 3}, []byte("b/"))
+	counters.Increment(Ssid{1, 2}, []byte("a/"))
+
+	a, ok := counters.Get(Ssid{1, 2})
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1), a.ID)
+	assert.Equal(t, 2, a.Counter)
+
+	b, ok := counters.GetByID(2)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("b/"), b.Channel)
+
+	// Identifiers are not reused once the subscription is removed
+	counters.Decrement(Ssid{1, 3})
+	_, ok = counters.GetByID(2)
+	assert.False(t, ok)
+	counters.Increment(Ssid{1, 3}, []byte("b/"))
+	b, _ = counters.Get(Ssid{1, 3})
+	assert.Equal(t, uint32(3), b.ID)
+}
+
+func TestSub_Attribute(t *testing.T) {
+	counters := NewCounters()
+	counters.Increment(Ssid{1, 2}, []byte("a/"))
+	counters.Increment(Ssid{1, 2, wildcard}, []byte("a/+/"))
+	counters.Increment(Ssid{1, 3}, []byte("b/"))
+
+	counters.Attribute(NewID(Ssid{1, 2, 4}))
+	counters.Attribute(NewID(Ssid{1, 2, 4}))
+	counters.Attribute(nil)
+
+	a, _ := counters.Get(Ssid{1, 2})
+	assert.Equal(t, int64(2), a.Delivered)
+	assert.NotZero(t, a.Offset)
+	w, _ := counters.GetByID(2)
+	assert.Equal(t, int64(2), w.Delivered)
+	b, _ := counters.Get(Ssid{1, 3})
+	assert.Equal(t, int64(0), b.Delivered)
+
+	// A new subscription discards the routes, so the next messages are attributed to it
+	counters.Increment(Ssid{1, 2, 4}, []byte("a/b/"))
+	counters.Attribute(NewID(Ssid{1, 2, 4}))
+	c, _ := counters.Get(Ssid{1, 2, 4})
+	assert.Equal(t, int64(1), c.Delivered)
+	a, _ = counters.Get(Ssid{1, 2})
+	assert.Equal(t, int64(3), a.Delivered)
+
+	// Once removed, the messages are no longer attributed to it
+	counters.Decrement(Ssid{1, 2, 4})
+	counters.Attribute(NewID(Ssid{1, 2, 4}))
+	a, _ = counters.Get(Ssid{1, 2})
+	assert.Equal(t, int64(4), a.Delivered)
+}
+
+func TestSub_AttributeUnchanged(t *testing.T) {
+	counters := NewCounters()
+	counters.Increment(Ssid{1, 2}, []byte("a/"))
+	before := counters.All()
+
+	// Delivering a message must not discard the copies of the shards
+	counters.Attribute(NewID(Ssid{1, 2}))
+	for i := range counters.shards {
+		if counters.shards[i].size > 0 {
+			assert.NotNil(t, counters.shards[i].clone.Load().(*[]Counter))
+		}
+	}
+
+	after := counters.All()
+	assert.Equal(t, int64(0), before[0].Delivered)
+	assert.Equal(t, int64(1), after[0].Delivered)
+}
+
+func TestSub_Echoes(t *testing.T) {
+	counters := NewCounters()
+	counters.Increment(Ssid{1, 2}, []byte("a/"))
+	counters.Increment(Ssid{1, 2, 4}, []byte("a/b/"))
+	counters.SetNoEcho(Ssid{1, 2, 4}, true)
+	counters.SetNoEcho(Ssid{1, 9}, true)
+
+	// Only excluded if all of the subscriptions matched exclude it
+	assert.True(t, counters.Echoes(NewID(Ssid{1, 2, 4})))
+	counters.SetNoEcho(Ssid{1, 2}, true)
+	assert.False(t, counters.Echoes(NewID(Ssid{1, 2, 4})))
+	assert.True(t, counters.Echoes(NewID(Ssid{1, 3})))
+
+	b, _ := counters.Get(Ssid{1, 2, 4})
+	assert.True(t, b.NoEcho)
+}
+
+func TestSub_Selects(t *testing.T) {
+	hot, _ := ParseSelector("temp>50")
+	cold, _ := ParseSelector("temp<0")
+	counters := NewCounters()
+	counters.Increment(Ssid{1, 2}, []byte("a/"))
+	counters.Increment(Ssid{1, 2, 4}, []byte("a/b/"))
+	counters.SetFilter(Ssid{1, 2}, hot)
+	counters.SetFilter(Ssid{1, 2, 4}, cold)
+
+	// Only skipped if none of the subscriptions matched selects it
+	assert.True(t, counters.Selects(NewID(Ssid{1, 2, 4}), []byte(`{"temp":60}`)))
+	assert.True(t, counters.Selects(NewID(Ssid{1, 2, 4}), []byte(`{"temp":-5}`)))
+	assert.False(t, counters.Selects(NewID(Ssid{1, 2, 4}), []byte(`{"temp":20}`)))
+	assert.False(t, counters.Selects(NewID(Ssid{1, 2}), []byte(`{"temp":-5}`)))
+	assert.True(t, counters.Selects(NewID(Ssid{1, 3}), []byte(`{"temp":20}`)))
+
+	counters.SetFilter(Ssid{1, 2}, nil)
+	assert.True(t, counters.Selects(NewID(Ssid{1, 2, 4}), []byte(`{"temp":20}`)))
+	assert.True(t, counters.Selects(NewID(Ssid{1, 2}), []byte(`not json`)))
+}
+
+func TestSub_Meta(t *testing.T) {
+	counters := NewCounters()
+	counters.Increment(Ssid{1, 2}, []byte("a/"))
+	counters.SetMeta(Ssid{1, 2}, map[string]string{"status": "away"})
+	counters.SetMeta(Ssid{1, 3}, map[string]string{"status": "busy"})
+
+	a, _ := counters.Get(Ssid{1, 2})
+	assert.Equal(t, map[string]string{"status": "away"}, a.Meta)
+	_, ok := counters.Get(Ssid{1, 3})
+	assert.False(t, ok)
+}
+
+func TestSub_Expiring(t *testing.T) {
+	counters := NewCounters()
+	counters.Increment(Ssid{1, 2}, []byte("a/"))
+	counters.Increment(Ssid{1, 3}, []byte("b/"))
+	counters.Increment(Ssid{1, 4}, []byte("c/"))
+	counters.SetExpires(Ssid{1, 2}, 100)
+	counters.SetExpires(Ssid{1, 3}, 200)
+
+	// The subscriber is only warned once about each key
+	expiring := counters.Expiring(150)
+	assert.Len(t, expiring, 1)
+	assert.Equal(t, "a/", string(expiring[0].Channel))
+	assert.Empty(t, counters.Expiring(150))
+
+	// A renewed key can be warned about again
+	counters.SetExpires(Ssid{1, 2}, 300)
+	assert.Len(t, counters.Expiring(500), 2)
+	assert.Empty(t, counters.Expiring(500))
+}
+
 func TestSubscribers(t *testing.T) {
 	subs := newSubscribers()
 	sub := &testSubscriber{id: "x"}
@@ -133,7 +323,8 @@ func TestSub_All(t *testing.T) {
 	// Preparation.
 	counters := NewCounters()
 	ssid := make([]uint32, 1)
-	createdCounter := counters.getOrCreate(ssid, []byte("test"))
+	key := (Ssid(ssid)).GetHashCode()
+	createdCounter := counters.getOrCreate(counters.shardOf(key), key, ssid, []byte("test"))
 
 	// Call.
 	allCounters := counters.All()
@@ -143,7 +334,84 @@ func TestSub_All(t *testing.T) {
 	assert.Equal(t, createdCounter, &allCounters[0])
 }
 
-// TODO : test concurrency
+func TestSub_Collisions(t *testing.T) {
+	counters := NewCounters()
+	a, b := Ssid{1, 2}, Ssid{1, 3}
+
+	// Both counters are kept under the same hash and told apart by their SSID
+	shard := counters.shardOf(7)
+	counters.getOrCreate(shard, 7, a, []byte("a/")).Counter++
+	counters.getOrCreate(shard, 7, b, []byte("b/")).Counter++
+	assert.Len(t, shard.m[7], 2)
+	assert.Equal(t, []byte("a/"), shard.find(7, a).Channel)
+	assert.Equal(t, []byte("b/"), shard.find(7, b).Channel)
+
+	shard.remove(7, shard.find(7, a))
+	assert.Nil(t, shard.find(7, a))
+	assert.NotNil(t, shard.find(7, b))
+	shard.remove(7, shard.find(7, b))
+	assert.Empty(t, shard.m)
+	assert.Equal(t, 0, counters.Count())
+}
+
+func TestSub_Permutations(t *testing.T) {
+	a, b := hash.OfString("a"), hash.OfString("b")
+	counters := NewCounters()
+	counters.Increment(Ssid{1, a, b}, []byte("a/b/"))
+	counters.Increment(Ssid{1, b, a}, []byte("b/a/"))
+	assert.Equal(t, 2, counters.Count())
+
+	// Unsubscribing from one of the permutations keeps the other
+	assert.True(t, counters.Decrement(Ssid{1, b, a}))
+	c, ok := counters.Get(Ssid{1, a, b})
+	assert.True(t, ok)
+	assert.Equal(t, []byte("a/b/"), c.Channel)
+	_, ok = counters.Get(Ssid{1, b, a})
+	assert.False(t, ok)
+}
+
+func TestSub_AllChanged(t *testing.T) {
+	counters := NewCounters()
+	for i := uint32(0); i < 100; i++ {
+		counters.Increment(Ssid{1, i}, []byte("a/"))
+	}
+
+	// The copies of the shards are reused until their counters change
+	assert.Len(t, counters.All(), 100)
+	assert.Len(t, counters.All(), 100)
+	counters.Decrement(Ssid{1, 5})
+	assert.Len(t, counters.All(), 99)
+	assert.Equal(t, 99, counters.Count())
+
+	counters.Attribute(NewID(Ssid{1, 7}))
+	for _, c := range counters.All() {
+		if c.Ssid[1] == 7 {
+			assert.Equal(t, int64(1), c.Delivered)
+		}
+	}
+}
+
+func TestSub_Concurrent(t *testing.T) {
+	counters := NewCounters()
+	var wg sync.WaitGroup
+	for w := uint32(0); w < 8; w++ {
+		wg.Add(1)
+		go func(w uint32) {
+			defer wg.Done()
+			for i := uint32(0); i < 1000; i++ {
+				counters.Increment(Ssid{1, w<<16 | i}, nil)
+				if i%100 == 0 {
+					counters.All()
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	assert.Equal(t, 8000, counters.Count())
+	assert.Len(t, counters.All(), 8000)
+}
+
 // TODO : add decrement test
 func TestSub_Increment(t *testing.T) {
 	// Preparation.
@@ -154,27 +422,27 @@ func TestSub_Increment(t *testing.T) {
 	key1 := (Ssid(ssid1)).GetHashCode()
 	key2 := (Ssid(ssid2)).GetHashCode()
 
-	counters.getOrCreate(ssid1, []byte("test"))
+	counters.getOrCreate(counters.shardOf(key1), key1, ssid1, []byte("test"))
 
 	// Test previously created counter.
 	isFirst := counters.Increment(ssid1, []byte("test"))
 	assert.True(t, isFirst)
-	assert.Equal(t, 1, counters.m[key1].Counter)
+	assert.Equal(t, 1, counters.shardOf(key1).find(key1, ssid1).Counter)
 
 	// Test not previously create counter.
 	isFirst = counters.Increment(ssid2, []byte("test"))
 	assert.True(t, isFirst)
-	assert.Equal(t, 1, counters.m[key2].Counter)
+	assert.Equal(t, 1, counters.shardOf(key2).find(key2, ssid2).Counter)
 
 	// Test increment previously incremented counter.
 	isFirst = counters.Increment(ssid2, []byte("test"))
 	assert.False(t, isFirst)
-	assert.Equal(t, 2, counters.m[key2].Counter)
+	assert.Equal(t, 2, counters.shardOf(key2).find(key2, ssid2).Counter)
 
 	// Test decrement previously incremented counter.
 	isDecremented := counters.Decrement(ssid2)
 	assert.False(t, isDecremented)
-	assert.Equal(t, 1, counters.m[key2].Counter)
+	assert.Equal(t, 1, counters.shardOf(key2).find(key2, ssid2).Counter)
 
 	// Test decrement previously incremented counter.
 	isDecremented = counters.Decrement(ssid2)
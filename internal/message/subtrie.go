@@ -16,42 +16,100 @@ package message
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/emitter-io/emitter/internal/pool"
+	"github.com/emitter-io/emitter/internal/security/hash"
 )
 
+// node represents a node of the trie. Its state is never modified once published: the
+// writers replace it with an updated copy, so the lookups can read it without a lock.
 type node struct {
-	word     uint32
-	subs     Subscribers
-	parent   *node
-	children map[uint32]*node
+	word  uint32
+	state atomic.Value // The current *nodeState of the node.
 }
 
-func (n *node) orphan() {
-	if n.parent == nil {
-		return
+// nodeState represents the subscribers and the children of a node at some point in time.
+type nodeState struct {
+	subs     pmap // The buckets of subscribers, by the hash of their identifier.
+	children pmap // The children nodes, by their word.
+}
+
+// entry represents a subscriber of a node, along with its identifier.
+type entry struct {
+	id  string     // The identifier of the subscriber.
+	sub Subscriber // The subscriber.
+}
+
+// bucket represents the subscribers of a node whose identifiers hash the same, which are
+// told apart by their identifier. A bucket is never modified once published.
+type bucket []entry
+
+// with returns a copy of the bucket with the subscriber added, unless it was already in.
+func (b bucket) with(id string, sub Subscriber) (bucket, bool) {
+	for _, e := range b {
+		if e.id == id {
+			return b, false
+		}
 	}
 
-	delete(n.parent.children, n.word)
-	if n.parent.subs.Size() == 0 && len(n.parent.children) == 0 {
-		n.parent.orphan()
+	out := make(bucket, len(b), len(b)+1)
+	copy(out, b)
+	return append(out, entry{id: id, sub: sub}), true
+}
+
+// without returns a copy of the bucket with the subscriber removed, if it was in.
+func (b bucket) without(id string) (bucket, bool) {
+	for i, e := range b {
+		if e.id == id {
+			out := make(bucket, 0, len(b)-1)
+			out = append(out, b[:i]...)
+			return append(out, b[i+1:]...), true
+		}
+	}
+	return b, false
+}
+
+// newNode creates a new node without any subscriber or child.
+func newNode(word uint32) *node {
+	n := &node{word: word}
+	n.state.Store(new(nodeState))
+	return n
+}
+
+// load returns the current state of the node.
+func (n *node) load() *nodeState {
+	return n.state.Load().(*nodeState)
+}
+
+// child returns the child node of a word.
+func (n *node) child(word uint32) (*node, bool) {
+	if v, ok := n.load().children.Get(word); ok {
+		return v.(*node), true
 	}
+	return nil, false
 }
 
-// Trie represents an efficient collection of subscriptions with lookup capability.
+// isEmpty returns whether the node has neither subscribers nor children.
+func (s *nodeState) isEmpty() bool {
+	return s.subs.Len() == 0 && s.children.Len() == 0
+}
+
+// Trie represents an efficient collection of subscriptions with lookup capability. The
+// writers are serialized, while the lookups never lock and see each node either before
+// or after an update.
 type Trie struct {
-	sync.RWMutex
-	root  *node // The root node of the tree.
-	count int   // Number of subscriptions in the trie.
+	count  int64      // Number of subscriptions in the trie.
+	writer sync.Mutex // The lock held by the writers.
+	root   *node      // The root node of the tree.
 	lookup func(Ssid, *Subscribers, *node, func(s Subscriber) bool)
 }
 
 // newTrie creates a new trie without a lookup function
 func newTrie() *Trie {
 	return &Trie{
-		root: &node{
-			subs:     newSubscribers(),
-			children: make(map[uint32]*node),
-		},
+		root: newNode(0),
 	}
 }
 
@@ -71,84 +129,157 @@ func NewTrieMQTT() *Trie {
 
 // Count returns the number of subscriptions.
 func (t *Trie) Count() int {
-	t.RLock()
-	defer t.RUnlock()
-	return t.count
+	return int(atomic.LoadInt64(&t.count))
 }
 
 // Subscribe adds the Subscriber to the topic and returns a Subscription.
 func (t *Trie) Subscribe(ssid Ssid, sub Subscriber) *Subscription {
-	t.Lock()
+	t.writer.Lock()
+	defer t.writer.Unlock()
+
+	// The missing nodes are published before descending, always holding their state
 	curr := t.root
 	for _, word := range ssid {
-		child, ok := curr.children[word]
+		child, ok := curr.child(word)
 		if !ok {
-			child = &node{
-				word:     word,
-				subs:     newSubscribers(),
-				parent:   curr,
-				children: make(map[uint32]*node),
-			}
-			curr.children[word] = child
+			child = newNode(word)
+			state := *curr.load()
+			state.children = state.children.Set(word, child)
+			curr.state.Store(&state)
 		}
 		curr = child
 	}
 
 	// Add unique and count
-	if ok := curr.subs.AddUnique(sub); ok {
-		t.count++
+	if sub != nil {
+		id := sub.ID()
+		key := hash.OfString(id)
+		state := *curr.load()
+		v, _ := state.subs.Get(key)
+		if b, added := bucketOf(v).with(id, sub); added {
+			state.subs = state.subs.Set(key, b)
+			curr.state.Store(&state)
+			atomic.AddInt64(&t.count, 1)
+		}
 	}
 
-	t.Unlock()
 	return &Subscription{Ssid: ssid, Subscriber: sub}
 }
 
 // Unsubscribe removes the Subscription.
 func (t *Trie) Unsubscribe(ssid Ssid, subscriber Subscriber) {
-	t.Lock()
-	curr := t.root
+	t.writer.Lock()
+	defer t.writer.Unlock()
+
+	// Keep the path, since the nodes left empty are removed from their parents
+	path := make([]*node, 1, len(ssid)+1)
+	path[0] = t.root
 	for _, word := range ssid {
-		child, ok := curr.children[word]
+		child, ok := path[len(path)-1].child(word)
 		if !ok {
-			// Subscription doesn't exist.
-			t.Unlock()
-			return
+			return // Subscription doesn't exist.
 		}
-		curr = child
+		path = append(path, child)
 	}
 
 	// Remove the subscriber and decrement the counter
-	if ok := curr.subs.Remove(subscriber); ok {
-		t.count--
+	if subscriber == nil {
+		return
 	}
 
+	id := subscriber.ID()
+	key := hash.OfString(id)
+	curr := path[len(path)-1]
+	state := *curr.load()
+	v, _ := state.subs.Get(key)
+	b, removed := bucketOf(v).without(id)
+	switch {
+	case !removed:
+		return
+	case len(b) == 0:
+		state.subs, _ = state.subs.Delete(key)
+	default:
+		state.subs = state.subs.Set(key, b)
+	}
+
+	curr.state.Store(&state)
+	atomic.AddInt64(&t.count, -1)
+
 	// Remove orphans
-	if curr.subs.Size() == 0 && len(curr.children) == 0 {
-		curr.orphan()
+	for i := len(path) - 1; i > 0 && path[i].load().isEmpty(); i-- {
+		parent := *path[i-1].load()
+		parent.children, _ = parent.children.Delete(path[i].word)
+		path[i-1].state.Store(&parent)
 	}
-	t.Unlock()
+}
+
+// bucketOf returns the bucket of subscribers stored in a node, if any.
+func bucketOf(v interface{}) bucket {
+	b, _ := v.(bucket)
+	return b
+}
+
+// Walk calls the function for every subscription whose SSID starts with the prefix, where
+// a single-level wildcard in the prefix matches any word.
+func (t *Trie) Walk(prefix Ssid, fn func(Ssid, Subscriber)) {
+	t.walk(t.root, make(Ssid, 0, 8), prefix, fn)
+}
+
+// walk descends the nodes matching the remaining prefix, then calls the function for every
+// subscription of the branch.
+func (t *Trie) walk(curr *node, path, prefix Ssid, fn func(Ssid, Subscriber)) {
+	state := curr.load()
+	if len(prefix) == 0 {
+		state.subs.Range(func(_ uint32, v interface{}) bool {
+			for _, e := range v.(bucket) {
+				fn(append(Ssid(nil), path...), e.sub)
+			}
+			return true
+		})
+
+		state.children.Range(func(word uint32, v interface{}) bool {
+			t.walk(v.(*node), append(path, word), prefix, fn)
+			return true
+		})
+		return
+	}
+
+	state.children.Range(func(word uint32, v interface{}) bool {
+		if prefix[0] == wildcard || prefix[0] == word {
+			t.walk(v.(*node), append(path, word), prefix[1:], fn)
+		}
+		return true
+	})
 }
 
 // Lookup returns the Subscribers for the given topic.
 func (t *Trie) Lookup(ssid Ssid, filter func(s Subscriber) bool) (subs Subscribers) {
-	subs = newSubscribers()
-	t.RLock()
-
+	subs = lookups.Get().(Subscribers)
 	t.lookup(ssid, &subs, t.root, filter)
 
-	if contractNode, ok := t.root.children[ssid[0]]; ok {
-		if shareNode, ok := contractNode.children[share]; ok {
+	if contractNode, ok := t.root.child(ssid[0]); ok {
+		if shareNode, ok := contractNode.child(share); ok {
 			t.randomByGroup(ssid[1:], &subs, shareNode, filter)
 		}
 	}
-
-	t.RUnlock()
 	return
 }
 
-func (t *Trie) lookupEmitter(query Ssid, subs *Subscribers, node *node, filter func(s Subscriber) bool) {
+// LookupID returns the subscribers of the SSID of a message identifier, which is decoded
+// in a reusable buffer rather than allocated. The subscribers returned can be released
+// once the message is delivered.
+func (t *Trie) LookupID(id ID, filter func(s Subscriber) bool) Subscribers {
+	ssid := ssids.Get().(*Ssid)
+	*ssid = id.appendSsid((*ssid)[:0])
+	subs := t.Lookup(*ssid, filter)
+	ssids.Put(ssid)
+	return subs
+}
+
+func (t *Trie) lookupEmitter(query Ssid, subs *Subscribers, curr *node, filter func(s Subscriber) bool) {
 	// Add subscribers from the current branch
-	subs.AddRange(node.subs, filter)
+	state := curr.load()
+	subs.addFrom(state.subs, filter)
 
 	// If we're done, stop
 	if len(query) == 0 {
@@ -156,50 +287,55 @@ func (t *Trie) lookupEmitter(query Ssid, subs *Subscribers, node *node, filter f
 	}
 
 	// Go through the exact match branch
-	if n, ok := node.children[query[0]]; ok {
-		t.lookupEmitter(query[1:], subs, n, filter)
+	if n, ok := state.children.Get(query[0]); ok {
+		t.lookupEmitter(query[1:], subs, n.(*node), filter)
 	}
 
 	// Go through wildcard match branch
-	if n, ok := node.children[wildcard]; ok {
-		t.lookupEmitter(query[1:], subs, n, filter)
+	if n, ok := state.children.Get(wildcard); ok {
+		t.lookupEmitter(query[1:], subs, n.(*node), filter)
 	}
 }
 
-func (t *Trie) lookupMqtt(query Ssid, subs *Subscribers, node *node, filter func(s Subscriber) bool) {
+func (t *Trie) lookupMqtt(query Ssid, subs *Subscribers, curr *node, filter func(s Subscriber) bool) {
+	state := curr.load()
+
 	// If we're done, stop
 	if len(query) == 0 {
 		// Add subscribers from the current branch
-		subs.AddRange(node.subs, filter)
+		subs.addFrom(state.subs, filter)
 		return
 	}
 
 	// Go through the exact match branch
-	if n, ok := node.children[query[0]]; ok {
-		t.lookupMqtt(query[1:], subs, n, filter)
+	if n, ok := state.children.Get(query[0]); ok {
+		t.lookupMqtt(query[1:], subs, n.(*node), filter)
 	}
 
 	// Go through wildcard match branch
-	if n, ok := node.children[wildcard]; ok {
-		t.lookupMqtt(query[1:], subs, n, filter)
+	if n, ok := state.children.Get(wildcard); ok {
+		t.lookupMqtt(query[1:], subs, n.(*node), filter)
 	}
 
 	// Add subscribers from multi-wildcard branch
-	if n, ok := node.children[multiWildcard]; ok {
-		subs.AddRange(n.subs, filter)
+	if n, ok := state.children.Get(multiWildcard); ok {
+		subs.addFrom(n.(*node).load().subs, filter)
 	}
 }
 
 // Reusable pool of subscriber groups
-var temp = &sync.Pool{
-	New: func() interface{} {
-		x := time.Now().UnixNano()
-		return &tempState{
-			list: newSubscribers(),
-			rand: uint32((x >> 32) ^ x),
-		}
-	},
-}
+var temp = pool.New("message.groups", func() interface{} {
+	x := time.Now().UnixNano()
+	return &tempState{
+		list: newSubscribers(),
+		rand: uint32((x >> 32) ^ x),
+	}
+})
+
+// Reusable SSIDs, decoded from the message identifiers for the lookups
+var ssids = pool.New("message.ssids", func() interface{} {
+	return new(Ssid)
+})
 
 type tempState struct {
 	list Subscribers
@@ -212,11 +348,11 @@ func (t *Trie) randomByGroup(query Ssid, subs *Subscribers, shareNode *node, fil
 	defer temp.Put(tmp)
 
 	// Select a random subscriber from each share group (child of the share node)
-	for _, n := range shareNode.children {
+	shareNode.load().children.Range(func(_ uint32, n interface{}) bool {
 		tmp.list.Reset() // recycle
-		t.lookup(query, &tmp.list, n, filter)
+		t.lookup(query, &tmp.list, n.(*node), filter)
 		if tmp.list.Size() == 0 {
-			continue
+			return true
 		}
 
 		// Generate a random number using xorshift
@@ -228,7 +364,6 @@ func (t *Trie) randomByGroup(query Ssid, subs *Subscribers, shareNode *node, fil
 
 		// Select a random element from the list and add it
 		subs.AddUnique(tmp.list.Random(x))
-
-	}
-	return
+		return true
+	})
 }
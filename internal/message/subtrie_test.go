@@ -18,8 +18,10 @@ import (
 	"fmt"
 	"math/rand"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/emitter-io/emitter/internal/security"
 	"github.com/emitter-io/emitter/internal/security/hash"
 	"github.com/stretchr/testify/assert"
 )
@@ -60,6 +62,23 @@ func TestTrieMatch1(t *testing.T) {
 	}
 }
 
+func TestTrieLookupID(t *testing.T) {
+	m := NewTrie()
+	testPopulateWithStrings(m, []string{
+		"a/b/",
+		"a/b/c/",
+		"d/e/",
+	})
+
+	result := m.LookupID(NewID(testSub("a/b/c/")), nil)
+	assert.Equal(t, 2, len(result))
+
+	// A released set is cleared before being reused
+	result.Release()
+	assert.Equal(t, 0, len(result))
+	assert.Equal(t, 1, len(m.LookupID(NewID(testSub("d/e/")), nil)))
+}
+
 func TestTrieMatch(t *testing.T) {
 	m := NewTrie()
 	testPopulateWithStrings(m, []string{
@@ -274,7 +293,110 @@ func TestTrieIntegrationMqtt(t *testing.T) {
 	assertEqual(assert, m.Lookup([]uint32{4}, nil))
 }
 
+func TestTrieEscapedWildcard(t *testing.T) {
+	assert := assert.New(t)
+	m := NewTrie()
+	s0 := &testSubscriber{"s0"}
+	m.Subscribe(security.ParseChannel([]byte("emitter/a/%2B/")).Query, s0)
+
+	assertEqual(assert, m.Lookup(security.ParseChannel([]byte("emitter/a/x/")).Query, nil))
+	assertEqual(assert, m.Lookup(security.ParseChannel([]byte("emitter/a/%2b/")).Query, nil), s0)
+}
+
 // Populates the trie with a set of strings
+func TestTrieWalk(t *testing.T) {
+	m := NewTrie()
+	testPopulateWithStrings(m, []string{
+		"a/", "a/b/", "a/b/c/", "a/c/", "b/",
+	})
+
+	tests := []struct {
+		prefix string
+		ids    []string
+	}{
+		{prefix: "a/", ids: []string{"a/", "a/b/", "a/b/c/", "a/c/"}},
+		{prefix: "a/b/", ids: []string{"a/b/", "a/b/c/"}},
+		{prefix: "a/+/", ids: []string{"a/b/", "a/b/c/", "a/c/"}},
+		{prefix: "c/", ids: nil},
+	}
+
+	for _, tc := range tests {
+		var ids []string
+		m.Walk(testSub(tc.prefix), func(ssid Ssid, sub Subscriber) {
+			assert.Equal(t, Ssid(testSub(sub.ID())), ssid)
+			ids = append(ids, sub.ID())
+		})
+		assert.ElementsMatch(t, tc.ids, ids, tc.prefix)
+	}
+}
+
+func TestTrieUnsubscribeOrphans(t *testing.T) {
+	m := NewTrie()
+	testPopulateWithStrings(m, []string{"a/b/c/", "a/b/", "a/d/"})
+
+	m.Unsubscribe(testSub("a/b/c/"), &testSubscriber{"a/b/c/"})
+	m.Unsubscribe(testSub("a/d/"), &testSubscriber{"a/d/"})
+	assert.Equal(t, 1, m.Count())
+	assert.Equal(t, 1, m.root.load().children.Len())
+
+	// The last subscription removes the whole branch
+	m.Unsubscribe(testSub("a/b/"), &testSubscriber{"a/b/"})
+	assert.Equal(t, 0, m.Count())
+	assert.Equal(t, 0, m.root.load().children.Len())
+}
+
+func TestTrieCollision(t *testing.T) {
+	assert := assert.New(t)
+
+	// The identifiers of both subscribers hash the same
+	a, b := &testSubscriber{"31644"}, &testSubscriber{"173280"}
+	assert.Equal(hash.OfString(a.ID()), hash.OfString(b.ID()))
+
+	m := NewTrie()
+	m.Subscribe(Ssid{1, 2}, a)
+	m.Subscribe(Ssid{1, 2}, b)
+	m.Subscribe(Ssid{1, 2}, b)
+	assert.Equal(2, m.Count())
+	assertEqual(assert, m.Lookup(Ssid{1, 2}, nil), a, b)
+
+	m.Unsubscribe(Ssid{1, 2}, a)
+	assert.Equal(1, m.Count())
+	assertEqual(assert, m.Lookup(Ssid{1, 2}, nil), b)
+
+	m.Unsubscribe(Ssid{1, 2}, b)
+	assert.Equal(0, m.Count())
+	assertEqual(assert, m.Lookup(Ssid{1, 2}, nil))
+}
+
+func TestTrieConcurrent(t *testing.T) {
+	m := NewTrie()
+	testPopulateWithStrings(m, []string{"a/", "a/b/"})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				topic := fmt.Sprintf("a/b/%d/%d/", w, i%10)
+				sub := &testSubscriber{topic}
+				m.Subscribe(testSub(topic), sub)
+				m.Unsubscribe(testSub(topic), sub)
+			}
+		}(w)
+	}
+
+	// The stable subscriptions are always found while the trie is being updated
+	for i := 0; i < 1000; i++ {
+		subs := m.Lookup(testSub("a/b/c/"), nil)
+		assert.Equal(t, 2, subs.Size())
+		subs.Release()
+	}
+
+	wg.Wait()
+	assert.Equal(t, 2, m.Count())
+}
+
 func testPopulateWithStrings(m *Trie, values []string) {
 	for _, s := range values {
 		m.Subscribe(testSub(s), &testSubscriber{s})
@@ -368,6 +490,27 @@ func BenchmarkSubscriptionTrieLookup(b *testing.B) {
 	}
 }
 
+func BenchmarkSubscriptionTrieLookupParallel(b *testing.B) {
+	rand.Seed(42)
+	var (
+		m  = NewTrie()
+		s0 = new(testSubscriber)
+		q1 = []uint32{1, wildcard, 2, 3, 4}
+		q2 = []uint32{1, 5, 2, 3, 4}
+	)
+
+	m.Subscribe(q1, s0)
+	populateMatcher(m, 1000, 3)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			m.Lookup(q2, nil).Release()
+		}
+	})
+}
+
 func BenchmarkSubscriptionTrieSubscribeCold(b *testing.B) {
 	var (
 		m     = NewTrie()
@@ -0,0 +1,255 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The name of the file holding the version of a directory.
+const versionFile = "FORMAT"
+
+var (
+	errNewerFormat = errors.New("the data was written by a newer version of emitter")
+	errOtherFormat = errors.New("the directory holds data of another format")
+)
+
+// Migration represents a forward migration of an on-disk format to a version.
+type Migration struct {
+	Version     int                    // The version the migration upgrades to.
+	Description string                 // The description of the migration.
+	Apply       func(dir string) error // The function migrating the directory.
+}
+
+// Format represents a versioned on-disk format, along with the migrations which upgrade a
+// directory written by any of its previous versions. The directories written before the
+// format was versioned are at version 0.
+type Format struct {
+	Name       string      // The name of the format.
+	Migrations []Migration // The migrations, ordered by version.
+}
+
+// Options represents the options of a migration.
+type Options struct {
+	DryRun bool // Whether the migrations should only be planned.
+	Backup bool // Whether the directory should be copied before being migrated.
+}
+
+// Result represents the outcome of a migration.
+type Result struct {
+	From    int         // The version the directory was at.
+	To      int         // The version the directory is at, or would be at for a dry run.
+	Pending []Migration // The migrations which were, or would be, applied.
+	Backup  string      // The directory of the backup, if one was made.
+}
+
+// Version returns the current version of the format.
+func (f *Format) Version() int {
+	if n := len(f.Migrations); n > 0 {
+		return f.Migrations[n-1].Version
+	}
+	return 0
+}
+
+// Migrate upgrades the directory to the current version of the format. A new or an empty
+// directory is simply marked with the current version.
+func (f *Format) Migrate(dir string, opts Options) (result Result, err error) {
+	result.From, err = f.versionOf(dir)
+	if err != nil {
+		return
+	}
+
+	result.To = f.Version()
+	if result.From > result.To {
+		return result, fmt.Errorf("%w: %s format v%d, while v%d is supported", errNewerFormat, f.Name, result.From, result.To)
+	}
+
+	for _, m := range f.Migrations {
+		if m.Version > result.From {
+			result.Pending = append(result.Pending, m)
+		}
+	}
+
+	if opts.DryRun {
+		return
+	}
+
+	// Nothing to migrate in a new directory, only remember its version
+	if result.From < 0 {
+		result.From, result.Pending = result.To, nil
+		return result, f.writeVersion(dir, result.To)
+	}
+
+	if len(result.Pending) == 0 {
+		return
+	}
+
+	if opts.Backup {
+		result.Backup = fmt.Sprintf("%s.v%d-%s.bak", filepath.Clean(dir), result.From, time.Now().UTC().Format("20060102150405"))
+		if err = copyDir(dir, result.Backup); err != nil {
+			return result, fmt.Errorf("unable to back up %s: %w", dir, err)
+		}
+	}
+
+	// Apply the migrations, remembering the version after each one so an interrupted
+	// migration resumes where it stopped
+	for _, m := range result.Pending {
+		if err = m.Apply(dir); err != nil {
+			return result, fmt.Errorf("unable to migrate %s to v%d (%s): %w", f.Name, m.Version, m.Description, err)
+		}
+
+		if err = f.writeVersion(dir, m.Version); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// versionOf reads the version of the directory, which is -1 for a new directory.
+func (f *Format) versionOf(dir string) (int, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, versionFile))
+	switch {
+	case os.IsNotExist(err):
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) || (err == nil && len(entries) == 0) {
+			return -1, nil
+		}
+		return 0, err
+	case err != nil:
+		return 0, err
+	}
+
+	var v version
+	if err := json.Unmarshal(b, &v); err != nil {
+		return 0, err
+	}
+
+	if v.Format != f.Name {
+		return 0, fmt.Errorf("%w: expected %s, found %s", errOtherFormat, f.Name, v.Format)
+	}
+	return v.Version, nil
+}
+
+// writeVersion writes the version of the directory.
+func (f *Format) writeVersion(dir string, n int) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(version{Format: f.Name, Version: n})
+	if err != nil {
+		return err
+	}
+
+	// Write and rename, so the version is never partially written
+	tmp := filepath.Join(dir, versionFile+".tmp")
+	if err := ioutil.WriteFile(tmp, b, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, versionFile))
+}
+
+// version represents the content of the version file.
+type version struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// ------------------------------------------------------------------------------------
+
+var registry = struct {
+	sync.Mutex
+	formats map[string]*Format
+}{formats: make(map[string]*Format)}
+
+// Register makes an on-disk format available by its name, so its directories can be
+// migrated offline. This is typically called from the init function of the package
+// which owns the format.
+func Register(format *Format) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.formats[format.Name] = format
+}
+
+// Lookup returns the registered on-disk format of the specified name.
+func Lookup(name string) (*Format, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+	format, ok := registry.formats[name]
+	return format, ok
+}
+
+// Formats returns the names of the registered on-disk formats, sorted.
+func Formats() (names []string) {
+	registry.Lock()
+	defer registry.Unlock()
+	for name := range registry.formats {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return
+}
+
+// ------------------------------------------------------------------------------------
+
+// copyDir recursively copies a directory.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
+
+// copyFile copies a single file.
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,159 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package migrate
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFormat(applied *[]int) *Format {
+	step := func(v int) Migration {
+		return Migration{
+			Version:     v,
+			Description: "step",
+			Apply: func(dir string) error {
+				*applied = append(*applied, v)
+				return ioutil.WriteFile(filepath.Join(dir, "data"), []byte{byte(v)}, 0666)
+			},
+		}
+	}
+
+	return &Format{
+		Name:       "test",
+		Migrations: []Migration{step(1), step(2)},
+	}
+}
+
+func TestMigrate_New(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "new")
+	var applied []int
+	f := newTestFormat(&applied)
+
+	result, err := f.Migrate(dir, Options{Backup: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.From)
+	assert.Equal(t, 2, result.To)
+	assert.Empty(t, result.Pending)
+	assert.Empty(t, applied)
+
+	v, err := f.versionOf(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+}
+
+func TestMigrate_Legacy(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "data"), []byte{0}, 0666))
+
+	var applied []int
+	f := newTestFormat(&applied)
+
+	// A dry run only plans the migrations
+	result, err := f.Migrate(dir, Options{DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.From)
+	assert.Len(t, result.Pending, 2)
+	assert.Empty(t, applied)
+
+	// Migrate with a backup of the legacy data
+	result, err = f.Migrate(dir, Options{Backup: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, applied)
+	assert.NotEmpty(t, result.Backup)
+
+	b, err := ioutil.ReadFile(filepath.Join(result.Backup, "data"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0}, b)
+
+	// Migrating again does nothing
+	result, err = f.Migrate(dir, Options{Backup: true})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Pending)
+	assert.Empty(t, result.Backup)
+	assert.Equal(t, []int{1, 2}, applied)
+}
+
+func TestMigrate_Resume(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "data"), []byte{0}, 0666))
+
+	// Fail the second migration
+	var applied []int
+	f := newTestFormat(&applied)
+	apply := f.Migrations[1].Apply
+	f.Migrations[1].Apply = func(string) error { return errors.New("boom") }
+
+	_, err := f.Migrate(dir, Options{})
+	assert.Error(t, err)
+
+	// Only the failed migration is applied again
+	f.Migrations[1].Apply = apply
+	result, err := f.Migrate(dir, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.From)
+	assert.Equal(t, []int{1, 2}, applied)
+}
+
+func TestMigrate_Errors(t *testing.T) {
+	var applied []int
+	f := newTestFormat(&applied)
+
+	// A newer version is not downgraded
+	dir := t.TempDir()
+	assert.NoError(t, (&Format{Name: "test"}).writeVersion(dir, 3))
+	_, err := f.Migrate(dir, Options{})
+	assert.True(t, errors.Is(err, errNewerFormat))
+
+	// Another format is not touched
+	dir = t.TempDir()
+	assert.NoError(t, (&Format{Name: "other"}).writeVersion(dir, 1))
+	_, err = f.Migrate(dir, Options{})
+	assert.True(t, errors.Is(err, errOtherFormat))
+
+	// A corrupted version file is reported
+	dir = t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, versionFile), []byte("{"), 0666))
+	_, err = f.Migrate(dir, Options{})
+	assert.Error(t, err)
+	assert.Empty(t, applied)
+}
+
+func TestRegistry(t *testing.T) {
+	Register(&Format{Name: "test"})
+	f, ok := Lookup("test")
+	assert.True(t, ok)
+	assert.Equal(t, "test", f.Name)
+	assert.Contains(t, Formats(), "test")
+
+	_, ok = Lookup("missing")
+	assert.False(t, ok)
+}
+
+func TestCopyDir(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "copy")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "a", "b"), 0777))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "a", "b", "c"), []byte("hi"), 0666))
+	assert.NoError(t, copyDir(src, dst))
+
+	b, err := ioutil.ReadFile(filepath.Join(dst, "a", "b", "c"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", string(b))
+}
@@ -16,24 +16,32 @@ package listener
 
 import (
 	"bytes"
-	"context"
+	"errors"
 	"io"
 	"net"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/emitter-io/emitter/internal/async"
 	"github.com/kelindar/rate"
 )
 
+const flushDelay = time.Second // The delay after which the queued data is flushed.
+
+var (
+	errNotRaw  = errors.New("listener: no raw connection")
+	errSniffed = errors.New("listener: sniffed data not read yet")
+)
+
 // Conn wraps a net.Conn and provides transparent sniffing of connection data.
 type Conn struct {
 	sync.RWMutex
-	socket net.Conn           // The underlying network connection.
-	writer bytes.Buffer       // The buffered write queue.
-	reader sniffer            // The reader which performs sniffing.
-	limit  *rate.Limiter      // The write rate limiter.
-	cancel context.CancelFunc // The cancellation function for the force flush.
+	socket  net.Conn      // The underlying network connection.
+	writer  bytes.Buffer  // The buffered write queue.
+	reader  sniffer       // The reader which performs sniffing.
+	limit   *rate.Limiter // The write rate limiter.
+	flush   *time.Timer   // The timer of the forced flush, while some data is queued.
+	release func()        // The function releasing the admission of the connection, if any.
 }
 
 // NewConn creates a new sniffed connection.
@@ -42,15 +50,11 @@ func newConn(c net.Conn, writeRate int) *Conn {
 		writeRate = 60
 	}
 
-	conn := &Conn{
+	return &Conn{
 		socket: c,
 		reader: sniffer{source: c},
 		limit:  rate.New(writeRate, time.Second),
 	}
-
-	// TODO: see if we can get rid of this goroutine per connection
-	conn.cancel = async.Repeat(context.Background(), 1*time.Second, func() { conn.Flush() })
-	return conn
 }
 
 // Read reads the block of data from the underlying buffer.
@@ -79,7 +83,15 @@ func (m *Conn) Write(p []byte) (int, error) {
 // Close closes the connection. Any blocked Read or Write operations will be unblocked
 // and return errors.
 func (m *Conn) Close() error {
-	m.cancel()
+	m.Lock()
+	if m.flush != nil {
+		m.flush.Stop()
+	}
+	m.Unlock()
+
+	if m.release != nil {
+		m.release()
+	}
 	return m.socket.Close()
 }
 
@@ -134,13 +146,39 @@ func (m *Conn) Len() (n int) {
 	return
 }
 
+// enqueue queues the data, which is flushed after a delay unless written before.
 func (m *Conn) enqueue(p []byte) (n int, err error) {
 	m.Lock()
 	n, err = m.writer.Write(p)
+	if m.flush == nil {
+		m.flush = time.AfterFunc(flushDelay, m.onFlush)
+	}
 	m.Unlock()
 	return
 }
 
+// onFlush occurs when the queued data should be flushed.
+func (m *Conn) onFlush() {
+	m.Lock()
+	m.flush = nil
+	m.Unlock()
+	m.Flush()
+}
+
+// SyscallConn returns the raw underlying connection, so it can be polled for readiness.
+// This fails until the sniffed data was read, since it would be left out.
+func (m *Conn) SyscallConn() (syscall.RawConn, error) {
+	sc, ok := m.socket.(syscall.Conn)
+	switch {
+	case !ok:
+		return nil, errNotRaw
+	case m.reader.bufferSize > m.reader.bufferRead:
+		return nil, errSniffed
+	default:
+		return sc.SyscallConn()
+	}
+}
+
 func (m *Conn) startSniffing() io.Reader {
 	m.reader.reset(true)
 	return &m.reader
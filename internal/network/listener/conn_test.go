@@ -47,6 +47,49 @@ func TestConn(t *testing.T) {
 
 // ------------------------------------------------------------------------------------
 
+func TestConnRelease(t *testing.T) {
+	var released int
+	conn := newConn(new(fakeConn), 0)
+	conn.release = func() { released++ }
+
+	assert.NoError(t, conn.Close())
+	assert.Equal(t, 1, released)
+}
+
+func TestConnSyscallConn(t *testing.T) {
+	_, err := newConn(new(fakeConn), 0).SyscallConn()
+	assert.Equal(t, errNotRaw, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	server, err := l.Accept()
+	assert.NoError(t, err)
+	conn := newConn(server, 0)
+	defer conn.Close()
+
+	// The raw connection is only exposed once the sniffed data was read
+	client.Write([]byte{1, 2})
+	sniff := make([]byte, 2)
+	_, err = conn.startSniffing().Read(sniff)
+	assert.NoError(t, err)
+	conn.doneSniffing()
+
+	_, err = conn.SyscallConn()
+	assert.Equal(t, errSniffed, err)
+
+	_, err = conn.Read(sniff)
+	assert.NoError(t, err)
+	raw, err := conn.SyscallConn()
+	assert.NoError(t, err)
+	assert.NotNil(t, raw)
+}
+
 type fakeConn struct{}
 
 func (m *fakeConn) Read(p []byte) (int, error) {
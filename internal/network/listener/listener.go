@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
 	"time"
 )
@@ -66,12 +67,22 @@ var ErrListenerClosed = errListenerClosed("mux: listener closed")
 // for readability of readTimeout
 var noTimeout time.Duration
 
+// The maximum delay to wait after a temporary accept failure.
+const maxBackoff = time.Second
+
 // Config represents the configuration of the listener.
 type Config struct {
-	TLS       *tls.Config // The TLS/SSL configuration.
-	FlushRate int         // The maximum flush rate (QPS) per connection.
+	TLS       *tls.Config  // The TLS/SSL configuration.
+	FlushRate int          // The maximum flush rate (QPS) per connection.
+	Proxy     bool         // Whether the connections may start with a PROXY protocol header.
+	Trusted   []*net.IPNet // The networks allowed to send a PROXY protocol header, none if empty.
+	Admit     AdmitFunc    // The admission of the connections, or nil to admit any.
 }
 
+// AdmitFunc admits a connection given the address of its client, returning the function
+// to call once it is closed, which may be called more than once, or an error if refused.
+type AdmitFunc func(net.Addr) (func(), error)
+
 // New announces on the local network address laddr. The syntax of laddr is
 // "host:port", like "127.0.0.1:8080". If host is omitted, as in ":8080",
 // New listens on all available interfaces instead of just the interface
@@ -83,11 +94,50 @@ func New(address string, config Config) (*Listener, error) {
 		return nil, err
 	}
 
+	return Wrap(l, config), nil
+}
+
+// Wrap multiplexes the connections accepted by an existing listener, such as one created by
+// a program embedding the broker, which is closed along with the multiplexing listener.
+func Wrap(l net.Listener, config Config) *Listener {
+
+	// Read the PROXY protocol header sent by the load balancer, which precedes the handshake
+	if config.Proxy {
+		l = &proxyListener{Listener: l, trusted: config.Trusted}
+	}
+
 	// If we have a TLS configuration provided, wrap the listener in TLS
 	if config.TLS != nil {
 		l = tls.NewListener(l, config.TLS)
 	}
 
+	return newListener(l, config)
+}
+
+// NewUnix announces on a Unix domain socket at the specified path, whose access is granted
+// by the permissions of the file. A socket left over by a previous process is replaced.
+func NewUnix(path string, mode os.FileMode, config Config) (*Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return newListener(l, config), nil
+}
+
+// newListener creates a new multiplexing listener on top of a listener.
+func newListener(l net.Listener, config Config) *Listener {
 	return &Listener{
 		root:         l,
 		bufferSize:   1024,
@@ -95,7 +145,7 @@ func New(address string, config Config) (*Listener, error) {
 		closing:      make(chan struct{}),
 		readTimeout:  noTimeout,
 		config:       config,
-	}, nil
+	}
 }
 
 type processor struct {
@@ -158,15 +208,22 @@ func (m *Listener) Serve() error {
 		}
 	}()
 
+	var delay time.Duration // How long to wait after a temporary accept failure.
 	for {
 		c, err := m.root.Accept()
 		if err != nil {
 			if !m.handleErr(err) {
 				return err
 			}
+
+			// Back off on the temporary failures, such as running out of file descriptors,
+			// rather than spinning on the accept until they are available again.
+			delay = backoff(delay)
+			time.Sleep(delay)
 			continue
 		}
 
+		delay = 0
 		wg.Add(1)
 		go m.serve(c, m.closing, &wg)
 	}
@@ -179,6 +236,16 @@ func (m *Listener) serve(c net.Conn, donec <-chan struct{}, wg *sync.WaitGroup)
 	if m.readTimeout > noTimeout {
 		_ = c.SetReadDeadline(time.Now().Add(m.readTimeout))
 	}
+
+	// Admit the connection, the address of the client being read within the read timeout
+	if m.config.Admit != nil {
+		release, err := m.config.Admit(c.RemoteAddr())
+		if err != nil {
+			_ = muc.Close()
+			return
+		}
+		muc.release = release
+	}
 	for _, sl := range m.matchers {
 		for _, processor := range sl.matchers {
 			matched := processor(muc.startSniffing())
@@ -190,20 +257,33 @@ func (m *Listener) serve(c net.Conn, donec <-chan struct{}, wg *sync.WaitGroup)
 				select {
 				case sl.listen.connections <- muc:
 				case <-donec:
-					_ = c.Close()
+					_ = muc.Close()
 				}
 				return
 			}
 		}
 	}
 
-	_ = c.Close()
+	_ = muc.Close()
 	err := ErrNotMatched{c: c}
 	if !m.handleErr(err) {
 		_ = m.root.Close()
 	}
 }
 
+// backoff returns the delay to wait after a temporary accept failure, doubling the previous
+// one up to a second.
+func backoff(delay time.Duration) time.Duration {
+	switch {
+	case delay == 0:
+		return 5 * time.Millisecond
+	case 2*delay > maxBackoff:
+		return maxBackoff
+	default:
+		return 2 * delay
+	}
+}
+
 // HandleError registers an error handler that handles listener errors.
 func (m *Listener) HandleError(h ErrorHandler) {
 	m.errorHandler = h
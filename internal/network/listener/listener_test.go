@@ -16,12 +16,14 @@ package listener
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"net/rpc"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
@@ -270,6 +272,93 @@ func TestAny(t *testing.T) {
 	runTestHTTP1Client(t, muxl.Addr())
 }
 
+func TestAdmit(t *testing.T) {
+	l, err := New(":0", Config{
+		Admit: func(net.Addr) (func(), error) {
+			return nil, fmt.Errorf("refused")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.Match(MatchAny())
+	go l.Serve()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// The refused connection is closed before anything is read from it
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected the refused connection to be closed")
+	}
+}
+
+func TestUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A socket left over is replaced
+	path := filepath.Join(dir, "emitter.sock")
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := NewUnix(path, 0600, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the socket to be only accessible by its owner, got %v", info.Mode())
+	}
+
+	any := l.Match(MatchAny())
+	go l.Serve()
+	go func() {
+		if c, err := any.Accept(); err == nil {
+			c.Write([]byte("any"))
+			c.Close()
+		}
+	}()
+
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	client.Write([]byte("hello"))
+	buffer := make([]byte, 3)
+	if _, err := io.ReadFull(client, buffer); err != nil || string(buffer) != "any" {
+		t.Fatalf("expected a response over the socket, got %q (%v)", buffer, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	expected := []time.Duration{5, 10, 20, 40, 80, 160, 320, 640, 1000, 1000}
+	var delay time.Duration
+	for i, ms := range expected {
+		if delay = backoff(delay); delay != ms*time.Millisecond {
+			t.Fatalf("expected a delay of %dms after %d failures, got %v", ms, i+1, delay)
+		}
+	}
+}
+
 // interestingGoroutines returns all goroutines we care about for the purpose
 // of leak checking. It excludes testing or runtime ones.
 func interestingGoroutines() (gs []string) {
@@ -333,3 +422,34 @@ func leakCheck(t testing.TB) func() {
 		}
 	}
 }
+
+func TestWrap(t *testing.T) {
+	root, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := Wrap(root, Config{})
+	defer l.Close()
+
+	any := l.Match(MatchAny())
+	go l.Serve()
+	go func() {
+		if c, err := any.Accept(); err == nil {
+			c.Write([]byte("any"))
+			c.Close()
+		}
+	}()
+
+	client, err := net.Dial("tcp", root.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	client.Write([]byte("hello"))
+	buffer := make([]byte, 3)
+	if _, err := io.ReadFull(client, buffer); err != nil || string(buffer) != "any" {
+		t.Fatalf("expected a response over the wrapped listener, got %q (%v)", buffer, err)
+	}
+}
@@ -0,0 +1,197 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	proxyV1Prefix  = []byte("PROXY ")
+	proxyV2Prefix  = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	errProxyHeader = errors.New("listener: invalid PROXY protocol header")
+)
+
+const maxProxyV1 = 107 // The maximum length of a header of the version 1, including CRLF.
+
+// proxyListener represents a listener which reads the PROXY protocol header sent by a load
+// balancer in front of the broker, so the connections report the address of the client
+// rather than the one of the load balancer.
+type proxyListener struct {
+	net.Listener
+	trusted []*net.IPNet // The networks of the load balancers, trusting none if empty.
+}
+
+// Accept waits for and returns the next connection to the listener.
+func (l *proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil || !l.isTrusted(c.RemoteAddr()) {
+		return c, err
+	}
+
+	return &proxyConn{
+		Conn:   c,
+		reader: bufio.NewReader(c),
+	}, nil
+}
+
+// isTrusted returns whether the address is allowed to send a PROXY protocol header. The
+// connections of the other peers are left as they are, so a header they send is not read
+// and fails as an invalid packet rather than letting them choose their address.
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		for _, network := range l.trusted {
+			if network.Contains(tcp.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ------------------------------------------------------------------------------------
+
+// proxyConn represents a connection which may start with a PROXY protocol header. The
+// header is read along with the first read or the first request of the remote address, so
+// the listener is not blocked by the clients which are slow to send it. The header is
+// optional, a connection without one reports its own remote address.
+type proxyConn struct {
+	net.Conn
+	once   sync.Once     // Reads the header once.
+	reader *bufio.Reader // The reader, which peeks at the header.
+	remote net.Addr      // The address of the client, as sent by the load balancer.
+	err    error         // The error of reading the header, if any.
+}
+
+// Read reads the data following the header.
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// RemoteAddr returns the address of the client.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readHeader reads the PROXY protocol header, if there is one.
+func (c *proxyConn) readHeader() {
+	first, err := c.reader.Peek(1)
+	if err != nil {
+		return // Let the next read return the error
+	}
+
+	switch first[0] {
+	case proxyV1Prefix[0]:
+		if prefix, err := c.reader.Peek(len(proxyV1Prefix)); err == nil && bytes.Equal(prefix, proxyV1Prefix) {
+			c.remote, c.err = readProxyV1(c.reader)
+		}
+	case proxyV2Prefix[0]:
+		if prefix, err := c.reader.Peek(len(proxyV2Prefix)); err == nil && bytes.Equal(prefix, proxyV2Prefix) {
+			c.remote, c.err = readProxyV2(c.reader)
+		}
+	}
+}
+
+// readProxyV1 reads a header of the version 1, in text, such as
+// "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < maxProxyV1 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errProxyHeader
+	}
+
+	fields := strings.Fields(string(line))
+	switch {
+	case len(fields) >= 2 && fields[1] == "UNKNOWN":
+		return nil, nil // The connection is not proxied, e.g: a health check
+	case len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6"):
+		return nil, errProxyHeader
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, errProxyHeader
+	}
+
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyV2 reads a header of the version 2, in binary.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Prefix)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	command, family := header[12], header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case command>>4 != 2:
+		return nil, errProxyHeader
+	case command&0x0f == 0:
+		return nil, nil // A local connection, e.g: a health check of the load balancer
+	case command&0x0f != 1:
+		return nil, errProxyHeader
+	}
+
+	// Only the addresses over TCP are kept, the rest of the payload holds the extensions
+	switch {
+	case family == 0x11 && len(payload) >= 12:
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:4]),
+			Port: int(binary.BigEndian.Uint16(payload[8:10])),
+		}, nil
+	case family == 0x21 && len(payload) >= 36:
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:16]),
+			Port: int(binary.BigEndian.Uint16(payload[32:34])),
+		}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,107 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package listener
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newProxyConn creates a connection which receives the data sent, then closes.
+func newProxyConn(data []byte) *proxyConn {
+	client, server := net.Pipe()
+	go func() {
+		client.Write(data)
+		client.Close()
+	}()
+
+	return &proxyConn{Conn: server, reader: bufio.NewReader(server)}
+}
+
+func TestProxy_V1(t *testing.T) {
+	c := newProxyConn([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nhello"))
+	assert.Equal(t, "192.168.0.1:56324", c.RemoteAddr().String())
+
+	b, err := ioutil.ReadAll(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+}
+
+func TestProxy_V1Unknown(t *testing.T) {
+	c := newProxyConn([]byte("PROXY UNKNOWN\r\nhello"))
+	b, err := ioutil.ReadAll(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.Equal(t, "pipe", c.RemoteAddr().String())
+}
+
+func TestProxy_V1Invalid(t *testing.T) {
+	for _, header := range []string{
+		"PROXY TCP4 192.168.0.1\r\nhello",
+		"PROXY TCP4 invalid 192.168.0.11 56324 443\r\nhello",
+		"PROXY UDP4 192.168.0.1 192.168.0.11 56324 443\r\nhello",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\n",
+	} {
+		_, err := ioutil.ReadAll(newProxyConn([]byte(header)))
+		assert.Error(t, err, header)
+	}
+}
+
+func TestProxy_V2(t *testing.T) {
+	header := append([]byte{}, proxyV2Prefix...)
+	header = append(header, 0x21, 0x11, 0, 12)
+	header = append(header, 10, 0, 0, 1, 10, 0, 0, 2)
+	header = append(header, 0x04, 0xd2, 0x01, 0xbb) // Ports 1234 and 443
+
+	c := newProxyConn(append(header, "hello"...))
+	b, err := ioutil.ReadAll(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.Equal(t, "10.0.0.1:1234", c.RemoteAddr().String())
+}
+
+func TestProxy_V2Local(t *testing.T) {
+	header := append([]byte{}, proxyV2Prefix...)
+	header = append(header, 0x20, 0x00, 0, 0)
+
+	c := newProxyConn(append(header, "hello"...))
+	b, err := ioutil.ReadAll(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.Equal(t, "pipe", c.RemoteAddr().String())
+}
+
+func TestProxy_Without(t *testing.T) {
+	for _, data := range []string{"\x10\x00MQTT", "POST / HTTP/1.1\r\n\r\n", "P"} {
+		c := newProxyConn([]byte(data))
+		b, err := ioutil.ReadAll(c)
+		assert.NoError(t, err)
+		assert.Equal(t, data, string(b))
+		assert.Equal(t, "pipe", c.RemoteAddr().String())
+	}
+}
+
+func TestProxy_Trusted(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	l := &proxyListener{trusted: []*net.IPNet{network}}
+
+	assert.True(t, l.isTrusted(&net.TCPAddr{IP: net.ParseIP("10.1.2.3")}))
+	assert.False(t, l.isTrusted(&net.TCPAddr{IP: net.ParseIP("192.168.0.1")}))
+	assert.False(t, (&proxyListener{}).isTrusted(&net.TCPAddr{IP: net.ParseIP("192.168.0.1")}))
+}
@@ -15,7 +15,7 @@
 package mqtt
 
 import (
-	"sync"
+	"github.com/emitter-io/emitter/internal/pool"
 )
 
 // smallBufferSize is an initial allocation minimal capacity.
@@ -23,21 +23,19 @@ const smallBufferSize = 64
 const maxInt = int(^uint(0) >> 1)
 
 // buffers are reusable fixed-side buffers for faster encoding.
-var buffers = newBufferPool(maxMessageSize)
+var buffers = newBufferPool("mqtt.buffers", maxMessageSize)
 
 // bufferPool represents a thread safe buffer pool
 type bufferPool struct {
-	sync.Pool
+	*pool.Pool
 }
 
 // newBufferPool creates a new BufferPool bounded to the given size.
-func newBufferPool(bufferSize int) (bp *bufferPool) {
+func newBufferPool(name string, bufferSize int) (bp *bufferPool) {
 	return &bufferPool{
-		sync.Pool{
-			New: func() interface{} {
-				return &byteBuffer{buf: make([]byte, bufferSize)}
-			},
-		},
+		pool.New(name, func() interface{} {
+			return &byteBuffer{buf: make([]byte, bufferSize)}
+		}),
 	}
 }
 
@@ -0,0 +1,70 @@
+//go:build go1.18
+// +build go1.18
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package mqtt
+
+import (
+	"bytes"
+	"testing"
+)
+
+// FuzzDecodePacket checks that the decoder never panics on malformed packets, and that
+// the packets it accepts can be encoded and decoded back.
+func FuzzDecodePacket(f *testing.F) {
+	for _, m := range []Message{
+		&Connect{ProtoName: []byte("MQTT"), Version: 4, ClientID: []byte("client"), UsernameFlag: true, Username: []byte("user"), PasswordFlag: true, Password: []byte("pass")},
+		&Connect{ProtoName: []byte("MQTT"), Version: 4, WillFlag: true, WillTopic: []byte("a/b/"), WillMessage: []byte("bye")},
+		&Connack{ReturnCode: 0x05},
+		&Publish{Header: Header{QOS: 1}, Topic: []byte("key/a/b/"), MessageID: 1, Payload: []byte("hello")},
+		&Publish{Topic: []byte("key/a/b/?ttl=30&last=5"), Payload: []byte{}},
+		&Puback{MessageID: 1},
+		&Pubrec{MessageID: 2},
+		&Pubrel{Header: Header{QOS: 1}, MessageID: 3},
+		&Pubcomp{MessageID: 4},
+		&Subscribe{MessageID: 5, Subscriptions: []TopicQOSTuple{{Topic: []byte("key/a/+/"), Qos: 1}, {Topic: []byte("key/b/#/")}}},
+		&Suback{MessageID: 5, Qos: []uint8{0, 1}},
+		&Unsubscribe{MessageID: 6, Topics: []TopicQOSTuple{{Topic: []byte("key/a/+/")}}},
+		&Unsuback{MessageID: 6},
+		&Pingreq{},
+		&Pingresp{},
+		&Disconnect{},
+	} {
+		var buffer bytes.Buffer
+		m.EncodeTo(&buffer)
+		f.Add(buffer.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := DecodePacket(bytes.NewReader(data), maxMessageSize)
+		if err != nil {
+			return
+		}
+
+		var buffer bytes.Buffer
+		if _, err := msg.EncodeTo(&buffer); err != nil {
+			return
+		}
+
+		decoded, err := DecodePacket(&buffer, maxMessageSize)
+		if err != nil {
+			t.Fatalf("unable to decode the %s packet encoded back: %v", msg, err)
+		}
+		if decoded.Type() != msg.Type() {
+			t.Fatalf("decoded a %s packet back instead of %s", decoded, msg)
+		}
+	})
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 )
 
 const (
@@ -29,6 +30,10 @@ const (
 var ErrMessageTooLarge = errors.New("mqtt: message size exceeds 64K")
 var ErrMessageBadPacket = errors.New("mqtt: bad packet")
 
+// ErrPayloadTooLarge occurs when the payload of a decoded publish packet is larger than the
+// limit. The packet was skipped without being read into memory, so the reader can still be used.
+var ErrPayloadTooLarge = errors.New("mqtt: payload size exceeds the limit")
+
 //Message is the interface all our packets will be implementing
 type Message interface {
 	fmt.Stringer
@@ -94,7 +99,8 @@ type Connect struct {
 // 0x04 bad user or password
 // 0x05 not authorized
 type Connack struct {
-	ReturnCode uint8
+	SessionPresent bool
+	ReturnCode     uint8
 }
 
 // Publish represents an MQTT publish packet.
@@ -175,7 +181,13 @@ type TopicQOSTuple struct {
 }
 
 // DecodePacket decodes the packet from the provided reader.
-func DecodePacket(rdr Reader, maxMessageSize int64) (Message, error) {
+func DecodePacket(rdr Reader, maxSize int64) (Message, error) {
+	return DecodePacketLimited(rdr, maxSize, 0)
+}
+
+// DecodePacketLimited decodes the packet from the provided reader, skipping the publish
+// packets whose payload is larger than the maximum payload size, unless it is zero.
+func DecodePacketLimited(rdr Reader, maxSize, maxPayload int64) (Message, error) {
 	hdr, sizeOf, messageType, err := decodeHeader(rdr)
 	if err != nil {
 		return nil, err
@@ -192,15 +204,44 @@ func DecodePacket(rdr Reader, maxMessageSize int64) (Message, error) {
 	}
 
 	//check to make sure packet isn't above size limit
-	if int64(sizeOf) > maxMessageSize {
+	if int64(sizeOf) > maxSize {
 		return nil, ErrMessageTooLarge
 	}
 
-	// Now we can decode the buffer. The problem here is that we have to create
-	// a new buffer for the body as we're going to simply create slices around it.
-	// There's probably a way to use a "read buffer" provided to reduce allocations.
-	buffer := make([]byte, sizeOf)
-	_, err = io.ReadFull(rdr, buffer)
+	// Read the length of the topic of a publication first, so that a payload which is too
+	// large is skipped before a buffer is allocated for it
+	var head [2]byte
+	offset := 0
+	if messageType == TypeOfPublish && maxPayload > 0 && sizeOf >= 2 {
+		if _, err = io.ReadFull(rdr, head[:]); err != nil {
+			return nil, err
+		}
+
+		offset = len(head)
+		if payloadSize(hdr, sizeOf, head) > maxPayload {
+			if _, err = io.CopyN(ioutil.Discard, rdr, int64(sizeOf)-int64(offset)); err != nil {
+				return nil, err
+			}
+			return nil, ErrPayloadTooLarge
+		}
+	}
+
+	// Now we can decode the buffer. The packets which are decoded as slices around
+	// their body, such as the topic and the payload of a publication, need a buffer of
+	// their own which is then handed over without any copy, since the message outlives
+	// the packet in the storage and in the queues of the subscribers. The others are
+	// decoded in a pooled buffer, since their fields are copied out of it.
+	var buffer []byte
+	if copiesBody(messageType) && sizeOf <= maxMessageSize {
+		array := buffers.Get()
+		defer buffers.Put(array)
+		buffer = array.Slice(0, int(sizeOf))
+	} else {
+		buffer = make([]byte, sizeOf)
+	}
+
+	copy(buffer, head[:offset])
+	_, err = io.ReadFull(rdr, buffer[offset:])
 	if err != nil {
 		return nil, err
 	}
@@ -211,25 +252,25 @@ func DecodePacket(rdr Reader, maxMessageSize int64) (Message, error) {
 	case TypeOfConnect:
 		msg, err = decodeConnect(buffer)
 	case TypeOfConnack:
-		msg = decodeConnack(buffer, hdr)
+		msg, err = decodeConnack(buffer, hdr)
 	case TypeOfPublish:
 		msg, err = decodePublish(buffer, hdr)
 	case TypeOfPuback:
-		msg = decodePuback(buffer)
+		msg, err = decodePuback(buffer)
 	case TypeOfPubrec:
-		msg = decodePubrec(buffer)
+		msg, err = decodePubrec(buffer)
 	case TypeOfPubrel:
-		msg = decodePubrel(buffer, hdr)
+		msg, err = decodePubrel(buffer, hdr)
 	case TypeOfPubcomp:
-		msg = decodePubcomp(buffer)
+		msg, err = decodePubcomp(buffer)
 	case TypeOfSubscribe:
 		msg, err = decodeSubscribe(buffer, hdr)
 	case TypeOfSuback:
-		msg = decodeSuback(buffer)
+		msg, err = decodeSuback(buffer)
 	case TypeOfUnsubscribe:
 		msg, err = decodeUnsubscribe(buffer, hdr)
 	case TypeOfUnsuback:
-		msg = decodeUnsuback(buffer)
+		msg, err = decodeUnsuback(buffer)
 	default:
 		return nil, fmt.Errorf("Invalid zero-length packet with type %d", messageType)
 	}
@@ -237,6 +278,17 @@ func DecodePacket(rdr Reader, maxMessageSize int64) (Message, error) {
 	return msg, err
 }
 
+// copiesBody returns whether the decoding of a packet type copies its fields out of the
+// body, which can then be reused.
+func copiesBody(messageType uint8) bool {
+	switch messageType {
+	case TypeOfConnack, TypeOfPuback, TypeOfPubrec, TypeOfPubrel, TypeOfPubcomp, TypeOfSuback, TypeOfUnsuback:
+		return true
+	default:
+		return false
+	}
+}
+
 // EncodeTo writes the encoded message to the underlying writer.
 func (c *Connect) EncodeTo(w io.Writer) (int, error) {
 	array := buffers.Get()
@@ -297,7 +349,7 @@ func (c *Connack) EncodeTo(w io.Writer) (int, error) {
 
 	//write padding
 	head, buf := array.Split(maxHeaderSize)
-	offset := writeUint8(buf, byte(0))
+	offset := writeUint8(buf, boolToUInt8(c.SessionPresent))
 	offset += writeUint8(buf[offset:], byte(c.ReturnCode))
 
 	// Write the header in front and return the buffer
@@ -619,8 +671,12 @@ func decodeHeader(rdr Reader) (hdr Header, length uint32, messageType uint8, err
 	multiplier := uint32(1)
 	digit := byte(0x80)
 
-	// Read the length
-	for (digit & 0x80) != 0 {
+	// Read the length, which takes at most 4 bytes
+	for i := 0; (digit & 0x80) != 0; i++ {
+		if i == 4 {
+			return Header{}, 0, 0, ErrMessageBadPacket
+		}
+
 		b, err := rdr.ReadByte()
 		if err != nil {
 			return Header{}, 0, 0, err
@@ -642,11 +698,18 @@ func decodeConnect(data []byte) (Message, error) {
 	if err != nil {
 		return nil, err
 	}
-	ver := uint8(data[bookmark])
-	bookmark++
-	flags := data[bookmark]
-	bookmark++
-	keepalive := readUint16(data, &bookmark)
+	ver, err := readUint8(data, &bookmark)
+	if err != nil {
+		return nil, err
+	}
+	flags, err := readUint8(data, &bookmark)
+	if err != nil {
+		return nil, err
+	}
+	keepalive, err := readUint16(data, &bookmark)
+	if err != nil {
+		return nil, err
+	}
 	cliID, err := readString(data, &bookmark)
 	if err != nil {
 		return nil, err
@@ -659,7 +722,7 @@ func decodeConnect(data []byte) (Message, error) {
 		UsernameFlag:   flags&(1<<7) > 0,
 		PasswordFlag:   flags&(1<<6) > 0,
 		WillRetainFlag: flags&(1<<5) > 0,
-		WillQOS:        (flags & (1 << 4)) + (flags & (1 << 3)),
+		WillQOS:        (flags >> 3) & 0x03,
 		WillFlag:       flags&(1<<2) > 0,
 		CleanSeshFlag:  flags&(1<<1) > 0,
 	}
@@ -687,14 +750,26 @@ func decodeConnect(data []byte) (Message, error) {
 	return connect, nil
 }
 
-func decodeConnack(data []byte, _ Header) Message {
-	//first byte is weird in connack
-	bookmark := uint32(1)
-	retcode := data[bookmark]
+func decodeConnack(data []byte, _ Header) (Message, error) {
+	if len(data) < 2 {
+		return nil, ErrMessageBadPacket
+	}
 
+	// The first byte carries the session present flag
 	return &Connack{
-		ReturnCode: retcode,
+		SessionPresent: data[0]&1 > 0,
+		ReturnCode:     data[1],
+	}, nil
+}
+
+// payloadSize returns the size of the payload of a publish packet, given the length of its
+// body and the first two bytes of it, which are the length of its topic.
+func payloadSize(hdr Header, sizeOf uint32, head [2]byte) int64 {
+	size := int64(sizeOf) - 2 - int64(head[0])<<8 - int64(head[1])
+	if hdr.QOS > 0 {
+		size -= 2 // The message identifier
 	}
+	return size
 }
 
 func decodePublish(data []byte, hdr Header) (Message, error) {
@@ -705,7 +780,9 @@ func decodePublish(data []byte, hdr Header) (Message, error) {
 	}
 	var msgID uint16
 	if hdr.QOS > 0 {
-		msgID = readUint16(data, &bookmark)
+		if msgID, err = readUint16(data, &bookmark); err != nil {
+			return nil, err
+		}
 	}
 
 	return &Publish{
@@ -716,54 +793,69 @@ func decodePublish(data []byte, hdr Header) (Message, error) {
 	}, nil
 }
 
-func decodePuback(data []byte) Message {
+func decodePuback(data []byte) (Message, error) {
 	bookmark := uint32(0)
-	msgID := readUint16(data, &bookmark)
+	msgID, err := readUint16(data, &bookmark)
+	if err != nil {
+		return nil, err
+	}
 	return &Puback{
 		MessageID: msgID,
-	}
+	}, nil
 }
 
-func decodePubrec(data []byte) Message {
+func decodePubrec(data []byte) (Message, error) {
 	bookmark := uint32(0)
-	msgID := readUint16(data, &bookmark)
+	msgID, err := readUint16(data, &bookmark)
+	if err != nil {
+		return nil, err
+	}
 	return &Pubrec{
 		MessageID: msgID,
-	}
+	}, nil
 }
 
-func decodePubrel(data []byte, hdr Header) Message {
+func decodePubrel(data []byte, hdr Header) (Message, error) {
 	bookmark := uint32(0)
-	msgID := readUint16(data, &bookmark)
+	msgID, err := readUint16(data, &bookmark)
+	if err != nil {
+		return nil, err
+	}
 	return &Pubrel{
 		Header:    hdr,
 		MessageID: msgID,
-	}
+	}, nil
 }
 
-func decodePubcomp(data []byte) Message {
+func decodePubcomp(data []byte) (Message, error) {
 	bookmark := uint32(0)
-	msgID := readUint16(data, &bookmark)
+	msgID, err := readUint16(data, &bookmark)
+	if err != nil {
+		return nil, err
+	}
 	return &Pubcomp{
 		MessageID: msgID,
-	}
+	}, nil
 }
 
 func decodeSubscribe(data []byte, hdr Header) (Message, error) {
 	bookmark := uint32(0)
-	msgID := readUint16(data, &bookmark)
+	msgID, err := readUint16(data, &bookmark)
+	if err != nil {
+		return nil, err
+	}
 	var topics []TopicQOSTuple
 	maxlen := uint32(len(data))
-	var err error
 	for bookmark < maxlen {
 		var t TopicQOSTuple
 		t.Topic, err = readString(data, &bookmark)
 		if err != nil {
 			return nil, err
 		}
-		qos := data[bookmark]
-		bookmark++
-		t.Qos = uint8(qos)
+		t.Qos, err = readUint8(data, &bookmark)
+		if err != nil {
+			return nil, err
+		}
 		topics = append(topics, t)
 	}
 	return &Subscribe{
@@ -773,9 +865,12 @@ func decodeSubscribe(data []byte, hdr Header) (Message, error) {
 	}, nil
 }
 
-func decodeSuback(data []byte) Message {
+func decodeSuback(data []byte) (Message, error) {
 	bookmark := uint32(0)
-	msgID := readUint16(data, &bookmark)
+	msgID, err := readUint16(data, &bookmark)
+	if err != nil {
+		return nil, err
+	}
 	var qoses []uint8
 	maxlen := uint32(len(data))
 	//is this efficient
@@ -787,15 +882,17 @@ func decodeSuback(data []byte) Message {
 	return &Suback{
 		MessageID: msgID,
 		Qos:       qoses,
-	}
+	}, nil
 }
 
 func decodeUnsubscribe(data []byte, hdr Header) (Message, error) {
 	bookmark := uint32(0)
 	var topics []TopicQOSTuple
-	msgID := readUint16(data, &bookmark)
+	msgID, err := readUint16(data, &bookmark)
+	if err != nil {
+		return nil, err
+	}
 	maxlen := uint32(len(data))
-	var err error
 	for bookmark < maxlen {
 		var t TopicQOSTuple
 		//		qos := data[bookmark]
@@ -814,12 +911,15 @@ func decodeUnsubscribe(data []byte, hdr Header) (Message, error) {
 	}, nil
 }
 
-func decodeUnsuback(data []byte) Message {
+func decodeUnsuback(data []byte) (Message, error) {
 	bookmark := uint32(0)
-	msgID := readUint16(data, &bookmark)
+	msgID, err := readUint16(data, &bookmark)
+	if err != nil {
+		return nil, err
+	}
 	return &Unsuback{
 		MessageID: msgID,
-	}
+	}, nil
 }
 
 func decodePingreq() Message {
@@ -879,7 +979,10 @@ func writeUint8(buf []byte, v uint8) int {
 }
 
 func readString(b []byte, startsAt *uint32) ([]byte, error) {
-	l := readUint16(b, startsAt)
+	l, err := readUint16(b, startsAt)
+	if err != nil {
+		return nil, err
+	}
 	if uint32(l)+*startsAt > uint32(len(b)) {
 		return nil, ErrMessageBadPacket
 	}
@@ -888,12 +991,26 @@ func readString(b []byte, startsAt *uint32) ([]byte, error) {
 	return v, nil
 }
 
-func readUint16(b []byte, startsAt *uint32) uint16 {
+func readUint16(b []byte, startsAt *uint32) (uint16, error) {
+	if uint64(*startsAt)+2 > uint64(len(b)) {
+		return 0, ErrMessageBadPacket
+	}
+
 	b0 := uint16(b[*startsAt])
 	b1 := uint16(b[*startsAt+1])
 	*startsAt += 2
 
-	return (b0 << 8) + b1
+	return (b0 << 8) + b1, nil
+}
+
+func readUint8(b []byte, startsAt *uint32) (uint8, error) {
+	if uint64(*startsAt) >= uint64(len(b)) {
+		return 0, ErrMessageBadPacket
+	}
+
+	v := b[*startsAt]
+	*startsAt++
+	return v, nil
 }
 
 func boolToUInt8(v bool) uint8 {
@@ -162,6 +162,15 @@ func Test_Connack(t *testing.T) {
 	if !assertMessage(t, testPkt) {
 		t.Error("encode/decode connack failed")
 	}
+
+	// The session present flag is carried along
+	buf := bytes.NewBuffer([]byte{})
+	testPkt.SessionPresent = true
+	_, err := testPkt.EncodeTo(buf)
+	assert.NoError(t, err)
+	msg, err := DecodePacket(buf, 65536)
+	assert.NoError(t, err)
+	assert.Equal(t, testPkt, msg)
 }
 
 func Test_Publish(t *testing.T) {
@@ -232,6 +241,62 @@ func Test_Publish_WithUnicodeDecoding(t *testing.T) {
 	assert.Equal(t, pay, msg.(*Publish).Payload)
 }
 
+func Test_DecodePacketLimited(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{})
+	for _, pub := range []*Publish{
+		{Topic: []byte("a/b/c"), Payload: []byte("hello world")},
+		{Header: Header{QOS: 1}, Topic: []byte("a/b/c"), Payload: []byte("hello"), MessageID: 7},
+		{Header: Header{QOS: 1}, Topic: []byte("a/b/c"), Payload: []byte("hi you"), MessageID: 8},
+	} {
+		_, err := pub.EncodeTo(buf)
+		assert.NoError(t, err)
+	}
+	_, err := (&Puback{MessageID: 2}).EncodeTo(buf)
+	assert.NoError(t, err)
+
+	// The payloads which are too large are skipped, without losing the following packets
+	_, err = DecodePacketLimited(buf, 65536, 6)
+	assert.Equal(t, ErrPayloadTooLarge, err)
+
+	msg, err := DecodePacketLimited(buf, 65536, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, &Publish{Header: Header{QOS: 1}, Topic: []byte("a/b/c"), Payload: []byte("hello"), MessageID: 7}, msg)
+
+	msg, err = DecodePacketLimited(buf, 65536, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hi you"), msg.(*Publish).Payload)
+
+	msg, err = DecodePacketLimited(buf, 65536, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, &Puback{MessageID: 2}, msg)
+}
+
+func Test_DecodeReusesBuffers(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{})
+	pub := &Publish{Topic: []byte("a/b/c"), Payload: []byte("hello")}
+	_, err := pub.EncodeTo(buf)
+	assert.NoError(t, err)
+	_, err = (&Suback{MessageID: 1, Qos: []uint8{0, 1}}).EncodeTo(buf)
+	assert.NoError(t, err)
+	_, err = (&Puback{MessageID: 2}).EncodeTo(buf)
+	assert.NoError(t, err)
+
+	// The publication keeps its own buffer, while the acknowledgements are copied out of
+	// the pooled ones
+	first, err := DecodePacket(buf, 65536)
+	assert.NoError(t, err)
+	second, err := DecodePacket(buf, 65536)
+	assert.NoError(t, err)
+	third, err := DecodePacket(buf, 65536)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "hello", string(first.(*Publish).Payload))
+	assert.Equal(t, []uint8{0, 1}, second.(*Suback).Qos)
+	assert.Equal(t, uint16(2), third.(*Puback).MessageID)
+	assert.False(t, copiesBody(TypeOfPublish))
+	assert.True(t, copiesBody(TypeOfPuback))
+}
+
 func Test_Puback(t *testing.T) {
 	testPkt := &Puback{
 		MessageID: 0xbeef,
@@ -473,3 +538,36 @@ func decodeLen(field []byte) uint32 {
 	}
 	return length
 }
+
+func Test_DecodeMalformed(t *testing.T) {
+	for _, packet := range [][]byte{
+		{0x10, 0x06, 0x00, 0x04, 'M', 'Q', 'T', 'T'},          // connect without version
+		{0x10, 0x09, 0x00, 0x04, 'M', 'Q', 'T', 'T', 4, 0, 0}, // connect without client id
+		{0x20, 0x01, 0x00},                 // connack without return code
+		{0x32, 0x04, 0x00, 0x02, 'a', '/'}, // publish without message id
+		{0x40, 0x01, 0x00},                 // puback without message id
+		{0x50, 0x00},                       // pubrec without message id
+		{0x62, 0x01, 0x00},                 // pubrel without message id
+		{0x70, 0x00},                       // pubcomp without message id
+		{0x82, 0x06, 0x00, 0x01, 0x00, 0x02, 'a', '/'}, // subscribe without qos
+		{0x90, 0x01, 0x00},                   // suback without message id
+		{0xa2, 0x01, 0x00},                   // unsubscribe without message id
+		{0xb0, 0x00},                         // unsuback without message id
+		{0x30, 0xff, 0xff, 0xff, 0xff, 0x01}, // length over 4 bytes
+	} {
+		assert.NotPanics(t, func() {
+			_, err := DecodePacket(bytes.NewReader(packet), 65536)
+			assert.Error(t, err, "packet %x", packet)
+		})
+	}
+}
+
+func Test_DecodeWillQOS(t *testing.T) {
+	connect := &Connect{ProtoName: []byte("MQTT"), Version: 4, WillFlag: true, WillQOS: 2, WillTopic: []byte("a/"), WillMessage: []byte("b")}
+	var buffer bytes.Buffer
+	connect.EncodeTo(&buffer)
+
+	msg, err := DecodePacket(&buffer, 65536)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(2), msg.(*Connect).WillQOS)
+}
@@ -0,0 +1,193 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package poll
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrUnsupported is returned when the connections can not be polled on this platform.
+	ErrUnsupported = errors.New("poll: not supported on this platform")
+
+	// ErrClosed is returned when waiting on a poller which was closed.
+	ErrClosed = errors.New("poll: poller closed")
+)
+
+// Poller waits for idle connections to become readable, on a single goroutine for all of
+// them, so that the connections do not each need a goroutine blocked on reading.
+type Poller struct {
+	sync.Mutex
+	queue   *queue          // The readiness queue of the platform.
+	waiters map[int]*waiter // The connections waited for, by file descriptor.
+	closed  bool            // Whether the poller was closed.
+}
+
+// waiter represents a connection waited for.
+type waiter struct {
+	fd    int         // The file descriptor of the connection.
+	fn    func(bool)  // The function to call once readable or expired.
+	timer *time.Timer // The timer of the expiry.
+}
+
+// New creates a new poller and starts waiting for the readiness of its connections.
+func New() (*Poller, error) {
+	q, err := newQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Poller{
+		queue:   q,
+		waiters: make(map[int]*waiter),
+	}
+
+	go q.run(p.onReady)
+	return p, nil
+}
+
+// Wait waits for the connection to become readable, then calls the function on a new
+// goroutine. If the connection is not readable within the timeout, the function is called
+// with ready unset and the connection is no longer waited for. The connection must expose
+// its file descriptor and must not be read until the function is called.
+func (p *Poller) Wait(conn net.Conn, timeout time.Duration, fn func(ready bool)) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	// The file descriptor is only guaranteed to be open while it is controlled
+	if cerr := raw.Control(func(fd uintptr) {
+		err = p.add(int(fd), timeout, fn)
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// Remove stops waiting for the connection without calling its function, for instance
+// because it is being closed. This must be called before the connection is closed, so that
+// the file descriptor, which may be reused once closed, still refers to the connection.
+func (p *Poller) Remove(conn net.Conn) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return
+	}
+
+	raw.Control(func(fd uintptr) {
+		p.Lock()
+		w, ok := p.waiters[int(fd)]
+		if ok {
+			delete(p.waiters, w.fd)
+			p.queue.remove(w.fd)
+		}
+		p.Unlock()
+
+		if ok {
+			w.timer.Stop()
+		}
+	})
+}
+
+// Len returns the number of connections waited for.
+func (p *Poller) Len() int {
+	p.Lock()
+	defer p.Unlock()
+	return len(p.waiters)
+}
+
+// Close closes the poller, calling the function of every connection waited for with ready
+// unset.
+func (p *Poller) Close() error {
+	p.Lock()
+	if p.closed {
+		p.Unlock()
+		return nil
+	}
+
+	p.closed = true
+	waiters := p.waiters
+	p.waiters = make(map[int]*waiter)
+	p.Unlock()
+
+	for _, w := range waiters {
+		w.timer.Stop()
+		go w.fn(false)
+	}
+	return p.queue.close()
+}
+
+// add starts waiting for a file descriptor.
+func (p *Poller) add(fd int, timeout time.Duration, fn func(bool)) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+
+	if err := p.queue.add(fd); err != nil {
+		return err
+	}
+
+	w := &waiter{fd: fd, fn: fn}
+	w.timer = time.AfterFunc(timeout, func() {
+		p.release(w, false)
+	})
+
+	p.waiters[fd] = w
+	return nil
+}
+
+// onReady occurs when a file descriptor becomes readable.
+func (p *Poller) onReady(fd int) {
+	p.Lock()
+	w := p.waiters[fd]
+	p.Unlock()
+
+	if w != nil {
+		p.release(w, true)
+	}
+}
+
+// release stops waiting for a connection and calls its function, unless it was already
+// released.
+func (p *Poller) release(w *waiter, ready bool) {
+	p.Lock()
+	if p.waiters[w.fd] != w {
+		p.Unlock()
+		return
+	}
+
+	delete(p.waiters, w.fd)
+	p.queue.remove(w.fd)
+	p.Unlock()
+
+	w.timer.Stop()
+	go w.fn(ready)
+}
@@ -0,0 +1,104 @@
+//go:build darwin || freebsd || netbsd || openbsd
+// +build darwin freebsd netbsd openbsd
+
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package poll
+
+import (
+	"syscall"
+)
+
+// queue represents the readiness queue of the connections, implemented with kqueue.
+type queue struct {
+	fd   int    // The kqueue instance.
+	wake [2]int // The pipe waking up the loop once closed.
+}
+
+// newQueue creates a new readiness queue.
+func newQueue() (*queue, error) {
+	fd, err := syscall.Kqueue()
+	if err != nil {
+		return nil, err
+	}
+
+	q := &queue{fd: fd}
+	syscall.CloseOnExec(fd)
+	if err := syscall.Pipe(q.wake[:]); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	if err := q.change(q.wake[0], syscall.EV_ADD); err != nil {
+		q.release()
+		return nil, err
+	}
+	return q, nil
+}
+
+// add starts waiting for a file descriptor to become readable, once.
+func (q *queue) add(fd int) error {
+	return q.change(fd, syscall.EV_ADD|syscall.EV_ONESHOT)
+}
+
+// remove stops waiting for a file descriptor.
+func (q *queue) remove(fd int) {
+	_ = q.change(fd, syscall.EV_DELETE)
+}
+
+// change changes the registration of a file descriptor.
+func (q *queue) change(fd, flags int) error {
+	var ev [1]syscall.Kevent_t
+	syscall.SetKevent(&ev[0], fd, syscall.EVFILT_READ, flags)
+	_, err := syscall.Kevent(q.fd, ev[:], nil, nil)
+	return err
+}
+
+// run calls the function with every file descriptor which becomes readable, until the
+// queue is closed.
+func (q *queue) run(fn func(fd int)) {
+	defer q.release()
+	events := make([]syscall.Kevent_t, 128)
+	for {
+		n, err := syscall.Kevent(q.fd, nil, events, nil)
+		switch {
+		case err == syscall.EINTR:
+			continue
+		case err != nil:
+			return
+		}
+
+		for i := 0; i < n; i++ {
+			fd := int(events[i].Ident)
+			if fd == q.wake[0] {
+				return
+			}
+			fn(fd)
+		}
+	}
+}
+
+// close wakes up the loop so it stops.
+func (q *queue) close() error {
+	_, err := syscall.Write(q.wake[1], []byte{0})
+	return err
+}
+
+// release closes the file descriptors of the queue.
+func (q *queue) release() {
+	syscall.Close(q.wake[0])
+	syscall.Close(q.wake[1])
+	syscall.Close(q.fd)
+}
@@ -0,0 +1,100 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package poll
+
+import (
+	"syscall"
+)
+
+// queue represents the readiness queue of the connections, implemented with epoll.
+type queue struct {
+	fd   int    // The epoll instance.
+	wake [2]int // The pipe waking up the loop once closed.
+}
+
+// newQueue creates a new readiness queue.
+func newQueue() (*queue, error) {
+	fd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &queue{fd: fd}
+	if err := syscall.Pipe2(q.wake[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	if err := q.ctl(syscall.EPOLL_CTL_ADD, q.wake[0], syscall.EPOLLIN); err != nil {
+		q.release()
+		return nil, err
+	}
+	return q, nil
+}
+
+// add starts waiting for a file descriptor to become readable, once.
+func (q *queue) add(fd int) error {
+	return q.ctl(syscall.EPOLL_CTL_ADD, fd, syscall.EPOLLIN|syscall.EPOLLRDHUP|syscall.EPOLLONESHOT)
+}
+
+// remove stops waiting for a file descriptor.
+func (q *queue) remove(fd int) {
+	_ = q.ctl(syscall.EPOLL_CTL_DEL, fd, 0)
+}
+
+// ctl changes the registration of a file descriptor.
+func (q *queue) ctl(op, fd int, events uint32) error {
+	return syscall.EpollCtl(q.fd, op, fd, &syscall.EpollEvent{
+		Events: events,
+		Fd:     int32(fd),
+	})
+}
+
+// run calls the function with every file descriptor which becomes readable, until the
+// queue is closed.
+func (q *queue) run(fn func(fd int)) {
+	defer q.release()
+	events := make([]syscall.EpollEvent, 128)
+	for {
+		n, err := syscall.EpollWait(q.fd, events, -1)
+		switch {
+		case err == syscall.EINTR:
+			continue
+		case err != nil:
+			return
+		}
+
+		for i := 0; i < n; i++ {
+			fd := int(events[i].Fd)
+			if fd == q.wake[0] {
+				return
+			}
+			fn(fd)
+		}
+	}
+}
+
+// close wakes up the loop so it stops.
+func (q *queue) close() error {
+	_, err := syscall.Write(q.wake[1], []byte{0})
+	return err
+}
+
+// release closes the file descriptors of the queue.
+func (q *queue) release() {
+	syscall.Close(q.wake[0])
+	syscall.Close(q.wake[1])
+	syscall.Close(q.fd)
+}
@@ -0,0 +1,32 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package poll
+
+// queue represents the readiness queue of the connections, which is not supported on
+// this platform.
+type queue struct{}
+
+// newQueue returns an error, since the platform has no readiness queue.
+func newQueue() (*queue, error) {
+	return nil, ErrUnsupported
+}
+
+func (q *queue) add(fd int) error    { return ErrUnsupported }
+func (q *queue) remove(fd int)       {}
+func (q *queue) run(fn func(fd int)) {}
+func (q *queue) close() error        { return nil }
@@ -0,0 +1,175 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package poll
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newPair creates a pair of connected TCP connections.
+func newPair(t *testing.T) (server, client net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	client, err = net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	server, err = l.Accept()
+	assert.NoError(t, err)
+	return
+}
+
+// newPoller creates a new poller, skipping the test if the platform has none.
+func newPoller(t *testing.T) *Poller {
+	p, err := New()
+	if err == ErrUnsupported {
+		t.Skip(err)
+	}
+
+	assert.NoError(t, err)
+	return p
+}
+
+func TestPoller_Ready(t *testing.T) {
+	p := newPoller(t)
+	defer p.Close()
+
+	server, client := newPair(t)
+	defer server.Close()
+	defer client.Close()
+
+	ready := make(chan bool, 1)
+	assert.NoError(t, p.Wait(server, time.Minute, func(ok bool) {
+		ready <- ok
+	}))
+	assert.Equal(t, 1, p.Len())
+
+	// Nothing happens until the connection is readable
+	select {
+	case <-ready:
+		assert.Fail(t, "ready without any data")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	client.Write([]byte{1, 2, 3})
+	assert.True(t, <-ready)
+	assert.Equal(t, 0, p.Len())
+
+	// The data is left for the connection to read
+	buffer := make([]byte, 3)
+	n, err := server.Read(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// The connection can be waited for again, and is ready right away if data is pending
+	client.Write([]byte{4})
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, p.Wait(server, time.Minute, func(ok bool) {
+		ready <- ok
+	}))
+	assert.True(t, <-ready)
+}
+
+func TestPoller_Hangup(t *testing.T) {
+	p := newPoller(t)
+	defer p.Close()
+
+	server, client := newPair(t)
+	defer server.Close()
+
+	ready := make(chan bool, 1)
+	assert.NoError(t, p.Wait(server, time.Minute, func(ok bool) {
+		ready <- ok
+	}))
+
+	client.Close()
+	assert.True(t, <-ready)
+}
+
+func TestPoller_Expire(t *testing.T) {
+	p := newPoller(t)
+	defer p.Close()
+
+	server, client := newPair(t)
+	defer server.Close()
+	defer client.Close()
+
+	ready := make(chan bool, 1)
+	assert.NoError(t, p.Wait(server, 10*time.Millisecond, func(ok bool) {
+		ready <- ok
+	}))
+
+	assert.False(t, <-ready)
+	assert.Equal(t, 0, p.Len())
+}
+
+func TestPoller_Remove(t *testing.T) {
+	p := newPoller(t)
+	defer p.Close()
+
+	server, client := newPair(t)
+	defer client.Close()
+
+	called := make(chan bool, 1)
+	assert.NoError(t, p.Wait(server, 50*time.Millisecond, func(ok bool) {
+		called <- ok
+	}))
+
+	// The connection closed while waited for is forgotten, without calling its function
+	p.Remove(server)
+	server.Close()
+	assert.Equal(t, 0, p.Len())
+	select {
+	case <-called:
+		assert.Fail(t, "called once removed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Removing a connection which is not waited for does nothing
+	p.Remove(client)
+	assert.Equal(t, 0, p.Len())
+}
+
+func TestPoller_Close(t *testing.T) {
+	p := newPoller(t)
+	server, client := newPair(t)
+	defer server.Close()
+	defer client.Close()
+
+	ready := make(chan bool, 1)
+	assert.NoError(t, p.Wait(server, time.Minute, func(ok bool) {
+		ready <- ok
+	}))
+
+	// The connections waited for are released
+	assert.NoError(t, p.Close())
+	assert.False(t, <-ready)
+	assert.Equal(t, ErrClosed, p.Wait(server, time.Minute, func(bool) {}))
+}
+
+func TestPoller_Unsupported(t *testing.T) {
+	p := newPoller(t)
+	defer p.Close()
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	assert.Equal(t, ErrUnsupported, p.Wait(server, time.Minute, func(bool) {}))
+}
@@ -0,0 +1,29 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package quic
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// Protocol is the application protocol negotiated by the QUIC connections.
+const Protocol = "mqtt"
+
+// Config represents the configuration of a QUIC listener.
+type Config struct {
+	TLS   *tls.Config                    // The TLS configuration, QUIC being always encrypted.
+	Admit func(net.Addr) (func(), error) // The admission of the connections, or nil to admit any.
+}
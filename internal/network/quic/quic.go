@@ -0,0 +1,216 @@
+//go:build quic
+// +build quic
+
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	quicgo "github.com/quic-go/quic-go"
+)
+
+const (
+	streamTimeout = 10 * time.Second // The time given to a client to open its stream.
+	idleTimeout   = 60 * time.Second // The time after which an idle connection is closed.
+	backlog       = 64               // The number of connections waiting to be accepted.
+)
+
+// Listen announces on the UDP address and accepts the MQTT connections over QUIC. Each
+// connection carries a single bidirectional stream, opened by the client, which is the
+// MQTT session. Since QUIC identifies the connections by their own identifier rather than
+// by address, a client roaming from a network to another keeps its session.
+func Listen(address string, config Config) (net.Listener, error) {
+	root, err := quicgo.ListenAddr(address, withProtocol(config.TLS), &quicgo.Config{
+		MaxIdleTimeout:        idleTimeout,
+		KeepAlivePeriod:       idleTimeout / 2,
+		MaxIncomingStreams:    1,
+		MaxIncomingUniStreams: -1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &listener{
+		root:     root,
+		config:   config,
+		context:  ctx,
+		cancel:   cancel,
+		accepted: make(chan net.Conn, backlog),
+		failed:   make(chan error, 1),
+	}
+
+	go l.serve()
+	return l, nil
+}
+
+// listener represents a QUIC listener.
+type listener struct {
+	root     *quicgo.Listener   // The underlying QUIC listener.
+	config   Config             // The configuration of the listener.
+	context  context.Context    // The context of the listener.
+	cancel   context.CancelFunc // The cancellation of the listener.
+	accepted chan net.Conn      // The connections whose stream was opened.
+	failed   chan error         // The error which stopped the listener.
+}
+
+// serve accepts the QUIC connections and waits for their stream in the background, so
+// a client which is slow to open it does not hold the others back.
+func (l *listener) serve() {
+	for {
+		conn, err := l.root.Accept(l.context)
+		if err != nil {
+			l.failed <- err
+			return
+		}
+
+		go l.open(conn)
+	}
+}
+
+// open waits for the stream of a connection and hands it over to the listener.
+func (l *listener) open(conn quicgo.Connection) {
+	release := func() {}
+	if l.config.Admit != nil {
+		admitted, err := l.config.Admit(conn.RemoteAddr())
+		if err != nil {
+			conn.CloseWithError(0, err.Error())
+			return
+		}
+		release = admitted
+	}
+
+	ctx, cancel := context.WithTimeout(l.context, streamTimeout)
+	defer cancel()
+
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		release()
+		conn.CloseWithError(0, "no stream was opened")
+		return
+	}
+
+	c := &Conn{conn: conn, stream: stream, release: release}
+	select {
+	case l.accepted <- c:
+	case <-l.context.Done():
+		c.Close()
+	}
+}
+
+// Accept waits for and returns the next connection to the listener.
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accepted:
+		return c, nil
+	case err := <-l.failed:
+		l.failed <- err
+		return nil, err
+	}
+}
+
+// Close closes the listener.
+func (l *listener) Close() error {
+	l.cancel()
+	return l.root.Close()
+}
+
+// Addr returns the listener's network address.
+func (l *listener) Addr() net.Addr {
+	return l.root.Addr()
+}
+
+// withProtocol returns a copy of the TLS configuration which negotiates the MQTT protocol,
+// as the application protocol is required by QUIC, including for the configurations
+// selected per client.
+func withProtocol(config *tls.Config) *tls.Config {
+	c := config.Clone()
+	c.NextProtos = []string{Protocol}
+	if get := c.GetConfigForClient; get != nil {
+		c.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			conf, err := get(hello)
+			if err != nil || conf == nil {
+				return conf, err
+			}
+
+			conf = conf.Clone()
+			conf.NextProtos = []string{Protocol}
+			return conf, nil
+		}
+	}
+	return c
+}
+
+// ------------------------------------------------------------------------------------
+
+// Conn represents the MQTT session carried by the stream of a QUIC connection.
+type Conn struct {
+	conn    quicgo.Connection // The underlying QUIC connection.
+	stream  quicgo.Stream     // The stream of the session.
+	release func()            // The function releasing the admission of the connection.
+	closed  sync.Once         // Whether the connection was closed.
+}
+
+// Read reads data from the stream.
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.stream.Read(b)
+}
+
+// Write writes data to the stream.
+func (c *Conn) Write(b []byte) (int, error) {
+	return c.stream.Write(b)
+}
+
+// Close closes the stream along with its connection.
+func (c *Conn) Close() error {
+	c.closed.Do(func() {
+		c.stream.Close()
+		c.conn.CloseWithError(0, "")
+		c.release()
+	})
+	return nil
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the current network address of the client, which changes as the
+// connection migrates.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the stream.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.stream.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the stream.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.stream.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the stream.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.stream.SetWriteDeadline(t)
+}
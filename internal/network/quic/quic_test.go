@@ -0,0 +1,138 @@
+//go:build quic
+// +build quic
+
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package quic
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	quicgo "github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// newCertificate generates a self-signed certificate for the local host.
+func newCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// dial opens a stream to the listener and writes the payload on it.
+func dial(t *testing.T, addr string, payload string) quicgo.Stream {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := quicgo.DialAddr(ctx, addr, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{Protocol},
+	}, nil)
+	assert.NoError(t, err)
+
+	stream, err := conn.OpenStreamSync(ctx)
+	assert.NoError(t, err)
+	_, err = stream.Write([]byte(payload))
+	assert.NoError(t, err)
+	return stream
+}
+
+func TestListen(t *testing.T) {
+	cert := newCertificate(t)
+	l, err := Listen("127.0.0.1:0", Config{
+		TLS: &tls.Config{
+			GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+				return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+			},
+		},
+	})
+	assert.NoError(t, err)
+	defer l.Close()
+
+	stream := dial(t, l.Addr().String(), "ping")
+	defer stream.Close()
+
+	conn, err := l.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	buffer := make([]byte, 4)
+	_, err = io.ReadFull(conn, buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(buffer))
+
+	_, err = conn.Write([]byte("pong"))
+	assert.NoError(t, err)
+	_, err = io.ReadFull(stream, buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", string(buffer))
+}
+
+func TestListen_Denied(t *testing.T) {
+	var calls, released int32
+	admitted := make(chan bool, 2)
+	l, err := Listen("127.0.0.1:0", Config{
+		TLS: &tls.Config{Certificates: []tls.Certificate{newCertificate(t)}},
+		Admit: func(addr net.Addr) (func(), error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				admitted <- false
+				return nil, errors.New("denied")
+			}
+
+			admitted <- true
+			return func() { atomic.AddInt32(&released, 1) }, nil
+		},
+	})
+	assert.NoError(t, err)
+	defer l.Close()
+
+	// The first connection is denied, while the second one is accepted
+	dial(t, l.Addr().String(), "a")
+	assert.False(t, <-admitted)
+	dial(t, l.Addr().String(), "b")
+
+	conn, err := l.Accept()
+	assert.NoError(t, err)
+	buffer := make([]byte, 1)
+	_, err = io.ReadFull(conn, buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", string(buffer))
+
+	conn.Close()
+	conn.Close()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&released))
+}
@@ -32,14 +32,16 @@ type websocketConn interface {
 	RemoteAddr() net.Addr
 	SetReadDeadline(t time.Time) error
 	SetWriteDeadline(t time.Time) error
+	EnableWriteCompression(enable bool)
 }
 
 // websocketConn represents a websocket connection.
 type websocketTransport struct {
 	sync.Mutex
-	socket  websocketConn
-	reader  io.Reader
-	closing chan bool
+	socket    websocketConn
+	reader    io.Reader
+	closing   chan bool
+	threshold int // The minimum size of the compressed messages, if compression is enabled.
 }
 
 const (
@@ -49,23 +51,97 @@ const (
 	closeGracePeriod = 10 * time.Second    // Time to wait before force close on connection.
 )
 
+// DefaultSubprotocols are the subprotocols of MQTT over websocket, for MQTT 3.1.1 and 3.1.
+var DefaultSubprotocols = []string{"mqtt", "mqttv3.1", "mqttv3"}
+
 // The default upgrader to use
-var upgrader = &websocket.Upgrader{
-	Subprotocols: []string{"mqttv3.1", "mqttv3", "mqtt"},
-	CheckOrigin:  func(r *http.Request) bool { return true },
+var upgrader = NewUpgrader(Options{})
+
+// Options represents the options of the websocket connections of a listener.
+type Options struct {
+	Compression  bool     // Whether permessage-deflate is negotiated with the clients supporting it.
+	Level        int      // The compression level, from 1 (fastest) to 9 (smallest), or zero for the default.
+	Threshold    int      // The minimum size of the compressed messages, the smaller ones being sent as they are.
+	Subprotocols []string // The subprotocols supported, defaulting to the ones of MQTT.
+	Strict       bool     // Whether the clients must request one of the subprotocols.
+}
+
+// Upgrader represents an upgrader of the HTTP requests to MQTT over websocket.
+type Upgrader struct {
+	upgrader  websocket.Upgrader // The underlying upgrader.
+	options   Options            // The options of the connections.
+	protocols map[string]bool    // The subprotocols supported.
+}
+
+// NewUpgrader creates a new upgrader with the options of a listener.
+func NewUpgrader(options Options) *Upgrader {
+	if len(options.Subprotocols) == 0 {
+		options.Subprotocols = DefaultSubprotocols
+	}
+
+	u := &Upgrader{
+		options:   options,
+		protocols: make(map[string]bool, len(options.Subprotocols)),
+		upgrader: websocket.Upgrader{
+			EnableCompression: options.Compression,
+			CheckOrigin:       func(r *http.Request) bool { return true },
+		},
+	}
+
+	for _, v := range options.Subprotocols {
+		u.protocols[v] = true
+	}
+	return u
 }
 
 // TryUpgrade attempts to upgrade an HTTP request to mqtt over websocket.
 func TryUpgrade(w http.ResponseWriter, r *http.Request) (net.Conn, bool) {
+	return upgrader.TryUpgrade(w, r)
+}
+
+// TryUpgrade attempts to upgrade an HTTP request to mqtt over websocket. If the upgrader is
+// strict, the requests which do not ask for any of its subprotocols are refused.
+func (u *Upgrader) TryUpgrade(w http.ResponseWriter, r *http.Request) (net.Conn, bool) {
 	if w == nil || r == nil {
 		return nil, false
 	}
 
-	if ws, err := upgrader.Upgrade(w, r, nil); err == nil {
-		return newConn(ws), true
+	protocol := u.negotiate(r)
+	if protocol == "" && u.options.Strict && websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, "websocket: none of the requested subprotocols is supported", http.StatusBadRequest)
+		return nil, false
 	}
 
-	return nil, false
+	header := make(http.Header)
+	if protocol != "" {
+		header.Set("Sec-Websocket-Protocol", protocol)
+	}
+
+	ws, err := u.upgrader.Upgrade(w, r, header)
+	if err != nil {
+		return nil, false
+	}
+
+	if u.options.Compression && u.options.Level != 0 {
+		ws.SetCompressionLevel(u.options.Level)
+	}
+
+	conn := newConn(ws).(*websocketTransport)
+	if u.options.Compression {
+		conn.threshold = u.options.Threshold
+	}
+	return conn, true
+}
+
+// negotiate returns the first subprotocol requested by the client which is supported, since
+// the client lists them by order of preference, or an empty string if there is none.
+func (u *Upgrader) negotiate(r *http.Request) string {
+	for _, v := range websocket.Subprotocols(r) {
+		if u.protocols[v] {
+			return v
+		}
+	}
+	return ""
 }
 
 // newConn creates a new transport from websocket.
@@ -134,6 +210,11 @@ func (c *websocketTransport) Write(b []byte) (n int, err error) {
 	c.Lock()
 	defer c.Unlock()
 
+	// Leave the small messages uncompressed, as the compression would not pay for itself
+	if c.threshold > 0 {
+		c.socket.EnableWriteCompression(len(b) >= c.threshold)
+	}
+
 	var w io.WriteCloser
 	if w, err = c.socket.NextWriter(websocket.BinaryMessage); err == nil {
 		if n, err = w.Write(b); err == nil {
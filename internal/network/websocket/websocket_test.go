@@ -32,8 +32,9 @@ func (w *writer) Close() error                         { return nil }
 func (w *writer) Write(data []byte) (n int, err error) { return ((*bytes.Buffer)(w)).Write(data) }
 
 type conn struct {
-	read  []byte
-	write *writer
+	read       []byte
+	write      *writer
+	compressed []bool
 }
 
 func (c *conn) NextReader() (messageType int, r io.Reader, err error) {
@@ -58,6 +59,7 @@ func (c *conn) LocalAddr() net.Addr                { return &net.IPAddr{} }
 func (c *conn) RemoteAddr() net.Addr               { return &net.IPAddr{} }
 func (c *conn) SetReadDeadline(t time.Time) error  { return nil }
 func (c *conn) SetWriteDeadline(t time.Time) error { return nil }
+func (c *conn) EnableWriteCompression(enable bool) { c.compressed = append(c.compressed, enable) }
 
 func TestTryUpgradeNil(t *testing.T) {
 	_, ok := TryUpgrade(nil, nil)
@@ -86,6 +88,63 @@ func TestTryUpgrade(t *testing.T) {
 	//assert.True(t, ok)
 }
 
+func TestUpgrader_Negotiate(t *testing.T) {
+	tests := []struct {
+		supported []string
+		requested string
+		expect    string
+	}{
+		{requested: "", expect: ""},
+		{requested: "mqtt", expect: "mqtt"},
+		{requested: "mqttv3.1", expect: "mqttv3.1"},
+		{requested: "mqttv3.1, mqtt", expect: "mqttv3.1"},
+		{requested: "wamp, mqtt", expect: "mqtt"},
+		{requested: "wamp", expect: ""},
+		{supported: []string{"mqtt"}, requested: "mqttv3.1", expect: ""},
+	}
+
+	for _, tc := range tests {
+		r := httptest.NewRequest("GET", "http://127.0.0.1/", nil)
+		if tc.requested != "" {
+			r.Header.Set("Sec-WebSocket-Protocol", tc.requested)
+		}
+
+		u := NewUpgrader(Options{Subprotocols: tc.supported})
+		assert.Equal(t, tc.expect, u.negotiate(r))
+	}
+}
+
+func TestUpgrader_Strict(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://127.0.0.1/", nil)
+	r.Header.Set("Connection", "upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Key", "D1icfJz+khA9kj5/14dRXQ==")
+	r.Header.Set("Sec-WebSocket-Protocol", "wamp")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+
+	w := httptest.NewRecorder()
+	_, ok := NewUpgrader(Options{Strict: true}).TryUpgrade(w, r)
+	assert.False(t, ok)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "subprotocols")
+}
+
+func TestWrite_Compression(t *testing.T) {
+	socket := &conn{write: (*writer)(new(bytes.Buffer))}
+	c := &websocketTransport{
+		socket:    socket,
+		closing:   make(chan bool),
+		threshold: 8,
+	}
+
+	// Only the messages reaching the threshold are compressed
+	_, err := c.Write([]byte("hi"))
+	assert.NoError(t, err)
+	_, err = c.Write([]byte("hello world"))
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, true}, socket.compressed)
+}
+
 func TestRead_EOF(t *testing.T) {
 	c := newConn(new(conn))
 
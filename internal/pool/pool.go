@@ -0,0 +1,94 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pool
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// registry holds every pool created, for reporting their statistics.
+var registry struct {
+	sync.Mutex
+	pools []*Pool
+}
+
+// Pool represents a pool of reusable values, which counts how often the values are reused
+// rather than allocated, since the values which are not reused put pressure on the GC.
+type Pool struct {
+	pool   sync.Pool
+	name   string // The name of the pool, reported with its statistics.
+	gets   int64  // The number of values taken from the pool.
+	allocs int64  // The number of values allocated because the pool was empty.
+}
+
+// New creates a new pool with the function allocating its values, and registers it so its
+// statistics are reported.
+func New(name string, alloc func() interface{}) *Pool {
+	p := &Pool{name: name}
+	p.pool.New = func() interface{} {
+		atomic.AddInt64(&p.allocs, 1)
+		return alloc()
+	}
+
+	registry.Lock()
+	registry.pools = append(registry.pools, p)
+	registry.Unlock()
+	return p
+}
+
+// Get takes a value from the pool, or allocates a new one if the pool is empty.
+func (p *Pool) Get() interface{} {
+	atomic.AddInt64(&p.gets, 1)
+	return p.pool.Get()
+}
+
+// Put returns a value to the pool, so it can be reused.
+func (p *Pool) Put(v interface{}) {
+	p.pool.Put(v)
+}
+
+// Stats represents the statistics of a pool.
+type Stats struct {
+	Name   string // The name of the pool.
+	Gets   int64  // The number of values taken from the pool.
+	Allocs int64  // The number of values allocated because the pool was empty.
+}
+
+// Reused returns the number of values which were reused rather than allocated.
+func (s Stats) Reused() int64 {
+	return s.Gets - s.Allocs
+}
+
+// Snapshot returns the statistics of every pool, ordered by name.
+func Snapshot() []Stats {
+	registry.Lock()
+	defer registry.Unlock()
+
+	stats := make([]Stats, 0, len(registry.pools))
+	for _, p := range registry.pools {
+		stats = append(stats, Stats{
+			Name:   p.name,
+			Gets:   atomic.LoadInt64(&p.gets),
+			Allocs: atomic.LoadInt64(&p.allocs),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
@@ -0,0 +1,63 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// statsOf returns the statistics of a pool, by name.
+func statsOf(name string) (Stats, bool) {
+	for _, s := range Snapshot() {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Stats{}, false
+}
+
+func TestPool(t *testing.T) {
+	p := New("test.pool", func() interface{} {
+		return make([]byte, 8)
+	})
+
+	v := p.Get().([]byte)
+	assert.Len(t, v, 8)
+
+	stats, ok := statsOf("test.pool")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), stats.Gets)
+	assert.Equal(t, int64(1), stats.Allocs)
+	assert.Equal(t, int64(0), stats.Reused())
+
+	// The pool may drop its values at any time, so the reuse is not guaranteed
+	p.Put(v)
+	p.Get()
+	stats, _ = statsOf("test.pool")
+	assert.Equal(t, int64(2), stats.Gets)
+	assert.True(t, stats.Allocs >= 1 && stats.Allocs <= 2)
+}
+
+func TestSnapshot_Sorted(t *testing.T) {
+	New("test.b", func() interface{} { return nil })
+	New("test.a", func() interface{} { return nil })
+
+	stats := Snapshot()
+	for i := 1; i < len(stats); i++ {
+		assert.True(t, stats[i-1].Name <= stats[i].Name)
+	}
+}
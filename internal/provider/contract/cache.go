@@ -0,0 +1,121 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package contract
+
+import (
+	"sync"
+	"time"
+)
+
+// CacheStats represents the statistics of the cache of a contract provider, since it
+// was created.
+type CacheStats struct {
+	Hits   int64 // The number of contracts served from the cache.
+	Misses int64 // The number of contracts not found in the cache.
+	Stale  int64 // The number of contracts served from the cache while being outdated.
+	Errors int64 // The number of failed requests to the contract service.
+	Open   bool  // Whether the circuit to the contract service is open.
+}
+
+// Cached represents a contract provider which caches the contracts of a remote service.
+type Cached interface {
+	CacheStats() CacheStats
+}
+
+// entry represents a contract kept in the cache.
+type entry struct {
+	contract *contract // The cached contract.
+	fetched  time.Time // The time the contract was fetched at.
+}
+
+// newEntry creates a new cache entry for a contract which was just fetched.
+func newEntry(c *contract) *entry {
+	return &entry{
+		contract: c,
+		fetched:  time.Now(),
+	}
+}
+
+// isStale returns whether the contract is older than the time-to-live.
+func (e *entry) isStale(ttl time.Duration) bool {
+	return time.Since(e.fetched) >= ttl
+}
+
+// ------------------------------------------------------------------------------------
+
+// breaker represents a circuit breaker which stops calling a failing service for a while,
+// once a number of consecutive requests failed. Once the cooldown elapsed, a single request
+// probes the service and either closes the circuit or opens it again.
+type breaker struct {
+	sync.Mutex
+	threshold int           // The number of consecutive failures opening the circuit.
+	cooldown  time.Duration // The time the circuit stays open for.
+	failures  int           // The number of consecutive failures.
+	openUntil time.Time     // The time until which the circuit is open.
+	probing   bool          // Whether a request is probing the service.
+}
+
+// newBreaker creates a new circuit breaker.
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow returns whether a request may be sent to the service.
+func (b *breaker) Allow() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	switch {
+	case b.failures < b.threshold:
+		return true
+	case b.probing || time.Now().Before(b.openUntil):
+		return false
+	default:
+		b.probing = true
+		return true
+	}
+}
+
+// Success records a successful request, which closes the circuit.
+func (b *breaker) Success() {
+	b.Lock()
+	defer b.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records a failed request and returns whether it opened the circuit.
+func (b *breaker) Failure() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+		return true
+	}
+	return false
+}
+
+// IsOpen returns whether the circuit is open.
+func (b *breaker) IsOpen() bool {
+	b.Lock()
+	defer b.Unlock()
+	return b.failures >= b.threshold
+}
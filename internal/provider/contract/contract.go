@@ -16,9 +16,11 @@ package contract
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/emitter-io/config"
@@ -41,14 +43,80 @@ const (
 type Contract interface {
 	Validate(key security.Key) bool // Validate checks the security key with the contract.
 	Stats() usage.Meter             // Gets the usage statistics.
+	Weight() int                    // Gets the scheduling weight of the contract.
+	Retention() []Retention         // Gets the retention rules of the contract.
+	Placement() Placement           // Gets the regions of the contract.
+	Limits() Limits                 // Gets the limits of each connection of the contract.
+}
+
+// Limits represents the limits of each connection of a contract, which keep a single
+// client from using the resources shared with the others, along with the liveness settings
+// overriding the ones of the listeners and the daily quota of the whole contract. A zero
+// limit means that it is unbounded.
+type Limits struct {
+	MaxSubscriptions int   `json:"maxSubscriptions,omitempty"` // The maximum number of subscriptions.
+	MaxInflight      int   `json:"maxInflight,omitempty"`      // The maximum number of publishes waiting to be delivered.
+	MaxPacketSize    int   `json:"maxPacketSize,omitempty"`    // The maximum size of a packet, in bytes.
+	MaxMessageSize   int   `json:"maxMessageSize,omitempty"`   // The maximum size of the payload of a message, in bytes.
+	MinKeepAlive     int   `json:"minKeepAlive,omitempty"`     // The minimum keepalive enforced, in seconds.
+	MaxKeepAlive     int   `json:"maxKeepAlive,omitempty"`     // The maximum keepalive enforced, in seconds.
+	IdleTimeout      int   `json:"idleTimeout,omitempty"`      // The timeout of the connections without keepalive, in seconds.
+	SessionExpiry    int   `json:"sessionExpiry,omitempty"`    // The expiry of the offline sessions, in seconds.
+	MaxDailyMessages int64 `json:"maxDailyMessages,omitempty"` // The maximum number of messages published by the contract per day, on each node.
+}
+
+// Placement represents the regions of a contract in a multi-region deployment. The keys of
+// the contract are only generated in its home regions, while they are validated everywhere,
+// and its messages are only stored in the regions it resides in.
+type Placement struct {
+	Home      []string `json:"home,omitempty"`      // The home regions, anywhere if empty.
+	Residency []string `json:"residency,omitempty"` // The regions storing the messages, anywhere if empty.
+}
+
+// IsHome checks whether the region is one of the home regions of the contract.
+func (p Placement) IsHome(region string) bool {
+	return region == "" || len(p.Home) == 0 || contains(p.Home, region)
+}
+
+// Resides checks whether the messages of the contract can be stored in the region.
+func (p Placement) Resides(region string) bool {
+	return region == "" || len(p.Residency) == 0 || contains(p.Residency, region)
+}
+
+// contains checks whether the region is in the list.
+func contains(regions []string, region string) bool {
+	for _, v := range regions {
+		if v == region {
+			return true
+		}
+	}
+	return false
+}
+
+// Retention represents a retention rule of a contract, limiting the history kept for the
+// channels matching a pattern (e.g: "logs/+/"). A zero limit means that it is unbounded.
+type Retention struct {
+	Channel  string `json:"channel"`            // The pattern of the channels.
+	MaxAge   int64  `json:"maxAge,omitempty"`   // The maximum age of the messages, in seconds.
+	MaxCount int    `json:"maxCount,omitempty"` // The maximum number of messages.
+	MaxBytes int64  `json:"maxBytes,omitempty"` // The maximum size of the payloads, in bytes.
+}
+
+// Lister represents a contract provider which can enumerate the contracts it knows of.
+type Lister interface {
+	Range(f func(id uint32, c Contract) bool)
 }
 
 // contract represents a contract (user account).
 type contract struct {
-	ID        uint32      `json:"id"`     // Gets or sets the contract id.
-	MasterID  uint16      `json:"master"` // Gets or sets the master id.
-	Signature uint32      `json:"sign"`   // Gets or sets the signature of the contract.
-	State     uint8       `json:"state"`  // Gets or sets the state of the contract.
+	ID        uint32      `json:"id"`                  // Gets or sets the contract id.
+	MasterID  uint16      `json:"master"`              // Gets or sets the master id.
+	Signature uint32      `json:"sign"`                // Gets or sets the signature of the contract.
+	State     uint8       `json:"state"`               // Gets or sets the state of the contract.
+	Tier      uint8       `json:"tier"`                // Gets or sets the tier of the contract.
+	Rules     []Retention `json:"retention,omitempty"` // Gets or sets the retention rules.
+	Regions   Placement   `json:"placement"`           // Gets or sets the regions.
+	Caps      Limits      `json:"limits"`              // Gets or sets the limits of each connection.
 	stats     usage.Meter // Gets the usage stats.
 }
 
@@ -65,6 +133,27 @@ func (c *contract) Stats() usage.Meter {
 	return c.stats
 }
 
+// Weight gets the scheduling weight of the contract, the higher tier contracts get to
+// process more work per scheduling round.
+func (c *contract) Weight() int {
+	return int(c.Tier) + 1
+}
+
+// Retention gets the retention rules of the contract.
+func (c *contract) Retention() []Retention {
+	return c.Rules
+}
+
+// Placement gets the regions of the contract.
+func (c *contract) Placement() Placement {
+	return c.Regions
+}
+
+// Limits gets the limits of each connection of the contract.
+func (c *contract) Limits() Limits {
+	return c.Caps
+}
+
 // Provider represents an interface for a contract provider.
 type Provider interface {
 	config.Provider
@@ -135,8 +224,28 @@ func (p *SingleContractProvider) Name() string {
 	return "single"
 }
 
-// Configure configures the provider.
+// Configure configures the provider, loading the retention rules, the placement and the
+// limits of the connections of the owner contract.
 func (p *SingleContractProvider) Configure(config map[string]interface{}) error {
+	if err := decode(config, "retention", &p.owner.Rules); err != nil {
+		return err
+	}
+	if err := decode(config, "placement", &p.owner.Regions); err != nil {
+		return err
+	}
+	return decode(config, "limits", &p.owner.Caps)
+}
+
+// decode decodes a section of the configuration, if present.
+func decode(config map[string]interface{}, name string, out interface{}) error {
+	if v, ok := config[name]; ok {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		return json.Unmarshal(b, out)
+	}
 	return nil
 }
 
@@ -154,20 +263,38 @@ func (p *SingleContractProvider) Get(id uint32) (Contract, bool) {
 	return p.owner, true
 }
 
+// Range calls f sequentially for the owner contract.
+func (p *SingleContractProvider) Range(f func(id uint32, c Contract) bool) {
+	if p.owner != nil {
+		f(p.owner.ID, p.owner)
+	}
+}
+
 // ------------------------------------------------------------------------------------
 
 // Assert interface compliance
 var _ Provider = new(HTTPContractProvider)
+var _ Cached = new(HTTPContractProvider)
 
-// HTTPContractProvider provides contracts over http.
+// HTTPContractProvider provides contracts over http. The contracts are cached and refreshed
+// in the background once they are older than their time-to-live, while the outdated ones
+// keep being served if the contract service fails. A circuit breaker stops calling the
+// service for a while after consecutive failures.
 type HTTPContractProvider struct {
-	url    string             // The url to hit for the provider.
-	owner  *contract          // The owner contract.
-	cache  *sync.Map          // The cache for the contracts.
-	usage  usage.Metering     // The usage stats container.
-	http   http.Client        // The http client to use.
-	head   []http.HeaderValue // The http headers to add with each request.
-	cancel context.CancelFunc // The cancellation function.
+	url     string             // The url to hit for the provider.
+	owner   *contract          // The owner contract.
+	cache   *sync.Map          // The cache for the contracts.
+	pending sync.Map           // The contracts being refreshed in the background.
+	usage   usage.Metering     // The usage stats container.
+	http    http.Client        // The http client to use.
+	head    []http.HeaderValue // The http headers to add with each request.
+	ttl     time.Duration      // The time after which a cached contract is refreshed.
+	circuit *breaker           // The circuit breaker of the contract service.
+	hits    int64              // The number of contracts served from the cache.
+	misses  int64              // The number of contracts not found in the cache.
+	stale   int64              // The number of outdated contracts served from the cache.
+	failed  int64              // The number of failed requests to the contract service.
+	cancel  context.CancelFunc // The cancellation function.
 }
 
 // NewHTTPContractProvider creates a new single contract provider.
@@ -179,6 +306,8 @@ func NewHTTPContractProvider(license license.License, metering usage.Metering) *
 	p.owner.Signature = license.Signature()
 	p.cache = new(sync.Map)
 	p.usage = metering
+	p.ttl = 10 * time.Minute
+	p.circuit = newBreaker(5, 30*time.Second)
 	return &p
 }
 
@@ -193,13 +322,14 @@ func (p *HTTPContractProvider) Configure(config map[string]interface{}) (err err
 		return errors.New("Configuration was not provided for HTTP contract provider")
 	}
 
-	// Get the interval from the provider configuration
-	interval := 10 * time.Minute
-	if v, ok := config["interval"]; ok {
-		if i, ok := v.(float64); ok {
-			interval = time.Duration(i) * time.Millisecond
-		}
-	}
+	// Get the interval from the provider configuration, the contracts being outdated after
+	// the same time unless specified otherwise
+	interval := time.Duration(numberOf(config, "interval", 600000)) * time.Millisecond
+	p.ttl = time.Duration(numberOf(config, "ttl", float64(interval/time.Millisecond))) * time.Millisecond
+	p.circuit = newBreaker(
+		int(numberOf(config, "failures", 5)),
+		time.Duration(numberOf(config, "cooldown", 30000))*time.Millisecond,
+	)
 
 	// Get the authorization header to add to the request
 	headers := []http.HeaderValue{http.NewHeader("Accept", "application/json")}
@@ -225,26 +355,61 @@ func (p *HTTPContractProvider) Configure(config map[string]interface{}) (err err
 	return errors.New("The 'url' parameter was not provider in the configuration for HTTP contract provider")
 }
 
+// numberOf reads a positive number from the configuration, or returns the default value.
+func numberOf(config map[string]interface{}, name string, defaultValue float64) float64 {
+	if v, ok := config[name].(float64); ok && v > 0 {
+		return v
+	}
+	return defaultValue
+}
+
 // Create creates a contract, the HTTPContractProvider way.
 func (p *HTTPContractProvider) Create() (Contract, error) {
 	return nil, errors.New("HTTP contract provider can not create contracts")
 }
 
-// Get returns a ContractData fetched by its id.
+// Get returns a ContractData fetched by its id. A cached contract is returned right away,
+// and refreshed in the background if it is outdated.
 func (p *HTTPContractProvider) Get(id uint32) (Contract, bool) {
-	if c, ok := p.cache.Load(id); ok {
-		return c.(Contract), true
+	if v, ok := p.cache.Load(id); ok {
+		e := v.(*entry)
+		atomic.AddInt64(&p.hits, 1)
+		if e.isStale(p.ttl) {
+			atomic.AddInt64(&p.stale, 1)
+			p.refreshAsync(id)
+		}
+		return e.contract, true
 	}
 
-	// Load or store again, since we might have concurrently update it meanwhile
+	// Fetch the missing contract from the contract service
+	atomic.AddInt64(&p.misses, 1)
 	if contract, ok := p.fetchContract(id); ok {
-		c, _ := p.cache.LoadOrStore(id, contract)
-		return c.(Contract), true
+		p.cache.Store(id, newEntry(contract))
+		return contract, true
 	}
 
 	return nil, false
 }
 
+// Range calls f sequentially for each of the cached contracts. If f returns false, range
+// stops the iteration.
+func (p *HTTPContractProvider) Range(f func(id uint32, c Contract) bool) {
+	p.cache.Range(func(k, v interface{}) bool {
+		return f(k.(uint32), v.(*entry).contract)
+	})
+}
+
+// CacheStats returns the statistics of the cache of the contracts.
+func (p *HTTPContractProvider) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadInt64(&p.hits),
+		Misses: atomic.LoadInt64(&p.misses),
+		Stale:  atomic.LoadInt64(&p.stale),
+		Errors: atomic.LoadInt64(&p.failed),
+		Open:   p.circuit.IsOpen(),
+	}
+}
+
 // Close closes the provider.
 func (p *HTTPContractProvider) Close() error {
 	if p.cancel != nil {
@@ -254,15 +419,25 @@ func (p *HTTPContractProvider) Close() error {
 	return nil
 }
 
-// Fetches a single contract from the underlying contract provider.
+// Fetches a single contract from the underlying contract provider, unless the circuit to
+// the contract service is open.
 func (p *HTTPContractProvider) fetchContract(id uint32) (*contract, bool) {
+	if !p.circuit.Allow() {
+		return nil, false
+	}
+
 	c := new(contract)
 	_, err := p.http.Get(fmt.Sprintf("%s%d", p.url, id), c, p.head...)
 	if err != nil {
+		atomic.AddInt64(&p.failed, 1)
 		logging.LogError("contract", "fetching http contract", err)
+		if p.circuit.Failure() {
+			logging.LogAction("contract", fmt.Sprintf("contract service unavailable, serving the cached contracts for %v", p.circuit.cooldown))
+		}
 		return nil, false
 	}
 
+	p.circuit.Success()
 	if c.ID == 0 {
 		return nil, false
 	}
@@ -271,12 +446,28 @@ func (p *HTTPContractProvider) fetchContract(id uint32) (*contract, bool) {
 	return c, true
 }
 
-// Refresh fetches all the contracts from the underlying contract provider.
+// refreshAsync refreshes an outdated contract in the background, unless it is already
+// being refreshed. The outdated contract is kept if it can not be fetched.
+func (p *HTTPContractProvider) refreshAsync(id uint32) {
+	if _, loaded := p.pending.LoadOrStore(id, true); loaded {
+		return
+	}
+
+	go func() {
+		defer p.pending.Delete(id)
+		if contract, ok := p.fetchContract(id); ok {
+			p.cache.Store(id, newEntry(contract))
+		}
+	}()
+}
+
+// Refresh fetches all the contracts from the underlying contract provider, keeping the
+// cached ones which can not be fetched.
 func (p *HTTPContractProvider) refresh() {
 	p.cache.Range(func(k, v interface{}) bool {
 		if id, ok := k.(uint32); ok {
 			if contract, ok := p.fetchContract(id); ok {
-				p.cache.Store(id, contract)
+				p.cache.Store(id, newEntry(contract))
 			}
 		}
 		return true
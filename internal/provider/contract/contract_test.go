@@ -16,7 +16,9 @@ package contract
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/emitter-io/emitter/internal/network/http"
 	"github.com/emitter-io/emitter/internal/provider/usage"
@@ -61,6 +63,36 @@ func TestSingleContractProvider_Create(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestSingleContractProvider_Configure(t *testing.T) {
+	p, license := testNewSingleContractProvider()
+	assert.NoError(t, p.Configure(map[string]interface{}{
+		"retention": []interface{}{
+			map[string]interface{}{"channel": "logs/", "maxAge": float64(3600), "maxCount": float64(100)},
+		},
+	}))
+
+	assert.Equal(t, []Retention{{Channel: "logs/", MaxAge: 3600, MaxCount: 100}}, p.owner.Retention())
+	assert.Error(t, p.Configure(map[string]interface{}{"retention": "logs/"}))
+
+	assert.NoError(t, p.Configure(map[string]interface{}{
+		"placement": map[string]interface{}{"home": []interface{}{"eu"}, "residency": []interface{}{"eu", "ch"}},
+	}))
+	assert.Equal(t, Placement{Home: []string{"eu"}, Residency: []string{"eu", "ch"}}, p.owner.Placement())
+
+	assert.NoError(t, p.Configure(map[string]interface{}{
+		"limits": map[string]interface{}{"maxSubscriptions": float64(10), "maxInflight": float64(5), "maxPacketSize": float64(1024)},
+	}))
+	assert.Equal(t, Limits{MaxSubscriptions: 10, MaxInflight: 5, MaxPacketSize: 1024}, p.owner.Limits())
+	assert.Error(t, p.Configure(map[string]interface{}{"limits": "10"}))
+
+	var ids []uint32
+	p.Range(func(id uint32, c Contract) bool {
+		ids = append(ids, id)
+		return true
+	})
+	assert.Equal(t, []uint32{license.Contract()}, ids)
+}
+
 func TestSingleContractProvider_Get(t *testing.T) {
 	p, license := testNewSingleContractProvider()
 	contractByID, ok1 := p.Get(license.Contract())
@@ -163,13 +195,108 @@ func TestHTTPContractPovider_refresh(t *testing.T) {
 	p, _ := testNewHTTPContractProvider()
 	p.http = h
 
-	p.cache.Store(uint32(1), nil)
+	p.cache.Store(uint32(1), newEntry(nil))
 	p.refresh()
 
 	c, ok := p.cache.Load(uint32(1))
 	assert.True(t, ok)
-	assert.NotNil(t, c)
-	assert.Equal(t, uint8(2), c.(*contract).State)
+	assert.NotNil(t, c.(*entry).contract)
+	assert.Equal(t, uint8(2), c.(*entry).contract.State)
+}
+
+func TestHTTPContractPovider_Stale(t *testing.T) {
+	h := http.NewMockClient()
+	h.On("Get", "1", mock.Anything, mock.Anything).Return([]byte{}, errors.New("unavailable"))
+
+	p, _ := testNewHTTPContractProvider()
+	p.http = h
+	p.circuit = newBreaker(2, time.Hour)
+
+	// An outdated contract is still served while the service fails
+	cached := &contract{ID: 1, State: ContractStateAllowed}
+	p.cache.Store(uint32(1), &entry{contract: cached, fetched: time.Now().Add(-time.Hour)})
+	for i := 0; i < 3; i++ {
+		c, ok := p.Get(1)
+		assert.True(t, ok)
+		assert.Equal(t, cached, c)
+		assert.Eventually(t, func() bool {
+			_, pending := p.pending.Load(uint32(1))
+			return !pending
+		}, time.Second, time.Millisecond)
+	}
+
+	// The missing contracts are refused without calling the service once the circuit is open
+	_, ok := p.Get(2)
+	assert.False(t, ok)
+	h.AssertNumberOfCalls(t, "Get", 2)
+	assert.Equal(t, CacheStats{
+		Hits:   3,
+		Misses: 1,
+		Stale:  3,
+		Errors: 2,
+		Open:   true,
+	}, p.CacheStats())
+}
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(2, 10*time.Millisecond)
+	assert.True(t, b.Allow())
+	assert.False(t, b.Failure())
+	assert.True(t, b.Allow())
+	assert.True(t, b.Failure())
+	assert.True(t, b.IsOpen())
+	assert.False(t, b.Allow())
+
+	// Once the cooldown elapsed, a single request probes the service
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+	b.Success()
+	assert.False(t, b.IsOpen())
+	assert.True(t, b.Allow())
+}
+
+func TestPlacement(t *testing.T) {
+	tests := []struct {
+		placement Placement
+		region    string
+		isHome    bool
+		resides   bool
+	}{
+		{placement: Placement{}, region: "eu", isHome: true, resides: true},
+		{placement: Placement{Home: []string{"eu"}}, region: "", isHome: true, resides: true},
+		{placement: Placement{Home: []string{"eu"}}, region: "us", isHome: false, resides: true},
+		{placement: Placement{Home: []string{"eu", "us"}}, region: "us", isHome: true, resides: true},
+		{placement: Placement{Residency: []string{"eu"}}, region: "us", isHome: true, resides: false},
+		{placement: Placement{Residency: []string{"eu"}}, region: "eu", isHome: true, resides: true},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.isHome, tc.placement.IsHome(tc.region))
+		assert.Equal(t, tc.resides, tc.placement.Resides(tc.region))
+	}
+}
+
+func TestHTTPContractPovider_Range(t *testing.T) {
+	h := http.NewMockClient()
+	h.On("Get", "1", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		output := args.Get(1).(interface{})
+		json.Unmarshal([]byte(`{"id": 1, "state": 1, "retention": [{"channel": "logs/", "maxBytes": 1024}]}`), output)
+	}).Return([]byte{}, nil)
+
+	p, _ := testNewHTTPContractProvider()
+	p.http = h
+
+	_, ok := p.Get(1)
+	assert.True(t, ok)
+
+	var rules []Retention
+	p.Range(func(id uint32, c Contract) bool {
+		assert.Equal(t, uint32(1), id)
+		rules = append(rules, c.Retention()...)
+		return true
+	})
+	assert.Equal(t, []Retention{{Channel: "logs/", MaxBytes: 1024}}, rules)
 }
 
 func TestNoopContractPovider(t *testing.T) {
@@ -188,3 +315,8 @@ func TestNoopContractPovider(t *testing.T) {
 	n := p.Name()
 	assert.Equal(t, "noop", n)
 }
+
+func TestContract_Weight(t *testing.T) {
+	assert.Equal(t, 1, new(contract).Weight())
+	assert.Equal(t, 3, (&contract{Tier: 2}).Weight())
+}
@@ -0,0 +1,253 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package contract
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/provider/usage"
+	"github.com/emitter-io/emitter/internal/security/license"
+	"gopkg.in/yaml.v3"
+)
+
+// Assert interface compliance
+var _ Provider = new(FileContractProvider)
+var _ Lister = new(FileContractProvider)
+
+// FileContractProvider provides the contracts listed in a local file, either a JSON or a
+// YAML document or a SQLite database, for the deployments without a contract service. The
+// file is reloaded whenever it changes, keeping the previous contracts if it is invalid.
+type FileContractProvider struct {
+	sync.RWMutex
+	path      string               // The path of the file.
+	owner     *contract            // The owner contract.
+	usage     usage.Metering       // The usage stats container.
+	contracts map[uint32]*contract // The contracts, by their identifier.
+	modified  time.Time            // The modification time of the file, once loaded.
+	cancel    context.CancelFunc   // The cancellation function.
+}
+
+// contractFile represents the document listing the contracts.
+type contractFile struct {
+	Contracts []*contract `json:"contracts"` // The contracts provided.
+}
+
+// NewFileContractProvider creates a new file contract provider.
+func NewFileContractProvider(license license.License, metering usage.Metering) *FileContractProvider {
+	p := new(FileContractProvider)
+	p.owner = new(contract)
+	p.owner.MasterID = 1
+	p.owner.ID = license.Contract()
+	p.owner.Signature = license.Signature()
+	p.owner.State = ContractStateAllowed
+	p.usage = metering
+	p.contracts = make(map[uint32]*contract)
+	return p
+}
+
+// Name returns the name of the provider.
+func (p *FileContractProvider) Name() string {
+	return "file"
+}
+
+// Configure configures the provider, loading the contracts from the file at its 'path' and
+// checking it for changes every 'interval' milliseconds.
+func (p *FileContractProvider) Configure(config map[string]interface{}) error {
+	if path, ok := config["path"].(string); ok && path != "" {
+		p.path = path
+	} else {
+		return errors.New("The 'path' parameter was not provided in the configuration for file contract provider")
+	}
+
+	// The contracts must be valid at startup
+	modified := modTimeOf(p.path)
+	if err := p.load(); err != nil {
+		return err
+	}
+
+	p.modified = modified
+	interval := time.Duration(numberOf(config, "interval", 5000)) * time.Millisecond
+	p.cancel = async.Repeat(context.Background(), interval, p.reload)
+	return nil
+}
+
+// Create creates a contract, the FileContractProvider way.
+func (p *FileContractProvider) Create() (Contract, error) {
+	return nil, errors.New("File contract provider can not create contracts")
+}
+
+// Get returns a ContractData fetched by its id.
+func (p *FileContractProvider) Get(id uint32) (Contract, bool) {
+	p.RLock()
+	defer p.RUnlock()
+	if c, ok := p.contracts[id]; ok {
+		return c, true
+	}
+
+	return nil, false
+}
+
+// Range calls f sequentially for each of the contracts. If f returns false, range stops
+// the iteration.
+func (p *FileContractProvider) Range(f func(id uint32, c Contract) bool) {
+	p.RLock()
+	contracts := make([]*contract, 0, len(p.contracts))
+	for _, c := range p.contracts {
+		contracts = append(contracts, c)
+	}
+	p.RUnlock()
+
+	for _, c := range contracts {
+		if !f(c.ID, c) {
+			return
+		}
+	}
+}
+
+// Close closes the provider.
+func (p *FileContractProvider) Close() error {
+	if p.cancel != nil {
+		p.cancel()
+	}
+
+	return nil
+}
+
+// reload loads the contracts again if the file was modified since it was last loaded.
+func (p *FileContractProvider) reload() {
+	modified := modTimeOf(p.path)
+	if modified.Equal(p.modified) {
+		return
+	}
+
+	p.modified = modified
+	if err := p.load(); err != nil {
+		logging.LogError("contract", "reloading the contracts", err)
+		return
+	}
+
+	logging.LogTarget("contract", "reloaded the contracts", p.path)
+}
+
+// load reads the contracts from the file and replaces the current ones. The owner contract
+// of the license is provided unless the file lists it.
+func (p *FileContractProvider) load() error {
+	loaded, err := readContracts(p.path)
+	if err != nil {
+		return err
+	}
+
+	contracts := map[uint32]*contract{
+		p.owner.ID: p.owner,
+	}
+
+	for _, c := range loaded {
+		if c.ID == 0 {
+			return fmt.Errorf("contract: a contract of %s has no identifier", p.path)
+		}
+
+		// The signature and the master key default to the ones of the license
+		if c.MasterID == 0 {
+			c.MasterID = p.owner.MasterID
+		}
+		if c.Signature == 0 {
+			c.Signature = p.owner.Signature
+		}
+		if c.State == ContractStateUnknown {
+			c.State = ContractStateAllowed
+		}
+
+		c.stats = p.usage.Get(c.ID).(usage.Meter)
+		contracts[c.ID] = c
+	}
+
+	if p.owner.stats == nil {
+		p.owner.stats = p.usage.Get(p.owner.ID).(usage.Meter)
+	}
+
+	p.Lock()
+	p.contracts = contracts
+	p.Unlock()
+	return nil
+}
+
+// readContracts reads the contracts of a file, depending on its extension.
+func readContracts(path string) ([]*contract, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return readSQLite(path)
+	case ".yaml", ".yml":
+		return readDocument(path, yamlToJSON)
+	case ".json":
+		return readDocument(path, nil)
+	default:
+		return nil, fmt.Errorf("contract: the format of %s is not supported", path)
+	}
+}
+
+// readDocument reads the contracts of a JSON document, converted from another format if
+// needed.
+func readDocument(path string, convert func([]byte) ([]byte, error)) ([]*contract, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if convert != nil {
+		if b, err = convert(b); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc contractFile
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc.Contracts, nil
+}
+
+// yamlToJSON converts a YAML document to JSON, so that the contracts are decoded with the
+// same names whatever the format.
+func yamlToJSON(b []byte) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc)
+}
+
+// modTimeOf returns the latest modification time of a file, along with the write-ahead
+// log of a SQLite database.
+func modTimeOf(path string) (latest time.Time) {
+	for _, name := range []string{path, path + "-wal"} {
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return
+}
@@ -0,0 +1,126 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package contract
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/provider/usage"
+	"github.com/emitter-io/emitter/internal/security/license"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNewFileContractProvider(t *testing.T, name, content string) (*FileContractProvider, string) {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+	l, _ := license.Parse("zT83oDV0DWY5_JysbSTPTDr8KB0AAAAAAAAAAAAAAAI")
+	p := NewFileContractProvider(l, new(usage.NoopStorage))
+	return p, path
+}
+
+func TestFileContractProvider_JSON(t *testing.T) {
+	p, path := testNewFileContractProvider(t, "contracts.json", `{"contracts": [
+		{"id": 10, "tier": 2, "limits": {"maxMessageSize": 1024, "maxDailyMessages": 1000}},
+		{"id": 11, "state": 2}
+	]}`)
+
+	assert.Equal(t, "file", p.Name())
+	assert.NoError(t, p.Configure(map[string]interface{}{"path": path}))
+	defer p.Close()
+
+	c, ok := p.Get(10)
+	assert.True(t, ok)
+	assert.Equal(t, 3, c.Weight())
+	assert.Equal(t, Limits{MaxMessageSize: 1024, MaxDailyMessages: 1000}, c.Limits())
+	assert.Equal(t, ContractStateAllowed, c.(*contract).State)
+	assert.Equal(t, p.owner.Signature, c.(*contract).Signature)
+	assert.NotNil(t, c.Stats())
+
+	// The refused contracts are kept as such and the owner is provided as well
+	c, ok = p.Get(11)
+	assert.True(t, ok)
+	assert.Equal(t, ContractStateRefused, c.(*contract).State)
+	_, ok = p.Get(p.owner.ID)
+	assert.True(t, ok)
+	_, ok = p.Get(12)
+	assert.False(t, ok)
+
+	count := 0
+	p.Range(func(id uint32, c Contract) bool {
+		count++
+		return true
+	})
+	assert.Equal(t, 3, count)
+}
+
+func TestFileContractProvider_YAML(t *testing.T) {
+	p, path := testNewFileContractProvider(t, "contracts.yaml", `
+contracts:
+  - id: 10
+    retention:
+      - channel: logs/
+        maxAge: 3600
+    placement:
+      home: [eu]
+`)
+
+	assert.NoError(t, p.Configure(map[string]interface{}{"path": path}))
+	defer p.Close()
+
+	c, ok := p.Get(10)
+	assert.True(t, ok)
+	assert.Equal(t, []Retention{{Channel: "logs/", MaxAge: 3600}}, c.Retention())
+	assert.Equal(t, Placement{Home: []string{"eu"}}, c.Placement())
+}
+
+func TestFileContractProvider_Reload(t *testing.T) {
+	p, path := testNewFileContractProvider(t, "contracts.json", `{"contracts": [{"id": 10}]}`)
+	assert.NoError(t, p.Configure(map[string]interface{}{"path": path, "interval": 3600000.0}))
+	defer p.Close()
+
+	// An invalid file keeps the previous contracts
+	write := func(content string, modified time.Time) {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		assert.NoError(t, os.Chtimes(path, modified, modified))
+		p.reload()
+	}
+
+	write(`{"contracts": [{"id": 20}`, time.Now().Add(time.Minute))
+	_, ok := p.Get(10)
+	assert.True(t, ok)
+
+	write(`{"contracts": [{"id": 20}]}`, time.Now().Add(2*time.Minute))
+	_, ok = p.Get(10)
+	assert.False(t, ok)
+	_, ok = p.Get(20)
+	assert.True(t, ok)
+}
+
+func TestFileContractProvider_Invalid(t *testing.T) {
+	p, path := testNewFileContractProvider(t, "contracts.txt", ``)
+	assert.Error(t, p.Configure(map[string]interface{}{}))
+	assert.Error(t, p.Configure(map[string]interface{}{"path": path}))
+
+	p, path = testNewFileContractProvider(t, "contracts.json", `{"contracts": [{"tier": 1}]}`)
+	assert.Error(t, p.Configure(map[string]interface{}{"path": path}))
+
+	_, err := p.Create()
+	assert.Error(t, err)
+}
@@ -38,6 +38,30 @@ func (mock *Contract) Stats() usage.Meter {
 	return mockArgs.Get(0).(usage.Meter)
 }
 
+// Weight returns the scheduling weight.
+func (mock *Contract) Weight() int {
+	mockArgs := mock.Called()
+	return mockArgs.Int(0)
+}
+
+// Retention returns the retention rules.
+func (mock *Contract) Retention() []contract.Retention {
+	mockArgs := mock.Called()
+	return mockArgs.Get(0).([]contract.Retention)
+}
+
+// Placement returns the regions.
+func (mock *Contract) Placement() contract.Placement {
+	mockArgs := mock.Called()
+	return mockArgs.Get(0).(contract.Placement)
+}
+
+// Limits returns the limits of each connection.
+func (mock *Contract) Limits() contract.Limits {
+	mockArgs := mock.Called()
+	return mockArgs.Get(0).(contract.Limits)
+}
+
 // ContractProvider is the mock provider for contracts
 type ContractProvider struct {
 	mock.Mock
@@ -29,6 +29,7 @@ func TestMock(t *testing.T) {
 	c := new(Contract)
 	c.On("Validate", mock.Anything).Return(true)
 	c.On("Stats").Return(usage.NewMeter(id))
+	c.On("Weight").Return(2)
 
 	m := NewContractProvider()
 	cfg := make(map[string]interface{})
@@ -44,6 +45,7 @@ func TestMock(t *testing.T) {
 	assert.Equal(t, c, c1)
 	assert.True(t, c1.Validate(nil), true)
 	assert.Equal(t, usage.NewMeter(id), c1.Stats())
+	assert.Equal(t, 2, c1.Weight())
 
 	m.On("Create").Return(c, nil)
 	contract, err := m.Create()
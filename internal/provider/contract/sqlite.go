@@ -0,0 +1,87 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package contract
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	_ "github.com/mattn/go-sqlite3" // The SQLite driver.
+)
+
+// The query reading the contracts of a SQLite database. The limits which matter the most
+// have their own columns, while the rest of the settings of a contract are an optional JSON
+// document with the same fields as in a file.
+const sqliteQuery = `SELECT id, COALESCE(master, 0), COALESCE(sign, 0), COALESCE(state, 0), COALESCE(tier, 0),
+	COALESCE(max_message_size, 0), COALESCE(max_daily_messages, 0), COALESCE(config, '')
+	FROM contracts`
+
+// sqliteSettings represents the settings of a contract kept as a JSON document.
+type sqliteSettings struct {
+	Rules   []Retention `json:"retention,omitempty"` // The retention rules.
+	Regions Placement   `json:"placement"`           // The regions.
+	Caps    Limits      `json:"limits"`              // The limits of each connection.
+}
+
+// readSQLite reads the contracts of the 'contracts' table of a SQLite database.
+func readSQLite(path string) ([]*contract, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+	rows, err := db.Query(sqliteQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	var contracts []*contract
+	for rows.Next() {
+		var (
+			c              = new(contract)
+			maxMessageSize int
+			maxDaily       int64
+			config         string
+		)
+
+		if err := rows.Scan(&c.ID, &c.MasterID, &c.Signature, &c.State, &c.Tier, &maxMessageSize, &maxDaily, &config); err != nil {
+			return nil, err
+		}
+
+		// Decode the rest of the settings, then apply the limits of the columns
+		if config != "" {
+			var settings sqliteSettings
+			if err := json.Unmarshal([]byte(config), &settings); err != nil {
+				return nil, err
+			}
+			c.Rules, c.Regions, c.Caps = settings.Rules, settings.Regions, settings.Caps
+		}
+		if maxMessageSize > 0 {
+			c.Caps.MaxMessageSize = maxMessageSize
+		}
+		if maxDaily > 0 {
+			c.Caps.MaxDailyMessages = maxDaily
+		}
+
+		contracts = append(contracts, c)
+	}
+
+	return contracts, rows.Err()
+}
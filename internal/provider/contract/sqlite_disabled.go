@@ -0,0 +1,29 @@
+//go:build nosqlite
+// +build nosqlite
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package contract
+
+import (
+	"errors"
+)
+
+var errNoSQLite = errors.New("the SQLite support was excluded from this build (nosqlite tag)")
+
+// readSQLite returns an error, since the SQLite support was excluded from this build.
+func readSQLite(path string) ([]*contract, error) {
+	return nil, errNoSQLite
+}
@@ -0,0 +1,58 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package contract
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/provider/usage"
+	"github.com/emitter-io/emitter/internal/security/license"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileContractProvider_SQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contracts.db")
+	db, err := sql.Open("sqlite3", path)
+	assert.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE contracts (
+		id INTEGER PRIMARY KEY, master INTEGER, sign INTEGER, state INTEGER, tier INTEGER,
+		max_message_size INTEGER, max_daily_messages INTEGER, config TEXT)`)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO contracts (id, tier, max_daily_messages, config) VALUES
+		(10, 1, 500, '{"limits": {"maxSubscriptions": 5, "maxDailyMessages": 100}}'),
+		(11, NULL, NULL, NULL)`)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	l, _ := license.Parse("zT83oDV0DWY5_JysbSTPTDr8KB0AAAAAAAAAAAAAAAI")
+	p := NewFileContractProvider(l, new(usage.NoopStorage))
+	assert.NoError(t, p.Configure(map[string]interface{}{"path": path}))
+	defer p.Close()
+
+	// The columns take precedence over the settings
+	c, ok := p.Get(10)
+	assert.True(t, ok)
+	assert.Equal(t, 2, c.Weight())
+	assert.Equal(t, Limits{MaxSubscriptions: 5, MaxDailyMessages: 500}, c.Limits())
+
+	c, ok = p.Get(11)
+	assert.True(t, ok)
+	assert.Equal(t, Limits{}, c.Limits())
+}
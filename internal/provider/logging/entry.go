@@ -0,0 +1,156 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Level represents the severity of a log entry.
+type Level uint8
+
+// The severities of the log entries, from the most verbose.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// The names of the levels, as configured and written.
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// ParseLevel parses the name of a level.
+func ParseLevel(name string) (Level, bool) {
+	for i, v := range levelNames {
+		if strings.EqualFold(v, name) {
+			return Level(i), true
+		}
+	}
+	return LevelInfo, false
+}
+
+// String returns the name of the level.
+func (l Level) String() string {
+	if int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return "unknown"
+}
+
+// ------------------------------------------------------------------------------------
+
+// Field represents a key-value pair attached to a log entry, such as the identifier of
+// the connection it relates to.
+type Field struct {
+	Key   string      // The name of the field.
+	Value interface{} // The value of the field.
+}
+
+// Conn returns the field of the identifier of a connection.
+func Conn(id string) Field {
+	return Field{Key: "conn", Value: id}
+}
+
+// Contract returns the field of the identifier of a contract.
+func Contract(id uint32) Field {
+	return Field{Key: "contract", Value: id}
+}
+
+// Client returns the field of the MQTT client identifier of a connection.
+func Client(id string) Field {
+	return Field{Key: "client", Value: id}
+}
+
+// Remote returns the field of the remote address of a connection.
+func Remote(addr string) Field {
+	return Field{Key: "remote", Value: addr}
+}
+
+// ------------------------------------------------------------------------------------
+
+// Entry represents a single structured log entry.
+type Entry struct {
+	Time    time.Time   // The time of the entry.
+	Level   Level       // The severity of the entry.
+	Context string      // The subsystem which logged the entry.
+	Action  string      // The action which was performed or has failed.
+	Target  interface{} // The target of the action, if any.
+	Err     error       // The error of the action, if any.
+	Fields  []Field     // The additional fields of the entry.
+}
+
+// String formats the entry as a line of text for the console.
+func (e *Entry) String() string {
+	var sb strings.Builder
+	sb.WriteString("[" + e.Context + "] ")
+	switch {
+	case e.Err != nil:
+		fmt.Fprintf(&sb, "error during %s (%s)", e.Action, e.Err.Error())
+	case e.Target != nil:
+		fmt.Fprintf(&sb, "%s (%v)", e.Action, e.Target)
+	default:
+		sb.WriteString(e.Action)
+	}
+
+	for _, f := range e.Fields {
+		fmt.Fprintf(&sb, " %s=%v", f.Key, f.Value)
+	}
+	return sb.String()
+}
+
+// JSON formats the entry as a single JSON object, with its fields in a stable order.
+func (e *Entry) JSON() []byte {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	writeField(&buffer, "time", e.Time.UTC().Format(time.RFC3339Nano))
+	writeField(&buffer, "level", e.Level.String())
+	writeField(&buffer, "context", e.Context)
+	writeField(&buffer, "msg", e.Action)
+	if e.Target != nil {
+		writeField(&buffer, "target", fmt.Sprint(e.Target))
+	}
+	if e.Err != nil {
+		writeField(&buffer, "error", e.Err.Error())
+	}
+	for _, f := range e.Fields {
+		writeField(&buffer, f.Key, f.Value)
+	}
+
+	buffer.WriteByte('}')
+	return buffer.Bytes()
+}
+
+// writeField writes a key-value pair of a JSON object, formatting the values which can
+// not be marshaled as strings.
+func writeField(buffer *bytes.Buffer, key string, value interface{}) {
+	if buffer.Len() > 1 {
+		buffer.WriteByte(',')
+	}
+
+	k, _ := json.Marshal(key)
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+
+	buffer.Write(k)
+	buffer.WriteByte(':')
+	buffer.Write(v)
+}
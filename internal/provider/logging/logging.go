@@ -15,9 +15,12 @@
 package logging
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"time"
 
 	"github.com/emitter-io/config"
 )
@@ -28,19 +31,49 @@ var Discard = log.New(ioutil.Discard, "", 0)
 // Logger is the logger we use.
 var Logger = NewStdErr()
 
+// Various errors of the configuration of the logger.
+var (
+	errInvalidFormat = errors.New("logging: the format must be either 'console' or 'json'")
+	errInvalidLevel  = errors.New("logging: the level must be one of 'debug', 'info', 'warn' or 'error'")
+)
+
 // LogError logs the error as a string.
-func LogError(context string, action string, err error) {
-	Logger.Printf("[%s] error during %s (%s)", context, action, err.Error())
+func LogError(context string, action string, err error, fields ...Field) {
+	write(&Entry{Level: LevelError, Context: context, Action: action, Err: err, Fields: fields})
+}
+
+// LogWarn logs an action which requires the attention of the operators.
+func LogWarn(context string, action string, fields ...Field) {
+	write(&Entry{Level: LevelWarn, Context: context, Action: action, Fields: fields})
 }
 
 // LogAction logs The action with a tag.
-func LogAction(context string, action string) {
-	Logger.Printf("[%s] %s", context, action)
+func LogAction(context string, action string, fields ...Field) {
+	write(&Entry{Level: LevelInfo, Context: context, Action: action, Fields: fields})
 }
 
 // LogTarget logs The action with a tag.
-func LogTarget(context, action string, target interface{}) {
-	Logger.Printf("[%s] %s (%v)", context, action, target)
+func LogTarget(context, action string, target interface{}, fields ...Field) {
+	write(&Entry{Level: LevelInfo, Context: context, Action: action, Target: target, Fields: fields})
+}
+
+// LogDebug logs a verbose action, which is only written if enabled for the context.
+func LogDebug(context, action string, fields ...Field) {
+	write(&Entry{Level: LevelDebug, Context: context, Action: action, Fields: fields})
+}
+
+// write writes the entry to the logger. The loggers which are not structured only get
+// the entries of the info level and above, formatted as text.
+func write(e *Entry) {
+	e.Time = time.Now()
+	if structured, ok := Logger.(Structured); ok {
+		structured.Log(e)
+		return
+	}
+
+	if e.Level >= LevelInfo {
+		Logger.Printf("%s", e.String())
+	}
 }
 
 // ------------------------------------------------------------------------------------
@@ -53,17 +86,34 @@ type Logging interface {
 	Printf(format string, v ...interface{})
 }
 
+// Structured represents a logger which writes the structured entries itself.
+type Structured interface {
+	Logging
+
+	// Log writes the entry, unless its level is disabled.
+	Log(e *Entry)
+}
+
 // ------------------------------------------------------------------------------------
 
 // stderrLogger implements Logging contract.
-var _ Logging = new(stderrLogger)
-
-// stderrLogger represents a simple golang logger.
-type stderrLogger log.Logger
+var _ Structured = new(stderrLogger)
+
+// stderrLogger represents a leveled logger writing to the standard error, either as text
+// lines or as JSON objects.
+type stderrLogger struct {
+	out    *log.Logger      // The underlying logger.
+	json   bool             // Whether the entries are written as JSON.
+	level  Level            // The minimum level of the entries written.
+	levels map[string]Level // The minimum level per context, overriding the default one.
+}
 
 // NewStdErr creates a new default stderr logger.
 func NewStdErr() Logging {
-	return (*stderrLogger)(log.New(os.Stderr, "", log.LstdFlags))
+	return &stderrLogger{
+		out:   log.New(os.Stderr, "", log.LstdFlags),
+		level: LevelInfo,
+	}
 }
 
 // Name returns the name of the provider.
@@ -71,12 +121,64 @@ func (s *stderrLogger) Name() string {
 	return "stderr"
 }
 
-// Configure configures the provider
+// Configure configures the provider with the 'format' of the entries ('console' or 'json'),
+// their minimum 'level' and the minimum 'levels' of the contexts (e.g: {"conn": "debug"}).
 func (s *stderrLogger) Configure(config map[string]interface{}) error {
+	if v, ok := config["format"]; ok {
+		switch fmt.Sprint(v) {
+		case "console":
+		case "json":
+			s.json = true
+			s.out.SetFlags(0)
+		default:
+			return errInvalidFormat
+		}
+	}
+
+	if v, ok := config["level"]; ok {
+		level, ok := ParseLevel(fmt.Sprint(v))
+		if !ok {
+			return errInvalidLevel
+		}
+		s.level = level
+	}
+
+	if v, ok := config["levels"].(map[string]interface{}); ok {
+		s.levels = make(map[string]Level, len(v))
+		for context, name := range v {
+			level, ok := ParseLevel(fmt.Sprint(name))
+			if !ok {
+				return errInvalidLevel
+			}
+			s.levels[context] = level
+		}
+	}
 	return nil
 }
 
+// Enabled returns whether the entries of the level are written for the context.
+func (s *stderrLogger) Enabled(context string, level Level) bool {
+	if min, ok := s.levels[context]; ok {
+		return level >= min
+	}
+	return level >= s.level
+}
+
+// Log writes the entry, unless its level is disabled.
+func (s *stderrLogger) Log(e *Entry) {
+	if !s.Enabled(e.Context, e.Level) {
+		return
+	}
+
+	if s.json {
+		s.out.Printf("%s\n", e.JSON())
+		return
+	}
+
+	s.out.Printf("%s\n", e.String())
+}
+
 // Printf prints a log line.
 func (s *stderrLogger) Printf(format string, v ...interface{}) {
-	(*log.Logger)(s).Printf(format+"\n", v...)
+	s.out.Printf(format+"\n", v...)
 }
@@ -16,8 +16,10 @@ package logging
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"log"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,7 +27,10 @@ import (
 
 // newTestLogger creates a new default stderr logger.
 func newTestLogger(buffer *bytes.Buffer) Logging {
-	return (*stderrLogger)(log.New(buffer, "", 0))
+	return &stderrLogger{
+		out:   log.New(buffer, "", 0),
+		level: LevelInfo,
+	}
 }
 
 func TestLogAction(t *testing.T) {
@@ -58,8 +63,96 @@ func TestLogTarget(t *testing.T) {
 	assert.Equal(t, "[a] b (123)\n", string(buffer.Bytes()))
 }
 
+func TestLogFields(t *testing.T) {
+	defer func(l Logging) { Logger = l }(Logger)
+
+	buffer := bytes.NewBuffer(nil)
+	Logger = newTestLogger(buffer)
+
+	LogError("conn", "publish", errors.New("err"), Conn("abc"), Contract(1))
+	LogWarn("a", "b")
+	LogDebug("a", "c", Client("x"))
+	assert.Equal(t, "[conn] error during publish (err) conn=abc contract=1\n[a] b\n", string(buffer.Bytes()))
+}
+
+func TestLogLevels(t *testing.T) {
+	defer func(l Logging) { Logger = l }(Logger)
+
+	buffer := bytes.NewBuffer(nil)
+	logger := newTestLogger(buffer)
+	assert.NoError(t, logger.Configure(map[string]interface{}{
+		"format": "json",
+		"level":  "warn",
+		"levels": map[string]interface{}{"conn": "debug"},
+	}))
+
+	Logger = logger
+	LogAction("a", "dropped")
+	LogDebug("conn", "closed", Conn("abc"))
+	LogTarget("conn", "negotiated", 123)
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Len(t, lines, 2)
+	for _, line := range lines {
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, "conn", entry["context"])
+		assert.NotEmpty(t, entry["time"])
+	}
+
+	assert.Contains(t, lines[0], `"level":"debug","context":"conn","msg":"closed","conn":"abc"`)
+	assert.Contains(t, lines[1], `"level":"info","context":"conn","msg":"negotiated","target":"123"`)
+}
+
+func TestLogUnstructured(t *testing.T) {
+	defer func(l Logging) { Logger = l }(Logger)
+
+	buffer := bytes.NewBuffer(nil)
+	Logger = &unstructured{log.New(buffer, "", 0)}
+
+	LogDebug("a", "b")
+	LogTarget("a", "c", 1)
+	assert.Equal(t, "[a] c (1)\n", buffer.String())
+}
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		config map[string]interface{}
+		err    error
+	}{
+		{config: map[string]interface{}{"format": "xml"}, err: errInvalidFormat},
+		{config: map[string]interface{}{"level": "trace"}, err: errInvalidLevel},
+		{config: map[string]interface{}{"levels": map[string]interface{}{"conn": "all"}}, err: errInvalidLevel},
+		{config: map[string]interface{}{"format": "console", "level": "ERROR"}},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.err, NewStdErr().Configure(tc.config))
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	level, ok := ParseLevel("Warn")
+	assert.True(t, ok)
+	assert.Equal(t, LevelWarn, level)
+	assert.Equal(t, "warn", level.String())
+	assert.Equal(t, "unknown", Level(9).String())
+
+	_, ok = ParseLevel("verbose")
+	assert.False(t, ok)
+}
+
 func TestStdErrLogger(t *testing.T) {
 	l := NewStdErr()
 	assert.NoError(t, l.Configure(nil))
 	assert.Equal(t, "stderr", l.Name())
 }
+
+// unstructured represents a logger which is not leveled.
+type unstructured struct {
+	*log.Logger
+}
+
+func (u *unstructured) Name() string                                  { return "test" }
+func (u *unstructured) Configure(config map[string]interface{}) error { return nil }
+func (u *unstructured) Printf(format string, v ...interface{})        { u.Logger.Printf(format+"\n", v...) }
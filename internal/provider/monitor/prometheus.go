@@ -1,3 +1,6 @@
+//go:build !noprometheus
+// +build !noprometheus
+
 /**********************************************************************************
 * Copyright (c) 2009-2019 Misakai Ltd.
 * This program is free software: you can redistribute it and/or modify it under the
@@ -26,6 +29,12 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+func init() {
+	Register("prometheus", func(snapshotter stats.Snapshotter, mux *http.ServeMux) Storage {
+		return NewPrometheus(snapshotter, mux)
+	})
+}
+
 // Noop implements Storage contract.
 var _ Storage = new(Prometheus)
 
@@ -35,6 +44,7 @@ type Prometheus struct {
 	reader     stats.Snapshotter               // The reader which reads the snapshot of stats.
 	cancel     context.CancelFunc              // The cancellation function.
 	gauges     map[string]prometheus.Gauge     // The gauges created
+	counters   map[string]prometheus.Counter   // The counters created
 	histograms map[string]prometheus.Histogram // The histograms created
 }
 
@@ -51,6 +61,7 @@ func NewPrometheus(snapshotter stats.Snapshotter, mux *http.ServeMux) *Prometheu
 		registry:   registry,
 		reader:     snapshotter,
 		gauges:     make(map[string]prometheus.Gauge, 0),
+		counters:   make(map[string]prometheus.Counter, 0),
 		histograms: make(map[string]prometheus.Histogram, 0),
 	}
 }
@@ -92,12 +103,20 @@ func (p *Prometheus) write() {
 	p.gauge(metrics, "node.peers")
 	p.gauge(metrics, "node.conns")
 	p.gauge(metrics, "node.subs")
+	p.gauge(metrics, "node.lag")
+	p.gauge(metrics, "node.backlog")
+	p.gauge(metrics, "node.parked")
+	p.gauge(metrics, "node.queued")
+	p.gauge(metrics, "scheduler.delay")
 
+	// The events are counted and the latencies and fan-outs observed in histograms
 	for name := range metrics {
 		prefix := strings.Split(name, ".")[0]
 		switch prefix {
-		case "rcv", "send":
+		case "rcv", "send", "peer", "federation", "store", "fanout":
 			p.histogram(metrics, name)
+		case "conn", "pubsub", "cluster", "listener", "error", "pool":
+			p.counter(metrics, name)
 		}
 	}
 }
@@ -118,6 +137,21 @@ func (p *Prometheus) addGauge(metric string) prometheus.Gauge {
 	return g
 }
 
+// addCounter creates a counter and maps it to a metric name
+func (p *Prometheus) addCounter(metric string) prometheus.Counter {
+	opts := prometheus.CounterOpts{
+		Name: strings.Replace(metric, ".", "_", -1) + "_total",
+	}
+
+	c := prometheus.NewCounter(opts)
+	if err := p.registry.Register(c); err != nil {
+		panic(err)
+	}
+
+	p.counters[metric] = c
+	return c
+}
+
 func (p *Prometheus) addHistogram(metric string) prometheus.Histogram {
 	opts := prometheus.HistogramOpts{
 		Name: strings.Replace(metric, ".", "_", -1),
@@ -141,6 +175,18 @@ func (p *Prometheus) gauge(source map[string]stats.Snapshot, metric string) {
 	}
 }
 
+// sends the metric as a counter, incremented by the sum of the values measured. Since the
+// sample is bounded, the sum is estimated from the mean and the number of measurements.
+func (p *Prometheus) counter(source map[string]stats.Snapshot, metric string) {
+	if v, ok := source[metric]; ok && v.Count() > 0 {
+		c, ok := p.counters[metric]
+		if !ok {
+			c = p.addCounter(metric)
+		}
+		c.Add(v.Mean() * float64(v.Count()))
+	}
+}
+
 // sends the metric as a histogram
 func (p *Prometheus) histogram(source map[string]stats.Snapshot, metric string) {
 	if v, ok := source[metric]; ok {
@@ -1,3 +1,6 @@
+//go:build !noprometheus
+// +build !noprometheus
+
 /**********************************************************************************
 * Copyright (c) 2009-2019 Misakai Ltd.
 * This program is free software: you can redistribute it and/or modify it under the
@@ -57,6 +60,10 @@ func TestPrometheus_Request(t *testing.T) {
 		m.Measure("node.peers", 2)
 		m.Measure("node.conns", i)
 		m.Measure("node.subs", i)
+		m.Measure("conn.opened", 1)
+		m.Measure("cluster.forwarded", 2)
+		m.Measure("pool.mqtt.buffers.allocs", 1)
+		m.Measure("store.write", i/10)
 	}
 
 	mux := http.NewServeMux()
@@ -90,6 +97,12 @@ func TestPrometheus_Request(t *testing.T) {
 	assert.Contains(t, string(content), "rcv_test_sum 450")
 	assert.Contains(t, string(content), "rcv_test_count 100")
 
+	// assert counters, which sum the values measured
+	assert.Contains(t, string(content), "conn_opened_total 100")
+	assert.Contains(t, string(content), "cluster_forwarded_total 200")
+	assert.Contains(t, string(content), "pool_mqtt_buffers_allocs_total 100")
+	assert.Contains(t, string(content), "store_write_count 100")
+
 	// from InstrumentMetricHandler
 	assert.Contains(t, string(content), "promhttp_metric_handler_requests_total")
 
@@ -0,0 +1,65 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package monitor
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/emitter-io/config"
+	"github.com/emitter-io/stats"
+)
+
+// Factory creates a new, unconfigured instance of a monitoring sink. The snapshotter
+// provides the stats to publish, and the sinks which are scraped can register their
+// endpoints on the HTTP multiplexer.
+type Factory func(snapshotter stats.Snapshotter, mux *http.ServeMux) Storage
+
+// The registry of the optional monitoring sinks, by name.
+var registry = struct {
+	sync.Mutex
+	factories map[string]Factory
+}{
+	factories: make(map[string]Factory),
+}
+
+// Register registers a monitoring sink so it can be selected by its name through the
+// "monitor.provider" configuration. This is typically called from an init() function
+// of the file implementing the sink, which can then be excluded with a build tag.
+func Register(name string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.factories[name] = factory
+}
+
+// Providers creates an instance of every registered monitoring sink, sorted by name, so
+// one of them can be loaded from the configuration.
+func Providers(snapshotter stats.Snapshotter, mux *http.ServeMux) []config.Provider {
+	registry.Lock()
+	defer registry.Unlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	providers := make([]config.Provider, 0, len(names))
+	for _, name := range names {
+		providers = append(providers, registry.factories[name](snapshotter, mux))
+	}
+	return providers
+}
@@ -0,0 +1,38 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package monitor
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/emitter-io/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Providers(t *testing.T) {
+	Register("custom", func(stats.Snapshotter, *http.ServeMux) Storage { return NewNoop() })
+	defer func() {
+		registry.Lock()
+		delete(registry.factories, "custom")
+		registry.Unlock()
+	}()
+
+	providers := Providers(stats.New(), http.NewServeMux())
+	assert.NotEmpty(t, providers)
+	for _, p := range providers {
+		assert.NotNil(t, p)
+	}
+}
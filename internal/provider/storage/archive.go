@@ -0,0 +1,218 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+const (
+	archiveExtension  = ".frame" // The extension of the archived segments.
+	archiveMaxPending = 10       // The number of batches kept pending while the archive fails.
+)
+
+// ObjectStore represents an object storage (e.g: S3) in which the messages are archived.
+type ObjectStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	List(prefix string) ([]string, error)
+}
+
+// ------------------------------------------------------------------------------------
+
+// Archived implements Storage contract.
+var _ Storage = new(Archived)
+
+// Archived represents a storage which also archives every stored message into an object
+// storage, for long-term retention without bloating the underlying storage. The messages
+// are batched and written as compressed segments, one per contract and day, so they can
+// later be queried offline.
+type Archived struct {
+	sync.Mutex
+	Storage                           // The underlying storage.
+	objects  ObjectStore              // The object storage to archive to.
+	prefix   string                   // The prefix of the keys of the segments.
+	node     string                   // The unique identifier of this node.
+	limit    int                      // The number of messages which triggers a flush.
+	pending  map[string]message.Frame // The messages to archive, by segment prefix.
+	count    int                      // The number of messages pending.
+	flushing int32                    // Whether a flush is in progress.
+	cancel   context.CancelFunc       // The cancellation function.
+}
+
+// NewArchived creates a new storage archiving the messages into the object storage. The
+// messages are flushed at the interval specified or once the limit is reached.
+func NewArchived(store Storage, objects ObjectStore, prefix string, interval time.Duration, limit int) *Archived {
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+
+	s := &Archived{
+		Storage: store,
+		objects: objects,
+		prefix:  prefix,
+		node:    newNodeID(),
+		limit:   limit,
+		pending: make(map[string]message.Frame),
+	}
+
+	s.cancel = async.Repeat(context.Background(), interval, s.flush)
+	return s
+}
+
+// Store appends the message to the underlying storage and queues it for archival.
+func (s *Archived) Store(m *message.Message) error {
+	if err := s.Storage.Store(m); err != nil {
+		return err
+	}
+
+	s.Lock()
+	key := archivePrefix(s.prefix, m.Contract(), m.Time())
+	s.pending[key] = append(s.pending[key], *m)
+	s.count++
+	full := s.count >= s.limit
+	s.Unlock()
+
+	if full {
+		go s.flush()
+	}
+	return nil
+}
+
+// flush writes the pending messages into the object storage, as one segment per contract
+// and day. If the object storage fails, the messages are kept for the next attempt.
+func (s *Archived) flush() {
+	if !atomic.CompareAndSwapInt32(&s.flushing, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&s.flushing, 0)
+
+	s.Lock()
+	batches := s.pending
+	s.pending = make(map[string]message.Frame)
+	s.count = 0
+	s.Unlock()
+
+	for prefix, frame := range batches {
+		frame.Sort()
+		key := fmt.Sprintf("%s%d-%s%s", prefix, time.Now().UnixNano(), s.node, archiveExtension)
+		if err := s.objects.Put(key, frame.Encode()); err != nil {
+			logging.LogError("archive", "writing segment", err)
+			s.requeue(prefix, frame)
+		}
+	}
+}
+
+// requeue puts back the messages which could not be archived, unless too many of them
+// are pending already, in which case they are dropped.
+func (s *Archived) requeue(prefix string, frame message.Frame) {
+	s.Lock()
+	defer s.Unlock()
+	if s.count+len(frame) > archiveMaxPending*s.limit {
+		logging.LogWarn("archive", fmt.Sprintf("dropped %d messages which could not be archived", len(frame)))
+		return
+	}
+
+	s.pending[prefix] = append(frame, s.pending[prefix]...)
+	s.count += len(frame)
+}
+
+// OnSurvey handles an incoming cluster lookup request, if the underlying storage does.
+func (s *Archived) OnSurvey(surveyType string, payload []byte) ([]byte, bool) {
+	if surveyee, ok := s.Storage.(service.Surveyee); ok {
+		return surveyee.OnSurvey(surveyType, payload)
+	}
+	return nil, false
+}
+
+// Close flushes the pending messages and closes the underlying storage.
+func (s *Archived) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	// Wait for any flush in progress, so the last one is not skipped
+	for atomic.LoadInt32(&s.flushing) == 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.flush()
+	return s.Storage.Close()
+}
+
+// archivePrefix returns the prefix of the segments of a contract for the day of the time.
+func archivePrefix(prefix string, contract uint32, t int64) string {
+	return fmt.Sprintf("%s%d/%s/", prefix, contract, time.Unix(t, 0).UTC().Format("2006/01/02"))
+}
+
+// ------------------------------------------------------------------------------------
+
+// ReadArchive reads the messages of a contract archived within the time window, from the
+// oldest segment to the most recent one, and calls back for every message. Since there is
+// a segment prefix per day, the beginning of the window should be specified.
+func ReadArchive(objects ObjectStore, prefix string, contract uint32, from, until time.Time, fn func(*message.Message)) error {
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+
+	t0, t1 := window(from, until)
+	last := t1
+	if now := time.Now().Unix(); last > now {
+		last = now
+	}
+
+	for day := time.Unix(t0, 0).UTC().Truncate(24 * time.Hour); day.Unix() <= last; day = day.AddDate(0, 0, 1) {
+		keys, err := objects.List(archivePrefix(prefix, contract, day.Unix()))
+		if err != nil {
+			return err
+		}
+
+		sort.Strings(keys)
+		for _, key := range keys {
+			if path.Ext(key) != archiveExtension {
+				continue
+			}
+
+			data, err := objects.Get(key)
+			if err != nil {
+				return err
+			}
+
+			frame, err := message.DecodeFrame(data)
+			if err != nil {
+				return fmt.Errorf("archive: unable to decode %s (%s)", key, err)
+			}
+
+			for i := range frame {
+				if t := frame[i].Time(); t >= t0 && t <= t1 {
+					fn(&frame[i])
+				}
+			}
+		}
+	}
+	return nil
+}
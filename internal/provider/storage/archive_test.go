@@ -0,0 +1,159 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+// objects represents an in-memory object storage.
+type objects struct {
+	sync.Mutex
+	data map[string][]byte
+	err  error
+}
+
+func (o *objects) Put(key string, data []byte) error {
+	o.Lock()
+	defer o.Unlock()
+	if o.err != nil {
+		return o.err
+	}
+
+	o.data[key] = data
+	return nil
+}
+
+func (o *objects) Get(key string) ([]byte, error) {
+	o.Lock()
+	defer o.Unlock()
+	return o.data[key], nil
+}
+
+func (o *objects) List(prefix string) (keys []string, err error) {
+	o.Lock()
+	defer o.Unlock()
+	for key := range o.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return
+}
+
+func newTestArchive(limit int) (*Archived, *objects) {
+	store := NewInMemory(nil)
+	store.Configure(nil)
+	archive := &objects{data: make(map[string][]byte)}
+	return NewArchived(store, archive, "/archive/", time.Hour, limit), archive
+}
+
+func TestArchived_Flush(t *testing.T) {
+	s, archive := newTestArchive(1000)
+	day := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC).Unix()
+	for i := 0; i < 3; i++ {
+		msg := message.New(message.Ssid{uint32(i % 2), 1, 2}, []byte("a/b/"), []byte("hi"))
+		msg.TTL = 100
+		msg.ID.SetTime(day + int64(i))
+		assert.NoError(t, s.Store(msg))
+	}
+
+	// Nothing is written until flushed
+	assert.Len(t, archive.data, 0)
+	assert.NoError(t, s.Close())
+
+	keys, _ := archive.List("")
+	assert.Len(t, keys, 2)
+	assert.True(t, strings.HasPrefix(keys[0], "archive/0/2020/05/01/"))
+	assert.True(t, strings.HasPrefix(keys[1], "archive/1/2020/05/01/"))
+
+	frame, err := message.DecodeFrame(archive.data[keys[0]])
+	assert.NoError(t, err)
+	assert.Len(t, frame, 2)
+}
+
+func TestArchived_FlushLimit(t *testing.T) {
+	s, archive := newTestArchive(2)
+	defer s.Close()
+
+	for i := 0; i < 2; i++ {
+		msg := message.New(message.Ssid{1, 1, 2}, []byte("a/b/"), []byte("hi"))
+		msg.TTL = 100
+		assert.NoError(t, s.Store(msg))
+	}
+
+	// The flush is triggered asynchronously once the limit is reached
+	assert.Eventually(t, func() bool {
+		keys, _ := archive.List("archive/1/")
+		return len(keys) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestArchived_FlushError(t *testing.T) {
+	s, archive := newTestArchive(1)
+	archive.err = errors.New("unavailable")
+
+	msg := message.New(message.Ssid{1, 1, 2}, []byte("a/b/"), []byte("hi"))
+	msg.TTL = 100
+	s.Lock()
+	s.pending["archive/1/2020/05/01/"] = message.Frame{*msg}
+	s.count = 1
+	s.Unlock()
+
+	// The messages are kept for the next attempt
+	s.flush()
+	assert.Equal(t, 1, s.count)
+
+	// Until too many of them are pending
+	s.limit = 0
+	s.flush()
+	assert.Equal(t, 0, s.count)
+
+	archive.err = nil
+	assert.NoError(t, s.Close())
+	assert.Len(t, archive.data, 0)
+}
+
+func TestReadArchive(t *testing.T) {
+	s, archive := newTestArchive(1000)
+	now := time.Now().Unix()
+	for i := 0; i < 5; i++ {
+		msg := message.New(message.Ssid{1, 1, 2}, []byte("a/b/"), []byte{byte(i)})
+		msg.TTL = 100
+		msg.ID.SetTime(now - 86400*int64(i))
+		assert.NoError(t, s.Store(msg))
+	}
+	assert.NoError(t, s.Close())
+
+	var read []byte
+	assert.NoError(t, ReadArchive(archive, "archive", 1, time.Unix(now-86400*3, 0), time.Unix(now-86400, 0), func(m *message.Message) {
+		read = append(read, m.Payload[0])
+	}))
+	assert.Equal(t, []byte{3, 2, 1}, read)
+
+	// Other contracts are not read
+	assert.NoError(t, ReadArchive(archive, "archive", 2, time.Unix(now-86400*3, 0), time.Unix(0, 0), func(m *message.Message) {
+		assert.Fail(t, "unexpected message")
+	}))
+}
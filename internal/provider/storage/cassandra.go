@@ -0,0 +1,212 @@
+//go:build !nocassandra
+// +build !nocassandra
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/gocql/gocql"
+)
+
+const (
+	defaultCassandraKeyspace = "emitter"         // The default keyspace to use.
+	defaultCassandraTable    = "emitter_message" // The default table to store the messages in.
+	maxCassandraTTL          = 630720000         // The maximum TTL supported, 20 years.
+	cassandraPageSize        = 1000              // The number of rows fetched at once.
+)
+
+func init() {
+	Register("cassandra", func(service.Surveyor) Storage { return NewCassandra() })
+}
+
+// ------------------------------------------------------------------------------------
+
+// Cassandra implements Storage contract.
+var _ Storage = new(Cassandra)
+
+// Cassandra represents a storage which keeps the messages in a Cassandra (or Scylla)
+// cluster. The expiration of the messages is handled by the database itself and, since
+// the database is shared by all of the nodes, the queries do not need to be surveyed.
+type Cassandra struct {
+	retain  uint32         // The configured TTL for 'retained' messages.
+	table   string         // The name of the table to use.
+	session *gocql.Session // The session with the cluster.
+}
+
+// NewCassandra creates a new Cassandra storage.
+func NewCassandra() *Cassandra {
+	return new(Cassandra)
+}
+
+// Name returns the name of the provider.
+func (s *Cassandra) Name() string {
+	return "cassandra"
+}
+
+// Configure configures the storage. The config parameter provided is
+// loosely typed, since various storage mechanisms will require different
+// configurations.
+func (s *Cassandra) Configure(config map[string]interface{}) error {
+	s.table = configString(config, "table", defaultCassandraTable)
+	if !validTable.MatchString(s.table) {
+		return errInvalidTable
+	}
+
+	// Prepare the cluster configuration, the keyspace must already exist
+	cluster := gocql.NewCluster(strings.Split(configString(config, "hosts", "127.0.0.1"), ",")...)
+	cluster.Keyspace = configString(config, "keyspace", defaultCassandraKeyspace)
+	cluster.Timeout = 5 * time.Second
+	cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
+	if user := configString(config, "username", ""); user != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: user,
+			Password: configString(config, "password", ""),
+		}
+	}
+
+	consistency, err := gocql.ParseConsistencyWrapper(configString(config, "consistency", "LOCAL_QUORUM"))
+	if err != nil {
+		return err
+	}
+	cluster.Consistency = consistency
+
+	// Connect to the cluster
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return err
+	}
+
+	// Create the table, if it does not exist yet
+	if err := session.Query(cassandraSchema(s.table)).Exec(); err != nil {
+		session.Close()
+		return err
+	}
+
+	s.session = session
+	s.retain = configUint32(config, "retain", defaultRetain)
+	return nil
+}
+
+// cassandraSchema returns the statement creating the table. The messages are partitioned
+// per channel, by the contract and the first part of the channel, so the queries of the
+// sub-channels and wildcards stay within a single partition. Within a partition, the
+// messages are clustered by their ID, which sorts them from the most recent one.
+func cassandraSchema(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		prefix bigint,
+		id     blob,
+		value  blob,
+		PRIMARY KEY (prefix, id)
+	) WITH CLUSTERING ORDER BY (id ASC)
+	AND compaction = {'class': 'TimeWindowCompactionStrategy'}`, table)
+}
+
+// ttlOf returns the remaining time to live of the message, in seconds.
+func ttlOf(m *message.Message, retain uint32, now time.Time) int64 {
+	ttl := expiresOf(m, retain).Unix() - now.Unix()
+	if ttl > maxCassandraTTL {
+		return maxCassandraTTL
+	}
+	return ttl
+}
+
+// Store appends the messages to the store.
+func (s *Cassandra) Store(m *message.Message) error {
+	// The message has already expired, no need to store it
+	ttl := ttlOf(m, s.retain, time.Now())
+	if ttl <= 0 {
+		return nil
+	}
+
+	return s.session.Query(fmt.Sprintf("INSERT INTO %s (prefix, id, value) VALUES (?, ?, ?) USING TTL ?", s.table),
+		prefixOf(m.ID), []byte(m.ID), m.Encode(), ttl).Exec()
+}
+
+// Query performs a query and attempts to fetch last n messages where
+// n is specified by limit argument. From and until times can also be specified
+// for time-series retrieval.
+func (s *Cassandra) Query(ssid message.Ssid, from, until time.Time, limit int) (message.Frame, error) {
+	if len(ssid) < 2 {
+		return nil, errInvalidSsid
+	}
+
+	match := make(message.Frame, 0, limit)
+	err := s.scan(ssid, from, until, func(id message.ID, value []byte) bool {
+		if msg, err := message.DecodeMessage(value); err == nil {
+			match = append(match, msg)
+		}
+		return len(match) < limit
+	})
+
+	match.Limit(limit)
+	return match, err
+}
+
+// Delete removes the messages matching the SSID within the time window.
+func (s *Cassandra) Delete(ssid message.Ssid, from, until time.Time) error {
+	if len(ssid) < 2 {
+		return errInvalidSsid
+	}
+
+	// Collect the keys of the messages to remove
+	var keys [][]byte
+	if err := s.scan(ssid, from, until, func(id message.ID, _ []byte) bool {
+		keys = append(keys, id)
+		return true
+	}); err != nil || len(keys) == 0 {
+		return err
+	}
+
+	// Remove them within the partition, in a single statement
+	return s.session.Query(fmt.Sprintf("DELETE FROM %s WHERE prefix = ? AND id IN ?", s.table),
+		int64(ssid[0]^ssid[1]), keys).Exec()
+}
+
+// scan iterates through the messages of the partition matching the SSID within the time
+// window, from the most recent one, until the callback returns false.
+func (s *Cassandra) scan(ssid message.Ssid, from, until time.Time, fn func(message.ID, []byte) bool) error {
+	t0, t1 := window(from, until)
+	iter := s.session.Query(fmt.Sprintf("SELECT id, value FROM %s WHERE prefix = ? AND id >= ?", s.table),
+		int64(ssid[0]^ssid[1]), []byte(message.NewPrefix(ssid, t1))).PageSize(cassandraPageSize).Iter()
+
+	var id, value []byte
+	for iter.Scan(&id, &value) && message.ID(id).Time() >= t0 {
+		if message.ID(id).Match(ssid, t0, t1) && !fn(id, value) {
+			break
+		}
+	}
+	return iter.Close()
+}
+
+// GC runs the garbage collection. The expired messages are removed by the database
+// itself, so this does nothing.
+func (s *Cassandra) GC() error {
+	return nil
+}
+
+// Close is used to gracefully close the connection.
+func (s *Cassandra) Close() error {
+	if s.session != nil {
+		s.session.Close()
+	}
+	return nil
+}
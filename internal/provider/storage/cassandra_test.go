@@ -0,0 +1,124 @@
+//go:build !nocassandra
+// +build !nocassandra
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+// Opens a Cassandra storage and runs a test on it. This requires a cluster, specified
+// by the EMITTER_TEST_CASSANDRA hosts, otherwise the test is skipped.
+func runCassandraTest(t *testing.T, test func(store *Cassandra)) {
+	hosts := os.Getenv("EMITTER_TEST_CASSANDRA")
+	if hosts == "" {
+		t.Skip("EMITTER_TEST_CASSANDRA is not set")
+	}
+
+	store := NewCassandra()
+	assert.NoError(t, store.Configure(map[string]interface{}{
+		"hosts":       hosts,
+		"table":       "emitter_test",
+		"consistency": "ONE",
+	}))
+
+	defer store.Close()
+	defer store.session.Query("DROP TABLE emitter_test").Exec()
+	test(store)
+}
+
+func TestCassandra_Name(t *testing.T) {
+	s := NewCassandra()
+	assert.Equal(t, "cassandra", s.Name())
+	assert.NoError(t, s.Close())
+	assert.NoError(t, s.GC())
+}
+
+func TestCassandra_ConfigureInvalid(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"table": "messages; DROP TABLE x"},
+		{"consistency": "SOMETIMES"},
+		{"hosts": "127.0.0.1:1"},
+	}
+
+	for _, tc := range tests {
+		assert.Error(t, NewCassandra().Configure(tc))
+	}
+}
+
+func TestCassandra_Schema(t *testing.T) {
+	stmt := cassandraSchema("msg")
+	assert.Contains(t, stmt, "CREATE TABLE IF NOT EXISTS msg (")
+	assert.Contains(t, stmt, "PRIMARY KEY (prefix, id)")
+}
+
+func TestCassandra_ttlOf(t *testing.T) {
+	now := time.Now()
+	msg := message.New(message.Ssid{0, 1, 2}, []byte("a/"), nil)
+	msg.ID.SetTime(now.Unix())
+
+	tests := []struct {
+		ttl    uint32
+		expect int64
+	}{
+		{ttl: 0, expect: 0},
+		{ttl: 60, expect: 60},
+		{ttl: message.RetainedTTL, expect: 3600},
+		{ttl: math.MaxUint32 - 1, expect: maxCassandraTTL},
+	}
+
+	for _, tc := range tests {
+		msg.TTL = tc.ttl
+		assert.Equal(t, tc.expect, ttlOf(msg, 3600, now))
+	}
+}
+
+func TestCassandra_QueryOrdered(t *testing.T) {
+	runCassandraTest(t, func(store *Cassandra) {
+		testOrder(t, store)
+	})
+}
+
+func TestCassandra_QueryRetained(t *testing.T) {
+	runCassandraTest(t, func(store *Cassandra) {
+		testRetained(t, store)
+	})
+}
+
+func TestCassandra_QueryRange(t *testing.T) {
+	runCassandraTest(t, func(store *Cassandra) {
+		testRange(t, store)
+	})
+}
+
+func TestCassandra_Delete(t *testing.T) {
+	runCassandraTest(t, func(store *Cassandra) {
+		testOrder(t, store)
+
+		zero := time.Unix(0, 0)
+		assert.NoError(t, store.Delete(message.Ssid{0, 1}, zero, zero))
+		f, err := store.Query(message.Ssid{0, 1, 2}, zero, zero, 5)
+		assert.NoError(t, err)
+		assert.Len(t, f, 0)
+	})
+}
@@ -0,0 +1,118 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+// Compacted implements Storage contract.
+var _ Storage = new(Compacted)
+
+// Compacted represents a storage which compacts the last-value channels, retaining only
+// the newest message of each partition. The partition of a message is the part of its
+// channel matched by the pattern of the last-value channel, so a "devices/+/state/"
+// pattern keeps the newest message of each device.
+type Compacted struct {
+	Storage                     // The underlying storage.
+	patterns []security.Pattern // The patterns of the last-value channels.
+}
+
+// NewCompacted creates a new storage compacting the channels matching any of the
+// comma-separated patterns (e.g: "devices/+/state/").
+func NewCompacted(store Storage, patterns string) *Compacted {
+	return &Compacted{
+		Storage:  store,
+		patterns: security.ParsePatterns(patterns),
+	}
+}
+
+// Store appends the message to the underlying storage and, if the message is published
+// on a last-value channel, removes the older messages of its partition.
+func (s *Compacted) Store(m *message.Message) error {
+	if err := s.Storage.Store(m); err != nil {
+		return err
+	}
+
+	if depth := s.depthOf(m.Channel); depth > 0 {
+		partition := m.Ssid()[:depth+1]
+		if err := s.Storage.Delete(partition, time.Unix(0, 0), time.Unix(m.Time()-1, 0)); err != nil {
+			logging.LogError("storage", "compact", err)
+		}
+	}
+	return nil
+}
+
+// Query performs a query and attempts to fetch last n messages where n is specified by
+// limit argument. The messages of the last-value channels are compacted, since the older
+// messages of a partition may still be stored on other nodes.
+func (s *Compacted) Query(ssid message.Ssid, from, until time.Time, limit int) (message.Frame, error) {
+	frame, err := s.Storage.Query(ssid, from, until, limit)
+	if err != nil || len(frame) == 0 {
+		return frame, err
+	}
+
+	// Iterate from the newest message and keep the first one of each partition
+	frame.Sort()
+	seen := make(map[string]bool, len(frame))
+	compacted := make(message.Frame, 0, len(frame))
+	for i := len(frame) - 1; i >= 0; i-- {
+		if key, ok := s.partitionOf(&frame[i]); ok {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		compacted = append(compacted, frame[i])
+	}
+
+	compacted.Limit(limit)
+	return compacted, nil
+}
+
+// OnSurvey handles an incoming cluster lookup request, if the underlying storage does.
+func (s *Compacted) OnSurvey(surveyType string, payload []byte) ([]byte, bool) {
+	if surveyee, ok := s.Storage.(service.Surveyee); ok {
+		return surveyee.OnSurvey(surveyType, payload)
+	}
+	return nil, false
+}
+
+// depthOf returns the number of segments of the partition of a channel or zero if the
+// channel is not a last-value channel.
+func (s *Compacted) depthOf(channel []byte) int {
+	segments := security.SplitChannel(string(channel))
+	for _, pattern := range s.patterns {
+		if pattern.Match(segments) {
+			return len(pattern)
+		}
+	}
+	return 0
+}
+
+// partitionOf returns the partition key of a message on a last-value channel.
+func (s *Compacted) partitionOf(m *message.Message) (string, bool) {
+	depth := s.depthOf(m.Channel)
+	if depth == 0 {
+		return "", false
+	}
+
+	return m.Ssid()[:depth+1].Encode(), true
+}
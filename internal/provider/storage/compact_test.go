@@ -0,0 +1,119 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/stretchr/testify/assert"
+)
+
+// newChannelMessage creates a message on a channel, published after the specified delay.
+func newChannelMessage(channel string, delay int64, payload string) *message.Message {
+	ssid := message.NewSsid(1, security.ParseChannel([]byte("key/"+channel)).Query)
+	msg := message.New(ssid, []byte(channel), []byte(payload))
+	msg.TTL = 1000
+	msg.ID.SetTime(msg.ID.Time() + delay)
+	return msg
+}
+
+func TestCompacted_Store(t *testing.T) {
+	s := NewCompacted(NewInMemory(nil), "devices/+/state/, ")
+	assert.NoError(t, s.Configure(nil))
+	defer s.Close()
+
+	// Store a few versions of the state of two devices, as well as a regular channel
+	for i := int64(0); i < 5; i++ {
+		assert.NoError(t, s.Store(newChannelMessage("devices/1/state/", i, fmt.Sprintf("1.%d", i))))
+		assert.NoError(t, s.Store(newChannelMessage("devices/2/state/", i, fmt.Sprintf("2.%d", i))))
+		assert.NoError(t, s.Store(newChannelMessage("devices/1/log/", i, fmt.Sprintf("log.%d", i))))
+	}
+
+	// The underlying storage only retains the newest message of each device
+	zero := time.Unix(0, 0)
+	ssid := message.NewSsid(1, security.ParseChannel([]byte("key/devices/")).Query)
+	f, err := s.Storage.Query(ssid, zero, zero, 100)
+	assert.NoError(t, err)
+	assert.Len(t, f, 7)
+
+	// The compacted history returns the newest message of each partition
+	f, err = s.Query(ssid, zero, zero, 3)
+	assert.NoError(t, err)
+	assert.Len(t, f, 3)
+	var payloads []string
+	for _, m := range f {
+		payloads = append(payloads, string(m.Payload))
+	}
+	assert.ElementsMatch(t, []string{"1.4", "2.4", "log.4"}, payloads)
+}
+
+func TestCompacted_Query(t *testing.T) {
+	store := NewInMemory(nil)
+	assert.NoError(t, store.Configure(nil))
+	defer store.Close()
+
+	// Store directly in the underlying storage, as other nodes would
+	for i := int64(0); i < 3; i++ {
+		assert.NoError(t, store.Store(newChannelMessage("devices/1/state/", i, fmt.Sprintf("1.%d", i))))
+		assert.NoError(t, store.Store(newChannelMessage("devices/1/state/battery/", i, fmt.Sprintf("b.%d", i))))
+		assert.NoError(t, store.Store(newChannelMessage("devices/1/log/", i, fmt.Sprintf("log.%d", i))))
+	}
+
+	s := NewCompacted(store, "devices/+/state/")
+	zero := time.Unix(0, 0)
+	ssid := message.NewSsid(1, security.ParseChannel([]byte("key/devices/1/")).Query)
+	f, err := s.Query(ssid, zero, zero, 10)
+	assert.NoError(t, err)
+	assert.Len(t, f, 4)
+
+	// The partition is the part of the channel matched by the pattern
+	var state int
+	for _, m := range f {
+		if string(m.Channel) != "devices/1/log/" {
+			state++
+		}
+	}
+	assert.Equal(t, 1, state)
+}
+
+func TestCompacted_depthOf(t *testing.T) {
+	s := NewCompacted(nil, "devices/+/state/,a%2Fb/")
+	tests := []struct {
+		channel string
+		depth   int
+	}{
+		{channel: "devices/1/state/", depth: 3},
+		{channel: "devices/1/state/battery/", depth: 3},
+		{channel: "devices/1/", depth: 0},
+		{channel: "a%2fb/c/", depth: 1},
+		{channel: "other/", depth: 0},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.depth, s.depthOf([]byte(tc.channel)), tc.channel)
+	}
+}
+
+func TestCompacted_OnSurvey(t *testing.T) {
+	_, ok := NewCompacted(NewNoop(), "a/").OnSurvey("ssdstore", nil)
+	assert.False(t, ok)
+
+	_, ok = NewCompacted(NewInMemory(nil), "a/").OnSurvey("other", nil)
+	assert.False(t, ok)
+}
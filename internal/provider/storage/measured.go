@@ -0,0 +1,87 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/emitter-io/stats"
+)
+
+// Measured implements Storage contract.
+var _ Storage = new(Measured)
+
+// Measured represents a storage which measures the latency of the operations of the
+// underlying storage, along with the number of its errors and of the bytes it stored.
+type Measured struct {
+	Storage                 // The underlying storage.
+	written  int64          // The number of bytes of the payloads stored.
+	measurer stats.Measurer // The measurer to use.
+}
+
+// NewMeasured creates a new storage measuring the operations of the underlying storage.
+func NewMeasured(store Storage, measurer stats.Measurer) *Measured {
+	return &Measured{
+		Storage:  store,
+		measurer: measurer,
+	}
+}
+
+// Store stores the message and measures the latency of the write.
+func (s *Measured) Store(m *message.Message) error {
+	defer s.measurer.MeasureElapsed("store.write", time.Now())
+	err := s.measure(s.Storage.Store(m))
+	if err == nil {
+		atomic.AddInt64(&s.written, m.Size())
+	}
+	return err
+}
+
+// Written returns the number of bytes of the payloads stored so far.
+func (s *Measured) Written() int64 {
+	return atomic.LoadInt64(&s.written)
+}
+
+// Query queries the messages and measures the latency of the query.
+func (s *Measured) Query(ssid message.Ssid, from, until time.Time, limit int) (message.Frame, error) {
+	defer s.measurer.MeasureElapsed("store.query", time.Now())
+	frame, err := s.Storage.Query(ssid, from, until, limit)
+	return frame, s.measure(err)
+}
+
+// Delete removes the messages and measures the latency of the removal.
+func (s *Measured) Delete(ssid message.Ssid, from, until time.Time) error {
+	defer s.measurer.MeasureElapsed("store.delete", time.Now())
+	return s.measure(s.Storage.Delete(ssid, from, until))
+}
+
+// OnSurvey handles an incoming cluster lookup request, if the underlying storage does.
+func (s *Measured) OnSurvey(surveyType string, payload []byte) ([]byte, bool) {
+	if surveyee, ok := s.Storage.(service.Surveyee); ok {
+		return surveyee.OnSurvey(surveyType, payload)
+	}
+	return nil, false
+}
+
+// measure counts the error of an operation, if any.
+func (s *Measured) measure(err error) error {
+	if err != nil {
+		s.measurer.Measure("error.store", 1)
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingStorage struct {
+	Noop
+}
+
+func (s *failingStorage) Store(m *message.Message) error {
+	return errors.New("failed")
+}
+
+func TestMeasured(t *testing.T) {
+	m := stats.New()
+	zero := time.Unix(0, 0)
+
+	s := NewMeasured(NewNoop(), m)
+	assert.NoError(t, s.Store(newChannelMessage("a/", 0, "hi")))
+	_, err := s.Query(message.Ssid{1}, zero, zero, 10)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Delete(message.Ssid{1}, zero, zero))
+	assert.Equal(t, int64(2), s.Written())
+
+	s = NewMeasured(new(failingStorage), m)
+	assert.Error(t, s.Store(newChannelMessage("a/", 0, "hi")))
+	assert.Zero(t, s.Written())
+
+	snapshots, err := stats.Restore(m.Snapshot())
+	assert.NoError(t, err)
+	metrics := snapshots.ToMap()
+	assert.Equal(t, int32(2), metrics["store.write"].Amount)
+	assert.Equal(t, int32(1), metrics["store.query"].Amount)
+	assert.Equal(t, int32(1), metrics["store.delete"].Amount)
+	assert.Equal(t, int32(1), metrics["error.store"].Amount)
+}
@@ -15,11 +15,7 @@
 package storage
 
 import (
-	"context"
-	"time"
-
 	"github.com/dgraph-io/badger/v3"
-	"github.com/emitter-io/emitter/internal/async"
 	"github.com/emitter-io/emitter/internal/service"
 )
 
@@ -57,9 +53,14 @@ func (s *InMemory) Configure(config map[string]interface{}) error {
 		return err
 	}
 
-	// Setup the database and start GC
+	// Setup the database, expired messages are dropped by the compactions
 	s.db = db
 	s.retain = configUint32(config, "retain", defaultRetain)
-	s.cancel = async.Repeat(context.Background(), 30*time.Minute, s.GC)
 	return err
 }
+
+// GC runs the garbage collection on the storage. There is no value log to collect
+// in memory, so this does nothing.
+func (s *InMemory) GC() error {
+	return nil
+}
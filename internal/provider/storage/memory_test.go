@@ -32,6 +32,10 @@ func (a *mockAwaiter) Gather(timeout time.Duration) (r [][]byte) {
 	return a.f(timeout)
 }
 
+func (a *mockAwaiter) Expected() int {
+	return 1
+}
+
 type testStorageConfig struct {
 	Provider string                 `json:"provider"`
 	Config   map[string]interface{} `json:"config,omitempty"`
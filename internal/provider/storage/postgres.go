@@ -0,0 +1,238 @@
+//go:build !nopostgres
+// +build !nopostgres
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultPostgresTable      = "emitter_message" // The default table to store the messages in.
+	defaultPostgresPartitions = 16                // The default number of hash partitions.
+)
+
+var (
+	errInvalidTable = errors.New("the table name must be a valid, unquoted identifier")
+	validTable      = regexp.MustCompile("^[a-z_][a-z0-9_]{0,47}$")
+)
+
+func init() {
+	Register("postgres", func(service.Surveyor) Storage { return NewPostgres() })
+}
+
+// ------------------------------------------------------------------------------------
+
+// Postgres implements Storage contract.
+var _ Storage = new(Postgres)
+
+// Postgres represents a storage which keeps the messages in a PostgreSQL database. Since
+// the database is shared by all of the nodes, the queries do not need to be surveyed.
+type Postgres struct {
+	retain uint32             // The configured TTL for 'retained' messages.
+	table  string             // The name of the table to use.
+	db     *sql.DB            // The underlying database to use for messages.
+	cancel context.CancelFunc // The cancellation function.
+}
+
+// NewPostgres creates a new PostgreSQL storage.
+func NewPostgres() *Postgres {
+	return new(Postgres)
+}
+
+// Name returns the name of the provider.
+func (s *Postgres) Name() string {
+	return "postgres"
+}
+
+// Configure configures the storage. The config parameter provided is
+// loosely typed, since various storage mechanisms will require different
+// configurations.
+func (s *Postgres) Configure(config map[string]interface{}) error {
+	s.table = configString(config, "table", defaultPostgresTable)
+	if !validTable.MatchString(s.table) {
+		return errInvalidTable
+	}
+
+	// Attempt to open and ping the database
+	db, err := sql.Open("postgres", configString(config, "connection", ""))
+	if err != nil {
+		return err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+
+	// Create the schema, if it does not exist yet
+	partitions := configUint32(config, "partitions", defaultPostgresPartitions)
+	for _, stmt := range postgresSchema(s.table, int(partitions)) {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return err
+		}
+	}
+
+	// Setup the database and start the cleanup of expired messages
+	s.db = db
+	s.retain = configUint32(config, "retain", defaultRetain)
+	s.cancel = async.Repeat(context.Background(), 5*time.Minute, s.collect)
+	return nil
+}
+
+// postgresSchema returns the statements creating the table, hash partitioned by the
+// prefix of the SSID (contract and first part of the channel). The rows are keyed by
+// that prefix and the message ID, which sorts the messages from the most recent one.
+func postgresSchema(table string, partitions int) []string {
+	stmts := []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		prefix  BIGINT NOT NULL,
+		id      BYTEA  NOT NULL,
+		ts      BIGINT NOT NULL,
+		expires BIGINT NOT NULL,
+		value   BYTEA  NOT NULL,
+		PRIMARY KEY (prefix, id)
+	) PARTITION BY HASH (prefix)`, table)}
+
+	for i := 0; i < partitions; i++ {
+		stmts = append(stmts, fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s_%d PARTITION OF %s FOR VALUES WITH (MODULUS %d, REMAINDER %d)",
+			table, i, table, partitions, i))
+	}
+
+	return append(stmts,
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_ts ON %s (prefix, ts)", table, table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expires ON %s (expires)", table, table),
+	)
+}
+
+// Store appends the messages to the store.
+func (s *Postgres) Store(m *message.Message) error {
+	_, err := s.db.Exec(fmt.Sprintf(
+		"INSERT INTO %s (prefix, id, ts, expires, value) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING", s.table),
+		prefixOf(m.ID), []byte(m.ID), m.ID.Time(), expiresOf(m, s.retain).Unix(), m.Encode())
+	return err
+}
+
+// Query performs a query and attempts to fetch last n messages where
+// n is specified by limit argument. From and until times can also be specified
+// for time-series retrieval.
+func (s *Postgres) Query(ssid message.Ssid, from, until time.Time, limit int) (message.Frame, error) {
+	if len(ssid) < 2 {
+		return nil, errInvalidSsid
+	}
+
+	t0, t1 := window(from, until)
+	rows, err := s.db.Query(fmt.Sprintf(
+		"SELECT id, value FROM %s WHERE prefix = $1 AND ts >= $2 AND ts <= $3 AND expires > $4 ORDER BY id", s.table),
+		int64(ssid[0]^ssid[1]), t0, t1, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	// Match the rest of the SSID, since only the prefix is indexed
+	defer rows.Close()
+	match := make(message.Frame, 0, limit)
+	for rows.Next() && len(match) < limit {
+		var id, value []byte
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+
+		if message.ID(id).Match(ssid, t0, t1) {
+			if msg, err := message.DecodeMessage(value); err == nil {
+				match = append(match, msg)
+			}
+		}
+	}
+
+	match.Limit(limit)
+	return match, rows.Err()
+}
+
+// Delete removes the messages matching the SSID within the time window.
+func (s *Postgres) Delete(ssid message.Ssid, from, until time.Time) error {
+	if len(ssid) < 2 {
+		return errInvalidSsid
+	}
+
+	t0, t1 := window(from, until)
+	rows, err := s.db.Query(fmt.Sprintf(
+		"SELECT id FROM %s WHERE prefix = $1 AND ts >= $2 AND ts <= $3", s.table),
+		int64(ssid[0]^ssid[1]), t0, t1)
+	if err != nil {
+		return err
+	}
+
+	// Collect the keys of the messages to remove
+	defer rows.Close()
+	var keys pq.ByteaArray
+	for rows.Next() {
+		var id []byte
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+
+		if message.ID(id).Match(ssid, t0, t1) {
+			keys = append(keys, id)
+		}
+	}
+
+	if err := rows.Err(); err != nil || len(keys) == 0 {
+		return err
+	}
+
+	_, err = s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE prefix = $1 AND id = ANY($2)", s.table),
+		int64(ssid[0]^ssid[1]), keys)
+	return err
+}
+
+// GC runs the garbage collection, removing the expired messages.
+func (s *Postgres) GC() error {
+	_, err := s.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expires <= $1", s.table), time.Now().Unix())
+	return err
+}
+
+// collect periodically runs the garbage collection.
+func (s *Postgres) collect() {
+	if err := s.GC(); err != nil {
+		logging.LogError("postgres", "garbage collection", err)
+	}
+}
+
+// Close is used to gracefully close the connection.
+func (s *Postgres) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,111 @@
+//go:build !nopostgres
+// +build !nopostgres
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+// Opens a Postgres storage and runs a test on it. This requires a database, specified
+// by the EMITTER_TEST_POSTGRES connection string, otherwise the test is skipped.
+func runPostgresTest(t *testing.T, test func(store *Postgres)) {
+	conn := os.Getenv("EMITTER_TEST_POSTGRES")
+	if conn == "" {
+		t.Skip("EMITTER_TEST_POSTGRES is not set")
+	}
+
+	store := NewPostgres()
+	assert.NoError(t, store.Configure(map[string]interface{}{
+		"connection": conn,
+		"table":      "emitter_test",
+		"partitions": float64(4),
+	}))
+
+	defer store.Close()
+	defer store.db.Exec("DROP TABLE emitter_test")
+	test(store)
+}
+
+func TestPostgres_Name(t *testing.T) {
+	s := NewPostgres()
+	assert.Equal(t, "postgres", s.Name())
+	assert.NoError(t, s.Close())
+}
+
+func TestPostgres_ConfigureInvalid(t *testing.T) {
+	tests := []struct {
+		config map[string]interface{}
+		err    error
+	}{
+		{config: map[string]interface{}{"table": "messages; DROP TABLE x"}, err: errInvalidTable},
+		{config: map[string]interface{}{"table": "Messages"}, err: errInvalidTable},
+		{config: map[string]interface{}{"connection": "host=127.0.0.1 port=1 connect_timeout=1 sslmode=disable"}},
+	}
+
+	for _, tc := range tests {
+		err := NewPostgres().Configure(tc.config)
+		assert.Error(t, err)
+		if tc.err != nil {
+			assert.Equal(t, tc.err, err)
+		}
+	}
+}
+
+func TestPostgres_Schema(t *testing.T) {
+	stmts := postgresSchema("msg", 2)
+	assert.Len(t, stmts, 5)
+	assert.Contains(t, stmts[0], "CREATE TABLE IF NOT EXISTS msg (")
+	assert.Contains(t, stmts[0], "PARTITION BY HASH (prefix)")
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS msg_1 PARTITION OF msg FOR VALUES WITH (MODULUS 2, REMAINDER 1)", stmts[2])
+}
+
+func TestPostgres_QueryOrdered(t *testing.T) {
+	runPostgresTest(t, func(store *Postgres) {
+		testOrder(t, store)
+	})
+}
+
+func TestPostgres_QueryRetained(t *testing.T) {
+	runPostgresTest(t, func(store *Postgres) {
+		testRetained(t, store)
+	})
+}
+
+func TestPostgres_QueryRange(t *testing.T) {
+	runPostgresTest(t, func(store *Postgres) {
+		testRange(t, store)
+	})
+}
+
+func TestPostgres_Delete(t *testing.T) {
+	runPostgresTest(t, func(store *Postgres) {
+		testOrder(t, store)
+
+		zero := time.Unix(0, 0)
+		assert.NoError(t, store.Delete(message.Ssid{0, 1}, zero, zero))
+		f, err := store.Query(message.Ssid{0, 1, 2}, zero, zero, 5)
+		assert.NoError(t, err)
+		assert.Len(t, f, 0)
+		assert.NoError(t, store.GC())
+	})
+}
@@ -0,0 +1,418 @@
+//go:build !noredis
+// +build !noredis
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/emitter-io/emitter/internal/service/presence"
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	defaultRedisAddress   = "redis://127.0.0.1:6379" // The default address of the server.
+	defaultRedisPrefix    = "emitter"                // The default prefix of the keys.
+	defaultRedisMaxIdle   = 8                        // The default number of idle connections kept.
+	defaultRedisMaxActive = 64                       // The default maximum number of connections.
+	redisNodeTTL          = 30                       // The number of seconds a node stays alive without heartbeat.
+)
+
+func init() {
+	Register("redis", func(service.Surveyor) Storage { return NewRedis() })
+}
+
+// ------------------------------------------------------------------------------------
+
+// Redis implements Storage contract.
+var _ Storage = new(Redis)
+var _ presence.CacheProvider = new(Redis)
+
+// Redis represents a storage which keeps the messages in a Redis server. Each message is
+// kept under its own key, which expires natively, and indexed by time in a sorted set per
+// contract and first part of the channel. Since the server is shared by all of the nodes,
+// the queries do not need to be surveyed and it can also be used to cache the presence.
+type Redis struct {
+	retain   uint32             // The configured TTL for 'retained' messages.
+	prefix   string             // The prefix of all of the keys.
+	node     string             // The unique identifier of this node, for the presence.
+	presence bool               // Whether the presence is cached.
+	pool     *redis.Pool        // The pool of connections to the server.
+	cancel   context.CancelFunc // The cancellation function.
+}
+
+// NewRedis creates a new Redis storage.
+func NewRedis() *Redis {
+	return new(Redis)
+}
+
+// Name returns the name of the provider.
+func (s *Redis) Name() string {
+	return "redis"
+}
+
+// Configure configures the storage. The config parameter provided is
+// loosely typed, since various storage mechanisms will require different
+// configurations.
+func (s *Redis) Configure(config map[string]interface{}) error {
+	address := configString(config, "address", defaultRedisAddress)
+	s.pool = &redis.Pool{
+		MaxIdle:     int(configUint32(config, "maxIdle", defaultRedisMaxIdle)),
+		MaxActive:   int(configUint32(config, "maxActive", defaultRedisMaxActive)),
+		IdleTimeout: 4 * time.Minute,
+		Wait:        true,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(address, redis.DialConnectTimeout(5*time.Second))
+		},
+		TestOnBorrow: func(c redis.Conn, idle time.Time) error {
+			if time.Since(idle) < time.Minute {
+				return nil
+			}
+
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+
+	// Make sure the server is reachable
+	conn := s.pool.Get()
+	_, err := conn.Do("PING")
+	conn.Close()
+	if err != nil {
+		s.pool.Close()
+		return err
+	}
+
+	s.prefix = configString(config, "prefix", defaultRedisPrefix)
+	s.retain = configUint32(config, "retain", defaultRetain)
+	s.presence = configBool(config, "presence", false)
+	s.node = newNodeID()
+
+	// Start the cleanup of expired messages and, if the presence is cached, advertise
+	// that this node is alive so its presence entries are kept.
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	async.Repeat(ctx, 5*time.Minute, s.collect)
+	if s.presence {
+		async.Repeat(ctx, redisNodeTTL*time.Second/3, s.heartbeat)
+	}
+	return nil
+}
+
+// Store appends the messages to the store.
+func (s *Redis) Store(m *message.Message) error {
+	// The message has already expired, no need to store it
+	expires := expiresOf(m, s.retain)
+	ttl := expires.Unix() - time.Now().Unix()
+	if ttl <= 0 {
+		return nil
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	// Pipeline the message, its index and its expiration
+	conn.Send("SET", s.keyOf(m.ID), m.Encode(), "EX", ttl)
+	conn.Send("ZADD", s.indexOf(prefixOf(m.ID)), m.ID.Time(), []byte(m.ID))
+	conn.Send("ZADD", s.expiryKey(), expires.Unix(), []byte(m.ID))
+	_, err := conn.Do("")
+	return err
+}
+
+// Query performs a query and attempts to fetch last n messages where
+// n is specified by limit argument. From and until times can also be specified
+// for time-series retrieval.
+func (s *Redis) Query(ssid message.Ssid, from, until time.Time, limit int) (message.Frame, error) {
+	if len(ssid) < 2 {
+		return nil, errInvalidSsid
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	ids, err := s.lookup(conn, ssid, from, until)
+	if err != nil || len(ids) == 0 {
+		return message.Frame{}, err
+	}
+
+	// Fetch the most recent messages at once
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	keys := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, s.keyOf(id))
+	}
+
+	values, err := redis.ByteSlices(conn.Do("MGET", keys...))
+	if err != nil {
+		return nil, err
+	}
+
+	// The messages which have expired in the meantime are skipped
+	match := make(message.Frame, 0, len(values))
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+
+		if msg, err := message.DecodeMessage(value); err == nil {
+			match = append(match, msg)
+		}
+	}
+
+	match.Limit(limit)
+	return match, nil
+}
+
+// Delete removes the messages matching the SSID within the time window.
+func (s *Redis) Delete(ssid message.Ssid, from, until time.Time) error {
+	if len(ssid) < 2 {
+		return errInvalidSsid
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	ids, err := s.lookup(conn, ssid, from, until)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	// Pipeline the removal of the messages and of their index
+	index := s.indexOf(int64(ssid[0] ^ ssid[1]))
+	for _, id := range ids {
+		conn.Send("DEL", s.keyOf(id))
+		conn.Send("ZREM", index, []byte(id))
+		conn.Send("ZREM", s.expiryKey(), []byte(id))
+	}
+
+	_, err = conn.Do("")
+	return err
+}
+
+// GC runs the garbage collection, removing the expired messages from the indexes. The
+// messages themselves are expired by the server.
+func (s *Redis) GC() error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	now := time.Now().Unix()
+	expired, err := redis.ByteSlices(conn.Do("ZRANGEBYSCORE", s.expiryKey(), "-inf", now))
+	if err != nil || len(expired) == 0 {
+		return err
+	}
+
+	for _, id := range expired {
+		if len(id) >= 4 {
+			conn.Send("ZREM", s.indexOf(prefixOf(id)), id)
+		}
+	}
+
+	conn.Send("ZREMRANGEBYSCORE", s.expiryKey(), "-inf", now)
+	_, err = conn.Do("")
+	return err
+}
+
+// collect periodically runs the garbage collection.
+func (s *Redis) collect() {
+	if err := s.GC(); err != nil {
+		logging.LogError("redis", "garbage collection", err)
+	}
+}
+
+// lookup returns the IDs of the messages matching the SSID within the time window,
+// starting from the most recent one.
+func (s *Redis) lookup(conn redis.Conn, ssid message.Ssid, from, until time.Time) ([]message.ID, error) {
+	t0, t1 := window(from, until)
+	members, err := redis.ByteSlices(conn.Do("ZREVRANGEBYSCORE", s.indexOf(int64(ssid[0]^ssid[1])), t1, t0))
+	if err != nil {
+		return nil, err
+	}
+
+	// Match the rest of the SSID, since only the prefix is indexed
+	ids := make([]message.ID, 0, len(members))
+	for _, member := range members {
+		if id := message.ID(member); id.Match(ssid, t0, t1) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Close is used to gracefully close the connection.
+func (s *Redis) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	if s.pool == nil {
+		return nil
+	}
+
+	// Let the other nodes know right away that our presence is gone
+	if s.presence {
+		conn := s.pool.Get()
+		conn.Do("DEL", s.nodeKey(s.node))
+		conn.Close()
+	}
+	return s.pool.Close()
+}
+
+// keyOf returns the key of a message.
+func (s *Redis) keyOf(id message.ID) string {
+	return s.prefix + ":m:" + hex.EncodeToString(id)
+}
+
+// indexOf returns the key of the index of the messages sharing the prefix.
+func (s *Redis) indexOf(prefix int64) string {
+	return fmt.Sprintf("%s:i:%d", s.prefix, prefix)
+}
+
+// expiryKey returns the key of the index of the message expirations.
+func (s *Redis) expiryKey() string {
+	return s.prefix + ":expiry"
+}
+
+// ------------------------------------------------------------------------------------
+
+// Presence returns the presence cache, if the storage is configured to cache it.
+func (s *Redis) Presence() presence.Cache {
+	if !s.presence {
+		return nil
+	}
+	return &redisPresence{s}
+}
+
+// heartbeat advertises that the node is alive, so its presence entries are kept.
+func (s *Redis) heartbeat() {
+	conn := s.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("SET", s.nodeKey(s.node), 1, "EX", redisNodeTTL); err != nil {
+		logging.LogError("redis", "presence heartbeat", err)
+	}
+}
+
+// nodeKey returns the key advertising that a node is alive.
+func (s *Redis) nodeKey(node string) string {
+	return s.prefix + ":n:" + node
+}
+
+// presenceOf returns the key of the hash which contains the subscribers of a channel.
+func (s *Redis) presenceOf(ssid message.Ssid) string {
+	return s.prefix + ":p:" + ssid.Encode()
+}
+
+// redisPresence represents a presence cache which keeps, for every channel, a hash of the
+// subscribers keyed by the node they are connected to and their ID, along with their
+// username followed by their metadata.
+type redisPresence struct {
+	*Redis
+}
+
+// Track records the presence of a local subscriber.
+func (s *redisPresence) Track(ssid message.Ssid, who presence.Info, present bool) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	field := s.node + "/" + who.ID
+	if present {
+		_, err := conn.Do("HSET", s.presenceOf(ssid), field, presence.JoinUsername(who.Username, who.Meta))
+		return err
+	}
+
+	_, err := conn.Do("HDEL", s.presenceOf(ssid), field)
+	return err
+}
+
+// Lookup returns the subscribers of the other nodes which are still alive.
+func (s *redisPresence) Lookup(ssid message.Ssid) ([]presence.Info, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	key := s.presenceOf(ssid)
+	entries, err := redis.StringMap(conn.Do("HGETALL", key))
+	if err != nil {
+		return nil, err
+	}
+
+	// Pipeline the check of the nodes the subscribers are connected to
+	alive := make(map[string]bool)
+	nodes := make([]string, 0, 4)
+	for field := range entries {
+		node, _ := splitPresence(field)
+		if _, ok := alive[node]; !ok && node != s.node {
+			alive[node] = false
+			nodes = append(nodes, node)
+			conn.Send("EXISTS", s.nodeKey(node))
+		}
+	}
+
+	if len(nodes) > 0 {
+		if err := conn.Flush(); err != nil {
+			return nil, err
+		}
+
+		for _, node := range nodes {
+			if alive[node], err = redis.Bool(conn.Receive()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	who := make([]presence.Info, 0, len(entries))
+	gone := []interface{}{key}
+	for field, value := range entries {
+		switch node, id := splitPresence(field); {
+		case node == s.node:
+			continue
+		case alive[node]:
+			username, meta := presence.SplitUsername(value)
+			who = append(who, presence.Info{ID: id, Username: username, Meta: meta})
+		default:
+			gone = append(gone, field)
+		}
+	}
+
+	// Remove the subscribers of the nodes which are gone
+	if len(gone) > 1 {
+		if _, err := conn.Do("HDEL", gone...); err != nil {
+			logging.LogError("redis", "presence cleanup", err)
+		}
+	}
+
+	sort.Slice(who, func(i, j int) bool { return who[i].ID < who[j].ID })
+	return who, nil
+}
+
+// splitPresence splits the field of a presence entry into the node and the subscriber ID.
+func splitPresence(field string) (node, id string) {
+	if i := strings.IndexByte(field, '/'); i >= 0 {
+		return field[:i], field[i+1:]
+	}
+	return field, ""
+}
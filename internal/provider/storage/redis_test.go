@@ -0,0 +1,153 @@
+//go:build !noredis
+// +build !noredis
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/service/presence"
+	"github.com/stretchr/testify/assert"
+)
+
+// Opens a Redis storage and runs a test on it. This requires a server, specified by the
+// EMITTER_TEST_REDIS address, otherwise the test is skipped.
+func runRedisTest(t *testing.T, test func(store *Redis)) {
+	address := os.Getenv("EMITTER_TEST_REDIS")
+	if address == "" {
+		t.Skip("EMITTER_TEST_REDIS is not set")
+	}
+
+	store := NewRedis()
+	assert.NoError(t, store.Configure(map[string]interface{}{
+		"address":  address,
+		"prefix":   "emitter-test-" + newNodeID(),
+		"presence": true,
+	}))
+
+	defer store.Close()
+	test(store)
+}
+
+func TestRedis_Name(t *testing.T) {
+	s := NewRedis()
+	assert.Equal(t, "redis", s.Name())
+	assert.Nil(t, s.Presence())
+	assert.NoError(t, s.Close())
+}
+
+func TestRedis_ConfigureInvalid(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"address": "redis://127.0.0.1:1"},
+		{"address": "http://127.0.0.1"},
+	}
+
+	for _, tc := range tests {
+		assert.Error(t, NewRedis().Configure(tc))
+	}
+}
+
+func TestRedis_Keys(t *testing.T) {
+	s := &Redis{prefix: "x"}
+	id := message.ID{0, 0, 0, 1, 0xff}
+	assert.Equal(t, "x:m:00000001ff", s.keyOf(id))
+	assert.Equal(t, "x:i:1", s.indexOf(prefixOf(id)))
+	assert.Equal(t, "x:expiry", s.expiryKey())
+	assert.Equal(t, "x:n:a", s.nodeKey("a"))
+	assert.Equal(t, "x:p:"+message.Ssid{1, 2}.Encode(), s.presenceOf(message.Ssid{1, 2}))
+}
+
+func TestRedis_splitPresence(t *testing.T) {
+	tests := []struct {
+		field string
+		node  string
+		id    string
+	}{
+		{field: "a/b", node: "a", id: "b"},
+		{field: "a/b/c", node: "a", id: "b/c"},
+		{field: "a", node: "a", id: ""},
+	}
+
+	for _, tc := range tests {
+		node, id := splitPresence(tc.field)
+		assert.Equal(t, tc.node, node)
+		assert.Equal(t, tc.id, id)
+	}
+}
+
+func TestRedis_QueryOrdered(t *testing.T) {
+	runRedisTest(t, func(store *Redis) {
+		testOrder(t, store)
+	})
+}
+
+func TestRedis_QueryRetained(t *testing.T) {
+	runRedisTest(t, func(store *Redis) {
+		testRetained(t, store)
+	})
+}
+
+func TestRedis_QueryRange(t *testing.T) {
+	runRedisTest(t, func(store *Redis) {
+		testRange(t, store)
+	})
+}
+
+func TestRedis_Delete(t *testing.T) {
+	runRedisTest(t, func(store *Redis) {
+		testOrder(t, store)
+
+		zero := time.Unix(0, 0)
+		assert.NoError(t, store.Delete(message.Ssid{0, 1}, zero, zero))
+		f, err := store.Query(message.Ssid{0, 1, 2}, zero, zero, 5)
+		assert.NoError(t, err)
+		assert.Len(t, f, 0)
+		assert.NoError(t, store.GC())
+	})
+}
+
+func TestRedis_Presence(t *testing.T) {
+	runRedisTest(t, func(store *Redis) {
+		remote := &Redis{
+			prefix:   store.prefix,
+			pool:     store.pool,
+			node:     newNodeID(),
+			presence: true,
+		}
+
+		ssid := message.Ssid{1, 2, 3}
+		remote.heartbeat()
+		assert.NoError(t, remote.Presence().Track(ssid, presence.Info{ID: "b", Username: "bob", Meta: map[string]string{"status": "away"}}, true))
+		assert.NoError(t, store.Presence().Track(ssid, presence.Info{ID: "a"}, true))
+
+		// Only the subscribers of the other nodes are returned
+		who, err := store.Presence().Lookup(ssid)
+		assert.NoError(t, err)
+		assert.Equal(t, []presence.Info{{ID: "b", Username: "bob", Meta: map[string]string{"status": "away"}}}, who)
+
+		// Once the other node is gone, so are its subscribers
+		conn := store.pool.Get()
+		conn.Do("DEL", remote.nodeKey(remote.node))
+		conn.Close()
+		who, err = store.Presence().Lookup(ssid)
+		assert.NoError(t, err)
+		assert.Empty(t, who)
+	})
+}
@@ -0,0 +1,77 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/emitter-io/config"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+// Factory creates a new, unconfigured instance of a storage backend. The surveyor
+// provided can be used by the backend to query the other nodes of the cluster.
+type Factory func(survey service.Surveyor) Storage
+
+// The registry of the storage backends, by name.
+var registry = struct {
+	sync.Mutex
+	factories map[string]Factory
+}{
+	factories: make(map[string]Factory),
+}
+
+func init() {
+	Register("noop", func(service.Surveyor) Storage { return NewNoop() })
+	Register("inmemory", func(survey service.Surveyor) Storage { return NewInMemory(survey) })
+	Register("ssd", func(survey service.Surveyor) Storage { return NewSSD(survey) })
+}
+
+// Register registers a storage backend so it can be selected by its name through the
+// "storage.provider" configuration. This is typically called from an init() function
+// of the package implementing the backend and replaces any backend of the same name.
+func Register(name string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.factories[name] = factory
+}
+
+// Registered checks whether a storage backend is registered under the name.
+func Registered(name string) bool {
+	registry.Lock()
+	defer registry.Unlock()
+	_, ok := registry.factories[name]
+	return ok
+}
+
+// Providers creates an instance of every registered storage backend, sorted by name, so
+// one of them can be loaded from the configuration.
+func Providers(survey service.Surveyor) []config.Provider {
+	registry.Lock()
+	defer registry.Unlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	providers := make([]config.Provider, 0, len(names))
+	for _, name := range names {
+		providers = append(providers, registry.factories[name](survey))
+	}
+	return providers
+}
@@ -0,0 +1,110 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/config"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+type customStore struct {
+	Noop
+}
+
+func (s *customStore) Name() string {
+	return "custom"
+}
+
+func TestRegistry_Providers(t *testing.T) {
+	Register("custom", func(service.Surveyor) Storage { return new(customStore) })
+	defer func() {
+		registry.Lock()
+		delete(registry.factories, "custom")
+		registry.Unlock()
+	}()
+
+	assert.True(t, Registered("custom"))
+	assert.True(t, Registered("ssd"))
+	assert.False(t, Registered("unknown"))
+
+	var names []string
+	for _, p := range Providers(nil) {
+		names = append(names, p.Name())
+	}
+	assert.True(t, sort.StringsAreSorted(names))
+	assert.Subset(t, names, []string{"custom", "inmemory", "noop", "ssd"})
+}
+
+func TestRegistry_Load(t *testing.T) {
+	tests := []struct {
+		provider string
+		expected string
+	}{
+		{provider: "", expected: "noop"},
+		{provider: "noop", expected: "noop"},
+		{provider: "inmemory", expected: "inmemory"},
+	}
+
+	for _, tc := range tests {
+		var cfg *config.ProviderConfig
+		if tc.provider != "" {
+			cfg = &config.ProviderConfig{Provider: tc.provider}
+		}
+
+		s := config.LoadProvider(cfg, append([]config.Provider{NewNoop()}, Providers(nil)...)...).(Storage)
+		assert.Equal(t, tc.expected, s.Name())
+		assert.NoError(t, s.Close())
+	}
+}
+
+func TestInMemory_Delete(t *testing.T) {
+	s := newTestMemStore()
+	defer s.Close()
+
+	zero := time.Unix(0, 0)
+	assert.Error(t, s.Delete(message.Ssid{0}, zero, zero))
+	assert.NoError(t, s.Delete(message.Ssid{0, 1, 2}, zero, zero))
+
+	f, err := s.Query(message.Ssid{0, 1}, zero, zero, 10)
+	assert.NoError(t, err)
+	assert.Len(t, f, 4)
+	for _, m := range f {
+		assert.NotEqual(t, uint32(2), m.Ssid()[2])
+	}
+
+	assert.NoError(t, s.Delete(message.Ssid{0, 1}, zero, zero))
+	f, err = s.Query(message.Ssid{0, 1}, zero, zero, 10)
+	assert.NoError(t, err)
+	assert.Len(t, f, 0)
+}
+
+func TestInMemory_GC(t *testing.T) {
+	s := newTestMemStore()
+	defer s.Close()
+	assert.NoError(t, s.GC())
+}
+
+func TestNoop_DeleteAndGC(t *testing.T) {
+	s := NewNoop()
+	zero := time.Unix(0, 0)
+	assert.NoError(t, s.Delete(message.Ssid{1}, zero, zero))
+	assert.NoError(t, s.GC())
+}
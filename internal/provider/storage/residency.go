@@ -0,0 +1,59 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+// Resident implements Storage contract.
+var _ Storage = new(Resident)
+
+// Resident represents a storage which enforces the data residency of the contracts, only
+// storing the messages of the contracts which are allowed to reside in its region. The
+// messages of the other contracts are still delivered, but never stored.
+type Resident struct {
+	Storage                     // The underlying storage.
+	contracts contract.Provider // The contracts with their placement.
+	region    string            // The region of this cluster.
+}
+
+// NewResident creates a new storage enforcing the data residency of the contracts.
+func NewResident(store Storage, contracts contract.Provider, region string) *Resident {
+	return &Resident{
+		Storage:   store,
+		contracts: contracts,
+		region:    region,
+	}
+}
+
+// Store stores the message, if its contract can reside in the region.
+func (s *Resident) Store(m *message.Message) error {
+	if c, ok := s.contracts.Get(m.Contract()); !ok || !c.Placement().Resides(s.region) {
+		return nil
+	}
+
+	return s.Storage.Store(m)
+}
+
+// OnSurvey handles an incoming cluster lookup request, if the underlying storage does.
+func (s *Resident) OnSurvey(surveyType string, payload []byte) ([]byte, bool) {
+	if surveyee, ok := s.Storage.(service.Surveyee); ok {
+		return surveyee.OnSurvey(surveyType, payload)
+	}
+	return nil, false
+}
@@ -0,0 +1,59 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	"github.com/emitter-io/emitter/internal/provider/contract/mock"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResident_Store(t *testing.T) {
+	tests := []struct {
+		found     bool
+		residency []string
+		expected  int
+	}{
+		{found: false, expected: 0},
+		{found: true, expected: 1},
+		{found: true, residency: []string{"eu", "ch"}, expected: 1},
+		{found: true, residency: []string{"us"}, expected: 0},
+	}
+
+	for _, tc := range tests {
+		store := NewInMemory(nil)
+		assert.NoError(t, store.Configure(nil))
+
+		c := new(mock.Contract)
+		c.On("Placement").Return(contract.Placement{Residency: tc.residency})
+		contracts := mock.NewContractProvider()
+		contracts.On("Get", uint32(1)).Return(c, tc.found)
+
+		s := NewResident(store, contracts, "eu")
+		assert.NoError(t, s.Store(newChannelMessage("logs/a/", 0, "hi")))
+
+		zero := time.Unix(0, 0)
+		ssid := message.NewSsid(1, security.ParseChannel([]byte("key/logs/")).Query)
+		f, err := s.Query(ssid, zero, zero, 100)
+		assert.NoError(t, err)
+		assert.Len(t, f, tc.expected)
+		assert.NoError(t, s.Close())
+	}
+}
@@ -0,0 +1,168 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+const (
+	maxRetentionScan = 10000 // The maximum number of messages scanned to enforce a size rule.
+)
+
+// Bounded implements Storage contract.
+var _ Storage = new(Bounded)
+
+// Bounded represents a storage which periodically enforces the retention rules of the
+// contracts, removing the messages which are older or exceed the count or the size the
+// contract allows to keep for a channel pattern. Since the history is spread across the
+// cluster, the limits are computed on the surveyed history and enforced on every node.
+type Bounded struct {
+	Storage                      // The underlying storage.
+	contracts contract.Lister    // The contracts with their retention rules.
+	cancel    context.CancelFunc // The cancellation function.
+}
+
+// NewBounded creates a new storage enforcing the retention rules of the contracts at the
+// specified interval.
+func NewBounded(store Storage, contracts contract.Lister, interval time.Duration) *Bounded {
+	s := &Bounded{
+		Storage:   store,
+		contracts: contracts,
+	}
+
+	s.cancel = async.Repeat(context.Background(), interval, func() {
+		if err := s.GC(); err != nil {
+			logging.LogError("storage", "enforce retention", err)
+		}
+	})
+	return s
+}
+
+// GC enforces the retention rules of the contracts and then runs the garbage collection
+// of the underlying storage.
+func (s *Bounded) GC() error {
+	s.contracts.Range(func(id uint32, c contract.Contract) bool {
+		for _, rule := range c.Retention() {
+			if err := s.enforce(id, rule); err != nil {
+				logging.LogError("storage", "enforce retention of "+rule.Channel, err)
+			}
+		}
+		return true
+	})
+
+	return s.Storage.GC()
+}
+
+// enforce removes the messages of a contract exceeding a retention rule.
+func (s *Bounded) enforce(id uint32, rule contract.Retention) error {
+	ssid, ok := ssidOf(id, rule.Channel)
+	if !ok {
+		return errInvalidSsid
+	}
+
+	// Everything older than the maximum age is removed
+	var cutoff int64
+	if rule.MaxAge > 0 {
+		cutoff = time.Now().Unix() - rule.MaxAge - 1
+	}
+
+	// Find the newest message exceeding the count or the size, scanning from the newest
+	if rule.MaxCount > 0 || rule.MaxBytes > 0 {
+		limit := maxRetentionScan
+		if rule.MaxBytes == 0 {
+			limit = rule.MaxCount + 1
+		}
+
+		zero := time.Unix(0, 0)
+		frame, err := s.Storage.Query(ssid, zero, zero, limit)
+		if err != nil {
+			return err
+		}
+
+		frame.Sort()
+		if until, ok := exceeding(frame, rule); ok && until > cutoff {
+			cutoff = until
+		}
+	}
+
+	if cutoff <= 0 {
+		return nil
+	}
+
+	return s.Storage.Delete(ssid, time.Unix(0, 0), time.Unix(cutoff, 0))
+}
+
+// OnSurvey handles an incoming cluster lookup request, if the underlying storage does.
+func (s *Bounded) OnSurvey(surveyType string, payload []byte) ([]byte, bool) {
+	if surveyee, ok := s.Storage.(service.Surveyee); ok {
+		return surveyee.OnSurvey(surveyType, payload)
+	}
+	return nil, false
+}
+
+// Close stops enforcing the retention rules and closes the underlying storage.
+func (s *Bounded) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	return s.Storage.Close()
+}
+
+// exceeding returns the time up to which the messages of a sorted frame exceed the count
+// or the size of a retention rule. Since the storage is removing messages at a second
+// resolution, the messages published within the same second as a message being kept
+// are kept as well.
+func exceeding(frame message.Frame, rule contract.Retention) (int64, bool) {
+	var size int64
+	for i := len(frame) - 1; i >= 0; i-- {
+		size += int64(len(frame[i].Payload))
+		count := len(frame) - i
+		if (rule.MaxCount > 0 && count > rule.MaxCount) || (rule.MaxBytes > 0 && size > rule.MaxBytes) {
+			until := frame[i].Time()
+			if i+1 < len(frame) && frame[i+1].Time() == until {
+				until--
+			}
+			return until, true
+		}
+	}
+	return 0, false
+}
+
+// ssidOf returns the SSID matching a channel pattern of a contract. The first part of the
+// pattern must be static, since the messages are stored by their contract and first part.
+func ssidOf(id uint32, pattern string) (message.Ssid, bool) {
+	parts := security.ParsePattern(pattern)
+	if len(parts) == 0 || parts[0] == "+" || parts[0] == "#" {
+		return nil, false
+	}
+
+	pattern = strings.Trim(pattern, "/")
+	channel := security.ParseChannel([]byte("key/" + pattern + "/"))
+	if channel.ChannelType == security.ChannelInvalid {
+		return nil, false
+	}
+	return message.NewSsid(id, channel.Query), true
+}
@@ -0,0 +1,139 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	"github.com/emitter-io/emitter/internal/provider/usage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/stretchr/testify/assert"
+)
+
+type testContract []contract.Retention
+
+func (c testContract) Validate(key security.Key) bool  { return true }
+func (c testContract) Stats() usage.Meter              { return usage.NewNoop().Get(1).(usage.Meter) }
+func (c testContract) Weight() int                     { return 1 }
+func (c testContract) Retention() []contract.Retention { return c }
+func (c testContract) Placement() contract.Placement   { return contract.Placement{} }
+func (c testContract) Limits() contract.Limits         { return contract.Limits{} }
+
+type testContracts map[uint32]contract.Contract
+
+func (l testContracts) Range(f func(id uint32, c contract.Contract) bool) {
+	for id, c := range l {
+		if !f(id, c) {
+			return
+		}
+	}
+}
+
+func TestBounded_GC(t *testing.T) {
+	tests := []struct {
+		rule     contract.Retention
+		expected []string
+	}{
+		{rule: contract.Retention{Channel: "other/"}, expected: []string{"a.0", "a.1", "a.2", "a.3", "a.4", "b.4"}},
+		{rule: contract.Retention{Channel: "logs/", MaxAge: 2}, expected: []string{"a.2", "a.3", "a.4", "b.4"}},
+		{rule: contract.Retention{Channel: "logs/", MaxCount: 3}, expected: []string{"a.3", "a.4", "b.4"}},
+		{rule: contract.Retention{Channel: "logs/a/", MaxCount: 2}, expected: []string{"a.3", "a.4", "b.4"}},
+		{rule: contract.Retention{Channel: "logs/+/", MaxCount: 1}, expected: []string{"a.4", "b.4"}},
+		{rule: contract.Retention{Channel: "logs/", MaxBytes: 9}, expected: []string{"a.3", "a.4", "b.4"}},
+		{rule: contract.Retention{Channel: "+/a/", MaxCount: 1}, expected: []string{"a.0", "a.1", "a.2", "a.3", "a.4", "b.4"}},
+	}
+
+	for _, tc := range tests {
+		msg := fmt.Sprintf("%+v", tc.rule)
+		store := NewInMemory(nil)
+		assert.NoError(t, store.Configure(nil))
+
+		// Publish a message every second on "logs/a/" and a single one on "logs/b/", the
+		// latter within the same second as the newest one on "logs/a/".
+		for i := int64(0); i < 5; i++ {
+			assert.NoError(t, store.Store(newChannelMessage("logs/a/", i-4, fmt.Sprintf("a.%d", i))))
+		}
+		assert.NoError(t, store.Store(newChannelMessage("logs/b/", 0, "b.4")))
+
+		s := NewBounded(store, testContracts{1: testContract{tc.rule}}, time.Hour)
+		assert.NoError(t, s.GC(), msg)
+
+		zero := time.Unix(0, 0)
+		ssid := message.NewSsid(1, security.ParseChannel([]byte("key/logs/")).Query)
+		f, err := s.Query(ssid, zero, zero, 100)
+		assert.NoError(t, err, msg)
+
+		var payloads []string
+		for _, m := range f {
+			payloads = append(payloads, string(m.Payload))
+		}
+		assert.ElementsMatch(t, tc.expected, payloads, msg)
+		assert.NoError(t, s.Close())
+	}
+}
+
+func TestExceeding(t *testing.T) {
+	frame := message.Frame{
+		*newChannelMessage("a/", 0, "12"),
+		*newChannelMessage("a/", 1, "34"),
+		*newChannelMessage("a/", 1, "56"),
+	}
+	frame.Sort()
+
+	tests := []struct {
+		rule    contract.Retention
+		until   int64
+		removed bool
+	}{
+		{rule: contract.Retention{}},
+		{rule: contract.Retention{MaxCount: 3}},
+		{rule: contract.Retention{MaxCount: 2}, until: frame[0].Time(), removed: true},
+		{rule: contract.Retention{MaxCount: 1}, until: frame[0].Time(), removed: true},
+		{rule: contract.Retention{MaxBytes: 4}, until: frame[0].Time(), removed: true},
+		{rule: contract.Retention{MaxBytes: 1}, until: frame[2].Time(), removed: true},
+	}
+
+	for _, tc := range tests {
+		until, removed := exceeding(frame, tc.rule)
+		assert.Equal(t, tc.removed, removed, "%+v", tc.rule)
+		assert.Equal(t, tc.until, until, "%+v", tc.rule)
+	}
+}
+
+func TestSsidOf(t *testing.T) {
+	tests := []struct {
+		pattern string
+		ok      bool
+	}{
+		{pattern: "logs/", ok: true},
+		{pattern: "logs", ok: true},
+		{pattern: "logs/+/errors/", ok: true},
+		{pattern: "+/errors/"},
+		{pattern: "#/"},
+		{pattern: ""},
+	}
+
+	for _, tc := range tests {
+		ssid, ok := ssidOf(1, tc.pattern)
+		assert.Equal(t, tc.ok, ok, tc.pattern)
+		if tc.ok {
+			assert.Equal(t, uint32(1), ssid.Contract(), tc.pattern)
+		}
+	}
+}
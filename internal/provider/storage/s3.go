@@ -0,0 +1,100 @@
+//go:build !nos3
+// +build !nos3
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3 implements ObjectStore contract.
+var _ ObjectStore = new(S3)
+
+// S3 represents an object storage compatible with the S3 API, such as AWS S3, MinIO or
+// Google Cloud Storage through its interoperability endpoint. The credentials are taken
+// from the environment, as for any AWS client.
+type S3 struct {
+	client *s3.S3 // The client to use.
+	bucket string // The bucket to store the objects in.
+}
+
+// NewS3 creates a new S3 object storage. The endpoint is only required for the services
+// other than AWS S3, in which case the path-style addressing is used.
+func NewS3(bucket, region, endpoint string) (*S3, error) {
+	cfg := aws.NewConfig()
+	if region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+
+	if endpoint != "" {
+		cfg = cfg.WithEndpoint(endpoint).WithS3ForcePathStyle(true)
+	}
+
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3{
+		client: s3.New(sess),
+		bucket: bucket,
+	}, nil
+}
+
+// Put writes an object.
+func (s *S3) Put(key string, data []byte) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+// Get reads an object.
+func (s *S3) Get(key string) ([]byte, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+// List lists the keys of the objects starting with the prefix.
+func (s *S3) List(prefix string) ([]string, error) {
+	var keys []string
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	return keys, err
+}
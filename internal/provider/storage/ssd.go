@@ -16,25 +16,50 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/emitter-io/emitter/internal/async"
 	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/migrate"
 	"github.com/emitter-io/emitter/internal/provider/logging"
 	"github.com/emitter-io/emitter/internal/service"
 	"github.com/kelindar/binary"
 )
 
+const (
+	defaultSSDDir        = "/data" // The default directory of the database.
+	defaultSSDCompaction = 30      // The default interval of the compaction, in minutes.
+	ssdEvictionRatio     = 0.9     // The ratio of the maximum size to shrink to, once exceeded.
+)
+
+// SSDFormat is the on-disk format of the SSD storage. Any change to the encoding of the keys
+// or the values must come with a migration of the existing databases.
+var SSDFormat = &migrate.Format{
+	Name: "ssd",
+	Migrations: []migrate.Migration{{
+		Version:     1,
+		Description: "version the message database",
+		Apply:       func(string) error { return nil },
+	}},
+}
+
+func init() {
+	migrate.Register(SSDFormat)
+}
+
 // ------------------------------------------------------------------------------------ //
 
 // SSD represents an SSD-optimized storage storage.
 type SSD struct {
-	retain uint32             // The configured TTL for 'retained' messages.
-	survey service.Surveyor   // The cluster surveyor.
-	db     *badger.DB         // The underlying database to use for messages.
-	cancel context.CancelFunc // The cancellation function.
+	retain  uint32             // The configured TTL for 'retained' messages.
+	maxSize int64              // The maximum size of the messages, in bytes (0 for unlimited).
+	survey  service.Surveyor   // The cluster surveyor.
+	db      *badger.DB         // The underlying database to use for messages.
+	cancel  context.CancelFunc // The cancellation function.
 }
 
 // NewSSD creates a new SSD-optimized storage storage.
@@ -54,24 +79,34 @@ func (s *SSD) Name() string {
 // configurations.
 func (s *SSD) Configure(config map[string]interface{}) error {
 
-	// Get the interval from the provider configuration
-	dir := "/data"
-	if v, ok := config["dir"]; ok {
-		if d, ok := v.(string); ok {
-			dir = d
-		}
-	}
-
 	// Make sure we have a directory
+	dir := configString(config, "dir", defaultSSDDir)
 	if err := os.MkdirAll(dir, 0777); err != nil {
 		return err
 	}
 
-	// Create the options
-	opts := badger.DefaultOptions(dir)
-	opts.SyncWrites = false
+	// Upgrade the database written by a previous version, backing it up first unless asked not to
+	result, err := SSDFormat.Migrate(dir, migrate.Options{Backup: configBool(config, "backup", true)})
+	if err != nil {
+		return err
+	}
+	if len(result.Pending) > 0 {
+		logging.LogAction("ssd", fmt.Sprintf("migrated %s from v%d to v%d", dir, result.From, result.To))
+	}
 
-	//opts.ValueLogLoadingMode = options.FileIO
+	// Create the options, syncing the writes only if asked to since a graceful shutdown
+	// flushes them anyway.
+	opts := badger.DefaultOptions(dir)
+	opts.SyncWrites = configBool(config, "sync", false)
+
+	// With a size cap, keep the value log files small enough to be reclaimed
+	s.maxSize = int64(configUint32(config, "maxSize", 0)) << 20
+	if s.maxSize > 0 && s.maxSize/4 < opts.ValueLogFileSize {
+		opts.ValueLogFileSize = s.maxSize / 4
+		if opts.ValueLogFileSize < 1<<20 {
+			opts.ValueLogFileSize = 1 << 20
+		}
+	}
 
 	// Attempt to open the database
 	db, err := badger.Open(opts)
@@ -82,23 +117,20 @@ func (s *SSD) Configure(config map[string]interface{}) error {
 	// Setup the database and start GC
 	s.db = db
 	s.retain = configUint32(config, "retain", defaultRetain)
-	s.cancel = async.Repeat(context.Background(), 30*time.Minute, s.GC)
+	interval := time.Duration(configUint32(config, "compaction", defaultSSDCompaction)) * time.Minute
+	s.cancel = async.Repeat(context.Background(), interval, s.collect)
 	return nil
 }
 
 // Store appends the messages to the store.
 func (s *SSD) Store(m *message.Message) error {
-	if m.TTL == message.RetainedTTL {
-		m.TTL = s.retain
-	}
-
 	// TODO: add batching instead of storing one by one
 	return s.storeFrame(message.Frame{*m})
 }
 
 // storeFrame appends the frame of messages to the store.
 func (s *SSD) storeFrame(msgs message.Frame) error {
-	encoded := encodeFrame(msgs)
+	encoded := encodeFrame(msgs, s.retain)
 	return s.db.Update(func(tx *badger.Txn) error {
 		for _, m := range encoded {
 			entry := m // Copy address
@@ -109,13 +141,13 @@ func (s *SSD) storeFrame(msgs message.Frame) error {
 }
 
 // encodeMessage encodes a message frame so we can store it
-func encodeFrame(msgs message.Frame) []*badger.Entry {
+func encodeFrame(msgs message.Frame, retain uint32) []*badger.Entry {
 	entries := make([]*badger.Entry, 0, len(msgs))
 	for _, m := range msgs {
 		entries = append(entries, &badger.Entry{
 			Key:       m.ID,
 			Value:     m.Encode(),
-			ExpiresAt: uint64(m.Expires().Unix()),
+			ExpiresAt: uint64(expiresOf(&m, retain).Unix()),
 		})
 	}
 	return entries
@@ -222,7 +254,135 @@ func loadMessage(item *badger.Item) (message.Message, error) {
 	return message.DecodeMessage(data)
 }
 
-// GC runs the garbage collection on the storage
-func (s *SSD) GC() {
-	s.db.RunValueLogGC(0.50)
+// Delete removes the messages matching the SSID within the time window.
+func (s *SSD) Delete(ssid message.Ssid, from, until time.Time) error {
+	if len(ssid) < 2 {
+		return errInvalidSsid
+	}
+
+	// Collect the keys of the messages to remove
+	t0, t1 := window(from, until)
+	var keys [][]byte
+	if err := s.db.View(func(tx *badger.Txn) error {
+		it := tx.NewIterator(badger.IteratorOptions{
+			PrefetchValues: false,
+		})
+		defer it.Close()
+
+		for it.Seek(message.NewPrefix(ssid, t1)); it.Valid() &&
+			message.ID(it.Item().Key()).HasPrefix(ssid, t0); it.Next() {
+			if message.ID(it.Item().Key()).Match(ssid, t0, t1) {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Remove them in a batch, since there might be too many for a single transaction
+	batch := s.db.NewWriteBatch()
+	defer batch.Cancel()
+	for _, key := range keys {
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+// GC runs the garbage collection on the storage, evicting the oldest messages if the
+// storage exceeds its maximum size and then reclaiming the space of the value log.
+func (s *SSD) GC() error {
+	if err := s.evict(); err != nil {
+		return err
+	}
+
+	for {
+		switch err := s.db.RunValueLogGC(0.50); err {
+		case nil:
+			continue
+		case badger.ErrNoRewrite:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// evict removes the oldest messages until the storage shrinks back well within its
+// maximum size. The sizes are first accumulated per second, so the cutoff can be found
+// without keeping all of the keys in memory.
+func (s *SSD) evict() error {
+	if s.maxSize <= 0 {
+		return nil
+	}
+
+	var total int64
+	sizes := make(map[int64]int64)
+	if err := s.scan(func(item *badger.Item) error {
+		size := item.EstimatedSize()
+		sizes[message.ID(item.Key()).Time()] += size
+		total += size
+		return nil
+	}); err != nil || total <= s.maxSize {
+		return err
+	}
+
+	// Find the time up to which the messages need to be removed
+	times := make([]int64, 0, len(sizes))
+	for t := range sizes {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	var cutoff int64
+	target := int64(float64(s.maxSize) * ssdEvictionRatio)
+	for _, t := range times {
+		if total <= target {
+			break
+		}
+
+		cutoff = t
+		total -= sizes[t]
+	}
+
+	// Remove them in a batch, since there might be too many for a single transaction
+	batch := s.db.NewWriteBatch()
+	defer batch.Cancel()
+	if err := s.scan(func(item *badger.Item) error {
+		if message.ID(item.Key()).Time() > cutoff {
+			return nil
+		}
+		return batch.Delete(item.KeyCopy(nil))
+	}); err != nil {
+		return err
+	}
+
+	logging.LogAction("ssd", "evicted the messages stored before "+time.Unix(cutoff+1, 0).UTC().Format(time.RFC3339))
+	return batch.Flush()
+}
+
+// scan iterates through the keys of all of the messages.
+func (s *SSD) scan(fn func(*badger.Item) error) error {
+	return s.db.View(func(tx *badger.Txn) error {
+		it := tx.NewIterator(badger.IteratorOptions{
+			PrefetchValues: false,
+		})
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := fn(it.Item()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// collect periodically runs the garbage collection.
+func (s *SSD) collect() {
+	if err := s.GC(); err != nil {
+		logging.LogError("ssd", "garbage collection", err)
+	}
 }
@@ -17,13 +17,16 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/migrate"
 	"github.com/emitter-io/stats"
 	"github.com/kelindar/binary"
 	"github.com/stretchr/testify/assert"
@@ -96,6 +99,109 @@ func TestSSD_QueryRange(t *testing.T) {
 	})
 }
 
+func TestSSD_Reopen(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "emitter")
+	defer os.RemoveAll(dir)
+
+	// Store messages and close the storage, as a restart would
+	store := NewSSD(nil)
+	assert.NoError(t, store.Configure(map[string]interface{}{
+		"dir":  dir,
+		"sync": true,
+	}))
+	assert.NoError(t, store.storeFrame(getNTestMessages(10)))
+	assert.NoError(t, store.Close())
+
+	// The messages must survive
+	store = NewSSD(nil)
+	assert.NoError(t, store.Configure(map[string]interface{}{
+		"dir": dir,
+	}))
+	defer store.Close()
+
+	zero := time.Unix(0, 0)
+	f, err := store.Query([]uint32{0, 3, 2, 6}, zero, zero, 5)
+	assert.NoError(t, err)
+	assert.Len(t, f, 1)
+}
+
+func TestSSD_Migrate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "emitter")
+	defer os.RemoveAll(dir)
+
+	// Write a database as a version which did not track its format would
+	store := NewSSD(nil)
+	assert.NoError(t, store.Configure(map[string]interface{}{
+		"dir":  dir,
+		"sync": true,
+	}))
+	assert.NoError(t, store.storeFrame(getNTestMessages(10)))
+	assert.NoError(t, store.Close())
+	assert.NoError(t, os.Remove(filepath.Join(dir, "FORMAT")))
+
+	// The database is backed up, migrated and the messages survive
+	store = NewSSD(nil)
+	assert.NoError(t, store.Configure(map[string]interface{}{
+		"dir": dir,
+	}))
+	defer store.Close()
+
+	backups, _ := filepath.Glob(dir + ".v0-*.bak")
+	assert.Len(t, backups, 1)
+	for _, backup := range backups {
+		defer os.RemoveAll(backup)
+	}
+
+	result, err := SSDFormat.Migrate(dir, migrate.Options{DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, SSDFormat.Version(), result.From)
+	assert.Empty(t, result.Pending)
+
+	zero := time.Unix(0, 0)
+	f, err := store.Query([]uint32{0, 3, 2, 6}, zero, zero, 5)
+	assert.NoError(t, err)
+	assert.Len(t, f, 1)
+}
+
+func TestSSD_Evict(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "emitter")
+	defer os.RemoveAll(dir)
+
+	store := NewSSD(nil)
+	assert.NoError(t, store.Configure(map[string]interface{}{
+		"dir":     dir,
+		"maxSize": float64(1),
+	}))
+	defer store.Close()
+	assert.Equal(t, int64(1<<20), store.maxSize)
+	assert.Equal(t, int64(1<<20), store.db.Opts().ValueLogFileSize)
+
+	// Store about 2MB of messages, each one a second apart
+	now := time.Now().Unix()
+	for i := 0; i < 200; i++ {
+		payload := make([]byte, 10000)
+		rand.Read(payload)
+		msg := message.New(message.Ssid{0, 1, 2}, []byte("a/b/"), payload)
+		msg.TTL = 100000
+		msg.ID.SetTime(now - 200 + int64(i))
+		assert.NoError(t, store.Store(msg))
+	}
+
+	// Only the most recent messages are kept
+	assert.NoError(t, store.GC())
+	zero := time.Unix(0, 0)
+	f, err := store.Query(message.Ssid{0, 1, 2}, zero, zero, 1000)
+	assert.NoError(t, err)
+	assert.True(t, len(f) > 50 && len(f) < 100, len(f))
+	assert.Equal(t, now-1, f[len(f)-1].Time())
+
+	// Once within the limit, nothing else is removed
+	assert.NoError(t, store.GC())
+	g, err := store.Query(message.Ssid{0, 1, 2}, zero, zero, 1000)
+	assert.NoError(t, err)
+	assert.Len(t, g, len(f))
+}
+
 func TestSSD_QuerySurveyed(t *testing.T) {
 	runSSDTest(func(s *SSD) {
 		const wildcard = uint32(1815237614)
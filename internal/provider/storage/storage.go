@@ -15,8 +15,12 @@
 package storage
 
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/emitter-io/config"
@@ -25,7 +29,8 @@ import (
 )
 
 var (
-	errNotFound = errors.New("no messages were found")
+	errNotFound    = errors.New("no messages were found")
+	errInvalidSsid = errors.New("the ssid must contain at least the contract and the first channel part")
 )
 
 const (
@@ -48,6 +53,15 @@ type Storage interface {
 	// n is specified by limit argument. From and until times can also be specified
 	// for time-series retrieval.
 	Query(ssid message.Ssid, from, until time.Time, limit int) (message.Frame, error)
+
+	// Delete removes the messages matching the SSID within the time window from this
+	// node. The SSID provided must contain at least the contract and the first part
+	// of the channel, and a zero 'until' time means that the window is not bounded.
+	Delete(ssid message.Ssid, from, until time.Time) error
+
+	// GC runs the garbage collection, removing the expired messages and reclaiming
+	// the space they used. This is called periodically by the storage itself.
+	GC() error
 }
 
 // ------------------------------------------------------------------------------------
@@ -63,6 +77,28 @@ func window(from, until time.Time) (int64, int64) {
 	return t0, t1
 }
 
+// expiresOf returns the expiration time of a message, where the retained messages are kept
+// for the configured retention period. The TTL of the message itself is left untouched,
+// so that the retained messages can still be told apart when queried.
+func expiresOf(m *message.Message, retain uint32) time.Time {
+	if m.TTL == message.RetainedTTL {
+		return time.Unix(m.Time(), 0).Add(time.Second * time.Duration(retain))
+	}
+	return m.Expires()
+}
+
+// prefixOf returns the prefix of the message ID, as stored in the database.
+func prefixOf(id message.ID) int64 {
+	return int64(binary.BigEndian.Uint32(id[0:4]))
+}
+
+// newNodeID generates a random identifier for the node.
+func newNodeID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 // The lookup query to send out to the cluster.
 type lookupQuery struct {
 	Ssid  message.Ssid // The ssid to match.
@@ -92,6 +128,26 @@ func configUint32(config map[string]interface{}, name string, defaultValue uint3
 	return defaultValue
 }
 
+// configString retrieves a string from the config
+func configString(config map[string]interface{}, name string, defaultValue string) string {
+	if v, ok := config[name]; ok {
+		if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+			return s
+		}
+	}
+	return defaultValue
+}
+
+// configBool retrieves a bool from the config
+func configBool(config map[string]interface{}, name string, defaultValue bool) bool {
+	if v, ok := config[name]; ok {
+		if b, ok := v.(bool); ok {
+			return b
+		}
+	}
+	return defaultValue
+}
+
 // ------------------------------------------------------------------------------------
 
 // Noop implements Storage contract.
@@ -132,6 +188,16 @@ func (s *Noop) Query(ssid message.Ssid, from, until time.Time, limit int) (messa
 	return nil, nil
 }
 
+// Delete removes the messages matching the SSID within the time window.
+func (s *Noop) Delete(ssid message.Ssid, from, until time.Time) error {
+	return nil
+}
+
+// GC runs the garbage collection.
+func (s *Noop) GC() error {
+	return nil
+}
+
 // Close gracefully terminates the storage and ensures that every related
 // resource is properly disposed.
 func (s *Noop) Close() error {
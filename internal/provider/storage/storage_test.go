@@ -38,6 +38,11 @@ func testMessage(a, b, c uint32) *message.Message {
 	}
 }
 
+func TestPrefixOf(t *testing.T) {
+	id := message.NewID(message.Ssid{0xffffffff, 1, 2})
+	assert.Equal(t, int64(0xfffffffe), prefixOf(id))
+}
+
 func TestNoop_Store(t *testing.T) {
 	s := NewNoop()
 	err := s.Store(testMessage(1, 2, 3))
@@ -0,0 +1,65 @@
+//go:build !notracing
+// +build !notracing
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package tracing
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Configure starts exporting the spans to an OTLP/HTTP collector, sampling the specified
+// ratio of the traces which are started on this node. The returned closer flushes the
+// remaining spans and stops the exporter.
+func Configure(endpoint string, insecure bool, ratio float64, node string) (io.Closer, error) {
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "emitter"),
+			attribute.String("service.instance.id", node),
+		)),
+	)
+
+	use(provider)
+	return &closer{provider}, nil
+}
+
+// closer shuts down the tracer provider.
+type closer struct {
+	provider *sdktrace.TracerProvider
+}
+
+// Close flushes the remaining spans and stops the exporter.
+func (c *closer) Close() error {
+	return c.provider.Shutdown(context.Background())
+}
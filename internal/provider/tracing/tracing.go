@@ -0,0 +1,131 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package tracing
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/message"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header is the name of the message header which carries the trace context across the
+// nodes, in the W3C Trace Context format.
+const Header = "traceparent"
+
+var (
+	enabled    uint32                                            // Whether the tracing is configured.
+	tracer     = trace.NewNoopTracerProvider().Tracer("emitter") // The tracer of the spans.
+	propagator = propagation.TraceContext{}                      // The propagator of the trace context.
+	noop       = trace.SpanFromContext(context.Background())     // The span returned when not tracing.
+)
+
+// use sets the provider of the tracer and enables the tracing.
+func use(provider trace.TracerProvider) {
+	tracer = provider.Tracer("emitter")
+	atomic.StoreUint32(&enabled, 1)
+}
+
+// Enabled returns whether the tracing is configured.
+func Enabled() bool {
+	return atomic.LoadUint32(&enabled) == 1
+}
+
+// Start starts a new span as a child of the span in the context, or a new trace if there
+// is none.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !Enabled() {
+		return ctx, noop
+	}
+
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Child starts a new span as a child of the span in the context. If there is none, nothing
+// is traced.
+func Child(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, noop
+	}
+
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Continue starts a new span as a child of the trace carried by the message. If the message
+// does not carry any, nothing is traced.
+func Continue(m *message.Message, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Child(Extract(m.Headers), name, attrs...)
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err *errors.Error) {
+	if err != nil {
+		span.SetStatus(codes.Error, err.Message)
+	}
+	span.End()
+}
+
+// Extract returns a context with the trace context carried by the headers, if any.
+func Extract(headers message.Headers) context.Context {
+	ctx := context.Background()
+	if !Enabled() || headers[Header] == "" {
+		return ctx
+	}
+
+	return propagator.Extract(ctx, carrier(headers))
+}
+
+// Inject attaches the trace context of the span in the context to the headers of the
+// message, so that the peers can continue the trace. The headers are left untouched if
+// the message can not carry any more of them.
+func Inject(ctx context.Context, m *message.Message) {
+	if !Enabled() || !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+
+	if _, ok := m.Headers[Header]; !ok && len(m.Headers) >= message.MaxHeaders {
+		return
+	}
+
+	if m.Headers == nil {
+		m.Headers = make(message.Headers, 1)
+	}
+	propagator.Inject(ctx, carrier(m.Headers))
+}
+
+// ------------------------------------------------------------------------------------
+
+// carrier adapts the headers of a message to carry the trace context.
+type carrier message.Headers
+
+// Get returns the value of a header.
+func (c carrier) Get(key string) string {
+	return c[key]
+}
+
+// Set sets the value of a header.
+func (c carrier) Set(key, value string) {
+	c[key] = value
+}
+
+// Keys returns the names of the headers.
+func (c carrier) Keys() []string {
+	return message.Headers(c).Names()
+}
@@ -0,0 +1,100 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestRecorder() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	use(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+}
+
+func TestPropagate(t *testing.T) {
+	recorder := newTestRecorder()
+
+	// Publish on the first node
+	ctx, publish := Start(context.Background(), "publish")
+	msg := message.New(message.Ssid{1, 2, 3}, []byte("a/b/c/"), []byte("hello"))
+	Inject(ctx, msg)
+	End(publish, nil)
+	assert.Len(t, msg.Headers[Header], 55)
+
+	// Deliver on the peer, after the message went through the codec
+	decoded, err := message.DecodeFrame((&message.Frame{*msg}).Encode())
+	assert.NoError(t, err)
+	_, deliver := Continue(&decoded[0], "peer.deliver")
+	End(deliver, errors.ErrNotFound)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "peer.deliver", spans[1].Name())
+	assert.Equal(t, spans[0].SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+	assert.Equal(t, spans[0].SpanContext().SpanID(), spans[1].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestContinue_NoTrace(t *testing.T) {
+	recorder := newTestRecorder()
+
+	msg := message.New(message.Ssid{1, 2, 3}, []byte("a/b/c/"), []byte("hello"))
+	_, span := Continue(msg, "lookup")
+	span.End()
+
+	assert.False(t, span.SpanContext().IsValid())
+	assert.Empty(t, recorder.Ended())
+}
+
+func TestExtract_Publisher(t *testing.T) {
+	newTestRecorder()
+
+	// The publisher has specified its own trace
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx, span := Start(Extract(message.Headers{Header: parent}), "publish")
+	span.End()
+
+	msg := message.New(message.Ssid{1, 2, 3}, []byte("a/b/c/"), []byte("hello"))
+	Inject(ctx, msg)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Contains(t, msg.Headers[Header], "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.NotEqual(t, parent, msg.Headers[Header])
+}
+
+func TestInject_Full(t *testing.T) {
+	newTestRecorder()
+
+	ctx, span := Start(context.Background(), "publish")
+	defer span.End()
+
+	msg := message.New(message.Ssid{1, 2, 3}, []byte("a/b/c/"), []byte("hello"))
+	msg.Headers = message.Headers{}
+	for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		msg.Headers[k] = "x"
+	}
+
+	Inject(ctx, msg)
+	assert.Len(t, msg.Headers, message.MaxHeaders)
+	assert.Empty(t, msg.Headers[Header])
+}
@@ -17,6 +17,7 @@ package security
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/emitter-io/emitter/internal/config"
@@ -37,6 +38,13 @@ const (
 	MaxTime = 3029529600 // 2066
 )
 
+// The prefixes of the options which carry the headers of a message and the presence
+// metadata of a subscription.
+const (
+	headerPrefix = "h-"
+	metaPrefix   = "m-"
+)
+
 var zeroTime = time.Unix(0, 0)
 
 // ChannelOption represents a key/value pair option.
@@ -69,12 +77,111 @@ func (c *Channel) Last() (int64, bool) {
 	return c.getOption("last", 64)
 }
 
+// Retained returns whether only the retained messages should be replayed ('retained=1').
+func (c *Channel) Retained() bool {
+	v, ok := c.getOption("retained", 64)
+	return ok && v == 1
+}
+
+// Rewind returns the 'rewind' option, which is the duration before the subscription for
+// which the recently published messages should be delivered. It is either a number of
+// seconds or a duration (e.g: 'rewind=500ms').
+func (c *Channel) Rewind() (time.Duration, bool) {
+	return c.getDuration("rewind")
+}
+
+// Delay returns the 'delay' option, which is the duration the message should be held for
+// before being delivered. It is either a number of seconds or a duration (e.g: 'delay=30s').
+func (c *Channel) Delay() (time.Duration, bool) {
+	return c.getDuration("delay")
+}
+
+// At returns the 'at' option, which is the UTC unix timestamp in seconds at which the
+// message should be delivered.
+func (c *Channel) At() (time.Time, bool) {
+	if v, ok := c.getOption("at", 64); ok && v >= MinTime && v <= MaxTime {
+		return time.Unix(v, 0), true
+	}
+	return zeroTime, false
+}
+
+// MessageID returns the 'id' option, which is the alphanumeric identifier the publisher
+// gave to the message so that its retries can be deduplicated.
+func (c *Channel) MessageID() (string, bool) {
+	for _, v := range c.Options {
+		if v.Key == "id" {
+			return v.Value, true
+		}
+	}
+	return "", false
+}
+
+// Alias returns the 'alias' option, which is the name of the link the publisher binds the
+// channel to, so that its following messages can be published on the alias instead.
+func (c *Channel) Alias() (string, bool) {
+	for _, v := range c.Options {
+		if v.Key == "alias" {
+			return v.Value, true
+		}
+	}
+	return "", false
+}
+
+// Chunk returns the options of a message published in chunks (e.g: 'chunk=fw1&part=2&parts=8'),
+// which are the identifier of the whole message and the position of the chunk within it,
+// starting at 1. The position is zero if it is missing or invalid.
+func (c *Channel) Chunk() (id string, part, parts int, ok bool) {
+	for _, v := range c.Options {
+		if v.Key == "chunk" {
+			id, ok = v.Value, true
+		}
+	}
+
+	p, okPart := c.getOption("part", 32)
+	n, okParts := c.getOption("parts", 32)
+	if !ok || !okPart || !okParts || p < 1 || p > n {
+		return id, 0, 0, ok
+	}
+	return id, int(p), int(n), true
+}
+
+// Filter returns the 'filter' option, which is the selector of the messages delivered to a
+// subscriber (e.g: "filter=temp>50 and unit='celsius'"). Since the '&' separates the options,
+// the selector is percent-decoded so any of its bytes can be escaped.
+func (c *Channel) Filter() (string, bool) {
+	for _, v := range c.Options {
+		if v.Key == "filter" {
+			out, ok := unescape([]byte(v.Value))
+			return string(out), ok
+		}
+	}
+	return "", false
+}
+
 // Exclude returns whether the exclude me ('me=0') option was set or not.
 func (c *Channel) Exclude() bool {
 	v, ok := c.getOption("me", 64)
 	return ok && v == 0
 }
 
+// LowPriority returns whether the message was published with a low priority
+// ('priority=low') and can be shed when the server is overloaded.
+func (c *Channel) LowPriority() bool {
+	for _, v := range c.Options {
+		if v.Key == "priority" {
+			return v.Value == "low"
+		}
+	}
+	return false
+}
+
+// NotifyOrphan returns whether the publisher asked to be notified ('orphan=1') when the
+// message published did not match any subscriber.
+func (c *Channel) NotifyOrphan() bool {
+	v, ok := c.getOption("orphan", 64)
+	return ok && v == 1
+}
+
 // Window returns the from-until options which should be a UTC unix timestamp in seconds.
 func (c *Channel) Window() (time.Time, time.Time) {
 	u0, _ := c.getOption("from", 64)
@@ -82,6 +189,18 @@ func (c *Channel) Window() (time.Time, time.Time) {
 	return toUnix(u0), toUnix(u1)
 }
 
+// Headers returns the options prefixed with 'h-' (e.g: 'h-trace=abc'), which are the
+// headers the publisher attached to the message, indexed by their name.
+func (c *Channel) Headers() map[string]string {
+	return c.getPrefixed(headerPrefix)
+}
+
+// Meta returns the options prefixed with 'm-' (e.g: 'm-status=away'), which are the
+// presence metadata the subscriber attached to the subscription, indexed by their name.
+func (c *Channel) Meta() map[string]string {
+	return c.getPrefixed(metaPrefix)
+}
+
 // SafeString returns a string representation of the channel without the key.
 func (c *Channel) SafeString() string {
 	text := string(c.Channel)
@@ -117,6 +236,38 @@ func toUnix(t int64) time.Time {
 	return time.Unix(t, 0)
 }
 
+// getDuration retrieves a positive duration option, either a number of seconds or a
+// duration string.
+func (c *Channel) getDuration(name string) (time.Duration, bool) {
+	for _, v := range c.Options {
+		if v.Key == name {
+			if secs, err := strconv.ParseInt(v.Value, 10, 64); err == nil && secs > 0 {
+				return time.Duration(secs) * time.Second, true
+			}
+			if d, err := time.ParseDuration(v.Value); err == nil && d > 0 {
+				return d, true
+			}
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// getPrefixed retrieves the options with the specified prefix, indexed by their name
+// without the prefix.
+func (c *Channel) getPrefixed(prefix string) map[string]string {
+	var options map[string]string
+	for _, v := range c.Options {
+		if len(v.Key) > len(prefix) && strings.HasPrefix(v.Key, prefix) {
+			if options == nil {
+				options = make(map[string]string, 2)
+			}
+			options[v.Key[len(prefix):]] = v.Value
+		}
+	}
+	return options
+}
+
 // getOptUint retrieves a Uint option
 func (c *Channel) getOption(name string, bitSize int) (int64, bool) {
 	for i := 0; i < len(c.Options); i++ {
@@ -190,6 +341,7 @@ func (c *Channel) parseChannel(text []byte) (i int) {
 	length, offset := len(text), 0
 	chanChars := 0
 	wildcards := 0
+	escaped := false
 	for ; i < length; i++ {
 		symbol := text[i] // The current byte
 		switch {
@@ -200,7 +352,14 @@ func (c *Channel) parseChannel(text []byte) (i int) {
 				c.ChannelType = ChannelInvalid
 				return i
 			}
-			c.Query = append(c.Query, hash.Of(text[offset:i]))
+
+			// The escaped parts are hashed in their canonical escaped form, so the escaping
+			// does not matter but an escaped wildcard (e.g: '%2B') never acts as the wildcard.
+			part := text[offset:i]
+			if escaped {
+				part = []byte(CanonicalPart(string(part)))
+			}
+			c.Query = append(c.Query, hash.Of(part))
 
 			if i+1 == length { // The end flag
 				c.Channel = text[:i+1]
@@ -219,6 +378,7 @@ func (c *Channel) parseChannel(text []byte) (i int) {
 			offset = i + 1
 			chanChars = 0
 			wildcards = 0
+			escaped = false
 			continue
 		// If this symbol is a wildcard symbol
 		case symbol == '#' || symbol == '+' || symbol == '*':
@@ -230,8 +390,19 @@ func (c *Channel) parseChannel(text []byte) (i int) {
 			c.ChannelType = ChannelWildcard
 			continue
 
+		// If this symbol starts an escaped byte, it must be followed by two hex digits (e.g: '%2F')
+		case symbol == '%':
+			if wildcards > 0 || i+2 >= length || !isHex(text[i+1]) || !isHex(text[i+2]) {
+				c.ChannelType = ChannelInvalid
+				return i
+			}
+			chanChars++
+			escaped = true
+			i += 2
+			continue
+
 		// Valid character, but nothing special
-		case (symbol >= 45 && symbol <= 58) || (symbol >= 65 && symbol <= 122) || symbol == 36:
+		case isChannelChar(symbol):
 			if wildcards > 0 {
 				c.ChannelType = ChannelInvalid
 				return i
@@ -272,12 +443,13 @@ func (c *Channel) parseOptions(text []byte) (i int, ok bool) {
 				key = text[i : j-1]
 				i = j
 				break
-			} else if !((symbol >= 48 && symbol <= 57) || (symbol >= 65 && symbol <= 90) || (symbol >= 97 && symbol <= 122)) {
+			} else if !isOptionChar(symbol) && symbol != '-' {
 				return i, false
 			}
 		}
 
-		// Get the value
+		// Get the value, the selector of a filter may also contain its operators
+		selector := string(key) == "filter"
 		for j < length {
 			symbol := text[j]
 			j++
@@ -286,7 +458,7 @@ func (c *Channel) parseOptions(text []byte) (i int, ok bool) {
 				val = text[i : j-1]
 				i = j
 				break
-			} else if !((symbol >= 48 && symbol <= 57) || (symbol >= 65 && symbol <= 90) || (symbol >= 97 && symbol <= 122)) {
+			} else if !isOptionChar(symbol) && !(selector && isSelectorChar(symbol)) {
 				return i, false
 			} else if j == length {
 				val = text[i:j]
@@ -0,0 +1,75 @@
+//go:build go1.18
+// +build go1.18
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package security
+
+import (
+	"bytes"
+	"testing"
+)
+
+// FuzzParseChannel checks that the channel parser never panics, and that the channels it
+// accepts are well-formed.
+func FuzzParseChannel(f *testing.F) {
+	for _, seed := range []string{
+		"emitter/a/",
+		"emitter/a/b/c/",
+		"emitter/test-channel/+/and-more/",
+		"emitter/a/b%2Fc/",
+		"emitter/a/%2b%2B/+/",
+		"0TJnt4yZPL73zt35h1UTIFsYBLetyD_g/emitter/?test=true&something=7",
+		"key/a/b/?ttl=30&last=5&from=1500000000&until=1600000000",
+		"key/a/?delay=10s&at=1600000000&rewind=1h&id=abc&alias=x",
+		"key/a/?h.trace=abc&h.span=def&me=0",
+		"key/a//b/",
+		"key/a/%zz/",
+		"key/a/b/c/d/?test==true",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, text []byte) {
+		c := ParseChannel(text)
+		if c.ChannelType == ChannelInvalid {
+			return
+		}
+
+		if !bytes.HasSuffix(c.Channel, []byte("/")) {
+			t.Fatalf("the channel %q of %q has no trailing separator", c.Channel, text)
+		}
+		if len(c.Query) == 0 {
+			t.Fatalf("the channel %q of %q has no query", c.Channel, text)
+		}
+
+		// The values of the options are converted on access, so these must cope with anything
+		c.TTL()
+		c.Last()
+		c.Retained()
+		c.Rewind()
+		c.Delay()
+		c.At()
+		c.MessageID()
+		c.Alias()
+		c.Exclude()
+		c.LowPriority()
+		c.NotifyOrphan()
+		c.Window()
+		c.Headers()
+		c.Target()
+		_ = c.String()
+	})
+}
@@ -17,6 +17,7 @@ package security
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -60,6 +61,8 @@ func TestParseChannel(t *testing.T) {
 		{k: "0TJnt4yZPL73zt35h1UTIFsYBLetyD_g", ch: "emitter/", o: []string{"test=true", "something=7"}, t: ChannelStatic},
 		{k: "emitter", ch: "a/b/c/d/", o: []string{"test=true", "something=7"}, t: ChannelStatic},
 		{k: "emitter", ch: "a/b/c/d/", o: []string{"req=13", "something=7"}, t: ChannelStatic},
+		{k: "emitter", ch: "a/b%2Fc/", t: ChannelStatic},
+		{k: "emitter", ch: "a/%2b%2B/+/", t: ChannelWildcard},
 
 		// Invalid channels
 		{t: ChannelInvalid},
@@ -83,6 +86,10 @@ func TestParseChannel(t *testing.T) {
 		{k: "emitter", ch: "a/b/c/d/", o: []string{"te_st==true"}, t: ChannelInvalid},
 		{k: "emitter", ch: "a/", o: []string{"=true"}, t: ChannelInvalid},
 		{k: "emitter", ch: "a/", o: []string{"test="}, t: ChannelInvalid},
+		{k: "emitter", ch: "a/%2/", t: ChannelInvalid},
+		{k: "emitter", ch: "a/%zz/", t: ChannelInvalid},
+		{k: "emitter", ch: "a/+%2F/", t: ChannelInvalid},
+		{k: "emitter", ch: "a/%2F", t: ChannelInvalid},
 		//		{k: "emitter", ch: "a/b/c/d", o: []string{"test=="}, err: true},
 	}
 
@@ -146,6 +153,41 @@ func TestGetChannelExclude(t *testing.T) {
 	}
 }
 
+func TestGetChannelLowPriority(t *testing.T) {
+	tests := []struct {
+		channel string
+		ok      bool
+	}{
+		{channel: "emitter/a/?priority=low", ok: true},
+		{channel: "emitter/a/?ttl=5&priority=low", ok: true},
+		{channel: "emitter/a/?priority=high", ok: false},
+		{channel: "emitter/a/", ok: false},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		assert.Equal(t, tc.ok, channel.LowPriority(), tc.channel)
+	}
+}
+
+func TestGetChannelNotifyOrphan(t *testing.T) {
+	tests := []struct {
+		channel string
+		ok      bool
+	}{
+		{channel: "emitter/a/?orphan=1", ok: true},
+		{channel: "emitter/a/?ttl=5&orphan=1", ok: true},
+		{channel: "emitter/a/?orphan=0", ok: false},
+		{channel: "emitter/a/?orphan=abc", ok: false},
+		{channel: "emitter/a/", ok: false},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		assert.Equal(t, tc.ok, channel.NotifyOrphan(), tc.channel)
+	}
+}
+
 func TestGetChannelTTL(t *testing.T) {
 	tests := []struct {
 		channel string
@@ -188,6 +230,226 @@ func TestGetChannelLast(t *testing.T) {
 	}
 }
 
+func TestGetChannelRetained(t *testing.T) {
+	tests := []struct {
+		channel  string
+		retained bool
+	}{
+		{channel: "emitter/a/?retained=1", retained: true},
+		{channel: "emitter/a/?last=2&retained=1", retained: true},
+		{channel: "emitter/a/?retained=0"},
+		{channel: "emitter/a/?retained=abc"},
+		{channel: "emitter/a/"},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		assert.Equal(t, tc.retained, channel.Retained(), tc.channel)
+	}
+}
+
+func TestGetChannelRewind(t *testing.T) {
+	tests := []struct {
+		channel string
+		rewind  time.Duration
+		ok      bool
+	}{
+		{channel: "emitter/a/?rewind=5", rewind: 5 * time.Second, ok: true},
+		{channel: "emitter/a/?rewind=500ms", rewind: 500 * time.Millisecond, ok: true},
+		{channel: "emitter/a/?last=2&rewind=1m", rewind: time.Minute, ok: true},
+		{channel: "emitter/a/?rewind=0", ok: false},
+		{channel: "emitter/a/?rewind=-2s", ok: false},
+		{channel: "emitter/a/?rewind=abc", ok: false},
+		{channel: "emitter/a/", ok: false},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		rewind, ok := channel.Rewind()
+
+		assert.Equal(t, tc.rewind, rewind, tc.channel)
+		assert.Equal(t, tc.ok, ok, tc.channel)
+	}
+}
+
+func TestGetChannelDelay(t *testing.T) {
+	tests := []struct {
+		channel string
+		delay   time.Duration
+		ok      bool
+	}{
+		{channel: "emitter/a/?delay=30", delay: 30 * time.Second, ok: true},
+		{channel: "emitter/a/?delay=1h30m", delay: 90 * time.Minute, ok: true},
+		{channel: "emitter/a/?delay=0", ok: false},
+		{channel: "emitter/a/", ok: false},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		delay, ok := channel.Delay()
+
+		assert.Equal(t, tc.delay, delay, tc.channel)
+		assert.Equal(t, tc.ok, ok, tc.channel)
+	}
+}
+
+func TestGetChannelHeaders(t *testing.T) {
+	tests := []struct {
+		channel string
+		headers map[string]string
+		valid   bool
+	}{
+		{channel: "emitter/a/?h-trace=abc", headers: map[string]string{"trace": "abc"}, valid: true},
+		{channel: "emitter/a/?ttl=30&h-zone=euwest&h-v=2", headers: map[string]string{"zone": "euwest", "v": "2"}, valid: true},
+		{channel: "emitter/a/?h-=abc", valid: true},
+		{channel: "emitter/a/?ttl=30", valid: true},
+		{channel: "emitter/a/?h-zone=eu-west", valid: false},
+		{channel: "emitter/a/?h-zone=eu_west", valid: false},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		assert.Equal(t, tc.valid, channel.ChannelType != ChannelInvalid, tc.channel)
+		assert.Equal(t, tc.headers, channel.Headers(), tc.channel)
+	}
+}
+
+func TestGetChannelMeta(t *testing.T) {
+	tests := []struct {
+		channel string
+		meta    map[string]string
+	}{
+		{channel: "emitter/a/?m-status=away", meta: map[string]string{"status": "away"}},
+		{channel: "emitter/a/?m-status=away&h-v=2&m-device=mobile", meta: map[string]string{"status": "away", "device": "mobile"}},
+		{channel: "emitter/a/?m-=away"},
+		{channel: "emitter/a/?ttl=30"},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		assert.Equal(t, tc.meta, channel.Meta(), tc.channel)
+	}
+}
+
+func TestGetChannelAt(t *testing.T) {
+	tests := []struct {
+		channel string
+		at      int64
+		ok      bool
+	}{
+		{channel: "emitter/a/?at=1600000000", at: 1600000000, ok: true},
+		{channel: "emitter/a/?at=1", at: 0, ok: false},
+		{channel: "emitter/a/?at=abc", at: 0, ok: false},
+		{channel: "emitter/a/", at: 0, ok: false},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		at, ok := channel.At()
+
+		assert.Equal(t, tc.at, at.Unix(), tc.channel)
+		assert.Equal(t, tc.ok, ok, tc.channel)
+	}
+}
+
+func TestGetChannelMessageID(t *testing.T) {
+	tests := []struct {
+		channel string
+		id      string
+		ok      bool
+	}{
+		{channel: "emitter/a/?id=abc123", id: "abc123", ok: true},
+		{channel: "emitter/a/?ttl=30&id=7", id: "7", ok: true},
+		{channel: "emitter/a/", ok: false},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		id, ok := channel.MessageID()
+
+		assert.Equal(t, tc.id, id, tc.channel)
+		assert.Equal(t, tc.ok, ok, tc.channel)
+	}
+}
+
+func TestGetChannelAlias(t *testing.T) {
+	tests := []struct {
+		channel string
+		alias   string
+		ok      bool
+	}{
+		{channel: "emitter/a/?alias=t1", alias: "t1", ok: true},
+		{channel: "emitter/a/?ttl=5&alias=7", alias: "7", ok: true},
+		{channel: "emitter/a/?ttl=5", alias: "", ok: false},
+		{channel: "emitter/a/", alias: "", ok: false},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		alias, ok := channel.Alias()
+
+		assert.Equal(t, tc.alias, alias, tc.channel)
+		assert.Equal(t, tc.ok, ok, tc.channel)
+	}
+}
+
+func TestGetChannelFilter(t *testing.T) {
+	tests := []struct {
+		channel string
+		filter  string
+		ok      bool
+		invalid bool
+	}{
+		{channel: "emitter/a/?filter=temp>50", filter: "temp>50", ok: true},
+		{channel: "emitter/a/?last=5&filter=unit='c' and (temp>=50.5 or x.y!=-1)", filter: "unit='c' and (temp>=50.5 or x.y!=-1)", ok: true},
+		{channel: "emitter/a/?filter=a>1%26b<2&ttl=5", filter: "a>1&b<2", ok: true},
+		{channel: "emitter/a/?filter=a>%2", ok: false},
+		{channel: "emitter/a/?ttl=5", ok: false},
+		{channel: "emitter/a/?ttl=5>1", invalid: true},
+		{channel: "emitter/a/?filter=a>1&b<2", invalid: true},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		if tc.invalid {
+			assert.Equal(t, ChannelInvalid, channel.ChannelType, tc.channel)
+			continue
+		}
+
+		filter, ok := channel.Filter()
+		assert.Equal(t, ChannelStatic, channel.ChannelType, tc.channel)
+		assert.Equal(t, tc.filter, filter, tc.channel)
+		assert.Equal(t, tc.ok, ok, tc.channel)
+	}
+}
+
+func TestGetChannelChunk(t *testing.T) {
+	tests := []struct {
+		channel string
+		id      string
+		part    int
+		parts   int
+		ok      bool
+	}{
+		{channel: "emitter/a/?chunk=fw1&part=2&parts=8", id: "fw1", part: 2, parts: 8, ok: true},
+		{channel: "emitter/a/?chunk=fw1&part=9&parts=8", id: "fw1", ok: true},
+		{channel: "emitter/a/?chunk=fw1&part=0&parts=8", id: "fw1", ok: true},
+		{channel: "emitter/a/?chunk=fw1", id: "fw1", ok: true},
+		{channel: "emitter/a/?part=1&parts=8", ok: false},
+		{channel: "emitter/a/", ok: false},
+	}
+
+	for _, tc := range tests {
+		channel := ParseChannel([]byte(tc.channel))
+		id, part, parts, ok := channel.Chunk()
+
+		assert.Equal(t, tc.id, id, tc.channel)
+		assert.Equal(t, tc.part, part, tc.channel)
+		assert.Equal(t, tc.parts, parts, tc.channel)
+		assert.Equal(t, tc.ok, ok, tc.channel)
+	}
+}
+
 func TestGetChannelWindow(t *testing.T) {
 	tests := []struct {
 		channel string
@@ -262,3 +524,22 @@ func TestChannelString(t *testing.T) {
 		assert.Equal(t, tc.channel, channel.String())
 	}
 }
+
+func TestParseChannelEscaped(t *testing.T) {
+	plain := ParseChannel([]byte("emitter/a/b/"))
+	escaped := ParseChannel([]byte("emitter/a/%62/"))
+	assert.Equal(t, plain.Query, escaped.Query)
+
+	lower := ParseChannel([]byte("emitter/a/x%2fy/"))
+	upper := ParseChannel([]byte("emitter/a/x%2Fy/"))
+	split := ParseChannel([]byte("emitter/a/x/y/"))
+	assert.Equal(t, ChannelStatic, upper.ChannelType)
+	assert.Equal(t, lower.Query, upper.Query)
+	assert.Len(t, upper.Query, 2)
+	assert.NotEqual(t, split.Query, upper.Query)
+
+	wildcard := ParseChannel([]byte("emitter/a/+/"))
+	plus := ParseChannel([]byte("emitter/a/%2B/"))
+	assert.Equal(t, ChannelStatic, plus.ChannelType)
+	assert.NotEqual(t, wildcard.Query, plus.Query)
+}
@@ -0,0 +1,127 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package security
+
+import (
+	"strings"
+
+	"github.com/emitter-io/emitter/internal/config"
+)
+
+const hexDigits = "0123456789ABCDEF"
+
+// EscapeChannel escapes an arbitrary value so it can be used as a single part of a channel.
+// Every byte outside of the set of valid channel characters, including the separator and
+// the wildcards, is percent-encoded (e.g: "a/b" becomes "a%2Fb").
+func EscapeChannel(part string) string {
+	var out strings.Builder
+	out.Grow(len(part))
+	for i := 0; i < len(part); i++ {
+		if b := part[i]; isChannelChar(b) {
+			out.WriteByte(b)
+		} else {
+			out.WriteByte('%')
+			out.WriteByte(hexDigits[b>>4])
+			out.WriteByte(hexDigits[b&15])
+		}
+	}
+	return out.String()
+}
+
+// UnescapeChannel decodes a percent-encoded part of a channel.
+func UnescapeChannel(part string) (string, bool) {
+	out, ok := unescape([]byte(part))
+	return string(out), ok
+}
+
+// CanonicalPart returns the canonical form of a part of a channel, so the different
+// escapings of the same value (e.g: "%2f", "%2F") are treated alike.
+func CanonicalPart(part string) string {
+	if strings.IndexByte(part, '%') < 0 {
+		return part
+	}
+
+	if value, ok := UnescapeChannel(part); ok {
+		return EscapeChannel(value)
+	}
+	return part
+}
+
+// IsOption checks whether the text can be carried as the key or the value of a channel
+// option, which is alphanumeric.
+func IsOption(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if !isOptionChar(text[i]) {
+			return false
+		}
+	}
+	return len(text) > 0
+}
+
+// unescape decodes the percent-encoded bytes.
+func unescape(text []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		if text[i] != '%' {
+			out = append(out, text[i])
+			continue
+		}
+
+		if i+2 >= len(text) || !isHex(text[i+1]) || !isHex(text[i+2]) {
+			return nil, false
+		}
+
+		out = append(out, fromHex(text[i+1])<<4|fromHex(text[i+2]))
+		i += 2
+	}
+	return out, true
+}
+
+// isChannelChar checks whether a byte can be used in a channel without being escaped.
+func isChannelChar(b byte) bool {
+	return (b >= 45 && b <= 58 && b != config.ChannelSeparator) || (b >= 65 && b <= 122) || b == 36
+}
+
+// isOptionChar checks whether a byte can be part of the key or the value of an option.
+func isOptionChar(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z')
+}
+
+// isSelectorChar checks whether a byte can be part of the selector of a filter option, in
+// addition to the option characters.
+func isSelectorChar(b byte) bool {
+	switch b {
+	case ' ', '=', '!', '<', '>', '\'', '(', ')', '.', '-', '_', '%':
+		return true
+	}
+	return false
+}
+
+// isHex checks whether a byte is a hexadecimal digit.
+func isHex(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+// fromHex converts a hexadecimal digit to its value.
+func fromHex(b byte) byte {
+	switch {
+	case b >= 'a':
+		return b - 'a' + 10
+	case b >= 'A':
+		return b - 'A' + 10
+	default:
+		return b - '0'
+	}
+}
@@ -0,0 +1,62 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package security
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeChannel(t *testing.T) {
+	tests := []struct {
+		value   string
+		escaped string
+	}{
+		{value: "abc", escaped: "abc"},
+		{value: "a/b", escaped: "a%2Fb"},
+		{value: "+#*", escaped: "%2B%23%2A"},
+		{value: "100%", escaped: "100%25"},
+		{value: "a b?", escaped: "a%20b%3F"},
+		{value: "\x00\xff", escaped: "%00%FF"},
+		{value: "6ba7b810-9dad-11d1", escaped: "6ba7b810-9dad-11d1"},
+	}
+
+	for _, tc := range tests {
+		escaped := EscapeChannel(tc.value)
+		assert.Equal(t, tc.escaped, escaped)
+
+		value, ok := UnescapeChannel(escaped)
+		assert.True(t, ok)
+		assert.Equal(t, tc.value, value)
+
+		channel := ParseChannel([]byte("emitter/" + escaped + "/"))
+		assert.Equal(t, ChannelStatic, channel.ChannelType, tc.value)
+	}
+}
+
+func TestUnescapeChannel_Invalid(t *testing.T) {
+	for _, v := range []string{"%", "%2", "%zz", "a%g1"} {
+		_, ok := UnescapeChannel(v)
+		assert.False(t, ok, v)
+	}
+}
+
+func TestCanonicalPart(t *testing.T) {
+	assert.Equal(t, "abc", CanonicalPart("abc"))
+	assert.Equal(t, "abc", CanonicalPart("%61bc"))
+	assert.Equal(t, "a%2Fb", CanonicalPart("a%2fb"))
+	assert.Equal(t, "a%zz", CanonicalPart("a%zz"))
+}
@@ -171,6 +171,8 @@ func (k Key) ValidateChannel(ch *Channel) bool {
 	}
 
 	for idx, part := range parts {
+		part = CanonicalPart(part)
+		parts[idx] = part
 		if ((targetPath >> (22 - uint32(idx))) & 1) == 1 {
 			if part == "+" {
 				return false
@@ -211,6 +213,8 @@ func (k Key) SetTarget(channel string) error {
 
 	// Encode all of the parts
 	for idx, part := range parts {
+		part = CanonicalPart(part)
+		parts[idx] = part
 		if part != "+" && part != "#" {
 			bitPath |= uint32(1 << (22 - uint16(idx)))
 		}
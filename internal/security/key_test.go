@@ -152,3 +152,17 @@ func TestKey(t *testing.T) {
 	assert.True(t, key.IsMaster())
 	assert.True(t, key.HasPermission(AllowMaster))
 }
+
+func TestKey_TargetEscaped(t *testing.T) {
+	key := Key(make([]byte, 24))
+	assert.NoError(t, key.SetTarget("a/b%2fc/#/"))
+
+	assert.True(t, key.ValidateChannel(ParseChannel([]byte("key/a/b%2Fc/"))))
+	assert.True(t, key.ValidateChannel(ParseChannel([]byte("key/a/b%2fc/d/"))))
+	assert.False(t, key.ValidateChannel(ParseChannel([]byte("key/a/b/c/"))))
+
+	// An escaped wildcard in the target is not a wildcard
+	assert.NoError(t, key.SetTarget("a/%2b/"))
+	assert.True(t, key.ValidateChannel(ParseChannel([]byte("key/a/%2B/"))))
+	assert.False(t, key.ValidateChannel(ParseChannel([]byte("key/a/x/"))))
+}
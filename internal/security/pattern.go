@@ -0,0 +1,78 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package security
+
+import (
+	"strings"
+)
+
+// Pattern represents a channel pattern (e.g: "sensors/+/"), in the canonical escaped form
+// of its parts. A '+' matches any single part and a pattern also matches all of the
+// channels it prefixes, so the empty pattern matches every channel.
+type Pattern []string
+
+// ParsePattern parses a channel pattern.
+func ParsePattern(pattern string) Pattern {
+	return Pattern(SplitChannel(pattern))
+}
+
+// ParsePatterns parses a comma-separated list of channel patterns (e.g: "a/+/,b/"), the
+// blank ones being skipped.
+func ParsePatterns(list string) (patterns []Pattern) {
+	for _, pattern := range strings.Split(list, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, ParsePattern(pattern))
+		}
+	}
+	return
+}
+
+// SplitChannel splits a channel into its parts, in their canonical escaped form, so the
+// different escapings of the same value match alike.
+func SplitChannel(channel string) []string {
+	if channel = strings.Trim(channel, "/"); channel == "" {
+		return nil
+	}
+
+	parts := strings.Split(channel, "/")
+	for i, part := range parts {
+		parts[i] = CanonicalPart(part)
+	}
+	return parts
+}
+
+// Match checks whether the parts of a channel, as split by SplitChannel, match the pattern.
+func (p Pattern) Match(channel []string) bool {
+	if len(p) > len(channel) {
+		return false
+	}
+
+	for i, part := range p {
+		if part != "+" && part != channel[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchAny checks whether the parts of a channel match any of the patterns.
+func MatchAny(patterns []Pattern, channel []string) bool {
+	for _, pattern := range patterns {
+		if pattern.Match(channel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package security
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePatterns(t *testing.T) {
+	assert.Nil(t, ParsePatterns(""))
+	assert.Equal(t, []Pattern{{"a", "+"}, {"b"}}, ParsePatterns(" a/+/ ,, /b/"))
+	assert.Equal(t, Pattern{"a%2Fb"}, ParsePattern("a%2fb/"))
+	assert.Len(t, ParsePattern("/"), 0)
+}
+
+func TestPattern_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		channel string
+		match   bool
+	}{
+		{pattern: "a/", channel: "a/", match: true},
+		{pattern: "a/", channel: "a/b/c/", match: true},
+		{pattern: "a/+/c/", channel: "a/b/c/", match: true},
+		{pattern: "a/+/c/", channel: "a/b/", match: false},
+		{pattern: "a/b/", channel: "a/c/", match: false},
+		{pattern: "a%2Fb/", channel: "a%2fb/c/", match: true},
+		{pattern: "", channel: "a/", match: true},
+		{pattern: "a/", channel: "", match: false},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.match, ParsePattern(tc.pattern).Match(SplitChannel(tc.channel)), tc.pattern+" "+tc.channel)
+	}
+
+	patterns := ParsePatterns("a/,b/+/")
+	assert.True(t, MatchAny(patterns, SplitChannel("b/c/")))
+	assert.False(t, MatchAny(patterns, SplitChannel("b/")))
+	assert.False(t, MatchAny(nil, SplitChannel("a/")))
+}
+
+func TestIsOption(t *testing.T) {
+	assert.True(t, IsOption("abc123"))
+	assert.False(t, IsOption(""))
+	assert.False(t, IsOption("a-b"))
+	assert.False(t, IsOption("é"))
+}
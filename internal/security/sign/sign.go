@@ -0,0 +1,119 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// TrailerSize is the number of bytes appended to a signed payload: the signing time, the
+// node which signed it and the signature itself.
+const TrailerSize = 8 + 8 + ed25519.SignatureSize
+
+var (
+	errInvalidKey       = errors.New("sign: the key must be a base64-encoded 32-byte seed")
+	errNotSigned        = errors.New("sign: the payload is not signed")
+	errUnknownSigner    = errors.New("sign: the payload was signed by an unknown node")
+	errInvalidSignature = errors.New("sign: the signature is invalid")
+)
+
+// Signer signs the messages delivered by a node.
+type Signer struct {
+	node uint64             // The node which signs the messages.
+	key  ed25519.PrivateKey // The private key of the node.
+}
+
+// New creates a new signer for a node from a base64-encoded seed. If no seed is
+// specified, a new key is generated.
+func New(node uint64, seed string) (*Signer, error) {
+	if seed == "" {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Signer{node: node, key: key}, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(seed)
+	if err != nil || len(b) != ed25519.SeedSize {
+		return nil, errInvalidKey
+	}
+
+	return &Signer{
+		node: node,
+		key:  ed25519.NewKeyFromSeed(b),
+	}, nil
+}
+
+// Node returns the node which signs the messages.
+func (s *Signer) Node() uint64 {
+	return s.node
+}
+
+// PublicKey returns the public key which verifies the signatures of this node.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Sign signs a payload sent on a channel at a specific time and returns the payload,
+// followed by the signing time, the node and the signature.
+func (s *Signer) Sign(channel, payload []byte, t time.Time) []byte {
+	out := make([]byte, len(payload)+TrailerSize)
+	copy(out, payload)
+
+	n := len(payload)
+	binary.BigEndian.PutUint64(out[n:n+8], uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(out[n+8:n+16], s.node)
+	copy(out[n+16:], ed25519.Sign(s.key, digestOf(channel, out[:n+16])))
+	return out
+}
+
+// Verify verifies a signed payload received on a channel, using the lookup function to
+// find the public key of the node which signed it. It returns the original payload, the
+// node and the time of the signature.
+func Verify(channel, signed []byte, lookup func(node uint64) ed25519.PublicKey) ([]byte, uint64, time.Time, error) {
+	if len(signed) < TrailerSize {
+		return nil, 0, time.Time{}, errNotSigned
+	}
+
+	n := len(signed) - ed25519.SignatureSize
+	node := binary.BigEndian.Uint64(signed[n-8 : n])
+	when := time.Unix(0, int64(binary.BigEndian.Uint64(signed[n-16:n-8])))
+	key := lookup(node)
+	if len(key) != ed25519.PublicKeySize {
+		return nil, node, when, errUnknownSigner
+	}
+
+	if !ed25519.Verify(key, digestOf(channel, signed[:n]), signed[n:]) {
+		return nil, node, when, errInvalidSignature
+	}
+
+	return signed[:n-16], node, when, nil
+}
+
+// digestOf returns the signed bytes, which is the length-prefixed channel followed by the
+// payload and the trailer without the signature.
+func digestOf(channel, body []byte) []byte {
+	out := make([]byte, 2, 2+len(channel)+len(body))
+	binary.BigEndian.PutUint16(out, uint16(len(channel)))
+	out = append(out, channel...)
+	return append(out, body...)
+}
@@ -0,0 +1,97 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package sign
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	seed := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	tests := []struct {
+		seed string
+		ok   bool
+	}{
+		{seed: "", ok: true},
+		{seed: seed, ok: true},
+		{seed: "abc", ok: false},
+		{seed: "!!", ok: false},
+	}
+
+	for _, tc := range tests {
+		s, err := New(1, tc.seed)
+		assert.Equal(t, tc.ok, err == nil, tc.seed)
+		if tc.ok {
+			assert.Equal(t, uint64(1), s.Node())
+			assert.Len(t, s.PublicKey(), ed25519.PublicKeySize)
+		}
+	}
+
+	// The same seed must give the same key
+	s1, _ := New(1, seed)
+	s2, _ := New(2, seed)
+	assert.Equal(t, s1.PublicKey(), s2.PublicKey())
+}
+
+func TestSignVerify(t *testing.T) {
+	s, err := New(42, "")
+	assert.NoError(t, err)
+
+	other, err := New(42, "")
+	assert.NoError(t, err)
+
+	now := time.Unix(0, 1589000000123456789)
+	signed := s.Sign([]byte("a/b/c/"), []byte("hello"), now)
+	assert.Len(t, signed, 5+TrailerSize)
+
+	lookup := func(node uint64) ed25519.PublicKey {
+		if node == 42 {
+			return s.PublicKey()
+		}
+		return nil
+	}
+
+	tampered := append([]byte{}, signed...)
+	tampered[0] = 'j'
+
+	tests := []struct {
+		channel string
+		signed  []byte
+		lookup  func(uint64) ed25519.PublicKey
+		err     error
+	}{
+		{channel: "a/b/c/", signed: signed, lookup: lookup},
+		{channel: "a/b/", signed: signed, lookup: lookup, err: errInvalidSignature},
+		{channel: "a/b/c/", signed: tampered, lookup: lookup, err: errInvalidSignature},
+		{channel: "a/b/c/", signed: []byte("hello"), lookup: lookup, err: errNotSigned},
+		{channel: "a/b/c/", signed: other.Sign([]byte("a/b/c/"), []byte("hello"), now), lookup: lookup, err: errInvalidSignature},
+		{channel: "a/b/c/", signed: signed, lookup: func(uint64) ed25519.PublicKey { return nil }, err: errUnknownSigner},
+	}
+
+	for _, tc := range tests {
+		payload, node, when, err := Verify([]byte(tc.channel), tc.signed, tc.lookup)
+		assert.Equal(t, tc.err, err)
+		if tc.err == nil {
+			assert.Equal(t, "hello", string(payload))
+			assert.Equal(t, uint64(42), node)
+			assert.Equal(t, now.UnixNano(), when.UnixNano())
+		}
+	}
+}
@@ -0,0 +1,162 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package access
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// The reasons a connection is refused.
+var (
+	ErrDenied  = errors.New("access: the address is not allowed on the listener")
+	ErrLimited = errors.New("access: too many connections from the address")
+)
+
+// Policy represents the addresses allowed to connect to a listener.
+type Policy struct {
+	Allow []*net.IPNet // The networks allowed, or nil to allow any which is not denied.
+	Deny  []*net.IPNet // The networks denied, which take precedence over the allowed ones.
+}
+
+// Allows returns whether the address is allowed by the policy.
+func (p *Policy) Allows(ip net.IP) bool {
+	if p == nil {
+		return true
+	}
+
+	if contains(p.Deny, ip) {
+		return false
+	}
+	return p.Allow == nil || contains(p.Allow, ip)
+}
+
+// contains returns whether any of the networks contains the address.
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ------------------------------------------------------------------------------------
+
+// Guard enforces the access policy of each listener along with the maximum number of
+// connections per address and per contract, as they are accepted.
+type Guard struct {
+	sync.Mutex
+	policies       map[string]*Policy // The policies, by listener.
+	maxPerIP       int                // The maximum number of connections per address, zero if unlimited.
+	maxPerContract int                // The maximum number of connections per contract, zero if unlimited.
+	addrs          map[string]int     // The number of connections per address.
+	contracts      map[uint32]int     // The number of connections per contract.
+}
+
+// New creates a new guard, which admits every connection until configured.
+func New() *Guard {
+	return &Guard{
+		policies:  make(map[string]*Policy),
+		addrs:     make(map[string]int),
+		contracts: make(map[uint32]int),
+	}
+}
+
+// Configure replaces the policies of the listeners and the limits. The connections already
+// admitted are kept.
+func (g *Guard) Configure(policies map[string]*Policy, maxPerIP, maxPerContract int) {
+	g.Lock()
+	defer g.Unlock()
+	g.policies = policies
+	g.maxPerIP = maxPerIP
+	g.maxPerContract = maxPerContract
+}
+
+// Admit admits a new connection on a listener from the address of its client. Once admitted,
+// the function returned must be called when the connection is closed.
+func (g *Guard) Admit(listener string, addr net.Addr) (func(), error) {
+	ip := ipOf(addr)
+	if ip == nil {
+		return func() {}, nil
+	}
+
+	g.Lock()
+	defer g.Unlock()
+	if !g.policies[listener].Allows(ip) {
+		return nil, ErrDenied
+	}
+
+	if g.maxPerIP <= 0 {
+		return func() {}, nil
+	}
+
+	key := ip.String()
+	if g.addrs[key] >= g.maxPerIP {
+		return nil, ErrLimited
+	}
+
+	g.addrs[key]++
+	var once sync.Once
+	return func() {
+		once.Do(func() { g.release(key) })
+	}, nil
+}
+
+// release releases a connection of an address.
+func (g *Guard) release(key string) {
+	g.Lock()
+	defer g.Unlock()
+	if g.addrs[key]--; g.addrs[key] <= 0 {
+		delete(g.addrs, key)
+	}
+}
+
+// AdmitContract admits a connection for a contract, once it is known. Once admitted, the
+// connection must be released with ReleaseContract when closed.
+func (g *Guard) AdmitContract(contract uint32) bool {
+	g.Lock()
+	defer g.Unlock()
+	if g.maxPerContract > 0 && g.contracts[contract] >= g.maxPerContract {
+		return false
+	}
+
+	g.contracts[contract]++
+	return true
+}
+
+// ReleaseContract releases a connection of a contract.
+func (g *Guard) ReleaseContract(contract uint32) {
+	g.Lock()
+	defer g.Unlock()
+	if g.contracts[contract]--; g.contracts[contract] <= 0 {
+		delete(g.contracts, contract)
+	}
+}
+
+// ipOf returns the IP address of a network address, if it has one.
+func ipOf(addr net.Addr) net.IP {
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		return v.IP
+	case *net.UDPAddr:
+		return v.IP
+	case *net.IPAddr:
+		return v.IP
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package access
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func networks(cidrs ...string) (out []*net.IPNet) {
+	for _, cidr := range cidrs {
+		_, network, _ := net.ParseCIDR(cidr)
+		out = append(out, network)
+	}
+	return
+}
+
+func addr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}
+}
+
+func TestPolicy(t *testing.T) {
+	var none *Policy
+	assert.True(t, none.Allows(net.ParseIP("1.2.3.4")))
+
+	p := &Policy{
+		Allow: networks("10.0.0.0/8"),
+		Deny:  networks("10.0.0.0/24"),
+	}
+	assert.True(t, p.Allows(net.ParseIP("10.1.0.1")))
+	assert.False(t, p.Allows(net.ParseIP("10.0.0.1")))
+	assert.False(t, p.Allows(net.ParseIP("192.168.0.1")))
+
+	p = &Policy{Deny: networks("192.168.0.0/16")}
+	assert.True(t, p.Allows(net.ParseIP("10.1.0.1")))
+	assert.False(t, p.Allows(net.ParseIP("192.168.0.1")))
+}
+
+func TestGuard_Admit(t *testing.T) {
+	g := New()
+	release, err := g.Admit("tcp", addr("192.168.0.1"))
+	assert.NoError(t, err)
+	release()
+
+	g.Configure(map[string]*Policy{
+		"tls": {Deny: networks("192.168.0.0/16")},
+	}, 2, 0)
+
+	_, err = g.Admit("tls", addr("192.168.0.1"))
+	assert.Equal(t, ErrDenied, err)
+
+	// The addresses are limited across the listeners
+	r1, err := g.Admit("tcp", addr("192.168.0.1"))
+	assert.NoError(t, err)
+	r2, err := g.Admit("tcp", addr("192.168.0.1"))
+	assert.NoError(t, err)
+	_, err = g.Admit("tcp", addr("192.168.0.1"))
+	assert.Equal(t, ErrLimited, err)
+	_, err = g.Admit("tcp", addr("192.168.0.2"))
+	assert.NoError(t, err)
+
+	// Releasing twice only releases once
+	r1()
+	r1()
+	assert.Equal(t, 1, g.addrs["192.168.0.1"])
+	r2()
+	assert.NotContains(t, g.addrs, "192.168.0.1")
+
+	// The addresses without an IP are admitted
+	_, err = g.Admit("tcp", &net.UnixAddr{Name: "sock"})
+	assert.NoError(t, err)
+}
+
+func TestGuard_AdmitContract(t *testing.T) {
+	g := New()
+	assert.True(t, g.AdmitContract(1))
+	g.ReleaseContract(1)
+
+	g.Configure(nil, 0, 1)
+	assert.True(t, g.AdmitContract(1))
+	assert.False(t, g.AdmitContract(1))
+	assert.True(t, g.AdmitContract(2))
+
+	g.ReleaseContract(1)
+	assert.True(t, g.AdmitContract(1))
+}
@@ -0,0 +1,129 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/security"
+)
+
+const maxListed = 1000 // The maximum number of channels listed at once.
+
+// The orderings of the listed channels, by their name.
+var orderings = map[string]func(a, b *ChannelInfo) bool{
+	"rate":        func(a, b *ChannelInfo) bool { return a.Rate > b.Rate },
+	"subscribers": func(a, b *ChannelInfo) bool { return a.Subscribers > b.Subscribers },
+	"messages":    func(a, b *ChannelInfo) bool { return a.Messages > b.Messages },
+	"bytes":       func(a, b *ChannelInfo) bool { return a.Bytes > b.Bytes },
+	"idle":        func(a, b *ChannelInfo) bool { return a.LastSeen < b.LastSeen },
+}
+
+// Filter represents the criteria of the channels to list.
+type Filter struct {
+	Contract uint32        // The contract of the channels, any if zero.
+	Pattern  string        // The pattern the channels must match (e.g: 'sensor/+/').
+	Idle     time.Duration // The minimum duration without any activity on the channels.
+	Order    string        // The ordering of the channels, by rate if not specified.
+	Limit    int           // The maximum number of channels listed.
+}
+
+// Channels lists the channels tracked on this node which match the filter, so the hot
+// channels and the dead ones can be spotted.
+func (s *Service) Channels(filter Filter) []ChannelInfo {
+	pattern := security.ParsePattern(filter.Pattern)
+	before := time.Now().Add(-filter.Idle).Unix()
+
+	out := make([]ChannelInfo, 0, 16)
+	s.each(func(k channelKey, c *channel) {
+		if (filter.Contract == 0 || filter.Contract == k.contract) &&
+			(filter.Idle <= 0 || atomic.LoadInt64(&c.lastSeen) <= before) &&
+			pattern.Match(security.SplitChannel(k.channel)) {
+			out = append(out, c.info(k))
+		}
+	})
+
+	less, ok := orderings[filter.Order]
+	if !ok {
+		less = orderings["rate"]
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if less(&out[i], &out[j]) != less(&out[j], &out[i]) {
+			return less(&out[i], &out[j])
+		}
+		return out[i].Channel < out[j].Channel
+	})
+
+	if filter.Limit > 0 && len(out) > filter.Limit {
+		out = out[:filter.Limit]
+	}
+	return out
+}
+
+// onChannels occurs when a new HTTP request listing the channels which match a pattern
+// is received.
+func (s *Service) onChannels(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := Filter{
+		Pattern: query.Get("pattern"),
+		Order:   query.Get("sort"),
+		Limit:   defaultTop,
+	}
+
+	if _, ok := orderings[filter.Order]; filter.Order != "" && !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if v := query.Get("contract"); v != "" {
+		contract, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		filter.Contract = uint32(contract)
+	}
+
+	if v := query.Get("idle"); v != "" {
+		idle, err := strconv.Atoi(v)
+		if err != nil || idle < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		filter.Idle = time.Duration(idle) * time.Second
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if filter.Limit > maxListed {
+		filter.Limit = maxListed
+	}
+
+	resp, _ := json.Marshal(s.Channels(filter))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
@@ -0,0 +1,94 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalytics_Channels(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	s.OnSubscribe(newTestSubscription(1, "a/b/"))
+	s.OnSubscribe(newTestSubscription(1, "a/c/"))
+	s.OnSubscribe(newTestSubscription(1, "a/c/"))
+	s.OnSubscribe(newTestSubscription(2, "a/d/"))
+	s.OnPublish(message.New(message.Ssid{1, 1}, []byte("a/b/"), []byte("hello")), 1)
+	s.OnPublish(message.New(message.Ssid{1, 1}, []byte("x/"), []byte("hi")), 0)
+	s.fetch(2, []byte("a/d/")).lastSeen = time.Now().Add(-time.Hour).Unix()
+
+	tests := []struct {
+		filter   Filter
+		channels []string
+	}{
+		{filter: Filter{Pattern: "a/", Order: "subscribers"}, channels: []string{"a/c/", "a/b/", "a/d/"}},
+		{filter: Filter{Pattern: "a/+/", Contract: 1, Order: "bytes"}, channels: []string{"a/b/", "a/c/"}},
+		{filter: Filter{Pattern: "a/c/"}, channels: []string{"a/c/"}},
+		{filter: Filter{Pattern: "/", Order: "messages", Limit: 2}, channels: []string{"a/b/", "x/"}},
+		{filter: Filter{Pattern: "a/", Idle: time.Minute}, channels: []string{"a/d/"}},
+		{filter: Filter{Pattern: "b/"}, channels: nil},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.channels, channelsOf(s.Channels(tc.filter)), tc.filter.Pattern)
+	}
+
+	info := s.Channels(Filter{Pattern: "a/b/"})[0]
+	assert.Equal(t, int64(5), info.Bytes)
+	assert.Equal(t, int64(1), info.Messages)
+	assert.Equal(t, int64(1), info.Subscribers)
+}
+
+func TestAnalytics_OnChannels(t *testing.T) {
+	tests := []struct {
+		query string
+		code  int
+		count int
+	}{
+		{query: "?pattern=a/&sort=abc", code: 400},
+		{query: "?pattern=a/&contract=abc", code: 400},
+		{query: "?pattern=a/&idle=-1", code: 400},
+		{query: "?pattern=a/&limit=0", code: 400},
+		{query: "?pattern=a/", code: 200, count: 2},
+		{query: "?pattern=a/&contract=2", code: 200, count: 0},
+		{query: "?pattern=a/&sort=idle&limit=1", code: 200, count: 1},
+	}
+
+	s := New()
+	defer s.Close()
+	s.OnSubscribe(newTestSubscription(1, "a/b/"))
+	s.OnSubscribe(newTestSubscription(1, "a/c/"))
+
+	for _, tc := range tests {
+		req, _ := http.NewRequest("GET", "/admin/analytics"+tc.query, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.OnHTTP).ServeHTTP(rr, req)
+
+		assert.Equal(t, tc.code, rr.Code, tc.query)
+		if tc.code == 200 {
+			var resp []ChannelInfo
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Len(t, resp, tc.count)
+		}
+	}
+}
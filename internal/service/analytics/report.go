@@ -0,0 +1,134 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package analytics
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// The upper bounds of the fan-out histogram buckets, the last bucket is unbounded.
+var buckets = []struct {
+	max   int
+	label string
+}{
+	{0, "0"},
+	{1, "1"},
+	{10, "2-10"},
+	{100, "11-100"},
+	{1000, "101-1000"},
+	{-1, ">1000"},
+}
+
+// histogram represents a fan-out histogram, updated atomically.
+type histogram [6]int64
+
+// observe adds a fan-out observation to the histogram.
+func (h *histogram) observe(subscribers int) {
+	for i, b := range buckets {
+		if b.max < 0 || subscribers <= b.max {
+			atomic.AddInt64(&h[i], 1)
+			return
+		}
+	}
+}
+
+// buckets returns the buckets of the histogram.
+func (h *histogram) buckets() []Bucket {
+	out := make([]Bucket, 0, len(h))
+	for i, b := range buckets {
+		out = append(out, Bucket{
+			Fanout: b.label,
+			Count:  atomic.LoadInt64(&h[i]),
+		})
+	}
+	return out
+}
+
+// ------------------------------------------------------------------------------------
+
+// Report represents a subscription pattern analytics report.
+type Report struct {
+	Time          int64         `json:"time"`          // The unix time of the report.
+	Channels      int           `json:"channels"`      // The number of channels tracked.
+	Dropped       int64         `json:"dropped"`       // The number of events not tracked due to the limit.
+	TopByRate     []ChannelInfo `json:"topRate"`       // The channels with the highest message rate.
+	TopBySubs     []ChannelInfo `json:"topSubscribed"` // The channels with the most subscribers.
+	Orphaned      []ChannelInfo `json:"orphaned"`      // The channels published to without subscribers.
+	FanoutBuckets []Bucket      `json:"fanout"`        // The fan-out histogram of the publications.
+}
+
+// ChannelInfo represents the statistics of a channel.
+type ChannelInfo struct {
+	Contract    uint32  `json:"contract"`    // The contract of the channel.
+	Channel     string  `json:"channel"`     // The channel or subscription pattern.
+	Subscribers int64   `json:"subscribers"` // The number of direct subscribers on this node.
+	Messages    int64   `json:"messages"`    // The number of messages published.
+	Orphaned    int64   `json:"orphaned"`    // The number of messages published without subscribers.
+	Bytes       int64   `json:"bytes"`       // The number of bytes of the payloads published.
+	Rate        float64 `json:"rate"`        // The message rate, per second.
+	LastSeen    int64   `json:"lastSeen"`    // The unix time of the last activity.
+}
+
+// Bucket represents a single bucket of the fan-out histogram.
+type Bucket struct {
+	Fanout string `json:"subscribers"` // The range of subscribers of the bucket.
+	Count  int64  `json:"count"`       // The number of publications in the bucket.
+}
+
+// newReport creates a new report from the channel statistics.
+func newReport(infos []ChannelInfo, fanout *histogram, dropped int64, limit int) *Report {
+	return &Report{
+		Time:     time.Now().Unix(),
+		Channels: len(infos),
+		Dropped:  dropped,
+		TopByRate: top(infos, limit, func(c *ChannelInfo) float64 {
+			return c.Rate
+		}),
+		TopBySubs: top(infos, limit, func(c *ChannelInfo) float64 {
+			return float64(c.Subscribers)
+		}),
+		Orphaned: top(infos, limit, func(c *ChannelInfo) float64 {
+			if c.Subscribers > 0 {
+				return 0
+			}
+			return float64(c.Orphaned)
+		}),
+		FanoutBuckets: fanout.buckets(),
+	}
+}
+
+// top returns the channels with the highest non-zero score.
+func top(infos []ChannelInfo, limit int, score func(*ChannelInfo) float64) []ChannelInfo {
+	out := make([]ChannelInfo, 0, limit)
+	for i := range infos {
+		if score(&infos[i]) > 0 {
+			out = append(out, infos[i])
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if si, sj := score(&out[i]), score(&out[j]); si != sj {
+			return si > sj
+		}
+		return out[i].Channel < out[j].Channel
+	})
+
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		subscribers int
+		bucket      int
+	}{
+		{subscribers: 0, bucket: 0},
+		{subscribers: 1, bucket: 1},
+		{subscribers: 2, bucket: 2},
+		{subscribers: 10, bucket: 2},
+		{subscribers: 11, bucket: 3},
+		{subscribers: 1000, bucket: 4},
+		{subscribers: 1001, bucket: 5},
+	}
+
+	for _, tc := range tests {
+		var h histogram
+		h.observe(tc.subscribers)
+		assert.Equal(t, int64(1), h[tc.bucket], tc.subscribers)
+	}
+}
+
+func TestTop(t *testing.T) {
+	infos := []ChannelInfo{
+		{Channel: "a/", Subscribers: 1},
+		{Channel: "b/", Subscribers: 3},
+		{Channel: "c/", Subscribers: 0},
+		{Channel: "d/", Subscribers: 3},
+	}
+
+	out := top(infos, 2, func(c *ChannelInfo) float64 {
+		return float64(c.Subscribers)
+	})
+	assert.Equal(t, []string{"b/", "d/"}, channelsOf(out))
+}
@@ -0,0 +1,182 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+)
+
+const (
+	defaultSamples = 1440  // The default number of samples returned, a day at the default interval.
+	maxSamples     = 10080 // The maximum number of samples returned at once.
+)
+
+// Sample represents the statistics of a channel over a sampling interval.
+type Sample struct {
+	Time        int64   `json:"time"`        // The unix time at the end of the interval.
+	Subscribers int64   `json:"subscribers"` // The number of direct subscribers on the node.
+	Messages    int64   `json:"messages"`    // The number of messages published during the interval.
+	Rate        float64 `json:"rate"`        // The average message rate of the interval, per second.
+}
+
+// History represents the statistics retained for a channel within a time window.
+type History struct {
+	Contract uint32   `json:"contract"` // The contract of the channel.
+	Channel  string   `json:"channel"`  // The channel or subscription pattern.
+	Samples  []Sample `json:"samples"`  // The samples, from the oldest to the newest.
+}
+
+// retention represents the periodic persistence of the channel statistics.
+type retention struct {
+	store    storage.Storage    // The storage provider the samples are kept in.
+	interval time.Duration      // The interval between the samples.
+	ttl      time.Duration      // The duration the samples are kept for.
+	cancel   context.CancelFunc // The cancellation function.
+}
+
+// UseStorage enables the retention of the statistics of the channels, which are sampled
+// at every interval and kept in the storage provider for the specified duration.
+func (s *Service) UseStorage(store storage.Storage, interval, ttl time.Duration) {
+	s.Lock()
+	s.retained = &retention{
+		store:    store,
+		interval: interval,
+		ttl:      ttl,
+	}
+	s.Unlock()
+
+	s.retained.cancel = async.Repeat(context.Background(), interval, s.sample)
+}
+
+// sample persists the statistics of the channels which were active during the interval.
+func (s *Service) sample() {
+	now := time.Now().Unix()
+	seconds := s.retained.interval.Seconds()
+	msgs := make([]*message.Message, 0, 64)
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.Lock()
+		for k, c := range shard.channels {
+			messages, subscribers := atomic.LoadInt64(&c.messages), atomic.LoadInt64(&c.subscribers)
+			count := messages - c.sampled
+			if count == 0 && subscribers == 0 {
+				continue
+			}
+
+			c.sampled = messages
+			payload, _ := json.Marshal(&Sample{
+				Time:        now,
+				Subscribers: subscribers,
+				Messages:    count,
+				Rate:        float64(count) / seconds,
+			})
+
+			msg := message.New(message.NewSsidForStats(k.contract, []byte(k.channel)), []byte(k.channel), payload)
+			msg.TTL = uint32(s.retained.ttl.Seconds())
+			msgs = append(msgs, msg)
+		}
+		shard.Unlock()
+	}
+
+	// Store the samples outside of the lock, since the storage may be slow
+	for _, msg := range msgs {
+		if err := s.retained.store.Store(msg); err != nil {
+			logging.LogError("analytics", "storing the channel statistics", err)
+			return
+		}
+	}
+}
+
+// History returns the statistics retained for the channel within the time window, a zero
+// 'until' time meaning that the window is not bounded.
+func (s *Service) History(contract uint32, channel string, from, until time.Time, limit int) (*History, error) {
+	out := &History{
+		Contract: contract,
+		Channel:  channel,
+		Samples:  make([]Sample, 0, 64),
+	}
+
+	msgs, err := s.retained.store.Query(message.NewSsidForStats(contract, []byte(channel)), from, until, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range msgs {
+		var sample Sample
+		if string(m.Channel) == channel && json.Unmarshal(m.Payload, &sample) == nil {
+			out.Samples = append(out.Samples, sample)
+		}
+	}
+	return out, nil
+}
+
+// onHistory occurs when a new HTTP request for the statistics retained for a channel is
+// received, which requires its 'contract' and optionally a 'from' and 'until' unix time
+// and a 'limit' on the number of samples.
+func (s *Service) onHistory(w http.ResponseWriter, r *http.Request) {
+	if s.retained == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	contract, err := strconv.ParseUint(query.Get("contract"), 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var from, until int64
+	limit := defaultSamples
+	for name, value := range map[string]*int64{"from": &from, "until": &until} {
+		if v := query.Get(name); v != "" {
+			if *value, err = strconv.ParseInt(v, 10, 64); err != nil || *value < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if limit > maxSamples {
+		limit = maxSamples
+	}
+
+	history, err := s.History(uint32(contract), query.Get("channel"), time.Unix(from, 0), time.Unix(until, 0), limit)
+	if err != nil {
+		logging.LogError("analytics", "querying the channel statistics", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp, _ := json.Marshal(history)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
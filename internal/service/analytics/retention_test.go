@@ -0,0 +1,108 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore() storage.Storage {
+	store := storage.NewInMemory(nil)
+	store.Configure(nil)
+	return store
+}
+
+func TestAnalytics_Retention(t *testing.T) {
+	s := New()
+	defer s.Close()
+	s.UseStorage(newTestStore(), 10*time.Second, time.Hour)
+
+	s.OnSubscribe(newTestSubscription(1, "a/b/"))
+	s.OnSubscribe(newTestSubscription(1, "a/b/"))
+	s.OnPublish(message.New(message.Ssid{1, 1}, []byte("a/b/"), nil), 2)
+	s.OnPublish(message.New(message.Ssid{1, 1}, []byte("a/b/c/"), nil), 0)
+	s.sample()
+
+	// Only the new messages are counted by the following sample
+	s.OnPublish(message.New(message.Ssid{1, 1}, []byte("a/b/"), nil), 2)
+	s.OnPublish(message.New(message.Ssid{1, 1}, []byte("a/b/"), nil), 2)
+	s.sample()
+
+	zero := time.Unix(0, 0)
+	h, err := s.History(1, "a/b/", zero, zero, 10)
+	assert.NoError(t, err)
+	assert.Len(t, h.Samples, 2)
+	assert.Equal(t, int64(2), h.Samples[0].Subscribers)
+	assert.Equal(t, int64(1), h.Samples[0].Messages)
+	assert.Equal(t, int64(2), h.Samples[1].Messages)
+	assert.Equal(t, 0.2, h.Samples[1].Rate)
+
+	// The idle channels are not sampled again, while the sub-channels are kept apart
+	h, err = s.History(1, "a/b/c/", zero, zero, 10)
+	assert.NoError(t, err)
+	assert.Len(t, h.Samples, 1)
+
+	h, err = s.History(2, "a/b/", zero, zero, 10)
+	assert.NoError(t, err)
+	assert.Len(t, h.Samples, 0)
+}
+
+func TestAnalytics_OnHistory(t *testing.T) {
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{query: "?channel=a/", code: 400},
+		{query: "?channel=a/&contract=x", code: 400},
+		{query: "?channel=a/&contract=1&from=x", code: 400},
+		{query: "?channel=a/&contract=1&limit=0", code: 400},
+		{query: "?channel=a/&contract=1&from=1&until=2000000000", code: 200},
+		{query: "?channel=a/&contract=1", code: 200},
+	}
+
+	// Without the retention, the statistics of a channel can't be queried
+	s := New()
+	defer s.Close()
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/analytics?channel=a/&contract=1", nil)
+	http.HandlerFunc(s.OnHTTP).ServeHTTP(rr, req)
+	assert.Equal(t, 404, rr.Code)
+
+	s.UseStorage(newTestStore(), time.Hour, time.Hour)
+	s.OnSubscribe(newTestSubscription(1, "a/"))
+	s.sample()
+
+	for _, tc := range tests {
+		req, _ := http.NewRequest("GET", "/admin/analytics"+tc.query, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.OnHTTP).ServeHTTP(rr, req)
+
+		assert.Equal(t, tc.code, rr.Code, tc.query)
+		if tc.code == 200 {
+			var resp History
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, "a/", resp.Channel)
+			assert.Len(t, resp.Samples, 1)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+)
+
+const (
+	window      = 10 * time.Second // The interval used for computing the message rates.
+	idleTimeout = time.Hour        // The time after which an idle channel is forgotten.
+	maxChannels = 100000           // The maximum number of channels tracked.
+	defaultTop  = 10               // The default number of channels to report.
+	shardCount  = 32               // The number of shards of the channels tracked.
+)
+
+// Service represents a channel analytics service which keeps track of the publish and
+// subscribe activity on the local node. The channels are sharded by their hash and their
+// statistics updated atomically, so the publications do not contend on a single lock.
+type Service struct {
+	sync.Mutex
+	cancel   context.CancelFunc // The cancellation function.
+	shards   [shardCount]shard  // The channels tracked, sharded by their hash.
+	count    int64              // The number of channels tracked.
+	fanout   histogram          // The fan-out histogram of the publications.
+	dropped  int64              // The number of events dropped due to the limit.
+	retained *retention         // The retention of the statistics, if enabled.
+}
+
+// shard represents a shard of the channels tracked.
+type shard struct {
+	sync.RWMutex
+	channels map[channelKey]*channel // The channels of the shard.
+}
+
+// New creates a new analytics service.
+func New() *Service {
+	s := new(Service)
+	for i := range s.shards {
+		s.shards[i].channels = make(map[channelKey]*channel)
+	}
+
+	s.cancel = async.Repeat(context.Background(), window, s.rotate)
+	return s
+}
+
+// OnPublish records a publication along with the number of subscribers it was
+// delivered to.
+func (s *Service) OnPublish(m *message.Message, subscribers int) {
+	s.fanout.observe(subscribers)
+	if c := s.fetch(m.Contract(), m.Channel); c != nil {
+		atomic.AddInt64(&c.messages, 1)
+		atomic.AddInt64(&c.bytes, m.Size())
+		atomic.AddInt64(&c.current, 1)
+		atomic.StoreInt64(&c.lastSeen, time.Now().Unix())
+		if subscribers == 0 {
+			atomic.AddInt64(&c.orphaned, 1)
+		}
+	}
+}
+
+// OnSubscribe records a new direct subscription.
+func (s *Service) OnSubscribe(ev *event.Subscription) {
+	if c := s.fetch(ev.Ssid.Contract(), ev.Channel); c != nil {
+		atomic.AddInt64(&c.subscribers, 1)
+		atomic.StoreInt64(&c.lastSeen, time.Now().Unix())
+	}
+}
+
+// OnUnsubscribe records the removal of a direct subscription.
+func (s *Service) OnUnsubscribe(ev *event.Subscription) {
+	key := newChannelKey(ev.Ssid.Contract(), ev.Channel)
+	shard := s.shardOf(key)
+	shard.RLock()
+	c, ok := shard.channels[key]
+	shard.RUnlock()
+	if !ok {
+		return
+	}
+
+	for {
+		n := atomic.LoadInt64(&c.subscribers)
+		if n <= 0 {
+			return
+		}
+
+		if atomic.CompareAndSwapInt64(&c.subscribers, n, n-1) {
+			atomic.StoreInt64(&c.lastSeen, time.Now().Unix())
+			return
+		}
+	}
+}
+
+// Report computes the analytics report, limiting each of the rankings to the
+// specified number of channels.
+func (s *Service) Report(limit int) *Report {
+	infos := make([]ChannelInfo, 0, atomic.LoadInt64(&s.count))
+	s.each(func(k channelKey, c *channel) {
+		infos = append(infos, c.info(k))
+	})
+
+	return newReport(infos, &s.fanout, atomic.LoadInt64(&s.dropped), limit)
+}
+
+// OnHTTP occurs when a new HTTP analytics request is received.
+func (s *Service) OnHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// A channel queries the statistics retained for it and a pattern lists the channels
+	// matching it, instead of the current report
+	switch {
+	case r.URL.Query().Get("channel") != "":
+		s.onHistory(w, r)
+		return
+	case r.URL.Query().Get("pattern") != "":
+		s.onChannels(w, r)
+		return
+	}
+
+	limit := defaultTop
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	resp, _ := json.Marshal(s.Report(limit))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// Close closes the service.
+func (s *Service) Close() error {
+	s.cancel()
+	if s.retained != nil {
+		s.retained.cancel()
+	}
+	return nil
+}
+
+// fetch gets or creates a channel entry. If the maximum number of channels is reached,
+// this returns nil.
+func (s *Service) fetch(contract uint32, name []byte) *channel {
+	key := newChannelKey(contract, name)
+	shard := s.shardOf(key)
+	shard.RLock()
+	c, ok := shard.channels[key]
+	shard.RUnlock()
+	if ok {
+		return c
+	}
+
+	shard.Lock()
+	defer shard.Unlock()
+	if c, ok := shard.channels[key]; ok {
+		return c
+	}
+
+	if atomic.LoadInt64(&s.count) >= maxChannels {
+		atomic.AddInt64(&s.dropped, 1)
+		return nil
+	}
+
+	c = new(channel)
+	shard.channels[key] = c
+	atomic.AddInt64(&s.count, 1)
+	return c
+}
+
+// shardOf returns the shard of the channel.
+func (s *Service) shardOf(key channelKey) *shard {
+	return &s.shards[hashOf(key.contract, key.channel)%shardCount]
+}
+
+// each calls the function on each of the channels tracked, under the read lock of
+// their shard. The statistics of the channels must be read atomically.
+func (s *Service) each(fn func(channelKey, *channel)) {
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.RLock()
+		for k, c := range shard.channels {
+			fn(k, c)
+		}
+		shard.RUnlock()
+	}
+}
+
+// rotate closes the current measurement window, computing the message rates and
+// forgetting the channels which were idle for too long.
+func (s *Service) rotate() {
+	expiry := time.Now().Add(-idleTimeout).Unix()
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.Lock()
+		for k, c := range shard.channels {
+			c.rate = float64(atomic.SwapInt64(&c.current, 0)) / window.Seconds()
+			if atomic.LoadInt64(&c.subscribers) == 0 && atomic.LoadInt64(&c.lastSeen) < expiry {
+				delete(shard.channels, k)
+				atomic.AddInt64(&s.count, -1)
+			}
+		}
+		shard.Unlock()
+	}
+}
+
+// hashOf returns the 32-bit FNV-1a hash of the channel of a contract.
+func hashOf(contract uint32, name string) uint32 {
+	h := uint32(2166136261) ^ contract
+	for i := 0; i < len(name); i++ {
+		h ^= uint32(name[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// ------------------------------------------------------------------------------------
+
+// channelKey represents a key of a channel, scoped by its contract.
+type channelKey struct {
+	contract uint32
+	channel  string
+}
+
+// newChannelKey creates a new channel key.
+func newChannelKey(contract uint32, name []byte) channelKey {
+	return channelKey{
+		contract: contract,
+		channel:  string(name),
+	}
+}
+
+// channel represents the statistics tracked for a single channel. The counters are updated
+// atomically, while the rate and the sample are guarded by the lock of the shard.
+type channel struct {
+	subscribers int64   // The number of direct subscribers.
+	messages    int64   // The number of messages published.
+	orphaned    int64   // The number of messages published without any subscriber.
+	bytes       int64   // The number of bytes of the payloads published.
+	current     int64   // The number of messages published in the current window.
+	rate        float64 // The message rate of the previous window.
+	sampled     int64   // The number of messages published at the previous sample.
+	lastSeen    int64   // The unix time of the last activity.
+}
+
+// info returns the public information about the channel, must be called under the lock
+// of its shard.
+func (c *channel) info(k channelKey) ChannelInfo {
+	return ChannelInfo{
+		Contract:    k.contract,
+		Channel:     k.channel,
+		Subscribers: atomic.LoadInt64(&c.subscribers),
+		Messages:    atomic.LoadInt64(&c.messages),
+		Orphaned:    atomic.LoadInt64(&c.orphaned),
+		Bytes:       atomic.LoadInt64(&c.bytes),
+		Rate:        c.rate,
+		LastSeen:    atomic.LoadInt64(&c.lastSeen),
+	}
+}
@@ -0,0 +1,168 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package analytics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/kelindar/binary/nocopy"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSubscription(contract uint32, channel string) *event.Subscription {
+	return &event.Subscription{
+		Ssid:    message.Ssid{contract, 1},
+		Channel: nocopy.Bytes(channel),
+	}
+}
+
+func TestAnalytics_Report(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	s.OnSubscribe(newTestSubscription(1, "a/b/"))
+	s.OnSubscribe(newTestSubscription(1, "a/b/"))
+	s.OnSubscribe(newTestSubscription(1, "a/+/"))
+	s.OnSubscribe(newTestSubscription(1, "x/"))
+	s.OnUnsubscribe(newTestSubscription(1, "x/"))
+	s.OnUnsubscribe(newTestSubscription(1, "y/"))
+
+	s.OnPublish(message.New(message.Ssid{1, 1}, []byte("a/b/"), nil), 3)
+	s.OnPublish(message.New(message.Ssid{1, 1}, []byte("a/b/"), nil), 3)
+	s.OnPublish(message.New(message.Ssid{1, 2}, []byte("c/"), nil), 0)
+	s.OnPublish(message.New(message.Ssid{1, 2}, []byte("x/"), nil), 0)
+	s.OnPublish(message.New(message.Ssid{1, 2}, []byte("x/"), nil), 0)
+	s.OnPublish(message.New(message.Ssid{1, 3}, []byte("d/"), nil), 5000)
+	s.rotate()
+
+	r := s.Report(2)
+	assert.Equal(t, 5, r.Channels)
+	assert.Equal(t, []string{"a/b/", "a/+/"}, channelsOf(r.TopBySubs))
+	assert.Equal(t, []string{"a/b/", "x/"}, channelsOf(r.TopByRate))
+	assert.Equal(t, []string{"x/", "c/"}, channelsOf(r.Orphaned))
+	assert.Equal(t, int64(2), r.TopBySubs[0].Subscribers)
+	assert.Equal(t, int64(2), r.TopBySubs[0].Messages)
+	assert.Equal(t, 0.2, r.TopByRate[0].Rate)
+	assert.Equal(t, []Bucket{
+		{Fanout: "0", Count: 3},
+		{Fanout: "1", Count: 0},
+		{Fanout: "2-10", Count: 2},
+		{Fanout: "11-100", Count: 0},
+		{Fanout: "101-1000", Count: 0},
+		{Fanout: ">1000", Count: 1},
+	}, r.FanoutBuckets)
+}
+
+func TestAnalytics_Limit(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	for i := 0; i < maxChannels; i++ {
+		s.fetch(1, []byte(strconv.Itoa(i)))
+	}
+
+	s.OnSubscribe(newTestSubscription(1, "a/"))
+	assert.Equal(t, int64(1), s.Report(1).Dropped)
+}
+
+func TestAnalytics_Concurrent(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			channel := []byte("a/" + strconv.Itoa(w%2) + "/")
+			for i := 0; i < 1000; i++ {
+				s.OnPublish(message.New(message.Ssid{1, 1}, channel, nil), i%2)
+				if i%100 == 0 {
+					s.rotate()
+					s.Report(1)
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	var messages int64
+	s.each(func(_ channelKey, c *channel) {
+		messages += c.messages
+	})
+	assert.Equal(t, int64(8000), messages)
+	assert.Equal(t, int64(0), s.Report(10).Dropped)
+}
+
+func TestAnalytics_Expire(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	s.OnPublish(message.New(message.Ssid{1, 1}, []byte("a/"), nil), 0)
+	s.OnSubscribe(newTestSubscription(1, "b/"))
+	s.each(func(_ channelKey, c *channel) {
+		c.lastSeen = 0
+	})
+
+	s.rotate()
+	assert.Equal(t, 1, s.Report(10).Channels)
+}
+
+func TestAnalytics_OnHTTP(t *testing.T) {
+	tests := []struct {
+		method string
+		query  string
+		code   int
+	}{
+		{method: "POST", code: 404},
+		{method: "GET", query: "?limit=abc", code: 400},
+		{method: "GET", query: "?limit=-1", code: 400},
+		{method: "GET", query: "?limit=1", code: 200},
+		{method: "GET", code: 200},
+	}
+
+	s := New()
+	defer s.Close()
+	s.OnSubscribe(newTestSubscription(1, "a/"))
+	s.OnSubscribe(newTestSubscription(1, "b/"))
+
+	for _, tc := range tests {
+		req, _ := http.NewRequest(tc.method, "/admin/analytics"+tc.query, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.OnHTTP).ServeHTTP(rr, req)
+
+		assert.Equal(t, tc.code, rr.Code)
+		if tc.code == 200 {
+			var resp Report
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, 2, resp.Channels)
+			assert.NotEmpty(t, resp.TopBySubs)
+		}
+	}
+}
+
+func channelsOf(infos []ChannelInfo) (out []string) {
+	for _, v := range infos {
+		out = append(out, v.Channel)
+	}
+	return
+}
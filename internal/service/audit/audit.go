@@ -0,0 +1,160 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/provider/logging"
+)
+
+// The kinds of the audited events.
+const (
+	KindKeygen     = "keygen"        // A key was generated, extended or renewed.
+	KindAuthFailed = "auth.failed"   // A key was rejected, being invalid, expired or banned.
+	KindDenied     = "access.denied" // A valid key was used without the required permission.
+	KindAdmin      = "admin"         // A request was made on the administrative API.
+)
+
+// ErrTampered is returned when the audit trail was altered.
+var ErrTampered = errors.New("audit: the trail was tampered with")
+
+// Event represents an audited event. Each event carries its sequence number and the hash of
+// the previous one, so a removed, reordered or altered event breaks the chain of the hashes.
+type Event struct {
+	Seq      uint64 `json:"seq"`                // The sequence number of the event on the node.
+	Time     int64  `json:"time"`               // The unix time of the event, in nanoseconds.
+	Node     string `json:"node"`               // The node the event occurred on.
+	Kind     string `json:"kind"`               // The kind of the event.
+	Contract uint32 `json:"contract,omitempty"` // The contract concerned, if known.
+	Actor    string `json:"actor,omitempty"`    // The connection or the address which acted.
+	Detail   string `json:"detail,omitempty"`   // The details of the event.
+	Prev     string `json:"prev"`               // The hash of the previous event.
+	Hash     string `json:"hash"`               // The hash of this event.
+}
+
+// digest computes the hash of the event, which covers every field but the hash itself.
+func (e *Event) digest() string {
+	unsigned := *e
+	unsigned.Hash = ""
+	encoded, _ := json.Marshal(&unsigned)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify checks that the events form an unbroken chain, starting from the first event given.
+func Verify(events []Event) error {
+	for i := range events {
+		if events[i].Hash != events[i].digest() {
+			return fmt.Errorf("%w: event %d was altered", ErrTampered, events[i].Seq)
+		}
+
+		if i > 0 && (events[i].Seq != events[i-1].Seq+1 || events[i].Prev != events[i-1].Hash) {
+			return fmt.Errorf("%w: events are missing before %d", ErrTampered, events[i].Seq)
+		}
+	}
+	return nil
+}
+
+// ------------------------------------------------------------------------------------
+
+// Sink represents a destination of the audit trail, which receives each of the events as
+// a line of JSON.
+type Sink interface {
+	io.Closer
+	Write([]byte) error
+}
+
+// resumer represents a sink which keeps the trail, from which the chain is resumed.
+type resumer interface {
+	last() (Event, bool)
+}
+
+// Log represents the audit trail of the node, which is written to its sinks.
+type Log struct {
+	sync.Mutex
+	node  string // The name of the node.
+	sinks []Sink // The destinations of the events.
+	seq   uint64 // The sequence number of the last event.
+	hash  string // The hash of the last event.
+}
+
+// New creates a new audit trail. If one of the sinks keeps the trail, the sequence and the
+// chain of the hashes continue from its last event.
+func New(node string, sinks ...Sink) *Log {
+	l := &Log{
+		node:  node,
+		sinks: sinks,
+	}
+
+	for _, sink := range sinks {
+		if r, ok := sink.(resumer); ok {
+			if last, ok := r.last(); ok && last.Seq > l.seq {
+				l.seq, l.hash = last.Seq, last.Hash
+			}
+		}
+	}
+	return l
+}
+
+// Audit records an event of the specified kind.
+func (l *Log) Audit(kind string, contract uint32, actor, detail string) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.seq++
+	e := Event{
+		Seq:      l.seq,
+		Time:     time.Now().UnixNano(),
+		Node:     l.node,
+		Kind:     kind,
+		Contract: contract,
+		Actor:    actor,
+		Detail:   detail,
+		Prev:     l.hash,
+	}
+
+	e.Hash = e.digest()
+	l.hash = e.Hash
+
+	encoded, err := json.Marshal(&e)
+	if err != nil {
+		return
+	}
+
+	for _, sink := range l.sinks {
+		if err := sink.Write(encoded); err != nil {
+			logging.LogError("audit", "writing an event", err)
+		}
+	}
+}
+
+// Close closes the sinks.
+func (l *Log) Close() error {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, sink := range l.sinks {
+		sink.Close()
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memory represents a sink which keeps the events in memory.
+type memory struct {
+	sync.Mutex
+	events []Event
+}
+
+func (s *memory) Write(event []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	var e Event
+	err := json.Unmarshal(event, &e)
+	s.events = append(s.events, e)
+	return err
+}
+
+func (s *memory) Close() error {
+	return nil
+}
+
+func TestAudit_Chain(t *testing.T) {
+	sink := new(memory)
+	l := New("node-1", sink)
+	l.Audit(KindKeygen, 1, "conn-1", "created a key for a/b/")
+	l.Audit(KindDenied, 1, "conn-2", "a/b/")
+	l.Audit(KindAdmin, 0, "127.0.0.1:1234", "GET /admin/protocols")
+	assert.NoError(t, l.Close())
+
+	assert.Len(t, sink.events, 3)
+	assert.Equal(t, uint64(1), sink.events[0].Seq)
+	assert.Equal(t, "node-1", sink.events[0].Node)
+	assert.Equal(t, KindDenied, sink.events[1].Kind)
+	assert.Equal(t, sink.events[1].Hash, sink.events[2].Prev)
+	assert.NoError(t, Verify(sink.events))
+}
+
+func TestAudit_Tampered(t *testing.T) {
+	sink := new(memory)
+	l := New("node-1", sink)
+	for i := 0; i < 3; i++ {
+		l.Audit(KindAuthFailed, 1, "conn-1", "")
+	}
+
+	altered := append([]Event(nil), sink.events...)
+	altered[1].Actor = "conn-2"
+	assert.Error(t, Verify(altered))
+
+	removed := []Event{sink.events[0], sink.events[2]}
+	assert.Error(t, Verify(removed))
+}
+
+func TestAudit_FileResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	for i := 0; i < 2; i++ {
+		file, err := NewFile(path)
+		assert.NoError(t, err)
+
+		l := New("node-1", file)
+		l.Audit(KindAdmin, 0, "", "")
+		l.Audit(KindAdmin, 0, "", "")
+		assert.NoError(t, l.Close())
+	}
+
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var e Event
+		assert.NoError(t, json.Unmarshal([]byte(line), &e))
+		events = append(events, e)
+	}
+
+	assert.Len(t, events, 4)
+	assert.Equal(t, uint64(4), events[3].Seq)
+	assert.NoError(t, Verify(events))
+}
+
+func TestAudit_HTTP(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(b))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	l := New("node-1", NewHTTP(server.URL))
+	l.Audit(KindKeygen, 1, "conn-1", "")
+	l.Audit(KindKeygen, 1, "conn-1", "")
+	assert.NoError(t, l.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, received, 2)
+	assert.Contains(t, received[1], `"seq":2`)
+}
+
+func TestAudit_Channel(t *testing.T) {
+	var published [][]byte
+	l := New("node-1", NewChannel(func(event []byte) {
+		published = append(published, event)
+	}))
+
+	l.Audit(KindAdmin, 0, "", "")
+	assert.Len(t, published, 1)
+}
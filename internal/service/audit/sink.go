@@ -0,0 +1,178 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/provider/logging"
+)
+
+const (
+	tailSize    = 64 * 1024       // The size of the end of the file read for resuming the chain.
+	queueSize   = 4096            // The number of events queued for the HTTP sink.
+	postTimeout = 5 * time.Second // The timeout of the delivery of an event to the HTTP sink.
+)
+
+// ------------------------------------------------------------------------------------
+
+// File represents a sink which appends the events to a file, one per line.
+type File struct {
+	sync.Mutex
+	file *os.File // The file the events are appended to.
+}
+
+// NewFile opens or creates the file the events are appended to.
+func NewFile(path string) (*File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{file: file}, nil
+}
+
+// Write appends an event to the file.
+func (s *File) Write(event []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	_, err := s.file.Write(append(event, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (s *File) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.file.Close()
+}
+
+// last reads the last event of the file, if any.
+func (s *File) last() (Event, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	info, err := s.file.Stat()
+	if err != nil || info.Size() == 0 {
+		return Event{}, false
+	}
+
+	offset := info.Size() - tailSize
+	if offset < 0 {
+		offset = 0
+	}
+
+	tail := make([]byte, info.Size()-offset)
+	if _, err := s.file.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return Event{}, false
+	}
+
+	tail = bytes.TrimRight(tail, "\n")
+	var last Event
+	if err := json.Unmarshal(tail[bytes.LastIndexByte(tail, '\n')+1:], &last); err != nil {
+		logging.LogError("audit", "resuming the trail", err)
+		return Event{}, false
+	}
+	return last, true
+}
+
+// ------------------------------------------------------------------------------------
+
+// Channel represents a sink which publishes the events on a channel.
+type Channel struct {
+	publish func([]byte) // The function which publishes an event.
+}
+
+// NewChannel creates a sink which publishes the events with the function specified.
+func NewChannel(publish func([]byte)) *Channel {
+	return &Channel{publish: publish}
+}
+
+// Write publishes an event.
+func (s *Channel) Write(event []byte) error {
+	s.publish(event)
+	return nil
+}
+
+// Close closes the sink.
+func (s *Channel) Close() error {
+	return nil
+}
+
+// ------------------------------------------------------------------------------------
+
+// HTTP represents a sink which posts the events to an HTTP endpoint. The events are
+// delivered in the background, in order, so a slow endpoint does not hold the broker.
+type HTTP struct {
+	url    string        // The URL of the endpoint.
+	client *http.Client  // The client used to post the events.
+	queue  chan []byte   // The events waiting to be delivered.
+	done   chan struct{} // Closed once the queue is drained.
+}
+
+// NewHTTP creates a sink which posts the events to the URL specified.
+func NewHTTP(url string) *HTTP {
+	s := &HTTP{
+		url:    url,
+		client: &http.Client{Timeout: postTimeout},
+		queue:  make(chan []byte, queueSize),
+		done:   make(chan struct{}),
+	}
+
+	go s.deliver()
+	return s
+}
+
+// Write queues an event for the delivery.
+func (s *HTTP) Write(event []byte) error {
+	select {
+	case s.queue <- event:
+		return nil
+	default:
+		return fmt.Errorf("audit: the queue of %s is full, event dropped", s.url)
+	}
+}
+
+// Close delivers the queued events and stops the sink.
+func (s *HTTP) Close() error {
+	close(s.queue)
+	<-s.done
+	return nil
+}
+
+// deliver posts the queued events until the sink is closed.
+func (s *HTTP) deliver() {
+	defer close(s.done)
+	for event := range s.queue {
+		resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(event))
+		if err != nil {
+			logging.LogError("audit", "posting an event", err)
+			continue
+		}
+
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logging.LogError("audit", "posting an event", fmt.Errorf("unexpected status %d", resp.StatusCode))
+		}
+	}
+}
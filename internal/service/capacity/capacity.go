@@ -0,0 +1,275 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package capacity
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+const (
+	defaultHorizon = 30  // The default number of days the growth is projected over.
+	maxHorizon     = 365 // The maximum number of days the growth can be projected over.
+)
+
+// Sample represents the usage of the resources of the node at a point in time.
+type Sample struct {
+	Time        time.Time // The time of the sample.
+	Connections int64     // The number of open connections.
+	Memory      uint64    // The number of bytes of the heap in use.
+	Stored      int64     // The number of bytes stored since the node has started.
+}
+
+// Limits represents the resources the node can use, a zero value meaning that the limit
+// is not known.
+type Limits struct {
+	Memory      uint64 // The number of bytes of memory of the host.
+	Descriptors int    // The number of file descriptors left for the new connections.
+}
+
+// Report represents the capacity report of a node.
+type Report struct {
+	Node          string   `json:"node"`                // The name of the node.
+	Window        int64    `json:"window"`              // The number of seconds of history the report is based on.
+	Connections   int64    `json:"connections"`         // The number of open connections.
+	Growth        float64  `json:"growth"`              // The growth of the connections, per day.
+	Horizon       int      `json:"horizon"`             // The number of days the growth is projected over.
+	Projected     int64    `json:"projected"`           // The number of connections projected at the horizon.
+	PerConnection uint64   `json:"memoryPerConnection"` // The number of bytes of memory used per connection.
+	Storage       float64  `json:"storageGrowth"`       // The number of bytes stored per day.
+	Headroom      Headroom `json:"headroom"`            // The resources left on the node.
+}
+
+// Headroom represents the resources left on a node.
+type Headroom struct {
+	Memory      uint64  `json:"memory,omitempty"`      // The number of bytes of memory left.
+	Connections int64   `json:"connections,omitempty"` // The number of connections which still fit.
+	Days        float64 `json:"days,omitempty"`        // The number of days until they are exhausted at the current growth.
+}
+
+// Planner periodically samples the usage of the resources of the node and projects it, so
+// that the operators can decide when to add nodes.
+type Planner struct {
+	sync.Mutex
+	node    string             // The name of the node.
+	size    int                // The maximum number of samples kept.
+	history []Sample           // The samples, from the oldest to the newest.
+	sample  func() Sample      // The function which samples the usage.
+	limits  func() Limits      // The function which returns the limits.
+	survey  service.Surveyor   // The surveyor to gather the reports of the other nodes.
+	cancel  context.CancelFunc // The cancellation function.
+}
+
+// New creates a new capacity planner which samples the usage at every interval and keeps
+// the specified number of samples.
+func New(node string, interval time.Duration, size int, sample func() Sample, limits func() Limits) *Planner {
+	p := &Planner{
+		node:    node,
+		size:    size,
+		history: make([]Sample, 0, 64),
+		sample:  sample,
+		limits:  limits,
+	}
+
+	p.cancel = async.Repeat(context.Background(), interval, p.record)
+	return p
+}
+
+// UseSurvey gathers the reports of the other nodes of the cluster through the surveyor.
+func (p *Planner) UseSurvey(survey service.Surveyor) {
+	p.survey = survey
+}
+
+// record takes a new sample, dropping the oldest one if the history is full.
+func (p *Planner) record() {
+	sample := p.sample()
+
+	p.Lock()
+	defer p.Unlock()
+	if len(p.history) >= p.size {
+		copy(p.history, p.history[1:])
+		p.history = p.history[:len(p.history)-1]
+	}
+	p.history = append(p.history, sample)
+}
+
+// Report projects the usage of the resources of the node over the horizon, in days.
+func (p *Planner) Report(horizon int) Report {
+	p.Lock()
+	history := make([]Sample, len(p.history))
+	copy(history, p.history)
+	p.Unlock()
+
+	report := Report{Node: p.node, Horizon: horizon}
+	if len(history) == 0 {
+		return report
+	}
+
+	first, last := history[0], history[len(history)-1]
+	days := last.Time.Sub(first.Time).Hours() / 24
+	report.Window = int64(last.Time.Sub(first.Time) / time.Second)
+	report.Connections = last.Connections
+	report.Growth = growthOf(history)
+	report.Projected = int64(math.Max(0, float64(last.Connections)+report.Growth*float64(horizon)))
+	report.PerConnection = memoryPerConnection(history)
+	if days > 0 {
+		report.Storage = float64(last.Stored-first.Stored) / days
+	}
+
+	report.Headroom = headroomOf(last, p.limits(), report.PerConnection, report.Growth)
+	return report
+}
+
+// growthOf returns the growth of the connections per day, which is the slope of their
+// least squares regression over the time.
+func growthOf(history []Sample) float64 {
+	if len(history) < 2 {
+		return 0
+	}
+
+	origin := history[0].Time
+	var n, sumX, sumY, sumXY, sumXX float64
+	for _, s := range history {
+		x := s.Time.Sub(origin).Hours() / 24
+		y := float64(s.Connections)
+		n++
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+// memoryPerConnection returns the average number of bytes of the heap in use per
+// connection, over the samples which had any connection.
+func memoryPerConnection(history []Sample) uint64 {
+	var total, count uint64
+	for _, s := range history {
+		if s.Connections > 0 {
+			total += s.Memory / uint64(s.Connections)
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return total / count
+}
+
+// headroomOf returns the resources left on the node and how long they last, given the
+// memory used per connection and the growth of the connections.
+func headroomOf(last Sample, limits Limits, perConnection uint64, growth float64) (h Headroom) {
+	connections := int64(-1)
+	if limits.Memory > last.Memory {
+		h.Memory = limits.Memory - last.Memory
+		if perConnection > 0 {
+			connections = int64(h.Memory / perConnection)
+		}
+	}
+
+	// The connections are bounded by the descriptors as well
+	if limits.Descriptors > 0 && (connections < 0 || int64(limits.Descriptors) < connections) {
+		connections = int64(limits.Descriptors)
+	}
+
+	if connections > 0 {
+		h.Connections = connections
+		if growth > 0 {
+			h.Days = float64(connections) / growth
+		}
+	}
+	return
+}
+
+// Gather returns the reports of every node of the cluster, starting with this one.
+func (p *Planner) Gather(horizon int) []Report {
+	reports := []Report{p.Report(horizon)}
+	if p.survey == nil {
+		return reports
+	}
+
+	if req, err := json.Marshal(horizon); err == nil {
+		if awaiter, err := p.survey.Query("capacity", req); err == nil {
+			for _, resp := range awaiter.Gather(time.Second) {
+				var report Report
+				if err := json.Unmarshal(resp, &report); err == nil {
+					reports = append(reports, report)
+				}
+			}
+		}
+	}
+	return reports
+}
+
+// OnSurvey handles an incoming capacity query.
+func (p *Planner) OnSurvey(queryType string, payload []byte) ([]byte, bool) {
+	if queryType != "capacity" {
+		return nil, false
+	}
+
+	var horizon int
+	if err := json.Unmarshal(payload, &horizon); err != nil {
+		return nil, false
+	}
+
+	resp, err := json.Marshal(p.Report(horizon))
+	return resp, err == nil
+}
+
+// OnHTTP occurs when a new HTTP request for the capacity report of the cluster is received,
+// which optionally specifies the number of 'days' the growth is projected over.
+func (p *Planner) OnHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	horizon := defaultHorizon
+	if v := r.URL.Query().Get("days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 || days > maxHorizon {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		horizon = days
+	}
+
+	resp, _ := json.Marshal(p.Gather(horizon))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// Close stops sampling the usage.
+func (p *Planner) Close() error {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package capacity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPlanner(samples []Sample, limits Limits) *Planner {
+	next := 0
+	p := New("a", time.Hour, 3, func() Sample {
+		s := samples[next]
+		next++
+		return s
+	}, func() Limits { return limits })
+	p.Close()
+
+	for range samples {
+		p.record()
+	}
+	return p
+}
+
+func TestPlanner_Report(t *testing.T) {
+	start := time.Unix(0, 0)
+	p := newPlanner([]Sample{
+		{Time: start, Connections: 0, Memory: 1000, Stored: 0},
+		{Time: start.Add(24 * time.Hour), Connections: 100, Memory: 1000, Stored: 1000},
+		{Time: start.Add(48 * time.Hour), Connections: 200, Memory: 2000, Stored: 4000},
+		{Time: start.Add(72 * time.Hour), Connections: 300, Memory: 3000, Stored: 6000},
+	}, Limits{Memory: 13000, Descriptors: 5000})
+
+	r := p.Report(10)
+	assert.Equal(t, "a", r.Node)
+	assert.Equal(t, int64(48*3600), r.Window)
+	assert.Equal(t, int64(300), r.Connections)
+	assert.InDelta(t, 100, r.Growth, 0.001)
+	assert.Equal(t, int64(1300), r.Projected)
+	assert.Equal(t, uint64(10), r.PerConnection)
+	assert.InDelta(t, 2500, r.Storage, 0.001)
+	assert.Equal(t, uint64(10000), r.Headroom.Memory)
+	assert.Equal(t, int64(1000), r.Headroom.Connections)
+	assert.InDelta(t, 10, r.Headroom.Days, 0.001)
+}
+
+func TestPlanner_ReportDescriptors(t *testing.T) {
+	start := time.Unix(0, 0)
+	p := newPlanner([]Sample{
+		{Time: start, Connections: 10, Memory: 100},
+		{Time: start.Add(24 * time.Hour), Connections: 10, Memory: 100},
+	}, Limits{Memory: 1000000, Descriptors: 50})
+
+	r := p.Report(10)
+	assert.Equal(t, float64(0), r.Growth)
+	assert.Equal(t, int64(10), r.Projected)
+	assert.Equal(t, int64(50), r.Headroom.Connections)
+	assert.Zero(t, r.Headroom.Days)
+}
+
+func TestPlanner_ReportEmpty(t *testing.T) {
+	p := New("a", time.Hour, 10, nil, nil)
+	defer p.Close()
+
+	assert.Equal(t, Report{Node: "a", Horizon: 5}, p.Report(5))
+}
+
+func TestPlanner_Survey(t *testing.T) {
+	other, _ := json.Marshal(Report{Node: "b", Connections: 5})
+	p := newPlanner([]Sample{{Time: time.Unix(0, 0), Connections: 1}}, Limits{})
+	p.UseSurvey(&fake.Surveyor{Resp: [][]byte{other, []byte("invalid")}})
+
+	reports := p.Gather(7)
+	assert.Len(t, reports, 2)
+	assert.Equal(t, "a", reports[0].Node)
+	assert.Equal(t, "b", reports[1].Node)
+
+	_, ok := p.OnSurvey("presence", nil)
+	assert.False(t, ok)
+
+	resp, ok := p.OnSurvey("capacity", []byte("7"))
+	assert.True(t, ok)
+
+	var report Report
+	assert.NoError(t, json.Unmarshal(resp, &report))
+	assert.Equal(t, 7, report.Horizon)
+	assert.Equal(t, int64(1), report.Connections)
+}
+
+func TestPlanner_OnHTTP(t *testing.T) {
+	p := newPlanner([]Sample{{Time: time.Unix(0, 0), Connections: 1}}, Limits{})
+	tests := []struct {
+		method  string
+		url     string
+		status  int
+		horizon int
+	}{
+		{method: "GET", url: "/admin/capacity", status: http.StatusOK, horizon: defaultHorizon},
+		{method: "GET", url: "/admin/capacity?days=7", status: http.StatusOK, horizon: 7},
+		{method: "GET", url: "/admin/capacity?days=0", status: http.StatusBadRequest},
+		{method: "GET", url: "/admin/capacity?days=x", status: http.StatusBadRequest},
+		{method: "POST", url: "/admin/capacity", status: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		p.OnHTTP(w, httptest.NewRequest(tc.method, tc.url, nil))
+		assert.Equal(t, tc.status, w.Code, tc.url)
+
+		if tc.status == http.StatusOK {
+			var reports []Report
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reports))
+			assert.Len(t, reports, 1)
+			assert.Equal(t, tc.horizon, reports[0].Horizon)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package cluster
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"sync"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/golang/snappy"
+	codec "github.com/kelindar/binary"
+)
+
+// The frames exchanged between the peers start with a marker when they are not a plain
+// message frame. A plain frame never starts with a zero byte, since it is compressed with
+// snappy and this is the length of a non-empty frame.
+const (
+	frameMarker     = byte(0x00) // The marker of the frames which are not plain.
+	frameAliased    = byte(0x01) // The kind of a frame whose channels are aliased.
+	frameResync     = byte(0x02) // The kind of a request to reset the aliases.
+	frameRaw        = byte(0x03) // The kind of a message frame which is not compressed.
+	frameAliasedRaw = byte(0x04) // The kind of an aliased frame which is not compressed.
+)
+
+var errUnknownFrame = errors.New("cluster: unknown frame")
+
+// aliasedFrame represents a frame of messages whose channels are replaced by the aliases
+// the peers agreed on, so the long channels are only sent once per peer.
+type aliasedFrame struct {
+	Epoch    uint32           // The epoch of the aliases of the sender.
+	Aliases  []alias          // The aliases defined by this frame.
+	Messages []aliasedMessage // The messages of the frame.
+}
+
+// alias represents an alias of a channel.
+type alias struct {
+	ID      uint32 // The identifier of the alias.
+	Channel []byte // The channel it stands for.
+}
+
+// aliasedMessage represents a message whose channel is either aliased or sent inline.
+type aliasedMessage struct {
+	ID      message.ID      // The ID of the message.
+	Alias   uint32          // The alias of the channel, zero if sent inline.
+	Channel []byte          // The channel of the message, if not aliased.
+	Payload []byte          // The payload of the message.
+	TTL     uint32          // The time-to-live of the message.
+	Headers message.Headers // The headers of the message.
+}
+
+// ------------------------------------------------------------------------------------
+
+// aliases represents the aliases of the channels sent to a peer. An epoch identifies the
+// aliases, so the peer can ask for them to be reset if it lost track of them, for example
+// when it restarted.
+type aliases struct {
+	sync.Mutex
+	epoch uint32            // The current epoch.
+	ids   map[string]uint32 // The aliases of the channels.
+	limit int               // The maximum number of aliases.
+}
+
+// newAliases creates a new set of aliases.
+func newAliases(limit int) *aliases {
+	a := &aliases{limit: limit}
+	a.reset()
+	return a
+}
+
+// reset forgets the aliases and starts a new epoch.
+func (a *aliases) reset() {
+	a.epoch = rand.Uint32()
+	a.ids = make(map[string]uint32)
+}
+
+// Reset forgets the aliases if they belong to the epoch.
+func (a *aliases) Reset(epoch uint32) {
+	a.Lock()
+	defer a.Unlock()
+	if a.epoch == epoch {
+		a.reset()
+	}
+}
+
+// Encode encodes the frame, aliasing the channels and defining the aliases which were
+// not sent yet. Once the limit is reached, the other channels are sent inline.
+func (a *aliases) Encode(frame message.Frame, compress bool) []byte {
+	a.Lock()
+	defer a.Unlock()
+
+	out := aliasedFrame{
+		Epoch:    a.epoch,
+		Messages: make([]aliasedMessage, 0, len(frame)),
+	}
+
+	for _, m := range frame {
+		msg := aliasedMessage{ID: m.ID, Payload: m.Payload, TTL: m.TTL, Headers: m.Headers}
+		id, ok := a.ids[string(m.Channel)]
+		switch {
+		case ok:
+			msg.Alias = id
+		case len(a.ids) < a.limit:
+			id = uint32(len(a.ids) + 1)
+			a.ids[string(m.Channel)] = id
+			out.Aliases = append(out.Aliases, alias{ID: id, Channel: m.Channel})
+			msg.Alias = id
+		default:
+			msg.Channel = m.Channel
+		}
+		out.Messages = append(out.Messages, msg)
+	}
+
+	b, err := codec.Marshal(&out)
+	if err != nil {
+		panic(err) // Should never panic
+	}
+
+	if !compress {
+		return append([]byte{frameMarker, frameAliasedRaw}, b...)
+	}
+	return append([]byte{frameMarker, frameAliased}, snappy.Encode(nil, b)...)
+}
+
+// ------------------------------------------------------------------------------------
+
+// channels represents the aliases of the channels received from a peer.
+type channels struct {
+	sync.Mutex
+	epoch uint32            // The epoch of the aliases.
+	names map[uint32][]byte // The channels, by their alias.
+}
+
+// Decode decodes an aliased frame. If some of the aliases are unknown, the corresponding
+// messages are dropped and the epoch to reset is returned.
+func (c *channels) Decode(buf []byte, compressed bool) (frame message.Frame, resync bool, epoch uint32, err error) {
+	if buf, err = decompress(buf, compressed); err != nil {
+		return
+	}
+
+	var in aliasedFrame
+	if err = codec.Unmarshal(buf, &in); err != nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.names == nil || c.epoch != in.Epoch {
+		c.epoch = in.Epoch
+		c.names = make(map[uint32][]byte)
+	}
+
+	for _, v := range in.Aliases {
+		c.names[v.ID] = append([]byte(nil), v.Channel...) // Outlives the buffer
+	}
+
+	frame = make(message.Frame, 0, len(in.Messages))
+	for _, m := range in.Messages {
+		channel := m.Channel
+		if m.Alias != 0 {
+			if channel = c.names[m.Alias]; channel == nil {
+				resync = true
+				continue
+			}
+		}
+
+		msg := message.Message{
+			ID:      m.ID,
+			Channel: channel,
+			Payload: m.Payload,
+			TTL:     m.TTL,
+		}
+		if len(m.Headers) > 0 {
+			msg.Headers = m.Headers
+		}
+		frame = append(frame, msg)
+	}
+	return frame, resync, in.Epoch, nil
+}
+
+// ------------------------------------------------------------------------------------
+
+// encodeRaw encodes a message frame without compressing it.
+func encodeRaw(frame message.Frame) []byte {
+	b, err := codec.Marshal(&frame)
+	if err != nil {
+		panic(err) // Should never panic
+	}
+	return append([]byte{frameMarker, frameRaw}, b...)
+}
+
+// decodeRaw decodes a message frame which is not compressed.
+func decodeRaw(buf []byte) (frame message.Frame, err error) {
+	err = codec.Unmarshal(append([]byte(nil), buf...), &frame) // The messages outlive the buffer
+	return
+}
+
+// decompress decompresses a frame, allocating the buffer its messages will refer to since
+// they are decoded without a copy.
+func decompress(buf []byte, compressed bool) ([]byte, error) {
+	if !compressed {
+		return append([]byte(nil), buf...), nil
+	}
+	return snappy.Decode(nil, buf)
+}
+
+// encodeResync encodes a request to reset the aliases of an epoch.
+func encodeResync(epoch uint32) []byte {
+	buf := []byte{frameMarker, frameResync, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(buf[2:], epoch)
+	return buf
+}
+
+// decodeResync decodes a request to reset the aliases of an epoch.
+func decodeResync(buf []byte) (uint32, error) {
+	if len(buf) != 4 {
+		return 0, errUnknownFrame
+	}
+	return binary.BigEndian.Uint32(buf), nil
+}
@@ -0,0 +1,131 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package cluster
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliases_Encode(t *testing.T) {
+	channel := strings.Repeat("building/floor/room/", 5)
+	frame := message.Frame{
+		newTestMessage(message.Ssid{1, 2, 3}, channel+"temperature/", "21"),
+		newTestMessage(message.Ssid{1, 2, 3}, channel+"humidity/", "40"),
+		newTestMessage(message.Ssid{1, 2, 3}, channel+"temperature/", "22"),
+	}
+	frame[1].Headers = message.Headers{"trace": "abc"}
+
+	out := newAliases(2)
+	in := new(channels)
+
+	// The first frame defines the aliases
+	first := out.Encode(frame, true)
+	decoded, resync, _, err := in.Decode(first[2:], true)
+	assert.NoError(t, err)
+	assert.False(t, resync)
+	assert.Equal(t, frame, decoded)
+
+	// The next frames only refer to them
+	next := out.Encode(frame, true)
+	decoded, resync, _, err = in.Decode(next[2:], true)
+	assert.NoError(t, err)
+	assert.False(t, resync)
+	assert.Equal(t, frame, decoded)
+	assert.Less(t, len(next), len(first))
+	assert.Less(t, len(next), len(frame.Encode()))
+
+	// Beyond the limit, the channels are sent inline
+	other := message.Frame{newTestMessage(message.Ssid{1, 2, 3}, "a/", "hi")}
+	decoded, _, _, err = in.Decode(out.Encode(other, true)[2:], true)
+	assert.NoError(t, err)
+	assert.Equal(t, other, decoded)
+	assert.Len(t, out.ids, 2)
+}
+
+func TestAliases_Resync(t *testing.T) {
+	frame := message.Frame{
+		newTestMessage(message.Ssid{1, 2, 3}, "a/b/c/", "1"),
+	}
+
+	out := newAliases(10)
+	out.Encode(frame, true)
+
+	// A restarted peer does not know the aliases and asks for them to be reset
+	in := new(channels)
+	decoded, resync, epoch, err := in.Decode(out.Encode(frame, true)[2:], true)
+	assert.NoError(t, err)
+	assert.True(t, resync)
+	assert.Empty(t, decoded)
+
+	// A stale request does not reset the aliases again
+	out.Reset(epoch)
+	assert.NotEqual(t, epoch, out.epoch)
+	current := out.epoch
+	out.Reset(epoch)
+	assert.Equal(t, current, out.epoch)
+
+	decoded, resync, _, err = in.Decode(out.Encode(frame, true)[2:], true)
+	assert.NoError(t, err)
+	assert.False(t, resync)
+	assert.Equal(t, frame, decoded)
+}
+
+func TestSwarm_DecodeFrame(t *testing.T) {
+	gossip := new(stubGossip)
+	s := &Swarm{config: &config.ClusterConfig{Aliases: 10}, gossip: gossip, state: event.NewState("")}
+	s.members = newMemberlist(s.newPeer)
+	peer := s.findPeer(2)
+	defer peer.Close()
+
+	// The plain frames are still understood
+	frame := message.Frame{newTestMessage(message.Ssid{1, 2, 3}, "a/b/c/", "1")}
+	decoded, err := s.decodeFrame(2, frame.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, frame, decoded)
+
+	// The frames which are not compressed are understood
+	decoded, err = s.decodeFrame(2, encodeRaw(frame))
+	assert.NoError(t, err)
+	assert.Equal(t, frame, decoded)
+
+	raw := newAliases(10)
+	decoded, err = s.decodeFrame(2, raw.Encode(frame, false))
+	assert.NoError(t, err)
+	assert.Equal(t, frame, decoded)
+
+	// The unknown aliases are resynced with the peer
+	sender := newAliases(10)
+	sender.Encode(frame, true)
+	decoded, err = s.decodeFrame(2, sender.Encode(frame, true))
+	assert.NoError(t, err)
+	assert.Empty(t, decoded)
+	assert.Len(t, gossip.unicasts, 1)
+
+	// The peer resets the aliases when asked to
+	epoch := peer.aliases.epoch
+	decoded, err = s.decodeFrame(2, encodeResync(epoch))
+	assert.NoError(t, err)
+	assert.Empty(t, decoded)
+	assert.NotEqual(t, epoch, peer.aliases.epoch)
+
+	_, err = s.decodeFrame(2, []byte{frameMarker, 0xff})
+	assert.Error(t, err)
+}
@@ -48,6 +48,23 @@ func (m *memberlist) GetOrAdd(name mesh.PeerName) (*Peer, bool) {
 	return v.(*Peer), !loaded
 }
 
+// Get gets a peer if it exists, without adding it
+func (m *memberlist) Get(name mesh.PeerName) (*Peer, bool) {
+	if p, ok := m.list.Load(name); ok {
+		return p.(*Peer), true
+	}
+	return nil, false
+}
+
+// All returns all of the peers in the memberlist
+func (m *memberlist) All() (peers []*Peer) {
+	m.list.Range(func(_, v interface{}) bool {
+		peers = append(peers, v.(*Peer))
+		return true
+	})
+	return
+}
+
 // Fallback gets a fallback peer for a given peer.
 func (m *memberlist) Fallback(name mesh.PeerName) (*Peer, bool) {
 	peers := make([]*Peer, 0, 8)
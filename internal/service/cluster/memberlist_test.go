@@ -44,5 +44,6 @@ func newPeer(name mesh.PeerName) *Peer {
 		frame:    message.NewFrame(defaultFrameSize),
 		subs:     message.NewCounters(),
 		activity: time.Now().Unix(),
+		total:    new(int64),
 	}
 }
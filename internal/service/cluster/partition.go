@@ -0,0 +1,207 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package cluster
+
+import (
+	"time"
+
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/weaveworks/mesh"
+)
+
+// The merge policies applied when a partition of the cluster heals.
+const (
+	MergeNewer  = "newer"  // Re-assert our subscriptions and purge the stale ones.
+	MergeReplay = "replay" // Same as newer, but also gossip our complete state right away.
+	MergeNone   = "none"   // Only emit the heal event.
+)
+
+// The time during which a peer must stay absent before its subscriptions are purged when a
+// partition heals, so the peers which are still joining keep their subscriptions.
+const purgeGrace = time.Minute
+
+// Heal represents an event which occurs when a partition of the cluster heals.
+type Heal struct {
+	Peer     string `json:"peer"`     // The name of the peer which came back.
+	Since    int64  `json:"since"`    // The unix time at which the peer was lost.
+	Policy   string `json:"policy"`   // The merge policy applied.
+	Replayed int    `json:"replayed"` // The number of our subscriptions re-asserted.
+	Purged   int    `json:"purged"`   // The number of stale subscriptions removed.
+}
+
+// onPeerLost occurs when a peer is no longer reachable.
+func (s *Swarm) onPeerLost(name mesh.PeerName) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.lost == nil {
+		s.lost = make(map[mesh.PeerName]int64)
+	}
+	s.lost[name] = time.Now().Unix()
+}
+
+// forget forgets the peers which were lost for longer than the specified duration, as
+// those are not expected to come back.
+func (s *Swarm) forget(after time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	expiry := time.Now().Add(-after).Unix()
+	for name, since := range s.lost {
+		if since < expiry {
+			delete(s.lost, name)
+		}
+	}
+}
+
+// checkHeal checks whether the peer which is reachable was previously lost, which means
+// that the partition between us has healed, and applies the merge policy if so.
+func (s *Swarm) checkHeal(name mesh.PeerName) {
+	s.Lock()
+	since, lost := s.lost[name]
+	delete(s.lost, name)
+	s.Unlock()
+
+	if lost {
+		s.onHeal(name, since)
+	}
+}
+
+// onHeal applies the configured merge policy once a partition has healed.
+func (s *Swarm) onHeal(name mesh.PeerName, since int64) {
+	heal := &Heal{
+		Peer:   name.String(),
+		Since:  since,
+		Policy: s.mergePolicy(),
+	}
+
+	switch heal.Policy {
+	case MergeReplay:
+		heal.Replayed, heal.Purged = s.reassert(), s.purgeStale(name)
+		s.gossip.GossipBroadcast(s.state)
+	case MergeNewer:
+		heal.Replayed, heal.Purged = s.reassert(), s.purgeStale(name)
+	}
+
+	logging.LogTarget("swarm", "partition healed with peer", heal.Peer)
+	if s.OnHeal != nil {
+		s.OnHeal(heal)
+	}
+}
+
+// mergePolicy returns the configured merge policy.
+func (s *Swarm) mergePolicy() string {
+	if s.config == nil {
+		return MergeNewer
+	}
+
+	switch s.config.MergePolicy {
+	case MergeReplay, MergeNone:
+		return s.config.MergePolicy
+	default:
+		return MergeNewer
+	}
+}
+
+// reassert adds our own subscriptions again with a newer time, so they take precedence
+// over the removals which the other side of the partition might have made while we
+// were unreachable.
+func (s *Swarm) reassert() (n int) {
+	op := event.NewState("")
+	s.state.SubscriptionsOf(s.name, func(ev *event.Subscription) {
+		s.state.Add(ev)
+		op.Add(ev)
+		n++
+	})
+
+	if n > 0 {
+		s.gossip.GossipBroadcast(op)
+	}
+	return
+}
+
+// purgeStale removes the subscriptions of the peers which have been inactive for longer
+// than the grace period, so that no message gets routed to them. The subscriptions of the
+// peer which is healing are never purged, as they were just merged.
+func (s *Swarm) purgeStale(healing mesh.PeerName) (n int) {
+	absent := make(map[mesh.PeerName]bool)
+	s.state.Subscriptions(func(ev *event.Subscription, v event.Value) {
+		if name := mesh.PeerName(ev.Peer); v.IsAdded() && name != s.name && name != healing {
+			if peer, ok := s.lookup(name); !ok || !peer.IsActive() {
+				absent[name] = true
+			}
+		}
+	})
+
+	for _, name := range s.expired(absent, time.Now()) {
+		n += s.purge(name)
+	}
+	return
+}
+
+// purgeAbsent purges the subscriptions of the peers which stayed absent since a partition
+// healed, once the grace period has elapsed.
+func (s *Swarm) purgeAbsent() {
+	s.Lock()
+	pending := len(s.absent) > 0
+	s.Unlock()
+
+	if pending {
+		s.purgeStale(s.name)
+	}
+}
+
+// expired records the time since which the peers are absent and returns the ones which
+// stayed absent for longer than the grace period. The peers which are no longer absent
+// are forgotten.
+func (s *Swarm) expired(absent map[mesh.PeerName]bool, now time.Time) (out []mesh.PeerName) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.absent == nil {
+		s.absent = make(map[mesh.PeerName]int64)
+	}
+
+	for name := range s.absent {
+		if !absent[name] {
+			delete(s.absent, name)
+		}
+	}
+
+	for name := range absent {
+		since, ok := s.absent[name]
+		switch {
+		case !ok:
+			s.absent[name] = now.Unix()
+		case now.Unix()-since >= int64(purgeGrace/time.Second):
+			delete(s.absent, name)
+			out = append(out, name)
+		}
+	}
+	return
+}
+
+// purge removes all of the subscriptions of a peer and returns the number of
+// subscriptions removed.
+func (s *Swarm) purge(name mesh.PeerName) (n int) {
+	dead := &deadPeer{name: name}
+	s.state.SubscriptionsOf(name, func(ev *event.Subscription) {
+		s.OnUnsubscribe(dead, ev) // Notify locally that the subscription is gone
+		s.state.Del(ev)           // Remove the state from ourselves
+		n++
+	})
+	return
+}
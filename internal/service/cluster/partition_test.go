@@ -0,0 +1,153 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/mesh"
+)
+
+func newTestPartition(t *testing.T, policy string) (*Swarm, *stubGossip) {
+	s := NewSwarm(&config.ClusterConfig{
+		NodeName:      "00:00:00:00:00:01",
+		ListenAddr:    ":4000",
+		AdvertiseAddr: ":4001",
+		MergePolicy:   policy,
+	}, testKey)
+
+	gossip := new(stubGossip)
+	s.gossip = gossip
+	s.OnSubscribe = func(message.Subscriber, *event.Subscription) bool { return true }
+	s.OnUnsubscribe = func(message.Subscriber, *event.Subscription) bool { return true }
+	s.OnDisconnect = func(message.Subscriber, *event.Connection) bool { return true }
+
+	// One subscription of ourselves, one of an active and one of a stale peer
+	s.state.Add(&event.Subscription{Peer: 1, Conn: 1, Ssid: message.Ssid{1, 2}})
+	s.state.Add(&event.Subscription{Peer: 2, Conn: 2, Ssid: message.Ssid{1, 2}})
+	s.state.Add(&event.Subscription{Peer: 3, Conn: 3, Ssid: message.Ssid{1, 2}})
+	s.members.Touch(2)
+	return s, gossip
+}
+
+func TestPartition_Heal(t *testing.T) {
+	tests := []struct {
+		policy     string
+		replayed   int
+		purged     int
+		broadcasts int
+	}{
+		{policy: "", replayed: 1, purged: 1, broadcasts: 1},
+		{policy: MergeNewer, replayed: 1, purged: 1, broadcasts: 1},
+		{policy: MergeReplay, replayed: 1, purged: 1, broadcasts: 2},
+		{policy: MergeNone, replayed: 0, purged: 0, broadcasts: 0},
+	}
+
+	for _, tc := range tests {
+		s, gossip := newTestPartition(t, tc.policy)
+
+		var heal *Heal
+		s.OnHeal = func(h *Heal) { heal = h }
+
+		// The subscriptions of the healing peer were just merged and must be kept
+		s.state.Add(&event.Subscription{Peer: 4, Conn: 4, Ssid: message.Ssid{1, 2}})
+		s.onPeerLost(4)
+
+		// The stale peer was absent for a while already
+		s.absent = map[mesh.PeerName]int64{3: time.Now().Add(-purgeGrace).Unix()}
+
+		s.checkHeal(4)
+		assert.NotNil(t, heal)
+		assert.Equal(t, tc.replayed, heal.Replayed, tc.policy)
+		assert.Equal(t, tc.purged, heal.Purged, tc.policy)
+		assert.Equal(t, tc.broadcasts, gossip.broadcasts, tc.policy)
+		assert.NotZero(t, heal.Since)
+
+		// Only the stale subscriptions are purged
+		purged := tc.purged > 0
+		assert.True(t, s.Contains(&event.Subscription{Peer: 2, Conn: 2, Ssid: message.Ssid{1, 2}}))
+		assert.Equal(t, !purged, s.Contains(&event.Subscription{Peer: 3, Conn: 3, Ssid: message.Ssid{1, 2}}))
+		assert.True(t, s.Contains(&event.Subscription{Peer: 4, Conn: 4, Ssid: message.Ssid{1, 2}}))
+		s.Close()
+	}
+}
+
+func TestPartition_Grace(t *testing.T) {
+	tests := []struct {
+		policy     string
+		replayed   int
+		broadcasts int
+	}{
+		{policy: "", replayed: 1, broadcasts: 1},
+		{policy: MergeNewer, replayed: 1, broadcasts: 1},
+		{policy: MergeReplay, replayed: 1, broadcasts: 2},
+		{policy: MergeNone, replayed: 0, broadcasts: 0},
+	}
+
+	for _, tc := range tests {
+		s, gossip := newTestPartition(t, tc.policy)
+
+		var heal *Heal
+		s.OnHeal = func(h *Heal) { heal = h }
+
+		// Lose the peer, nothing happens until it comes back
+		s.findPeer(4)
+		s.onPeerOffline(4)
+		assert.Nil(t, heal)
+
+		s.findPeer(4)
+		assert.NotNil(t, heal)
+		assert.Equal(t, tc.replayed, heal.Replayed, tc.policy)
+		assert.Equal(t, 0, heal.Purged, tc.policy)
+		assert.Equal(t, tc.broadcasts, gossip.broadcasts, tc.policy)
+		assert.NotZero(t, heal.Since)
+
+		// The stale subscriptions are kept during the grace period
+		assert.True(t, s.Contains(&event.Subscription{Peer: 3, Conn: 3, Ssid: message.Ssid{1, 2}}))
+		s.purgeAbsent()
+		assert.True(t, s.Contains(&event.Subscription{Peer: 3, Conn: 3, Ssid: message.Ssid{1, 2}}))
+
+		// Once the grace period has elapsed, they are purged
+		purged := tc.policy != MergeNone
+		if purged {
+			s.absent[3] = time.Now().Add(-purgeGrace).Unix()
+		}
+		s.purgeAbsent()
+		assert.True(t, s.Contains(&event.Subscription{Peer: 2, Conn: 2, Ssid: message.Ssid{1, 2}}))
+		assert.Equal(t, !purged, s.Contains(&event.Subscription{Peer: 3, Conn: 3, Ssid: message.Ssid{1, 2}}))
+
+		// The heal is only reported once
+		heal = nil
+		s.checkHeal(4)
+		assert.Nil(t, heal)
+		s.Close()
+	}
+}
+
+func TestPartition_Forget(t *testing.T) {
+	s := new(Swarm)
+	s.onPeerLost(5)
+	s.forget(time.Hour)
+	assert.Len(t, s.lost, 1)
+
+	s.lost[5] = time.Now().Add(-2 * time.Hour).Unix()
+	s.forget(time.Hour)
+	assert.Len(t, s.lost, 0)
+}
@@ -30,8 +30,9 @@ import (
 var _ message.Subscriber = &Peer{}
 
 const (
-	defaultFrameSize = 128              // Default message frame size to use
-	maxByteFrameSize = 10 * 1024 * 1024 // Hard limit imposed by our underlying gossip
+	defaultFrameSize     = 128                  // Default message frame size to use
+	maxByteFrameSize     = 10 * 1024 * 1024     // Hard limit imposed by our underlying gossip
+	defaultFlushInterval = 5 * time.Millisecond // Default interval of the frames sent
 )
 
 // Peer represents a remote peer.
@@ -42,6 +43,18 @@ type Peer struct {
 	frame    message.Frame      // The current message frame.
 	subs     *message.Counters  // The SSIDs of active subscriptions for this peer.
 	activity int64              // The time of last activity of the peer.
+	gossip   int64              // The time of last gossip received from the peer, in nanoseconds.
+	state    int64              // The number of bytes of state received from the peer.
+	sent     int64              // The number of messages forwarded to the peer.
+	total    *int64             // The number of messages forwarded to all of the peers.
+	received int64              // The number of messages received from the peer.
+	rates    peerRates          // The message rates, sampled periodically.
+	aliases  *aliases           // The aliases of the channels sent to the peer (optional).
+	channels channels           // The aliases of the channels received from the peer.
+	pending  int64              // The size of the payloads of the current frame.
+	flushAt  int64              // The size of the payloads above which the frame is sent right away.
+	flush    chan struct{}      // The signal to send the current frame right away.
+	raw      bool               // Whether the frames are sent without compression.
 	cancel   context.CancelFunc // The cancellation function.
 }
 
@@ -53,10 +66,24 @@ func (s *Swarm) newPeer(name mesh.PeerName) *Peer {
 		frame:    message.NewFrame(defaultFrameSize),
 		subs:     message.NewCounters(),
 		activity: time.Now().Unix(),
+		total:    &s.forwarded,
+		flush:    make(chan struct{}, 1),
+	}
+
+	// Alias the channels of the forwarded messages and batch them, as configured
+	interval := defaultFlushInterval
+	if s.config != nil {
+		if s.config.Aliases > 0 {
+			peer.aliases = newAliases(s.config.Aliases)
+		}
+
+		interval = s.config.FlushPeriod()
+		peer.flushAt = int64(s.config.FlushSize)
+		peer.raw = !s.config.Compressed()
 	}
 
 	// Spawn the send queue processor
-	peer.cancel = async.Repeat(context.Background(), 5*time.Millisecond, peer.processSendQueue)
+	peer.cancel = async.RepeatOn(context.Background(), interval, peer.flush, peer.processSendQueue)
 	return peer
 }
 
@@ -105,26 +132,39 @@ func (p *Peer) Send(m *message.Message) error {
 	// Make sure we don't send to a dead peer
 	if p.IsActive() {
 		p.frame = append(p.frame, *m)
+		p.pending += m.Size()
+		atomic.AddInt64(&p.sent, 1)
+		atomic.AddInt64(p.total, 1)
+
+		// Send a large frame without waiting for the interval
+		if p.flushAt > 0 && p.pending >= p.flushAt {
+			select {
+			case p.flush <- struct{}{}:
+			default:
+			}
+		}
 	}
 
 	return nil
 }
 
-// swap swaps the frame and returns the frame we can encode.
+// swap swaps the frame and returns the frame we can encode, if it is not empty.
 func (p *Peer) swap() (swapped message.Frame) {
 	p.Lock()
 	defer p.Unlock()
 
+	if len(p.frame) == 0 {
+		return nil
+	}
+
 	swapped = p.frame
 	p.frame = message.NewFrame(defaultFrameSize)
+	p.pending = 0
 	return
 }
 
 // processSendQueue flushes the current frame to the remote server
 func (p *Peer) processSendQueue() {
-	if len(p.frame) == 0 {
-		return
-	}
 
 	// Swap the frame and split the frame in chunks of at most 10MB
 	// for gossip unicast to work.
@@ -136,13 +176,70 @@ func (p *Peer) processSendQueue() {
 			break
 		}
 
-		buffer := chunk.Encode()
+		buffer := p.encode(chunk)
 		if err := p.sender.GossipUnicast(p.name, buffer); err != nil {
 			logging.LogError("peer", "gossip unicast", err)
 		}
 	}
 }
 
+// encode encodes a frame, aliasing its channels and compressing it as configured.
+func (p *Peer) encode(frame message.Frame) []byte {
+	switch {
+	case p.aliases != nil:
+		return p.aliases.Encode(frame, !p.raw)
+	case p.raw:
+		return encodeRaw(frame)
+	default:
+		return frame.Encode()
+	}
+}
+
+// onGossip occurs when a gossip of a specific size is received from the peer.
+func (p *Peer) onGossip(size int) {
+	atomic.StoreInt64(&p.gossip, time.Now().UnixNano())
+	atomic.AddInt64(&p.state, int64(size))
+}
+
+// onReceive occurs when a frame of messages is received from the peer.
+func (p *Peer) onReceive(count int) {
+	atomic.AddInt64(&p.received, int64(count))
+}
+
+// sample computes the message rates of the peer since the previous sample.
+func (p *Peer) sample() {
+	p.Lock()
+	defer p.Unlock()
+	p.rates.sample(atomic.LoadInt64(&p.sent), atomic.LoadInt64(&p.received), atomic.LoadInt64(&p.state), time.Now())
+}
+
+// ------------------------------------------------------------------------------------
+
+// peerRates represents the message rates of a peer.
+type peerRates struct {
+	sent      float64   // The number of messages forwarded per second.
+	received  float64   // The number of messages received per second.
+	state     float64   // The number of bytes of state received per second.
+	lastSent  int64     // The number of messages forwarded at the last sample.
+	lastRecv  int64     // The number of messages received at the last sample.
+	lastState int64     // The number of bytes of state received at the last sample.
+	lastTime  time.Time // The time of the last sample.
+}
+
+// sample computes the rates from the counters since the previous sample.
+func (r *peerRates) sample(sent, received, state int64, now time.Time) {
+	if elapsed := now.Sub(r.lastTime).Seconds(); !r.lastTime.IsZero() && elapsed > 0 {
+		r.sent = float64(sent-r.lastSent) / elapsed
+		r.received = float64(received-r.lastRecv) / elapsed
+		r.state = float64(state-r.lastState) / elapsed
+	}
+
+	r.lastSent = sent
+	r.lastRecv = received
+	r.lastState = state
+	r.lastTime = now
+}
+
 // ------------------------------------------------------------------------------------
 
 // DeadPeer represents a peer which is no longer online
@@ -3,16 +3,21 @@ package cluster
 import (
 	"testing"
 
+	"github.com/emitter-io/emitter/internal/config"
 	"github.com/emitter-io/emitter/internal/message"
 	"github.com/stretchr/testify/assert"
 	"github.com/weaveworks/mesh"
 )
 
-type stubGossip struct{}
+type stubGossip struct {
+	broadcasts int
+	unicasts   [][]byte
+}
 
 func (s *stubGossip) GossipNeighbourSubset(update mesh.GossipData) {}
-func (s *stubGossip) GossipBroadcast(update mesh.GossipData)       {}
+func (s *stubGossip) GossipBroadcast(update mesh.GossipData)       { s.broadcasts++ }
 func (s *stubGossip) GossipUnicast(dst mesh.PeerName, msg []byte) error {
+	s.unicasts = append(s.unicasts, msg)
 	return nil
 }
 
@@ -73,3 +78,35 @@ func TestPeer_Send(t *testing.T) {
 	p.processSendQueue()
 	assert.Equal(t, 0, len(p.frame))
 }
+
+func TestPeer_FlushSize(t *testing.T) {
+	s := &Swarm{config: &config.ClusterConfig{FlushSize: 10, Compression: "none"}}
+	configured := s.newPeer(123)
+	configured.Close()
+	assert.Equal(t, int64(10), configured.flushAt)
+	assert.True(t, configured.raw)
+
+	// Use a peer without its send queue processor
+	gossip := new(stubGossip)
+	p := newPeer(123)
+	p.sender = gossip
+	p.flush = make(chan struct{}, 1)
+	p.flushAt = configured.flushAt
+	p.raw = configured.raw
+
+	// A small frame waits for the interval
+	msg := newTestMessage(message.Ssid{1, 2, 3}, "a/b/c/", "hello")
+	p.Send(&msg)
+	assert.Equal(t, 0, len(p.flush))
+
+	// A frame reaching the flush size is sent right away, without compression
+	p.Send(&msg)
+	assert.Equal(t, 1, len(p.flush))
+	p.processSendQueue()
+	assert.Len(t, gossip.unicasts, 1)
+	assert.Equal(t, frameRaw, gossip.unicasts[0][1])
+
+	decoded, err := decodeRaw(gossip.unicasts[0][2:])
+	assert.NoError(t, err)
+	assert.Equal(t, message.Frame{msg, msg}, decoded)
+}
@@ -23,6 +23,7 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/emitter-io/address"
@@ -30,6 +31,7 @@ import (
 	"github.com/emitter-io/emitter/internal/config"
 	"github.com/emitter-io/emitter/internal/event"
 	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/migrate"
 	"github.com/emitter-io/emitter/internal/provider/logging"
 	"github.com/weaveworks/mesh"
 )
@@ -37,32 +39,46 @@ import (
 // Swarm represents a gossiper.
 type Swarm struct {
 	sync.Mutex
-	name    mesh.PeerName         // The name of ourselves.
-	actions chan func()           // The action queue for the peer.
-	cancel  context.CancelFunc    // The cancellation function.
-	config  *config.ClusterConfig // The configuration for the cluster.
-	state   *event.State          // The state to synchronise.
-	router  *mesh.Router          // The mesh router.
-	gossip  mesh.Gossip           // The gossip protocol.
-	members *memberlist           // The memberlist of peers.
+	name      mesh.PeerName           // The name of ourselves.
+	actions   chan func()             // The action queue for the peer.
+	cancel    context.CancelFunc      // The cancellation function.
+	config    *config.ClusterConfig   // The configuration for the cluster.
+	state     *event.State            // The state to synchronise.
+	router    *mesh.Router            // The mesh router.
+	gossip    mesh.Gossip             // The gossip protocol.
+	members   *memberlist             // The memberlist of peers.
+	pending   *event.State            // The pending delta, when the changes are batched.
+	lost      map[mesh.PeerName]int64 // The peers which were lost, along with the time.
+	absent    map[mesh.PeerName]int64 // The inactive peers with subscriptions, along with the time.
+	forwarded int64                   // The number of messages forwarded to the peers.
+	closing   sync.Once               // Guards the closing of the swarm.
 
 	OnSubscribe   func(message.Subscriber, *event.Subscription) bool // Delegate to invoke when the subscription event is received.
 	OnUnsubscribe func(message.Subscriber, *event.Subscription) bool // Delegate to invoke when the unsubscription event is received.
 	OnDisconnect  func(message.Subscriber, *event.Connection) bool   // Delegate to invoke when the client is disconnected.
 	OnMessage     func(*message.Message)                             // Delegate to invoke when a new message is received.
+	OnHeal        func(*Heal)                                        // Delegate to invoke when a partition has healed.
 }
 
 // Swarm implements mesh.Gossiper.
 var _ mesh.Gossiper = &Swarm{}
 
-// NewSwarm creates a new swarm messaging layer.
-func NewSwarm(cfg *config.ClusterConfig) *Swarm {
+// NewSwarm creates a new swarm messaging layer. The key provided is the pre-shared key
+// which is used to authenticate the peers and encrypt every inter-node session.
+func NewSwarm(cfg *config.ClusterConfig, key []byte) *Swarm {
 	name := getLocalPeerName(cfg)
 	if d, err := os.UserCacheDir(); cfg.Directory == "" && err == nil {
 		cfg.Directory = path.Join(d, fmt.Sprintf("emitter/%x", int(name)))
 	}
 
+	// Upgrade the state written by a previous version, if needed
 	os.MkdirAll(cfg.Directory, os.ModePerm)
+	if cfg.Directory != "" {
+		if _, err := event.Format.Migrate(cfg.Directory, migrate.Options{Backup: true}); err != nil {
+			logging.LogError("swarm", "migrating the cluster state", err)
+		}
+	}
+
 	swarm := &Swarm{
 		name:    name,
 		actions: make(chan func()),
@@ -83,12 +99,12 @@ func NewSwarm(cfg *config.ClusterConfig) *Swarm {
 	}
 
 	// Create a new router
-	interval := 30 * time.Second
+	interval := cfg.SyncPeriod()
 	router, err := mesh.NewRouter(mesh.Config{
 		Host:               listenAddr.IP.String(),
 		Port:               listenAddr.Port,
 		ProtocolMinVersion: mesh.ProtocolMinVersion,
-		Password:           []byte(cfg.Passphrase),
+		Password:           key,
 		ConnLimit:          128,
 		PeerDiscovery:      true,
 		TrustedSubnets:     []*net.IPNet{},
@@ -129,11 +145,20 @@ func (s *Swarm) findPeer(name mesh.PeerName) *Peer {
 	peer, added := s.members.GetOrAdd(name)
 	if added {
 		s.onPeerOnline(peer)
+		s.checkHeal(name)
 	}
 
 	return peer
 }
 
+// lookup retrieves a peer only if it is already known.
+func (s *Swarm) lookup(name mesh.PeerName) (*Peer, bool) {
+	if s.members == nil {
+		return nil, false
+	}
+	return s.members.Get(name)
+}
+
 // onPeerOnline occurs when a new peer is created.
 func (s *Swarm) onPeerOnline(peer *Peer) {
 	logging.LogTarget("swarm", "peer created", peer.name)
@@ -148,14 +173,13 @@ func (s *Swarm) onPeerOffline(name mesh.PeerName) {
 		logging.LogTarget("swarm", "unreachable peer removed", peer.name)
 		peer.Close() // Close the peer on our end
 
-		// Range over all of the subscriptions we have
-		dead := &deadPeer{name: name}
-		s.state.SubscriptionsOf(name, func(ev *event.Subscription) {
-			s.OnUnsubscribe(dead, ev) // Notify locally that the subscription is gone
-			s.state.Del(ev)           // Remove the state from ourselves
-		})
+		// Remove all of the subscriptions we have and remember the peer, in case this is
+		// a partition which heals later.
+		s.purge(name)
+		s.onPeerLost(name)
 
 		// If we're a fallback server, issue last will events
+		dead := &deadPeer{name: name}
 		if fallback, ok := s.members.Fallback(name); ok && s.name == fallback.name {
 			s.state.ConnectionsOf(name, func(ev *event.Connection) {
 				s.OnDisconnect(dead, ev)
@@ -184,7 +208,13 @@ func (s *Swarm) Listen(ctx context.Context) {
 
 	// Every few seconds, attempt to reinforce our cluster structure by
 	// initiating connections with all of our peers.
-	s.cancel = async.Repeat(ctx, 5*time.Second, s.update)
+	ctx, s.cancel = context.WithCancel(ctx)
+	async.Repeat(ctx, 5*time.Second, s.update)
+
+	// If configured, periodically gossip the batched changes
+	if interval := s.config.DeltaPeriod(); interval > 0 {
+		async.Repeat(ctx, interval, s.flush)
+	}
 
 	// Start the router
 	s.router.Start()
@@ -193,6 +223,14 @@ func (s *Swarm) Listen(ctx context.Context) {
 // update attempt to update our cluster structure by initiating connections
 // with all of our peers. This is is called periodically.
 func (s *Swarm) update() {
+	for _, peer := range s.members.All() {
+		peer.sample()
+	}
+
+	// Forget the peers which are lost for good and purge the ones which stayed absent
+	s.forget(24 * time.Hour)
+	s.purgeAbsent()
+
 	desc := s.router.Peers.Descriptions()
 	for _, peer := range desc {
 		if !peer.Self {
@@ -201,6 +239,7 @@ func (s *Swarm) update() {
 			// we still keep the peer, since we know that the peer is live.
 			if exists := s.router.Peers.Fetch(peer.Name); exists != nil {
 				s.members.Touch(peer.Name)
+				s.checkHeal(peer.Name)
 			}
 
 			// reinforce structure
@@ -279,6 +318,20 @@ func (s *Swarm) merge(buf []byte) (mesh.GossipData, error) {
 	return delta, nil
 }
 
+// Forwarded returns the number of messages forwarded to the peers since the start.
+func (s *Swarm) Forwarded() int64 {
+	return atomic.LoadInt64(&s.forwarded)
+}
+
+// StateLen returns the number of events in the replicated state of this node, without
+// going through them.
+func (s *Swarm) StateLen() int {
+	if s.state == nil {
+		return 0
+	}
+	return s.state.Len()
+}
+
 // NumPeers returns the number of connected peers.
 func (s *Swarm) NumPeers() int {
 	if s == nil || s.router == nil {
@@ -295,6 +348,13 @@ func (s *Swarm) NumPeers() int {
 
 // Gossip returns the state of everything we know; gets called periodically.
 func (s *Swarm) Gossip() (complete mesh.GossipData) {
+	if s.config != nil && s.config.MaxStateSize > 0 {
+		return &chunkedState{
+			State:   s.state,
+			maxSize: s.config.MaxStateSize,
+		}
+	}
+
 	return s.state
 }
 
@@ -319,6 +379,10 @@ func (s *Swarm) OnGossipBroadcast(src mesh.PeerName, buf []byte) (delta mesh.Gos
 		return
 	}
 
+	if peer, ok := s.lookup(src); ok {
+		peer.onGossip(len(buf))
+	}
+
 	if delta, err = s.merge(buf); err != nil {
 		logging.LogError("merge", "merging", err)
 	}
@@ -330,12 +394,16 @@ func (s *Swarm) OnGossipBroadcast(src mesh.PeerName, buf []byte) (delta mesh.Gos
 func (s *Swarm) OnGossipUnicast(src mesh.PeerName, buf []byte) (err error) {
 
 	// Decode an incoming message frame
-	frame, err := message.DecodeFrame(buf)
+	frame, err := s.decodeFrame(src, buf)
 	if err != nil {
 		logging.LogError("swarm", "decode frame", err)
 		return err
 	}
 
+	if peer, ok := s.lookup(src); ok {
+		peer.onReceive(len(frame))
+	}
+
 	// Go through each message in the decoded frame
 	for i := range frame {
 		s.OnMessage(&frame[i])
@@ -344,34 +412,104 @@ func (s *Swarm) OnGossipUnicast(src mesh.PeerName, buf []byte) (err error) {
 	return nil
 }
 
+// decodeFrame decodes a message frame received from a peer, which is either plain, raw if
+// it is not compressed, or has its channels aliased. If the peer sent aliases we do not know of, it is asked to reset
+// them and the messages using them are dropped.
+func (s *Swarm) decodeFrame(src mesh.PeerName, buf []byte) (message.Frame, error) {
+	if len(buf) < 2 || buf[0] != frameMarker {
+		return message.DecodeFrame(buf)
+	}
+
+	peer := s.findPeer(src)
+	switch buf[1] {
+	case frameRaw:
+		return decodeRaw(buf[2:])
+
+	case frameAliased, frameAliasedRaw:
+		frame, resync, epoch, err := peer.channels.Decode(buf[2:], buf[1] == frameAliased)
+		if resync {
+			logging.LogTarget("swarm", "unknown channel aliases, resyncing", src)
+			if err := s.gossip.GossipUnicast(src, encodeResync(epoch)); err != nil {
+				logging.LogError("swarm", "gossip unicast", err)
+			}
+		}
+		return frame, err
+
+	case frameResync:
+		epoch, err := decodeResync(buf[2:])
+		if err == nil && peer.aliases != nil {
+			peer.aliases.Reset(epoch)
+		}
+		return nil, err
+	}
+	return nil, errUnknownFrame
+}
+
 // Notify notifies the swarm when an event is on/off.
 func (s *Swarm) Notify(ev event.Event, enabled bool) {
-	op := event.NewState("")
-	if enabled {
-		s.state.Add(ev)
-		op.Add(ev)
-	} else {
-		s.state.Del(ev)
-		op.Del(ev)
+	apply(s.state, ev, enabled)
+
+	// If the changes are batched, add the operation to the pending delta
+	if s.config.DeltaPeriod() > 0 {
+		s.Lock()
+		if s.pending == nil {
+			s.pending = event.NewState("")
+		}
+		apply(s.pending, ev, enabled)
+		s.Unlock()
+		return
 	}
 
 	// Broadcasting just this operation
+	op := event.NewState("")
+	apply(op, ev, enabled)
 	s.gossip.GossipBroadcast(op)
 }
 
+// flush broadcasts the pending delta of the batched changes, if any.
+func (s *Swarm) flush() {
+	s.Lock()
+	delta := s.pending
+	s.pending = nil
+	s.Unlock()
+
+	if delta != nil {
+		s.gossip.GossipBroadcast(delta)
+	}
+}
+
 // Contains checks whether an event is currently triggered within the cluster.
 func (s *Swarm) Contains(ev event.Event) bool {
 	return s.state.Has(ev)
 }
 
-// Close terminates the connection.
-func (s *Swarm) Close() error {
-	if s.cancel != nil {
-		s.cancel()
+// Signers iterates through the public keys the peers sign the delivered messages with.
+func (s *Swarm) Signers(f func(*event.Signer)) {
+	s.state.Signers(f)
+}
+
+// Flush sends the pending delta and the messages queued for every peer right away,
+// without waiting for the next interval. It returns once the frames are handed over
+// to the gossip.
+func (s *Swarm) Flush() {
+	s.flush()
+	for _, peer := range s.members.All() {
+		peer.processSendQueue()
 	}
+}
+
+// Close terminates the connection. It is safe to call it more than once.
+func (s *Swarm) Close() (err error) {
+	s.closing.Do(func() {
+		if s.cancel != nil {
+			s.cancel()
+		}
 
-	s.state.Close()
-	return s.router.Stop()
+		s.flush()
+		s.state.Close()
+		err = s.router.Stop()
+	})
+	return
 }
 
 // getLocalPeerName retrieves or generates a local node name.
@@ -387,3 +525,25 @@ func getLocalPeerName(cfg *config.ClusterConfig) mesh.PeerName {
 
 	return peerName
 }
+
+// apply adds or removes an event from the state.
+func apply(state *event.State, ev event.Event, enabled bool) {
+	if enabled {
+		state.Add(ev)
+	} else {
+		state.Del(ev)
+	}
+}
+
+// ------------------------------------------------------------------------------------
+
+// chunkedState represents our complete state, encoded in chunks of a limited size.
+type chunkedState struct {
+	*event.State
+	maxSize int // The maximum size of a chunk.
+}
+
+// Encode serializes our complete state to a slice of chunks.
+func (c *chunkedState) Encode() [][]byte {
+	return c.State.EncodeChunks(c.maxSize)
+}
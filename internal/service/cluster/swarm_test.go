@@ -20,10 +20,13 @@ import (
 	"github.com/emitter-io/emitter/internal/config"
 	"github.com/emitter-io/emitter/internal/event"
 	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
 	"github.com/stretchr/testify/assert"
 	"github.com/weaveworks/mesh"
 )
 
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
 func newTestMessage(ssid message.Ssid, channel, payload string) message.Message {
 	return message.Message{
 		ID:      message.NewID(ssid),
@@ -65,7 +68,7 @@ func TestNewSwarm_Scenario(t *testing.T) {
 	}
 
 	// Create a new swarm and check if it was constructed well
-	s := NewSwarm(&cfg)
+	s := NewSwarm(&cfg, testKey)
 	s.update()
 
 	assert.Equal(t, 0, s.NumPeers())
@@ -118,7 +121,7 @@ func TestNotify(t *testing.T) {
 	}
 
 	// Create a new swarm and check if it was constructed well
-	s := NewSwarm(&cfg)
+	s := NewSwarm(&cfg, testKey)
 	defer s.Close()
 
 	// TODO: Test actual correctness as well
@@ -154,7 +157,7 @@ func Test_merge(t *testing.T) {
 	var subscribed bool
 
 	// Create a new swarm and check if it was constructed well
-	s := NewSwarm(&cfg)
+	s := NewSwarm(&cfg, testKey)
 	s.OnSubscribe = func(message.Subscriber, *event.Subscription) bool {
 		subscribed = true
 		return true
@@ -174,3 +177,71 @@ func TestJoin(t *testing.T) {
 	errs := s.Join("google.com", "127.0.0.1", "127.0.0.1:4000")
 	assert.Empty(t, errs)
 }
+
+func TestNotify_Batched(t *testing.T) {
+	cfg := config.ClusterConfig{
+		NodeName:      "00:00:00:00:00:01",
+		ListenAddr:    ":4000",
+		AdvertiseAddr: ":4001",
+		DeltaInterval: 100,
+	}
+
+	s := NewSwarm(&cfg, testKey)
+	s.gossip = new(stubGossip)
+	defer s.Close()
+
+	ev := &event.Subscription{Conn: 5, Ssid: []uint32{1, 2, 3}}
+	s.Notify(ev, true)
+	s.Notify(ev, false)
+	s.Notify(&event.Subscription{Conn: 6, Ssid: []uint32{1, 2, 3}}, true)
+	assert.True(t, s.Contains(&event.Subscription{Conn: 6, Ssid: []uint32{1, 2, 3}}))
+	assert.Equal(t, 2, s.pending.Len())
+
+	s.flush()
+	assert.Nil(t, s.pending)
+	assert.Equal(t, 1, s.gossip.(*stubGossip).broadcasts)
+}
+
+func TestGossip_Chunked(t *testing.T) {
+	cfg := config.ClusterConfig{
+		NodeName:      "00:00:00:00:00:01",
+		ListenAddr:    ":4000",
+		AdvertiseAddr: ":4001",
+		MaxStateSize:  200,
+	}
+
+	s := NewSwarm(&cfg, testKey)
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		s.state.Add(&event.Subscription{Peer: 2, Conn: security.ID(i), Ssid: []uint32{1, 2, 3}})
+	}
+
+	complete := s.Gossip()
+	assert.IsType(t, new(chunkedState), complete)
+	assert.True(t, len(complete.Encode()) > 1)
+}
+
+func TestSwarm_FlushAndClose(t *testing.T) {
+	msg := newTestMessage(message.Ssid{1, 2, 3}, "a/b/c/", "hello abc")
+	cfg := config.ClusterConfig{
+		NodeName:      "00:00:00:00:00:01",
+		ListenAddr:    ":4000",
+		AdvertiseAddr: ":4001",
+	}
+
+	s := NewSwarm(&cfg, testKey)
+	gossip := new(stubGossip)
+	peer := s.findPeer(123)
+	peer.sender = gossip
+
+	// The queued frame must be sent synchronously
+	assert.NoError(t, s.SendTo(123, &msg))
+	s.Flush()
+	assert.Len(t, gossip.unicasts, 1)
+	assert.Empty(t, peer.frame)
+
+	// Closing twice must be harmless
+	assert.NoError(t, s.Close())
+	assert.NoError(t, s.Close())
+}
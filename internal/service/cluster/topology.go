@@ -0,0 +1,118 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package cluster
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/weaveworks/mesh"
+)
+
+// The states of a peer, as seen by this node.
+const (
+	PeerAlive   = "alive"   // The peer was recently seen.
+	PeerSuspect = "suspect" // The peer was not seen for a while, but is still considered active.
+	PeerDead    = "dead"    // The peer is no longer active and will be removed.
+)
+
+// How long a peer can remain silent before it becomes a suspect.
+const suspectAfter = 10 * time.Second
+
+// Topology represents the cluster topology, as seen by this node.
+type Topology struct {
+	Node  string     `json:"node"`  // The name of this node.
+	State int        `json:"state"` // The number of events in the replicated state of this node.
+	Peers []PeerInfo `json:"peers"` // The peers of this node.
+}
+
+// PeerInfo represents the state and health information of a peer.
+type PeerInfo struct {
+	Name          string  `json:"name"`                // The name of the peer.
+	Addr          string  `json:"addr,omitempty"`      // The advertised address of the peer.
+	State         string  `json:"state"`               // The state of the peer.
+	Connections   int     `json:"connections"`         // The number of connections of the peer.
+	Subscriptions int     `json:"subscriptions"`       // The number of subscriptions of the peer.
+	LastSeen      int64   `json:"lastSeen"`            // The unix time of the last activity of the peer.
+	GossipLag     float64 `json:"gossipLag,omitempty"` // The seconds since the last gossip broadcast from the peer.
+	SentRate      float64 `json:"sentRate"`            // The number of messages forwarded to the peer per second.
+	ReceivedRate  float64 `json:"receivedRate"`        // The number of messages received from the peer per second.
+	StateBytes    int64   `json:"stateBytes"`          // The number of bytes of state deltas received from the peer.
+	StateRate     float64 `json:"stateRate"`           // The number of bytes of state deltas received from the peer per second.
+}
+
+// Topology returns the current cluster topology, along with the health of every peer.
+func (s *Swarm) Topology() *Topology {
+	descriptions := make(map[mesh.PeerName]mesh.PeerDescription)
+	if s.router != nil {
+		for _, d := range s.router.Peers.Descriptions() {
+			descriptions[d.Name] = d
+		}
+	}
+
+	now := time.Now()
+	topology := &Topology{
+		Node:  s.name.String(),
+		State: s.StateLen(),
+		Peers: make([]PeerInfo, 0, 8),
+	}
+
+	for _, peer := range s.members.All() {
+		info := peer.info(now)
+		if d, ok := descriptions[peer.name]; ok {
+			info.Addr = d.NickName
+			info.Connections = d.NumConnections
+		}
+
+		topology.Peers = append(topology.Peers, info)
+	}
+
+	sort.Slice(topology.Peers, func(i, j int) bool {
+		return topology.Peers[i].Name < topology.Peers[j].Name
+	})
+	return topology
+}
+
+// info returns the state and health information of the peer.
+func (p *Peer) info(now time.Time) PeerInfo {
+	p.Lock()
+	defer p.Unlock()
+
+	lastSeen := atomic.LoadInt64(&p.activity)
+	info := PeerInfo{
+		Name:          p.name.String(),
+		Subscriptions: p.subs.Count(),
+		LastSeen:      lastSeen,
+		SentRate:      p.rates.sent,
+		ReceivedRate:  p.rates.received,
+		StateBytes:    atomic.LoadInt64(&p.state),
+		StateRate:     p.rates.state,
+	}
+
+	switch {
+	case !p.IsActive():
+		info.State = PeerDead
+	case now.Sub(time.Unix(lastSeen, 0)) > suspectAfter:
+		info.State = PeerSuspect
+	default:
+		info.State = PeerAlive
+	}
+
+	if gossip := atomic.LoadInt64(&p.gossip); gossip > 0 {
+		info.GossipLag = now.Sub(time.Unix(0, gossip)).Seconds()
+	}
+	return info
+}
@@ -0,0 +1,96 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package cluster
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/mesh"
+)
+
+func TestTopology(t *testing.T) {
+	s := &Swarm{name: 1}
+	s.members = newMemberlist(s.newPeer)
+
+	alive, _ := s.members.GetOrAdd(2)
+	defer alive.Close()
+	alive.sender = new(stubGossip)
+	alive.onSubscribe("A", message.Ssid{1, 2, 3})
+	alive.onGossip(100)
+
+	suspect, _ := s.members.GetOrAdd(3)
+	defer suspect.Close()
+	atomic.StoreInt64(&suspect.activity, time.Now().Add(-20*time.Second).Unix())
+
+	dead, _ := s.members.GetOrAdd(4)
+	defer dead.Close()
+	atomic.StoreInt64(&dead.activity, 0)
+
+	topology := s.Topology()
+	assert.Equal(t, mesh.PeerName(1).String(), topology.Node)
+	assert.Len(t, topology.Peers, 3)
+	assert.Equal(t, PeerAlive, topology.Peers[0].State)
+	assert.Equal(t, 1, topology.Peers[0].Subscriptions)
+	assert.True(t, topology.Peers[0].GossipLag >= 0)
+	assert.Equal(t, int64(100), topology.Peers[0].StateBytes)
+	assert.Equal(t, PeerSuspect, topology.Peers[1].State)
+	assert.Equal(t, PeerDead, topology.Peers[2].State)
+}
+
+func TestStateLen(t *testing.T) {
+	s := &Swarm{name: 1}
+	s.members = newMemberlist(s.newPeer)
+	assert.Equal(t, 0, s.StateLen())
+
+	s.state = event.NewState(":memory:")
+	defer s.state.Close()
+	s.state.Add(&event.Subscription{Peer: 2, Conn: 1, Ssid: message.Ssid{1, 2}})
+	s.state.Add(&event.Subscription{Peer: 2, Conn: 2, Ssid: message.Ssid{1, 2}})
+	s.state.Del(&event.Subscription{Peer: 2, Conn: 2, Ssid: message.Ssid{1, 2}})
+	assert.Equal(t, 2, s.StateLen())
+	assert.Equal(t, 2, s.Topology().State)
+}
+
+func TestPeerRates(t *testing.T) {
+	var r peerRates
+	now := time.Now()
+
+	r.sample(10, 20, 0, now)
+	assert.Equal(t, 0.0, r.sent)
+
+	r.sample(60, 40, 500, now.Add(5*time.Second))
+	assert.Equal(t, 10.0, r.sent)
+	assert.Equal(t, 4.0, r.received)
+	assert.Equal(t, 100.0, r.state)
+}
+
+func TestPeer_Counters(t *testing.T) {
+	s := new(Swarm)
+	p := s.newPeer(123)
+	defer p.Close()
+
+	p.Send(&message.Message{})
+	p.onReceive(3)
+	p.sample()
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&p.sent))
+	assert.Equal(t, int64(1), s.Forwarded())
+	assert.Equal(t, int64(3), atomic.LoadInt64(&p.received))
+}
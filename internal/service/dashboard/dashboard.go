@@ -0,0 +1,167 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+)
+
+const (
+	defaultInspected = 20  // The default number of messages inspected.
+	maxInspected     = 500 // The maximum number of messages inspected.
+)
+
+// Stats represents the live counters of the node, from which the dashboard computes the
+// message rates.
+type Stats struct {
+	Node          string `json:"node"`          // The name of the node.
+	Time          int64  `json:"time"`          // The unix time of the counters, in milliseconds.
+	Connections   int64  `json:"connections"`   // The number of open connections.
+	Subscriptions int    `json:"subscriptions"` // The number of subscriptions.
+	Peers         int    `json:"peers"`         // The number of peers in the cluster.
+	Received      int64  `json:"received"`      // The number of messages received from the clients.
+	Sent          int64  `json:"sent"`          // The number of messages sent to the clients.
+	Ingress       int64  `json:"ingress"`       // The number of bytes received from the clients.
+	Egress        int64  `json:"egress"`        // The number of bytes sent to the clients.
+}
+
+// Inspected represents a stored message, as shown by the message inspector.
+type Inspected struct {
+	Time    int64             `json:"time"`              // The unix time of the message.
+	Channel string            `json:"channel"`           // The channel of the message.
+	TTL     uint32            `json:"ttl"`               // The time-to-live of the message.
+	Headers map[string]string `json:"headers,omitempty"` // The headers of the message.
+	Payload string            `json:"payload"`           // The payload, or its size if it is binary.
+}
+
+// Service represents the web dashboard of the node, which shows the cluster topology, the
+// live message rates, the top channels and the messages stored on a channel.
+type Service struct {
+	store    storage.Storage // The storage the inspected messages are read from.
+	contract uint32          // The contract inspected by default.
+	stats    func() Stats    // The function which reads the live counters.
+}
+
+// New creates a new dashboard.
+func New(store storage.Storage, contract uint32, stats func() Stats) *Service {
+	return &Service{
+		store:    store,
+		contract: contract,
+		stats:    stats,
+	}
+}
+
+// OnHTTP occurs when the page of the dashboard is requested.
+func (s *Service) OnHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexPage)
+}
+
+// OnStats occurs when the live counters of the node are requested.
+func (s *Service) OnStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	stats := s.stats()
+	stats.Time = time.Now().UnixNano() / int64(time.Millisecond)
+	reply(w, &stats)
+}
+
+// OnInspect occurs when the messages stored on a 'channel' are inspected, optionally of a
+// 'contract' other than the one of the license, the most recent 'limit' ones.
+func (s *Service) OnInspect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	channel := security.ParseChannel([]byte("emitter/" + r.URL.Query().Get("channel")))
+	if channel.ChannelType != security.ChannelStatic {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	contract, limit := s.contract, defaultInspected
+	if v := r.URL.Query().Get("contract"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		contract = uint32(n)
+	}
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if limit = n; limit > maxInspected {
+			limit = maxInspected
+		}
+	}
+
+	zero := time.Unix(0, 0)
+	msgs, err := s.store.Query(message.NewSsid(contract, channel.Query), zero, zero, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]Inspected, 0, len(msgs))
+	for i := range msgs {
+		out = append(out, inspect(&msgs[i]))
+	}
+	reply(w, out)
+}
+
+// inspect returns the inspected message, the binary payloads being replaced by their size.
+func inspect(m *message.Message) Inspected {
+	payload := string(m.Payload)
+	if !utf8.Valid(m.Payload) {
+		payload = "<" + strconv.Itoa(len(m.Payload)) + " bytes>"
+	}
+
+	return Inspected{
+		Time:    m.Time(),
+		Channel: string(m.Channel),
+		TTL:     m.TTL,
+		Headers: m.Headers,
+		Payload: payload,
+	}
+}
+
+// reply writes the response as JSON.
+func reply(w http.ResponseWriter, v interface{}) {
+	resp, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
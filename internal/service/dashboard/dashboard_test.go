@@ -0,0 +1,104 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService() (*Service, storage.Storage) {
+	store := storage.NewInMemory(nil)
+	store.Configure(nil)
+	return New(store, 1, func() Stats {
+		return Stats{Node: "node-a", Connections: 3}
+	}), store
+}
+
+func TestOnHTTP(t *testing.T) {
+	s, store := newTestService()
+	defer store.Close()
+
+	w := httptest.NewRecorder()
+	s.OnHTTP(w, httptest.NewRequest("GET", "/admin/dashboard", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Emitter Dashboard")
+
+	w = httptest.NewRecorder()
+	s.OnHTTP(w, httptest.NewRequest("POST", "/admin/dashboard", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOnStats(t *testing.T) {
+	s, store := newTestService()
+	defer store.Close()
+
+	w := httptest.NewRecorder()
+	s.OnStats(w, httptest.NewRequest("GET", "/admin/dashboard/stats", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stats Stats
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, "node-a", stats.Node)
+	assert.Equal(t, int64(3), stats.Connections)
+	assert.NotZero(t, stats.Time)
+}
+
+func TestOnInspect(t *testing.T) {
+	s, store := newTestService()
+	defer store.Close()
+
+	channel := security.ParseChannel([]byte("emitter/a/b/"))
+	for _, payload := range [][]byte{[]byte("hello"), {0xff, 0xfe}} {
+		msg := message.New(message.NewSsid(1, channel.Query), channel.Channel, payload)
+		msg.TTL = 60
+		assert.NoError(t, store.Store(msg))
+	}
+
+	tests := []struct {
+		url   string
+		code  int
+		count int
+	}{
+		{url: "/admin/inspect?channel=a/+/", code: 400},
+		{url: "/admin/inspect?channel=a/b/&contract=x", code: 400},
+		{url: "/admin/inspect?channel=a/b/&limit=0", code: 400},
+		{url: "/admin/inspect?channel=a/b/&contract=2", code: 200, count: 0},
+		{url: "/admin/inspect?channel=a/b/", code: 200, count: 2},
+	}
+
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		s.OnInspect(w, httptest.NewRequest("GET", tc.url, nil))
+		assert.Equal(t, tc.code, w.Code, tc.url)
+		if tc.code == http.StatusOK {
+			var out []Inspected
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+			assert.Len(t, out, tc.count)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	m := message.New(message.Ssid{1, 2}, []byte("a/"), []byte{0xff, 0x00})
+	assert.Equal(t, "<2 bytes>", inspect(m).Payload)
+}
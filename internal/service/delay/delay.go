@@ -0,0 +1,359 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package delay
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	codec "github.com/kelindar/binary"
+)
+
+const (
+	logFile    = "delayed.log" // The name of the log of the held messages.
+	opAdd      = uint8(1)      // The record of a message being held.
+	opDone     = uint8(2)      // The record of a message being delivered.
+	minCompact = 1000          // The minimum number of delivered records before compacting.
+)
+
+// Deliver represents a function delivering a message once its delivery time has come.
+type Deliver func(m *message.Message, stored bool)
+
+// Queue represents the messages held until their delivery time. If a directory is given, the
+// messages are written into an append-only log so they survive restarts, and a message is
+// delivered again if the node stopped right before recording its delivery.
+type Queue struct {
+	sync.Mutex
+	pending  map[uint64]*entry // The held messages, by their identifier.
+	due      entries           // The held messages, by their delivery time.
+	next     uint64            // The identifier of the next message.
+	done     int               // The number of delivered records in the log.
+	maxDelay time.Duration     // The maximum delay of a message.
+	maxCount int               // The maximum number of held messages.
+	deliver  Deliver           // The function delivering the messages.
+	dir      string            // The directory of the log, if persisted.
+	file     *os.File          // The log, if persisted.
+	wake     chan struct{}     // The channel waking up the delivery loop.
+}
+
+// New creates a new queue of held messages, reloading the messages held in the directory
+// and delivering them as they become due.
+func New(ctx context.Context, dir string, maxDelay time.Duration, maxCount int, deliver Deliver) (*Queue, error) {
+	q := &Queue{
+		pending:  make(map[uint64]*entry),
+		maxDelay: maxDelay,
+		maxCount: maxCount,
+		deliver:  deliver,
+		dir:      dir,
+		wake:     make(chan struct{}, 1),
+	}
+
+	if dir != "" {
+		if err := q.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	go q.loop(ctx)
+	return q, nil
+}
+
+// Delay holds the message until the delivery time.
+func (q *Queue) Delay(m *message.Message, at time.Time, stored bool) *errors.Error {
+	if time.Until(at) > q.maxDelay {
+		return errors.ErrBadRequest
+	}
+
+	q.Lock()
+	defer q.Unlock()
+	if len(q.pending) >= q.maxCount {
+		return errors.ErrOverloaded
+	}
+
+	q.next++
+	e := &entry{
+		ID:      q.next,
+		Due:     at.UnixNano(),
+		Stored:  stored,
+		Message: m.Encode(),
+	}
+
+	if err := q.append(opAdd, e); err != nil {
+		logging.LogError("delay", "holding a message", err)
+		return errors.ErrServerError
+	}
+
+	q.pending[e.ID] = e
+	heap.Push(&q.due, e)
+	if q.due[0] == e {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Len returns the number of held messages.
+func (q *Queue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.pending)
+}
+
+// loop delivers the messages as they become due.
+func (q *Queue) loop(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		q.flush(time.Now())
+
+		// Sleep until the next message is due, or a sooner one is held
+		timer.Reset(q.wait(time.Now()))
+		select {
+		case <-ctx.Done():
+			q.close()
+			return
+		case <-q.wake:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+		}
+	}
+}
+
+// wait returns the duration until the next message is due.
+func (q *Queue) wait(now time.Time) time.Duration {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.due) == 0 {
+		return time.Hour
+	}
+	return time.Unix(0, q.due[0].Due).Sub(now)
+}
+
+// flush delivers the messages which are due and records their delivery.
+func (q *Queue) flush(now time.Time) {
+	for _, e := range q.pop(now.UnixNano()) {
+		if m, err := message.DecodeMessage(e.Message); err == nil {
+			m.ID = message.NewID(m.Ssid()) // Published at the delivery time
+			q.deliver(&m, e.Stored)
+		}
+
+		q.Lock()
+		delete(q.pending, e.ID)
+		if err := q.append(opDone, &entry{ID: e.ID}); err != nil {
+			logging.LogError("delay", "recording a delivery", err)
+		}
+		q.Unlock()
+	}
+
+	q.Lock()
+	defer q.Unlock()
+	if q.done >= minCompact && q.done > len(q.pending) {
+		if err := q.compact(); err != nil {
+			logging.LogError("delay", "compacting the log", err)
+		}
+	}
+}
+
+// pop removes the messages which are due from the heap.
+func (q *Queue) pop(now int64) (out []*entry) {
+	q.Lock()
+	defer q.Unlock()
+	for len(q.due) > 0 && q.due[0].Due <= now {
+		out = append(out, heap.Pop(&q.due).(*entry))
+	}
+	return
+}
+
+// ------------------------------------------------------------------------------------
+
+// load replays the log of the directory and compacts it.
+func (q *Queue) load() error {
+	if err := os.MkdirAll(q.dir, 0777); err != nil {
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(q.dir, logFile))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		err = replay(f, func(op uint8, e *entry) {
+			switch op {
+			case opAdd:
+				q.pending[e.ID] = e
+			case opDone:
+				delete(q.pending, e.ID)
+			}
+			if e.ID > q.next {
+				q.next = e.ID
+			}
+		})
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, e := range q.pending {
+		heap.Push(&q.due, e)
+	}
+	return q.compact()
+}
+
+// compact rewrites the log with only the held messages.
+func (q *Queue) compact() error {
+	path := filepath.Join(q.dir, logFile)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, e := range q.pending {
+		if err := write(w, opAdd, e); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	// Reopen the log for appending
+	if q.file != nil {
+		q.file.Close()
+	}
+
+	q.done = 0
+	q.file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0666)
+	return err
+}
+
+// append appends a record to the log, if persisted.
+func (q *Queue) append(op uint8, e *entry) error {
+	if q.file == nil {
+		return nil
+	}
+
+	if op == opDone {
+		q.done++
+	}
+	return write(q.file, op, e)
+}
+
+// close closes the log.
+func (q *Queue) close() {
+	q.Lock()
+	defer q.Unlock()
+	if q.file != nil {
+		q.file.Close()
+		q.file = nil
+	}
+}
+
+// write writes a record, prefixed by its operation and its length.
+func write(w io.Writer, op uint8, e *entry) error {
+	b, err := codec.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	head := make([]byte, 5, 5+len(b))
+	head[0] = op
+	binary.BigEndian.PutUint32(head[1:], uint32(len(b)))
+	_, err = w.Write(append(head, b...))
+	return err
+}
+
+// replay reads the records of a log. A truncated record at the end of the log, written
+// while the node stopped, is ignored.
+func replay(r io.Reader, f func(uint8, *entry)) error {
+	reader := bufio.NewReader(r)
+	head := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(reader, head); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		b := make([]byte, binary.BigEndian.Uint32(head[1:]))
+		if _, err := io.ReadFull(reader, b); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		e := new(entry)
+		if err := codec.Unmarshal(b, e); err != nil {
+			return fmt.Errorf("corrupted record: %w", err)
+		}
+		f(head[0], e)
+	}
+}
+
+// ------------------------------------------------------------------------------------
+
+// entry represents a held message.
+type entry struct {
+	ID      uint64 // The identifier of the message.
+	Due     int64  // The delivery time, in unix nanoseconds.
+	Stored  bool   // Whether the message should be stored once delivered.
+	Message []byte // The encoded message.
+}
+
+// entries represents a heap of held messages, ordered by their delivery time.
+type entries []*entry
+
+func (h entries) Len() int            { return len(h) }
+func (h entries) Less(i, j int) bool  { return h[i].Due < h[j].Due }
+func (h entries) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *entries) Push(x interface{}) { *h = append(*h, x.(*entry)) }
+func (h *entries) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,155 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package delay
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	sync.Mutex
+	msgs   []message.Message
+	stored []bool
+}
+
+func (r *recorder) deliver(m *message.Message, stored bool) {
+	r.Lock()
+	defer r.Unlock()
+	r.msgs = append(r.msgs, *m)
+	r.stored = append(r.stored, stored)
+}
+
+func (r *recorder) count() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.msgs)
+}
+
+func newMessage(payload string) *message.Message {
+	return message.New(message.Ssid{1, 2, 3}, []byte("a/b/c/"), []byte(payload))
+}
+
+func TestDelay_Deliver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := new(recorder)
+	q, err := New(ctx, "", time.Hour, 10, r.deliver)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	assert.Nil(t, q.Delay(newMessage("later"), now.Add(time.Hour), false))
+	assert.Nil(t, q.Delay(newMessage("second"), now.Add(100*time.Millisecond), true))
+	assert.Nil(t, q.Delay(newMessage("first"), now.Add(50*time.Millisecond), false))
+	assert.Equal(t, 3, q.Len())
+
+	assert.Eventually(t, func() bool { return r.count() == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "first", string(r.msgs[0].Payload))
+	assert.Equal(t, "second", string(r.msgs[1].Payload))
+	assert.Equal(t, []bool{false, true}, r.stored)
+	assert.Equal(t, message.Ssid{1, 2, 3}, r.msgs[0].Ssid())
+	assert.True(t, r.msgs[0].Time() >= now.Unix())
+	assert.Equal(t, 1, q.Len())
+}
+
+func TestDelay_Limits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := new(recorder)
+	q, err := New(ctx, "", time.Hour, 1, r.deliver)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	assert.Equal(t, errors.ErrBadRequest, q.Delay(newMessage("a"), now.Add(2*time.Hour), false))
+	assert.Nil(t, q.Delay(newMessage("b"), now.Add(time.Minute), false))
+	assert.Equal(t, errors.ErrOverloaded, q.Delay(newMessage("c"), now.Add(time.Minute), false))
+}
+
+func TestDelay_Restart(t *testing.T) {
+	dir, err := os.MkdirTemp("", "delay")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Hold messages, one of which is delivered before the node stops
+	r := new(recorder)
+	ctx, cancel := context.WithCancel(context.Background())
+	q, err := New(ctx, dir, time.Hour, 10, r.deliver)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	assert.Nil(t, q.Delay(newMessage("now"), now, false))
+	assert.Nil(t, q.Delay(newMessage("soon"), now.Add(time.Second), true))
+	assert.Nil(t, q.Delay(newMessage("later"), now.Add(time.Hour), false))
+	assert.Eventually(t, func() bool { return r.count() == 1 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.Eventually(t, func() bool { return q.Len() == 2 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	// Simulate a record truncated while the node stopped
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0666)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte{opAdd, 0, 0, 1})
+	assert.NoError(t, err)
+	f.Close()
+
+	// The held messages survive the restart
+	time.Sleep(time.Second)
+	r = new(recorder)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	q, err = New(ctx, dir, time.Hour, 10, r.deliver)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return r.count() == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "soon", string(r.msgs[0].Payload))
+	assert.Equal(t, []bool{true}, r.stored)
+	assert.Equal(t, 1, q.Len())
+
+	// New messages do not reuse the identifiers of the held ones
+	assert.Nil(t, q.Delay(newMessage("next"), now.Add(time.Hour), false))
+	assert.Equal(t, uint64(4), q.next)
+}
+
+func TestDelay_Compact(t *testing.T) {
+	dir, err := os.MkdirTemp("", "delay")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := new(recorder)
+	q, err := New(ctx, dir, time.Hour, 10000, r.deliver)
+	assert.NoError(t, err)
+
+	for i := 0; i < minCompact; i++ {
+		assert.Nil(t, q.Delay(newMessage("hi"), time.Now(), false))
+	}
+
+	assert.Eventually(t, func() bool { return r.count() == minCompact }, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(filepath.Join(dir, logFile))
+		return err == nil && info.Size() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -16,8 +16,10 @@ package fake
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/emitter-io/emitter/internal/errors"
 	"github.com/emitter-io/emitter/internal/event"
 	"github.com/emitter-io/emitter/internal/message"
 	"github.com/emitter-io/emitter/internal/provider/contract"
@@ -27,14 +29,21 @@ import (
 )
 
 var (
-	_ service.Authorizer = new(Authorizer)
-	_ service.Replicator = new(Replicator)
-	_ service.PubSub     = new(PubSub)
-	_ service.Conn       = new(Conn)
-	_ service.Decryptor  = new(Decryptor)
-	_ contract.Contract  = new(Contract)
-	_ service.Surveyor   = new(Surveyor)
-	_ service.Notifier   = new(Notifier)
+	_ service.Authorizer   = new(Authorizer)
+	_ service.Replicator   = new(Replicator)
+	_ service.PubSub       = new(PubSub)
+	_ service.Conn         = new(Conn)
+	_ service.Decryptor    = new(Decryptor)
+	_ contract.Contract    = new(Contract)
+	_ service.Surveyor     = new(Surveyor)
+	_ service.Notifier     = new(Notifier)
+	_ service.Shedder      = new(Shedder)
+	_ service.Scheduler    = new(Scheduler)
+	_ service.Delayer      = new(Delayer)
+	_ service.DeadLetterer = new(DeadLetterer)
+	_ service.Observer     = new(Observer)
+	_ service.Auditor      = new(Auditor)
+	_ service.Connector    = new(Connector)
 )
 
 // ------------------------------------------------------------------------------------
@@ -45,6 +54,8 @@ type Authorizer struct {
 	Target    string
 	ExtraPerm uint8
 	Success   bool
+	Limits    contract.Limits
+	Expires   time.Time
 }
 
 // Authorize provides a fake implementation.
@@ -56,9 +67,14 @@ func (f *Authorizer) Authorize(channel *security.Channel, perms uint8) (contract
 		key.SetPermission(f.ExtraPerm, true)
 	}
 
+	if !f.Expires.IsZero() {
+		key.SetExpires(f.Expires)
+	}
+
 	key.SetContract(f.Contract)
 	return &Contract{
 		Invalid: !f.Success,
+		Caps:    f.Limits,
 	}, key, f.Success
 }
 
@@ -93,6 +109,9 @@ func (f *PubSub) Publish(m *message.Message, filter func(message.Subscriber) boo
 // Subscribe provides a fake implementation.
 func (f *PubSub) Subscribe(sub message.Subscriber, ev *event.Subscription) bool {
 	f.initialize()
+	if conn, ok := sub.(service.Conn); ok {
+		conn.CanSubscribe(ev.Ssid, ev.Channel)
+	}
 	f.Trie.Subscribe(ev.Ssid, sub)
 	return true
 }
@@ -100,6 +119,9 @@ func (f *PubSub) Subscribe(sub message.Subscriber, ev *event.Subscription) bool
 // Unsubscribe provides a fake implementation.
 func (f *PubSub) Unsubscribe(sub message.Subscriber, ev *event.Subscription) bool {
 	f.initialize()
+	if conn, ok := sub.(service.Conn); ok {
+		conn.CanUnsubscribe(ev.Ssid, ev.Channel)
+	}
 	f.Trie.Unsubscribe(ev.Ssid, sub)
 	return true
 }
@@ -139,7 +161,13 @@ func (f *Replicator) Notify(ev event.Event, enabled bool) {
 
 // Notifier fake.
 type Notifier struct {
-	Events []event.Subscription
+	Events    []event.Subscription
+	Published []int
+}
+
+// NotifyPublish provides a fake implementation.
+func (f *Notifier) NotifyPublish(m *message.Message, subscribers int) {
+	f.Published = append(f.Published, subscribers)
 }
 
 // NotifySubscribe provides a fake implementation.
@@ -160,6 +188,12 @@ type Conn struct {
 	Disabled  bool
 	Outgoing  []message.Message
 	Shortcuts map[string]string
+	Signed    bool
+	Headers   bool
+	Chunks    int
+	Expiry    time.Duration
+	Metadata  map[string]string
+	subs      *message.Counters
 }
 
 // Initializes the fake.
@@ -167,6 +201,9 @@ func (f *Conn) initialize() {
 	if f.Shortcuts == nil {
 		f.Shortcuts = make(map[string]string)
 	}
+	if f.subs == nil {
+		f.subs = message.NewCounters()
+	}
 }
 
 // Close provides a fake implementation.
@@ -191,15 +228,29 @@ func (f *Conn) Send(m *message.Message) error {
 }
 
 // CanSubscribe provides a fake implementation.
-func (f *Conn) CanSubscribe(message.Ssid, []byte) bool {
+func (f *Conn) CanSubscribe(ssid message.Ssid, channel []byte) bool {
+	f.initialize()
+	if !f.Disabled && len(ssid) > 0 {
+		f.subs.Increment(ssid, channel)
+	}
 	return !f.Disabled
 }
 
 // CanUnsubscribe provides a fake implementation.
-func (f *Conn) CanUnsubscribe(message.Ssid, []byte) bool {
+func (f *Conn) CanUnsubscribe(ssid message.Ssid, channel []byte) bool {
+	f.initialize()
+	if !f.Disabled && len(ssid) > 0 {
+		f.subs.Decrement(ssid)
+	}
 	return !f.Disabled
 }
 
+// Subscriptions provides a fake implementation.
+func (f *Conn) Subscriptions() *message.Counters {
+	f.initialize()
+	return f.subs
+}
+
 // LocalID provides a fake implementation.
 func (f *Conn) LocalID() security.ID {
 	return security.ID(f.ConnID)
@@ -210,6 +261,11 @@ func (f *Conn) Username() string {
 	return fmt.Sprintf("user of %v", f.ConnID)
 }
 
+// Meta provides a fake implementation.
+func (f *Conn) Meta() map[string]string {
+	return f.Metadata
+}
+
 // Track provides a fake implementation.
 func (f *Conn) Track(contract.Contract) {
 
@@ -236,6 +292,26 @@ func (f *Conn) AddLink(alias string, channel *security.Channel) {
 	f.Shortcuts[alias] = channel.String()
 }
 
+// EnableSigning provides a fake implementation.
+func (f *Conn) EnableSigning(enabled bool) {
+	f.Signed = enabled
+}
+
+// EnableHeaders provides a fake implementation.
+func (f *Conn) EnableHeaders(enabled bool) {
+	f.Headers = enabled
+}
+
+// EnableChunks provides a fake implementation.
+func (f *Conn) EnableChunks(size int) {
+	f.Chunks = size
+}
+
+// WarnExpiry provides a fake implementation.
+func (f *Conn) WarnExpiry(before time.Duration) {
+	f.Expiry = before
+}
+
 // ------------------------------------------------------------------------------------
 
 // Decryptor fake.
@@ -259,6 +335,9 @@ func (f *Decryptor) DecryptKey(k string) (security.Key, error) {
 // Contract fake.
 type Contract struct {
 	Invalid bool
+	Rules   []contract.Retention
+	Regions contract.Placement
+	Caps    contract.Limits
 }
 
 // Validate validates the contract data against a key.
@@ -271,23 +350,212 @@ func (f *Contract) Stats() usage.Meter {
 	return usage.NewNoop().Get(1)
 }
 
+// Weight gets the scheduling weight.
+func (f *Contract) Weight() int {
+	return 1
+}
+
+// Retention gets the retention rules.
+func (f *Contract) Retention() []contract.Retention {
+	return f.Rules
+}
+
+// Placement gets the regions.
+func (f *Contract) Placement() contract.Placement {
+	return f.Regions
+}
+
+// Limits gets the limits of each connection.
+func (f *Contract) Limits() contract.Limits {
+	return f.Caps
+}
+
 // ------------------------------------------------------------------------------------
 
 // Surveyor fake.
 type Surveyor struct {
-	Resp [][]byte
-	Err  error
+	Resp  [][]byte
+	Err   error
+	Peers int // The number of responses expected, defaults to the number of responses.
 }
 
 // Query provides a fake implementation.
 func (f *Surveyor) Query(string, []byte) (message.Awaiter, error) {
-	return &awaiter{f.Resp}, f.Err
+	expected := f.Peers
+	if expected == 0 {
+		expected = len(f.Resp)
+	}
+	return &awaiter{f.Resp, expected}, f.Err
 }
 
 type awaiter struct {
-	r [][]byte
+	r        [][]byte
+	expected int
 }
 
 func (a *awaiter) Gather(timeout time.Duration) [][]byte {
 	return a.r
 }
+
+func (a *awaiter) Expected() int {
+	return a.expected
+}
+
+// ------------------------------------------------------------------------------------
+
+// Shedder fake.
+type Shedder struct {
+	Level uint8
+}
+
+// Shed provides a fake implementation.
+func (f *Shedder) Shed(priority uint8) bool {
+	return f.Level >= priority && f.Level > 0
+}
+
+// ------------------------------------------------------------------------------------
+
+// Scheduler fake.
+type Scheduler struct{}
+
+// Schedule provides a fake implementation which runs the work inline.
+func (f *Scheduler) Schedule(contract uint32, fn func()) {
+	fn()
+}
+
+// Enqueue provides a fake implementation which runs the work inline.
+func (f *Scheduler) Enqueue(contract uint32, fn func()) {
+	fn()
+}
+
+// ------------------------------------------------------------------------------------
+
+// Scanner fake.
+type Scanner struct {
+	Hold    bool
+	Clean   bool
+	Scanned int
+}
+
+// Matches provides a fake implementation.
+func (f *Scanner) Matches(channel []byte) bool {
+	return true
+}
+
+// Holds provides a fake implementation.
+func (f *Scanner) Holds() bool {
+	return f.Hold
+}
+
+// Scan provides a fake implementation which returns the verdict inline.
+func (f *Scanner) Scan(m *message.Message, verdict func(bool)) {
+	f.Scanned++
+	verdict(f.Clean)
+}
+
+// ------------------------------------------------------------------------------------
+
+// Transformer fake.
+type Transformer struct {
+	Payload string        // The payload the messages are given, if not empty.
+	Err     *errors.Error // The error returned, if any.
+}
+
+// Transform provides a fake implementation which replaces the payload of the messages.
+func (f *Transformer) Transform(m *message.Message) *errors.Error {
+	if f.Err == nil && f.Payload != "" {
+		m.Payload = []byte(f.Payload)
+	}
+	return f.Err
+}
+
+// ------------------------------------------------------------------------------------
+
+// Router fake.
+type Router struct {
+	Drop   bool               // Whether the messages are dropped.
+	Routed []*message.Message // The messages routed.
+}
+
+// Route provides a fake implementation which records the messages.
+func (f *Router) Route(m *message.Message) bool {
+	f.Routed = append(f.Routed, m)
+	return !f.Drop
+}
+
+// ------------------------------------------------------------------------------------
+
+// Connector fake.
+type Connector struct {
+	sync.Mutex
+	Sent []message.Message // The messages sent.
+	Err  error             // The error returned, if any.
+}
+
+// Send provides a fake implementation which records the messages.
+func (f *Connector) Send(m *message.Message) error {
+	f.Lock()
+	defer f.Unlock()
+	f.Sent = append(f.Sent, *m)
+	return f.Err
+}
+
+// Messages returns a copy of the messages sent.
+func (f *Connector) Messages() []message.Message {
+	f.Lock()
+	defer f.Unlock()
+	return append([]message.Message(nil), f.Sent...)
+}
+
+// ------------------------------------------------------------------------------------
+
+// Delayer fake.
+type Delayer struct {
+	Held []message.Message
+	At   []time.Time
+}
+
+// Delay provides a fake implementation which records the held messages.
+func (f *Delayer) Delay(m *message.Message, at time.Time, stored bool) *errors.Error {
+	f.Held = append(f.Held, *m)
+	f.At = append(f.At, at)
+	return nil
+}
+
+// ------------------------------------------------------------------------------------
+
+// DeadLetterer fake.
+type DeadLetterer struct {
+	Letters []message.Message
+	Reasons []string
+}
+
+// DeadLetter provides a fake implementation which records the dead letters.
+func (f *DeadLetterer) DeadLetter(m *message.Message, reason string) {
+	f.Letters = append(f.Letters, *m)
+	f.Reasons = append(f.Reasons, reason)
+}
+
+// ------------------------------------------------------------------------------------
+
+// Observer fake.
+type Observer struct {
+	Observed []message.Message
+}
+
+// Observe provides a fake implementation which records the observed messages.
+func (f *Observer) Observe(m *message.Message) {
+	f.Observed = append(f.Observed, *m)
+}
+
+// ------------------------------------------------------------------------------------
+
+// Auditor fake.
+type Auditor struct {
+	Kinds []string
+}
+
+// Audit provides a fake implementation which records the kinds of the audited events.
+func (f *Auditor) Audit(kind string, contract uint32, actor, detail string) {
+	f.Kinds = append(f.Kinds, kind)
+}
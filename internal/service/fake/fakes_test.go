@@ -75,6 +75,9 @@ func TestNotifier(t *testing.T) {
 	f.NotifySubscribe(nil, ev)
 	f.NotifyUnsubscribe(nil, ev)
 	assert.Len(t, f.Events, 2)
+
+	f.NotifyPublish(nil, 3)
+	assert.Equal(t, []int{3}, f.Published)
 }
 
 func TestConn(t *testing.T) {
@@ -88,6 +91,7 @@ func TestConn(t *testing.T) {
 	assert.NoError(t, f.Close())
 	assert.True(t, f.CanSubscribe(nil, nil))
 	assert.True(t, f.CanUnsubscribe(nil, nil))
+	assert.NotNil(t, f.Subscriptions())
 
 	f.AddLink("a", &security.Channel{})
 	assert.NotNil(t, f.GetLink([]byte("a")))
@@ -115,3 +119,15 @@ func TestSurvey(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(r.Gather(0)))
 }
+
+func TestShedder(t *testing.T) {
+	assert.False(t, new(Shedder).Shed(1))
+	assert.True(t, (&Shedder{Level: 2}).Shed(1))
+	assert.False(t, (&Shedder{Level: 2}).Shed(3))
+}
+
+func TestScheduler(t *testing.T) {
+	var done bool
+	new(Scheduler).Schedule(1, func() { done = true })
+	assert.True(t, done)
+}
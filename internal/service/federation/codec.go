@@ -0,0 +1,187 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package federation
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	nonceSize    = 16               // The size of the handshake challenge.
+	maxFrameSize = 10 * 1024 * 1024 // The maximum size of an encoded frame.
+)
+
+// The roles signing the challenges of the handshake, so that the response of one end of a
+// link can not be reflected back as the response of the other, nor as the session key.
+const (
+	roleDialer   = 'd' // The dialer responding to the challenge of the acceptor.
+	roleAcceptor = 'a' // The acceptor responding to the challenge of the dialer.
+	roleSession  = 's' // The key of the session, which seals its frames.
+)
+
+// Various errors of the federation link.
+var (
+	errUnauthorized  = errors.New("federation: link is not authorized")
+	errFrameTooLarge = errors.New("federation: frame is too large")
+)
+
+// sealer encrypts and authenticates the frames sent over a federation link. The nonce of
+// each frame is its sequence number, which both ends count, so that a frame replayed,
+// reordered or dropped fails to be opened.
+type sealer struct {
+	aead cipher.AEAD
+	seq  uint64 // The sequence number of the next frame.
+}
+
+// newSealer creates a new frame sealer with the key of a session.
+func newSealer(key []byte) (*sealer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealer{aead: aead}, nil
+}
+
+// writeFrame encrypts and writes a length-prefixed frame to the writer.
+func (s *sealer) writeFrame(w io.Writer, frame []byte) error {
+	buffer := make([]byte, 4, 4+len(frame)+s.aead.Overhead())
+	buffer = s.aead.Seal(buffer, s.nonce(), frame, nil)
+	binary.BigEndian.PutUint32(buffer[:4], uint32(len(buffer)-4))
+	_, err := w.Write(buffer)
+	return err
+}
+
+// readFrame reads a length-prefixed frame from the reader and decrypts it.
+func (s *sealer) readFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := int(binary.BigEndian.Uint32(header[:]))
+	if size > maxFrameSize || size < s.aead.Overhead() {
+		return nil, errFrameTooLarge
+	}
+
+	buffer := make([]byte, size)
+	if _, err := io.ReadFull(r, buffer); err != nil {
+		return nil, err
+	}
+
+	return s.aead.Open(buffer[:0], s.nonce(), buffer, nil)
+}
+
+// nonce returns the nonce of the next frame, which is its sequence number.
+func (s *sealer) nonce() []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], s.seq)
+	s.seq++
+	return nonce
+}
+
+// ------------------------------------------------------------------------------------
+
+// challenge authenticates the remote cluster dialing a link, then proves in return that
+// this cluster knows the pre-shared key too. It returns the sealer of the frames of the
+// session, whose key is derived from the challenges of both ends.
+func challenge(rw io.ReadWriter, key []byte) (*sealer, error) {
+	local, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := rw.Write(local); err != nil {
+		return nil, err
+	}
+
+	// The dialer responds along with its own challenge
+	buffer := make([]byte, nonceSize+sha256.Size)
+	if _, err := io.ReadFull(rw, buffer); err != nil {
+		return nil, err
+	}
+
+	remote, response := buffer[:nonceSize], buffer[nonceSize:]
+	if !hmac.Equal(response, sign(key, roleDialer, local, remote)) {
+		return nil, errUnauthorized
+	}
+
+	if _, err := rw.Write(sign(key, roleAcceptor, local, remote)); err != nil {
+		return nil, err
+	}
+
+	return newSealer(sign(key, roleSession, local, remote))
+}
+
+// respond responds to the challenge of the remote cluster accepting a link, then makes sure
+// that the remote cluster knows the pre-shared key too. It returns the sealer of the frames
+// of the session, whose key is derived from the challenges of both ends.
+func respond(rw io.ReadWriter, key []byte) (*sealer, error) {
+	remote := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rw, remote); err != nil {
+		return nil, err
+	}
+
+	local, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := rw.Write(append(local, sign(key, roleDialer, remote, local)...)); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(rw, response); err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal(response, sign(key, roleAcceptor, remote, local)) {
+		return nil, errUnauthorized
+	}
+
+	return newSealer(sign(key, roleSession, remote, local))
+}
+
+// newNonce generates a random challenge.
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// sign computes the signature of the challenges of the acceptor and of the dialer, by the
+// role specified.
+func sign(key []byte, role byte, acceptor, dialer []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte{role})
+	mac.Write(acceptor)
+	mac.Write(dialer)
+	return mac.Sum(nil)
+}
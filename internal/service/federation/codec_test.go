@@ -0,0 +1,141 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package federation
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSealer(t *testing.T) {
+	w, err := newSealer(testKey)
+	assert.NoError(t, err)
+	r, err := newSealer(testKey)
+	assert.NoError(t, err)
+
+	var buffer bytes.Buffer
+	assert.NoError(t, w.writeFrame(&buffer, []byte("hello")))
+	assert.NoError(t, w.writeFrame(&buffer, []byte("world")))
+
+	out, err := r.readFrame(&buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(out))
+
+	out, err = r.readFrame(&buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(out))
+}
+
+func TestSealer_Replay(t *testing.T) {
+	w, _ := newSealer(testKey)
+	var first, second bytes.Buffer
+	assert.NoError(t, w.writeFrame(&first, []byte("hello")))
+	assert.NoError(t, w.writeFrame(&second, []byte("world")))
+	replayed := first.Bytes()
+
+	// A frame replayed is refused
+	r, _ := newSealer(testKey)
+	_, err := r.readFrame(bytes.NewReader(replayed))
+	assert.NoError(t, err)
+	_, err = r.readFrame(bytes.NewReader(replayed))
+	assert.Error(t, err)
+
+	// As well as a frame reordered
+	r, _ = newSealer(testKey)
+	_, err = r.readFrame(&second)
+	assert.Error(t, err)
+}
+
+func TestSealer_WrongKey(t *testing.T) {
+	s1, _ := newSealer(testKey)
+	s2, _ := newSealer([]byte("fedcba9876543210fedcba9876543210"))
+
+	var buffer bytes.Buffer
+	assert.NoError(t, s1.writeFrame(&buffer, []byte("hello")))
+
+	_, err := s2.readFrame(&buffer)
+	assert.Error(t, err)
+}
+
+func TestSealer_TooLarge(t *testing.T) {
+	s, _ := newSealer(testKey)
+	_, err := s.readFrame(bytes.NewBuffer([]byte{0xff, 0xff, 0xff, 0xff}))
+	assert.Equal(t, errFrameTooLarge, err)
+}
+
+func TestSealer_InvalidKey(t *testing.T) {
+	_, err := newSealer([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestChallenge(t *testing.T) {
+	tests := []struct {
+		key     []byte
+		success bool
+	}{
+		{key: testKey, success: true},
+		{key: []byte("invalid"), success: false},
+	}
+
+	for _, tc := range tests {
+		server, client := net.Pipe()
+		responded := make(chan *sealer, 1)
+		go func() {
+			s, _ := respond(client, tc.key)
+			responded <- s
+		}()
+
+		accepted, err := challenge(server, testKey)
+		assert.Equal(t, tc.success, err == nil)
+		server.Close()
+		dialed := <-responded
+		client.Close()
+		if !tc.success {
+			assert.Nil(t, dialed)
+			continue
+		}
+
+		// Both ends derived the same key for the session
+		var buffer bytes.Buffer
+		assert.NoError(t, dialed.writeFrame(&buffer, []byte("hello")))
+		out, err := accepted.readFrame(&buffer)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(out))
+	}
+}
+
+func TestRespond_Unauthorized(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	// The remote cluster does not know the key and can not respond to the challenge
+	go func() {
+		nonce, _ := newNonce()
+		server.Write(nonce)
+		io.ReadFull(server, make([]byte, nonceSize+sha256.Size))
+		server.Write(make([]byte, sha256.Size))
+	}()
+
+	_, err := respond(client, testKey)
+	assert.Equal(t, errUnauthorized, err)
+}
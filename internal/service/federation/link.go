@@ -0,0 +1,178 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package federation
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+)
+
+const (
+	defaultFrameSize = 128              // Default message frame size to use.
+	maxQueueSize     = 100000           // The maximum number of messages queued for a link.
+	dialTimeout      = 5 * time.Second  // The timeout for establishing a link.
+	writeTimeout     = 10 * time.Second // The timeout for writing a frame.
+)
+
+// link represents an outgoing link to a remote cluster. The messages are queued and
+// periodically flushed as a single compressed frame, in order to save the WAN bandwidth.
+type link struct {
+	sync.Mutex
+	sending sync.Mutex         // The lock which serializes the flushes of the link.
+	addr    string             // The address of the remote cluster.
+	key     []byte             // The pre-shared key for the handshake.
+	sealer  *sealer            // The frame sealer of the session, if established.
+	frame   message.Frame      // The current message frame.
+	conn    net.Conn           // The underlying connection, if established.
+	dropped int64              // The number of messages dropped due to the queue limit.
+	cancel  context.CancelFunc // The cancellation function.
+}
+
+// newLink creates a new link to the remote cluster.
+func newLink(addr string, key []byte, interval time.Duration) *link {
+	l := &link{
+		addr:  addr,
+		key:   key,
+		frame: message.NewFrame(defaultFrameSize),
+	}
+
+	l.cancel = async.Repeat(context.Background(), interval, l.flush)
+	return l
+}
+
+// Send queues the message for the remote cluster.
+func (l *link) Send(m *message.Message) {
+	l.Lock()
+	defer l.Unlock()
+
+	// If the remote cluster is unreachable for a long time, drop the oldest messages
+	if len(l.frame) >= maxQueueSize {
+		l.frame = l.frame[1:]
+		l.dropped++
+	}
+
+	l.frame = append(l.frame, *m)
+}
+
+// swap swaps the frame and returns the frame we can encode, or nil if it is empty.
+func (l *link) swap() (swapped message.Frame) {
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.frame) == 0 {
+		return nil
+	}
+
+	swapped = l.frame
+	l.frame = message.NewFrame(defaultFrameSize)
+	return
+}
+
+// requeue puts back the messages which could not be sent, in front of the current frame.
+func (l *link) requeue(frame message.Frame) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.frame = append(frame, l.frame...)
+	if over := len(l.frame) - maxQueueSize; over > 0 {
+		l.frame = l.frame[over:]
+		l.dropped += int64(over)
+	}
+}
+
+// flush sends the queued messages to the remote cluster.
+func (l *link) flush() {
+	l.sending.Lock()
+	defer l.sending.Unlock()
+
+	frame := l.swap()
+	if len(frame) == 0 {
+		return
+	}
+
+	if err := l.connect(); err != nil {
+		logging.LogError("federation", "connecting to "+l.addr, err)
+		l.requeue(frame)
+		return
+	}
+
+	// Split the frame in chunks, since we have a hard limit on the frame size
+	for remaining := frame; len(remaining) > 0; {
+		var chunk message.Frame
+		chunk, remaining = remaining.Split(maxFrameSize / 2)
+		if len(chunk) == 0 {
+			break
+		}
+
+		l.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := l.sealer.writeFrame(l.conn, chunk.Encode()); err != nil {
+			logging.LogError("federation", "sending to "+l.addr, err)
+			l.disconnect()
+			l.requeue(append(chunk, remaining...))
+			return
+		}
+	}
+}
+
+// connect establishes the connection to the remote cluster, if not yet established.
+func (l *link) connect() error {
+	if l.conn != nil {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", l.addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+
+	// Prove that we know the pre-shared key, and that the remote cluster does too
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	sealer, err := respond(conn, l.key)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	conn.SetDeadline(time.Time{})
+	logging.LogTarget("federation", "link established", l.addr)
+	l.conn = conn
+	l.sealer = sealer
+	return nil
+}
+
+// disconnect closes the connection, it will be re-established on the next flush.
+func (l *link) disconnect() {
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+		l.sealer = nil
+	}
+}
+
+// Close closes the link.
+func (l *link) Close() error {
+	l.cancel()
+	l.sending.Lock()
+	defer l.sending.Unlock()
+
+	l.disconnect()
+	return nil
+}
@@ -0,0 +1,40 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package federation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLink_Queue(t *testing.T) {
+	l := newLink("127.0.0.1:1", testKey, time.Hour)
+	defer l.Close()
+
+	for i := 0; i < maxQueueSize+10; i++ {
+		l.Send(message.New(message.Ssid{1, 2}, []byte("a/b/"), []byte("hi")))
+	}
+
+	assert.Equal(t, maxQueueSize, len(l.frame))
+	assert.Equal(t, int64(10), l.dropped)
+
+	// Remote is unreachable, the messages must be kept
+	l.flush()
+	assert.Equal(t, maxQueueSize, len(l.frame))
+	assert.Nil(t, l.conn)
+}
@@ -0,0 +1,188 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package federation
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/security"
+)
+
+const defaultFlushInterval = 50 * time.Millisecond
+
+// Service represents a federation of independent clusters. Instead of joining a single
+// gossip mesh, the clusters exchange the messages of selected channels over a dedicated
+// link which batches and compresses the messages.
+type Service struct {
+	key      []byte                // The pre-shared federation key.
+	listen   string                // The address to listen on for the incoming links.
+	listener net.Listener          // The listener for the incoming links.
+	patterns []security.Pattern    // The channel patterns replicated, both ways.
+	headers  message.HeaderMapping // The headers to replicate, all if nil.
+	links    []*link               // The outgoing links to the remote clusters.
+
+	OnMessage func(*message.Message) // Delegate to invoke when a new message is received.
+}
+
+// New creates a new federation service.
+func New(cfg *config.FederationConfig, key []byte) (*Service, error) {
+	if _, err := newSealer(key); err != nil {
+		return nil, err
+	}
+
+	interval := defaultFlushInterval
+	if cfg.FlushInterval > 0 {
+		interval = time.Duration(cfg.FlushInterval) * time.Millisecond
+	}
+
+	s := &Service{
+		key:      key,
+		listen:   cfg.ListenAddr,
+		patterns: security.ParsePatterns(cfg.Channels),
+		headers:  message.ParseHeaderMapping(cfg.Headers),
+	}
+
+	for _, addr := range split(cfg.Remotes) {
+		s.links = append(s.links, newLink(addr, key, interval))
+	}
+	return s, nil
+}
+
+// Listen starts accepting the links from the remote clusters, if configured.
+func (s *Service) Listen(ctx context.Context) (err error) {
+	if s.listen == "" {
+		return nil
+	}
+
+	if s.listener, err = net.Listen("tcp", s.listen); err != nil {
+		return err
+	}
+
+	logging.LogTarget("federation", "starting the listener", s.listener.Addr())
+	go func() {
+		<-ctx.Done()
+		s.listener.Close()
+	}()
+
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+	return nil
+}
+
+// serve processes an incoming link from a remote cluster.
+func (s *Service) serve(conn net.Conn) {
+	defer conn.Close()
+
+	// Make sure the remote cluster knows the pre-shared key, and prove that we do too
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	sealer, err := challenge(conn, s.key)
+	if err != nil {
+		logging.LogError("federation", "authorizing "+conn.RemoteAddr().String(), err)
+		return
+	}
+
+	conn.SetDeadline(time.Time{})
+	logging.LogTarget("federation", "link accepted", conn.RemoteAddr())
+	for {
+		buffer, err := sealer.readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		frame, err := message.DecodeFrame(buffer)
+		if err != nil {
+			logging.LogError("federation", "decode frame", err)
+			return
+		}
+
+		// Only accept the channels replicated by this cluster, whatever the remote sends
+		for i := range frame {
+			if s.matches(string(frame[i].Channel)) {
+				s.OnMessage(&frame[i])
+			}
+		}
+	}
+}
+
+// Forward replicates the message to the remote clusters, if its channel matches one of
+// the configured patterns. This must only be called on the node where the message was
+// originally published, so the messages never loop between the clusters.
+func (s *Service) Forward(m *message.Message) {
+	if len(s.links) == 0 || !s.matches(string(m.Channel)) {
+		return
+	}
+
+	// Only carry the configured headers across, the rest of the message is kept as is so
+	// its time-to-live runs from the time it was originally published.
+	if s.headers != nil {
+		mapped := *m
+		mapped.Headers = s.headers.Apply(m.Headers)
+		m = &mapped
+	}
+
+	for _, link := range s.links {
+		link.Send(m)
+	}
+}
+
+// matches checks whether a channel matches any of the patterns. A '+' in the pattern
+// matches any single segment and a pattern also matches all of the channels it prefixes.
+func (s *Service) matches(channel string) bool {
+	return security.MatchAny(s.patterns, security.SplitChannel(channel))
+}
+
+// Addr returns the address of the listener for the incoming links.
+func (s *Service) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Close closes the service.
+func (s *Service) Close() error {
+	for _, link := range s.links {
+		link.Close()
+	}
+
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// split splits a comma-separated list and trims each of the values.
+func split(list string) (out []string) {
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return
+}
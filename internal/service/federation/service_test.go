@@ -0,0 +1,184 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package federation
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFederation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The remote cluster, accepting the links
+	var mu sync.Mutex
+	var received []string
+	remote, err := New(&config.FederationConfig{
+		ListenAddr: "127.0.0.1:0",
+		Channels:   "a/+/c/, x/",
+	}, testKey)
+	assert.NoError(t, err)
+	remote.OnMessage = func(m *message.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, string(m.Channel))
+	}
+
+	assert.NoError(t, remote.Listen(ctx))
+	defer remote.Close()
+
+	// The local cluster, replicating more channels than the remote one accepts
+	local, err := New(&config.FederationConfig{
+		Remotes:       remote.Addr().String(),
+		Channels:      "a/, x/",
+		FlushInterval: 5,
+	}, testKey)
+	assert.NoError(t, err)
+	defer local.Close()
+
+	for _, channel := range []string{"a/b/c/", "a/b/d/", "x/y/", "y/"} {
+		local.Forward(message.New(message.Ssid{1, 2}, []byte(channel), []byte("hi")))
+	}
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"a/b/c/", "x/y/"}, received)
+}
+
+func TestFederation_Unauthorized(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remote, err := New(&config.FederationConfig{ListenAddr: "127.0.0.1:0"}, testKey)
+	assert.NoError(t, err)
+	remote.OnMessage = func(m *message.Message) {
+		t.Fail()
+	}
+
+	assert.NoError(t, remote.Listen(ctx))
+	defer remote.Close()
+
+	local, err := New(&config.FederationConfig{
+		Remotes:  remote.Addr().String(),
+		Channels: "a/",
+	}, []byte("fedcba9876543210fedcba9876543210"))
+	assert.NoError(t, err)
+	defer local.Close()
+
+	local.Forward(message.New(message.Ssid{1, 2}, []byte("a/b/"), []byte("hi")))
+	local.links[0].flush()
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestServe_Replay(t *testing.T) {
+	s, err := New(&config.FederationConfig{Channels: "a/"}, testKey)
+	assert.NoError(t, err)
+
+	var received []string
+	s.OnMessage = func(m *message.Message) {
+		received = append(received, string(m.Channel))
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go s.serve(server)
+
+	sealer, err := respond(client, testKey)
+	assert.NoError(t, err)
+
+	frame := message.Frame{
+		*message.New(message.Ssid{1, 2}, []byte("a/b/"), []byte("hi")),
+		*message.New(message.Ssid{1, 2}, []byte("b/"), []byte("hi")),
+	}
+
+	// The frame is sent twice, the replayed one closing the link
+	var buffer bytes.Buffer
+	assert.NoError(t, sealer.writeFrame(&buffer, frame.Encode()))
+	_, err = client.Write(buffer.Bytes())
+	assert.NoError(t, err)
+	_, err = client.Write(buffer.Bytes())
+	assert.NoError(t, err)
+
+	_, err = client.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.Equal(t, []string{"a/b/"}, received)
+}
+
+func TestForward_Headers(t *testing.T) {
+	s, err := New(&config.FederationConfig{
+		Remotes:       "127.0.0.1:1",
+		Channels:      "a/",
+		FlushInterval: 60000,
+		Headers:       "trace,zone=region",
+	}, testKey)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	m := message.New(message.Ssid{1, 2}, []byte("a/b/"), []byte("hi"))
+	m.TTL = 30
+	m.Headers = message.Headers{"trace": "abc", "zone": "eu", "user": "bob"}
+	s.Forward(m)
+
+	frame := s.links[0].swap()
+	assert.Len(t, frame, 1)
+	assert.Equal(t, m.ID, frame[0].ID)
+	assert.Equal(t, uint32(30), frame[0].TTL)
+	assert.Equal(t, message.Headers{"trace": "abc", "region": "eu"}, frame[0].Headers)
+	assert.Len(t, m.Headers, 3)
+}
+
+func TestMatches(t *testing.T) {
+	s, err := New(&config.FederationConfig{Channels: "a/+/c/,b/,d%2fe/"}, testKey)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		channel string
+		match   bool
+	}{
+		{channel: "a/b/c/", match: true},
+		{channel: "a/x/c/d/", match: true},
+		{channel: "a/b/", match: false},
+		{channel: "a/b/d/", match: false},
+		{channel: "b/", match: true},
+		{channel: "b/c/", match: true},
+		{channel: "c/", match: false},
+		{channel: "d%2Fe/", match: true},
+		{channel: "d/e/", match: false},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.match, s.matches(tc.channel), tc.channel)
+	}
+}
+
+func TestListen_NotConfigured(t *testing.T) {
+	s, err := New(&config.FederationConfig{}, testKey)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Listen(context.Background()))
+	assert.Nil(t, s.Addr())
+	assert.NoError(t, s.Close())
+}
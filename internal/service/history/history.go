@@ -0,0 +1,170 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package history
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+const (
+	defaultLimit = 100  // The number of messages returned by default.
+	maxLimit     = 1000 // The maximum number of messages returned at once.
+	maxAttempts  = 4    // The maximum number of queries issued to fill a page.
+)
+
+// Service represents a message history service, which reads the stored messages of a
+// channel within a time window, one page at a time.
+type Service struct {
+	auth  service.Authorizer // The authorizer to use.
+	store storage.Storage    // The storage provider to use.
+}
+
+// New creates a new message history service.
+func New(auth service.Authorizer, store storage.Storage) *Service {
+	return &Service{
+		auth:  auth,
+		store: store,
+	}
+}
+
+// OnRequest handles a request to read the message history. The pages are returned from
+// the newest to the oldest, each one along with the cursor of the next page.
+func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, bool) {
+	var request Request
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return errors.ErrBadRequest, false
+	}
+
+	// Ensure we have trailing slash
+	if !strings.HasSuffix(request.Channel, "/") {
+		request.Channel = request.Channel + "/"
+	}
+
+	target := security.MakeChannel(request.Key, request.Channel)
+	if target.ChannelType == security.ChannelInvalid {
+		return errors.ErrTargetInvalid, false
+	}
+
+	// Reading the history requires the load permission
+	_, key, allowed := s.auth.Authorize(target, security.AllowLoad)
+	if !allowed || key.HasPermission(security.AllowExtend) {
+		return errors.ErrUnauthorized, false
+	}
+
+	var cursor message.ID
+	if request.Cursor != "" {
+		b, err := hex.DecodeString(request.Cursor)
+		if err != nil || len(b) < 16 {
+			return errors.ErrBadRequest, false
+		}
+		cursor = message.ID(b)
+	}
+
+	if request.Limit <= 0 {
+		request.Limit = defaultLimit
+	}
+	if request.Limit > maxLimit {
+		request.Limit = maxLimit
+	}
+
+	ssid := message.NewSsid(key.Contract(), target.Query)
+	msgs, more, err := s.page(ssid, toTime(request.From), toTime(request.Until), cursor, request.Limit)
+	if err != nil {
+		logging.LogError("history", "query messages", err)
+		return errors.ErrServerError, false
+	}
+
+	resp := &Response{
+		Status:   200,
+		Messages: make([]Message, 0, len(msgs)),
+	}
+
+	for _, m := range msgs {
+		resp.Messages = append(resp.Messages, Message{
+			ID:      hex.EncodeToString(m.ID),
+			Channel: string(m.Channel),
+			Time:    m.Time(),
+			Payload: m.Payload,
+			Headers: m.Headers,
+		})
+	}
+
+	if more && len(msgs) > 0 {
+		resp.Cursor = hex.EncodeToString(msgs[0].ID)
+	}
+	return resp, true
+}
+
+// page queries the newest messages published before the cursor within the time window,
+// and returns whether there are older ones left. Since the messages published within
+// the same second as the cursor might have already been returned, more of them are
+// queried until the page is complete.
+func (s *Service) page(ssid message.Ssid, from, until time.Time, cursor message.ID, limit int) (message.Frame, bool, error) {
+	if cursor != nil {
+		if t := time.Unix(cursor.Time(), 0); until.Unix() == 0 || t.Before(until) {
+			until = t
+		}
+	}
+
+	var frame message.Frame
+	for skip, i := 0, 0; i < maxAttempts; i++ {
+		n := limit + 1 + skip // One more to know whether there's a next page
+		found, err := s.store.Query(ssid, from, until, n)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// The frame is sorted, so cut the messages which are not before the cursor
+		found.Sort()
+		frame = found
+		if cursor != nil {
+			frame = found[:sort.Search(len(found), func(i int) bool {
+				return !found[i].ID.Before(cursor)
+			})]
+		}
+
+		// Stop if there are no more messages in the window or if we have a full page
+		if len(found) < n || len(frame) > limit {
+			break
+		}
+
+		skip = len(found) - len(frame)
+	}
+
+	more := len(frame) > limit
+	if more {
+		frame = frame[len(frame)-limit:]
+	}
+	return frame, more, nil
+}
+
+// toTime converts the unix time of the request to a time.
+func toTime(t int64) time.Time {
+	if t <= 0 {
+		return time.Unix(0, 0)
+	}
+	return time.Unix(t, 0)
+}
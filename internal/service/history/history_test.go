@@ -0,0 +1,157 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package history
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService(success bool, perm uint8) (*Service, storage.Storage) {
+	store := storage.NewInMemory(nil)
+	store.Configure(nil)
+	return New(&fake.Authorizer{
+		Contract:  1,
+		Success:   success,
+		ExtraPerm: perm,
+	}, store), store
+}
+
+// storeAt stores a message on the channel at a specific time.
+func storeAt(store storage.Storage, channel string, t int64, payload string) {
+	ssid := message.NewSsid(1, security.ParseChannel([]byte("key/"+channel)).Query)
+	m := message.New(ssid, []byte(channel), []byte(payload))
+	m.ID.SetTime(t)
+	m.TTL = 3600
+	store.Store(m)
+}
+
+func TestOnRequest_Invalid(t *testing.T) {
+	tests := []struct {
+		payload string
+		success bool
+		perm    uint8
+		err     *errors.Error
+	}{
+		{payload: "{", success: true, err: errors.ErrBadRequest},
+		{payload: `{"key":"key","channel":"a/b/","cursor":"zz"}`, success: true, err: errors.ErrBadRequest},
+		{payload: `{"key":"key","channel":"a/b/","cursor":"0102"}`, success: true, err: errors.ErrBadRequest},
+		{payload: `{"key":"","channel":"a/b/"}`, success: true, err: errors.ErrTargetInvalid},
+		{payload: `{"key":"key","channel":"a/b/"}`, success: false, err: errors.ErrUnauthorized},
+		{payload: `{"key":"key","channel":"a/b/"}`, success: true, perm: security.AllowExtend, err: errors.ErrUnauthorized},
+	}
+
+	for _, tc := range tests {
+		s, store := newTestService(tc.success, tc.perm)
+		resp, ok := s.OnRequest(new(fake.Conn), []byte(tc.payload))
+		assert.False(t, ok, tc.payload)
+		assert.Equal(t, tc.err, resp, tc.payload)
+		store.Close()
+	}
+}
+
+func TestOnRequest_Pages(t *testing.T) {
+	s, store := newTestService(true, 0)
+	defer store.Close()
+
+	// Store a few messages, most of them within the same second
+	now := time.Now().Unix()
+	for i := 0; i < 25; i++ {
+		storeAt(store, "a/b/", now-100+int64(i/10), fmt.Sprintf("%d", i))
+	}
+	storeAt(store, "a/c/", now-100, "other")
+
+	var cursor string
+	var pages int
+	var payloads []string
+	for {
+		resp, ok := s.OnRequest(new(fake.Conn), []byte(fmt.Sprintf(
+			`{"key":"key","channel":"a/b","limit":4,"cursor":"%s"}`, cursor,
+		)))
+		assert.True(t, ok)
+
+		r := resp.(*Response)
+		assert.Equal(t, 200, r.Status)
+		assert.True(t, len(r.Messages) <= 4)
+
+		// Prepend the page, since they go from the newest to the oldest
+		page := make([]string, 0, len(r.Messages))
+		for _, m := range r.Messages {
+			assert.Equal(t, "a/b/", m.Channel)
+			page = append(page, string(m.Payload))
+		}
+
+		pages++
+		payloads = append(page, payloads...)
+		if cursor = r.Cursor; cursor == "" || pages > 10 {
+			break
+		}
+	}
+
+	expect := make([]string, 0, 25)
+	for i := 0; i < 25; i++ {
+		expect = append(expect, fmt.Sprintf("%d", i))
+	}
+
+	assert.Equal(t, 7, pages)
+	assert.Equal(t, expect, payloads)
+}
+
+func TestOnRequest_Window(t *testing.T) {
+	s, store := newTestService(true, 0)
+	defer store.Close()
+
+	now := time.Now().Unix()
+	for i := 0; i < 10; i++ {
+		storeAt(store, "a/b/", now-100+int64(i), fmt.Sprintf("%d", i))
+	}
+
+	tests := []struct {
+		from, until int64
+		limit       int
+		expect      []string
+		more        bool
+	}{
+		{from: now - 98, until: now - 96, expect: []string{"2", "3", "4"}},
+		{from: now - 98, until: now - 96, limit: 2, expect: []string{"3", "4"}, more: true},
+		{from: now - 92, expect: []string{"8", "9"}},
+		{until: now - 99, expect: []string{"0", "1"}},
+		{from: now - 10, expect: []string{}},
+	}
+
+	for _, tc := range tests {
+		resp, ok := s.OnRequest(new(fake.Conn), []byte(fmt.Sprintf(
+			`{"key":"key","channel":"a/b/","from":%d,"until":%d,"limit":%d}`, tc.from, tc.until, tc.limit,
+		)))
+		assert.True(t, ok)
+
+		r := resp.(*Response)
+		payloads := make([]string, 0, len(r.Messages))
+		for _, m := range r.Messages {
+			payloads = append(payloads, string(m.Payload))
+		}
+
+		assert.Equal(t, tc.expect, payloads)
+		assert.Equal(t, tc.more, r.Cursor != "")
+	}
+}
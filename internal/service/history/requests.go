@@ -0,0 +1,50 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+package history
+
+import "github.com/emitter-io/emitter/internal/message"
+
+// Request represents a request to read the message history of a channel.
+type Request struct {
+	Key     string `json:"key"`              // The channel key for this request.
+	Channel string `json:"channel"`          // The channel to read, which can contain wildcards.
+	From    int64  `json:"from,omitempty"`   // The beginning of the time window, in unix seconds.
+	Until   int64  `json:"until,omitempty"`  // The end of the time window, in unix seconds.
+	Limit   int    `json:"limit,omitempty"`  // The maximum number of messages to return.
+	Cursor  string `json:"cursor,omitempty"` // The cursor returned with the previous page, if any.
+}
+
+// ------------------------------------------------------------------------------------
+
+// Response represents a response to the history request.
+type Response struct {
+	Request  uint16    `json:"req,omitempty"`    // The corresponding request ID.
+	Status   int       `json:"status"`           // The status of the response.
+	Messages []Message `json:"messages"`         // The messages, from the oldest to the newest.
+	Cursor   string    `json:"cursor,omitempty"` // The cursor of the next (older) page, if any.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *Response) ForRequest(id uint16) {
+	r.Request = id
+}
+
+// Message represents a message of the history.
+type Message struct {
+	ID      string          `json:"id"`                // The hex-encoded message ID.
+	Channel string          `json:"channel"`           // The channel of the message.
+	Time    int64           `json:"time"`              // The unix time of the message.
+	Payload []byte          `json:"payload"`           // The payload of the message, base64-encoded.
+	Headers message.Headers `json:"headers,omitempty"` // The headers of the message.
+}
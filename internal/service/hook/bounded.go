@@ -0,0 +1,260 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package hook
+
+import (
+	"fmt"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/pm"
+)
+
+// maxString is the size of the largest string the library functions of the sandbox may
+// build, which is far above the size of a message. The interpreter has no allocation limit,
+// so the functions whose result can be much larger than their arguments (e.g: string.rep)
+// are checked before they allocate, while the concatenations are bounded by the timeout.
+const maxString = 1 << 20
+
+// bind bounds the library functions of the sandbox which could exhaust the memory of the
+// broker in a single call.
+func bind(state *lua.LState) {
+	guard(state, lua.StringLibName, "rep", checkRep)
+	guard(state, lua.StringLibName, "format", checkFormat)
+	guard(state, lua.TabLibName, "concat", checkConcat)
+	state.GetGlobal(lua.StringLibName).(*lua.LTable).RawSetString("gsub", state.NewFunction(strGsub))
+}
+
+// guard replaces a function of a library with one checking its arguments beforehand. The
+// methods of the strings share the table of the library, and hence are replaced as well.
+func guard(state *lua.LState, lib, name string, check func(*lua.LState)) {
+	table := state.GetGlobal(lib).(*lua.LTable)
+	original := table.RawGetString(name).(*lua.LFunction).GFunction
+	table.RawSetString(name, state.NewFunction(func(state *lua.LState) int {
+		check(state)
+		return original(state)
+	}))
+}
+
+// tooLarge raises the error of a string which would be larger than allowed.
+func tooLarge(state *lua.LState) {
+	state.RaiseError("the string would be larger than %d bytes", maxString)
+}
+
+// checkRep checks the size of the string repeated by string.rep(s, n).
+func checkRep(state *lua.LState) {
+	s, n := state.CheckString(1), state.CheckInt(2)
+	if len(s) > 0 && n > maxString/len(s) {
+		tooLarge(state)
+	}
+}
+
+// checkFormat checks the size of the string formatted by string.format(format, ...), whose
+// width and precision have at most two digits, as in the reference implementation.
+func checkFormat(state *lua.LState) {
+	format := state.CheckString(1)
+	size := len(format)
+	for i := 2; i <= state.GetTop(); i++ {
+		size += len(state.Get(i).String())
+	}
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+
+		if i++; i < len(format) && format[i] == '%' {
+			continue
+		}
+
+		// Skip the flags, then check the width and the precision
+		for i < len(format) && strings.IndexByte("-+ #0", format[i]) >= 0 {
+			i++
+		}
+
+		if i = skipDigits(state, format, i, "width"); i < len(format) && format[i] == '.' {
+			i = skipDigits(state, format, i+1, "precision")
+		}
+		size += 99
+	}
+
+	if size > maxString {
+		tooLarge(state)
+	}
+}
+
+// skipDigits skips the digits of the width or of the precision of a format.
+func skipDigits(state *lua.LState, format string, i int, part string) int {
+	start := i
+	for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+		i++
+	}
+
+	if i-start > 2 {
+		state.RaiseError("invalid format (%s too long)", part)
+	}
+	return i
+}
+
+// checkConcat checks the size of the string built by table.concat(t, sep, i, j).
+func checkConcat(state *lua.LState) {
+	table := state.CheckTable(1)
+	sep := state.OptString(2, "")
+	from, until := state.OptInt(3, 1), state.OptInt(4, table.Len())
+
+	size := 0
+	for i := from; i <= until; i++ {
+		item := table.RawGetInt(i)
+		if !lua.LVCanConvToString(item) {
+			return // The concatenation fails on its own
+		}
+
+		if size += len(lua.LVAsString(item)) + len(sep); size > maxString {
+			tooLarge(state)
+		}
+	}
+}
+
+// ------------------------------------------------------------------------------------
+
+// strGsub replaces the matches of a pattern in a string, as string.gsub(s, pattern, repl, n)
+// does, while refusing to build a string larger than allowed.
+func strGsub(state *lua.LState) int {
+	str := state.CheckString(1)
+	pattern := state.CheckString(2)
+	state.CheckTypes(3, lua.LTString, lua.LTTable, lua.LTFunction)
+	repl := state.CheckAny(3)
+	limit := state.OptInt(4, -1)
+
+	matches, err := pm.Find(pattern, []byte(str), 0, limit)
+	if err != nil {
+		state.RaiseError("%s", err.Error())
+	}
+
+	if len(matches) == 0 {
+		state.SetTop(1)
+		state.Push(lua.LNumber(0))
+		return 2
+	}
+
+	out := &builder{state: state}
+	last := 0
+	for _, m := range matches {
+		start, end := m.Capture(0), m.Capture(1)
+		out.write(str[last:start])
+		switch r := repl.(type) {
+		case lua.LString:
+			out.expand(str, string(r), m)
+		case *lua.LTable:
+			out.replace(str, m, state.GetTable(r, capturesOf(str, m)[0]))
+		case *lua.LFunction:
+			args := capturesOf(str, m)
+			state.Push(r)
+			for _, arg := range args {
+				state.Push(arg)
+			}
+
+			state.Call(len(args), 1)
+			out.replace(str, m, state.Get(-1))
+			state.Pop(1)
+		}
+		last = end
+	}
+
+	out.write(str[last:])
+	state.Push(lua.LString(out.String()))
+	state.Push(lua.LNumber(len(matches)))
+	return 2
+}
+
+// capturesOf returns the captures of a match, or the whole match if the pattern has none,
+// where a position capture is a number.
+func capturesOf(str string, m *pm.MatchData) []lua.LValue {
+	if m.CaptureLength() <= 2 {
+		return []lua.LValue{lua.LString(str[m.Capture(0):m.Capture(1)])}
+	}
+
+	captures := make([]lua.LValue, 0, m.CaptureLength()/2-1)
+	for i := 2; i < m.CaptureLength(); i += 2 {
+		if m.IsPosCapture(i) {
+			captures = append(captures, lua.LNumber(m.Capture(i)))
+		} else {
+			captures = append(captures, lua.LString(str[m.Capture(i):m.Capture(i+1)]))
+		}
+	}
+	return captures
+}
+
+// captureOf returns the capture of a match referred to by a replacement string, where a
+// position capture is its position.
+func captureOf(state *lua.LState, str string, m *pm.MatchData, i int) string {
+	if i > 2 && i >= m.CaptureLength() {
+		state.RaiseError("invalid capture index")
+	}
+
+	if i == 2 && i >= m.CaptureLength() {
+		i = 0
+	}
+
+	if m.IsPosCapture(i) {
+		return fmt.Sprint(m.Capture(i))
+	}
+	return str[m.Capture(i):m.Capture(i+1)]
+}
+
+// builder builds a string which can not grow larger than allowed.
+type builder struct {
+	strings.Builder
+	state *lua.LState
+}
+
+// write appends a string.
+func (b *builder) write(s string) {
+	if b.Len()+len(s) > maxString {
+		tooLarge(b.state)
+	}
+	b.WriteString(s)
+}
+
+// replace appends the replacement of a match, or the match itself if it is false or nil.
+func (b *builder) replace(str string, m *pm.MatchData, value lua.LValue) {
+	if lua.LVIsFalse(value) {
+		b.write(str[m.Capture(0):m.Capture(1)])
+		return
+	}
+	b.write(lua.LVAsString(value))
+}
+
+// expand appends the replacement string of a match, where '%d' is its d-th capture, '%0'
+// the whole match and '%%' a single '%'.
+func (b *builder) expand(str, repl string, m *pm.MatchData) {
+	for i := 0; i < len(repl); i++ {
+		c := repl[i]
+		if c != '%' || i == len(repl)-1 {
+			b.write(repl[i : i+1])
+			continue
+		}
+
+		i++
+		switch c = repl[i]; {
+		case c == '%':
+			b.write("%")
+		case c >= '0' && c <= '9':
+			b.write(captureOf(b.state, str, m, 2*int(c-'0')))
+		default:
+			b.write(repl[i-1 : i+1])
+		}
+	}
+}
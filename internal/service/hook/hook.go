@@ -0,0 +1,228 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package hook
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	defaultTimeout = 50           // The default number of milliseconds a script may run for each message.
+	entryPoint     = "on_publish" // The function of the script called for each message.
+)
+
+var (
+	errUnsupported  = fmt.Errorf("hook: only the Lua scripts (.lua) are supported")
+	errNoChannels   = fmt.Errorf("hook: the channels the script runs on must be specified")
+	errNoEntryPoint = fmt.Errorf("hook: the script must define an '%s(msg)' function", entryPoint)
+)
+
+// Service implements the Transformer contract.
+var _ service.Transformer = new(Service)
+
+// Service represents the hooks which run a sandboxed script on the messages published on
+// some channels, in the order they were configured.
+type Service struct {
+	hooks []*hook // The hooks configured.
+}
+
+// New creates a new hook service, compiling the scripts configured. The scripts keep their
+// state in the key-value store of the contracts, if specified.
+func New(configs []config.HookConfig, store service.KeyValue) (*Service, error) {
+	s := new(Service)
+	for _, cfg := range configs {
+		h, err := newHook(cfg, store)
+		if err != nil {
+			return nil, err
+		}
+
+		s.hooks = append(s.hooks, h)
+	}
+	return s, nil
+}
+
+// Len returns the number of hooks configured.
+func (s *Service) Len() int {
+	return len(s.hooks)
+}
+
+// Transform runs the hooks matching the contract and the channel of the message, which may
+// alter its payload, its time-to-live and its headers, or refuse it.
+func (s *Service) Transform(m *message.Message) *errors.Error {
+	var segments []string
+	for _, h := range s.hooks {
+		if h.contract != 0 && h.contract != m.Contract() {
+			continue
+		}
+
+		if segments == nil {
+			segments = security.SplitChannel(string(m.Channel))
+		}
+
+		if !h.matches(segments) {
+			continue
+		}
+
+		if err := h.run(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ------------------------------------------------------------------------------------
+
+// hook represents a script run on the messages published on some channels.
+type hook struct {
+	name     string             // The name of the script, for the logs.
+	contract uint32             // The contract the script is restricted to, if any.
+	patterns []security.Pattern // The channel patterns the script runs on.
+	timeout  time.Duration      // The time the script may run for each message.
+	failOpen bool               // Whether the messages are published when the script fails.
+	store    service.KeyValue   // The key-value store the script keeps its state in, if any.
+	proto    *lua.FunctionProto // The compiled script.
+	states   sync.Pool          // The interpreters, each with the script loaded.
+}
+
+// newHook creates a new hook and checks that its script can be loaded.
+func newHook(cfg config.HookConfig, store service.KeyValue) (*hook, error) {
+	if !strings.EqualFold(filepath.Ext(cfg.Script), ".lua") {
+		return nil, errUnsupported
+	}
+
+	proto, err := compile(cfg.Script)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	h := &hook{
+		name:     filepath.Base(cfg.Script),
+		contract: cfg.Contract,
+		timeout:  time.Duration(timeout) * time.Millisecond,
+		failOpen: cfg.FailOpen,
+		store:    store,
+		proto:    proto,
+	}
+
+	h.patterns = security.ParsePatterns(cfg.Channels)
+
+	if len(h.patterns) == 0 {
+		return nil, errNoChannels
+	}
+
+	// Load the script once, so that the errors are reported right away
+	state, err := h.load()
+	if err != nil {
+		return nil, err
+	}
+
+	h.states.Put(state)
+	return h, nil
+}
+
+// matches checks whether the script runs on the channel.
+func (h *hook) matches(channel []string) bool {
+	return security.MatchAny(h.patterns, channel)
+}
+
+// load creates a new sandboxed interpreter and runs the script in it, which defines the
+// function called for each message.
+func (h *hook) load() (*lua.LState, error) {
+	state := newState(h.store)
+	state.Push(state.NewFunctionFromProto(h.proto))
+	if err := state.PCall(0, 0, nil); err != nil {
+		state.Close()
+		return nil, fmt.Errorf("hook: unable to load %s, %v", h.name, err)
+	}
+
+	if _, ok := state.GetGlobal(entryPoint).(*lua.LFunction); !ok {
+		state.Close()
+		return nil, errNoEntryPoint
+	}
+	return state, nil
+}
+
+// run runs the script on the message and applies its verdict.
+func (h *hook) run(m *message.Message) *errors.Error {
+	state, _ := h.states.Get().(*lua.LState)
+	if state == nil {
+		var err error
+		if state, err = h.load(); err != nil {
+			return h.onFailure(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	state.SetContext(context.WithValue(ctx, contractKey{}, m.Contract()))
+
+	// Call the script with the message, which returns false to refuse it, optionally with
+	// the reason, or alters the fields of the message it was given
+	msg := toTable(state, m)
+	if err := state.CallByParam(lua.P{
+		Fn:      state.GetGlobal(entryPoint),
+		NRet:    2,
+		Protect: true,
+	}, msg); err != nil {
+		state.Close() // The interpreter may have been interrupted anywhere
+		return h.onFailure(err)
+	}
+
+	verdict, reason := state.Get(-2), state.Get(-1)
+	state.Pop(2)
+	state.RemoveContext()
+	h.states.Put(state)
+
+	if verdict == lua.LFalse {
+		err := errors.ErrRejected.Copy()
+		if reason, ok := reason.(lua.LString); ok && reason != "" {
+			err.Message = string(reason)
+		}
+		return err
+	}
+
+	if err := fromTable(msg, m); err != nil {
+		return h.onFailure(err)
+	}
+	return nil
+}
+
+// onFailure occurs when the script has failed, in which case the message is either published
+// unchanged or refused.
+func (h *hook) onFailure(err error) *errors.Error {
+	logging.LogError("hook", "running "+h.name, err)
+	if h.failOpen {
+		return nil
+	}
+	return errors.ErrServerError
+}
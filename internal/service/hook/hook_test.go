@@ -0,0 +1,229 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package hook
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/service/kv"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestHooks creates the hooks running the script on the channels.
+func newTestHooks(t *testing.T, script string, cfg config.HookConfig) (*Service, error) {
+	cfg.Script = filepath.Join(t.TempDir(), "hook.lua")
+	if cfg.Channels == "" {
+		cfg.Channels = "sensors/"
+	}
+
+	store := storage.NewInMemory(nil)
+	store.Configure(nil)
+	t.Cleanup(func() { store.Close() })
+
+	assert.NoError(t, ioutil.WriteFile(cfg.Script, []byte(script), 0644))
+	return New([]config.HookConfig{cfg}, kv.New(store))
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		script string
+		cfg    config.HookConfig
+		err    bool
+	}{
+		{script: "function on_publish(msg) end"},
+		{script: "function on_publish(msg) end", cfg: config.HookConfig{Channels: " , "}, err: true},
+		{script: "function on_publish(msg)", err: true},
+		{script: "function transform(msg) end", err: true},
+		{script: "error('boom')", err: true},
+		{script: "local f = io.open('/etc/passwd')", err: true},
+	}
+
+	for _, tc := range tests {
+		s, err := newTestHooks(t, tc.script, tc.cfg)
+		assert.Equal(t, tc.err, err != nil, tc.script)
+		if err == nil {
+			assert.Equal(t, 1, s.Len())
+		}
+	}
+
+	_, err := New([]config.HookConfig{{Script: "hook.wasm", Channels: "a/"}}, nil)
+	assert.Equal(t, errUnsupported, err)
+}
+
+func TestTransform(t *testing.T) {
+	s, err := newTestHooks(t, `
+		function on_publish(msg)
+			local data, err = json.decode(msg.payload)
+			if data == nil then
+				return false
+			end
+			if data.temp == nil then
+				return false, "the temperature is missing"
+			end
+
+			data.unit = "celsius"
+			msg.payload = json.encode(data)
+			msg.headers.zone = "eu"
+			msg.ttl = 60
+		end`, config.HookConfig{Channels: "sensors/+/"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		channel string
+		payload string
+		expect  string
+		err     string
+	}{
+		{channel: "sensors/1/", payload: `{"temp":21}`, expect: `{"temp":21,"unit":"celsius"}`},
+		{channel: "sensors/1/", payload: `{"hum":40}`, err: "the temperature is missing"},
+		{channel: "sensors/1/", payload: `oops`, err: errors.ErrRejected.Message},
+		{channel: "other/1/", payload: `oops`, expect: `oops`},
+	}
+
+	for _, tc := range tests {
+		msg := message.New(message.Ssid{1, 2}, []byte(tc.channel), []byte(tc.payload))
+		err := s.Transform(msg)
+		if tc.err != "" {
+			assert.Equal(t, tc.err, err.Message)
+			assert.Equal(t, 422, err.Status)
+			continue
+		}
+
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expect, string(msg.Payload))
+		if tc.expect != tc.payload {
+			assert.Equal(t, message.Headers{"zone": "eu"}, msg.Headers)
+			assert.Equal(t, uint32(60), msg.TTL)
+		}
+	}
+}
+
+func TestTransform_Contract(t *testing.T) {
+	s, err := newTestHooks(t, `function on_publish(msg) msg.payload = "c" .. msg.contract end`, config.HookConfig{Contract: 2})
+	assert.NoError(t, err)
+
+	for _, contract := range []uint32{1, 2} {
+		msg := message.New(message.Ssid{contract, 2}, []byte("sensors/"), []byte("hello"))
+		assert.Nil(t, s.Transform(msg))
+		assert.Equal(t, map[uint32]string{1: "hello", 2: "c2"}[contract], string(msg.Payload))
+	}
+}
+
+func TestTransform_KeyValue(t *testing.T) {
+	s, err := newTestHooks(t, `
+		function on_publish(msg)
+			local count = tonumber(kv.get("count") or "0") + 1
+			kv.set("count", tostring(count), 60)
+			if count > 2 then
+				kv.delete("count")
+			end
+			msg.payload = tostring(count)
+		end`, config.HookConfig{})
+	assert.NoError(t, err)
+
+	// The state is kept per contract
+	for _, tc := range []struct {
+		contract uint32
+		expect   string
+	}{
+		{contract: 1, expect: "1"},
+		{contract: 1, expect: "2"},
+		{contract: 2, expect: "1"},
+		{contract: 1, expect: "3"},
+		{contract: 1, expect: "1"},
+	} {
+		msg := message.New(message.Ssid{tc.contract, 2}, []byte("sensors/"), []byte("hello"))
+		assert.Nil(t, s.Transform(msg))
+		assert.Equal(t, tc.expect, string(msg.Payload))
+	}
+
+	// The store can not be used outside of a message
+	_, err = newTestHooks(t, `kv.get("count") function on_publish(msg) end`, config.HookConfig{})
+	assert.Error(t, err)
+}
+
+func TestTransform_Failure(t *testing.T) {
+	tests := []struct {
+		script   string
+		failOpen bool
+	}{
+		{script: `function on_publish(msg) error("boom") end`},
+		{script: `function on_publish(msg) while true do end end`},
+		{script: `function on_publish(msg) msg.payload = 42 end`},
+		{script: `function on_publish(msg) msg.ttl = -1 end`},
+		{script: `function on_publish(msg) msg.headers.zone = "a&b" end`},
+		{script: `function on_publish(msg) msg.headers.zone = "eu-west" end`},
+		{script: `function on_publish(msg) os.exit(1) end`},
+		{script: `function on_publish(msg) dofile("/etc/passwd") end`},
+		{script: `function on_publish(msg) msg.payload = string.rep("x", 1e12) end`},
+		{script: `function on_publish(msg) msg.payload = ("x"):rep(1e12) end`},
+		{script: `function on_publish(msg) error("boom") end`, failOpen: true},
+	}
+
+	for _, tc := range tests {
+		s, err := newTestHooks(t, tc.script, config.HookConfig{Timeout: 20, FailOpen: tc.failOpen})
+		assert.NoError(t, err)
+
+		msg := message.New(message.Ssid{1, 2}, []byte("sensors/"), []byte("hello"))
+		err2 := s.Transform(msg)
+		if tc.failOpen {
+			assert.Nil(t, err2, tc.script)
+		} else {
+			assert.Equal(t, errors.ErrServerError, err2, tc.script)
+		}
+		assert.Equal(t, "hello", string(msg.Payload))
+	}
+}
+
+func TestSandbox_Bounded(t *testing.T) {
+	tests := []struct {
+		script string
+		out    string // The value of 'x', if the script succeeds.
+	}{
+		{script: `x = string.rep("ab", 3)`, out: "ababab"},
+		{script: `x = string.rep("ab", 1e9)`},
+		{script: `x = string.format("%05.2f|%-10s|%%", 1.5, "a")`, out: "01.50|a         |%"},
+		{script: `x = string.format("%999999d", 1)`},
+		{script: `x = string.format("%.100f", 1)`},
+		{script: `x = table.concat({"a", "b", "c"}, ",")`, out: "a,b,c"},
+		{script: `local s = string.rep("x", 1e6) x = table.concat({s, s}, ",")`},
+		{script: `x = string.gsub("hello world", "(%w+)", "<%1>")`, out: "<hello> <world>"},
+		{script: `x = string.gsub("hello", "l", {l = "L"})`, out: "heLLo"},
+		{script: `x = string.gsub("hello", "(h)(e)", function(a, b) return b .. a end)`, out: "ehllo"},
+		{script: `x = ("abc"):gsub("%w", "%0%0")`, out: "aabbcc"},
+		{script: `x = string.gsub("abc", "x", "y")`, out: "abc"},
+		{script: `local s = string.rep("x", 1e5) x = string.gsub(s, ".", "%0%0%0%0%0%0%0%0%0%0%0")`},
+		{script: `local s = string.rep("x", 1e6) x = string.gsub("abc", ".", function() return s end)`},
+		{script: `x = json.encode({a = {1, "b", true}})`, out: `{"a":[1,"b",true]}`},
+		{script: `local t = {string.rep("x", 1e5)} for i = 1, 20 do t = {t, t} end x = json.encode(t)`},
+	}
+
+	for _, tc := range tests {
+		state := newState(nil)
+		err := state.DoString(tc.script)
+		if tc.out == "" {
+			assert.Error(t, err, tc.script)
+		} else if assert.NoError(t, err, tc.script) {
+			assert.Equal(t, tc.out, state.GetGlobal("x").String(), tc.script)
+		}
+		state.Close()
+	}
+}
@@ -0,0 +1,345 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package hook
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+var (
+	errInvalidPayload = errors.New("hook: the payload of the message must be a string")
+	errInvalidTTL     = errors.New("hook: the ttl of the message must be a positive number")
+	errInvalidHeaders = errors.New("hook: the headers of the message must be at most 8 alphanumeric strings")
+	errNoContract     = errors.New("hook: the key-value store can only be used while running on a message")
+)
+
+// contractKey is the key of the contract of the message in the context of the interpreter.
+type contractKey struct{}
+
+// The libraries opened in the sandbox, which leave out the access to the files, to the
+// operating system and to the other scripts.
+var libraries = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// The functions of the base library which are removed from the sandbox.
+var unsafe = []string{
+	"collectgarbage", "dofile", "getfenv", "setfenv", "load", "loadfile", "loadstring",
+	"module", "require", "print", "_printregs", "newproxy",
+}
+
+// compile parses and compiles the script at the path.
+func compile(path string) (*lua.FunctionProto, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+	chunk, err := parse.Parse(bufio.NewReader(file), path)
+	if err != nil {
+		return nil, err
+	}
+
+	return lua.Compile(chunk, path)
+}
+
+// newState creates a new sandboxed interpreter, with a small stack and only the libraries
+// which can not reach outside of it, along with a 'json' module to decode and encode the
+// payloads and a 'kv' module to keep some state, if a key-value store is specified.
+func newState(store service.KeyValue) *lua.LState {
+	state := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   64,
+		RegistrySize:    1024,
+		RegistryMaxSize: 64 * 1024,
+	})
+
+	for _, lib := range libraries {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+
+	for _, name := range unsafe {
+		state.SetGlobal(name, lua.LNil)
+	}
+
+	bind(state)
+
+	state.SetGlobal("json", state.SetFuncs(state.NewTable(), map[string]lua.LGFunction{
+		"decode": jsonDecode,
+		"encode": jsonEncode,
+	}))
+
+	if store != nil {
+		state.SetGlobal("kv", state.SetFuncs(state.NewTable(), map[string]lua.LGFunction{
+			"get":    kvGet(store),
+			"set":    kvSet(store),
+			"delete": kvDelete(store),
+		}))
+	}
+	return state
+}
+
+// contractOf returns the contract of the message the script runs on.
+func contractOf(state *lua.LState) uint32 {
+	if ctx := state.Context(); ctx != nil {
+		if contract, ok := ctx.Value(contractKey{}).(uint32); ok {
+			return contract
+		}
+	}
+
+	state.RaiseError("%s", errNoContract.Error())
+	return 0
+}
+
+// kvGet returns the value of a key of the contract, or nil if there is none.
+func kvGet(store service.KeyValue) lua.LGFunction {
+	return func(state *lua.LState) int {
+		value, ok, err := store.Get(contractOf(state), state.CheckString(1))
+		switch {
+		case err != nil:
+			state.RaiseError("%s", err.Error())
+		case !ok:
+			state.Push(lua.LNil)
+		default:
+			state.Push(lua.LString(value))
+		}
+		return 1
+	}
+}
+
+// kvSet sets the value of a key of the contract, which expires after the optional number
+// of seconds.
+func kvSet(store service.KeyValue) lua.LGFunction {
+	return func(state *lua.LState) int {
+		key, value, ttl := state.CheckString(1), state.CheckString(2), state.OptInt(3, 0)
+		if ttl < 0 {
+			state.ArgError(3, "the ttl must be a positive number")
+		}
+
+		if err := store.Set(contractOf(state), key, []byte(value), time.Duration(ttl)*time.Second); err != nil {
+			state.RaiseError("%s", err.Error())
+		}
+		return 0
+	}
+}
+
+// kvDelete removes a key of the contract.
+func kvDelete(store service.KeyValue) lua.LGFunction {
+	return func(state *lua.LState) int {
+		if err := store.Delete(contractOf(state), state.CheckString(1)); err != nil {
+			state.RaiseError("%s", err.Error())
+		}
+		return 0
+	}
+}
+
+// toTable converts the message to the table given to the script.
+func toTable(state *lua.LState, m *message.Message) *lua.LTable {
+	headers := state.NewTable()
+	for k, v := range m.Headers {
+		headers.RawSetString(k, lua.LString(v))
+	}
+
+	msg := state.NewTable()
+	msg.RawSetString("contract", lua.LNumber(m.Contract()))
+	msg.RawSetString("channel", lua.LString(m.Channel))
+	msg.RawSetString("payload", lua.LString(m.Payload))
+	msg.RawSetString("ttl", lua.LNumber(m.TTL))
+	msg.RawSetString("headers", headers)
+	return msg
+}
+
+// fromTable applies the payload, the time-to-live and the headers of the table the script
+// was given to the message. Its contract and its channel can not be changed.
+func fromTable(msg *lua.LTable, m *message.Message) error {
+	payload, ok := msg.RawGetString("payload").(lua.LString)
+	if !ok {
+		return errInvalidPayload
+	}
+
+	ttl, ok := msg.RawGetString("ttl").(lua.LNumber)
+	if !ok || ttl < 0 || ttl > math.MaxUint32 {
+		return errInvalidTTL
+	}
+
+	headers, err := headersOf(msg.RawGetString("headers"))
+	if err != nil {
+		return err
+	}
+
+	if string(payload) != string(m.Payload) {
+		m.Payload = []byte(payload)
+	}
+
+	m.TTL = uint32(ttl)
+	m.Headers = headers
+	return nil
+}
+
+// headersOf converts the headers of the table the script was given, which are delivered as
+// channel options and hence must be short alphanumeric strings.
+func headersOf(value lua.LValue) (headers message.Headers, err error) {
+	table, ok := value.(*lua.LTable)
+	if !ok {
+		if value != lua.LNil {
+			return nil, errInvalidHeaders
+		}
+		return nil, nil
+	}
+
+	table.ForEach(func(k, v lua.LValue) {
+		key, ok := k.(lua.LString)
+		if !ok || !lua.LVCanConvToString(v) || !security.IsOption(string(key)) || !security.IsOption(lua.LVAsString(v)) {
+			err = errInvalidHeaders
+			return
+		}
+
+		if headers == nil {
+			headers = make(message.Headers, 2)
+		}
+		headers[string(key)] = lua.LVAsString(v)
+	})
+
+	if err != nil || len(headers) > message.MaxHeaders {
+		return nil, errInvalidHeaders
+	}
+	return
+}
+
+// ------------------------------------------------------------------------------------
+
+// jsonDecode decodes a JSON text into a Lua value, or returns nil and the error.
+func jsonDecode(state *lua.LState) int {
+	var value interface{}
+	if err := json.Unmarshal([]byte(state.CheckString(1)), &value); err != nil {
+		state.Push(lua.LNil)
+		state.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	state.Push(toValue(state, value))
+	return 1
+}
+
+// jsonEncode encodes a Lua value into a JSON text, or returns nil and the error.
+func jsonEncode(state *lua.LState) int {
+	size := 0
+	value := fromValue(state.CheckAny(1), 0, &size)
+	if size > maxString {
+		tooLarge(state)
+	}
+
+	out, err := json.Marshal(value)
+	if err != nil {
+		state.Push(lua.LNil)
+		state.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	state.Push(lua.LString(out))
+	return 1
+}
+
+// toValue converts a decoded JSON value into a Lua value.
+func toValue(state *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		table := state.CreateTable(len(v), 0)
+		for _, item := range v {
+			table.Append(toValue(state, item))
+		}
+		return table
+	case map[string]interface{}:
+		table := state.CreateTable(0, len(v))
+		for k, item := range v {
+			table.RawSetString(k, toValue(state, item))
+		}
+		return table
+	default:
+		return lua.LNil
+	}
+}
+
+// fromValue converts a Lua value into a value which can be encoded in JSON. The tables with
+// a sequence are encoded as arrays and the others as objects, while the tables nested too
+// deeply, such as the recursive ones, are left out. The size of the JSON text is estimated
+// along the way, and the conversion stops once it is larger than allowed, since a table can
+// refer to the same values many times.
+func fromValue(value lua.LValue, depth int, size *int) interface{} {
+	if *size > maxString {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case lua.LBool:
+		*size += 5
+		return bool(v)
+	case lua.LNumber:
+		*size += 24
+		return float64(v)
+	case lua.LString:
+		*size += len(v) + 2
+		return string(v)
+	case *lua.LTable:
+		if *size += 2; depth > 32 {
+			return nil
+		}
+
+		if n := v.Len(); n > 0 {
+			items := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				items = append(items, fromValue(v.RawGetInt(i), depth+1, size))
+			}
+			return items
+		}
+
+		object := make(map[string]interface{})
+		v.ForEach(func(k, item lua.LValue) {
+			if key, ok := k.(lua.LString); ok {
+				*size += len(key) + 3
+				object[string(key)] = fromValue(item, depth+1, size)
+			}
+		})
+		return object
+	default:
+		return nil
+	}
+}
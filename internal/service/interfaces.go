@@ -16,7 +16,9 @@ package service
 
 import (
 	"io"
+	"time"
 
+	"github.com/emitter-io/emitter/internal/errors"
 	"github.com/emitter-io/emitter/internal/event"
 	"github.com/emitter-io/emitter/internal/message"
 	"github.com/emitter-io/emitter/internal/provider/contract"
@@ -49,7 +51,7 @@ type Surveyee interface {
 	OnSurvey(string, []byte) ([]byte, bool)
 }
 
-//Surveyor issues the surveys.
+// Surveyor issues the surveys.
 type Surveyor interface {
 	Query(string, []byte) (message.Awaiter, error)
 }
@@ -60,12 +62,23 @@ type Conn interface {
 	message.Subscriber
 	CanSubscribe(message.Ssid, []byte) bool
 	CanUnsubscribe(message.Ssid, []byte) bool
+	Subscriptions() *message.Counters
 	LocalID() security.ID
 	Username() string
+	Meta() map[string]string
 	Track(contract.Contract)
 	Links() map[string]string
 	GetLink([]byte) []byte
 	AddLink(string, *security.Channel)
+	EnableSigning(bool)
+	EnableHeaders(bool)
+	EnableChunks(int)
+	WarnExpiry(time.Duration)
+}
+
+// Auditor records the security-relevant events in the audit trail.
+type Auditor interface {
+	Audit(string, uint32, string, string)
 }
 
 // Replicator replicates an event withih the cluster
@@ -79,8 +92,69 @@ type Decryptor interface {
 	DecryptKey(string) (security.Key, error)
 }
 
+// Encryptor encrypts security keys.
+type Encryptor interface {
+	EncryptKey(security.Key) (string, error)
+}
+
+// Shedder decides whether the work of a given priority should be shed due to overload.
+type Shedder interface {
+	Shed(uint8) bool
+}
+
+// Scheduler schedules the work of a contract, fairly shared with the other contracts.
+type Scheduler interface {
+	Schedule(uint32, func())
+	Enqueue(uint32, func())
+}
+
 // Notifier notifies the cluster about publish/subscribe events.
 type Notifier interface {
+	NotifyPublish(*message.Message, int)
 	NotifySubscribe(message.Subscriber, *event.Subscription)
 	NotifyUnsubscribe(message.Subscriber, *event.Subscription)
 }
+
+// Scanner scans the content of the messages published on some of the channels.
+type Scanner interface {
+	Matches([]byte) bool
+	Holds() bool
+	Scan(*message.Message, func(bool))
+}
+
+// Transformer runs the hooks on the messages published, which may alter or refuse them.
+type Transformer interface {
+	Transform(*message.Message) *errors.Error
+}
+
+// Router applies the routing rules to the messages published, which may drop them.
+type Router interface {
+	Route(*message.Message) bool
+}
+
+// Connector sends the messages to an external system.
+type Connector interface {
+	Send(*message.Message) error
+}
+
+// Delayer holds the messages until their delivery time.
+type Delayer interface {
+	Delay(*message.Message, time.Time, bool) *errors.Error
+}
+
+// DeadLetterer republishes the messages which could not be delivered, along with the reason.
+type DeadLetterer interface {
+	DeadLetter(*message.Message, string)
+}
+
+// Observer observes the messages published by the clients.
+type Observer interface {
+	Observe(*message.Message)
+}
+
+// KeyValue represents a small key-value store, namespaced per contract.
+type KeyValue interface {
+	Get(uint32, string) ([]byte, bool, error)
+	Set(uint32, string, []byte, time.Duration) error
+	Delete(uint32, string) error
+}
@@ -15,14 +15,17 @@
 package keygen
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service/audit"
 )
 
 // HTTP creates a new HTTP handler which can be used to serve HTTP keygen page.
@@ -50,8 +53,10 @@ func (s *Service) HTTP() http.HandlerFunc {
 				if f.isValid() {
 					key, err := s.CreateKey(f.Key, f.Channel, f.access(), f.expires())
 					if err != nil {
+						s.record(audit.KindDenied, 0, r.RemoteAddr, "keygen for "+f.Channel+": "+err.Error())
 						f.Response = err.Error()
 					} else {
+						s.record(audit.KindKeygen, 0, r.RemoteAddr, "created a key for "+f.Channel)
 						f.Response = fmt.Sprintf("channel: %s\nkey    : %s", f.Channel, key)
 					}
 
@@ -72,6 +77,44 @@ func (s *Service) HTTP() http.HandlerFunc {
 	}
 }
 
+// OnHTTP occurs when a new HTTP keygen request is received, whose body is a JSON request
+// with the master key, or with the master key given as a bearer token instead.
+func (s *Service) OnHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var request Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if request.Key == "" {
+		request.Key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	key, err := s.CreateKey(request.Key, request.Channel, request.access(), request.expires())
+	if err != nil {
+		s.record(audit.KindDenied, 0, r.RemoteAddr, "keygen for "+request.Channel+": "+err.Error())
+		resp, _ := json.Marshal(err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(err.Status)
+		w.Write(resp)
+		return
+	}
+
+	s.record(audit.KindKeygen, 0, r.RemoteAddr, "created a key for "+request.Channel)
+	resp, _ := json.Marshal(&Response{
+		Status:  http.StatusOK,
+		Key:     key,
+		Channel: request.Channel,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
 // ------------------------------------------------------------------------------------
 
 type keygenForm struct {
@@ -202,3 +202,33 @@ func Test_HTTP(t *testing.T) {
 		assert.Contains(t, response, c.ExpectedResponseContains, c.Scenario)
 	}
 }
+
+func TestOnHTTP(t *testing.T) {
+	p := newTestProvider(t)
+	tests := []struct {
+		method string
+		body   string
+		bearer string
+		code   int
+	}{
+		{method: "GET", code: 404},
+		{method: "POST", body: "{", code: 400},
+		{method: "POST", body: `{"key":"invalid","channel":"a/b/","type":"rw"}`, code: 401},
+		{method: "POST", body: `{"key":"` + keygenTestSecret + `","channel":"a/b/","type":"rw"}`, code: 200},
+		{method: "POST", body: `{"channel":"a/b/","type":"rw"}`, bearer: keygenTestSecret, code: 200},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, "/admin/keygen", strings.NewReader(tc.body))
+		if tc.bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.bearer)
+		}
+
+		w := httptest.NewRecorder()
+		p.OnHTTP(w, req)
+		assert.Equal(t, tc.code, w.Code, tc.body)
+		if tc.code == http.StatusOK {
+			assert.Contains(t, w.Body.String(), `"channel":"a/b/"`)
+		}
+	}
+}
@@ -29,13 +29,17 @@ import (
 	"github.com/emitter-io/emitter/internal/security/hash"
 	"github.com/emitter-io/emitter/internal/security/license"
 	"github.com/emitter-io/emitter/internal/service"
+	"github.com/emitter-io/emitter/internal/service/audit"
 )
 
 // Service represents a key generation service.
 type Service struct {
-	cipher license.Cipher     // Cipher to use for the key generation
-	loader contract.Provider  // Contract loader to use to retrieve contracts
-	auth   service.Authorizer // The authorizer to use.
+	cipher    license.Cipher     // Cipher to use for the key generation
+	loader    contract.Provider  // Contract loader to use to retrieve contracts
+	auth      service.Authorizer // The authorizer to use.
+	audit     service.Auditor    // The audit trail (optional).
+	region    string             // The region of this cluster (optional).
+	endpoints map[string]string  // The public endpoints of the regions (optional).
 }
 
 // New creates a new key generation provider.
@@ -47,6 +51,25 @@ func New(cipher license.Cipher, loader contract.Provider, auth service.Authorize
 	}
 }
 
+// UseRegion makes the service only generate the keys of the contracts homed in the region,
+// redirecting the other requests to the public endpoints of their home regions.
+func (s *Service) UseRegion(region string, endpoints map[string]string) {
+	s.region = region
+	s.endpoints = endpoints
+}
+
+// UseAuditor records the keys generated and the keys rejected in the audit trail.
+func (s *Service) UseAuditor(auditor service.Auditor) {
+	s.audit = auditor
+}
+
+// record records an event in the audit trail, if any.
+func (s *Service) record(kind string, contract uint32, actor, detail string) {
+	if s.audit != nil {
+		s.audit.Audit(kind, contract, actor, detail)
+	}
+}
+
 // OnRequest processes a keygen request.
 func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, bool) {
 	var message Request
@@ -57,6 +80,7 @@ func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, b
 	// Decrypt the parent key and make sure it's not expired
 	parentKey, err := s.DecryptKey(message.Key)
 	if err != nil || parentKey.IsExpired() {
+		s.record(audit.KindAuthFailed, 0, c.ID(), "keygen with an invalid or expired key")
 		return errors.ErrUnauthorized, false
 	}
 
@@ -64,9 +88,12 @@ func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, b
 	if parentKey.IsMaster() {
 		key, err := s.CreateKey(message.Key, message.Channel, message.access(), message.expires())
 		if err != nil {
+			s.record(audit.KindDenied, parentKey.Contract(), c.ID(), "keygen for "+message.Channel+": "+err.Error())
 			return err, false
 		}
 
+		s.record(audit.KindKeygen, parentKey.Contract(), c.ID(), "created a key for "+message.Channel)
+
 		// Success, return the response
 		return &Response{
 			Status:  200,
@@ -79,9 +106,12 @@ func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, b
 	if parentKey.HasPermission(security.AllowExtend) {
 		channel, err := s.ExtendKey(message.Key, message.Channel, c.ID(), message.access(), message.expires())
 		if err != nil {
+			s.record(audit.KindDenied, parentKey.Contract(), c.ID(), "keygen for "+message.Channel+": "+err.Error())
 			return err, false
 		}
 
+		s.record(audit.KindKeygen, parentKey.Contract(), c.ID(), "extended a key to "+string(channel.Channel))
+
 		// Success, return the response
 		return &Response{
 			Status:  200,
@@ -91,9 +121,40 @@ func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, b
 	}
 
 	// Not authorised
+	s.record(audit.KindDenied, parentKey.Contract(), c.ID(), "keygen for "+message.Channel+" without the extend permission")
 	return errors.ErrUnauthorized, false
 }
 
+// OnRenew processes a request to renew the expiry of a key, given the master key it was
+// generated with.
+func (s *Service) OnRenew(c service.Conn, payload []byte) (service.Response, bool) {
+	var message RenewRequest
+	if err := json.Unmarshal(payload, &message); err != nil || message.Target == "" {
+		return errors.ErrBadRequest, false
+	}
+
+	// Decrypt the master key and make sure it's not expired
+	masterKey, err := s.DecryptKey(message.Key)
+	if err != nil || !masterKey.IsMaster() || masterKey.IsExpired() {
+		s.record(audit.KindAuthFailed, 0, c.ID(), "key renewal with an invalid or expired key")
+		return errors.ErrUnauthorized, false
+	}
+
+	expires := message.expires()
+	key, renewErr := s.RenewKey(message.Key, message.Target, expires)
+	if renewErr != nil {
+		s.record(audit.KindDenied, masterKey.Contract(), c.ID(), "key renewal: "+renewErr.Error())
+		return renewErr, false
+	}
+
+	s.record(audit.KindKeygen, masterKey.Contract(), c.ID(), "renewed a key")
+	return &RenewResponse{
+		Status:  200,
+		Key:     key,
+		Expires: expires.Unix(),
+	}, true
+}
+
 // DecryptKey decrypts a key and returns it
 func (s *Service) DecryptKey(key string) (security.Key, error) {
 	return s.cipher.DecryptKey([]byte(key))
@@ -122,6 +183,11 @@ func (s *Service) CreateKey(rawMasterKey, channel string, access uint8, expires
 		return "", errors.ErrUnauthorized
 	}
 
+	// The keys are only generated in the home regions of the contract
+	if s.region != "" && !contract.Placement().IsHome(s.region) {
+		return "", errors.ErrWrongRegion.WithRetry(0, s.endpointsOf(contract.Placement().Home))
+	}
+
 	// Generate random salt
 	n, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt16))
 	if err != nil {
@@ -161,6 +227,58 @@ func (s *Service) CreateKey(rawMasterKey, channel string, access uint8, expires
 	return out, nil
 }
 
+// RenewKey renews a key generated with the master key, which keeps its channel and its
+// permissions but expires at the new expiration time. Since only the expiry changes, the
+// key can even be renewed once it has expired.
+func (s *Service) RenewKey(rawMasterKey, rawKey string, expires time.Time) (string, *errors.Error) {
+	masterKey, err := s.DecryptKey(rawMasterKey)
+	if err != nil || !masterKey.IsMaster() || masterKey.IsExpired() {
+		return "", errors.ErrUnauthorized
+	}
+
+	// Attempt to fetch the contract using the key. Underneath, it's cached.
+	contract, contractFound := s.loader.Get(masterKey.Contract())
+	if !contractFound {
+		return "", errors.ErrNotFound
+	}
+
+	// Validate the contract
+	if !contract.Validate(masterKey) {
+		return "", errors.ErrUnauthorized
+	}
+
+	// The keys are only renewed in the home regions of the contract, as they are generated
+	if s.region != "" && !contract.Placement().IsHome(s.region) {
+		return "", errors.ErrWrongRegion.WithRetry(0, s.endpointsOf(contract.Placement().Home))
+	}
+
+	// Only the keys generated with this master key can be renewed with it
+	key, err := s.DecryptKey(rawKey)
+	if err != nil || key.IsMaster() || key.Contract() != masterKey.Contract() || key.Master() != masterKey.Master() {
+		return "", errors.ErrUnauthorized
+	}
+
+	// Apply the new expiration to a copy of the key
+	renewed := security.Key(append([]byte(nil), key...))
+	renewed.SetExpires(expires)
+	out, err := s.cipher.EncryptKey(renewed)
+	if err != nil {
+		return "", errors.ErrServerError
+	}
+
+	return out, nil
+}
+
+// endpointsOf returns the public endpoints of the regions.
+func (s *Service) endpointsOf(regions []string) (out []string) {
+	for _, region := range regions {
+		if endpoint, ok := s.endpoints[region]; ok {
+			out = append(out, endpoint)
+		}
+	}
+	return
+}
+
 // ExtendKey creates a private channel and an appropriate key.
 func (s *Service) ExtendKey(channelKey, channelName, connectionID string, access uint8, expires time.Time) (*security.Channel, *errors.Error) {
 	var suffix string
@@ -26,6 +26,7 @@ import (
 	"github.com/emitter-io/emitter/internal/provider/usage"
 	"github.com/emitter-io/emitter/internal/security"
 	"github.com/emitter-io/emitter/internal/security/license"
+	"github.com/emitter-io/emitter/internal/service/audit"
 	"github.com/emitter-io/emitter/internal/service/fake"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -95,6 +96,28 @@ func TestKeyGen_Request(t *testing.T) {
 	}
 }
 
+func TestKeyGen_Audit(t *testing.T) {
+	license, _ := license.Parse(keygenTestLicense)
+	cipher, _ := license.Cipher()
+	provider := secmock.NewContractProvider()
+	provider.On("Get", mock.Anything).Return(&fake.Contract{}, true)
+
+	auditor := new(fake.Auditor)
+	s := New(cipher, provider, &fake.Authorizer{Contract: 1, Success: true})
+	s.UseAuditor(auditor)
+
+	for _, key := range []string{keygenTestSecret, "invalid"} {
+		b, _ := json.Marshal(&Request{
+			Key:     key,
+			Channel: "a/b/",
+			Type:    "rwls",
+		})
+		s.OnRequest(&fake.Conn{ConnID: 1}, b)
+	}
+
+	assert.Equal(t, []string{audit.KindKeygen, audit.KindAuthFailed}, auditor.Kinds)
+}
+
 func TestExtendKey(t *testing.T) {
 	license, _ := license.Parse(keygenTestLicense)
 
@@ -258,6 +281,40 @@ func TestCreateKey(t *testing.T) {
 	}
 }
 
+func TestCreateKey_Region(t *testing.T) {
+	license, _ := license.Parse("N7XxQbUEPxJ_RIj4muLUdLGYtR1kdKe2AAAAAAAAAAI")
+	tests := []struct {
+		region string
+		home   []string
+		err    *errors.Error
+	}{
+		{region: "eu"},
+		{region: "eu", home: []string{"eu"}},
+		{region: "us", home: []string{"eu", "ch"}, err: errors.ErrWrongRegion.WithRetry(0, []string{"eu.example.com:8080"})},
+	}
+
+	for _, tc := range tests {
+		provider := secmock.NewContractProvider()
+		c := new(secmock.Contract)
+		c.On("Validate", mock.Anything).Return(true)
+		c.On("Placement").Return(contract.Placement{Home: tc.home})
+		provider.On("Get", mock.Anything).Return(c, true)
+		cipher, _ := license.Cipher()
+		p := New(cipher, provider, &authorizer{cipher, provider})
+		p.UseRegion(tc.region, map[string]string{
+			"eu": "eu.example.com:8080",
+			"us": "us.example.com:8080",
+		})
+
+		_, err := p.CreateKey("8GR6MtpL7Xut-pyogQMeS_gyxEA21BbR", "article1/", 0, time.Time{})
+		if tc.err != nil {
+			assert.Equal(t, tc.err, err)
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+}
+
 type authorizer struct {
 	cipher license.Cipher
 	loader contract.Provider
@@ -280,3 +337,52 @@ func (a *authorizer) Authorize(channel *security.Channel, permission uint8) (con
 	// Return the contract and the key
 	return contract, key, true
 }
+
+func TestKeyGen_Renew(t *testing.T) {
+	license, _ := license.Parse(keygenTestLicense)
+	cipher, _ := license.Cipher()
+	provider := secmock.NewContractProvider()
+	provider.On("Get", mock.Anything).Return(&fake.Contract{}, true)
+
+	auditor := new(fake.Auditor)
+	s := New(cipher, provider, &fake.Authorizer{Contract: 1, Success: true})
+	s.UseAuditor(auditor)
+
+	original, err := s.CreateKey(keygenTestSecret, "a/b/", security.AllowReadWrite, time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+
+	renew := func(master, target string, ttl int32) (*RenewResponse, bool) {
+		b, _ := json.Marshal(&RenewRequest{Key: master, Target: target, TTL: ttl})
+		resp, ok := s.OnRenew(&fake.Conn{ConnID: 1}, b)
+		renewed, _ := resp.(*RenewResponse)
+		return renewed, ok
+	}
+
+	// The renewed key keeps its channel and permissions
+	resp, ok := renew(keygenTestSecret, original, 3600)
+	assert.True(t, ok)
+	assert.NotEqual(t, original, resp.Key)
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), resp.Expires, 5)
+
+	before, _ := s.DecryptKey(original)
+	after, _ := s.DecryptKey(resp.Key)
+	assert.Equal(t, resp.Expires, after.Expires().Unix())
+	assert.Equal(t, before.Permissions(), after.Permissions())
+	assert.Equal(t, before.Salt(), after.Salt())
+	assert.True(t, after.ValidateChannel(security.ParseChannel([]byte(resp.Key+"/a/b/"))))
+
+	// A key renewed without a TTL does not expire
+	resp, ok = renew(keygenTestSecret, original, 0)
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), resp.Expires)
+
+	// The master key can not be renewed, nor used as the target
+	_, ok = renew(original, original, 3600)
+	assert.False(t, ok)
+	_, ok = renew(keygenTestSecret, keygenTestSecret, 3600)
+	assert.False(t, ok)
+	_, ok = renew(keygenTestSecret, "", 3600)
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{audit.KindKeygen, audit.KindKeygen, audit.KindAuthFailed, audit.KindDenied}, auditor.Kinds)
+}
@@ -30,11 +30,17 @@ type Request struct {
 
 // expires returns the requested expiration time
 func (m *Request) expires() time.Time {
-	if m.TTL == 0 {
+	return expiresIn(m.TTL)
+}
+
+// expiresIn returns the expiration time of a key with a TTL, in seconds, where a key without
+// a TTL does not expire.
+func expiresIn(ttl int32) time.Time {
+	if ttl == 0 {
 		return time.Unix(0, 0)
 	}
 
-	return time.Now().Add(time.Duration(m.TTL) * time.Second).UTC()
+	return time.Now().Add(time.Duration(ttl) * time.Second).UTC()
 }
 
 // access returns the requested level of access
@@ -76,3 +82,30 @@ type Response struct {
 func (r *Response) ForRequest(id uint16) {
 	r.Request = id
 }
+
+// ------------------------------------------------------------------------------------
+
+// RenewRequest represents a request to renew the expiry of a key.
+type RenewRequest struct {
+	Key    string `json:"key"`    // The master key to use.
+	Target string `json:"target"` // The key to renew.
+	TTL    int32  `json:"ttl"`    // The new TTL of the key, from now.
+}
+
+// expires returns the requested expiration time
+func (m *RenewRequest) expires() time.Time {
+	return expiresIn(m.TTL)
+}
+
+// RenewResponse represents a response to a key renewal request.
+type RenewResponse struct {
+	Request uint16 `json:"req,omitempty"`
+	Status  int    `json:"status"`
+	Key     string `json:"key"`     // The renewed key.
+	Expires int64  `json:"expires"` // The unix time the renewed key expires at, zero if it does not.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *RenewResponse) ForRequest(id uint16) {
+	r.Request = id
+}
@@ -0,0 +1,202 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package kv
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+const (
+	maxKeySize   = 256              // The maximum size of a key, in bytes.
+	maxValueSize = 64 * 1024        // The maximum size of a value, in bytes.
+	maxVersions  = 16               // The maximum number of stored versions looked up for a key.
+	tombstoneTTL = 24 * time.Hour   // The duration the deletions are remembered for.
+	forever      = time.Duration(0) // The time-to-live of the values which never expire.
+)
+
+var channel = []byte("emitter/kv/")
+
+// Various errors of the key-value store.
+var (
+	ErrKeyInvalid    = errors.New("kv: the key must be between 1 and 256 bytes")
+	ErrValueTooLarge = errors.New("kv: the value must not exceed 64KB")
+)
+
+// Service implements the KeyValue contract.
+var _ service.KeyValue = new(Service)
+
+// entry represents a version of a value, as stored.
+type entry struct {
+	Key     string `json:"key"`               // The key of the value.
+	Value   []byte `json:"value,omitempty"`   // The value.
+	Time    int64  `json:"time"`              // The unix time of the version, in nanoseconds.
+	Deleted bool   `json:"deleted,omitempty"` // Whether the key was deleted.
+}
+
+// Service represents a small key-value store, namespaced per contract, which lets the
+// rules and the plugins keep their state (e.g: counters, debouncing) without an external
+// database. The values are kept in the message storage, so they are replicated the same
+// way as the messages and the queries of the storage reach the other nodes.
+type Service struct {
+	sync.Mutex
+	store storage.Storage // The storage provider to use.
+}
+
+// New creates a new key-value store.
+func New(store storage.Storage) *Service {
+	return &Service{
+		store: store,
+	}
+}
+
+// Get retrieves the value of the key for the contract, and whether it was found.
+func (s *Service) Get(contract uint32, key string) ([]byte, bool, error) {
+	if len(key) == 0 || len(key) > maxKeySize {
+		return nil, false, ErrKeyInvalid
+	}
+
+	versions, err := s.versions(message.NewSsidForKey(contract, key))
+	if err != nil {
+		return nil, false, err
+	}
+
+	latest := latestOf(versions, key)
+	if latest == nil || latest.Deleted {
+		return nil, false, nil
+	}
+	return latest.Value, true, nil
+}
+
+// Set sets the value of the key for the contract, which expires after the time-to-live
+// unless it is zero.
+func (s *Service) Set(contract uint32, key string, value []byte, ttl time.Duration) error {
+	if len(key) == 0 || len(key) > maxKeySize {
+		return ErrKeyInvalid
+	}
+
+	if len(value) > maxValueSize {
+		return ErrValueTooLarge
+	}
+
+	return s.write(contract, &entry{
+		Key:   key,
+		Value: value,
+	}, ttl)
+}
+
+// Delete removes the key of the contract.
+func (s *Service) Delete(contract uint32, key string) error {
+	if len(key) == 0 || len(key) > maxKeySize {
+		return ErrKeyInvalid
+	}
+
+	// A deletion is kept for a while, so the previous versions still stored on the other
+	// nodes do not come back
+	return s.write(contract, &entry{
+		Key:     key,
+		Deleted: true,
+	}, tombstoneTTL)
+}
+
+// versions retrieves the stored versions of the keys of an SSID.
+func (s *Service) versions(ssid message.Ssid) (message.Frame, error) {
+	zero := time.Unix(0, 0)
+	return s.store.Query(ssid, zero, zero, maxVersions)
+}
+
+// write stores a new version of the key and removes the previous ones from this node.
+func (s *Service) write(contract uint32, e *entry, ttl time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	e.Time = time.Now().UnixNano()
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ssid := message.NewSsidForKey(contract, e.Key)
+	previous, err := s.versions(ssid)
+	if err != nil {
+		return err
+	}
+
+	msg := message.New(ssid, channel, encoded)
+	msg.TTL = message.RetainedTTL
+	if ttl != forever {
+		msg.TTL = uint32((ttl + time.Second - 1) / time.Second)
+	}
+
+	if err := s.store.Store(msg); err != nil {
+		return err
+	}
+
+	// Several keys may hash the same, so the latest versions of the other keys are stored
+	// again once the previous versions are removed
+	if err := s.store.Delete(ssid, time.Unix(0, 0), time.Unix(msg.Time()-1, 0)); err != nil {
+		logging.LogError("kv", "removing previous versions", err)
+		return nil
+	}
+
+	for _, m := range othersOf(previous, e.Key, msg.Time()) {
+		if err := s.store.Store(m); err != nil {
+			logging.LogError("kv", "keeping the versions of another key", err)
+		}
+	}
+	return nil
+}
+
+// latestOf returns the latest version of the key among the stored versions, or nil if none.
+// Several keys may hash the same and older versions may still be around.
+func latestOf(versions message.Frame, key string) (latest *entry) {
+	for _, m := range versions {
+		var stored entry
+		if err := json.Unmarshal(m.Payload, &stored); err == nil && stored.Key == key && (latest == nil || stored.Time > latest.Time) {
+			latest = &stored
+		}
+	}
+	return
+}
+
+// othersOf returns the latest stored version of each of the keys other than the specified
+// one, which were stored before the unix time.
+func othersOf(versions message.Frame, key string, before int64) (out []*message.Message) {
+	latest := make(map[string]int64)
+	index := make(map[string]int)
+	for i, m := range versions {
+		var stored entry
+		if err := json.Unmarshal(m.Payload, &stored); err != nil || stored.Key == key || m.Time() >= before {
+			continue
+		}
+
+		if t, ok := latest[stored.Key]; !ok || stored.Time > t {
+			latest[stored.Key] = stored.Time
+			index[stored.Key] = i
+		}
+	}
+
+	for _, i := range index {
+		out = append(out, &versions[i])
+	}
+	return
+}
@@ -0,0 +1,99 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package kv
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService() (*Service, storage.Storage) {
+	store := storage.NewInMemory(nil)
+	store.Configure(nil)
+	return New(store), store
+}
+
+func TestKV_SetGet(t *testing.T) {
+	s, store := newTestService()
+	defer store.Close()
+
+	_, ok, err := s.Get(1, "counter")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, s.Set(1, "counter", []byte("1"), 0))
+	assert.NoError(t, s.Set(1, "counter", []byte("2"), time.Minute))
+
+	v, ok, err := s.Get(1, "counter")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("2"), v)
+
+	// Another contract has its own namespace
+	_, ok, err = s.Get(2, "counter")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestKV_Delete(t *testing.T) {
+	s, store := newTestService()
+	defer store.Close()
+
+	assert.NoError(t, s.Set(1, "a", []byte("x"), 0))
+	assert.NoError(t, s.Delete(1, "a"))
+
+	_, ok, err := s.Get(1, "a")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestKV_Collision(t *testing.T) {
+	s, store := newTestService()
+	defer store.Close()
+
+	// Store a version of another key which hashes the same as 'a'
+	ssid := message.NewSsidForKey(1, "a")
+	other := message.New(ssid, channel, []byte(`{"key":"b","value":"eQ==","time":1}`))
+	other.ID.SetTime(other.Time() - 10)
+	other.TTL = message.RetainedTTL
+	assert.NoError(t, store.Store(other))
+
+	// Writing 'a' removes its previous versions, but keeps the ones of 'b'
+	assert.NoError(t, s.Set(1, "a", []byte("x"), 0))
+	assert.NoError(t, s.Set(1, "a", []byte("z"), 0))
+
+	versions, err := s.versions(ssid)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("y"), latestOf(versions, "b").Value)
+	assert.Equal(t, []byte("z"), latestOf(versions, "a").Value)
+}
+
+func TestKV_Limits(t *testing.T) {
+	s, store := newTestService()
+	defer store.Close()
+
+	assert.Equal(t, ErrKeyInvalid, s.Set(1, "", nil, 0))
+	assert.Equal(t, ErrKeyInvalid, s.Set(1, strings.Repeat("k", maxKeySize+1), nil, 0))
+	assert.Equal(t, ErrValueTooLarge, s.Set(1, "a", make([]byte, maxValueSize+1), 0))
+
+	_, _, err := s.Get(1, "")
+	assert.Equal(t, ErrKeyInvalid, err)
+	assert.Equal(t, ErrKeyInvalid, s.Delete(1, ""))
+}
@@ -73,6 +73,7 @@ func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, b
 			User:    nocopy.String(c.Username()),
 			Ssid:    ssid,
 			Channel: channel.Channel,
+			Meta:    c.Meta(),
 		})
 	}
 
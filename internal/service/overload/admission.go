@@ -0,0 +1,114 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package overload
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	minRetryAfter = time.Second // The minimum delay a throttled client is asked to wait for.
+	maxRetryAfter = time.Minute // The maximum delay a throttled client is asked to wait for.
+)
+
+// Admission throttles the new connections once they arrive faster than the configured rate,
+// such as when every client reconnects at once after a restart. The rate admitted is halved
+// for every overload level of the guard, and the throttled clients are asked to retry after
+// a jittered delay which grows with the backlog, spreading their reconnections over time.
+type Admission struct {
+	sync.Mutex
+	guard   *Guard     // The guard of the node, to adapt the rate to the overload.
+	rate    float64    // The number of connections admitted per second, zero if disabled.
+	tokens  float64    // The number of connections which can be admitted right away.
+	backlog float64    // The estimated number of clients waiting to be admitted.
+	last    time.Time  // The time of the last connection.
+	random  *rand.Rand // The random generator of the jitter.
+}
+
+// NewAdmission creates a new admission control admitting the specified number of new
+// connections per second. If the rate is zero, every connection is admitted.
+func NewAdmission(rate int, guard *Guard) *Admission {
+	return &Admission{
+		guard:  guard,
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Admit returns whether a new connection can be admitted and, if not, the delay after
+// which the client should retry.
+func (a *Admission) Admit() (bool, time.Duration) {
+	return a.admit(time.Now())
+}
+
+// admit returns whether a connection arriving at the specified time can be admitted.
+func (a *Admission) admit(now time.Time) (bool, time.Duration) {
+	a.Lock()
+	defer a.Unlock()
+	if a.rate <= 0 {
+		return true, 0
+	}
+
+	// Refill the tokens, allowing a burst of a second, and drain the backlog at the same rate
+	rate := a.admitted()
+	elapsed := math.Max(0, now.Sub(a.last).Seconds())
+	a.last = now
+	a.tokens = math.Min(rate, a.tokens+elapsed*rate)
+	a.backlog = math.Max(0, a.backlog-elapsed*rate)
+	if a.tokens >= 1 {
+		a.tokens--
+		return true, 0
+	}
+
+	// Spread the retries over the time it takes to admit the clients waiting
+	a.backlog++
+	window := time.Duration(a.backlog / rate * float64(time.Second))
+	delay := minRetryAfter + time.Duration(a.random.Int63n(int64(window)+1))
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return false, delay
+}
+
+// SetRate changes the number of new connections admitted per second, zero disabling the
+// admission control.
+func (a *Admission) SetRate(rate int) {
+	a.Lock()
+	defer a.Unlock()
+	a.rate = float64(rate)
+	a.tokens = math.Min(a.tokens, a.rate)
+}
+
+// admitted returns the number of connections admitted per second, depending on the
+// current overload level.
+func (a *Admission) admitted() float64 {
+	if a.guard == nil {
+		return a.rate
+	}
+	return a.rate / float64(uint(1)<<a.guard.Level())
+}
+
+// Backlog returns the estimated number of clients waiting to be admitted, which is zero
+// unless there is a storm of connections.
+func (a *Admission) Backlog() int {
+	a.Lock()
+	defer a.Unlock()
+	return int(a.backlog)
+}
@@ -0,0 +1,96 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package overload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmission_Disabled(t *testing.T) {
+	a := NewAdmission(0, nil)
+	for i := 0; i < 100; i++ {
+		ok, _ := a.Admit()
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 0, a.Backlog())
+}
+
+func TestAdmission_SetRate(t *testing.T) {
+	a := NewAdmission(10, nil)
+	a.SetRate(2)
+	now := a.last
+
+	for i := 0; i < 2; i++ {
+		ok, _ := a.admit(now)
+		assert.True(t, ok)
+	}
+
+	ok, _ := a.admit(now)
+	assert.False(t, ok)
+
+	a.SetRate(0)
+	ok, _ = a.admit(now)
+	assert.True(t, ok)
+}
+
+func TestAdmission_Storm(t *testing.T) {
+	a := NewAdmission(10, nil)
+	now := a.last
+
+	// The burst of a second is admitted right away
+	for i := 0; i < 10; i++ {
+		ok, _ := a.admit(now)
+		assert.True(t, ok)
+	}
+
+	// The rest of the storm is throttled, with delays growing along with the backlog
+	for i := 0; i < 100; i++ {
+		ok, delay := a.admit(now)
+		assert.False(t, ok)
+		assert.True(t, delay >= minRetryAfter && delay <= minRetryAfter+time.Duration(i+1)*100*time.Millisecond, delay.String())
+	}
+	assert.Equal(t, 100, a.Backlog())
+
+	// The backlog drains at the admitted rate
+	ok, _ := a.admit(now.Add(5 * time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, 50, a.Backlog())
+
+	ok, _ = a.admit(now.Add(time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, 0, a.Backlog())
+}
+
+func TestAdmission_Overload(t *testing.T) {
+	g := &Guard{threshold: 100 * time.Millisecond, lag: int64(time.Second)}
+	a := NewAdmission(80, g)
+	assert.Equal(t, 10.0, a.admitted())
+
+	g.lag = 0
+	assert.Equal(t, 80.0, a.admitted())
+}
+
+func TestAdmission_MaxRetry(t *testing.T) {
+	a := NewAdmission(1, nil)
+	now := a.last
+	a.admit(now)
+	for i := 0; i < 1000; i++ {
+		_, delay := a.admit(now)
+		assert.True(t, delay <= maxRetryAfter)
+	}
+}
@@ -0,0 +1,176 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package overload
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	descriptorInterval = time.Second // The interval at which the descriptors are counted.
+	recoveryMargin     = 0.05        // The share of the limit to free before accepting again.
+)
+
+// Notify is called when the file descriptors become exhausted or are available again, along
+// with the number of descriptors used and their limit, which are zero when not counted.
+type Notify func(exhausted bool, used, limit int)
+
+// Descriptors watches the number of file descriptors used by the process and reports them
+// as exhausted once they approach the limit, so that the new connections can be refused
+// before the process runs out of them and the cluster links or the storage start failing.
+type Descriptors struct {
+	exhausted uint32             // Whether the descriptors are exhausted or not.
+	threshold float64            // The share of the limit above which they are exhausted.
+	notify    Notify             // The function notified on the changes.
+	cancel    context.CancelFunc // The cancellation function.
+}
+
+// NewDescriptors creates a new watcher of the file descriptors, which are exhausted once
+// the specified share of the limit is used. If the threshold is zero or the descriptors
+// can not be counted on this platform, they are never reported as exhausted.
+func NewDescriptors(threshold float64, notify Notify) *Descriptors {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Descriptors{
+		threshold: threshold,
+		notify:    notify,
+		cancel:    cancel,
+	}
+
+	if _, _, ok := countDescriptors(); ok && threshold > 0 {
+		go d.measure(ctx)
+	}
+	return d
+}
+
+// measure periodically counts the descriptors used.
+func (d *Descriptors) measure(ctx context.Context) {
+	ticker := time.NewTicker(descriptorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if used, limit, ok := countDescriptors(); ok {
+				d.observe(used, limit)
+			}
+		}
+	}
+}
+
+// observe updates the state from the number of descriptors used. Once exhausted, the
+// descriptors only become available again when the usage fell below the threshold by a
+// margin, so the state does not flap while the connections come and go.
+func (d *Descriptors) observe(used, limit int) {
+	if limit <= 0 {
+		return
+	}
+
+	usage := float64(used) / float64(limit)
+	switch {
+	case usage >= d.threshold && atomic.CompareAndSwapUint32(&d.exhausted, 0, 1):
+		d.notifyChange(true, used, limit)
+	case usage < d.threshold-recoveryMargin && atomic.CompareAndSwapUint32(&d.exhausted, 1, 0):
+		d.notifyChange(false, used, limit)
+	}
+}
+
+// notifyChange notifies the change of the state, if anyone is interested.
+func (d *Descriptors) notifyChange(exhausted bool, used, limit int) {
+	if d.notify != nil {
+		d.notify(exhausted, used, limit)
+	}
+}
+
+// Exhaust reports the descriptors as exhausted right away, for example when accepting a
+// connection failed because the process ran out of them. They become available again
+// once the usage is counted below the threshold.
+func (d *Descriptors) Exhaust() {
+	if d.threshold > 0 && atomic.CompareAndSwapUint32(&d.exhausted, 0, 1) {
+		d.notifyChange(true, 0, 0)
+	}
+}
+
+// Exhausted returns whether the descriptors are exhausted and the new connections should
+// be refused.
+func (d *Descriptors) Exhausted() bool {
+	return atomic.LoadUint32(&d.exhausted) == 1
+}
+
+// Usage returns the number of file descriptors used by the process along with the number
+// it can use before the new connections are refused, if they can be counted.
+func (d *Descriptors) Usage() (used, allowed int, ok bool) {
+	used, limit, ok := countDescriptors()
+	if d.threshold <= 0 {
+		return used, limit, ok
+	}
+	return used, int(float64(limit) * d.threshold), ok
+}
+
+// Close stops counting the descriptors.
+func (d *Descriptors) Close() error {
+	d.cancel()
+	return nil
+}
+
+// ------------------------------------------------------------------------------------
+
+// countDescriptors returns the number of file descriptors used by the process and their
+// limit, if they can be determined.
+func countDescriptors() (int, int, bool) {
+	f, err := os.Open("/proc/self/limits")
+	if err != nil {
+		return 0, 0, false
+	}
+
+	defer f.Close()
+	limit, ok := parseLimits(f)
+	if !ok {
+		return 0, 0, false
+	}
+
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, 0, false
+	}
+
+	// Reading the directory uses a descriptor as well, as does the limits file
+	return len(fds) - 2, limit, true
+}
+
+// parseLimits parses the soft limit of the open files out of the content of /proc/self/limits.
+func parseLimits(r io.Reader) (int, bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "Max open files") {
+			fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+			if len(fields) < 1 {
+				return 0, false
+			}
+
+			limit, err := strconv.Atoi(fields[0])
+			return limit, err == nil
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,91 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package overload
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescriptors_Observe(t *testing.T) {
+	var changes []bool
+	d := &Descriptors{threshold: 0.9, notify: func(exhausted bool, used, limit int) {
+		changes = append(changes, exhausted)
+	}}
+
+	d.observe(800, 1000)
+	assert.False(t, d.Exhausted())
+
+	// Exhausted once the threshold is reached, and until the usage falls below the margin
+	d.observe(900, 1000)
+	assert.True(t, d.Exhausted())
+	d.observe(860, 1000)
+	assert.True(t, d.Exhausted())
+	d.observe(849, 1000)
+	assert.False(t, d.Exhausted())
+
+	// Exhausted right away when the process ran out of descriptors
+	d.Exhaust()
+	assert.True(t, d.Exhausted())
+	d.observe(100, 1000)
+	assert.False(t, d.Exhausted())
+	assert.Equal(t, []bool{true, false, true, false}, changes)
+}
+
+func TestDescriptors_Disabled(t *testing.T) {
+	d := NewDescriptors(0, nil)
+	defer d.Close()
+
+	d.Exhaust()
+	assert.False(t, d.Exhausted())
+}
+
+func TestDescriptors_Count(t *testing.T) {
+	if used, limit, ok := countDescriptors(); ok {
+		assert.True(t, used > 0)
+		assert.True(t, limit >= used)
+	}
+}
+
+func TestDescriptors_Usage(t *testing.T) {
+	d := NewDescriptors(0.5, nil)
+	defer d.Close()
+
+	if used, allowed, ok := d.Usage(); ok {
+		_, limit, _ := countDescriptors()
+		assert.True(t, used > 0)
+		assert.Equal(t, limit/2, allowed)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		input string
+		limit int
+		ok    bool
+	}{
+		{input: "Max cpu time              unlimited            unlimited            seconds\nMax open files            1024                 524288               files", limit: 1024, ok: true},
+		{input: "Max open files            unlimited            unlimited            files", ok: false},
+		{input: "Max cpu time              unlimited            unlimited            seconds", ok: false},
+	}
+
+	for _, tc := range tests {
+		limit, ok := parseLimits(strings.NewReader(tc.input))
+		assert.Equal(t, tc.limit, limit)
+		assert.Equal(t, tc.ok, ok)
+	}
+}
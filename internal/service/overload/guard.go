@@ -0,0 +1,114 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package overload
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// The priorities of the work which can be shed, the lowest priority work is shed first.
+const (
+	PriorityHistory  = uint8(1) // History queries, shed once the lag exceeds the threshold.
+	PriorityPresence = uint8(2) // Presence queries, shed once the lag exceeds twice the threshold.
+	PriorityLow      = uint8(3) // Low-priority publishes, shed once the lag exceeds 4x the threshold.
+)
+
+const (
+	sampleInterval = 50 * time.Millisecond // The interval at which the lag is sampled.
+	smoothing      = 0.25                  // The weight of the latest sample in the moving average.
+)
+
+// Guard measures the scheduler lag of the node and sheds the low priority work when the
+// lag exceeds the configured threshold, keeping the message delivery alive during an
+// overload.
+type Guard struct {
+	lag       int64              // The smoothed scheduler lag, in nanoseconds.
+	threshold time.Duration      // The lag above which the work starts being shed.
+	cancel    context.CancelFunc // The cancellation function.
+}
+
+// New creates a new guard with the specified lag threshold. If the threshold is zero,
+// the guard never sheds any work.
+func New(threshold time.Duration) *Guard {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &Guard{
+		threshold: threshold,
+		cancel:    cancel,
+	}
+
+	if threshold > 0 {
+		go g.measure(ctx)
+	}
+	return g
+}
+
+// measure periodically samples the scheduler lag, which is the extra time it took for a
+// sleeping goroutine to be scheduled again.
+func (g *Guard) measure(ctx context.Context) {
+	for {
+		start := time.Now()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sampleInterval):
+			g.observe(time.Since(start) - sampleInterval)
+		}
+	}
+}
+
+// observe adds a lag sample to the moving average.
+func (g *Guard) observe(sample time.Duration) {
+	if sample < 0 {
+		sample = 0
+	}
+
+	lag := time.Duration(atomic.LoadInt64(&g.lag))
+	lag = time.Duration(smoothing*float64(sample) + (1-smoothing)*float64(lag))
+	atomic.StoreInt64(&g.lag, int64(lag))
+}
+
+// Lag returns the current smoothed scheduler lag.
+func (g *Guard) Lag() time.Duration {
+	return time.Duration(atomic.LoadInt64(&g.lag))
+}
+
+// Level returns the current overload level, from zero (not overloaded) to the highest
+// priority which is currently being shed.
+func (g *Guard) Level() uint8 {
+	lag := g.Lag()
+	switch {
+	case g.threshold <= 0 || lag < g.threshold:
+		return 0
+	case lag < 2*g.threshold:
+		return PriorityHistory
+	case lag < 4*g.threshold:
+		return PriorityPresence
+	default:
+		return PriorityLow
+	}
+}
+
+// Shed returns whether the work of the specified priority should be rejected.
+func (g *Guard) Shed(priority uint8) bool {
+	return g.Level() >= priority
+}
+
+// Close stops measuring the lag.
+func (g *Guard) Close() error {
+	g.cancel()
+	return nil
+}
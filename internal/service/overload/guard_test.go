@@ -0,0 +1,72 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package overload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuard_Level(t *testing.T) {
+	tests := []struct {
+		lag   time.Duration
+		level uint8
+	}{
+		{lag: 0, level: 0},
+		{lag: 99 * time.Millisecond, level: 0},
+		{lag: 100 * time.Millisecond, level: PriorityHistory},
+		{lag: 250 * time.Millisecond, level: PriorityPresence},
+		{lag: time.Second, level: PriorityLow},
+	}
+
+	for _, tc := range tests {
+		g := &Guard{threshold: 100 * time.Millisecond, lag: int64(tc.lag)}
+		assert.Equal(t, tc.level, g.Level(), tc.lag.String())
+		assert.Equal(t, tc.level >= PriorityHistory, g.Shed(PriorityHistory))
+		assert.Equal(t, tc.level >= PriorityLow, g.Shed(PriorityLow))
+	}
+}
+
+func TestGuard_Disabled(t *testing.T) {
+	g := New(0)
+	defer g.Close()
+
+	g.observe(time.Hour)
+	assert.Equal(t, uint8(0), g.Level())
+	assert.False(t, g.Shed(PriorityHistory))
+}
+
+func TestGuard_Observe(t *testing.T) {
+	g := &Guard{threshold: time.Millisecond}
+	for i := 0; i < 50; i++ {
+		g.observe(10 * time.Millisecond)
+	}
+
+	assert.InDelta(t, float64(10*time.Millisecond), float64(g.Lag()), float64(time.Millisecond))
+	assert.Equal(t, PriorityLow, g.Level())
+
+	g.observe(-time.Second)
+	assert.True(t, g.Lag() > 0)
+}
+
+func TestGuard_Measure(t *testing.T) {
+	g := New(time.Hour)
+	defer g.Close()
+
+	time.Sleep(3 * sampleInterval)
+	assert.Equal(t, uint8(0), g.Level())
+}
@@ -0,0 +1,480 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package plugins
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/emitter-io/emitter/pkg/plugin"
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+)
+
+const (
+	superviseInterval = time.Second // The interval at which the plugins are checked for having exited.
+	maxBackoff        = time.Minute // The longest delay before a plugin which exited is restarted.
+)
+
+var (
+	errNoName   = fmt.Errorf("plugins: the name and the path of each plugin must be specified")
+	errChecksum = fmt.Errorf("plugins: the checksum of a plugin must be a hex-encoded SHA-256")
+	errStopped  = fmt.Errorf("plugins: the plugin is not running")
+)
+
+// The kinds of plugins dispensed, in the order they are looked up.
+var kinds = []string{plugin.KindAuthorizer, plugin.KindStore, plugin.KindConnector, plugin.KindHook}
+
+// Service implements the Transformer contract.
+var _ service.Transformer = new(Service)
+
+// Service represents the plugins extending the broker, which are external binaries started
+// along with it and restarted whenever they exit. Each plugin serves any of an authorizer, a
+// store, a connector and a hook.
+type Service struct {
+	sync.Mutex
+	processes   []*process                   // The processes of the plugins started.
+	closed      bool                         // Whether the plugins were stopped.
+	cancel      context.CancelFunc           // The cancellation of the supervision.
+	authorizers []*authorizer                // The authorizers, in the order configured.
+	hooks       []*hook                      // The hooks, in the order configured.
+	connectors  map[string]service.Connector // The connectors, by the name of their plugin.
+}
+
+// New starts the plugins configured and dispenses what each of them serves. The stores are
+// registered as storage backends, under the name of their plugin, which hence must not be
+// the name of another backend.
+func New(configs []config.PluginConfig) (*Service, error) {
+	s := &Service{
+		connectors: make(map[string]service.Connector),
+	}
+
+	for _, cfg := range configs {
+		if err := s.start(cfg); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	s.cancel = async.Repeat(context.Background(), superviseInterval, s.supervise)
+	return s, nil
+}
+
+// Len returns the number of plugins started.
+func (s *Service) Len() int {
+	return len(s.processes)
+}
+
+// start starts a plugin binary and dispenses the kinds of plugins it serves.
+func (s *Service) start(cfg config.PluginConfig) error {
+	if cfg.Name == "" || cfg.Path == "" {
+		return errNoName
+	}
+
+	// The name selects the store of the plugin, so it must not shadow a built-in backend
+	for _, p := range s.processes {
+		if p.cfg.Name == cfg.Name {
+			return fmt.Errorf("plugins: the name '%s' is used by several plugins", cfg.Name)
+		}
+	}
+
+	if storage.Registered(cfg.Name) {
+		return fmt.Errorf("plugins: the name '%s' is used by a storage backend", cfg.Name)
+	}
+
+	p := &process{cfg: cfg, started: time.Now()}
+	if err := p.start(); err != nil {
+		return err
+	}
+
+	s.processes = append(s.processes, p)
+	if err := s.add(p); err != nil {
+		return err
+	}
+
+	logging.LogTarget("plugins", "started "+cfg.Name, cfg.Path)
+	return nil
+}
+
+// add adds the implementations served by a plugin, by kind.
+func (s *Service) add(p *process) error {
+	if len(p.served) == 0 {
+		return fmt.Errorf("plugins: '%s' does not serve any plugin", p.cfg.Name)
+	}
+
+	if _, ok := p.served[plugin.KindAuthorizer].(plugin.Authorizer); ok {
+		s.authorizers = append(s.authorizers, &authorizer{proc: p})
+	}
+
+	if _, ok := p.served[plugin.KindStore].(plugin.Store); ok {
+		storage.Register(p.cfg.Name, func(service.Surveyor) storage.Storage {
+			return newStore(p)
+		})
+	}
+
+	if _, ok := p.served[plugin.KindConnector].(plugin.Connector); ok {
+		s.connectors[p.cfg.Name] = &connector{proc: p}
+	}
+
+	if _, ok := p.served[plugin.KindHook].(plugin.Hook); ok {
+		s.hooks = append(s.hooks, newHook(p))
+	}
+	return nil
+}
+
+// supervise restarts the plugins which have exited.
+func (s *Service) supervise() {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return
+	}
+
+	now := time.Now()
+	for _, p := range s.processes {
+		if p.exited() {
+			p.restart(now)
+		}
+	}
+}
+
+// Authorize checks whether the authorizers approve a request which was authorized by its
+// key. Since the plugins are trusted with the access, a failing authorizer denies it.
+func (s *Service) Authorize(contract uint32, channel []byte, permission uint8) bool {
+	req := &plugin.AuthRequest{
+		Contract:   contract,
+		Channel:    string(channel),
+		Permission: permission,
+	}
+
+	for _, a := range s.authorizers {
+		allowed, err := a.authorize(req)
+		if err != nil {
+			logging.LogError("plugins", "authorizing with "+a.proc.cfg.Name, err)
+			return false
+		}
+
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// Transform runs the hooks matching the channel of the message, which may alter its payload,
+// its time-to-live and its headers, or refuse it.
+func (s *Service) Transform(m *message.Message) *errors.Error {
+	var segments []string
+	for _, h := range s.hooks {
+		if segments == nil {
+			segments = security.SplitChannel(string(m.Channel))
+		}
+
+		if !h.matches(segments) {
+			continue
+		}
+
+		if err := h.run(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Connectors returns the connectors served by the plugins, by the name of their plugin.
+func (s *Service) Connectors() map[string]service.Connector {
+	return s.connectors
+}
+
+// Close stops the plugins.
+func (s *Service) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.closed = true
+	for _, p := range s.processes {
+		p.stop()
+	}
+	return nil
+}
+
+// ------------------------------------------------------------------------------------
+
+// process represents the binary of a plugin, which is restarted whenever it exits after a
+// delay doubling on every exit, unless it ran for long enough.
+type process struct {
+	sync.RWMutex
+	cfg      config.PluginConfig    // The configuration of the plugin.
+	client   *goplugin.Client       // The client of the binary, if started.
+	served   map[string]interface{} // The implementations served by the binary, by kind.
+	started  time.Time              // The time the binary was last started at.
+	failures int                    // The number of times the binary exited in a row.
+	retry    time.Time              // The time the binary is restarted at, once it exited.
+}
+
+// start starts the binary and dispenses the kinds of plugins it serves.
+func (p *process) start() error {
+	clientConfig := &goplugin.ClientConfig{
+		HandshakeConfig:  plugin.Handshake,
+		Plugins:          (*plugin.Set)(nil).Plugins(),
+		Cmd:              exec.Command(p.cfg.Path),
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolNetRPC},
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:  "plugin." + p.cfg.Name,
+			Level: hclog.Info,
+		}),
+	}
+
+	// Verify the binary before it is run, if its checksum is known
+	if p.cfg.Checksum != "" {
+		sum, err := hex.DecodeString(p.cfg.Checksum)
+		if err != nil || len(sum) != sha256.Size {
+			return errChecksum
+		}
+
+		clientConfig.SecureConfig = &goplugin.SecureConfig{
+			Checksum: sum,
+			Hash:     sha256.New(),
+		}
+	}
+
+	client := goplugin.NewClient(clientConfig)
+	conn, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return fmt.Errorf("plugins: unable to start '%s', %v", p.cfg.Name, err)
+	}
+
+	// A plugin only serves some of the kinds, the others failing to be dispensed
+	served := make(map[string]interface{}, len(kinds))
+	for _, kind := range kinds {
+		if raw, err := conn.Dispense(kind); err == nil {
+			served[kind] = raw
+		}
+	}
+
+	p.stop()
+	p.Lock()
+	p.client = client
+	p.served = served
+	p.Unlock()
+	return nil
+}
+
+// restart restarts the binary which exited, once the delay before its restart has elapsed.
+func (p *process) restart(now time.Time) {
+	if p.retry.IsZero() {
+		if now.Sub(p.started) >= maxBackoff {
+			p.failures = 0
+		}
+
+		p.failures++
+		p.retry = now.Add(backoffOf(p.failures))
+		logging.LogTarget("plugins", "exited "+p.cfg.Name, p.failures)
+		return
+	}
+
+	if now.Before(p.retry) {
+		return
+	}
+
+	// A binary failing to start is still seen as exited, and hence retried later
+	p.retry = time.Time{}
+	p.started = now
+	if err := p.start(); err != nil {
+		logging.LogError("plugins", "restarting "+p.cfg.Name, err)
+		return
+	}
+
+	logging.LogTarget("plugins", "restarted "+p.cfg.Name, p.cfg.Path)
+}
+
+// exited checks whether the binary was started and has exited since.
+func (p *process) exited() bool {
+	p.RLock()
+	defer p.RUnlock()
+	return p.client != nil && p.client.Exited()
+}
+
+// stop stops the binary, if started.
+func (p *process) stop() {
+	p.RLock()
+	defer p.RUnlock()
+	if p.client != nil {
+		p.client.Kill()
+	}
+}
+
+// get returns the implementation of a kind served by the binary, if any.
+func (p *process) get(kind string) interface{} {
+	p.RLock()
+	defer p.RUnlock()
+	return p.served[kind]
+}
+
+// backoffOf returns the delay before a binary which exited a number of times in a row is
+// restarted.
+func backoffOf(failures int) time.Duration {
+	if failures > 6 {
+		return maxBackoff
+	}
+
+	if delay := time.Second << (failures - 1); delay < maxBackoff {
+		return delay
+	}
+	return maxBackoff
+}
+
+// ------------------------------------------------------------------------------------
+
+// authorizer represents an authorizer served by a plugin.
+type authorizer struct {
+	proc *process // The plugin serving the authorizer.
+}
+
+// authorize asks the plugin whether the request is authorized.
+func (a *authorizer) authorize(req *plugin.AuthRequest) (bool, error) {
+	impl, ok := a.proc.get(plugin.KindAuthorizer).(plugin.Authorizer)
+	if !ok {
+		return false, errStopped
+	}
+	return impl.Authorize(req)
+}
+
+// connector represents a connector served by a plugin.
+type connector struct {
+	proc *process // The plugin serving the connector.
+}
+
+// Send sends the message to the plugin.
+func (c *connector) Send(m *message.Message) error {
+	impl, ok := c.proc.get(plugin.KindConnector).(plugin.Connector)
+	if !ok {
+		return errStopped
+	}
+	return impl.Send(messageOf(m))
+}
+
+// ------------------------------------------------------------------------------------
+
+// hook represents a hook served by a plugin, which runs on the messages published on some
+// channels.
+type hook struct {
+	proc     *process           // The plugin serving the hook.
+	patterns []security.Pattern // The channel patterns the hook runs on, all of them if empty.
+}
+
+// newHook creates a new hook served by a plugin.
+func newHook(p *process) *hook {
+	return &hook{
+		proc:     p,
+		patterns: security.ParsePatterns(p.cfg.Channels),
+	}
+}
+
+// matches checks whether the hook runs on the channel.
+func (h *hook) matches(channel []string) bool {
+	return len(h.patterns) == 0 || security.MatchAny(h.patterns, channel)
+}
+
+// run runs the hook on the message and applies its verdict.
+func (h *hook) run(m *message.Message) *errors.Error {
+	impl, ok := h.proc.get(plugin.KindHook).(plugin.Hook)
+	if !ok {
+		return h.onFailure(errStopped)
+	}
+
+	msg := messageOf(m)
+	if err := impl.OnPublish(msg); err != nil {
+		if rejection, ok := err.(*plugin.Rejection); ok {
+			refused := errors.ErrRejected.Copy()
+			if rejection.Reason != "" {
+				refused.Message = rejection.Reason
+			}
+			return refused
+		}
+
+		return h.onFailure(err)
+	}
+
+	// The headers are delivered as channel options and hence must be alphanumeric
+	if len(msg.Headers) > message.MaxHeaders {
+		return h.onFailure(fmt.Errorf("plugins: more than %d headers were set", message.MaxHeaders))
+	}
+
+	for k, v := range msg.Headers {
+		if !security.IsOption(k) || !security.IsOption(v) {
+			return h.onFailure(fmt.Errorf("plugins: the header '%s' is not alphanumeric", k))
+		}
+	}
+
+	m.Payload = msg.Payload
+	m.TTL = msg.TTL
+	m.Headers = nil
+	if len(msg.Headers) > 0 {
+		m.Headers = message.Headers(msg.Headers)
+	}
+	return nil
+}
+
+// onFailure occurs when the hook has failed, in which case the message is either published
+// unchanged or refused.
+func (h *hook) onFailure(err error) *errors.Error {
+	logging.LogError("plugins", "running the hook of "+h.proc.cfg.Name, err)
+	if h.proc.cfg.FailOpen {
+		return nil
+	}
+	return errors.ErrServerError
+}
+
+// ------------------------------------------------------------------------------------
+
+// messageOf converts a message to the one passed to the plugins.
+func messageOf(m *message.Message) *plugin.Message {
+	var headers map[string]string
+	if len(m.Headers) > 0 {
+		headers = make(map[string]string, len(m.Headers))
+		for k, v := range m.Headers {
+			headers[k] = v
+		}
+	}
+
+	return &plugin.Message{
+		ID:       m.ID,
+		Ssid:     m.Ssid(),
+		Contract: m.Contract(),
+		Channel:  string(m.Channel),
+		Payload:  m.Payload,
+		TTL:      m.TTL,
+		Headers:  headers,
+		Time:     m.Time(),
+	}
+}
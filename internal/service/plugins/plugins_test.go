@@ -0,0 +1,280 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package plugins
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/emitter-io/emitter/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPlugin implements all of the kinds of plugins.
+type testPlugin struct {
+	sync.Mutex
+	allowed  bool                        // Whether the requests are authorized.
+	err      error                       // The error returned, if any.
+	verdict  func(*plugin.Message) error // The verdict of the hook, if any.
+	messages []plugin.Message            // The messages stored or sent.
+}
+
+func (p *testPlugin) Authorize(req *plugin.AuthRequest) (bool, error) {
+	return p.allowed, p.err
+}
+
+func (p *testPlugin) Configure(config map[string]interface{}) error {
+	return p.err
+}
+
+func (p *testPlugin) Store(m *plugin.Message) error {
+	p.Lock()
+	defer p.Unlock()
+	p.messages = append(p.messages, *m)
+	return p.err
+}
+
+func (p *testPlugin) Query(q *plugin.Query) (out []plugin.Message, err error) {
+	p.Lock()
+	defer p.Unlock()
+	for _, m := range p.messages {
+		if q.Matches(&m) {
+			out = append(out, m)
+		}
+	}
+	return out, p.err
+}
+
+func (p *testPlugin) Delete(q *plugin.Query) error {
+	p.Lock()
+	defer p.Unlock()
+	p.messages = p.messages[:0]
+	return p.err
+}
+
+func (p *testPlugin) Send(m *plugin.Message) error {
+	return p.Store(m)
+}
+
+func (p *testPlugin) OnPublish(m *plugin.Message) error {
+	if p.verdict != nil {
+		return p.verdict(m)
+	}
+	return p.err
+}
+
+func newTestService(t *testing.T, cfg config.PluginConfig, p *testPlugin) *Service {
+	s := &Service{connectors: make(map[string]service.Connector)}
+	assert.NoError(t, s.add(&process{cfg: cfg, served: map[string]interface{}{
+		plugin.KindAuthorizer: p,
+		plugin.KindStore:      p,
+		plugin.KindConnector:  p,
+		plugin.KindHook:       p,
+	}}))
+	return s
+}
+
+func newTestMessage(channel, payload string) *message.Message {
+	ssid := message.NewSsid(1, security.MakeChannel("key", channel).Query)
+	return message.New(ssid, []byte(channel), []byte(payload))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []config.PluginConfig{
+		{Path: "plugin"},
+		{Name: "plugin"},
+		{Name: "plugin", Path: "plugin", Checksum: "abc"},
+		{Name: "plugin", Path: "/does/not/exist"},
+		{Name: "ssd", Path: "plugin"},
+		{Name: "inmemory", Path: "plugin"},
+	}
+
+	for _, tc := range tests {
+		_, err := New([]config.PluginConfig{tc})
+		assert.Error(t, err)
+	}
+}
+
+func TestAdd_None(t *testing.T) {
+	s := new(Service)
+	assert.Error(t, s.add(&process{cfg: config.PluginConfig{Name: "none"}}))
+}
+
+func TestProcess_Restart(t *testing.T) {
+	p := &process{cfg: config.PluginConfig{Name: "crashed", Path: "/does/not/exist"}}
+	now := time.Now()
+
+	// The restart is delayed once the binary has exited
+	p.restart(now)
+	assert.Equal(t, 1, p.failures)
+	assert.Equal(t, now.Add(time.Second), p.retry)
+
+	p.restart(now.Add(500 * time.Millisecond))
+	assert.Equal(t, now.Add(time.Second), p.retry)
+
+	// The binary fails to start, and the next restart is delayed twice as long
+	p.restart(now.Add(time.Second))
+	assert.True(t, p.retry.IsZero())
+	assert.Nil(t, p.client)
+
+	p.restart(now.Add(2 * time.Second))
+	assert.Equal(t, 2, p.failures)
+	assert.Equal(t, now.Add(4*time.Second), p.retry)
+
+	// A binary which ran for long enough is restarted after the shortest delay
+	p.started, p.retry = now, time.Time{}
+	p.restart(now.Add(maxBackoff))
+	assert.Equal(t, 1, p.failures)
+}
+
+func TestBackoffOf(t *testing.T) {
+	assert.Equal(t, time.Second, backoffOf(1))
+	assert.Equal(t, 4*time.Second, backoffOf(3))
+	assert.Equal(t, 32*time.Second, backoffOf(6))
+	assert.Equal(t, maxBackoff, backoffOf(7))
+	assert.Equal(t, maxBackoff, backoffOf(100))
+}
+
+func TestStopped(t *testing.T) {
+	p := &testPlugin{allowed: true}
+	s := newTestService(t, config.PluginConfig{Name: "stopped"}, p)
+	s.authorizers[0].proc.served = nil
+
+	// A plugin which no longer serves its kinds fails them
+	assert.False(t, s.Authorize(1, []byte("a/"), plugin.PermissionRead))
+	assert.Equal(t, errStopped, s.Connectors()["stopped"].Send(newTestMessage("a/", "hello")))
+	assert.Equal(t, errors.ErrServerError, s.Transform(newTestMessage("a/", "hello")))
+	assert.Equal(t, errStopped, newStore(s.authorizers[0].proc).Store(newTestMessage("a/", "hello")))
+	assert.NoError(t, s.Close())
+}
+
+func TestAuthorize(t *testing.T) {
+	p := &testPlugin{allowed: true}
+	s := newTestService(t, config.PluginConfig{Name: "auth"}, p)
+	assert.True(t, s.Authorize(1, []byte("a/"), plugin.PermissionRead))
+
+	p.allowed = false
+	assert.False(t, s.Authorize(1, []byte("a/"), plugin.PermissionRead))
+
+	// A failing authorizer denies the request
+	p.allowed, p.err = true, fmt.Errorf("unreachable")
+	assert.False(t, s.Authorize(1, []byte("a/"), plugin.PermissionRead))
+
+	// Without any authorizer, the requests are not restricted
+	assert.True(t, new(Service).Authorize(1, []byte("a/"), plugin.PermissionRead))
+}
+
+func TestTransform(t *testing.T) {
+	p := &testPlugin{verdict: func(m *plugin.Message) error {
+		switch string(m.Payload) {
+		case "refuse":
+			return &plugin.Rejection{Reason: "not today"}
+		case "fail":
+			return fmt.Errorf("crashed")
+		case "bad":
+			m.Headers = map[string]string{"zone": "e-u"}
+			return nil
+		}
+
+		m.Payload = append(m.Payload, '!')
+		m.TTL = 30
+		m.Headers = map[string]string{"zone": "eu"}
+		return nil
+	}}
+
+	s := newTestService(t, config.PluginConfig{Name: "hook", Channels: "orders/"}, p)
+
+	// The message is altered by the hook
+	msg := newTestMessage("orders/eu/", "hello")
+	assert.Nil(t, s.Transform(msg))
+	assert.Equal(t, "hello!", string(msg.Payload))
+	assert.Equal(t, uint32(30), msg.TTL)
+	assert.Equal(t, message.Headers{"zone": "eu"}, msg.Headers)
+
+	// The hook only runs on the channels configured
+	msg = newTestMessage("other/", "hello")
+	assert.Nil(t, s.Transform(msg))
+	assert.Equal(t, "hello", string(msg.Payload))
+
+	// The message is refused with the reason given
+	err := s.Transform(newTestMessage("orders/", "refuse"))
+	assert.Equal(t, errors.ErrRejected.Status, err.Status)
+	assert.Equal(t, "not today", err.Message)
+
+	// A failing hook or invalid headers refuse the message
+	assert.Equal(t, errors.ErrServerError, s.Transform(newTestMessage("orders/", "fail")))
+	assert.Equal(t, errors.ErrServerError, s.Transform(newTestMessage("orders/", "bad")))
+
+	// Unless the hook fails open
+	s = newTestService(t, config.PluginConfig{Name: "hook", FailOpen: true}, p)
+	msg = newTestMessage("orders/", "bad")
+	assert.Nil(t, s.Transform(msg))
+	assert.Nil(t, msg.Headers)
+}
+
+func TestConnectors(t *testing.T) {
+	p := new(testPlugin)
+	s := newTestService(t, config.PluginConfig{Name: "kafka"}, p)
+
+	connector, ok := s.Connectors()["kafka"]
+	assert.True(t, ok)
+	assert.NoError(t, connector.Send(newTestMessage("orders/", "hello")))
+	assert.Len(t, p.messages, 1)
+	assert.Equal(t, "orders/", p.messages[0].Channel)
+	assert.Equal(t, uint32(1), p.messages[0].Contract)
+}
+
+func TestStore(t *testing.T) {
+	p := new(testPlugin)
+	newTestService(t, config.PluginConfig{Name: "teststore"}, p)
+
+	// The store is registered as a storage backend
+	var store storage.Storage
+	for _, provider := range storage.Providers(nil) {
+		if provider.Name() == "teststore" {
+			store = provider.(storage.Storage)
+		}
+	}
+
+	assert.NotNil(t, store)
+	assert.NoError(t, store.Configure(nil))
+	for i := 0; i < 3; i++ {
+		msg := newTestMessage("a/b/", fmt.Sprintf("%d", i))
+		msg.TTL = 60
+		assert.NoError(t, store.Store(msg))
+	}
+	assert.NoError(t, store.Store(newTestMessage("c/", "other")))
+	assert.NotZero(t, p.messages[0].Expires)
+
+	ssid := message.NewSsid(1, security.MakeChannel("key", "a/").Query)
+	frame, err := store.Query(ssid, time.Unix(0, 0), time.Unix(0, 0), 2)
+	assert.NoError(t, err)
+	assert.Len(t, frame, 2)
+	assert.Equal(t, "a/b/", string(frame[0].Channel))
+	assert.Equal(t, uint32(60), frame[0].TTL)
+
+	assert.NoError(t, store.Delete(ssid, time.Unix(0, 0), time.Unix(0, 0)))
+	assert.Len(t, p.messages, 0)
+	assert.NoError(t, store.GC())
+	assert.NoError(t, store.Close())
+}
@@ -0,0 +1,143 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package plugins
+
+import (
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/pkg/plugin"
+)
+
+// store implements the Storage contract.
+var _ storage.Storage = new(store)
+
+// store represents a store served by a plugin, used as the storage of the broker.
+type store struct {
+	proc *process // The plugin serving the store.
+}
+
+// newStore creates a new storage backed by the store served by a plugin.
+func newStore(p *process) *store {
+	return &store{
+		proc: p,
+	}
+}
+
+// Name returns the name of the provider.
+func (s *store) Name() string {
+	return s.proc.cfg.Name
+}
+
+// impl returns the store served by the plugin, which changes when the plugin is restarted.
+func (s *store) impl() (plugin.Store, error) {
+	impl, ok := s.proc.get(plugin.KindStore).(plugin.Store)
+	if !ok {
+		return nil, errStopped
+	}
+	return impl, nil
+}
+
+// Configure passes the configuration of the storage provider to the plugin.
+func (s *store) Configure(config map[string]interface{}) error {
+	impl, err := s.impl()
+	if err != nil {
+		return err
+	}
+	return impl.Configure(config)
+}
+
+// Store stores the message in the plugin, along with the time it expires.
+func (s *store) Store(m *message.Message) error {
+	impl, err := s.impl()
+	if err != nil {
+		return err
+	}
+
+	msg := messageOf(m)
+	msg.Expires = m.Expires().Unix()
+	return impl.Store(msg)
+}
+
+// Query queries the messages of the plugin. The messages it returns are checked against the
+// query once more, so that a plugin can only return the messages it was asked for.
+func (s *store) Query(ssid message.Ssid, from, until time.Time, limit int) (message.Frame, error) {
+	impl, err := s.impl()
+	if err != nil {
+		return nil, err
+	}
+
+	q := queryOf(ssid, from, until)
+	q.Limit = limit
+
+	msgs, err := impl.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make(message.Frame, 0, len(msgs))
+	for _, m := range msgs {
+		if !message.ID(m.ID).Match(ssid, q.From, q.Until) {
+			continue
+		}
+
+		frame = append(frame, message.Message{
+			ID:      message.ID(m.ID),
+			Channel: []byte(m.Channel),
+			Payload: m.Payload,
+			TTL:     m.TTL,
+			Headers: message.Headers(m.Headers),
+		})
+	}
+
+	frame.Limit(limit)
+	return frame, nil
+}
+
+// Delete removes the messages matching the SSID within the time window from the plugin.
+func (s *store) Delete(ssid message.Ssid, from, until time.Time) error {
+	impl, err := s.impl()
+	if err != nil {
+		return err
+	}
+	return impl.Delete(queryOf(ssid, from, until))
+}
+
+// GC does nothing, since the plugin removes the expired messages itself.
+func (s *store) GC() error {
+	return nil
+}
+
+// Close does nothing, since the plugin is stopped along with the others.
+func (s *store) Close() error {
+	return nil
+}
+
+// queryOf converts a query to the one passed to the plugins, where a zero 'until' time means
+// that the window is not bounded.
+func queryOf(ssid message.Ssid, from, until time.Time) *plugin.Query {
+	q := &plugin.Query{
+		Ssid:  ssid,
+		From:  from.Unix(),
+		Until: until.Unix(),
+	}
+
+	if q.Until == 0 {
+		q.Until = int64(security.MaxTime)
+	}
+	return q
+}
@@ -0,0 +1,108 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package presence
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Limits of the metadata a client attaches to its presence, which is kept in memory for
+// every subscription and returned with every presence query.
+const (
+	MaxMetaFields = 8   // The maximum number of fields of the metadata.
+	MaxMetaSize   = 256 // The maximum size in bytes of the names and values of the fields.
+)
+
+// SplitUsername splits the username provided on connect into the name itself and the
+// metadata which follows it as options (e.g: 'alice?status=away&device=mobile').
+func SplitUsername(username string) (string, map[string]string) {
+	i := strings.IndexByte(username, '?')
+	if i < 0 {
+		return username, nil
+	}
+
+	values, err := url.ParseQuery(username[i+1:])
+	if err != nil || len(values) == 0 {
+		return username[:i], nil
+	}
+
+	meta := make(map[string]string, len(values))
+	for k, v := range values {
+		meta[k] = v[0]
+	}
+	return username[:i], LimitMeta(meta)
+}
+
+// JoinUsername joins the name and the metadata back into a username, the opposite of
+// what SplitUsername does.
+func JoinUsername(name string, meta map[string]string) string {
+	if len(meta) == 0 {
+		return name
+	}
+
+	values := make(url.Values, len(meta))
+	for k, v := range meta {
+		values.Set(k, v)
+	}
+	return name + "?" + values.Encode()
+}
+
+// MergeMeta merges the metadata of a subscription over the one of its connection and
+// returns the result within the limits.
+func MergeMeta(conn, sub map[string]string) map[string]string {
+	if len(sub) == 0 {
+		return conn
+	}
+
+	meta := make(map[string]string, len(conn)+len(sub))
+	for k, v := range conn {
+		meta[k] = v
+	}
+	for k, v := range sub {
+		meta[k] = v
+	}
+	return LimitMeta(meta)
+}
+
+// LimitMeta returns the metadata within the limits. The fields are kept in the order of
+// their names, dropping the ones which would exceed the limits.
+func LimitMeta(meta map[string]string) map[string]string {
+	size := 0
+	for k, v := range meta {
+		size += len(k) + len(v)
+	}
+
+	if len(meta) <= MaxMetaFields && size <= MaxMetaSize {
+		return meta
+	}
+
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	size = 0
+	limited := make(map[string]string, MaxMetaFields)
+	for _, k := range keys {
+		if n := len(k) + len(meta[k]); len(limited) < MaxMetaFields && size+n <= MaxMetaSize {
+			limited[k] = meta[k]
+			size += n
+		}
+	}
+	return limited
+}
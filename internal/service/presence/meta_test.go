@@ -0,0 +1,96 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package presence
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		name     string
+		meta     map[string]string
+	}{
+		{username: "alice", name: "alice"},
+		{username: "alice?", name: "alice"},
+		{username: "alice?status=away", name: "alice", meta: map[string]string{"status": "away"}},
+		{username: "alice?status=away&device=mobile&status=busy", name: "alice", meta: map[string]string{"status": "away", "device": "mobile"}},
+		{username: "?status=in%20a%20call", name: "", meta: map[string]string{"status": "in a call"}},
+		{username: "alice?status=%zz", name: "alice"},
+	}
+
+	for _, tc := range tests {
+		name, meta := SplitUsername(tc.username)
+		assert.Equal(t, tc.name, name, tc.username)
+		assert.Equal(t, tc.meta, meta, tc.username)
+	}
+}
+
+func TestJoinUsername(t *testing.T) {
+	assert.Equal(t, "alice", JoinUsername("alice", nil))
+
+	username := JoinUsername("alice", map[string]string{"status": "in a call", "device": "mobile"})
+	assert.Equal(t, "alice?device=mobile&status=in+a+call", username)
+
+	name, meta := SplitUsername(username)
+	assert.Equal(t, "alice", name)
+	assert.Equal(t, map[string]string{"status": "in a call", "device": "mobile"}, meta)
+}
+
+func TestMergeMeta(t *testing.T) {
+	conn := map[string]string{"status": "online", "device": "mobile"}
+	assert.Equal(t, conn, MergeMeta(conn, nil))
+	assert.Equal(t, map[string]string{"status": "away", "device": "mobile"},
+		MergeMeta(conn, map[string]string{"status": "away"}))
+	assert.Equal(t, map[string]string{"status": "away"},
+		MergeMeta(nil, map[string]string{"status": "away"}))
+}
+
+func TestLimitMeta(t *testing.T) {
+	fields := make(map[string]string)
+	for i := 0; i < MaxMetaFields+2; i++ {
+		fields["f"+strconv.Itoa(i)] = "v"
+	}
+
+	// Only the first fields by name are kept
+	limited := LimitMeta(fields)
+	assert.Len(t, limited, MaxMetaFields)
+	assert.NotContains(t, limited, "f8")
+	assert.NotContains(t, limited, "f9")
+
+	// The fields which would exceed the size are dropped
+	limited = LimitMeta(map[string]string{
+		"a": strings.Repeat("x", MaxMetaSize/2),
+		"b": strings.Repeat("x", MaxMetaSize),
+		"c": "small",
+	})
+	assert.Equal(t, []string{"a", "c"}, keysOf(limited))
+}
+
+// keysOf returns the sorted names of the fields.
+func keysOf(meta map[string]string) []string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
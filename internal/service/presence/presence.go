@@ -45,6 +45,11 @@ func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, b
 		return errors.ErrBadRequest, false
 	}
 
+	q, ok := msg.query()
+	if !ok {
+		return errors.ErrBadRequest, false
+	}
+
 	// Ensure we have trailing slash
 	if !strings.HasSuffix(msg.Channel, "/") {
 		msg.Channel = msg.Channel + "/"
@@ -84,11 +89,14 @@ func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, b
 
 	// If we requested a status, populate the slice via scatter/gather.
 	now := time.Now().UTC().Unix()
-	who := make([]Info, 0, 4)
 	if msg.Status {
 
 		// Gather local & cluster presence
-		who = append(who, s.getAllPresence(ssid)...)
+		who, err := s.getAllPresence(ssid, q)
+		if err != nil {
+			return err, false
+		}
+
 		return &Response{
 			Time:    now,
 			Event:   EventTypeStatus,
@@ -100,9 +108,15 @@ func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, b
 	return nil, true
 }
 
-// OnHTTP occurs when a new HTTP presence request is received.
+// OnHTTP occurs when a new HTTP presence request is received. A GET streams the changes
+// of the presence, while a POST returns the current presence.
 func (s *Service) OnHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
+	switch r.Method {
+	case "GET":
+		s.onStream(w, r)
+		return
+	case "POST":
+	default:
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
@@ -117,6 +131,12 @@ func (s *Service) OnHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
+	q, ok := msg.query()
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	// Ensure we have trailing slash
 	if !strings.HasSuffix(msg.Channel, "/") {
 		msg.Channel = msg.Channel + "/"
@@ -139,7 +159,12 @@ func (s *Service) OnHTTP(w http.ResponseWriter, r *http.Request) {
 	// Create the ssid for the presence
 	ssid := message.NewSsid(key.Contract(), channel.Query)
 	now := time.Now().UTC().Unix()
-	who := s.getAllPresence(ssid)
+	who, failure := s.getAllPresence(ssid, q)
+	if failure != nil {
+		w.WriteHeader(failure.Status)
+		return
+	}
+
 	resp, _ := json.Marshal(&Response{
 		Time:    now,
 		Event:   EventTypeStatus,
@@ -148,10 +148,11 @@ func TestPresence_OnHTTP(t *testing.T) {
 		request      *Request
 		expectStatus int
 		expectSubs   int
+		peers        int
 		code         int
 	}{
 		{
-			method: "GET",
+			method: "PUT",
 			code:   404,
 		},
 		{
@@ -183,12 +184,45 @@ func TestPresence_OnHTTP(t *testing.T) {
 				Channel: "a/b/c/",
 			},
 		},
+		{
+			method:   "POST",
+			contract: 1,
+			code:     400,
+			request: &Request{
+				Key:         "key",
+				Channel:     "a/b/c/",
+				Consistency: "linearizable",
+			},
+		},
+		{
+			method:       "POST",
+			contract:     1,
+			code:         200,
+			expectStatus: 5,
+			request: &Request{
+				Key:         "key",
+				Channel:     "a/b/c/",
+				Consistency: ConsistencyStrong,
+			},
+		},
+		{
+			method:   "POST",
+			contract: 1,
+			peers:    3,
+			code:     408,
+			request: &Request{
+				Key:         "key",
+				Channel:     "a/b/c/",
+				Consistency: ConsistencyStrong,
+			},
+		},
 	}
 
 	for _, tc := range tests {
 		users, _ := binary.Marshal([]Info{{ID: "user1"}, {ID: "user2"}})
 		survey := &fake.Surveyor{
-			Resp: [][]byte{users, users},
+			Resp:  [][]byte{users, users},
+			Peers: tc.peers,
 		}
 
 		pubsub := new(fake.PubSub)
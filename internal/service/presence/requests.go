@@ -22,12 +22,60 @@ import (
 	"github.com/emitter-io/emitter/internal/message"
 )
 
+// Limits of the time given to the peers to respond to a status query.
+const (
+	defaultTimeout = time.Second      // The default time given to the peers to respond.
+	maxTimeout     = 10 * time.Second // The maximum time given to the peers to respond.
+)
+
 // Request represents a presence request
 type Request struct {
-	Key     string `json:"key"`     // The channel key for this request.
-	Channel string `json:"channel"` // The target channel for this request.
-	Status  bool   `json:"status"`  // Specifies that a status response should be sent.
-	Changes *bool  `json:"changes"` // Specifies that the changes should be notified.
+	Key         string      `json:"key"`                   // The channel key for this request.
+	Channel     string      `json:"channel"`               // The target channel for this request.
+	Status      bool        `json:"status"`                // Specifies that a status response should be sent.
+	Changes     *bool       `json:"changes"`               // Specifies that the changes should be notified.
+	Consistency Consistency `json:"consistency,omitempty"` // The consistency of the status, "eventual" by default.
+	Timeout     int         `json:"timeout,omitempty"`     // The milliseconds given to the peers to respond.
+}
+
+// query returns the options of the status query, or false if they are invalid.
+func (r *Request) query() (query, bool) {
+	q := query{strong: r.Consistency == ConsistencyStrong, timeout: defaultTimeout}
+	if r.Consistency != "" && r.Consistency != ConsistencyEventual && !q.strong {
+		return q, false
+	}
+
+	switch {
+	case r.Timeout < 0:
+		return q, false
+	case r.Timeout > 0:
+		q.timeout = time.Duration(r.Timeout) * time.Millisecond
+		if q.timeout > maxTimeout {
+			q.timeout = maxTimeout
+		}
+	}
+	return q, true
+}
+
+// Consistency represents the consistency of the presence returned by a status query.
+type Consistency string
+
+// Various consistency modes
+const (
+	// ConsistencyEventual looks up the presence of the other nodes from the shared cache if
+	// there is one, which might lag behind, and otherwise returns the presence of the nodes
+	// which responded in time.
+	ConsistencyEventual = Consistency("eventual")
+
+	// ConsistencyStrong queries the presence of every other node live and fails with a
+	// timeout unless all of them responded in time.
+	ConsistencyStrong = Consistency("strong")
+)
+
+// query represents the options of a status query.
+type query struct {
+	strong  bool          // Whether every other node must respond to the query.
+	timeout time.Duration // The time given to the other nodes to respond.
 }
 
 // EventType represents a presence event type
@@ -60,8 +108,9 @@ func (r *Response) ForRequest(id uint16) {
 
 // Info represents a presence info for a single connection.
 type Info struct {
-	ID       string `json:"id"`                 // The subscriber ID.
-	Username string `json:"username,omitempty"` // The subscriber username set by client ID.
+	ID       string            `json:"id"`                 // The subscriber ID.
+	Username string            `json:"username,omitempty"` // The subscriber username set by client ID.
+	Meta     map[string]string `json:"meta,omitempty"`     // The metadata attached by the subscriber.
 }
 
 // ------------------------------------------------------------------------------------
@@ -87,6 +136,7 @@ func newNotification(event EventType, ev *event.Subscription, filter func(messag
 		Who: Info{
 			ID:       ev.ConnID(),
 			Username: string(ev.User),
+			Meta:     ev.Meta,
 		},
 	}
 }
@@ -16,6 +16,7 @@ package presence
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -25,3 +26,27 @@ func Test_Response(t *testing.T) {
 	res.ForRequest(1)
 	assert.Equal(t, 1, int(res.Request))
 }
+
+func TestRequest_Query(t *testing.T) {
+	tests := []struct {
+		request Request
+		query   query
+		ok      bool
+	}{
+		{request: Request{}, query: query{timeout: time.Second}, ok: true},
+		{request: Request{Consistency: ConsistencyEventual}, query: query{timeout: time.Second}, ok: true},
+		{request: Request{Consistency: ConsistencyStrong}, query: query{strong: true, timeout: time.Second}, ok: true},
+		{request: Request{Consistency: ConsistencyStrong, Timeout: 250}, query: query{strong: true, timeout: 250 * time.Millisecond}, ok: true},
+		{request: Request{Timeout: 60000}, query: query{timeout: 10 * time.Second}, ok: true},
+		{request: Request{Timeout: -1}},
+		{request: Request{Consistency: "linearizable"}},
+	}
+
+	for _, tc := range tests {
+		q, ok := tc.request.query()
+		assert.Equal(t, tc.ok, ok)
+		if tc.ok {
+			assert.Equal(t, tc.query, q)
+		}
+	}
+}
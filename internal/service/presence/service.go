@@ -16,14 +16,28 @@ package presence
 
 import (
 	"context"
-	"time"
 
+	"github.com/emitter-io/emitter/internal/errors"
 	"github.com/emitter-io/emitter/internal/message"
 	"github.com/emitter-io/emitter/internal/provider/logging"
 	"github.com/emitter-io/emitter/internal/service"
 	"github.com/kelindar/binary"
 )
 
+// Cache represents a presence store shared by all of the nodes, which allows a node to
+// look up the cluster-wide presence without surveying every other node.
+type Cache interface {
+	Track(ssid message.Ssid, who Info, present bool) error // Records the presence of a local subscriber.
+	Lookup(ssid message.Ssid) ([]Info, error)              // Returns the subscribers of the other nodes.
+}
+
+// CacheProvider represents a storage which can also be used to cache the presence.
+type CacheProvider interface {
+	Presence() Cache
+}
+
+// ------------------------------------------------------------------------------------
+
 // Service represents a publish service.
 type Service struct {
 	context context.Context    // The context for the service.
@@ -33,6 +47,7 @@ type Service struct {
 	pubsub  service.PubSub     // The pub/sub service to use.
 	survey  service.Surveyor   // The surveyor to use.
 	trie    *message.Trie      // The subscription matching trie.
+	cache   Cache              // The shared presence cache (optional).
 }
 
 // New creates a new publisher service.
@@ -52,6 +67,12 @@ func New(auth service.Authorizer, pubsub service.PubSub, survey service.Surveyor
 	return s
 }
 
+// UseCache makes the service track the presence in the shared cache and look up the
+// presence of the other nodes from it, instead of surveying them.
+func (s *Service) UseCache(cache Cache) {
+	s.cache = cache
+}
+
 // notifyPresenceChange sends out an event to notify when a client is subscribed/unsubscribed.
 func (s *Service) pollPresenceChange() {
 	go func() {
@@ -68,12 +89,25 @@ func (s *Service) pollPresenceChange() {
 
 // send sends out an event to notify when a client is subscribed/unsubscribed.
 func (s *Service) send(ev *Notification) {
+	s.track(ev)
 	channel := []byte("emitter/presence/") // TODO: avoid allocation
 	if encoded, ok := ev.Encode(); ok {
 		s.pubsub.Publish(message.New(ev.Ssid, channel, encoded), ev.filter)
 	}
 }
 
+// track records the presence change in the shared cache. The notifications with a filter
+// are the ones of the peers which went offline, their entries expire with the peer itself.
+func (s *Service) track(ev *Notification) {
+	if s.cache == nil || ev.filter != nil || ev.Event == EventTypeStatus {
+		return
+	}
+
+	if err := s.cache.Track(ev.Ssid, ev.Who, ev.Event == EventTypeSubscribe); err != nil {
+		logging.LogError("presence", "tracking presence", err)
+	}
+}
+
 // OnSurvey handles an incoming presence query.
 func (s *Service) OnSurvey(queryType string, payload []byte) ([]byte, bool) {
 	if queryType != "presence" {
@@ -101,12 +135,22 @@ func (s *Service) lookupPresence(ssid message.Ssid) []Info {
 			resp = append(resp, Info{
 				ID:       conn.ID(),
 				Username: conn.Username(),
+				Meta:     metaOf(conn, ssid),
 			})
 		}
 	}
 	return resp
 }
 
+// metaOf returns the presence metadata of a connection, which is the one attached to its
+// subscription to the channel if it subscribed to it directly.
+func metaOf(conn service.Conn, ssid message.Ssid) map[string]string {
+	if sub, ok := conn.Subscriptions().Get(ssid); ok && sub.Meta != nil {
+		return sub.Meta
+	}
+	return conn.Meta()
+}
+
 // Close closes gracefully the service.,
 func (s *Service) Close() {
 	if s.cancel != nil {
@@ -116,28 +160,58 @@ func (s *Service) Close() {
 
 // ------------------------------------------------------------------------------------
 
-func (s *Service) getClusterPresence(ssid message.Ssid) []Info {
+// getClusterPresence returns the presence of the other nodes. A strongly consistent query
+// always surveys the other nodes and fails unless every one of them responded in time.
+func (s *Service) getClusterPresence(ssid message.Ssid, q query) ([]Info, *errors.Error) {
+	if s.cache != nil && !q.strong {
+		who, err := s.cache.Lookup(message.NewSsidForPresence(ssid))
+		if err == nil {
+			return who, nil
+		}
+
+		// Fall back to the survey if the cache is unavailable
+		logging.LogError("presence", "looking up presence", err)
+	}
+
+	req, err := binary.Marshal(ssid)
+	if err != nil {
+		return nil, errors.ErrServerError
+	}
+
+	awaiter, err := s.survey.Query("presence", req)
+	if err != nil {
+		if q.strong {
+			logging.LogError("presence", "surveying presence", err)
+			return nil, errors.ErrServerError
+		}
+		return []Info{}, nil
+	}
+
+	// Wait for all presence updates to come back (or a deadline)
 	who := make([]Info, 0, 4)
-	if req, err := binary.Marshal(ssid); err == nil {
-		if awaiter, err := s.survey.Query("presence", req); err == nil {
-
-			// Wait for all presence updates to come back (or a deadline)
-			for _, resp := range awaiter.Gather(1000 * time.Millisecond) {
-				info := []Info{}
-				if err := binary.Unmarshal(resp, &info); err == nil {
-					//logging.LogTarget("query", "response gathered", info)
-					who = append(who, info...)
-				}
-			}
+	responses := awaiter.Gather(q.timeout)
+	for _, resp := range responses {
+		info := []Info{}
+		if err := binary.Unmarshal(resp, &info); err == nil {
+			//logging.LogTarget("query", "response gathered", info)
+			who = append(who, info...)
 		}
 	}
-	return who
+
+	if q.strong && len(responses) < awaiter.Expected() {
+		return nil, errors.ErrTimeout
+	}
+	return who, nil
 }
 
 func (s *Service) getLocalPresence(ssid message.Ssid) []Info {
 	return s.lookupPresence(ssid)
 }
 
-func (s *Service) getAllPresence(ssid message.Ssid) []Info {
-	return append(s.getLocalPresence(ssid), s.getClusterPresence(ssid)...)
+func (s *Service) getAllPresence(ssid message.Ssid, q query) ([]Info, *errors.Error) {
+	who, err := s.getClusterPresence(ssid, q)
+	if err != nil {
+		return nil, err
+	}
+	return append(s.getLocalPresence(ssid), who...), nil
 }
@@ -17,6 +17,7 @@ package presence
 import (
 	"testing"
 
+	"github.com/emitter-io/emitter/internal/errors"
 	"github.com/emitter-io/emitter/internal/event"
 	"github.com/emitter-io/emitter/internal/message"
 	"github.com/emitter-io/emitter/internal/service/fake"
@@ -64,6 +65,29 @@ func TestPresence_OnSurvey(t *testing.T) {
 	}
 }
 
+func TestPresence_lookupMeta(t *testing.T) {
+	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
+	pubsub := new(fake.PubSub)
+	conn1 := &fake.Conn{ConnID: 1, Metadata: map[string]string{"device": "mobile"}}
+	conn2 := &fake.Conn{ConnID: 2, Metadata: map[string]string{"device": "desktop"}}
+	pubsub.Subscribe(conn1, &event.Subscription{Ssid: ssid, Channel: nocopy.Bytes("a/b/c/")})
+	pubsub.Subscribe(conn2, &event.Subscription{Ssid: ssid, Channel: nocopy.Bytes("a/b/c/")})
+
+	// The metadata attached to the subscription is returned instead of the connection's
+	conn2.Subscriptions().SetMeta(ssid, map[string]string{"status": "away"})
+
+	s := New(new(fake.Authorizer), pubsub, new(fake.Surveyor), pubsub.Trie)
+	meta := make(map[string]map[string]string)
+	for _, who := range s.lookupPresence(ssid) {
+		meta[who.ID] = who.Meta
+	}
+
+	assert.Equal(t, map[string]map[string]string{
+		conn1.ID(): {"device": "mobile"},
+		conn2.ID(): {"status": "away"},
+	}, meta)
+}
+
 func TestPresence_Notify(t *testing.T) {
 	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
 	pubsub := new(fake.PubSub)
@@ -86,3 +110,93 @@ func TestPresence_Notify(t *testing.T) {
 	assert.Equal(t, 1, s.trie.Count())
 
 }
+
+// cache represents a presence cache which records the tracked presence.
+type cache struct {
+	tracked map[string]bool
+	others  []Info
+	err     error
+}
+
+func (c *cache) Track(ssid message.Ssid, who Info, present bool) error {
+	c.tracked[who.ID] = present
+	return c.err
+}
+
+func (c *cache) Lookup(ssid message.Ssid) ([]Info, error) {
+	return c.others, c.err
+}
+
+func TestPresence_Cache(t *testing.T) {
+	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
+	pubsub := new(fake.PubSub)
+	s := New(&fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}, pubsub, new(fake.Surveyor), pubsub.Trie)
+	defer s.Close()
+
+	c := &cache{
+		tracked: make(map[string]bool),
+		others:  []Info{{ID: "remote"}},
+	}
+	s.UseCache(c)
+
+	// Only the local changes are tracked
+	s.send(newNotification(EventTypeSubscribe, &event.Subscription{Ssid: ssid, Conn: 1}, nil))
+	s.send(newNotification(EventTypeUnsubscribe, &event.Subscription{Ssid: ssid, Conn: 2}, nil))
+	s.send(newNotification(EventTypeUnsubscribe, &event.Subscription{Ssid: ssid, Conn: 3}, func(message.Subscriber) bool {
+		return true
+	}))
+	assert.Len(t, c.tracked, 2)
+	assert.True(t, c.tracked[(&event.Subscription{Conn: 1}).ConnID()])
+
+	// The cluster presence comes from the cache
+	eventual := query{timeout: defaultTimeout}
+	who, err := s.getClusterPresence(ssid, eventual)
+	assert.Nil(t, err)
+	assert.Equal(t, []Info{{ID: "remote"}}, who)
+
+	// Unless the query is strongly consistent
+	who, err = s.getClusterPresence(ssid, query{strong: true, timeout: defaultTimeout})
+	assert.Nil(t, err)
+	assert.Empty(t, who)
+
+	// Falls back to the survey when the cache fails
+	c.err = errors.New("unavailable")
+	who, err = s.getClusterPresence(ssid, eventual)
+	assert.Nil(t, err)
+	assert.Empty(t, who)
+}
+
+func TestPresence_Consistency(t *testing.T) {
+	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
+	remote, _ := binary.Marshal([]Info{{ID: "remote"}})
+	survey := &fake.Surveyor{Resp: [][]byte{remote}, Peers: 2}
+	pubsub := new(fake.PubSub)
+	s := New(new(fake.Authorizer), pubsub, survey, pubsub.Trie)
+	defer s.Close()
+
+	// The presence of the peers which responded is returned
+	who, err := s.getClusterPresence(ssid, query{timeout: defaultTimeout})
+	assert.Nil(t, err)
+	assert.Equal(t, []Info{{ID: "remote"}}, who)
+
+	// Unless every peer must respond
+	who, err = s.getClusterPresence(ssid, query{strong: true, timeout: defaultTimeout})
+	assert.Equal(t, errors.ErrTimeout, err)
+	assert.Nil(t, who)
+
+	survey.Peers = 1
+	who, err = s.getClusterPresence(ssid, query{strong: true, timeout: defaultTimeout})
+	assert.Nil(t, err)
+	assert.Equal(t, []Info{{ID: "remote"}}, who)
+
+	// A failed survey fails the strongly consistent query only
+	survey.Err = errors.New("unavailable")
+	who, err = s.getClusterPresence(ssid, query{timeout: defaultTimeout})
+	assert.Nil(t, err)
+	assert.Empty(t, who)
+	_, err = s.getClusterPresence(ssid, query{strong: true, timeout: defaultTimeout})
+	assert.Equal(t, errors.ErrServerError, err)
+}
@@ -0,0 +1,184 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package presence
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+)
+
+const (
+	streamBuffer = 256              // The number of changes buffered for a slow stream.
+	pingInterval = 30 * time.Second // The interval of the comments keeping a stream open.
+)
+
+// onStream occurs when a new HTTP presence stream is requested. The presence of the channel
+// across the cluster is sent first, then each change as it happens, as server-sent events
+// until the client goes away. A client which falls too far behind is disconnected, so it
+// reconnects and starts again from the current presence.
+func (s *Service) onStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	// The status can be queried with a specific consistency and timeout
+	query := r.URL.Query()
+	msg := Request{Consistency: Consistency(query.Get("consistency"))}
+	if v := query.Get("timeout"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		msg.Timeout = n
+	}
+
+	q, ok := msg.query()
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	name := query.Get("channel")
+	if !strings.HasSuffix(name, "/") {
+		name = name + "/"
+	}
+
+	// Parse the channel and check the authorization and permissions
+	channel := security.ParseChannel([]byte(query.Get("key") + "/" + name))
+	if channel.ChannelType == security.ChannelInvalid {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	_, key, allowed := s.auth.Authorize(channel, security.AllowPresence)
+	if !allowed || key.HasPermission(security.AllowExtend) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Subscribe to the changes before gathering the presence, so none is missed
+	ssid := message.NewSsid(key.Contract(), channel.Query)
+	st := newStream()
+	ev := &event.Subscription{
+		Conn:    st.luid,
+		Ssid:    message.NewSsidForPresence(ssid),
+		Channel: channel.Channel,
+	}
+
+	s.pubsub.Subscribe(st, ev)
+	defer s.pubsub.Unsubscribe(st, ev)
+
+	var status []byte
+	if query.Get("status") != "false" {
+		who, err := s.getAllPresence(ssid, q)
+		if err != nil {
+			w.WriteHeader(err.Status)
+			return
+		}
+
+		status, _ = json.Marshal(&Response{
+			Time:    time.Now().UTC().Unix(),
+			Event:   EventTypeStatus,
+			Channel: name,
+			Who:     who,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if status != nil {
+		writeEvent(w, status)
+	}
+	flusher.Flush()
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-st.lagging:
+			return
+		case <-ping.C:
+			w.Write([]byte(": ping\n\n"))
+			flusher.Flush()
+		case m := <-st.changes:
+			writeEvent(w, m.Payload)
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes a server-sent event carrying a JSON payload.
+func writeEvent(w http.ResponseWriter, payload []byte) {
+	w.Write([]byte("data: "))
+	w.Write(payload)
+	w.Write([]byte("\n\n"))
+}
+
+// ------------------------------------------------------------------------------------
+
+// stream represents an HTTP client streaming the presence changes of a channel, which is
+// subscribed to them like a connection would.
+type stream struct {
+	luid    security.ID           // The locally unique id of the stream.
+	changes chan *message.Message // The changes to write to the client.
+	lagging chan struct{}         // Closed once the client falls behind.
+	lagged  uint32                // Whether the client fell behind.
+}
+
+// newStream creates a new presence stream.
+func newStream() *stream {
+	return &stream{
+		luid:    security.NewID(),
+		changes: make(chan *message.Message, streamBuffer),
+		lagging: make(chan struct{}),
+	}
+}
+
+// ID returns the unique identifier of the subsriber.
+func (st *stream) ID() string {
+	return st.luid.Unique(0, "presence")
+}
+
+// Type returns the type of the subscriber.
+func (st *stream) Type() message.SubscriberType {
+	return message.SubscriberDirect
+}
+
+// Send queues a change to be written to the client, without blocking the notifications of
+// the other subscribers if the client is slow.
+func (st *stream) Send(m *message.Message) error {
+	select {
+	case st.changes <- m:
+	default:
+		if atomic.CompareAndSwapUint32(&st.lagged, 0, 1) {
+			close(st.lagging)
+		}
+	}
+	return nil
+}
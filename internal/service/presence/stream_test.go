@@ -0,0 +1,127 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package presence
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/kelindar/binary"
+	"github.com/kelindar/binary/nocopy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresence_OnStream(t *testing.T) {
+	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
+	users, _ := binary.Marshal([]Info{{ID: "remote"}})
+	pubsub := new(fake.PubSub)
+	s := New(&fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+		Target:   "a/b/c/",
+	}, pubsub, &fake.Surveyor{Resp: [][]byte{users}}, pubsub.Trie)
+	defer s.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(s.OnHTTP))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/presence?key=key&channel=a/b/c")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// The current presence comes first
+	reader := bufio.NewReader(resp.Body)
+	var status Response
+	assert.NoError(t, json.Unmarshal(readEvent(t, reader), &status))
+	assert.Equal(t, EventTypeStatus, status.Event)
+	assert.Equal(t, "a/b/c/", status.Channel)
+	assert.Equal(t, []Info{{ID: "remote"}}, status.Who)
+
+	// Then the changes as they happen
+	s.Notify(EventTypeSubscribe, &event.Subscription{
+		Peer:    2,
+		Conn:    5,
+		Ssid:    ssid,
+		User:    nocopy.String("alice"),
+		Channel: nocopy.Bytes("a/b/c/"),
+	}, nil)
+
+	var change Notification
+	assert.NoError(t, json.Unmarshal(readEvent(t, reader), &change))
+	assert.Equal(t, EventTypeSubscribe, change.Event)
+	assert.Equal(t, "a/b/c/", change.Channel)
+	assert.Equal(t, "alice", change.Who.Username)
+}
+
+func TestPresence_OnStreamInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		auth  *fake.Authorizer
+		code  int
+	}{
+		{query: "channel=a/b/c/", auth: &fake.Authorizer{Success: true}, code: http.StatusBadRequest},
+		{query: "key=key&channel=a/b/c/", auth: &fake.Authorizer{}, code: http.StatusUnauthorized},
+	} {
+		s := New(tc.auth, new(fake.PubSub), new(fake.Surveyor), message.NewTrie())
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/presence?"+tc.query, nil)
+		s.OnHTTP(rr, req)
+		s.Close()
+		assert.Equal(t, tc.code, rr.Code)
+	}
+}
+
+func TestStream_Lagging(t *testing.T) {
+	st := newStream()
+	assert.NotEmpty(t, st.ID())
+	assert.Equal(t, message.SubscriberDirect, st.Type())
+
+	for i := 0; i < streamBuffer; i++ {
+		assert.NoError(t, st.Send(new(message.Message)))
+	}
+
+	select {
+	case <-st.lagging:
+		t.Fatal("the stream lagged too early")
+	default:
+	}
+
+	st.Send(new(message.Message))
+	st.Send(new(message.Message))
+	<-st.lagging
+}
+
+// readEvent reads the payload of the next server-sent event, skipping the comments.
+func readEvent(t *testing.T, reader *bufio.Reader) []byte {
+	for {
+		line, err := reader.ReadString('\n')
+		if !assert.NoError(t, err) {
+			return nil
+		}
+
+		if strings.HasPrefix(line, "data: ") {
+			return []byte(strings.TrimPrefix(strings.TrimSpace(line), "data: "))
+		}
+	}
+}
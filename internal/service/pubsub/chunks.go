@@ -0,0 +1,199 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+const (
+	minChunkSize = 128         // The minimum size of the chunks delivered, below which the chunking is not worth it.
+	maxChunkSize = 63 * 1024   // The maximum size of the chunks delivered, leaving room for the topic in a packet.
+	chunkTimeout = time.Minute // The time after which a message published in chunks is abandoned, if incomplete.
+	maxAssembled = 1000        // The maximum number of messages of a contract being reassembled at once.
+)
+
+// ChunksRequest represents a request to receive the large messages in chunks.
+type ChunksRequest struct {
+	Size int `json:"size"` // The size of the chunks, or zero to receive the messages whole.
+}
+
+// ChunksResponse represents a response to a chunks request.
+type ChunksResponse struct {
+	Request    uint16 `json:"req,omitempty"`        // The corresponding request ID.
+	Status     int    `json:"status"`               // The status of the response.
+	Size       int    `json:"size"`                 // The size of the chunks, or zero if disabled.
+	MaxSize    int    `json:"maxSize,omitempty"`    // The maximum size of a packet the client can publish.
+	MaxMessage int    `json:"maxMessage,omitempty"` // The maximum size of a message the client can publish in chunks.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *ChunksResponse) ForRequest(id uint16) {
+	r.Request = id
+}
+
+// UseChunks lets the connections receive the large messages in chunks, advertising the
+// maximum size of the packets they can publish. If the maximum size of a message is set,
+// the clients can also publish the messages of up to that size in chunks, which are
+// reassembled before being published.
+func (s *Service) UseChunks(maxSize, maxMessage int) {
+	s.maxSize = maxSize
+	if maxMessage > 0 {
+		s.chunks = newAssembler(maxMessage)
+	}
+}
+
+// OnChunksRequest handles a request to receive the messages larger than a size in chunks of
+// that size, for the clients which can not receive a packet as large as the message, such
+// as the devices downloading a firmware update.
+func (s *Service) OnChunksRequest(c service.Conn, payload []byte) (service.Response, bool) {
+	var request ChunksRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return errors.ErrBadRequest, false
+	}
+
+	if request.Size < 0 || request.Size > maxChunkSize || (request.Size > 0 && request.Size < minChunkSize) {
+		return errors.ErrBadRequest, false
+	}
+
+	c.EnableChunks(request.Size)
+	return &ChunksResponse{
+		Status:     200,
+		Size:       request.Size,
+		MaxSize:    s.maxSize,
+		MaxMessage: s.chunks.MaxSize(),
+	}, true
+}
+
+// ------------------------------------------------------------------------------------
+
+// assembler represents the large messages being published in chunks, which are reassembled
+// before being published as a whole.
+type assembler struct {
+	sync.Mutex
+	maxSize int                  // The maximum size of a reassembled message.
+	pending map[string]*assembly // The messages being reassembled, by publisher and identifier.
+	counts  map[uint32]int       // The number of messages being reassembled, by contract.
+}
+
+// assembly represents a message being reassembled.
+type assembly struct {
+	chunks   map[int][]byte // The chunks received so far, by position.
+	contract uint32         // The contract of the publisher.
+	parts    int            // The number of chunks of the message.
+	size     int            // The size of the chunks received.
+	expires  int64          // The unix time after which the message is abandoned.
+}
+
+// newAssembler creates a new assembler of the messages of up to the maximum size.
+func newAssembler(maxSize int) *assembler {
+	return &assembler{
+		maxSize: maxSize,
+		pending: make(map[string]*assembly),
+		counts:  make(map[uint32]int),
+	}
+}
+
+// MaxSize returns the maximum size of a reassembled message, or zero if the messages can not
+// be published in chunks.
+func (a *assembler) MaxSize() int {
+	if a == nil {
+		return 0
+	}
+	return a.maxSize
+}
+
+// Add adds a chunk of a message and returns the whole payload once all of its chunks were
+// received, or nil while some of them are still missing. The limit of the contract, if any,
+// is enforced as the chunks are received rather than once the message is whole. Since the
+// number of chunks is announced by the publisher, they are kept as they are received and a
+// message can not have more chunks than bytes, nor empty ones. The number of messages being
+// reassembled is limited by contract, so a single tenant can not hold up all of the others.
+func (a *assembler) Add(contract uint32, key string, part, parts int, chunk []byte, limit int) ([]byte, *errors.Error) {
+	a.Lock()
+	defer a.Unlock()
+
+	now := time.Now().Unix()
+	a.expire(now)
+
+	m, ok := a.pending[key]
+	switch {
+	case part < 1 || part > parts || parts > a.maxSize || len(chunk) == 0:
+		return nil, errors.ErrBadRequest
+	case !ok && a.counts[contract] >= maxAssembled:
+		return nil, errors.ErrOverloaded
+	case !ok:
+		m = &assembly{chunks: make(map[int][]byte), contract: contract, parts: parts}
+		a.pending[key] = m
+		a.counts[contract]++
+	case m.parts != parts:
+		a.remove(key, m)
+		return nil, errors.ErrBadRequest
+	}
+
+	// A chunk sent again replaces the one received before
+	m.size += len(chunk) - len(m.chunks[part])
+	m.chunks[part] = chunk
+	m.expires = now + int64(chunkTimeout/time.Second)
+	switch {
+	case m.size > a.maxSize:
+		a.remove(key, m)
+		return nil, errors.ErrPacketTooLarge.WithMaxSize(a.maxSize)
+	case limit > 0 && m.size > limit:
+		a.remove(key, m)
+		return nil, errors.ErrMessageTooLarge.WithMaxSize(limit)
+	}
+
+	if len(m.chunks) < parts {
+		return nil, nil
+	}
+
+	a.remove(key, m)
+	whole := make([]byte, 0, m.size)
+	for i := 1; i <= parts; i++ {
+		whole = append(whole, m.chunks[i]...)
+	}
+	return whole, nil
+}
+
+// Len returns the number of messages being reassembled.
+func (a *assembler) Len() int {
+	a.Lock()
+	defer a.Unlock()
+	return len(a.pending)
+}
+
+// expire abandons the messages whose chunks stopped coming, must be called under the lock.
+func (a *assembler) expire(now int64) {
+	for key, m := range a.pending {
+		if now > m.expires {
+			a.remove(key, m)
+		}
+	}
+}
+
+// remove removes a message being reassembled, must be called under the lock.
+func (a *assembler) remove(key string, m *assembly) {
+	delete(a.pending, key)
+	a.counts[m.contract]--
+	if a.counts[m.contract] == 0 {
+		delete(a.counts, m.contract)
+	}
+}
@@ -0,0 +1,169 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/kelindar/binary/nocopy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubSub_OnChunksRequest(t *testing.T) {
+	s, _ := newTestSubscriptions()
+	s.UseChunks(65536, 1<<20)
+	c := new(fake.Conn)
+
+	// Bad requests
+	for _, payload := range []string{"{", `{"size":-1}`, `{"size":10}`, `{"size":1000000}`} {
+		_, ok := s.OnChunksRequest(c, []byte(payload))
+		assert.False(t, ok, payload)
+		assert.Equal(t, 0, c.Chunks)
+	}
+
+	// Enable, then disable the chunking of the large messages
+	resp, ok := s.OnChunksRequest(c, []byte(`{"size":4096}`))
+	assert.True(t, ok)
+	assert.Equal(t, &ChunksResponse{Status: 200, Size: 4096, MaxSize: 65536, MaxMessage: 1 << 20}, resp)
+	assert.Equal(t, 4096, c.Chunks)
+
+	resp, ok = s.OnChunksRequest(c, []byte(`{"size":0}`))
+	assert.True(t, ok)
+	assert.Equal(t, 0, resp.(*ChunksResponse).Size)
+	assert.Equal(t, 0, c.Chunks)
+}
+
+func TestAssembler_Add(t *testing.T) {
+	a := newAssembler(10)
+
+	// The chunks can arrive in any order
+	whole, err := a.Add(1, "a", 2, 3, []byte("cd"), 0)
+	assert.Nil(t, err)
+	assert.Nil(t, whole)
+	whole, err = a.Add(1, "a", 1, 3, []byte("ab"), 0)
+	assert.Nil(t, err)
+	assert.Nil(t, whole)
+	whole, err = a.Add(1, "a", 3, 3, []byte("ef"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "abcdef", string(whole))
+	assert.Equal(t, 0, a.Len())
+
+	// The invalid chunks are refused
+	_, err = a.Add(1, "b", 0, 3, []byte("ab"), 0)
+	assert.Equal(t, errors.ErrBadRequest, err)
+	_, err = a.Add(1, "b", 1, 3, []byte("ab"), 0)
+	assert.Nil(t, err)
+	_, err = a.Add(1, "b", 2, 4, []byte("ab"), 0)
+	assert.Equal(t, errors.ErrBadRequest, err)
+	assert.Equal(t, 0, a.Len())
+
+	// A message can not have more chunks than the bytes of the largest message
+	_, err = a.Add(1, "b", 1, 4000000000, []byte("ab"), 0)
+	assert.Equal(t, errors.ErrBadRequest, err)
+	assert.Equal(t, 0, a.Len())
+
+	// The messages larger than the maximum are refused, advertising the maximum
+	_, err = a.Add(1, "c", 1, 2, []byte("abcdef"), 0)
+	assert.Nil(t, err)
+	_, err = a.Add(1, "c", 2, 2, []byte("ghijkl"), 0)
+	assert.Equal(t, 413, err.Status)
+	assert.Equal(t, 10, err.MaxSize)
+	assert.Equal(t, 0, a.Len())
+
+	// The limit of the contract is enforced as the chunks are received
+	_, err = a.Add(1, "e", 1, 2, []byte("abcdef"), 4)
+	assert.Equal(t, errors.ErrMessageTooLarge.Message, err.Message)
+	assert.Equal(t, 4, err.MaxSize)
+	assert.Equal(t, 0, a.Len())
+
+	// The empty chunks are refused
+	_, err = a.Add(1, "f", 1, 2, nil, 0)
+	assert.Equal(t, errors.ErrBadRequest, err)
+	assert.Equal(t, 0, a.Len())
+
+	// The incomplete messages are abandoned after a while
+	_, err = a.Add(1, "d", 1, 2, []byte("ab"), 0)
+	assert.Nil(t, err)
+	a.expire(time.Now().Add(2 * chunkTimeout).Unix())
+	assert.Equal(t, 0, a.Len())
+	assert.Empty(t, a.counts)
+}
+
+func TestAssembler_Limit(t *testing.T) {
+	a := newAssembler(10)
+	for i := 0; i < maxAssembled; i++ {
+		_, err := a.Add(1, strconv.Itoa(i), 1, 2, []byte("ab"), 0)
+		assert.Nil(t, err)
+	}
+
+	// A contract can not reassemble more messages at once, but the others still can
+	_, err := a.Add(1, "a", 1, 2, []byte("ab"), 0)
+	assert.Equal(t, errors.ErrOverloaded, err)
+	_, err = a.Add(2, "b", 1, 2, []byte("ab"), 0)
+	assert.Nil(t, err)
+
+	// Once one of its messages is whole, the contract can reassemble another one
+	whole, err := a.Add(1, "0", 2, 2, []byte("cd"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "abcd", string(whole))
+	_, err = a.Add(1, "a", 1, 2, []byte("ab"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, maxAssembled+1, a.Len())
+}
+
+func TestPubSub_PublishChunks(t *testing.T) {
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}
+
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	sub := new(fake.Conn)
+	s.Subscribe(sub, &event.Subscription{
+		Ssid:    message.Ssid{1, 3238259379, 500706888, 1027807523},
+		Channel: nocopy.Bytes("a/b/c/"),
+	})
+
+	publish := func(topic, payload string) *errors.Error {
+		return s.OnPublish(new(fake.Conn), &mqtt.Publish{
+			Topic:   []byte(topic),
+			Payload: []byte(payload),
+		})
+	}
+
+	// Without a maximum size, the messages can not be published in chunks
+	assert.Equal(t, errors.ErrNotImplemented, publish("key/a/b/c/?chunk=fw1&part=1&parts=2", "hello "))
+
+	// The message is only delivered once all of its chunks were received
+	s.UseChunks(65536, 1<<20)
+	c := new(fake.Conn)
+	for i, chunk := range []string{"hello ", "world"} {
+		assert.Nil(t, s.OnPublish(c, &mqtt.Publish{
+			Topic:   []byte("key/a/b/c/?chunk=fw1&part=" + string(rune('1'+i)) + "&parts=2"),
+			Payload: []byte(chunk),
+		}))
+	}
+
+	assert.Len(t, sub.Outgoing, 1)
+	assert.Equal(t, "hello world", string(sub.Outgoing[0].Payload))
+	assert.Equal(t, "a/b/c/", string(sub.Outgoing[0].Channel))
+}
@@ -0,0 +1,82 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+)
+
+// The reasons a message could not be delivered.
+const (
+	ReasonRejected = "rejected" // The message was rejected by the content scanner.
+	ReasonOverflow = "overflow" // The message overflowed the queue of an offline session.
+	ReasonExpired  = "expired"  // The offline session queueing the message expired.
+)
+
+// DeadLetter represents a message which could not be delivered, republished on the
+// dead-letter channel of its contract along with the reason.
+type DeadLetter struct {
+	Channel string          `json:"channel"`           // The channel of the message.
+	Time    int64           `json:"time"`              // The unix time of the message.
+	Reason  string          `json:"reason"`            // The reason the message could not be delivered.
+	Payload []byte          `json:"payload"`           // The payload of the message.
+	Headers message.Headers `json:"headers,omitempty"` // The headers of the message.
+}
+
+// deadLetter represents the configuration of the dead-letter channels.
+type deadLetter struct {
+	prefix string // The prefix of the dead-letter channels.
+	ttl    uint32 // The time-to-live of the dead letters, in seconds.
+}
+
+// DeadLetter republishes a message which could not be delivered on the dead-letter channel
+// of its contract, which is the original channel prefixed by the configured prefix (e.g:
+// "deadletter/sensor/1/"). The dead letters themselves are never dead-lettered again. Since
+// the messages are often dead-lettered while being delivered, by a task of the scheduler,
+// the dead letters are enqueued without waiting for room in the queue of the contract.
+func (s *Service) DeadLetter(m *message.Message, reason string) {
+	if s.dead == nil || strings.HasPrefix(string(m.Channel), s.dead.prefix) {
+		return
+	}
+
+	channel := security.ParseChannel([]byte("emitter/" + s.dead.prefix + string(m.Channel)))
+	if channel.ChannelType != security.ChannelStatic {
+		return
+	}
+
+	payload, err := json.Marshal(&DeadLetter{
+		Channel: string(m.Channel),
+		Time:    m.Time(),
+		Reason:  reason,
+		Payload: m.Payload,
+		Headers: m.Headers,
+	})
+	if err != nil {
+		return
+	}
+
+	msg := message.New(message.NewSsid(m.Contract(), channel.Query), channel.Channel, payload)
+	msg.TTL = s.dead.ttl
+	if msg.Stored() {
+		s.persistWith(s.sched.Enqueue, msg)
+	}
+
+	_, count := s.publishWith(s.sched.Enqueue, msg, nil)
+	s.notifier.NotifyPublish(msg, count)
+}
@@ -0,0 +1,80 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubSub_DeadLetter(t *testing.T) {
+	store := storage.NewInMemory(nil)
+	store.Configure(nil)
+	defer store.Close()
+
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}
+
+	s := New(auth, store, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	s.UseScanner(&fake.Scanner{Hold: true, Clean: false})
+	sub := new(fake.Conn)
+	ssid := message.NewSsid(1, security.ParseChannel([]byte("key/deadletter/")).Query)
+	s.Subscribe(sub, &event.Subscription{
+		Ssid:    ssid,
+		Channel: []byte("deadletter/"),
+	})
+
+	// Without the dead-letter channels, the rejected messages are silently dropped
+	publish := func() {
+		assert.Nil(t, s.OnPublish(new(fake.Conn), &mqtt.Publish{
+			Topic:   []byte("key/a/b/c/"),
+			Payload: []byte("hi"),
+		}))
+	}
+
+	publish()
+	assert.Empty(t, sub.Outgoing)
+
+	// The rejected messages are republished on the dead-letter channel
+	s.UseDeadLetter("deadletter", 3600)
+	publish()
+	assert.Len(t, sub.Outgoing, 1)
+	assert.Equal(t, "deadletter/a/b/c/", string(sub.Outgoing[0].Channel))
+
+	var letter DeadLetter
+	assert.NoError(t, json.Unmarshal(sub.Outgoing[0].Payload, &letter))
+	assert.Equal(t, "a/b/c/", letter.Channel)
+	assert.Equal(t, ReasonRejected, letter.Reason)
+	assert.Equal(t, "hi", string(letter.Payload))
+
+	msgs, err := store.Query(ssid, time.Unix(0, 0), time.Now(), 100)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+
+	// The dead letters are never dead-lettered again
+	s.DeadLetter(&sub.Outgoing[0], ReasonOverflow)
+	assert.Len(t, sub.Outgoing, 1)
+}
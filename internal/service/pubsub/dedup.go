@@ -0,0 +1,94 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/security"
+)
+
+// dedup represents a window of the message identifiers recently published on each channel,
+// which lets the retried publishes be dropped instead of being delivered twice.
+type dedup struct {
+	sync.Mutex
+	window   int64              // The number of seconds the identifiers are remembered for.
+	size     int                // The maximum number of identifiers remembered.
+	swept    int64              // The last time the stale identifiers were removed.
+	patterns []security.Pattern // The patterns of the deduplicated channels, all if empty.
+	seen     map[string]int64   // The time each identifier was last seen at.
+}
+
+// newDedup creates a new deduplication window for the comma-separated channel patterns.
+func newDedup(window time.Duration, size int, patterns string) *dedup {
+	d := &dedup{
+		window: int64(window / time.Second),
+		size:   size,
+		swept:  time.Now().Unix(),
+		seen:   make(map[string]int64),
+	}
+
+	d.patterns = security.ParsePatterns(patterns)
+	return d
+}
+
+// Duplicate records the identifier of a message published on a channel and returns whether
+// it is a retry of a message already published within the window. A message which is not
+// marked as a retry is only recorded, since its identifier might have been reused.
+func (d *dedup) Duplicate(contract uint32, channel []byte, id string, retry bool) bool {
+	if !d.matches(channel) {
+		return false
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	now := time.Now().Unix()
+	if now-d.swept > d.window || len(d.seen) >= d.size {
+		d.sweep(now)
+	}
+
+	key := strconv.FormatUint(uint64(contract), 10) + "/" + string(channel) + "?" + id
+	if t, ok := d.seen[key]; ok && retry && now-t <= d.window {
+		return true
+	}
+
+	// Once full, the identifiers are no longer recorded rather than dropping the messages
+	if len(d.seen) < d.size {
+		d.seen[key] = now
+	}
+	return false
+}
+
+// matches checks whether the messages published on the channel are deduplicated.
+func (d *dedup) matches(channel []byte) bool {
+	if len(d.patterns) == 0 {
+		return true
+	}
+
+	return security.MatchAny(d.patterns, security.SplitChannel(string(channel)))
+}
+
+// sweep removes the identifiers which are no longer within the window.
+func (d *dedup) sweep(now int64) {
+	for key, t := range d.seen {
+		if now-t > d.window {
+			delete(d.seen, key)
+		}
+	}
+	d.swept = now
+}
@@ -0,0 +1,62 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedup_Duplicate(t *testing.T) {
+	d := newDedup(time.Minute, 100, "")
+	assert.False(t, d.Duplicate(1, []byte("a/b/"), "1", true))
+	assert.True(t, d.Duplicate(1, []byte("a/b/"), "1", true))
+	assert.False(t, d.Duplicate(1, []byte("a/c/"), "1", true))
+	assert.False(t, d.Duplicate(2, []byte("a/b/"), "1", true))
+
+	// The messages which are not retries are only recorded
+	assert.False(t, d.Duplicate(1, []byte("a/b/"), "1", false))
+	assert.True(t, d.Duplicate(1, []byte("a/b/"), "1", true))
+}
+
+func TestDedup_Matches(t *testing.T) {
+	d := newDedup(time.Minute, 100, "orders/+/, payments/")
+	assert.False(t, d.Duplicate(1, []byte("orders/1/"), "x", false))
+	assert.True(t, d.Duplicate(1, []byte("orders/1/"), "x", true))
+	assert.False(t, d.Duplicate(1, []byte("payments/eu/"), "x", false))
+	assert.True(t, d.Duplicate(1, []byte("payments/eu/"), "x", true))
+	assert.False(t, d.Duplicate(1, []byte("other/"), "x", false))
+	assert.False(t, d.Duplicate(1, []byte("other/"), "x", true))
+	assert.False(t, d.Duplicate(1, []byte("orders/"), "x", true))
+}
+
+func TestDedup_Sweep(t *testing.T) {
+	d := newDedup(time.Minute, 10, "")
+	for i := 0; i < 20; i++ {
+		assert.False(t, d.Duplicate(1, []byte("a/"), fmt.Sprintf("%d", i), true))
+	}
+	assert.Len(t, d.seen, 10)
+
+	// Once expired, the identifiers are forgotten
+	for key := range d.seen {
+		d.seen[key] -= 120
+	}
+	d.sweep(time.Now().Unix())
+	assert.Len(t, d.seen, 0)
+	assert.False(t, d.Duplicate(1, []byte("a/"), "0", true))
+}
@@ -0,0 +1,56 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+// ExpiryRequest represents a request to be warned before the keys of the subscriptions expire.
+type ExpiryRequest struct {
+	Warn int `json:"warn"` // The number of minutes before the expiry to warn at, or zero to disable it.
+}
+
+// ExpiryResponse represents a response to an expiry request.
+type ExpiryResponse struct {
+	Request uint16 `json:"req,omitempty"` // The corresponding request ID.
+	Status  int    `json:"status"`        // The status of the response.
+	Warn    int    `json:"warn"`          // The number of minutes before the expiry to warn at.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *ExpiryResponse) ForRequest(id uint16) {
+	r.Request = id
+}
+
+// OnExpiryRequest handles a request to be warned on the 'emitter/expiry/' channel before the
+// keys the connection subscribed with expire, so the client can renew them and subscribe
+// again with the renewed keys, instead of finding out once it is refused.
+func (s *Service) OnExpiryRequest(c service.Conn, payload []byte) (service.Response, bool) {
+	var request ExpiryRequest
+	if err := json.Unmarshal(payload, &request); err != nil || request.Warn < 0 {
+		return errors.ErrBadRequest, false
+	}
+
+	c.WarnExpiry(time.Duration(request.Warn) * time.Minute)
+	return &ExpiryResponse{
+		Status: 200,
+		Warn:   request.Warn,
+	}, true
+}
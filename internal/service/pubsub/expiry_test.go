@@ -0,0 +1,46 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubSub_OnExpiryRequest(t *testing.T) {
+	s, _ := newTestSubscriptions()
+	c := new(fake.Conn)
+
+	// Bad requests
+	_, ok := s.OnExpiryRequest(c, []byte("{"))
+	assert.False(t, ok)
+	_, ok = s.OnExpiryRequest(c, []byte(`{"warn":-1}`))
+	assert.False(t, ok)
+	assert.Zero(t, c.Expiry)
+
+	// Enable, then disable the warnings
+	resp, ok := s.OnExpiryRequest(c, []byte(`{"warn":5}`))
+	assert.True(t, ok)
+	assert.Equal(t, 5, resp.(*ExpiryResponse).Warn)
+	assert.Equal(t, 5*time.Minute, c.Expiry)
+
+	resp, ok = s.OnExpiryRequest(c, []byte(`{"warn":0}`))
+	assert.True(t, ok)
+	assert.Equal(t, 0, resp.(*ExpiryResponse).Warn)
+	assert.Zero(t, c.Expiry)
+}
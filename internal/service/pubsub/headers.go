@@ -0,0 +1,55 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"encoding/json"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+// HeadersRequest represents a request to enable or disable the delivery of the headers.
+type HeadersRequest struct {
+	Enabled bool `json:"enabled"` // Whether the headers should be delivered or not.
+}
+
+// HeadersResponse represents a response to a headers request.
+type HeadersResponse struct {
+	Request uint16 `json:"req,omitempty"` // The corresponding request ID.
+	Status  int    `json:"status"`        // The status of the response.
+	Enabled bool   `json:"enabled"`       // Whether the headers are delivered or not.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *HeadersResponse) ForRequest(id uint16) {
+	r.Request = id
+}
+
+// OnHeadersRequest handles a request to enable or disable the delivery of the headers of
+// the messages to the connection. Since MQTT 3.1.1 has no message properties, the headers
+// are appended to the channel of the delivered messages as options (e.g: 'a/b/?h-trace=abc').
+func (s *Service) OnHeadersRequest(c service.Conn, payload []byte) (service.Response, bool) {
+	var request HeadersRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return errors.ErrBadRequest, false
+	}
+
+	c.EnableHeaders(request.Enabled)
+	return &HeadersResponse{
+		Status:  200,
+		Enabled: request.Enabled,
+	}, true
+}
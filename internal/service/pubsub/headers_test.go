@@ -0,0 +1,43 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubSub_OnHeadersRequest(t *testing.T) {
+	s, _ := newTestSubscriptions()
+	c := new(fake.Conn)
+
+	// Bad request
+	_, ok := s.OnHeadersRequest(c, []byte("{"))
+	assert.False(t, ok)
+	assert.False(t, c.Headers)
+
+	// Enable, then disable the delivery of the headers
+	resp, ok := s.OnHeadersRequest(c, []byte(`{"enabled":true}`))
+	assert.True(t, ok)
+	assert.True(t, resp.(*HeadersResponse).Enabled)
+	assert.True(t, c.Headers)
+
+	resp, ok = s.OnHeadersRequest(c, []byte(`{"enabled":false}`))
+	assert.True(t, ok)
+	assert.False(t, resp.(*HeadersResponse).Enabled)
+	assert.False(t, c.Headers)
+}
@@ -0,0 +1,66 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"sync"
+)
+
+// inflight represents the number of publishes of each connection which are still waiting to
+// be delivered, so that a single publisher cannot flood the delivery queue of its contract.
+type inflight struct {
+	sync.Mutex
+	counts map[string]int // The number of publishes in flight, per connection.
+}
+
+// newInflight creates a new inflight counter.
+func newInflight() *inflight {
+	return &inflight{
+		counts: make(map[string]int),
+	}
+}
+
+// Acquire counts a new publish of the connection and returns whether it stays within the
+// limit. A publish which is not acquired must not be released.
+func (f *inflight) Acquire(id string, limit int) bool {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.counts[id] >= limit {
+		return false
+	}
+
+	f.counts[id]++
+	return true
+}
+
+// Release releases a publish of the connection once it was delivered.
+func (f *inflight) Release(id string) {
+	f.Lock()
+	defer f.Unlock()
+
+	if n := f.counts[id] - 1; n > 0 {
+		f.counts[id] = n
+		return
+	}
+	delete(f.counts, id)
+}
+
+// Count returns the number of publishes of the connection in flight.
+func (f *inflight) Count(id string) int {
+	f.Lock()
+	defer f.Unlock()
+	return f.counts[id]
+}
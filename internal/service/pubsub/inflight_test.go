@@ -0,0 +1,40 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInflight(t *testing.T) {
+	f := newInflight()
+	assert.True(t, f.Acquire("a", 2))
+	assert.True(t, f.Acquire("a", 2))
+	assert.False(t, f.Acquire("a", 2))
+	assert.True(t, f.Acquire("b", 2))
+	assert.Equal(t, 2, f.Count("a"))
+
+	// Once released, the slots can be acquired again
+	f.Release("a")
+	assert.Equal(t, 1, f.Count("a"))
+	assert.True(t, f.Acquire("a", 2))
+
+	f.Release("a")
+	f.Release("a")
+	f.Release("b")
+	assert.Empty(t, f.counts)
+}
@@ -52,11 +52,12 @@ func (s *Service) OnLastWill(sub message.Subscriber, ev *event.Connection) bool
 
 	// Store the message if needed
 	if msg.Stored() && key.HasPermission(security.AllowStore) {
-		s.store.Store(msg)
+		s.persist(msg)
 	}
 
 	// Iterate through all subscribers and send them the message
-	size := s.Publish(msg, nil)
+	size, count := s.publish(msg, nil)
+	s.notifier.NotifyPublish(msg, count)
 
 	// Write the monitoring information
 	contract.Stats().AddIngress(int64(len(ev.WillMessage)))
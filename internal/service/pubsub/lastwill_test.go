@@ -116,7 +116,7 @@ func TestPubSub_LastWill(t *testing.T) {
 		}
 
 		// Issue a request
-		s := New(auth, store, notify, trie)
+		s := New(auth, store, notify, new(fake.Shedder), new(fake.Scheduler), trie)
 		sub := new(fake.Conn)
 		s.Subscribe(sub, &event.Subscription{
 			Peer:    2,
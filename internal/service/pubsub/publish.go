@@ -15,28 +15,139 @@
 package pubsub
 
 import (
+	"context"
 	"encoding/json"
+	"strconv"
+	"time"
+
 	"github.com/emitter-io/emitter/internal/errors"
 	"github.com/emitter-io/emitter/internal/message"
 	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	"github.com/emitter-io/emitter/internal/provider/tracing"
 	"github.com/emitter-io/emitter/internal/security"
 	"github.com/emitter-io/emitter/internal/service"
+	"github.com/emitter-io/emitter/internal/service/overload"
+	"github.com/emitter-io/emitter/internal/service/scan"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Publish publishes a message to everyone and returns the number of outgoing bytes written.
 func (s *Service) Publish(m *message.Message, filter func(message.Subscriber) bool) (n int64) {
+	n, _ = s.publish(m, filter)
+	return
+}
+
+// publish publishes a message to everyone and returns the number of outgoing bytes written
+// along with the number of subscribers the message was delivered to. The delivery itself
+// is scheduled on behalf of the contract of the message.
+func (s *Service) publish(m *message.Message, filter func(message.Subscriber) bool) (n int64, count int) {
+	return s.publishWith(s.sched.Schedule, m, filter)
+}
+
+// publishWith publishes a message to everyone, scheduling its delivery with the function.
+func (s *Service) publishWith(schedule func(uint32, func()), m *message.Message, filter func(message.Subscriber) bool) (n int64, count int) {
+	_, lookup := tracing.Continue(m, "lookup")
 	size := m.Size()
-	for _, subscriber := range s.trie.Lookup(m.Ssid(), filter) {
-		subscriber.Send(m)
+	subscribers := s.trie.LookupID(m.ID, filter)
+	for _, subscriber := range subscribers {
 		if subscriber.Type() == message.SubscriberDirect {
 			n += size
 		}
 	}
-	return
+	lookup.SetAttributes(attribute.Int("subscribers", len(subscribers)))
+	lookup.End()
+
+	if s.recent != nil {
+		s.recent.Add(m)
+	}
+
+	count = len(subscribers)
+	schedule(m.Contract(), func() {
+		ctx, deliver := tracing.Continue(m, "deliver")
+		for _, subscriber := range subscribers {
+			if subscriber.Type() == message.SubscriberRemote {
+				forward(ctx, subscriber, m)
+				continue
+			}
+			subscriber.Send(m)
+		}
+		deliver.End()
+		subscribers.Release()
+	})
+	return n, count
+}
+
+// forward sends the message to a remote subscriber, which forwards it to its peer.
+func forward(ctx context.Context, subscriber message.Subscriber, m *message.Message) {
+	_, span := tracing.Child(ctx, "forward", attribute.String("peer", subscriber.ID()))
+	subscriber.Send(m)
+	span.End()
+}
+
+// persist schedules the message to be stored on behalf of its contract.
+func (s *Service) persist(m *message.Message) {
+	s.persistWith(s.sched.Schedule, m)
+}
+
+// persistWith stores the message, scheduling it with the function.
+func (s *Service) persistWith(schedule func(uint32, func()), m *message.Message) {
+	schedule(m.Contract(), func() {
+		s.store.Store(m)
+	})
+}
+
+// publishScanned publishes a message whose content needs to be scanned. Depending on the
+// policy, the message is either held until found clean, or delivered right away and then
+// retracted with a tombstone if rejected. Either way, only the clean messages are stored.
+func (s *Service) publishScanned(contract contract.Contract, m *message.Message, stored bool, filter func(message.Subscriber) bool) {
+	if s.scanner.Holds() {
+		s.scanner.Scan(m, func(clean bool) {
+			if clean {
+				if stored {
+					s.persist(m)
+				}
+
+				size, count := s.publish(m, filter)
+				s.notifier.NotifyPublish(m, count)
+				contract.Stats().AddEgress(size)
+				return
+			}
+
+			s.DeadLetter(m, ReasonRejected)
+		})
+		return
+	}
+
+	size, count := s.publish(m, filter)
+	s.notifier.NotifyPublish(m, count)
+	contract.Stats().AddEgress(size)
+	s.scanner.Scan(m, func(clean bool) {
+		switch {
+		case clean && stored:
+			s.persist(m)
+		case !clean:
+			s.publish(scan.NewTombstone(m), filter)
+			s.DeadLetter(m, ReasonRejected)
+		}
+	})
+}
+
+// unaliased returns a copy of the channel without the 'alias' option, so that publishing on
+// the alias does not bind it again.
+func unaliased(channel *security.Channel) *security.Channel {
+	bound := *channel
+	bound.Options = make([]security.ChannelOption, 0, len(channel.Options))
+	for _, v := range channel.Options {
+		if v.Key != "alias" {
+			bound.Options = append(bound.Options, v)
+		}
+	}
+	return &bound
 }
 
 // OnPublish is a handler for MQTT Publish events.
-func (s *Service) OnPublish(c service.Conn, packet *mqtt.Publish) *errors.Error {
+func (s *Service) OnPublish(c service.Conn, packet *mqtt.Publish) (err *errors.Error) {
 	mqttTopic := c.GetLink(packet.Topic)
 
 	// Make sure we have a valid channel
@@ -56,8 +167,21 @@ func (s *Service) OnPublish(c service.Conn, packet *mqtt.Publish) *errors.Error
 		return nil
 	}
 
+	// Trace the publication, as a continuation of the trace of the publisher if it has
+	// specified one (e.g: 'h-traceparent=00-...')
+	ctx, span := tracing.Start(tracing.Extract(channel.Headers()), "publish",
+		attribute.String("channel", string(channel.Channel)))
+	defer func() { tracing.End(span, err) }()
+
+	// Low priority publishes are shed when the server is severely overloaded
+	if channel.LowPriority() && s.shedder.Shed(overload.PriorityLow) {
+		return errors.ErrOverloaded
+	}
+
 	// Check the authorization and permissions
+	_, auth := tracing.Start(ctx, "authorize")
 	contract, key, allowed := s.auth.Authorize(channel, security.AllowWrite)
+	auth.End()
 	if !allowed {
 		return errors.ErrUnauthorized
 	}
@@ -67,12 +191,40 @@ func (s *Service) OnPublish(c service.Conn, packet *mqtt.Publish) *errors.Error
 		return errors.ErrUnauthorizedExt
 	}
 
+	// Limit the number of publishes of the connection waiting to be delivered. The release is
+	// scheduled after the delivery, since the work of a contract is run in order.
+	if limit := contract.Limits().MaxInflight; limit > 0 {
+		self := c.ID()
+		if !s.inflight.Acquire(self, limit) {
+			return errors.ErrTooManyInflight
+		}
+		defer s.sched.Schedule(key.Contract(), func() {
+			s.inflight.Release(self)
+		})
+	}
+
+	// Bind the channel to the alias requested by the publisher (e.g: 'alias=t1'), so that its
+	// following messages can be published on the alias instead of the whole channel
+	if alias, ok := channel.Alias(); ok {
+		if len(alias) == 0 || len(alias) > 2 {
+			return errors.ErrLinkInvalid
+		}
+		c.AddLink(alias, unaliased(channel))
+	}
+
 	// Create a new message
-	msg := message.New(
-		message.NewSsid(key.Contract(), channel.Query),
-		channel.Channel,
-		packet.Payload,
-	)
+	msg := message.NewOf(key.Contract(), channel.Query, channel.Channel, packet.Payload)
+
+	// Attach the headers the publisher has specified (e.g: 'h-trace=abc')
+	if headers := channel.Headers(); len(headers) > 0 {
+		if len(headers) > message.MaxHeaders {
+			return errors.ErrBadRequest
+		}
+		msg.Headers = headers
+	}
+
+	// Carry the trace along with the message, so that the peers can continue it
+	tracing.Inject(ctx, msg)
 
 	// If a user have specified a retain flag, retain with a default TTL
 	if packet.Header.Retain {
@@ -84,29 +236,138 @@ func (s *Service) OnPublish(c service.Conn, packet *mqtt.Publish) *errors.Error
 		msg.TTL = uint32(ttl)
 	}
 
-	// Store the message if needed
-	if msg.Stored() && key.HasPermission(security.AllowStore) {
-		s.store.Store(msg)
-	}
-
-	// Check whether an exclude me option was set (i.e.: 'me=0')
-	var exclude string
-	if channel.Exclude() {
-		exclude = c.ID()
+	// Check whether an exclude me option was set (i.e.: 'me=0'), either on the message or on
+	// the subscriptions of the publisher it matches
+	self, exclude := c.ID(), channel.Exclude()
+	filter := func(s message.Subscriber) bool {
+		return s.ID() != self || (!exclude && c.Subscriptions().Echoes(msg.ID))
 	}
 
-	// Iterate through all subscribers and send them the message
-	size := s.Publish(msg, func(s message.Subscriber) bool {
-		return s.ID() != exclude
-	})
-
 	// Write the monitoring information
 	c.Track(contract)
 	contract.Stats().AddIngress(int64(len(packet.Payload)))
+
+	// Reassemble the large messages published in chunks (e.g: 'chunk=fw1&part=2&parts=8'),
+	// which are only published once all of their chunks were received
+	if id, part, parts, ok := channel.Chunk(); ok {
+		if s.chunks == nil {
+			return errors.ErrNotImplemented
+		}
+
+		whole, err := s.chunks.Add(key.Contract(), self+"/"+id+"/"+string(channel.Channel), part, parts, packet.Payload, contract.Limits().MaxMessageSize)
+		if err != nil || whole == nil {
+			return err
+		}
+		msg.Payload = whole
+	}
+
+	// Refuse the messages larger than the contract allows, such as the first one of a client
+	// which was not limited when it was decoded, since its contract was not known yet
+	if limit := contract.Limits().MaxMessageSize; limit > 0 && len(msg.Payload) > limit {
+		return errors.ErrMessageTooLarge.WithMaxSize(limit)
+	}
+
+	// Drop the retries of the messages which were already published
+	if s.dedup != nil && s.isDuplicate(c, key.Contract(), channel, packet) {
+		return nil
+	}
+
+	// Refuse the messages beyond the daily quota of the contract
+	if limit := contract.Limits().MaxDailyMessages; limit > 0 && !s.quota.Acquire(key.Contract(), limit, time.Now()) {
+		return errors.ErrQuotaExceeded
+	}
+
+	// Run the hooks, which may validate, transform or enrich the message, or refuse it
+	for _, hooks := range s.hooks {
+		if err := hooks.Transform(msg); err != nil {
+			return err
+		}
+	}
+
+	// Apply the routing rules, which may drop the message without the publisher knowing
+	if s.router != nil && !s.router.Route(msg) {
+		return nil
+	}
+
+	// Report the accepted message, for example to compute the synthetic channels
+	if s.observer != nil {
+		s.observer.Observe(msg)
+	}
+
+	// Hold the message if it should only be delivered later
+	stored := msg.Stored() && key.HasPermission(security.AllowStore)
+	if at, ok := deliveryTime(channel); ok {
+		if s.delayer == nil {
+			return errors.ErrNotImplemented
+		}
+		return s.delayer.Delay(msg, at, stored)
+	}
+
+	// The channels carrying user content may need their messages to be scanned first
+	if s.scanner != nil && s.scanner.Matches(channel.Channel) {
+		s.publishScanned(contract, msg, stored, filter)
+		return nil
+	}
+
+	// Store the message if needed
+	if stored {
+		s.persist(msg)
+	}
+
+	// Iterate through all subscribers and send them the message
+	size, count := s.publish(msg, filter)
+	s.notifier.NotifyPublish(msg, count)
 	contract.Stats().AddEgress(size)
+
+	// If the publisher asked for it, let it know that nobody has received the message
+	if count == 0 && channel.NotifyOrphan() {
+		return errors.ErrNoSubscribers
+	}
 	return nil
 }
 
+// Deliver publishes a message which was held until its delivery time, to all of the
+// subscribers of its channel.
+func (s *Service) Deliver(contract contract.Contract, m *message.Message, stored bool) {
+	everyone := func(message.Subscriber) bool { return true }
+	if s.scanner != nil && s.scanner.Matches(m.Channel) {
+		s.publishScanned(contract, m, stored, everyone)
+		return
+	}
+
+	if stored {
+		s.persist(m)
+	}
+
+	size, count := s.publish(m, everyone)
+	s.notifier.NotifyPublish(m, count)
+	contract.Stats().AddEgress(size)
+}
+
+// deliveryTime returns the time at which the message should be delivered, if it was
+// published with either a 'delay' or an 'at' option.
+func deliveryTime(channel *security.Channel) (time.Time, bool) {
+	if delay, ok := channel.Delay(); ok {
+		return time.Now().Add(delay), true
+	}
+	return channel.At()
+}
+
+// isDuplicate checks whether the publish is the retry of a message already published. The
+// message is identified either by the 'id' option of the channel or, for the MQTT packets
+// requiring an acknowledgement, by the packet identifier within the connection.
+func (s *Service) isDuplicate(c service.Conn, contract uint32, channel *security.Channel, packet *mqtt.Publish) bool {
+	if id, ok := channel.MessageID(); ok {
+		return s.dedup.Duplicate(contract, channel.Channel, id, true)
+	}
+
+	if packet.Header.QOS > 0 {
+		id := c.ID() + "-" + strconv.Itoa(int(packet.MessageID))
+		return s.dedup.Duplicate(contract, channel.Channel, id, packet.Header.DUP)
+	}
+	return false
+}
+
 // onEmitterRequest processes an emitter request.
 func (s *Service) onEmitterRequest(c service.Conn, channel *security.Channel, payload []byte, requestID uint16) (ok bool) {
 	var resp service.Response
@@ -18,13 +18,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/emitter-io/emitter/internal/errors"
 	"github.com/emitter-io/emitter/internal/event"
 	"github.com/emitter-io/emitter/internal/message"
 	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/emitter-io/emitter/internal/provider/contract"
 	"github.com/emitter-io/emitter/internal/provider/storage"
 	"github.com/emitter-io/emitter/internal/security"
 	"github.com/emitter-io/emitter/internal/service/fake"
 	"github.com/emitter-io/emitter/internal/service/me"
+	"github.com/emitter-io/emitter/internal/service/overload"
 	"github.com/kelindar/binary/nocopy"
 	"github.com/stretchr/testify/assert"
 )
@@ -35,6 +38,7 @@ func TestPubSub_Publish(t *testing.T) {
 		contract     int           // The contract ID
 		request      *mqtt.Publish // The publish request
 		extraPerm    uint8         // Extra key permission
+		overload     uint8         // The overload level of the server
 		expectStored int           // How many messages were stored?
 		expectCount  int           // How many messages were published?
 		success      bool          // Success or failure?
@@ -79,6 +83,38 @@ func TestPubSub_Publish(t *testing.T) {
 				Topic: []byte("key/a/b/c/?me=0"),
 			},
 		},
+		{ // Overloaded, Low Priority
+			contract: 1,
+			success:  false,
+			overload: overload.PriorityLow,
+			request: &mqtt.Publish{
+				Topic: []byte("key/a/b/c/?priority=low"),
+			},
+		},
+		{ // Overloaded, Normal Priority
+			contract:    1,
+			expectCount: 1,
+			success:     true,
+			overload:    overload.PriorityLow,
+			request: &mqtt.Publish{
+				Topic: []byte("key/a/b/c/"),
+			},
+		},
+		{ // Happy Path, Orphan Notification
+			contract:    1,
+			expectCount: 1,
+			success:     true,
+			request: &mqtt.Publish{
+				Topic: []byte("key/a/b/c/?orphan=1"),
+			},
+		},
+		{ // No Subscribers, Orphan Notification
+			contract: 1,
+			success:  false,
+			request: &mqtt.Publish{
+				Topic: []byte("key/a/b/d/?orphan=1"),
+			},
+		},
 		{ // // Happy Path, Retained
 			contract:     1,
 			success:      true,
@@ -106,7 +142,7 @@ func TestPubSub_Publish(t *testing.T) {
 		}
 
 		// Issue a request
-		s := New(auth, store, notify, trie)
+		s := New(auth, store, notify, &fake.Shedder{Level: tc.overload}, new(fake.Scheduler), trie)
 		sub := new(fake.Conn)
 		s.Subscribe(sub, &event.Subscription{
 			Peer:    2,
@@ -119,6 +155,9 @@ func TestPubSub_Publish(t *testing.T) {
 		err := s.OnPublish(c, tc.request)
 		assert.Equal(t, tc.success, err == nil)
 		assert.Equal(t, tc.expectCount, len(sub.Outgoing))
+		if tc.success {
+			assert.Equal(t, []int{tc.expectCount}, notify.Published)
+		}
 
 		// Query the storage
 		{
@@ -129,6 +168,400 @@ func TestPubSub_Publish(t *testing.T) {
 	}
 }
 
+func TestPubSub_PublishScanned(t *testing.T) {
+	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
+	tests := []struct {
+		hold          bool // Whether the messages are held
+		clean         bool // The verdict of the scanner
+		expectStored  int  // How many messages were stored?
+		expectCount   int  // How many messages were published?
+		expectRetract bool // Whether a tombstone was published
+	}{
+		{hold: true, clean: true, expectStored: 1, expectCount: 1},
+		{hold: true, clean: false},
+		{hold: false, clean: true, expectStored: 1, expectCount: 1},
+		{hold: false, clean: false, expectCount: 2, expectRetract: true},
+	}
+
+	for _, tc := range tests {
+		store := storage.NewInMemory(nil)
+		store.Configure(nil)
+		trie := message.NewTrie()
+		notify := new(fake.Notifier)
+		scanner := &fake.Scanner{Hold: tc.hold, Clean: tc.clean}
+		auth := &fake.Authorizer{
+			Contract:  1,
+			Success:   true,
+			ExtraPerm: security.AllowStore,
+		}
+
+		s := New(auth, store, notify, new(fake.Shedder), new(fake.Scheduler), trie)
+		s.UseScanner(scanner)
+		sub := new(fake.Conn)
+		s.Subscribe(sub, &event.Subscription{
+			Peer:    2,
+			Conn:    5,
+			Ssid:    ssid,
+			Channel: nocopy.Bytes("a/b/c/"),
+		})
+
+		assert.Nil(t, s.OnPublish(new(fake.Conn), &mqtt.Publish{
+			Topic:   []byte("key/a/b/c/?ttl=30"),
+			Payload: []byte("hi"),
+		}))
+		assert.Equal(t, 1, scanner.Scanned)
+		assert.Equal(t, tc.expectCount, len(sub.Outgoing))
+		if tc.expectRetract {
+			assert.Equal(t, "emitter/retract/", string(sub.Outgoing[1].Channel))
+		}
+
+		msgs, err := store.Query(ssid, time.Unix(0, 0), time.Now(), 100)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expectStored, len(msgs))
+		store.Close()
+	}
+}
+
+func TestPubSub_PublishDedup(t *testing.T) {
+	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}
+
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	s.UseDedup(time.Minute, 100, "a/")
+	sub := new(fake.Conn)
+	s.Subscribe(sub, &event.Subscription{
+		Ssid:    ssid,
+		Channel: nocopy.Bytes("a/b/c/"),
+	})
+
+	publish := func(c *fake.Conn, topic string, id uint16, dup bool) {
+		assert.Nil(t, s.OnPublish(c, &mqtt.Publish{
+			Header:    mqtt.Header{QOS: 1, DUP: dup},
+			MessageID: id,
+			Topic:     []byte(topic),
+			Payload:   []byte("hi"),
+		}))
+	}
+
+	// The retries with the same message identifier are dropped
+	c1, c2 := &fake.Conn{ConnID: 1}, &fake.Conn{ConnID: 2}
+	publish(c1, "key/a/b/c/?id=abc", 0, false)
+	publish(c2, "key/a/b/c/?id=abc", 0, false)
+	publish(c1, "key/a/b/c/?id=def", 0, false)
+	assert.Len(t, sub.Outgoing, 2)
+
+	// The retransmitted packets are dropped, but not the reused packet identifiers
+	publish(c1, "key/a/b/c/", 10, false)
+	publish(c1, "key/a/b/c/", 10, true)
+	publish(c2, "key/a/b/c/", 10, true)
+	publish(c1, "key/a/b/c/", 10, false)
+	assert.Len(t, sub.Outgoing, 5)
+}
+
+func TestPubSub_PublishDelayed(t *testing.T) {
+	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}
+
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	sub := new(fake.Conn)
+	s.Subscribe(sub, &event.Subscription{
+		Ssid:    ssid,
+		Channel: nocopy.Bytes("a/b/c/"),
+	})
+
+	publish := func(topic string) *errors.Error {
+		return s.OnPublish(new(fake.Conn), &mqtt.Publish{
+			Topic:   []byte(topic),
+			Payload: []byte("hi"),
+		})
+	}
+
+	// Without a delayer, the delayed messages are refused
+	assert.Equal(t, errors.ErrNotImplemented, publish("key/a/b/c/?delay=30s"))
+
+	// The delayed messages are held instead of being delivered
+	delayer := new(fake.Delayer)
+	s.UseDelay(delayer)
+	assert.Nil(t, publish("key/a/b/c/?delay=30s"))
+	assert.Nil(t, publish("key/a/b/c/?at=1700000000"))
+	assert.Nil(t, publish("key/a/b/c/"))
+	assert.Len(t, sub.Outgoing, 1)
+	assert.Len(t, delayer.Held, 2)
+	assert.WithinDuration(t, time.Now().Add(30*time.Second), delayer.At[0], time.Second)
+	assert.Equal(t, time.Unix(1700000000, 0), delayer.At[1])
+
+	// Once due, the held messages are delivered to the subscribers
+	s.Deliver(new(fake.Contract), &delayer.Held[0], false)
+	assert.Len(t, sub.Outgoing, 2)
+}
+
+func TestPubSub_PublishObserved(t *testing.T) {
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}
+
+	observer := new(fake.Observer)
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	s.UseObserver(observer)
+	assert.Nil(t, s.OnPublish(new(fake.Conn), &mqtt.Publish{
+		Topic:   []byte("key/a/b/c/"),
+		Payload: []byte("hi"),
+	}))
+
+	assert.Len(t, observer.Observed, 1)
+	assert.Equal(t, "a/b/c/", string(observer.Observed[0].Channel))
+}
+
+func TestPubSub_PublishInflight(t *testing.T) {
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+		Limits:   contract.Limits{MaxInflight: 1},
+	}
+
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	c := new(fake.Conn)
+	publish := func() *errors.Error {
+		return s.OnPublish(c, &mqtt.Publish{
+			Topic:   []byte("key/a/b/c/"),
+			Payload: []byte("hi"),
+		})
+	}
+
+	// The publishes delivered right away are released
+	assert.Nil(t, publish())
+	assert.Nil(t, publish())
+	assert.Equal(t, 0, s.inflight.Count(c.ID()))
+
+	// While a publish waiting to be delivered holds the only slot
+	assert.True(t, s.inflight.Acquire(c.ID(), 1))
+	assert.Equal(t, errors.ErrTooManyInflight, publish())
+}
+
+func TestPubSub_PublishHeaders(t *testing.T) {
+	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}
+
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	sub := new(fake.Conn)
+	s.Subscribe(sub, &event.Subscription{
+		Ssid:    ssid,
+		Channel: nocopy.Bytes("a/b/c/"),
+	})
+
+	publish := func(topic string) *errors.Error {
+		return s.OnPublish(new(fake.Conn), &mqtt.Publish{
+			Topic:   []byte(topic),
+			Payload: []byte("hi"),
+		})
+	}
+
+	// The headers are attached to the delivered message, but not to its channel
+	assert.Nil(t, publish("key/a/b/c/?ttl=30&h-trace=abc&h-zone=eu"))
+	assert.Len(t, sub.Outgoing, 1)
+	assert.Equal(t, "a/b/c/", string(sub.Outgoing[0].Channel))
+	assert.Equal(t, message.Headers{"trace": "abc", "zone": "eu"}, sub.Outgoing[0].Headers)
+
+	// Too many headers are refused
+	assert.Equal(t, errors.ErrBadRequest, publish("key/a/b/c/?h-a=1&h-b=2&h-c=3&h-d=4&h-e=5&h-f=6&h-g=7&h-h=8&h-i=9"))
+	assert.Len(t, sub.Outgoing, 1)
+}
+
+func TestPubSub_PublishMaxMessageSize(t *testing.T) {
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+		Limits:   contract.Limits{MaxMessageSize: 5},
+	}
+
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	sub := new(fake.Conn)
+	s.Subscribe(sub, &event.Subscription{
+		Ssid:    message.Ssid{1, 3238259379, 500706888, 1027807523},
+		Channel: nocopy.Bytes("a/b/c/"),
+	})
+
+	publish := func(payload string) *errors.Error {
+		return s.OnPublish(new(fake.Conn), &mqtt.Publish{
+			Topic:   []byte("key/a/b/c/"),
+			Payload: []byte(payload),
+		})
+	}
+
+	// The messages larger than the contract allows are refused, advertising the maximum
+	assert.Nil(t, publish("hello"))
+	err := publish("hello world")
+	assert.Equal(t, errors.ErrMessageTooLarge.Message, err.Message)
+	assert.Equal(t, 5, err.MaxSize)
+	assert.Len(t, sub.Outgoing, 1)
+}
+
+func TestPubSub_PublishQuota(t *testing.T) {
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+		Limits:   contract.Limits{MaxDailyMessages: 2},
+	}
+
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	publish := func() *errors.Error {
+		return s.OnPublish(new(fake.Conn), &mqtt.Publish{
+			Topic:   []byte("key/a/b/c/"),
+			Payload: []byte("hi"),
+		})
+	}
+
+	// The quota is shared by all of the connections of the contract
+	assert.Nil(t, publish())
+	assert.Nil(t, publish())
+	assert.Equal(t, errors.ErrQuotaExceeded, publish())
+}
+
+func TestPubSub_PublishHooks(t *testing.T) {
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}
+
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	sub := new(fake.Conn)
+	s.Subscribe(sub, &event.Subscription{
+		Ssid:    message.Ssid{1, 3238259379, 500706888, 1027807523},
+		Channel: nocopy.Bytes("a/b/c/"),
+	})
+
+	hooks := &fake.Transformer{Payload: "transformed"}
+	s.UseHooks(hooks)
+	publish := func() *errors.Error {
+		return s.OnPublish(new(fake.Conn), &mqtt.Publish{
+			Topic:   []byte("key/a/b/c/"),
+			Payload: []byte("hello"),
+		})
+	}
+
+	// The message is delivered as transformed by the hooks
+	assert.Nil(t, publish())
+	assert.Len(t, sub.Outgoing, 1)
+	assert.Equal(t, "transformed", string(sub.Outgoing[0].Payload))
+
+	// The message refused by the hooks is not delivered
+	hooks.Err = errors.ErrRejected
+	assert.Equal(t, errors.ErrRejected, publish())
+	assert.Len(t, sub.Outgoing, 1)
+}
+
+func TestPubSub_PublishRouted(t *testing.T) {
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}
+
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	sub := new(fake.Conn)
+	s.Subscribe(sub, &event.Subscription{
+		Ssid:    message.Ssid{1, 3238259379, 500706888, 1027807523},
+		Channel: nocopy.Bytes("a/b/c/"),
+	})
+
+	router := new(fake.Router)
+	s.UseRouter(router)
+	publish := func() *errors.Error {
+		return s.OnPublish(new(fake.Conn), &mqtt.Publish{
+			Topic:   []byte("key/a/b/c/"),
+			Payload: []byte("hello"),
+		})
+	}
+
+	// The message is routed, then delivered
+	assert.Nil(t, publish())
+	assert.Len(t, router.Routed, 1)
+	assert.Len(t, sub.Outgoing, 1)
+
+	// The message dropped by the rules is not delivered, without the publisher knowing
+	router.Drop = true
+	assert.Nil(t, publish())
+	assert.Len(t, router.Routed, 2)
+	assert.Len(t, sub.Outgoing, 1)
+}
+
+func TestPubSub_PublishNoEcho(t *testing.T) {
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}
+
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	c1, c2 := &fake.Conn{ConnID: 1}, &fake.Conn{ConnID: 2}
+	assert.Nil(t, s.OnSubscribe(c1, []byte("key/a/b/c/?me=0")))
+	assert.Nil(t, s.OnSubscribe(c2, []byte("key/a/b/c/")))
+
+	publish := func(c *fake.Conn, topic string) {
+		assert.Nil(t, s.OnPublish(c, &mqtt.Publish{
+			Topic:   []byte(topic),
+			Payload: []byte("hi"),
+		}))
+	}
+
+	// The messages of the connection itself are not echoed back to it
+	publish(c1, "key/a/b/c/")
+	publish(c2, "key/a/b/c/")
+	assert.Len(t, c1.Outgoing, 1)
+	assert.Len(t, c2.Outgoing, 2)
+
+	// Unless it is also subscribed without the option
+	assert.Nil(t, s.OnSubscribe(c1, []byte("key/a/")))
+	publish(c1, "key/a/b/c/")
+	assert.Len(t, c1.Outgoing, 2)
+
+	// While the message option excludes the publisher regardless of its subscriptions
+	publish(c2, "key/a/b/c/?me=0")
+	assert.Len(t, c2.Outgoing, 3)
+}
+
+func TestPubSub_PublishAlias(t *testing.T) {
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}
+
+	s := New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	pub, sub := &fake.Conn{ConnID: 1}, &fake.Conn{ConnID: 2}
+	assert.Nil(t, s.OnSubscribe(sub, []byte("key/a/b/c/")))
+
+	publish := func(topic string) *errors.Error {
+		return s.OnPublish(pub, &mqtt.Publish{
+			Topic:   []byte(topic),
+			Payload: []byte("hi"),
+		})
+	}
+
+	// Unknown aliases are refused
+	assert.Equal(t, errors.ErrBadRequest, publish("t1"))
+
+	// The first message binds the alias, without the option itself
+	assert.Nil(t, publish("key/a/b/c/?ttl=30&alias=t1"))
+	assert.Equal(t, "key/a/b/c/?ttl=30", pub.Links()["t1"])
+
+	// The following ones are published on the alias
+	assert.Nil(t, publish("t1"))
+	assert.Len(t, sub.Outgoing, 2)
+	assert.Equal(t, "a/b/c/", string(sub.Outgoing[1].Channel))
+
+	// Aliases must be 1 or 2 characters long
+	assert.Equal(t, errors.ErrLinkInvalid, publish("key/a/b/c/?alias=abc"))
+	assert.Len(t, sub.Outgoing, 2)
+}
+
 func TestPubSub_Request(t *testing.T) {
 	tests := []struct {
 		contract int           // The contract ID
@@ -159,7 +592,7 @@ func TestPubSub_Request(t *testing.T) {
 		}
 
 		// Issue a request
-		s := New(auth, storage.NewNoop(), new(fake.Notifier), trie)
+		s := New(auth, storage.NewNoop(), new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), trie)
 		s.Handle("me", me.New().OnRequest)
 
 		c := new(fake.Conn)
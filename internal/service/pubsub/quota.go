@@ -0,0 +1,54 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"sync"
+	"time"
+)
+
+// quota represents the number of messages published by each contract during the current
+// day (UTC), so that a contract cannot publish beyond its daily quota on this node.
+type quota struct {
+	sync.Mutex
+	day    int64            // The current day, since the epoch.
+	counts map[uint32]int64 // The number of messages published today, per contract.
+}
+
+// newQuota creates a new quota counter.
+func newQuota() *quota {
+	return &quota{
+		counts: make(map[uint32]int64),
+	}
+}
+
+// Acquire counts a new message of the contract published at the time specified and returns
+// whether it stays within the daily limit. The counts start over every day.
+func (q *quota) Acquire(contract uint32, limit int64, now time.Time) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	if day := now.Unix() / 86400; day != q.day {
+		q.day = day
+		q.counts = make(map[uint32]int64)
+	}
+
+	if q.counts[contract] >= limit {
+		return false
+	}
+
+	q.counts[contract]++
+	return true
+}
@@ -0,0 +1,37 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota(t *testing.T) {
+	q := newQuota()
+	now := time.Date(2020, 6, 1, 23, 59, 0, 0, time.UTC)
+	assert.True(t, q.Acquire(1, 2, now))
+	assert.True(t, q.Acquire(1, 2, now))
+	assert.False(t, q.Acquire(1, 2, now))
+	assert.True(t, q.Acquire(2, 2, now))
+
+	// The counts start over on the next day
+	tomorrow := now.Add(2 * time.Minute)
+	assert.True(t, q.Acquire(1, 2, tomorrow))
+	assert.Equal(t, int64(1), q.counts[1])
+	assert.Zero(t, q.counts[2])
+}
@@ -0,0 +1,118 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+)
+
+// recent represents a buffer of the messages recently published on each channel, which
+// lets the subscribers rewind and receive the messages published shortly before they
+// subscribed.
+type recent struct {
+	sync.Mutex
+	window   int64                                   // The number of seconds the messages are kept for.
+	size     int                                     // The maximum number of messages kept per channel.
+	swept    int64                                   // The last time the stale channels were removed.
+	channels map[uint32]map[string][]message.Message // The recent messages, per contract and channel.
+}
+
+// newRecent creates a new buffer of the recent messages.
+func newRecent(window time.Duration, size int) *recent {
+	return &recent{
+		window:   int64(window / time.Second),
+		size:     size,
+		swept:    time.Now().Unix(),
+		channels: make(map[uint32]map[string][]message.Message),
+	}
+}
+
+// Add adds a published message to the buffer.
+func (r *recent) Add(m *message.Message) {
+	if len(m.ID) == 0 {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now().Unix()
+	if now-r.swept > r.window {
+		r.sweep(now)
+	}
+
+	contract := m.Contract()
+	channels, ok := r.channels[contract]
+	if !ok {
+		channels = make(map[string][]message.Message)
+		r.channels[contract] = channels
+	}
+
+	// Drop the messages which are too old or too many, then append the new one
+	channel := string(m.Channel)
+	msgs := r.expire(channels[channel], now)
+	if len(msgs) >= r.size {
+		msgs = msgs[len(msgs)-r.size+1:]
+	}
+	channels[channel] = append(msgs, *m)
+}
+
+// Since returns the messages matching the SSID which were published since a specific time,
+// from the oldest to the newest.
+func (r *recent) Since(ssid message.Ssid, since time.Time) (out message.Frame) {
+	r.Lock()
+	defer r.Unlock()
+
+	t0, t1 := since.Unix(), time.Now().Unix()
+	for _, msgs := range r.channels[ssid.Contract()] {
+		for _, m := range msgs {
+			if m.ID.Match(ssid, t0, t1) {
+				out = append(out, m)
+			}
+		}
+	}
+
+	out.Sort()
+	return
+}
+
+// expire returns the messages which are still recent enough to be kept.
+func (r *recent) expire(msgs []message.Message, now int64) []message.Message {
+	for i := range msgs {
+		if now-msgs[i].Time() <= r.window {
+			return msgs[i:]
+		}
+	}
+	return msgs[:0]
+}
+
+// sweep removes the channels which have not received a message recently.
+func (r *recent) sweep(now int64) {
+	for contract, channels := range r.channels {
+		for channel, msgs := range channels {
+			if msgs = r.expire(msgs, now); len(msgs) == 0 {
+				delete(channels, channel)
+			}
+		}
+
+		if len(channels) == 0 {
+			delete(r.channels, contract)
+		}
+	}
+	r.swept = now
+}
@@ -0,0 +1,82 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRecentMessage(ssid message.Ssid, channel string, t int64) *message.Message {
+	m := message.New(ssid, []byte(channel), []byte(fmt.Sprintf("%d", t)))
+	m.ID.SetTime(t)
+	return m
+}
+
+func TestRecent_Since(t *testing.T) {
+	r := newRecent(10*time.Second, 3)
+	now := time.Now().Unix()
+
+	r.Add(&message.Message{Channel: []byte("emitter/x/")}) // Without an ID, ignored
+	r.Add(newRecentMessage(message.Ssid{1, 2, 3}, "a/b/", now-20))
+	r.Add(newRecentMessage(message.Ssid{1, 2, 3}, "a/b/", now-5))
+	r.Add(newRecentMessage(message.Ssid{1, 2, 3}, "a/b/", now-4))
+	r.Add(newRecentMessage(message.Ssid{1, 2, 4}, "a/c/", now-3))
+	r.Add(newRecentMessage(message.Ssid{2, 2, 3}, "a/b/", now-2))
+
+	tests := []struct {
+		ssid   message.Ssid
+		since  int64
+		expect int
+	}{
+		{ssid: message.Ssid{1, 2, 3}, since: now - 30, expect: 2},
+		{ssid: message.Ssid{1, 2, 3}, since: now - 4, expect: 1},
+		{ssid: message.Ssid{1, 2}, since: now - 30, expect: 3},
+		{ssid: message.Ssid{1, 2, 1815237614}, since: now - 30, expect: 3},
+		{ssid: message.Ssid{1, 2, 4}, since: now - 1, expect: 0},
+		{ssid: message.Ssid{2, 2}, since: now - 30, expect: 1},
+		{ssid: message.Ssid{3, 2}, since: now - 30, expect: 0},
+	}
+
+	for _, tc := range tests {
+		assert.Len(t, r.Since(tc.ssid, time.Unix(tc.since, 0)), tc.expect, tc.ssid)
+	}
+}
+
+func TestRecent_Size(t *testing.T) {
+	r := newRecent(10*time.Second, 3)
+	now := time.Now().Unix()
+	for i := 0; i < 10; i++ {
+		r.Add(newRecentMessage(message.Ssid{1, 2, 3}, "a/b/", now))
+	}
+
+	assert.Len(t, r.Since(message.Ssid{1, 2, 3}, time.Unix(now-1, 0)), 3)
+}
+
+func TestRecent_Sweep(t *testing.T) {
+	r := newRecent(10*time.Second, 3)
+	now := time.Now().Unix()
+	r.Add(newRecentMessage(message.Ssid{1, 2, 3}, "a/b/", now-15))
+	r.Add(newRecentMessage(message.Ssid{2, 2, 3}, "a/b/", now))
+	assert.Len(t, r.channels, 2)
+
+	r.sweep(now)
+	assert.Len(t, r.channels, 1)
+	assert.Len(t, r.channels[2], 1)
+}
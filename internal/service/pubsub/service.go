@@ -15,7 +15,11 @@
 package pubsub
 
 import (
+	"strings"
+	"time"
+
 	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/contract"
 	"github.com/emitter-io/emitter/internal/provider/storage"
 	"github.com/emitter-io/emitter/internal/security/hash"
 	"github.com/emitter-io/emitter/internal/service"
@@ -23,24 +27,105 @@ import (
 
 // Service represents a publish service.
 type Service struct {
-	auth     service.Authorizer         // The authorizer to use.
-	store    storage.Storage            // The storage provider to use.
-	notifier service.Notifier           // The notifier to use.
-	trie     *message.Trie              // The subscription matching trie.
-	handlers map[uint32]service.Handler // The emitter request handlers.
+	auth      service.Authorizer         // The authorizer to use.
+	store     storage.Storage            // The storage provider to use.
+	notifier  service.Notifier           // The notifier to use.
+	shedder   service.Shedder            // The load shedder to use.
+	sched     service.Scheduler          // The scheduler for the delivery and storage.
+	trie      *message.Trie              // The subscription matching trie.
+	handlers  map[uint32]service.Handler // The emitter request handlers.
+	scanner   service.Scanner            // The content scanner (optional).
+	recent    *recent                    // The recently published messages (optional).
+	dedup     *dedup                     // The recently published message identifiers (optional).
+	delayer   service.Delayer            // The holder of the delayed messages (optional).
+	dead      *deadLetter                // The dead-letter channels (optional).
+	observer  service.Observer           // The observer of the published messages (optional).
+	inflight  *inflight                  // The publishes waiting to be delivered, per connection.
+	quota     *quota                     // The messages published today, per contract.
+	maxSize   int                        // The maximum size of a packet, advertised to the clients.
+	chunks    *assembler                 // The messages published in chunks (optional).
+	hooks     []service.Transformer      // The hooks run on the messages published, in order.
+	router    service.Router             // The routing rules of the messages published (optional).
+	contracts contract.Provider          // The contracts limiting the subscriptions (optional).
 }
 
 // New creates a new publisher service.
-func New(auth service.Authorizer, store storage.Storage, notifier service.Notifier, trie *message.Trie) *Service {
+func New(auth service.Authorizer, store storage.Storage, notifier service.Notifier, shedder service.Shedder, sched service.Scheduler, trie *message.Trie) *Service {
 	return &Service{
 		auth:     auth,
 		store:    store,
 		notifier: notifier,
+		shedder:  shedder,
+		sched:    sched,
 		trie:     trie,
 		handlers: make(map[uint32]service.Handler),
+		inflight: newInflight(),
+		quota:    newQuota(),
+	}
+}
+
+// UseScanner makes the service scan the content of the messages published on the
+// channels matched by the scanner.
+func (s *Service) UseScanner(scanner service.Scanner) {
+	s.scanner = scanner
+}
+
+// UseRewind keeps the messages recently published on each channel, so that the subscribers
+// can receive the messages published up to the window before they subscribed.
+func (s *Service) UseRewind(window time.Duration, size int) {
+	s.recent = newRecent(window, size)
+}
+
+// UseDedup drops the retried publishes whose identifier was already published on the same
+// channel within the window, for the channels matching the comma-separated patterns.
+func (s *Service) UseDedup(window time.Duration, size int, patterns string) {
+	s.dedup = newDedup(window, size, patterns)
+}
+
+// UseDelay makes the service hand the messages published with a 'delay' or an 'at' option
+// over to the delayer, which delivers them back once their delivery time has come.
+func (s *Service) UseDelay(delayer service.Delayer) {
+	s.delayer = delayer
+}
+
+// UseDeadLetter republishes the messages which could not be delivered on the dead-letter
+// channel of their contract, prefixed by the specified prefix (e.g: "deadletter/").
+func (s *Service) UseDeadLetter(prefix string, ttl uint32) {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	s.dead = &deadLetter{
+		prefix: prefix,
+		ttl:    ttl,
 	}
 }
 
+// UseObserver makes the service report the messages published by the clients to the
+// observer, once they were accepted.
+func (s *Service) UseObserver(observer service.Observer) {
+	s.observer = observer
+}
+
+// UseHooks makes the service run the hooks on the messages published, which may alter them
+// or refuse them before they are delivered and stored. The hooks run in the order they were
+// added, each one seeing the message as altered by the previous ones.
+func (s *Service) UseHooks(hooks service.Transformer) {
+	s.hooks = append(s.hooks, hooks)
+}
+
+// UseRouter makes the service apply the routing rules to the messages published, which may
+// republish, forward, tag or drop them.
+func (s *Service) UseRouter(router service.Router) {
+	s.router = router
+}
+
+// UseContracts makes the service limit the number of subscriptions of the connections as
+// set by their contracts, whichever service subscribes them.
+func (s *Service) UseContracts(contracts contract.Provider) {
+	s.contracts = contracts
+}
+
 // Handle adds a handler for an "emitter/..." request
 func (s *Service) Handle(request string, handler service.Handler) {
 	s.handlers[hash.OfString(request)] = handler
@@ -16,18 +16,26 @@ package pubsub
 
 import (
 	"bytes"
+	"time"
+
 	"github.com/emitter-io/emitter/internal/errors"
 	"github.com/emitter-io/emitter/internal/event"
 	"github.com/emitter-io/emitter/internal/message"
 	"github.com/emitter-io/emitter/internal/provider/logging"
 	"github.com/emitter-io/emitter/internal/security"
 	"github.com/emitter-io/emitter/internal/service"
+	"github.com/emitter-io/emitter/internal/service/overload"
+	"github.com/emitter-io/emitter/internal/service/presence"
 	"github.com/kelindar/binary/nocopy"
 )
 
-// Subscribe subscribes to a channel.
+// The maximum number of messages replayed for a time window or the retained messages.
+const maxReplay = 1000
+
+// Subscribe subscribes to a channel. A connection is not subscribed beyond the number of
+// subscriptions allowed by the contract, if the contracts are known.
 func (s *Service) Subscribe(sub message.Subscriber, ev *event.Subscription) bool {
-	if conn, ok := sub.(service.Conn); ok && !conn.CanSubscribe(ev.Ssid, ev.Channel) {
+	if conn, ok := sub.(service.Conn); ok && (s.tooManySubs(conn, ev.Ssid) || !conn.CanSubscribe(ev.Ssid, ev.Channel)) {
 		return false
 	}
 
@@ -41,6 +49,14 @@ func (s *Service) Subscribe(sub message.Subscriber, ev *event.Subscription) bool
 
 // OnSubscribe is a handler for MQTT Subscribe events.
 func (s *Service) OnSubscribe(c service.Conn, mqttTopic []byte) *errors.Error {
+	_, _, err := s.subscribe(c, mqttTopic, false)
+	return err
+}
+
+// subscribe subscribes the connection to the channel of the MQTT topic and returns the
+// SSID of the subscription along with whether the connection was already subscribed to
+// it. An idempotent subscription is not repeated if it already exists.
+func (s *Service) subscribe(c service.Conn, mqttTopic []byte, idempotent bool) (message.Ssid, bool, *errors.Error) {
 
 	// compatibility with paho.mqtt.golang
 	// https://github.com/eclipse/paho.mqtt.golang/blob/master/topic.go#L78
@@ -51,53 +67,157 @@ func (s *Service) OnSubscribe(c service.Conn, mqttTopic []byte) *errors.Error {
 	// Parse the channel
 	channel := security.ParseChannel(mqttTopic)
 	if channel.ChannelType == security.ChannelInvalid {
-		return errors.ErrBadRequest
+		return nil, false, errors.ErrBadRequest
+	}
+
+	// Parse the selector of the messages delivered, if the subscription is filtered
+	var filter *message.Selector
+	if text, ok := channel.Filter(); ok {
+		selector, err := message.ParseSelector(text)
+		if !ok || err != nil {
+			return nil, false, errors.ErrBadRequest
+		}
+		filter = selector
 	}
 
 	// Check the authorization and permissions
 	contract, key, allowed := s.auth.Authorize(channel, security.AllowRead)
 	if !allowed {
-		return errors.ErrUnauthorized
+		return nil, false, errors.ErrUnauthorized
 	}
 
 	// Keys which are supposed to be extended should not be used for subscribing
 	if key.HasPermission(security.AllowExtend) {
-		return errors.ErrUnauthorizedExt
+		return nil, false, errors.ErrUnauthorizedExt
+	}
+
+	// History queries are the first to be shed when the server is overloaded
+	limit, replay := replayLimit(channel)
+	if replay && s.shedder.Shed(overload.PriorityHistory) {
+		return nil, false, errors.ErrOverloaded
 	}
 
 	// Subscribe the client to the channel
 	ssid := message.NewSsid(key.Contract(), channel.Query)
+	_, duplicate := c.Subscriptions().Get(ssid)
+	if duplicate && idempotent {
+		c.Subscriptions().SetExpires(ssid, key.Expires().Unix())
+		return ssid, duplicate, nil
+	}
+
+	// Limit the number of subscriptions of the connection, as set by the contract
+	if exceedsSubs(c, ssid, contract.Limits().MaxSubscriptions) {
+		return nil, false, errors.ErrTooManySubs
+	}
+
+	// The presence metadata of the subscription (e.g: 'm-status=away') overrides the one
+	// of the connection
+	meta := presence.MergeMeta(c.Meta(), channel.Meta())
 	s.Subscribe(c, &event.Subscription{
 		Conn:    c.LocalID(),
 		User:    nocopy.String(c.Username()),
 		Ssid:    ssid,
 		Channel: channel.Channel,
+		Meta:    meta,
 	})
 
-	// Use limit = 1 if not specified, otherwise use the limit option. The limit now
-	// defaults to one as per MQTT spec we always need to send retained messages.
-	limit := int64(1)
-	if v, ok := channel.Last(); ok {
-		limit = v
-	}
+	// Exclude the messages published by the connection itself if asked to (i.e.: 'me=0')
+	c.Subscriptions().SetNoEcho(ssid, channel.Exclude())
+	c.Subscriptions().SetMeta(ssid, meta)
+	c.Subscriptions().SetFilter(ssid, filter)
+	c.Subscriptions().SetExpires(ssid, key.Expires().Unix())
 
 	// Check if the key has a load permission (also applies for retained)
+	var sent map[string]bool
 	if key.HasPermission(security.AllowLoad) {
 		t0, t1 := channel.Window() // Get the window
-		msgs, err := s.store.Query(ssid, t0, t1, int(limit))
+		retained := channel.Retained()
+		query := limit
+		if retained && query < maxReplay {
+			query = maxReplay
+		}
+
+		msgs, err := s.store.Query(ssid, t0, t1, int(query))
 		if err != nil {
-			logging.LogError("conn", "query last messages", err)
-			return errors.ErrServerError
+			logging.LogError("conn", "query last messages", err, logging.Conn(c.ID()), logging.Contract(ssid.Contract()))
+			return nil, false, errors.ErrServerError
+		}
+
+		// Only keep the retained messages if asked to
+		if retained {
+			msgs = onlyRetained(msgs, int(limit))
 		}
 
 		// Range over the messages in the channel and forward them
+		sent = make(map[string]bool, len(msgs))
 		for _, m := range msgs {
 			msg := m // Copy message
+			sent[string(msg.ID)] = true
 			c.Send(&msg)
 		}
 	}
 
+	// Deliver the messages published shortly before, unless they were already sent
+	if rewind, ok := channel.Rewind(); ok && s.recent != nil {
+		for _, m := range s.recent.Since(ssid, time.Now().Add(-rewind)) {
+			if msg := m; !sent[string(msg.ID)] {
+				c.Send(&msg)
+			}
+		}
+	}
+
 	// Write the stats
 	c.Track(contract)
-	return nil
+	return ssid, duplicate, nil
+}
+
+// replayLimit returns the number of stored messages to replay before the live delivery
+// starts and whether the history was explicitly requested. The limit defaults to one,
+// as per MQTT spec we always need to send retained messages, while a time window
+// without a limit replays the messages of the entire window.
+func replayLimit(channel *security.Channel) (int64, bool) {
+	if v, ok := channel.Last(); ok {
+		return v, true
+	}
+
+	if t0, t1 := channel.Window(); t0.Unix() > 0 || t1.Unix() > 0 {
+		return maxReplay, true
+	}
+
+	return 1, channel.Retained()
+}
+
+// onlyRetained returns the last retained messages of a frame.
+func onlyRetained(msgs message.Frame, limit int) message.Frame {
+	out := msgs[:0]
+	for _, m := range msgs {
+		if m.TTL == message.RetainedTTL {
+			out = append(out, m)
+		}
+	}
+
+	out.Limit(limit)
+	return out
+}
+
+// tooManySubs checks whether the connection already has as many subscriptions as the
+// contract of the subscription allows, if the contracts are known.
+func (s *Service) tooManySubs(c service.Conn, ssid message.Ssid) bool {
+	if s.contracts == nil {
+		return false
+	}
+
+	contract, ok := s.contracts.Get(ssid.Contract())
+	return ok && exceedsSubs(c, ssid, contract.Limits().MaxSubscriptions)
+}
+
+// exceedsSubs checks whether subscribing the connection would exceed the limit of
+// subscriptions, the ones it already has not counting twice.
+func exceedsSubs(c service.Conn, ssid message.Ssid, limit int) bool {
+	if limit <= 0 || c.Subscriptions().Count() < limit {
+		return false
+	}
+
+	_, exists := c.Subscriptions().Get(ssid)
+	return !exists
 }
@@ -15,14 +15,20 @@
 package pubsub
 
 import (
-	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/event"
 	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	secmock "github.com/emitter-io/emitter/internal/provider/contract/mock"
 	"github.com/emitter-io/emitter/internal/provider/storage"
 	"github.com/emitter-io/emitter/internal/security"
 	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/emitter-io/emitter/internal/service/overload"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,6 +39,7 @@ func TestPubSub_Subscribe(t *testing.T) {
 		topic        string // The subscribe topic
 		extraPerm    uint8  // Extra key permission
 		disabled     bool   // Is the connection disabled?
+		overload     uint8  // The overload level of the server.
 		expectLoaded int    // How many messages were loaded?
 		expectCount  int    // How many subscribers now?
 		success      bool   // Success or failure?
@@ -79,6 +86,22 @@ func TestPubSub_Subscribe(t *testing.T) {
 			expectLoaded: 7,
 			topic:        "key/a/b/c/?last=7",
 		},
+		{ // Overloaded, history shed
+			success:   false,
+			contract:  1,
+			extraPerm: security.AllowLoad,
+			overload:  overload.PriorityHistory,
+			topic:     "key/a/b/c/?last=7",
+		},
+		{ // Overloaded, simple
+			success:      true,
+			contract:     1,
+			extraPerm:    security.AllowLoad,
+			overload:     overload.PriorityHistory,
+			expectCount:  1,
+			expectLoaded: 1,
+			topic:        "key/a/b/c/",
+		},
 	}
 
 	for _, tc := range tests {
@@ -93,7 +116,7 @@ func TestPubSub_Subscribe(t *testing.T) {
 		}
 
 		// Create new service
-		s := New(auth, store, notify, trie)
+		s := New(auth, store, notify, &fake.Shedder{Level: tc.overload}, new(fake.Scheduler), trie)
 		c := &fake.Conn{
 			Disabled: tc.disabled,
 		}
@@ -115,6 +138,202 @@ func TestPubSub_Subscribe(t *testing.T) {
 	}
 }
 
+func TestPubSub_SubscribeMeta(t *testing.T) {
+	trie := message.NewTrie()
+	notify := new(fake.Notifier)
+	auth := &fake.Authorizer{Contract: 1, Success: true}
+	s := New(auth, storage.NewNoop(), notify, new(fake.Shedder), new(fake.Scheduler), trie)
+	c := &fake.Conn{Metadata: map[string]string{"status": "online", "device": "mobile"}}
+
+	// The metadata of the subscription overrides the one of the connection
+	assert.Nil(t, s.OnSubscribe(c, []byte("key/a/b/c/?m-status=away")))
+	meta := map[string]string{"status": "away", "device": "mobile"}
+	assert.Len(t, notify.Events, 1)
+	assert.Equal(t, meta, notify.Events[0].Meta)
+
+	sub, ok := c.Subscriptions().Get(message.Ssid{1, 3238259379, 500706888, 1027807523})
+	assert.True(t, ok)
+	assert.Equal(t, meta, sub.Meta)
+}
+
+func TestPubSub_SubscribeFilter(t *testing.T) {
+	s := New(&fake.Authorizer{Contract: 1, Success: true}, storage.NewNoop(), new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	c := new(fake.Conn)
+
+	// An invalid selector is refused before subscribing
+	assert.Equal(t, errors.ErrBadRequest, s.OnSubscribe(c, []byte("key/a/b/c/?filter=temp>")))
+	assert.Equal(t, 0, c.Subscriptions().Count())
+
+	// The selector is kept along with the subscription
+	assert.Nil(t, s.OnSubscribe(c, []byte("key/a/b/c/?filter=temp>50 and unit='c'")))
+	sub, ok := c.Subscriptions().Get(message.Ssid{1, 3238259379, 500706888, 1027807523})
+	assert.True(t, ok)
+	assert.Equal(t, "temp>50 and unit='c'", sub.Filter.String())
+
+	// Subscribing again without a filter removes it
+	assert.Nil(t, s.OnSubscribe(c, []byte("key/a/b/c/")))
+	sub, _ = c.Subscriptions().Get(message.Ssid{1, 3238259379, 500706888, 1027807523})
+	assert.Nil(t, sub.Filter)
+}
+
+func TestPubSub_SubscribeExpiry(t *testing.T) {
+	auth := &fake.Authorizer{Contract: 1, Success: true, Expires: time.Unix(1700000000, 0)}
+	s := New(auth, storage.NewNoop(), new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	c := new(fake.Conn)
+
+	// The expiry of the key is kept along with the subscription
+	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
+	assert.Nil(t, s.OnSubscribe(c, []byte("key/a/b/c/")))
+	sub, ok := c.Subscriptions().Get(ssid)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1700000000), sub.Expires)
+
+	// Subscribing again with a renewed key extends it
+	c.Subscriptions().Expiring(1700000000)
+	auth.Expires = time.Unix(1800000000, 0)
+	_, duplicate, err := s.subscribe(c, []byte("key/a/b/c/"), true)
+	assert.Nil(t, err)
+	assert.True(t, duplicate)
+	sub, _ = c.Subscriptions().Get(ssid)
+	assert.Equal(t, int64(1800000000), sub.Expires)
+	assert.False(t, sub.Warned)
+}
+
+func TestPubSub_SubscribeLimit(t *testing.T) {
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+		Limits:   contract.Limits{MaxSubscriptions: 2},
+	}
+
+	s := New(auth, storage.NewNoop(), new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	c := new(fake.Conn)
+	assert.Nil(t, s.OnSubscribe(c, []byte("key/a/")))
+	assert.Nil(t, s.OnSubscribe(c, []byte("key/b/")))
+
+	// Subscribing again to the same channel does not count against the limit
+	assert.Nil(t, s.OnSubscribe(c, []byte("key/a/")))
+	assert.Equal(t, errors.ErrTooManySubs, s.OnSubscribe(c, []byte("key/c/")))
+	assert.Equal(t, 2, c.Subscriptions().Count())
+}
+
+func TestPubSub_SubscribeLimitContracts(t *testing.T) {
+	contracts := secmock.NewContractProvider()
+	contracts.On("Get", uint32(1)).Return(&fake.Contract{Caps: contract.Limits{MaxSubscriptions: 1}}, true)
+
+	s := New(new(fake.Authorizer), storage.NewNoop(), new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), message.NewTrie())
+	s.UseContracts(contracts)
+
+	// The limit applies to the subscriptions made by the other services, such as an import
+	c := new(fake.Conn)
+	assert.True(t, s.Subscribe(c, &event.Subscription{Ssid: message.Ssid{1, 2}, Channel: []byte("a/")}))
+	assert.False(t, s.Subscribe(c, &event.Subscription{Ssid: message.Ssid{1, 3}, Channel: []byte("b/")}))
+	assert.Equal(t, 1, c.Subscriptions().Count())
+	assert.Len(t, s.trie.Lookup(message.Ssid{1, 3}, nil), 0)
+}
+
+func TestPubSub_SubscribeReplay(t *testing.T) {
+	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
+	now := time.Now().Unix()
+	tests := []struct {
+		topic        string // The subscribe topic
+		overload     uint8  // The overload level of the server.
+		expectLoaded int    // How many messages were loaded?
+		success      bool   // Success or failure?
+	}{
+		{topic: "key/a/b/c/", expectLoaded: 1, success: true},
+		{topic: "key/a/b/c/?last=3", expectLoaded: 3, success: true},
+		{topic: "key/a/b/c/?retained=1", expectLoaded: 1, success: true},
+		{topic: "key/a/b/c/?retained=1&last=5", expectLoaded: 2, success: true},
+		{topic: fmt.Sprintf("key/a/b/c/?from=%d", now-60), expectLoaded: 7, success: true},
+		{topic: fmt.Sprintf("key/a/b/c/?from=%d&last=4", now-60), expectLoaded: 4, success: true},
+		{topic: fmt.Sprintf("key/a/b/c/?from=%d", now-60), overload: overload.PriorityHistory},
+		{topic: "key/a/b/c/?retained=1", overload: overload.PriorityHistory},
+	}
+
+	for _, tc := range tests {
+		store := storage.NewInMemory(nil)
+		store.Configure(nil)
+		auth := &fake.Authorizer{
+			Contract:  1,
+			Success:   true,
+			ExtraPerm: security.AllowLoad,
+		}
+
+		s := New(auth, store, new(fake.Notifier), &fake.Shedder{Level: tc.overload}, new(fake.Scheduler), message.NewTrie())
+		for i := 0; i < 7; i++ {
+			ttl := uint32(30)
+			if i == 1 || i == 3 {
+				ttl = message.RetainedTTL
+			}
+
+			store.Store(&message.Message{
+				ID:      message.NewID(ssid),
+				Channel: []byte("a/b/c/"),
+				Payload: []byte(fmt.Sprintf("%d", i)),
+				TTL:     ttl,
+			})
+		}
+
+		c := new(fake.Conn)
+		err := s.OnSubscribe(c, []byte(tc.topic))
+		assert.Equal(t, tc.success, err == nil, tc.topic)
+		assert.Equal(t, tc.expectLoaded, len(c.Outgoing), tc.topic)
+		if strings.Contains(tc.topic, "retained") && tc.success {
+			assert.Equal(t, "3", string(c.Outgoing[len(c.Outgoing)-1].Payload))
+		}
+	}
+}
+
+func TestPubSub_SubscribeRewind(t *testing.T) {
+	ssid := message.Ssid{1, 3238259379, 500706888, 1027807523}
+	tests := []struct {
+		topic        string // The subscribe topic
+		extraPerm    uint8  // Extra key permission
+		rewind       bool   // Whether the rewind is enabled
+		expectLoaded int    // How many messages were sent?
+	}{
+		{topic: "key/a/b/c/", rewind: true, expectLoaded: 0},
+		{topic: "key/a/b/c/?rewind=5", rewind: false, expectLoaded: 0},
+		{topic: "key/a/b/c/?rewind=5", rewind: true, expectLoaded: 3},
+		{topic: "key/a/b/?rewind=5s", rewind: true, expectLoaded: 3},
+		{topic: "key/a/b/c/?rewind=5&last=2", extraPerm: security.AllowLoad, rewind: true, expectLoaded: 3},
+	}
+
+	for _, tc := range tests {
+		store := storage.NewInMemory(nil)
+		store.Configure(nil)
+		trie := message.NewTrie()
+		auth := &fake.Authorizer{
+			Contract:  1,
+			Success:   true,
+			ExtraPerm: tc.extraPerm,
+		}
+
+		s := New(auth, store, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), trie)
+		if tc.rewind {
+			s.UseRewind(10*time.Second, 16)
+		}
+
+		// Publish a few messages, some of them stored, before anyone subscribes
+		for i := 0; i < 3; i++ {
+			m := &message.Message{
+				ID:      message.NewID(ssid),
+				Channel: []byte("a/b/c/"),
+				Payload: []byte("hello"),
+				TTL:     30,
+			}
+
+			s.Publish(m, nil)
+			store.Store(m)
+		}
+
+		c := new(fake.Conn)
+		assert.Nil(t, s.OnSubscribe(c, []byte(tc.topic)))
+		assert.Equal(t, tc.expectLoaded, len(c.Outgoing), tc.topic)
+	}
+}
+
 func TestPubSub_Subscribe_Buggy(t *testing.T) {
 	tests := []struct {
 		contract     int    // The contract ID
@@ -144,7 +363,7 @@ func TestPubSub_Subscribe_Buggy(t *testing.T) {
 		}
 
 		// Create new service
-		s := New(auth, new(buggyStore), new(fake.Notifier), trie)
+		s := New(auth, new(buggyStore), new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), trie)
 		c := &fake.Conn{
 			Disabled: tc.disabled,
 		}
@@ -181,6 +400,14 @@ func (s *buggyStore) Query(ssid message.Ssid, from, until time.Time, limit int)
 	return nil, errors.New("not working")
 }
 
+func (s *buggyStore) Delete(ssid message.Ssid, from, until time.Time) error {
+	return errors.New("not working")
+}
+
+func (s *buggyStore) GC() error {
+	return errors.New("not working")
+}
+
 func (s *buggyStore) Close() error {
 	return errors.New("not working")
 }
@@ -0,0 +1,161 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/kelindar/binary/nocopy"
+)
+
+// SubscriptionRequest represents a request to subscribe or unsubscribe.
+type SubscriptionRequest struct {
+	Key     string `json:"key,omitempty"`     // The key for the channel to subscribe to.
+	Channel string `json:"channel,omitempty"` // The channel to subscribe to.
+	ID      uint32 `json:"id,omitempty"`      // The identifier of the subscription to unsubscribe.
+}
+
+// SubscriptionResponse represents a response to a subscription request.
+type SubscriptionResponse struct {
+	Request   uint16 `json:"req,omitempty"`       // The corresponding request ID.
+	Status    int    `json:"status"`              // The status of the response.
+	ID        uint32 `json:"id"`                  // The identifier of the subscription.
+	Channel   string `json:"channel"`             // The channel of the subscription.
+	Duplicate bool   `json:"duplicate,omitempty"` // Whether the subscription already existed.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *SubscriptionResponse) ForRequest(id uint16) {
+	r.Request = id
+}
+
+// SubscriptionsResponse represents a response listing the subscriptions of a connection.
+type SubscriptionsResponse struct {
+	Request       uint16         `json:"req,omitempty"` // The corresponding request ID.
+	Status        int            `json:"status"`        // The status of the response.
+	Subscriptions []Subscription `json:"subscriptions"` // The subscriptions of the connection.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *SubscriptionsResponse) ForRequest(id uint16) {
+	r.Request = id
+}
+
+// Subscription represents a subscription of a connection.
+type Subscription struct {
+	ID        uint32 `json:"id"`               // The identifier of the subscription.
+	Channel   string `json:"channel"`          // The channel of the subscription.
+	Delivered int64  `json:"delivered"`        // The number of messages delivered through it.
+	NoEcho    bool   `json:"noEcho,omitempty"` // Whether the messages of the connection itself are excluded.
+	Filter    string `json:"filter,omitempty"` // The selector of the messages delivered, if any.
+}
+
+// ------------------------------------------------------------------------------------
+
+// OnSubscribeRequest handles a request to subscribe, returning the identifier of the
+// subscription. Unlike the MQTT subscribe, this is idempotent and subscribing to the
+// same channel again returns the existing subscription.
+func (s *Service) OnSubscribeRequest(c service.Conn, payload []byte) (service.Response, bool) {
+	var request SubscriptionRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return errors.ErrBadRequest, false
+	}
+
+	channel := security.MakeChannel(request.Key, request.Channel)
+	if channel.ChannelType == security.ChannelInvalid {
+		return errors.ErrBadRequest, false
+	}
+
+	ssid, duplicate, err := s.subscribe(c, []byte(channel.String()), true)
+	if err != nil {
+		return err, false
+	}
+
+	sub, ok := c.Subscriptions().Get(ssid)
+	if !ok {
+		return errors.ErrServerError, false
+	}
+
+	return &SubscriptionResponse{
+		Status:    200,
+		ID:        sub.ID,
+		Channel:   string(sub.Channel),
+		Duplicate: duplicate,
+	}, true
+}
+
+// OnUnsubscribeRequest handles a request to unsubscribe by the identifier of the
+// subscription. The subscription is removed entirely, even if the connection has
+// subscribed to its channel several times.
+func (s *Service) OnUnsubscribeRequest(c service.Conn, payload []byte) (service.Response, bool) {
+	var request SubscriptionRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return errors.ErrBadRequest, false
+	}
+
+	sub, ok := c.Subscriptions().GetByID(request.ID)
+	if !ok {
+		return errors.ErrNotFound, false
+	}
+
+	ev := &event.Subscription{
+		Conn:    c.LocalID(),
+		User:    nocopy.String(c.Username()),
+		Ssid:    sub.Ssid,
+		Channel: sub.Channel,
+	}
+
+	for i := 0; i < sub.Counter; i++ {
+		s.Unsubscribe(c, ev)
+	}
+
+	return &SubscriptionResponse{
+		Status:  200,
+		ID:      sub.ID,
+		Channel: string(sub.Channel),
+	}, true
+}
+
+// OnSubscriptionsRequest handles a request to list the subscriptions of the connection.
+func (s *Service) OnSubscriptionsRequest(c service.Conn, payload []byte) (service.Response, bool) {
+	counters := c.Subscriptions().All()
+	subs := make([]Subscription, 0, len(counters))
+	for _, v := range counters {
+		sub := Subscription{
+			ID:        v.ID,
+			Channel:   string(v.Channel),
+			Delivered: v.Delivered,
+			NoEcho:    v.NoEcho,
+		}
+		if v.Filter != nil {
+			sub.Filter = v.Filter.String()
+		}
+		subs = append(subs, sub)
+	}
+
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].ID < subs[j].ID
+	})
+
+	return &SubscriptionsResponse{
+		Status:        200,
+		Subscriptions: subs,
+	}, true
+}
@@ -0,0 +1,105 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSubscriptions() (*Service, *message.Trie) {
+	trie := message.NewTrie()
+	auth := &fake.Authorizer{
+		Contract: 1,
+		Success:  true,
+	}
+
+	return New(auth, nil, new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), trie), trie
+}
+
+func TestPubSub_OnSubscribeRequest(t *testing.T) {
+	s, trie := newTestSubscriptions()
+	c := new(fake.Conn)
+
+	// Bad requests
+	_, ok := s.OnSubscribeRequest(c, []byte("{"))
+	assert.False(t, ok)
+	_, ok = s.OnSubscribeRequest(c, []byte(`{"key":"key","channel":""}`))
+	assert.False(t, ok)
+
+	// Subscribe for the first time
+	resp, ok := s.OnSubscribeRequest(c, []byte(`{"key":"key","channel":"a/b/"}`))
+	assert.True(t, ok)
+	first := resp.(*SubscriptionResponse)
+	assert.Equal(t, 200, first.Status)
+	assert.Equal(t, "a/b/", first.Channel)
+	assert.False(t, first.Duplicate)
+
+	// Subscribe again, the subscription is not repeated
+	resp, ok = s.OnSubscribeRequest(c, []byte(`{"key":"key","channel":"a/b/"}`))
+	assert.True(t, ok)
+	second := resp.(*SubscriptionResponse)
+	assert.Equal(t, first.ID, second.ID)
+	assert.True(t, second.Duplicate)
+	assert.Equal(t, 1, trie.Count())
+
+	sub, _ := c.Subscriptions().GetByID(first.ID)
+	assert.Equal(t, 1, sub.Counter)
+}
+
+func TestPubSub_OnUnsubscribeRequest(t *testing.T) {
+	s, trie := newTestSubscriptions()
+	c := new(fake.Conn)
+
+	// Subscribe twice through MQTT
+	assert.Nil(t, s.OnSubscribe(c, []byte("key/a/b/")))
+	assert.Nil(t, s.OnSubscribe(c, []byte("key/a/b/")))
+	sub := c.Subscriptions().All()[0]
+	assert.Equal(t, 2, sub.Counter)
+
+	// Bad request and unknown subscription
+	_, ok := s.OnUnsubscribeRequest(c, []byte("{"))
+	assert.False(t, ok)
+	_, ok = s.OnUnsubscribeRequest(c, []byte(`{"id":999}`))
+	assert.False(t, ok)
+
+	// Unsubscribe by ID removes the subscription entirely
+	resp, ok := s.OnUnsubscribeRequest(c, []byte(`{"id":1}`))
+	assert.True(t, ok)
+	assert.Equal(t, "a/b/", resp.(*SubscriptionResponse).Channel)
+	assert.Equal(t, 0, trie.Count())
+	assert.Empty(t, c.Subscriptions().All())
+}
+
+func TestPubSub_OnSubscriptionsRequest(t *testing.T) {
+	s, _ := newTestSubscriptions()
+	c := new(fake.Conn)
+	assert.Nil(t, s.OnSubscribe(c, []byte("key/a/")))
+	assert.Nil(t, s.OnSubscribe(c, []byte("key/b/")))
+	c.Subscriptions().Attribute(message.NewID(message.NewSsid(1, []uint32{3238259379})))
+
+	resp, ok := s.OnSubscriptionsRequest(c, nil)
+	assert.True(t, ok)
+
+	subs := resp.(*SubscriptionsResponse).Subscriptions
+	assert.Len(t, subs, 2)
+	assert.Equal(t, uint32(1), subs[0].ID)
+	assert.Equal(t, "a/", subs[0].Channel)
+	assert.Equal(t, uint32(2), subs[1].ID)
+	assert.Equal(t, "b/", subs[1].Channel)
+}
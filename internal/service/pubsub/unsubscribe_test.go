@@ -77,7 +77,7 @@ func TestPubSub_Unsubscribe(t *testing.T) {
 		}
 
 		// Create new service
-		s := New(auth, storage.NewNoop(), new(fake.Notifier), trie)
+		s := New(auth, storage.NewNoop(), new(fake.Notifier), new(fake.Shedder), new(fake.Scheduler), trie)
 
 		// Register few subscribers
 		for i := 0; i < 10; i++ {
@@ -0,0 +1,222 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package reply
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/kelindar/binary/nocopy"
+)
+
+const (
+	defaultTimeout = 10 * time.Second  // The default duration to wait for a response.
+	maxTimeout     = 300 * time.Second // The maximum duration to wait for a response.
+)
+
+// Service represents a request/reply service. A request is published along with a reply
+// channel generated for it and a key which only allows to publish on that channel until
+// the request times out, so the responders do not need any key of their own. The first
+// response is delivered to the requester, otherwise it is notified of the timeout.
+type Service struct {
+	auth   service.Authorizer // The authorizer to use.
+	keys   service.Encryptor  // The encryptor of the reply keys.
+	pubsub service.PubSub     // The pub/sub service to use.
+}
+
+// New creates a new request/reply service.
+func New(auth service.Authorizer, keys service.Encryptor, pubsub service.PubSub) *Service {
+	return &Service{
+		auth:   auth,
+		keys:   keys,
+		pubsub: pubsub,
+	}
+}
+
+// OnRequest handles a request to be answered by a responder.
+func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, bool) {
+	var request Request
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return errors.ErrBadRequest, false
+	}
+
+	// Requests should only be published on static channels
+	channel := security.MakeChannel(request.Key, request.Channel)
+	if channel.ChannelType != security.ChannelStatic {
+		return errors.ErrBadRequest, false
+	}
+
+	// Check the authorization and permissions
+	contract, key, allowed := s.auth.Authorize(channel, security.AllowWrite)
+	if !allowed {
+		return errors.ErrUnauthorized, false
+	}
+
+	// Generate the correlation identifier along with the reply channel
+	id, err := newCorrelationID()
+	if err != nil {
+		return errors.ErrServerError, false
+	}
+
+	timeout := timeoutOf(request.Timeout)
+	replyChannel := "emitter/reply/" + id + "/"
+	replyKey, err := s.replyKey(key, replyChannel, timeout)
+	if err != nil {
+		return errors.ErrServerError, false
+	}
+
+	// Wait for the response before publishing the request
+	target := security.ParseChannel([]byte(replyKey + "/" + replyChannel))
+	w := &waiter{
+		luid:   security.NewID(),
+		id:     id,
+		conn:   c,
+		pubsub: s.pubsub,
+	}
+
+	w.sub = event.Subscription{
+		Conn:    w.luid,
+		User:    nocopy.String(c.Username()),
+		Ssid:    message.NewSsid(key.Contract(), target.Query),
+		Channel: target.Channel,
+	}
+
+	s.pubsub.Subscribe(w, &w.sub)
+	w.timer = time.AfterFunc(timeout, w.expire)
+
+	// Publish the request to the responders
+	envelope, _ := json.Marshal(&Envelope{
+		ID:      id,
+		Reply:   replyKey + "/" + replyChannel,
+		Payload: request.Payload,
+	})
+
+	c.Track(contract)
+	contract.Stats().AddIngress(int64(len(request.Payload)))
+	contract.Stats().AddEgress(s.pubsub.Publish(message.New(
+		message.NewSsid(key.Contract(), channel.Query),
+		channel.Channel,
+		envelope,
+	), nil))
+
+	return &Response{
+		Status:  200,
+		ID:      id,
+		Channel: replyChannel,
+	}, true
+}
+
+// replyKey creates the key allowing to publish the response on the reply channel, until
+// the request times out.
+func (s *Service) replyKey(key security.Key, channel string, timeout time.Duration) (string, error) {
+	reply := security.Key(make([]byte, 24))
+	copy(reply, key)
+	reply.SetPermissions(security.AllowWrite)
+	reply.SetExpires(time.Now().Add(timeout))
+	if err := reply.SetTarget(channel); err != nil {
+		return "", err
+	}
+
+	return s.keys.EncryptKey(reply)
+}
+
+// newCorrelationID generates a random correlation identifier.
+func newCorrelationID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// timeoutOf returns the duration to wait for a response.
+func timeoutOf(seconds int) time.Duration {
+	timeout := time.Duration(seconds) * time.Second
+	switch {
+	case seconds <= 0:
+		return defaultTimeout
+	case timeout > maxTimeout:
+		return maxTimeout
+	default:
+		return timeout
+	}
+}
+
+// ------------------------------------------------------------------------------------
+
+// waiter represents a requester waiting for the response on its reply channel.
+type waiter struct {
+	luid   security.ID        // The locally unique id of the waiter.
+	id     string             // The correlation identifier of the request.
+	conn   service.Conn       // The connection of the requester.
+	sub    event.Subscription // The subscription to the reply channel.
+	pubsub service.PubSub     // The pub/sub service to use.
+	timer  *time.Timer        // The timer of the timeout.
+	done   uint32             // Whether the request completed.
+}
+
+// ID returns the unique identifier of the subsriber.
+func (w *waiter) ID() string {
+	return w.luid.Unique(0, "reply")
+}
+
+// Type returns the type of the subscriber.
+func (w *waiter) Type() message.SubscriberType {
+	return message.SubscriberDirect
+}
+
+// Send delivers the first response to the requester and stops waiting.
+func (w *waiter) Send(m *message.Message) error {
+	if !w.complete() {
+		return nil
+	}
+
+	w.timer.Stop()
+	return w.conn.Send(m)
+}
+
+// expire notifies the requester that no response was received in time.
+func (w *waiter) expire() {
+	if !w.complete() {
+		return
+	}
+
+	payload, _ := json.Marshal(&Timeout{
+		Status:  errors.ErrTimeout.Status,
+		Message: errors.ErrTimeout.Message,
+		ID:      w.id,
+	})
+
+	w.conn.Send(message.New(w.sub.Ssid, []byte("emitter/error/"), payload))
+}
+
+// complete marks the request as completed and stops waiting for the response. It returns
+// false if the request was already completed.
+func (w *waiter) complete() bool {
+	if !atomic.CompareAndSwapUint32(&w.done, 0, 1) {
+		return false
+	}
+
+	w.pubsub.Unsubscribe(w, &w.sub)
+	return true
+}
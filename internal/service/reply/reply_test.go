@@ -0,0 +1,133 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package reply
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/security/license"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService(t *testing.T, success bool) (*Service, *fake.PubSub, license.Cipher) {
+	l, err := license.Parse("N7XxQbUEPxJ_RIj4muLUdLGYtR1kdKe2AAAAAAAAAAI")
+	assert.NoError(t, err)
+	cipher, err := l.Cipher()
+	assert.NoError(t, err)
+
+	pubsub := new(fake.PubSub)
+	auth := &fake.Authorizer{Contract: 1, Success: success}
+	return New(auth, cipher, pubsub), pubsub, cipher
+}
+
+func TestReply_Invalid(t *testing.T) {
+	tests := []struct {
+		payload string
+		success bool
+		err     *errors.Error
+	}{
+		{payload: "{", success: true, err: errors.ErrBadRequest},
+		{payload: `{"key":"key","channel":"svc/+/"}`, success: true, err: errors.ErrBadRequest},
+		{payload: `{"key":"key","channel":"svc/compute/"}`, success: false, err: errors.ErrUnauthorized},
+	}
+
+	for _, tc := range tests {
+		s, _, _ := newTestService(t, tc.success)
+		resp, ok := s.OnRequest(new(fake.Conn), []byte(tc.payload))
+		assert.False(t, ok)
+		assert.Equal(t, tc.err, resp)
+	}
+}
+
+func TestReply_Respond(t *testing.T) {
+	s, pubsub, cipher := newTestService(t, true)
+	responder := new(fake.Conn)
+	ssid := message.NewSsid(1, security.MakeChannel("key", "svc/compute/").Query)
+	pubsub.Subscribe(responder, &event.Subscription{Ssid: ssid, Channel: []byte("svc/compute/")})
+
+	// Send the request and deliver it to the responder
+	requester := new(fake.Conn)
+	resp, ok := s.OnRequest(requester, []byte(`{"key":"key","channel":"svc/compute/","payload":"1+1","timeout":5}`))
+	assert.True(t, ok)
+	response := resp.(*Response)
+	assert.Equal(t, 200, response.Status)
+	assert.Equal(t, "emitter/reply/"+response.ID+"/", response.Channel)
+	assert.Len(t, responder.Outgoing, 1)
+
+	var envelope Envelope
+	assert.NoError(t, json.Unmarshal(responder.Outgoing[0].Payload, &envelope))
+	assert.Equal(t, response.ID, envelope.ID)
+	assert.Equal(t, "1+1", envelope.Payload)
+
+	// The reply key only allows to publish the response on the reply channel
+	reply := security.ParseChannel([]byte(envelope.Reply))
+	assert.Equal(t, response.Channel, string(reply.Channel))
+	key, err := cipher.DecryptKey(reply.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, security.AllowWrite, key.Permissions())
+	assert.True(t, key.ValidateChannel(reply))
+	assert.True(t, key.Expires().Before(time.Now().Add(6*time.Second)))
+	assert.False(t, key.ValidateChannel(security.ParseChannel([]byte(string(reply.Key)+"/svc/compute/"))))
+
+	// Only the first response is delivered to the requester
+	answer := message.New(message.NewSsid(1, reply.Query), reply.Channel, []byte("2"))
+	pubsub.Publish(answer, nil)
+	pubsub.Publish(answer, nil)
+	assert.Len(t, requester.Outgoing, 1)
+	assert.Equal(t, "2", string(requester.Outgoing[0].Payload))
+	assert.Empty(t, pubsub.Trie.Lookup(message.NewSsid(1, reply.Query), nil))
+}
+
+func TestReply_Timeout(t *testing.T) {
+	s, pubsub, _ := newTestService(t, true)
+	requester := new(fake.Conn)
+	resp, ok := s.OnRequest(requester, []byte(`{"key":"key","channel":"svc/compute/","timeout":5}`))
+	assert.True(t, ok)
+
+	// Expire the request, as if nobody answered
+	channel := security.ParseChannel([]byte("key/" + resp.(*Response).Channel))
+	ssid := message.NewSsid(1, channel.Query)
+	subs := pubsub.Trie.Lookup(ssid, nil)
+	assert.Len(t, subs, 1)
+	for _, sub := range subs {
+		w := sub.(*waiter)
+		assert.Equal(t, message.SubscriberDirect, w.Type())
+		w.timer.Stop()
+		w.expire()
+		w.expire()
+	}
+
+	assert.Empty(t, pubsub.Trie.Lookup(ssid, nil))
+	assert.Len(t, requester.Outgoing, 1)
+	assert.Equal(t, "emitter/error/", string(requester.Outgoing[0].Channel))
+
+	var timeout Timeout
+	assert.NoError(t, json.Unmarshal(requester.Outgoing[0].Payload, &timeout))
+	assert.Equal(t, 408, timeout.Status)
+	assert.Equal(t, resp.(*Response).ID, timeout.ID)
+}
+
+func TestTimeoutOf(t *testing.T) {
+	assert.Equal(t, defaultTimeout, timeoutOf(0))
+	assert.Equal(t, 5*time.Second, timeoutOf(5))
+	assert.Equal(t, maxTimeout, timeoutOf(3600))
+}
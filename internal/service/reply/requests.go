@@ -0,0 +1,56 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package reply
+
+// Request represents a request to be answered by a responder.
+type Request struct {
+	Key     string `json:"key"`               // The key for the channel.
+	Channel string `json:"channel"`           // The channel the request is published on.
+	Payload string `json:"payload"`           // The payload of the request.
+	Timeout int    `json:"timeout,omitempty"` // The number of seconds to wait for a response.
+}
+
+// ------------------------------------------------------------------------------------
+
+// Response represents the acknowledgement of a request.
+type Response struct {
+	Request uint16 `json:"req,omitempty"`     // The corresponding request ID.
+	Status  int    `json:"status"`            // The status of the response.
+	ID      string `json:"id,omitempty"`      // The correlation identifier of the request.
+	Channel string `json:"channel,omitempty"` // The channel the response is received on.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *Response) ForRequest(id uint16) {
+	r.Request = id
+}
+
+// ------------------------------------------------------------------------------------
+
+// Envelope represents a request, as delivered to the responders.
+type Envelope struct {
+	ID      string `json:"id"`      // The correlation identifier of the request.
+	Reply   string `json:"reply"`   // The key and the channel to publish the response on.
+	Payload string `json:"payload"` // The payload of the request.
+}
+
+// ------------------------------------------------------------------------------------
+
+// Timeout represents the notification that no response was received in time.
+type Timeout struct {
+	Status  int    `json:"status"`  // The status of the notification.
+	Message string `json:"message"` // The description of the timeout.
+	ID      string `json:"id"`      // The correlation identifier of the request.
+}
@@ -0,0 +1,274 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+// The actions a rule can apply to the messages matching it.
+const (
+	ActionRepublish = "republish" // Publishes a copy of the message on another channel.
+	ActionForward   = "forward"   // Posts the message to an HTTP endpoint.
+	ActionDrop      = "drop"      // Drops the message, which is not delivered nor stored.
+	ActionTag       = "tag"       // Attaches headers to the message.
+	ActionConnector = "connector" // Sends the message to a connector, such as a plugin.
+)
+
+const (
+	forwardTimeout     = 10 * time.Second // The time given to the endpoint to accept a message.
+	forwardConcurrency = 16               // The maximum number of messages forwarded or sent at once.
+)
+
+// Service implements the Router contract.
+var _ service.Router = new(Service)
+
+// Service represents the routing rules, which are applied in the order they were configured
+// to the messages published on the channels matching them.
+type Service struct {
+	pubsub service.PubSub // The pub/sub service to republish with.
+	rules  []*rule        // The rules configured.
+	client *http.Client   // The client to forward the messages with.
+	slots  chan struct{}  // The slots limiting the concurrent forwards.
+}
+
+// New creates the routing rules from their configuration. The connectors are the ones the
+// rules may send the messages to, by their name.
+func New(pubsub service.PubSub, configs []config.RuleConfig, connectors map[string]service.Connector) (*Service, error) {
+	s := &Service{
+		pubsub: pubsub,
+		client: &http.Client{Timeout: forwardTimeout},
+		slots:  make(chan struct{}, forwardConcurrency),
+	}
+
+	for i, cfg := range configs {
+		r, err := newRule(cfg, connectors)
+		if err != nil {
+			return nil, fmt.Errorf("rules: rule #%d %v", i+1, err)
+		}
+
+		s.rules = append(s.rules, r)
+	}
+	return s, nil
+}
+
+// Route applies the rules matching the contract and the channel of the message and returns
+// whether the message should still be delivered.
+func (s *Service) Route(m *message.Message) bool {
+	var segments []string
+	for _, r := range s.rules {
+		if r.contract != 0 && r.contract != m.Contract() {
+			continue
+		}
+
+		if segments == nil {
+			segments = security.SplitChannel(string(m.Channel))
+		}
+
+		if !r.matches(segments) {
+			continue
+		}
+
+		switch r.action {
+		case ActionDrop:
+			return false
+		case ActionTag:
+			tag(m, r.headers)
+		case ActionRepublish:
+			s.republish(m, r.target)
+		case ActionForward:
+			s.dispatch(m, "forwarding", func(msg *message.Message) error {
+				return s.post(msg, r.url)
+			})
+		case ActionConnector:
+			s.dispatch(m, "sending", r.connector.Send)
+		}
+
+		if r.final {
+			break
+		}
+	}
+	return true
+}
+
+// republish publishes a copy of the message on the target channel, within the same contract.
+func (s *Service) republish(m *message.Message, target *security.Channel) {
+	msg := message.NewOf(m.Contract(), target.Query, target.Channel, m.Payload)
+	msg.TTL = m.TTL
+	msg.Headers = copyHeaders(m.Headers)
+	s.pubsub.Publish(msg, nil)
+}
+
+// dispatch hands a copy of the message to the send function asynchronously. This blocks if
+// too many messages are being forwarded or sent already, slowing down the publisher.
+func (s *Service) dispatch(m *message.Message, what string, send func(*message.Message) error) {
+	msg := *m
+	msg.Headers = copyHeaders(m.Headers)
+
+	s.slots <- struct{}{}
+	go func() {
+		defer func() { <-s.slots }()
+		if err := send(&msg); err != nil {
+			logging.LogError("rules", what+" a message", err)
+		}
+	}()
+}
+
+// post posts the payload of the message to the endpoint.
+func (s *Service) post(m *message.Message, url string) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(m.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Emitter-Channel", string(m.Channel))
+	req.Header.Set("X-Emitter-Contract", strconv.FormatUint(uint64(m.Contract()), 10))
+	if m.TTL > 0 {
+		req.Header.Set("X-Emitter-TTL", strconv.FormatUint(uint64(m.TTL), 10))
+	}
+
+	for k, v := range m.Headers {
+		req.Header.Set("X-Emitter-Header-"+k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("rules: unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return nil
+}
+
+// tag attaches the headers to the message, overriding the ones it already has. The headers
+// beyond the maximum a message can carry are skipped.
+func tag(m *message.Message, headers message.Headers) {
+	if m.Headers == nil {
+		m.Headers = make(message.Headers, len(headers))
+	}
+
+	for k, v := range headers {
+		if _, ok := m.Headers[k]; ok || len(m.Headers) < message.MaxHeaders {
+			m.Headers[k] = v
+		}
+	}
+}
+
+// copyHeaders copies the headers of a message, since they may still be changed by the rules
+// following the ones which republish or forward it.
+func copyHeaders(headers message.Headers) message.Headers {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	out := make(message.Headers, len(headers))
+	for k, v := range headers {
+		out[k] = v
+	}
+	return out
+}
+
+// ------------------------------------------------------------------------------------
+
+// rule represents a routing rule.
+type rule struct {
+	contract  uint32             // The contract the rule is restricted to, if any.
+	patterns  []security.Pattern // The channel patterns the rule applies to.
+	action    string             // The action of the rule.
+	target    *security.Channel  // The channel to republish on.
+	url       string             // The endpoint to forward to.
+	headers   message.Headers    // The headers to tag with.
+	connector service.Connector  // The connector to send to.
+	final     bool               // Whether the following rules are skipped.
+}
+
+// newRule creates a new rule and checks that its action is complete.
+func newRule(cfg config.RuleConfig, connectors map[string]service.Connector) (*rule, error) {
+	r := &rule{
+		contract: cfg.Contract,
+		action:   cfg.Action,
+		final:    cfg.Final,
+	}
+
+	r.patterns = security.ParsePatterns(cfg.Channels)
+
+	if len(r.patterns) == 0 {
+		return nil, fmt.Errorf("does not specify the channels it applies to")
+	}
+
+	switch cfg.Action {
+	case ActionDrop:
+	case ActionRepublish:
+		r.target = security.ParseChannel([]byte("emitter/" + cfg.Target))
+		if r.target.ChannelType != security.ChannelStatic || len(r.target.Options) > 0 {
+			return nil, fmt.Errorf("republishes on '%s', which is not a valid static channel", cfg.Target)
+		}
+	case ActionForward:
+		if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+			return nil, fmt.Errorf("forwards to '%s', which is not an http or https endpoint", cfg.URL)
+		}
+		r.url = cfg.URL
+	case ActionTag:
+		headers, ok := parseHeaders(cfg.Headers)
+		if !ok {
+			return nil, fmt.Errorf("tags with '%s', which are not valid headers", cfg.Headers)
+		}
+		r.headers = headers
+	case ActionConnector:
+		connector, ok := connectors[cfg.Connector]
+		if !ok {
+			return nil, fmt.Errorf("sends to the connector '%s', which is not configured", cfg.Connector)
+		}
+		r.connector = connector
+	default:
+		return nil, fmt.Errorf("has the unsupported action '%s'", cfg.Action)
+	}
+	return r, nil
+}
+
+// matches checks whether the rule applies to the channel segments.
+func (r *rule) matches(segments []string) bool {
+	return security.MatchAny(r.patterns, segments)
+}
+
+// parseHeaders parses a comma-separated list of alphanumeric headers (e.g: 'zone=eu,tier=1').
+func parseHeaders(list string) (message.Headers, bool) {
+	headers := make(message.Headers)
+	for _, v := range strings.Split(list, ",") {
+		kv := strings.SplitN(strings.TrimSpace(v), "=", 2)
+		if len(kv) != 2 || !security.IsOption(kv[0]) || !security.IsOption(kv[1]) {
+			return nil, false
+		}
+		headers[kv[0]] = kv[1]
+	}
+	return headers, len(headers) <= message.MaxHeaders
+}
@@ -0,0 +1,151 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package rules
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMessage(contract uint32, channel, payload string) *message.Message {
+	ssid := message.NewSsid(contract, security.MakeChannel("key", channel).Query)
+	return message.New(ssid, []byte(channel), []byte(payload))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []config.RuleConfig{
+		{Channels: "", Action: ActionDrop},
+		{Channels: "a/", Action: "delete"},
+		{Channels: "a/", Action: ActionRepublish, Target: "b/+/"},
+		{Channels: "a/", Action: ActionRepublish, Target: "b/?ttl=5"},
+		{Channels: "a/", Action: ActionForward, URL: "ftp://example.com"},
+		{Channels: "a/", Action: ActionTag, Headers: "zone"},
+		{Channels: "a/", Action: ActionTag, Headers: "zone=e-u"},
+		{Channels: "a/", Action: ActionConnector, Connector: "kafka"},
+	}
+
+	for _, tc := range tests {
+		_, err := New(new(fake.PubSub), []config.RuleConfig{tc}, nil)
+		assert.Error(t, err)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	pubsub := new(fake.PubSub)
+	s, err := New(pubsub, []config.RuleConfig{
+		{Channels: "sensors/+/debug/", Action: ActionDrop},
+		{Channels: "sensors/+/", Action: ActionTag, Headers: "zone=eu, tier=1"},
+		{Channels: "sensors/+/alert/", Action: ActionRepublish, Target: "alerts/", Final: true},
+		{Channels: "sensors/", Action: ActionTag, Headers: "late=1"},
+		{Channels: "sensors/", Contract: 2, Action: ActionDrop},
+	}, nil)
+	assert.NoError(t, err)
+
+	sub := new(fake.Conn)
+	pubsub.Subscribe(sub, &event.Subscription{
+		Ssid:    message.NewSsid(1, security.MakeChannel("key", "alerts/").Query),
+		Channel: []byte("alerts/"),
+	})
+
+	// A dropped message skips the following rules
+	msg := newTestMessage(1, "sensors/s1/debug/", "a")
+	assert.False(t, s.Route(msg))
+	assert.Nil(t, msg.Headers)
+
+	// The rules apply in order, until a final one
+	msg = newTestMessage(1, "sensors/s1/alert/", "b")
+	assert.True(t, s.Route(msg))
+	assert.Equal(t, message.Headers{"zone": "eu", "tier": "1"}, msg.Headers)
+	assert.Len(t, sub.Outgoing, 1)
+	assert.Equal(t, "alerts/", string(sub.Outgoing[0].Channel))
+	assert.Equal(t, "b", string(sub.Outgoing[0].Payload))
+	assert.Equal(t, msg.Headers, sub.Outgoing[0].Headers)
+
+	msg = newTestMessage(1, "sensors/s1/", "c")
+	assert.True(t, s.Route(msg))
+	assert.Equal(t, message.Headers{"zone": "eu", "tier": "1", "late": "1"}, msg.Headers)
+	assert.Len(t, sub.Outgoing, 1)
+
+	// The rules of a contract only apply to it
+	assert.False(t, s.Route(newTestMessage(2, "sensors/s1/", "d")))
+	assert.True(t, s.Route(newTestMessage(1, "other/", "e")))
+}
+
+func TestRoute_Forward(t *testing.T) {
+	received := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Header.Set("X-Body", string(body))
+		received <- r.Header.Clone()
+	}))
+	defer server.Close()
+
+	s, err := New(new(fake.PubSub), []config.RuleConfig{
+		{Channels: "orders/", Action: ActionForward, URL: server.URL},
+	}, nil)
+	assert.NoError(t, err)
+
+	msg := newTestMessage(1, "orders/eu/", "hello")
+	msg.Headers = message.Headers{"trace": "abc"}
+	assert.True(t, s.Route(msg))
+
+	select {
+	case h := <-received:
+		assert.Equal(t, "hello", h.Get("X-Body"))
+		assert.Equal(t, "orders/eu/", h.Get("X-Emitter-Channel"))
+		assert.Equal(t, "1", h.Get("X-Emitter-Contract"))
+		assert.Equal(t, "abc", h.Get("X-Emitter-Header-trace"))
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the message was not forwarded")
+	}
+}
+
+func TestRoute_Connector(t *testing.T) {
+	connector := new(fake.Connector)
+	s, err := New(new(fake.PubSub), []config.RuleConfig{
+		{Channels: "orders/", Action: ActionConnector, Connector: "kafka"},
+	}, map[string]service.Connector{"kafka": connector})
+	assert.NoError(t, err)
+
+	msg := newTestMessage(1, "orders/eu/", "hello")
+	assert.True(t, s.Route(msg))
+	assert.Eventually(t, func() bool {
+		return len(connector.Messages()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	sent := connector.Messages()[0]
+	assert.Equal(t, "orders/eu/", string(sent.Channel))
+	assert.Equal(t, "hello", string(sent.Payload))
+}
+
+func TestTag_Limit(t *testing.T) {
+	msg := newTestMessage(1, "a/", "")
+	msg.Headers = message.Headers{"a": "1", "b": "1", "c": "1", "d": "1", "e": "1", "f": "1", "g": "1"}
+	tag(msg, message.Headers{"a": "2", "x": "2", "y": "2"})
+
+	assert.Len(t, msg.Headers, message.MaxHeaders)
+	assert.Equal(t, "2", msg.Headers["a"])
+}
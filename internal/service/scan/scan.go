@@ -0,0 +1,151 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package scan
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+const (
+	defaultTimeout     = 10 // The default number of seconds to wait for a verdict.
+	defaultConcurrency = 16 // The default number of messages scanned at once.
+)
+
+var (
+	errInvalidURL    = errors.New("scan: the url of the scanner must be an http or https endpoint")
+	errInvalidPolicy = errors.New("scan: the policy must be either 'hold' or 'retract'")
+)
+
+// Service implements the Scanner contract.
+var _ service.Scanner = new(Service)
+
+// Service represents a content scanner which posts the payloads of the messages published
+// on some channels to an HTTP endpoint (e.g: an antivirus) and relays its verdict.
+type Service struct {
+	url      string                // The endpoint of the scanner.
+	patterns []security.Pattern    // The channel patterns to scan.
+	hold     bool                  // Whether the messages are held until scanned.
+	failOpen bool                  // Whether the messages are clean when the scanner fails.
+	headers  message.HeaderMapping // The headers sent to the scanner, all if nil.
+	client   *http.Client          // The client to use for the requests.
+	slots    chan struct{}         // The slots limiting the concurrent scans.
+}
+
+// New creates a new content scanner.
+func New(cfg *config.ScanConfig) (*Service, error) {
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		return nil, errInvalidURL
+	}
+
+	if cfg.Policy != "" && cfg.Policy != "hold" && cfg.Policy != "retract" {
+		return nil, errInvalidPolicy
+	}
+
+	timeout, concurrency := cfg.Timeout, cfg.Concurrency
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	s := &Service{
+		url:      cfg.URL,
+		hold:     cfg.Policy == "hold",
+		failOpen: cfg.FailOpen,
+		headers:  message.ParseHeaderMapping(cfg.Headers),
+		client:   &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		slots:    make(chan struct{}, concurrency),
+	}
+
+	s.patterns = security.ParsePatterns(cfg.Channels)
+	return s, nil
+}
+
+// Matches checks whether the messages published on the channel must be scanned.
+func (s *Service) Matches(channel []byte) bool {
+	return security.MatchAny(s.patterns, security.SplitChannel(string(channel)))
+}
+
+// Holds checks whether the messages are held until scanned, instead of being delivered
+// right away and retracted if rejected.
+func (s *Service) Holds() bool {
+	return s.hold
+}
+
+// Scan scans the message asynchronously and calls back with the verdict. This blocks if
+// too many messages are being scanned already, slowing down the publisher.
+func (s *Service) Scan(m *message.Message, verdict func(bool)) {
+	s.slots <- struct{}{}
+	go func() {
+		defer func() { <-s.slots }()
+		clean, err := s.check(m)
+		if err != nil {
+			logging.LogError("scan", "scanning content", err)
+			clean = s.failOpen
+		}
+
+		verdict(clean)
+	}()
+}
+
+// check posts the payload to the scanner and returns whether the content is clean.
+func (s *Service) check(m *message.Message) (bool, error) {
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(m.Payload))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Emitter-Channel", string(m.Channel))
+	if m.TTL > 0 {
+		req.Header.Set("X-Emitter-TTL", strconv.FormatUint(uint64(m.TTL), 10))
+	}
+
+	for k, v := range s.headers.Apply(m.Headers) {
+		req.Header.Set("X-Emitter-Header-"+k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return true, nil
+	case resp.StatusCode == http.StatusForbidden,
+		resp.StatusCode == http.StatusNotAcceptable,
+		resp.StatusCode == http.StatusUnavailableForLegalReasons:
+		return false, nil
+	default:
+		return false, fmt.Errorf("scan: unexpected status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,156 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package scan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		cfg config.ScanConfig
+		err error
+	}{
+		{cfg: config.ScanConfig{URL: "icap://localhost"}, err: errInvalidURL},
+		{cfg: config.ScanConfig{URL: "http://localhost", Policy: "drop"}, err: errInvalidPolicy},
+		{cfg: config.ScanConfig{URL: "http://localhost", Policy: "hold"}},
+		{cfg: config.ScanConfig{URL: "https://localhost"}},
+	}
+
+	for _, tc := range tests {
+		s, err := New(&tc.cfg)
+		assert.Equal(t, tc.err, err)
+		if err == nil {
+			assert.Equal(t, tc.cfg.Policy == "hold", s.Holds())
+			assert.Equal(t, defaultConcurrency, cap(s.slots))
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	s, err := New(&config.ScanConfig{
+		URL:      "http://localhost",
+		Channels: "uploads/+/, chat/a%2Fb/",
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		channel string
+		match   bool
+	}{
+		{channel: "uploads/1/", match: true},
+		{channel: "uploads/1/images/", match: true},
+		{channel: "uploads/", match: false},
+		{channel: "chat/a%2fb/", match: true},
+		{channel: "chat/a/b/", match: false},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.match, s.Matches([]byte(tc.channel)), tc.channel)
+	}
+}
+
+func TestScan(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "a/b/", r.Header.Get("X-Emitter-Channel"))
+		switch string(body) {
+		case "clean":
+			w.WriteHeader(http.StatusOK)
+		case "virus":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		payload  string
+		failOpen bool
+		clean    bool
+	}{
+		{payload: "clean", clean: true},
+		{payload: "virus", clean: false},
+		{payload: "virus", failOpen: true, clean: false},
+		{payload: "error", clean: false},
+		{payload: "error", failOpen: true, clean: true},
+	}
+
+	for _, tc := range tests {
+		s, err := New(&config.ScanConfig{
+			URL:      server.URL,
+			FailOpen: tc.failOpen,
+		})
+		assert.NoError(t, err)
+
+		verdict := make(chan bool, 1)
+		s.Scan(message.New(message.Ssid{1, 2}, []byte("a/b/"), []byte(tc.payload)), func(clean bool) {
+			verdict <- clean
+		})
+		assert.Equal(t, tc.clean, <-verdict, tc.payload)
+	}
+}
+
+func TestScan_Headers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "60", r.Header.Get("X-Emitter-TTL"))
+		assert.Equal(t, "abc", r.Header.Get("X-Emitter-Header-Trace"))
+		assert.Equal(t, "eu", r.Header.Get("X-Emitter-Header-Region"))
+		assert.Empty(t, r.Header.Get("X-Emitter-Header-Zone"))
+		assert.Empty(t, r.Header.Get("X-Emitter-Header-User"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s, err := New(&config.ScanConfig{
+		URL:     server.URL,
+		Headers: "trace,zone=region",
+	})
+	assert.NoError(t, err)
+
+	m := message.New(message.Ssid{1, 2}, []byte("a/b/"), []byte("clean"))
+	m.TTL = 60
+	m.Headers = message.Headers{"trace": "abc", "zone": "eu", "user": "bob"}
+	clean, err := s.check(m)
+	assert.NoError(t, err)
+	assert.True(t, clean)
+}
+
+func TestNewTombstone(t *testing.T) {
+	m := message.New(message.Ssid{1, 2, 3}, []byte("a/b/"), []byte("virus"))
+	ts := NewTombstone(m)
+	assert.Equal(t, m.Ssid(), ts.Ssid())
+	assert.Equal(t, "emitter/retract/", string(ts.Channel))
+
+	var out Tombstone
+	digest := sha256.Sum256([]byte("virus"))
+	assert.NoError(t, json.Unmarshal(ts.Payload, &out))
+	assert.Equal(t, Tombstone{
+		Channel: "a/b/",
+		Time:    m.Time(),
+		Digest:  hex.EncodeToString(digest[:]),
+	}, out)
+}
@@ -0,0 +1,48 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package scan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/emitter-io/emitter/internal/message"
+)
+
+var (
+	tombstone = []byte("emitter/retract/")
+)
+
+// Tombstone represents a notification that a message, delivered before being scanned, was
+// rejected by the scanner and should be retracted by its subscribers.
+type Tombstone struct {
+	Channel string `json:"channel"` // The channel of the message.
+	Time    int64  `json:"time"`    // The unix time of the message.
+	Digest  string `json:"digest"`  // The hex encoded SHA-256 digest of the payload.
+}
+
+// NewTombstone creates a tombstone message, which is sent to the subscribers of the
+// message retracted.
+func NewTombstone(m *message.Message) *message.Message {
+	digest := sha256.Sum256(m.Payload)
+	payload, _ := json.Marshal(&Tombstone{
+		Channel: string(m.Channel),
+		Time:    m.Time(),
+		Digest:  hex.EncodeToString(digest[:]),
+	})
+
+	return message.New(m.Ssid(), tombstone, payload)
+}
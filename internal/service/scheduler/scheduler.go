@@ -0,0 +1,310 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxQueueSize is the maximum number of tasks queued per contract, past which the callers
+// scheduling more tasks wait for room in the queue.
+const MaxQueueSize = 10000
+
+const (
+	smoothing   = 0.1         // The weight of the latest sample in the moving average of delays.
+	idleTimeout = time.Minute // The time after which the delays of an idle contract are forgotten.
+)
+
+// Scheduler schedules the work of multiple tenants (contracts) fairly, using a weighted
+// deficit round-robin over per-contract queues. The tasks of a single contract are always
+// executed in order, by at most one worker at a time, so a burst of one tenant can never
+// occupy more than its share of the workers.
+type Scheduler struct {
+	sync.Mutex
+	cond    *sync.Cond        // Signals the workers that a queue is ready.
+	drained *sync.Cond        // Signals the callers waiting for the queues to drain.
+	weight  func(uint32) int  // The function which returns the weight of a contract.
+	queues  map[uint32]*queue // The queues, per contract.
+	ready   []*queue          // The queues which are waiting for a worker.
+	delays  map[uint32]*delay // The moving average of the scheduling delays, per contract.
+	pruned  time.Time         // The last time the delays of the idle contracts were pruned.
+	workers int               // The number of workers.
+	closed  bool              // Whether the scheduler is closed.
+	wg      sync.WaitGroup    // The wait group for the workers.
+}
+
+// delay represents the moving average of the scheduling delays of a contract.
+type delay struct {
+	average float64   // The moving average, in nanoseconds.
+	updated time.Time // The last time a task of the contract was executed.
+}
+
+// queue represents a queue of tasks of a contract.
+type queue struct {
+	contract uint32 // The contract of the queue.
+	weight   int    // The number of tasks executed per round.
+	tasks    []task // The pending tasks.
+	busy     bool   // Whether the queue is being processed by a worker.
+}
+
+// task represents a scheduled unit of work.
+type task struct {
+	fn       func()    // The function to execute.
+	enqueued time.Time // The time when the task was scheduled.
+}
+
+// New creates a new scheduler with the specified number of workers. The weight function
+// returns the number of tasks a contract can execute per round. If the number of workers
+// is zero, the tasks are executed synchronously, within the caller.
+func New(workers int, weight func(uint32) int) *Scheduler {
+	s := &Scheduler{
+		weight:  weight,
+		queues:  make(map[uint32]*queue),
+		delays:  make(map[uint32]*delay),
+		pruned:  time.Now(),
+		workers: workers,
+	}
+
+	s.cond = sync.NewCond(&s.Mutex)
+	s.drained = sync.NewCond(&s.Mutex)
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.process()
+	}
+	return s
+}
+
+// Schedule schedules a task on behalf of a contract. If the queue of the contract is full,
+// the caller is blocked until there is room in the queue, which slows down only the
+// bursting tenant and keeps its tasks in order. A task must therefore never schedule
+// another task of its own contract this way, but enqueue it instead.
+func (s *Scheduler) Schedule(contract uint32, fn func()) {
+	s.schedule(contract, fn, true)
+}
+
+// Enqueue schedules a task on behalf of a contract without waiting for room in its queue,
+// which may then grow past its limit. This is meant for the tasks scheduled by the tasks of
+// the same contract (e.g: the dead letters of a delivery), since the worker waiting for its
+// own queue to drain would never wake up.
+func (s *Scheduler) Enqueue(contract uint32, fn func()) {
+	s.schedule(contract, fn, false)
+}
+
+// schedule schedules a task on behalf of a contract, optionally waiting for room in the
+// queue of the contract if it is full.
+func (s *Scheduler) schedule(contract uint32, fn func(), wait bool) {
+	if s.workers <= 0 {
+		fn()
+		return
+	}
+
+	// Get the weight outside of the lock, as it might require to fetch the contract
+	weight := s.weight(contract)
+	if weight <= 0 {
+		weight = 1
+	}
+
+	s.Lock()
+	q, ok := s.queues[contract]
+	for wait && ok && len(q.tasks) >= MaxQueueSize && !s.closed {
+		s.drained.Wait()
+		q, ok = s.queues[contract]
+	}
+
+	// Once the scheduler is closed, the tasks are executed synchronously, unless the tasks
+	// of the contract are still being executed by the workers which keep going until every
+	// queue is empty.
+	if !ok && s.closed {
+		s.Unlock()
+		fn()
+		return
+	}
+
+	if !ok {
+		q = &queue{contract: contract}
+		s.queues[contract] = q
+	}
+	q.weight = weight
+	q.tasks = append(q.tasks, task{fn: fn, enqueued: time.Now()})
+	if len(q.tasks) == 1 && !q.busy {
+		s.ready = append(s.ready, q)
+		s.cond.Signal()
+	}
+	s.Unlock()
+}
+
+// process executes the scheduled tasks until the scheduler is closed.
+func (s *Scheduler) process() {
+	defer s.wg.Done()
+	for {
+		q, batch, ok := s.next()
+		if !ok {
+			return
+		}
+
+		for _, t := range batch {
+			t.fn()
+		}
+
+		s.release(q)
+	}
+}
+
+// next waits for the next queue to be ready and takes its batch of tasks.
+func (s *Scheduler) next() (*queue, []task, bool) {
+	s.Lock()
+	defer s.Unlock()
+	for len(s.ready) == 0 {
+		if s.closed {
+			return nil, nil, false
+		}
+		s.cond.Wait()
+	}
+
+	q := s.ready[0]
+	s.ready = s.ready[1:]
+	q.busy = true
+
+	// Take as many tasks as the weight of the contract allows
+	n := q.weight
+	if n > len(q.tasks) {
+		n = len(q.tasks)
+	}
+
+	full := len(q.tasks) >= MaxQueueSize
+	batch := make([]task, n)
+	copy(batch, q.tasks)
+	q.tasks = q.tasks[n:]
+
+	// Wake up the callers waiting for room in the queue
+	if full && n > 0 {
+		s.drained.Broadcast()
+	}
+
+	// Update the scheduling delays of the contract
+	now := time.Now()
+	d, ok := s.delays[q.contract]
+	if !ok {
+		d = new(delay)
+		s.delays[q.contract] = d
+	}
+
+	d.updated = now
+	for _, t := range batch {
+		d.average = smoothing*float64(now.Sub(t.enqueued)) + (1-smoothing)*d.average
+	}
+
+	s.prune(now)
+	return q, batch, true
+}
+
+// prune forgets the delays of the contracts which have been idle for a while. This must
+// be called while holding the lock.
+func (s *Scheduler) prune(now time.Time) {
+	if now.Sub(s.pruned) < idleTimeout {
+		return
+	}
+
+	s.pruned = now
+	for contract, d := range s.delays {
+		if _, queued := s.queues[contract]; !queued && now.Sub(d.updated) >= idleTimeout {
+			delete(s.delays, contract)
+		}
+	}
+}
+
+// release puts the queue back in the round-robin if there are tasks remaining.
+func (s *Scheduler) release(q *queue) {
+	s.Lock()
+	defer s.Unlock()
+
+	q.busy = false
+	switch {
+	case len(q.tasks) > 0:
+		s.ready = append(s.ready, q)
+		s.cond.Signal()
+	default:
+		delete(s.queues, q.contract)
+		if len(s.queues) == 0 {
+			s.drained.Broadcast()
+		}
+	}
+}
+
+// Wait waits until all of the queued tasks are executed or the timeout elapses, and
+// returns whether the scheduler is idle.
+func (s *Scheduler) Wait(timeout time.Duration) bool {
+	var expired bool
+	timer := time.AfterFunc(timeout, func() {
+		s.Lock()
+		expired = true
+		s.drained.Broadcast()
+		s.Unlock()
+	})
+	defer timer.Stop()
+
+	s.Lock()
+	defer s.Unlock()
+	for len(s.queues) > 0 && !expired {
+		s.drained.Wait()
+	}
+	return len(s.queues) == 0
+}
+
+// Delays returns the scheduling delays, per contract.
+func (s *Scheduler) Delays() []Delay {
+	s.Lock()
+	defer s.Unlock()
+
+	out := make([]Delay, 0, len(s.delays))
+	for contract, d := range s.delays {
+		var queued int
+		if q, ok := s.queues[contract]; ok {
+			queued = len(q.tasks)
+		}
+
+		out = append(out, Delay{
+			Contract: contract,
+			Delay:    time.Duration(d.average).Seconds() * 1000,
+			Queued:   queued,
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Delay > out[j].Delay })
+	return out
+}
+
+// Close stops the workers, once all of the queued tasks are executed.
+func (s *Scheduler) Close() error {
+	s.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.drained.Broadcast()
+	s.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// ------------------------------------------------------------------------------------
+
+// Delay represents the scheduling delay of a contract.
+type Delay struct {
+	Contract uint32  `json:"contract"` // The contract.
+	Delay    float64 `json:"delay"`    // The average scheduling delay, in milliseconds.
+	Queued   int     `json:"queued"`   // The number of tasks currently queued.
+}
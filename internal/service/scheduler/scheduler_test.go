@@ -0,0 +1,206 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package scheduler
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler_Inline(t *testing.T) {
+	s := New(0, func(uint32) int { return 1 })
+	defer s.Close()
+
+	var count int
+	s.Schedule(1, func() { count++ })
+	assert.Equal(t, 1, count)
+	assert.Empty(t, s.Delays())
+}
+
+func TestScheduler_Order(t *testing.T) {
+	s := New(4, func(uint32) int { return 3 })
+
+	var mu sync.Mutex
+	out := make(map[uint32][]int)
+	for i := 0; i < 100; i++ {
+		for c := uint32(1); c <= 3; c++ {
+			contract, value := c, i
+			s.Schedule(contract, func() {
+				mu.Lock()
+				out[contract] = append(out[contract], value)
+				mu.Unlock()
+			})
+		}
+	}
+
+	assert.NoError(t, s.Close())
+	for c := uint32(1); c <= 3; c++ {
+		assert.Len(t, out[c], 100)
+		for i, v := range out[c] {
+			assert.Equal(t, i, v)
+		}
+	}
+}
+
+func TestScheduler_Fairness(t *testing.T) {
+	s := New(1, func(contract uint32) int {
+		return int(contract)
+	})
+
+	// Block the only worker, so we can queue up the tasks
+	block := make(chan struct{})
+	s.Schedule(9, func() { <-block })
+	time.Sleep(10 * time.Millisecond)
+
+	var mu sync.Mutex
+	var order []uint32
+	for i := 0; i < 4; i++ {
+		for _, c := range []uint32{1, 2} {
+			contract := c
+			s.Schedule(contract, func() {
+				mu.Lock()
+				order = append(order, contract)
+				mu.Unlock()
+			})
+		}
+	}
+
+	close(block)
+	assert.NoError(t, s.Close())
+	assert.Equal(t, []uint32{1, 2, 2, 1, 2, 2, 1, 1}, order)
+}
+
+func TestScheduler_Full(t *testing.T) {
+	s := New(1, func(uint32) int { return 1 })
+
+	block := make(chan struct{})
+	s.Schedule(1, func() { <-block })
+	time.Sleep(10 * time.Millisecond)
+
+	var mu sync.Mutex
+	var order []int
+	for i := 0; i < MaxQueueSize; i++ {
+		value := i
+		s.Schedule(1, func() {
+			mu.Lock()
+			order = append(order, value)
+			mu.Unlock()
+		})
+	}
+
+	// The queue is full, the caller must wait for room in the queue
+	scheduled := make(chan struct{})
+	go func() {
+		s.Schedule(1, func() {
+			mu.Lock()
+			order = append(order, MaxQueueSize)
+			mu.Unlock()
+		})
+		close(scheduled)
+	}()
+
+	select {
+	case <-scheduled:
+		assert.Fail(t, "the task must not be scheduled while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	delays := s.Delays()
+	assert.Len(t, delays, 1)
+	assert.Equal(t, MaxQueueSize, delays[0].Queued)
+
+	// Once there is room, the task is queued after the others
+	close(block)
+	<-scheduled
+	assert.NoError(t, s.Close())
+	assert.Len(t, order, MaxQueueSize+1)
+	for i, v := range order {
+		assert.Equal(t, i, v)
+	}
+
+	// Once closed, the tasks are executed synchronously
+	var after bool
+	s.Schedule(2, func() { after = true })
+	assert.True(t, after)
+}
+
+func TestScheduler_Enqueue(t *testing.T) {
+	s := New(1, func(uint32) int { return 1 })
+
+	// A task schedules another task of its contract once the queue is full
+	var done int32
+	block := make(chan struct{})
+	s.Schedule(1, func() {
+		<-block
+		s.Enqueue(1, func() { atomic.StoreInt32(&done, 1) })
+	})
+
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < MaxQueueSize; i++ {
+		s.Schedule(1, func() {})
+	}
+
+	// The task is queued past the limit, rather than waiting for its own worker
+	close(block)
+	assert.True(t, s.Wait(time.Second))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&done))
+	assert.NoError(t, s.Close())
+}
+
+func TestScheduler_Prune(t *testing.T) {
+	s := New(1, func(uint32) int { return 1 })
+	defer s.Close()
+
+	s.Schedule(1, func() {})
+	assert.True(t, s.Wait(time.Second))
+	assert.Len(t, s.Delays(), 1)
+
+	// The delays of the idle contracts must be forgotten
+	s.Lock()
+	s.delays[1].updated = time.Now().Add(-idleTimeout)
+	s.pruned = time.Now().Add(-idleTimeout)
+	s.Unlock()
+
+	s.Schedule(2, func() {})
+	assert.True(t, s.Wait(time.Second))
+
+	delays := s.Delays()
+	assert.Len(t, delays, 1)
+	assert.Equal(t, uint32(2), delays[0].Contract)
+}
+
+func TestScheduler_Wait(t *testing.T) {
+	s := New(2, func(uint32) int { return 1 })
+	defer s.Close()
+	assert.True(t, s.Wait(0))
+
+	var done int64
+	block := make(chan struct{})
+	s.Schedule(1, func() { <-block })
+	for i := 0; i < 10; i++ {
+		s.Schedule(1, func() { atomic.AddInt64(&done, 1) })
+	}
+
+	// The first task is blocked, so the timeout must elapse
+	assert.False(t, s.Wait(10*time.Millisecond))
+
+	close(block)
+	assert.True(t, s.Wait(time.Second))
+	assert.Equal(t, int64(10), atomic.LoadInt64(&done))
+}
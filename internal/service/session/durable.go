@@ -0,0 +1,282 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/emitter-io/emitter/internal/service/pubsub"
+	"github.com/kelindar/binary/nocopy"
+)
+
+// Durable represents the offline sessions of the clients which connected with the clean
+// session flag off. While such a client is offline, its subscriptions are kept and the
+// messages published on them are queued, bounded by count and size, until it reconnects
+// or the session expires.
+type Durable struct {
+	sync.Mutex
+	pubsub   service.PubSub       // The pub/sub service to use.
+	sessions map[string]*Offline  // The offline sessions, by their key.
+	expiry   time.Duration        // The duration after which an offline session expires.
+	maxCount int                  // The maximum number of queued messages per session.
+	maxBytes int                  // The maximum size of the queued messages per session.
+	dead     service.DeadLetterer // The dead-letter channels (optional).
+}
+
+// NewDurable creates a new container of offline sessions.
+func NewDurable(ctx context.Context, pubsub service.PubSub, expiry time.Duration, maxCount, maxBytes int) *Durable {
+	d := &Durable{
+		pubsub:   pubsub,
+		sessions: make(map[string]*Offline),
+		expiry:   expiry,
+		maxCount: maxCount,
+		maxBytes: maxBytes,
+	}
+
+	async.Repeat(ctx, time.Minute, func() {
+		d.expire(time.Now())
+	})
+	return d
+}
+
+// UseDeadLetter republishes the queued messages which could not be delivered, because they
+// overflowed the queue or their session expired, on the dead-letter channels.
+func (d *Durable) UseDeadLetter(dead service.DeadLetterer) {
+	d.dead = dead
+}
+
+// Key returns the key of the session of a client. The credentials are part of the key, so
+// the queued messages are only ever delivered to a client presenting the same ones.
+func Key(clientID, username, password []byte) string {
+	h := sha256.New()
+	for _, v := range [][]byte{clientID, username, password} {
+		h.Write([]byte{byte(len(v) >> 8), byte(len(v))})
+		h.Write(v)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Park keeps the subscriptions of a disconnecting client and queues the messages published
+// on them, until the session expires. If the expiry is zero, the default one applies. This
+// must be called before the connection itself unsubscribes.
+func (d *Durable) Park(key string, c service.Conn, expiry time.Duration) {
+	subs := c.Subscriptions().All()
+	if len(subs) == 0 {
+		return
+	}
+
+	if expiry <= 0 {
+		expiry = d.expiry
+	}
+
+	session := &Offline{
+		luid:     security.NewID(),
+		user:     c.Username(),
+		subs:     make([]event.Subscription, 0, len(subs)),
+		expires:  time.Now().Add(expiry),
+		maxCount: d.maxCount,
+		maxBytes: d.maxBytes,
+		dead:     d.dead,
+	}
+
+	for _, sub := range subs {
+		ev := event.Subscription{
+			Conn:    session.luid,
+			User:    nocopy.String(session.user),
+			Ssid:    sub.Ssid,
+			Channel: sub.Channel,
+		}
+
+		session.subs = append(session.subs, ev)
+		d.pubsub.Subscribe(session, &ev)
+	}
+
+	d.Lock()
+	previous := d.sessions[key]
+	d.sessions[key] = session
+	d.Unlock()
+	d.discard(previous)
+}
+
+// Take removes the offline session of a key, if any, so it can be restored.
+func (d *Durable) Take(key string) (*Offline, bool) {
+	d.Lock()
+	defer d.Unlock()
+	session, ok := d.sessions[key]
+	delete(d.sessions, key)
+	return session, ok
+}
+
+// Discard removes the offline session of a key, if any, along with its queued messages.
+func (d *Durable) Discard(key string) {
+	if session, ok := d.Take(key); ok {
+		d.discard(session)
+	}
+}
+
+// Restore subscribes the reconnected client to the subscriptions of its offline session
+// and sends it the queued messages. The client is subscribed before the session stops
+// queueing, so a message published meanwhile might be received twice but never lost. The
+// subscriptions beyond the limit of the contract, if it was lowered meanwhile, are dropped.
+func (d *Durable) Restore(session *Offline, c service.Conn) (sent int) {
+	for _, sub := range session.subs {
+		if _, exists := c.Subscriptions().Get(sub.Ssid); !exists {
+			d.pubsub.Subscribe(c, &event.Subscription{
+				Conn:    c.LocalID(),
+				User:    nocopy.String(c.Username()),
+				Ssid:    sub.Ssid,
+				Channel: sub.Channel,
+				Meta:    c.Meta(),
+			})
+		}
+	}
+
+	for _, m := range d.discard(session) {
+		msg := m // Copy message
+		if c.Send(&msg) == nil {
+			sent++
+		}
+	}
+	return
+}
+
+// Len returns the number of offline sessions.
+func (d *Durable) Len() int {
+	d.Lock()
+	defer d.Unlock()
+	return len(d.sessions)
+}
+
+// expire discards the offline sessions which expired, along with their queued messages.
+func (d *Durable) expire(now time.Time) {
+	var expired []*Offline
+	d.Lock()
+	for key, session := range d.sessions {
+		if now.After(session.expires) {
+			expired = append(expired, session)
+			delete(d.sessions, key)
+		}
+	}
+	d.Unlock()
+
+	for _, session := range expired {
+		queue := d.discard(session)
+		for i := 0; d.dead != nil && i < len(queue); i++ {
+			d.dead.DeadLetter(&queue[i], pubsub.ReasonExpired)
+		}
+	}
+}
+
+// discard unsubscribes an offline session and returns its queued messages.
+func (d *Durable) discard(session *Offline) message.Frame {
+	if session == nil {
+		return nil
+	}
+
+	for i := range session.subs {
+		d.pubsub.Unsubscribe(session, &session.subs[i])
+	}
+	return session.close()
+}
+
+// ------------------------------------------------------------------------------------
+
+// Offline represents the session of an offline client, which queues the messages
+// published on its subscriptions.
+type Offline struct {
+	sync.Mutex
+	luid     security.ID          // The locally unique id of the session.
+	user     string               // The username of the client.
+	subs     []event.Subscription // The subscriptions of the client.
+	queue    message.Frame        // The queued messages.
+	size     int                  // The size of the queued messages.
+	dropped  int                  // The number of messages dropped because of the bounds.
+	closed   bool                 // Whether the session stopped queueing.
+	expires  time.Time            // The expiration time of the session.
+	maxCount int                  // The maximum number of queued messages.
+	maxBytes int                  // The maximum size of the queued messages.
+	dead     service.DeadLetterer // The dead-letter channels (optional).
+}
+
+// ID returns the unique identifier of the subsriber.
+func (s *Offline) ID() string {
+	return s.luid.Unique(0, "session")
+}
+
+// Type returns the type of the subscriber. The session is a direct subscriber, so the
+// messages keep being routed to this node while the client is offline.
+func (s *Offline) Type() message.SubscriberType {
+	return message.SubscriberDirect
+}
+
+// Send queues the message, dropping the oldest ones if the queue is full.
+func (s *Offline) Send(m *message.Message) error {
+	for _, dropped := range s.enqueue(m) {
+		msg := dropped // Copy message
+		s.dead.DeadLetter(&msg, pubsub.ReasonOverflow)
+	}
+	return nil
+}
+
+// enqueue queues the message and returns the messages dropped, if they should be
+// dead-lettered once the session is unlocked.
+func (s *Offline) enqueue(m *message.Message) (dropped message.Frame) {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return nil
+	}
+
+	s.queue = append(s.queue, *m)
+	s.size += len(m.Payload)
+	for len(s.queue) > 0 && (len(s.queue) > s.maxCount || s.size > s.maxBytes) {
+		if s.dead != nil {
+			dropped = append(dropped, s.queue[0])
+		}
+
+		s.size -= len(s.queue[0].Payload)
+		s.queue[0] = message.Message{}
+		s.queue = s.queue[1:]
+		s.dropped++
+	}
+	return
+}
+
+// Dropped returns the number of messages dropped because the queue was full.
+func (s *Offline) Dropped() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.dropped
+}
+
+// close stops queueing and returns the queued messages.
+func (s *Offline) close() message.Frame {
+	s.Lock()
+	defer s.Unlock()
+	s.closed = true
+	queue := s.queue
+	s.queue = nil
+	s.size = 0
+	return queue
+}
@@ -0,0 +1,227 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package session
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/emitter-io/emitter/internal/service/pubsub"
+	"github.com/emitter-io/emitter/internal/service/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDurable(maxCount, maxBytes int) (*Durable, *fake.PubSub, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pubsub := new(fake.PubSub)
+	return NewDurable(ctx, pubsub, time.Hour, maxCount, maxBytes), pubsub, cancel
+}
+
+func newTestMessage(channel, payload string) *message.Message {
+	ssid := message.NewSsid(1, security.MakeChannel("key", channel).Query)
+	return message.New(ssid, []byte(channel), []byte(payload))
+}
+
+func TestDurable_ParkRestore(t *testing.T) {
+	d, pubsub, cancel := newTestDurable(100, 1000)
+	defer cancel()
+
+	// Subscribe the client and disconnect it
+	c := &fake.Conn{ConnID: 1}
+	ssid := message.NewSsid(1, security.MakeChannel("key", "a/b/").Query)
+	pubsub.Subscribe(c, &event.Subscription{Ssid: ssid, Channel: []byte("a/b/")})
+	d.Park("key", c, 0)
+	pubsub.Unsubscribe(c, &event.Subscription{Ssid: ssid, Channel: []byte("a/b/")})
+	assert.Equal(t, 1, d.Len())
+
+	// Publish while the client is offline
+	pubsub.Publish(newTestMessage("a/b/", "1"), nil)
+	pubsub.Publish(newTestMessage("a/b/", "2"), nil)
+	pubsub.Publish(newTestMessage("a/c/", "3"), nil)
+	assert.Empty(t, c.Outgoing)
+
+	// Reconnect and receive the queued messages
+	session, ok := d.Take("key")
+	assert.True(t, ok)
+	assert.Equal(t, 0, d.Len())
+
+	reconnected := &fake.Conn{ConnID: 2}
+	assert.Equal(t, 2, d.Restore(session, reconnected))
+	assert.Len(t, reconnected.Outgoing, 2)
+	assert.Equal(t, "1", string(reconnected.Outgoing[0].Payload))
+	assert.Equal(t, "2", string(reconnected.Outgoing[1].Payload))
+
+	// The reconnected client is subscribed and the session no longer queues
+	pubsub.Publish(newTestMessage("a/b/", "4"), nil)
+	assert.Len(t, reconnected.Outgoing, 3)
+	assert.Len(t, pubsub.Trie.Lookup(ssid, nil), 1)
+
+	_, ok = d.Take("key")
+	assert.False(t, ok)
+}
+
+func TestDurable_Discard(t *testing.T) {
+	d, pubsub, cancel := newTestDurable(100, 1000)
+	defer cancel()
+
+	// Parking without any subscriptions keeps nothing
+	c := new(fake.Conn)
+	d.Park("key", c, 0)
+	assert.Equal(t, 0, d.Len())
+
+	ssid := message.NewSsid(1, security.MakeChannel("key", "a/").Query)
+	pubsub.Subscribe(c, &event.Subscription{Ssid: ssid, Channel: []byte("a/")})
+	d.Park("key", c, 0)
+	pubsub.Unsubscribe(c, &event.Subscription{Ssid: ssid, Channel: []byte("a/")})
+	assert.Len(t, pubsub.Trie.Lookup(ssid, nil), 1)
+
+	d.Discard("key")
+	assert.Equal(t, 0, d.Len())
+	assert.Len(t, pubsub.Trie.Lookup(ssid, nil), 0)
+}
+
+func TestDurable_Expire(t *testing.T) {
+	d, pubsub, cancel := newTestDurable(100, 1000)
+	defer cancel()
+
+	dead := new(fake.DeadLetterer)
+	d.UseDeadLetter(dead)
+
+	c := new(fake.Conn)
+	ssid := message.NewSsid(1, security.MakeChannel("key", "a/").Query)
+	pubsub.Subscribe(c, &event.Subscription{Ssid: ssid, Channel: []byte("a/")})
+	d.Park("key", c, 0)
+	pubsub.Unsubscribe(c, &event.Subscription{Ssid: ssid, Channel: []byte("a/")})
+	pubsub.Publish(newTestMessage("a/", "1"), nil)
+
+	d.expire(time.Now())
+	assert.Equal(t, 1, d.Len())
+	assert.Empty(t, dead.Letters)
+
+	// The messages queued by an expired session are dead-lettered
+	d.expire(time.Now().Add(2 * time.Hour))
+	assert.Equal(t, 0, d.Len())
+	assert.Len(t, dead.Letters, 1)
+	assert.Equal(t, "1", string(dead.Letters[0].Payload))
+	assert.Equal(t, []string{"expired"}, dead.Reasons)
+}
+
+func TestDurable_ExpireOverridden(t *testing.T) {
+	d, pubsub, cancel := newTestDurable(100, 1000)
+	defer cancel()
+
+	ssid := message.NewSsid(1, security.MakeChannel("key", "a/").Query)
+	c1, c2 := new(fake.Conn), new(fake.Conn)
+	pubsub.Subscribe(c1, &event.Subscription{Ssid: ssid, Channel: []byte("a/")})
+	pubsub.Subscribe(c2, &event.Subscription{Ssid: ssid, Channel: []byte("a/")})
+	d.Park("short", c1, time.Minute)
+	d.Park("long", c2, 24*time.Hour)
+
+	// Each session expires after its own expiry
+	d.expire(time.Now().Add(2 * time.Minute))
+	_, ok := d.Take("short")
+	assert.False(t, ok)
+
+	d.expire(time.Now().Add(2 * time.Hour))
+	_, ok = d.Take("long")
+	assert.True(t, ok)
+}
+
+func TestOffline_Send(t *testing.T) {
+	tests := []struct {
+		maxCount int
+		maxBytes int
+		expected []string
+		dropped  int
+	}{
+		{maxCount: 10, maxBytes: 100, expected: []string{"0", "1", "2", "3", "4"}},
+		{maxCount: 3, maxBytes: 100, expected: []string{"2", "3", "4"}, dropped: 2},
+		{maxCount: 10, maxBytes: 2, expected: []string{"3", "4"}, dropped: 3},
+		{maxCount: 10, maxBytes: 0, dropped: 5},
+	}
+
+	for _, tc := range tests {
+		dead := new(fake.DeadLetterer)
+		s := &Offline{maxCount: tc.maxCount, maxBytes: tc.maxBytes, dead: dead}
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, s.Send(newTestMessage("a/", fmt.Sprintf("%d", i))))
+		}
+
+		var payloads []string
+		for _, m := range s.close() {
+			payloads = append(payloads, string(m.Payload))
+		}
+		assert.Equal(t, tc.expected, payloads)
+		assert.Equal(t, tc.dropped, s.Dropped())
+		assert.Len(t, dead.Letters, tc.dropped)
+
+		// A closed session no longer queues
+		assert.NoError(t, s.Send(newTestMessage("a/", "x")))
+		assert.Empty(t, s.close())
+	}
+}
+
+func TestOffline_SendFull(t *testing.T) {
+	sched := scheduler.New(1, func(uint32) int { return 1 })
+	defer sched.Close()
+
+	store := storage.NewInMemory(nil)
+	store.Configure(nil)
+	defer store.Close()
+
+	ps := pubsub.New(&fake.Authorizer{Contract: 1, Success: true}, store, new(fake.Notifier), new(fake.Shedder), sched, message.NewTrie())
+	ps.UseDeadLetter("dead/", 60)
+	sub := new(fake.Conn)
+	ps.Subscribe(sub, &event.Subscription{
+		Ssid:    message.NewSsid(1, security.MakeChannel("key", "dead/a/").Query),
+		Channel: []byte("dead/a/"),
+	})
+
+	// The session can only queue a single message
+	s := &Offline{maxCount: 1, maxBytes: 100, dead: ps}
+	assert.NoError(t, s.Send(newTestMessage("a/", "1")))
+
+	// The session overflows while delivering, once the queue of the contract is full
+	block := make(chan struct{})
+	sched.Schedule(1, func() {
+		<-block
+		s.Send(newTestMessage("a/", "2"))
+	})
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < scheduler.MaxQueueSize; i++ {
+		sched.Schedule(1, func() {})
+	}
+
+	// The dead letter is enqueued past the limit rather than blocking the worker
+	close(block)
+	assert.True(t, sched.Wait(time.Second))
+	assert.Equal(t, 1, s.Dropped())
+	assert.Len(t, sub.Outgoing, 1)
+}
+
+func TestKey(t *testing.T) {
+	key := Key([]byte("client"), []byte("user"), []byte("pass"))
+	assert.Len(t, key, 64)
+	assert.Equal(t, key, Key([]byte("client"), []byte("user"), []byte("pass")))
+	assert.NotEqual(t, key, Key([]byte("client"), []byte("user"), []byte("other")))
+	assert.NotEqual(t, Key([]byte("ab"), []byte("c"), nil), Key([]byte("a"), []byte("bc"), nil))
+}
@@ -0,0 +1,69 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package session
+
+// State represents the exported state of a session, which can be imported on another
+// broker or cluster.
+type State struct {
+	Version       int               `json:"version"`         // The version of the document.
+	Exported      int64             `json:"exported"`        // The unix time of the export.
+	Subscriptions []Subscription    `json:"subscriptions"`   // The subscriptions of the session.
+	Links         map[string]string `json:"links,omitempty"` // The links of the session, without their keys.
+}
+
+// Subscription represents an exported subscription.
+type Subscription struct {
+	Channel   string `json:"channel"`   // The channel of the subscription.
+	Delivered int64  `json:"delivered"` // The number of messages delivered through it.
+	Offset    int64  `json:"offset"`    // The unix time of the last message delivered through it.
+	Pending   int    `json:"pending"`   // The number of stored messages published after the offset.
+}
+
+// ------------------------------------------------------------------------------------
+
+// ImportRequest represents a request to import the state of a session.
+type ImportRequest struct {
+	Key    string `json:"key"`    // The key to use for the subscriptions and the links.
+	State  State  `json:"state"`  // The state to import.
+	Resume bool   `json:"resume"` // Whether the messages published after the offsets should be sent.
+}
+
+// ------------------------------------------------------------------------------------
+
+// ExportResponse represents a response to the export request.
+type ExportResponse struct {
+	Request uint16 `json:"req,omitempty"` // The corresponding request ID.
+	Status  int    `json:"status"`        // The status of the response.
+	State   State  `json:"state"`         // The state of the session.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *ExportResponse) ForRequest(id uint16) {
+	r.Request = id
+}
+
+// ImportResponse represents a response to the import request.
+type ImportResponse struct {
+	Request  uint16   `json:"req,omitempty"`      // The corresponding request ID.
+	Status   int      `json:"status"`             // The status of the response.
+	Imported []string `json:"imported"`           // The channels which were subscribed to.
+	Rejected []string `json:"rejected,omitempty"` // The channels which the key does not allow.
+	Resumed  int      `json:"resumed"`            // The number of messages sent since the offsets.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *ImportResponse) ForRequest(id uint16) {
+	r.Request = id
+}
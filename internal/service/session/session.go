@@ -0,0 +1,166 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package session
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/kelindar/binary/nocopy"
+)
+
+const (
+	stateVersion = 1    // The version of the exported state document.
+	maxPending   = 1000 // The maximum number of pending messages per subscription.
+)
+
+var (
+	shortcut = regexp.MustCompile("^[a-zA-Z0-9]{1,2}$")
+)
+
+// Service represents a session state export and import service, which allows the
+// long-lived consumers to be migrated between brokers or clusters.
+type Service struct {
+	auth   service.Authorizer // The authorizer to use.
+	pubsub service.PubSub     // The pub/sub service to use.
+	store  storage.Storage    // The storage provider to use.
+}
+
+// New creates a new session state service.
+func New(auth service.Authorizer, pubsub service.PubSub, store storage.Storage) *Service {
+	return &Service{
+		auth:   auth,
+		pubsub: pubsub,
+		store:  store,
+	}
+}
+
+// OnExport handles a request to export the state of the session.
+func (s *Service) OnExport(c service.Conn, payload []byte) (service.Response, bool) {
+	subs := c.Subscriptions().All()
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].ID < subs[j].ID
+	})
+
+	state := State{
+		Version:       stateVersion,
+		Exported:      time.Now().Unix(),
+		Subscriptions: make([]Subscription, 0, len(subs)),
+		Links:         make(map[string]string),
+	}
+
+	for _, sub := range subs {
+		state.Subscriptions = append(state.Subscriptions, Subscription{
+			Channel:   string(sub.Channel),
+			Delivered: sub.Delivered,
+			Offset:    sub.Offset,
+			Pending:   len(s.since(sub.Ssid, sub.Offset)),
+		})
+	}
+
+	// Export the links without their keys, they are provided again on import
+	for name, link := range c.Links() {
+		state.Links[name] = security.ParseChannel([]byte(link)).SafeString()
+	}
+
+	return &ExportResponse{
+		Status: 200,
+		State:  state,
+	}, true
+}
+
+// OnImport handles a request to import the state of a session. Every subscription and
+// link is authorized with the key provided and the subscriptions which already exist
+// are left as they are, so the import can safely be repeated.
+func (s *Service) OnImport(c service.Conn, payload []byte) (service.Response, bool) {
+	var request ImportRequest
+	if err := json.Unmarshal(payload, &request); err != nil || request.State.Version != stateVersion {
+		return errors.ErrBadRequest, false
+	}
+
+	resp := &ImportResponse{
+		Status:   200,
+		Imported: []string{},
+	}
+
+	for _, sub := range request.State.Subscriptions {
+		channel := security.MakeChannel(request.Key, sub.Channel)
+		if channel.ChannelType == security.ChannelInvalid {
+			resp.Rejected = append(resp.Rejected, sub.Channel)
+			continue
+		}
+
+		// Keys which are supposed to be extended should not be used for subscribing
+		_, key, allowed := s.auth.Authorize(channel, security.AllowRead)
+		if !allowed || key.HasPermission(security.AllowExtend) {
+			resp.Rejected = append(resp.Rejected, sub.Channel)
+			continue
+		}
+
+		// The subscriptions beyond the limit of the contract are rejected
+		ssid := message.NewSsid(key.Contract(), channel.Query)
+		if _, exists := c.Subscriptions().Get(ssid); !exists && !s.pubsub.Subscribe(c, &event.Subscription{
+			Conn:    c.LocalID(),
+			User:    nocopy.String(c.Username()),
+			Ssid:    ssid,
+			Channel: channel.Channel,
+			Meta:    c.Meta(),
+		}) {
+			resp.Rejected = append(resp.Rejected, sub.Channel)
+			continue
+		}
+
+		// Send the messages published since the offset, if the key allows loading them
+		resp.Imported = append(resp.Imported, string(channel.Channel))
+		if request.Resume && key.HasPermission(security.AllowLoad) {
+			for _, m := range s.since(ssid, sub.Offset) {
+				msg := m // Copy message
+				c.Send(&msg)
+				resp.Resumed++
+			}
+		}
+	}
+
+	// Restore the links with the key provided
+	for name, link := range request.State.Links {
+		if channel := security.MakeChannel(request.Key, link); shortcut.MatchString(name) && channel.ChannelType != security.ChannelInvalid {
+			c.AddLink(name, channel)
+		}
+	}
+
+	return resp, true
+}
+
+// since returns the stored messages published after the offset. If there is no offset,
+// nothing was delivered yet and there is no point of reference.
+func (s *Service) since(ssid message.Ssid, offset int64) message.Frame {
+	if offset <= 0 || s.store == nil {
+		return nil
+	}
+
+	msgs, err := s.store.Query(ssid, time.Unix(offset+1, 0), time.Unix(0, 0), maxPending)
+	if err != nil {
+		return nil
+	}
+	return msgs
+}
@@ -0,0 +1,136 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package session
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService(perm uint8) (*Service, storage.Storage) {
+	store := storage.NewInMemory(nil)
+	store.Configure(nil)
+	return New(&fake.Authorizer{
+		Contract:  1,
+		Success:   true,
+		ExtraPerm: perm,
+	}, new(fake.PubSub), store), store
+}
+
+func TestExport(t *testing.T) {
+	s, store := newTestService(0)
+	defer store.Close()
+
+	// Subscribe and deliver a message
+	c := new(fake.Conn)
+	ssid := message.NewSsid(1, security.MakeChannel("key", "a/b/").Query)
+	s.pubsub.Subscribe(c, &event.Subscription{Ssid: ssid, Channel: []byte("a/b/")})
+	c.AddLink("x", security.MakeChannel("key", "a/b/?last=1"))
+
+	delivered := message.New(ssid, []byte("a/b/"), []byte("1"))
+	delivered.TTL = 60
+	c.Subscriptions().Attribute(delivered.ID)
+
+	// Store a message published afterwards
+	pending := message.New(ssid, []byte("a/b/"), []byte("2"))
+	pending.TTL = 60
+	pending.ID.SetTime(delivered.ID.Time() + 10)
+	assert.NoError(t, store.Store(pending))
+
+	resp, ok := s.OnExport(c, nil)
+	assert.True(t, ok)
+
+	state := resp.(*ExportResponse).State
+	assert.Equal(t, stateVersion, state.Version)
+	assert.Equal(t, []Subscription{{
+		Channel:   "a/b/",
+		Delivered: 1,
+		Offset:    delivered.ID.Time(),
+		Pending:   1,
+	}}, state.Subscriptions)
+	assert.Equal(t, map[string]string{"x": "a/b/?last=1"}, state.Links)
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		payload  string
+		perm     uint8
+		success  bool
+		imported []string
+		rejected []string
+		resumed  int
+	}{
+		{payload: "{", success: false},
+		{payload: `{"key":"key","state":{"version":2}}`, success: false},
+		{
+			payload:  `{"key":"key","state":{"version":1,"subscriptions":[{"channel":"a/b/"},{"channel":"+"}],"links":{"x":"a/b/"}}}`,
+			success:  true,
+			imported: []string{"a/b/"},
+			rejected: []string{"+"},
+		},
+		{
+			payload:  `{"key":"key","state":{"version":1,"subscriptions":[{"channel":"a/b/"}]}}`,
+			perm:     security.AllowExtend,
+			success:  true,
+			imported: []string{},
+			rejected: []string{"a/b/"},
+		},
+		{
+			payload:  `{"key":"key","resume":true,"state":{"version":1,"subscriptions":[{"channel":"a/b/","offset":1}]}}`,
+			perm:     security.AllowLoad,
+			success:  true,
+			imported: []string{"a/b/"},
+			resumed:  1,
+		},
+	}
+
+	for _, tc := range tests {
+		s, store := newTestService(tc.perm)
+		ssid := message.NewSsid(1, security.MakeChannel("key", "a/b/").Query)
+		stored := message.New(ssid, []byte("a/b/"), []byte("1"))
+		stored.TTL = 60
+		store.Store(stored)
+
+		// Import twice, it should be idempotent
+		c := new(fake.Conn)
+		for i := 0; i < 2; i++ {
+			resp, ok := s.OnImport(c, []byte(tc.payload))
+			assert.Equal(t, tc.success, ok)
+			if !tc.success {
+				continue
+			}
+
+			r := resp.(*ImportResponse)
+			assert.Equal(t, tc.imported, r.Imported)
+			assert.Equal(t, tc.rejected, r.Rejected)
+			assert.Equal(t, tc.resumed, r.Resumed)
+			assert.Len(t, c.Subscriptions().All(), len(tc.imported))
+		}
+		store.Close()
+	}
+}
+
+func TestStateJSON(t *testing.T) {
+	b, err := json.Marshal(&ExportResponse{Status: 200, State: State{Version: 1, Exported: 10}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"status":200,"state":{"version":1,"exported":10,"subscriptions":null}}`, string(b))
+}
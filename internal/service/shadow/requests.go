@@ -0,0 +1,58 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package shadow
+
+// Document represents the shadow of a device, a JSON state document kept per channel.
+type Document struct {
+	Channel string                 `json:"channel"` // The channel of the device.
+	Version int64                  `json:"version"` // The version of the document, incremented on every change.
+	Time    int64                  `json:"time"`    // The unix time of the last change.
+	State   map[string]interface{} `json:"state"`   // The state of the device.
+}
+
+// ------------------------------------------------------------------------------------
+
+// Request represents a request to get or to update the shadow of a device.
+type Request struct {
+	Key     string                 `json:"key"`               // The channel key for this request.
+	Channel string                 `json:"channel"`           // The channel of the device.
+	State   map[string]interface{} `json:"state,omitempty"`   // The partial update to apply, as a JSON merge patch.
+	Version int64                  `json:"version,omitempty"` // The expected version of the document, if any.
+	Changes *bool                  `json:"changes,omitempty"` // Specifies that the changes should be notified.
+}
+
+// ------------------------------------------------------------------------------------
+
+// Response represents a response to the shadow request.
+type Response struct {
+	Request  uint16   `json:"req,omitempty"` // The corresponding request ID.
+	Status   int      `json:"status"`        // The status of the response.
+	Document Document `json:"document"`      // The current document.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *Response) ForRequest(id uint16) {
+	r.Request = id
+}
+
+// ------------------------------------------------------------------------------------
+
+// Delta represents a notification of the changes applied to a document.
+type Delta struct {
+	Channel string                 `json:"channel"` // The channel of the device.
+	Version int64                  `json:"version"` // The version of the document after the changes.
+	Time    int64                  `json:"time"`    // The unix time of the changes.
+	Delta   map[string]interface{} `json:"delta"`   // The changes, with null for the removed keys.
+}
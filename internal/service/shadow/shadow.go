@@ -0,0 +1,226 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package shadow
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+	"github.com/kelindar/binary/nocopy"
+)
+
+const (
+	maxVersions = 16 // The maximum number of stored versions looked up for a document.
+)
+
+var (
+	channel = []byte("emitter/shadow/")
+)
+
+// Service represents a device shadow service, which keeps a JSON state document per
+// channel in the message storage, applies the partial updates and notifies the changes.
+type Service struct {
+	sync.Mutex
+	auth   service.Authorizer // The authorizer to use.
+	pubsub service.PubSub     // The pub/sub service to use.
+	store  storage.Storage    // The storage provider to use.
+}
+
+// New creates a new device shadow service.
+func New(auth service.Authorizer, pubsub service.PubSub, store storage.Storage) *Service {
+	return &Service{
+		auth:   auth,
+		pubsub: pubsub,
+		store:  store,
+	}
+}
+
+// OnRequest handles a request to get or to update the shadow of a device. If a version is
+// specified, the update is only applied if the document is still at that version.
+func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, bool) {
+	var request Request
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return errors.ErrBadRequest, false
+	}
+
+	// Ensure we have trailing slash
+	if !strings.HasSuffix(request.Channel, "/") {
+		request.Channel = request.Channel + "/"
+	}
+
+	// The shadows are kept per device, so the channel can not contain wildcards
+	target := security.MakeChannel(request.Key, request.Channel)
+	if target.ChannelType != security.ChannelStatic {
+		return errors.ErrTargetInvalid, false
+	}
+
+	// Reading the document requires the read permission and updating it the write one
+	access := security.AllowRead
+	if request.State != nil {
+		access = security.AllowWrite
+	}
+
+	_, key, allowed := s.auth.Authorize(target, access)
+	if !allowed || key.HasPermission(security.AllowExtend) {
+		return errors.ErrUnauthorized, false
+	}
+
+	// Subscribe or unsubscribe from the changes
+	ssid := message.NewSsidForShadow(message.NewSsid(key.Contract(), target.Query))
+	if request.Changes != nil {
+		ev := &event.Subscription{
+			Conn:    c.LocalID(),
+			User:    nocopy.String(c.Username()),
+			Ssid:    ssid,
+			Channel: target.Channel,
+		}
+
+		switch *request.Changes {
+		case true:
+			s.pubsub.Subscribe(c, ev)
+		case false:
+			s.pubsub.Unsubscribe(c, ev)
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	doc, err := s.load(ssid, string(target.Channel))
+	if err != nil {
+		logging.LogError("shadow", "loading document", err)
+		return errors.ErrServerError, false
+	}
+
+	if request.State != nil {
+		if request.Version != 0 && request.Version != doc.Version {
+			return errors.ErrConflict, false
+		}
+
+		if err := s.update(ssid, &doc, request.State); err != nil {
+			logging.LogError("shadow", "storing document", err)
+			return errors.ErrServerError, false
+		}
+	}
+
+	return &Response{
+		Status:   200,
+		Document: doc,
+	}, true
+}
+
+// load retrieves the latest version of the document from the storage.
+func (s *Service) load(ssid message.Ssid, name string) (Document, error) {
+	doc := Document{
+		Channel: name,
+		State:   make(map[string]interface{}),
+	}
+
+	zero := time.Unix(0, 0)
+	msgs, err := s.store.Query(ssid, zero, zero, maxVersions)
+	if err != nil {
+		return doc, err
+	}
+
+	// Older versions may still be around, if several updates happened within a second
+	for _, m := range msgs {
+		var stored Document
+		if err := json.Unmarshal(m.Payload, &stored); err == nil && stored.Version > doc.Version && stored.State != nil {
+			doc = stored
+		}
+	}
+	return doc, nil
+}
+
+// update applies the patch to the document and, if anything changed, stores the new
+// version and notifies the changes to the subscribers.
+func (s *Service) update(ssid message.Ssid, doc *Document, patch map[string]interface{}) error {
+	delta := merge(doc.State, patch)
+	if len(delta) == 0 {
+		return nil
+	}
+
+	doc.Version++
+	doc.Time = time.Now().Unix()
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	// Store the new version and remove the previous ones
+	msg := message.New(ssid, channel, encoded)
+	msg.TTL = message.RetainedTTL
+	if err := s.store.Store(msg); err != nil {
+		return err
+	}
+
+	if err := s.store.Delete(ssid, time.Unix(0, 0), time.Unix(msg.Time()-1, 0)); err != nil {
+		logging.LogError("shadow", "removing previous versions", err)
+	}
+
+	// Notify the subscribers of the changes
+	if notification, err := json.Marshal(&Delta{
+		Channel: doc.Channel,
+		Version: doc.Version,
+		Time:    doc.Time,
+		Delta:   delta,
+	}); err == nil {
+		s.pubsub.Publish(message.New(ssid, channel, notification), nil)
+	}
+	return nil
+}
+
+// merge applies the patch to the state as a JSON merge patch (RFC 7396): the objects are
+// merged recursively and the null values remove the keys. It returns the changes applied.
+func merge(state, patch map[string]interface{}) map[string]interface{} {
+	delta := make(map[string]interface{})
+	for k, v := range patch {
+		switch value := v.(type) {
+		case nil:
+			if _, ok := state[k]; ok {
+				delete(state, k)
+				delta[k] = nil
+			}
+
+		case map[string]interface{}:
+			current, ok := state[k].(map[string]interface{})
+			if !ok {
+				current = make(map[string]interface{})
+			}
+
+			if changes := merge(current, value); len(changes) > 0 || !ok {
+				state[k] = current
+				delta[k] = changes
+			}
+
+		default:
+			if current, ok := state[k]; !ok || !reflect.DeepEqual(current, v) {
+				state[k] = v
+				delta[k] = v
+			}
+		}
+	}
+	return delta
+}
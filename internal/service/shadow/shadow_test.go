@@ -0,0 +1,145 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package shadow
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/provider/storage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService(success bool, perm uint8) (*Service, storage.Storage) {
+	store := storage.NewInMemory(nil)
+	store.Configure(nil)
+	return New(&fake.Authorizer{
+		Contract:  1,
+		Success:   success,
+		ExtraPerm: perm,
+	}, new(fake.PubSub), store), store
+}
+
+func TestOnRequest_Invalid(t *testing.T) {
+	tests := []struct {
+		payload string
+		success bool
+		perm    uint8
+		err     *errors.Error
+	}{
+		{payload: "{", success: true, err: errors.ErrBadRequest},
+		{payload: `{"key":"key","channel":"a/+/"}`, success: true, err: errors.ErrTargetInvalid},
+		{payload: `{"key":"key","channel":"a/b/"}`, success: false, err: errors.ErrUnauthorized},
+		{payload: `{"key":"key","channel":"a/b/"}`, success: true, perm: security.AllowExtend, err: errors.ErrUnauthorized},
+		{payload: `{"key":"key","channel":"a/b/","state":{"x":1},"version":3}`, success: true, err: errors.ErrConflict},
+	}
+
+	for _, tc := range tests {
+		s, store := newTestService(tc.success, tc.perm)
+		resp, ok := s.OnRequest(new(fake.Conn), []byte(tc.payload))
+		assert.False(t, ok)
+		assert.Equal(t, tc.err, resp)
+		store.Close()
+	}
+}
+
+func TestOnRequest_Update(t *testing.T) {
+	s, store := newTestService(true, 0)
+	defer store.Close()
+
+	// Subscribe to the changes of the device, while getting its empty document
+	c := new(fake.Conn)
+	resp, ok := s.OnRequest(c, []byte(`{"key":"key","channel":"devices/1","changes":true}`))
+	assert.True(t, ok)
+	assert.Equal(t, Document{
+		Channel: "devices/1/",
+		State:   map[string]interface{}{},
+	}, resp.(*Response).Document)
+
+	// Apply a few partial updates
+	updates := []string{
+		`{"key":"key","channel":"devices/1/","state":{"led":{"on":true,"color":"red"},"fw":"1.0"}}`,
+		`{"key":"key","channel":"devices/1/","state":{"led":{"color":"blue"}},"version":1}`,
+		`{"key":"key","channel":"devices/1/","state":{"led":{"color":"blue"}}}`,
+		`{"key":"key","channel":"devices/1/","state":{"fw":null}}`,
+	}
+
+	for _, update := range updates {
+		_, ok := s.OnRequest(c, []byte(update))
+		assert.True(t, ok)
+	}
+
+	// The update of a stale version is rejected
+	resp, ok = s.OnRequest(c, []byte(`{"key":"key","channel":"devices/1/","state":{"fw":"2.0"},"version":1}`))
+	assert.False(t, ok)
+	assert.Equal(t, errors.ErrConflict, resp)
+
+	// The updates which did not change anything do not bump the version
+	resp, ok = s.OnRequest(c, []byte(`{"key":"key","channel":"devices/1/"}`))
+	assert.True(t, ok)
+	doc := resp.(*Response).Document
+	assert.Equal(t, int64(3), doc.Version)
+	assert.Equal(t, map[string]interface{}{
+		"led": map[string]interface{}{"on": true, "color": "blue"},
+	}, doc.State)
+
+	// The other devices are not affected
+	resp, ok = s.OnRequest(c, []byte(`{"key":"key","channel":"devices/1/sub/"}`))
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), resp.(*Response).Document.Version)
+
+	// Every change was notified
+	assert.Len(t, c.Outgoing, 3)
+	var delta Delta
+	assert.NoError(t, json.Unmarshal(c.Outgoing[2].Payload, &delta))
+	assert.Equal(t, "emitter/shadow/", string(c.Outgoing[2].Channel))
+	assert.Equal(t, Delta{
+		Channel: "devices/1/",
+		Version: 3,
+		Time:    doc.Time,
+		Delta:   map[string]interface{}{"fw": nil},
+	}, delta)
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		state  string
+		patch  string
+		expect string
+		delta  string
+	}{
+		{state: `{}`, patch: `{"a":1}`, expect: `{"a":1}`, delta: `{"a":1}`},
+		{state: `{"a":1}`, patch: `{"a":1}`, expect: `{"a":1}`, delta: `{}`},
+		{state: `{"a":1,"b":2}`, patch: `{"a":null,"c":null}`, expect: `{"b":2}`, delta: `{"a":null}`},
+		{state: `{"a":{"b":1,"c":2}}`, patch: `{"a":{"b":3}}`, expect: `{"a":{"b":3,"c":2}}`, delta: `{"a":{"b":3}}`},
+		{state: `{"a":1}`, patch: `{"a":{"b":1}}`, expect: `{"a":{"b":1}}`, delta: `{"a":{"b":1}}`},
+		{state: `{"a":[1,2]}`, patch: `{"a":[1,2]}`, expect: `{"a":[1,2]}`, delta: `{}`},
+	}
+
+	for _, tc := range tests {
+		var state, patch map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(tc.state), &state))
+		assert.NoError(t, json.Unmarshal([]byte(tc.patch), &patch))
+
+		delta := merge(state, patch)
+		encodedState, _ := json.Marshal(state)
+		encodedDelta, _ := json.Marshal(delta)
+		assert.JSONEq(t, tc.expect, string(encodedState))
+		assert.JSONEq(t, tc.delta, string(encodedDelta))
+	}
+}
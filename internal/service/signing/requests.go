@@ -0,0 +1,36 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package signing
+
+// Request represents a signing request.
+type Request struct {
+	Enabled *bool `json:"enabled,omitempty"` // Whether the delivered messages should be signed.
+}
+
+// ------------------------------------------------------------------------------------
+
+// Response represents a signing response.
+type Response struct {
+	Request uint16            `json:"req,omitempty"`     // The corresponding request ID.
+	Status  int               `json:"status"`            // The status of the response.
+	Enabled *bool             `json:"enabled,omitempty"` // Whether the delivered messages are signed.
+	Node    string            `json:"node"`              // The name of the node the client is connected to.
+	Keys    map[string]string `json:"keys"`              // The base64-encoded public keys, by node name.
+}
+
+// ForRequest sets the request ID in the response for matching
+func (r *Response) ForRequest(id uint16) {
+	r.Request = id
+}
@@ -0,0 +1,108 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package signing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/security/sign"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+var system = []byte("emitter/")
+
+// Directory represents the replicated directory of the public keys of the nodes.
+type Directory interface {
+	service.Replicator
+	Signers(func(*event.Signer))
+}
+
+// Service represents a message signing service.
+type Service struct {
+	signer    *sign.Signer // The signer of this node.
+	directory Directory    // The directory of the public keys, if clustered.
+}
+
+// New creates a new message signing service and announces the public key of the node
+// to the other nodes of the cluster.
+func New(signer *sign.Signer, directory Directory) *Service {
+	if directory != nil {
+		directory.Notify(&event.Signer{
+			Peer:      signer.Node(),
+			PublicKey: signer.PublicKey(),
+		}, true)
+	}
+
+	return &Service{
+		signer:    signer,
+		directory: directory,
+	}
+}
+
+// Sign signs a payload delivered on a channel. The responses and notifications of the
+// broker itself are not signed, since they are not messages which transited it.
+func (s *Service) Sign(channel, payload []byte) []byte {
+	if bytes.HasPrefix(channel, system) {
+		return payload
+	}
+
+	return s.signer.Sign(channel, payload, time.Now())
+}
+
+// Keys returns the public keys of the nodes, indexed by the hex-encoded node name.
+func (s *Service) Keys() map[string]string {
+	keys := make(map[string]string)
+	if s.directory != nil {
+		s.directory.Signers(func(ev *event.Signer) {
+			keys[nameOf(ev.Peer)] = base64.StdEncoding.EncodeToString(ev.PublicKey)
+		})
+	}
+
+	keys[nameOf(s.signer.Node())] = base64.StdEncoding.EncodeToString(s.signer.PublicKey())
+	return keys
+}
+
+// OnRequest handles a request to enable or disable the signing of the messages delivered
+// to the connection, and responds with the public keys of the nodes.
+func (s *Service) OnRequest(c service.Conn, payload []byte) (service.Response, bool) {
+	var message Request
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &message); err != nil {
+			return errors.ErrBadRequest, false
+		}
+	}
+
+	if message.Enabled != nil {
+		c.EnableSigning(*message.Enabled)
+	}
+
+	return &Response{
+		Status:  200,
+		Enabled: message.Enabled,
+		Node:    nameOf(s.signer.Node()),
+		Keys:    s.Keys(),
+	}, true
+}
+
+// nameOf returns the name of the node, as it appears in the signed payloads.
+func nameOf(node uint64) string {
+	return fmt.Sprintf("%016x", node)
+}
@@ -0,0 +1,99 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package signing
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/errors"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/security/sign"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+type directory struct {
+	state *event.State
+}
+
+func (d *directory) Notify(ev event.Event, enabled bool) {
+	d.state.Add(ev)
+}
+
+func (d *directory) Contains(ev event.Event) bool {
+	return d.state.Has(ev)
+}
+
+func (d *directory) Signers(f func(*event.Signer)) {
+	d.state.Signers(f)
+}
+
+func TestNew(t *testing.T) {
+	dir := &directory{state: event.NewState("")}
+	dir.state.Add(&event.Signer{Peer: 2, PublicKey: []byte{1, 2, 3}})
+
+	signer, err := sign.New(1, "")
+	assert.NoError(t, err)
+
+	s := New(signer, dir)
+	keys := s.Keys()
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "AQID", keys["0000000000000002"])
+	assert.Equal(t, base64.StdEncoding.EncodeToString(signer.PublicKey()), keys["0000000000000001"])
+}
+
+func TestSign(t *testing.T) {
+	signer, err := sign.New(1, "")
+	assert.NoError(t, err)
+
+	s := New(signer, nil)
+	assert.Equal(t, []byte("hi"), s.Sign([]byte("emitter/keygen/"), []byte("hi")))
+	assert.Len(t, s.Sign([]byte("a/b/"), []byte("hi")), 2+sign.TrailerSize)
+}
+
+func TestOnRequest(t *testing.T) {
+	signer, err := sign.New(1, "")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		payload string
+		signed  bool
+		err     error
+	}{
+		{payload: "", signed: false},
+		{payload: `{"enabled": true}`, signed: true},
+		{payload: `{"enabled": false}`, signed: false},
+		{payload: `{}`, signed: false},
+		{payload: `{`, err: errors.ErrBadRequest},
+	}
+
+	for _, tc := range tests {
+		c := new(fake.Conn)
+		s := New(signer, nil)
+		resp, ok := s.OnRequest(c, []byte(tc.payload))
+		assert.Equal(t, tc.err == nil, ok, tc.payload)
+		assert.Equal(t, tc.signed, c.Signed, tc.payload)
+		if tc.err != nil {
+			assert.Equal(t, tc.err, resp)
+			continue
+		}
+
+		r := resp.(*Response)
+		assert.Equal(t, 200, r.Status)
+		assert.Equal(t, "0000000000000001", r.Node)
+		assert.Len(t, r.Keys, 1)
+	}
+}
@@ -0,0 +1,171 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package snapshot
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const defaultLimit = 100 // The default number of subscriptions listed per contract.
+
+// Diff represents the subscriptions added and removed between two snapshots.
+type Diff struct {
+	From      int64          `json:"from"`      // The unix time of the first snapshot.
+	Until     int64          `json:"until"`     // The unix time of the second snapshot.
+	Contracts []ContractDiff `json:"contracts"` // The changes, by contract.
+}
+
+// ContractDiff represents the subscriptions of a contract added and removed between two
+// snapshots.
+type ContractDiff struct {
+	Contract     uint32  `json:"contract"`     // The contract of the subscriptions.
+	AddedCount   int     `json:"addedCount"`   // The number of subscriptions added.
+	RemovedCount int     `json:"removedCount"` // The number of subscriptions removed.
+	Added        []Entry `json:"added"`        // The subscriptions added, up to the limit.
+	Removed      []Entry `json:"removed"`      // The subscriptions removed, up to the limit.
+}
+
+// newDiff computes the changes between two sets of subscriptions.
+func newDiff(from, until int64, before, after map[Entry]struct{}) *Diff {
+	contracts := make(map[uint32]*ContractDiff)
+	fetch := func(id uint32) *ContractDiff {
+		c, ok := contracts[id]
+		if !ok {
+			c = &ContractDiff{Contract: id, Added: []Entry{}, Removed: []Entry{}}
+			contracts[id] = c
+		}
+		return c
+	}
+
+	for e := range after {
+		if _, ok := before[e]; !ok {
+			c := fetch(e.Contract)
+			c.Added = append(c.Added, e)
+			c.AddedCount++
+		}
+	}
+
+	for e := range before {
+		if _, ok := after[e]; !ok {
+			c := fetch(e.Contract)
+			c.Removed = append(c.Removed, e)
+			c.RemovedCount++
+		}
+	}
+
+	diff := &Diff{From: from, Until: until, Contracts: make([]ContractDiff, 0, len(contracts))}
+	for _, c := range contracts {
+		sortEntries(c.Added)
+		sortEntries(c.Removed)
+		diff.Contracts = append(diff.Contracts, *c)
+	}
+
+	sort.Slice(diff.Contracts, func(i, j int) bool {
+		return diff.Contracts[i].Contract < diff.Contracts[j].Contract
+	})
+	return diff
+}
+
+// Only returns the changes of a single contract, listing up to the specified number of
+// subscriptions for each.
+func (d *Diff) Only(contract uint32, limit int) *Diff {
+	out := &Diff{From: d.From, Until: d.Until, Contracts: make([]ContractDiff, 0, len(d.Contracts))}
+	for _, c := range d.Contracts {
+		if contract == 0 || c.Contract == contract {
+			c.Added = c.Added[:min(len(c.Added), limit)]
+			c.Removed = c.Removed[:min(len(c.Removed), limit)]
+			out.Contracts = append(out.Contracts, c)
+		}
+	}
+	return out
+}
+
+// sortEntries sorts the entries by connection, then by channel.
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Conn != entries[j].Conn {
+			return entries[i].Conn < entries[j].Conn
+		}
+		return entries[i].Channel < entries[j].Channel
+	})
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ------------------------------------------------------------------------------------
+
+// OnHTTP occurs when a new HTTP snapshot request is received. Without a 'from' parameter,
+// the times of the snapshots are listed. Otherwise, the snapshot at or before 'from' is
+// compared with the one at or before 'until', or with the current subscriptions.
+func (s *Service) OnHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("from") == "" {
+		reply(w, map[string][]int64{"snapshots": s.Times()})
+		return
+	}
+
+	from, err1 := parseInt(query.Get("from"), 0)
+	until, err2 := parseInt(query.Get("until"), 0)
+	contract, err3 := parseInt(query.Get("contract"), 0)
+	limit, err4 := parseInt(query.Get("limit"), defaultLimit)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || limit <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var t1 time.Time
+	if until > 0 {
+		t1 = time.Unix(until, 0)
+	}
+
+	diff, err := s.Diff(time.Unix(from, 0), t1)
+	switch {
+	case err == errNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		reply(w, diff.Only(uint32(contract), int(limit)))
+	}
+}
+
+// reply writes a JSON response.
+func reply(w http.ResponseWriter, v interface{}) {
+	resp, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// parseInt parses an optional integer parameter.
+func parseInt(v string, defaultValue int64) (int64, error) {
+	if v == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
@@ -0,0 +1,90 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff_Only(t *testing.T) {
+	before := map[Entry]struct{}{
+		{Contract: 1, Conn: "a", Channel: "x/"}: {},
+		{Contract: 1, Conn: "b", Channel: "x/"}: {},
+	}
+	after := map[Entry]struct{}{
+		{Contract: 2, Conn: "c", Channel: "y/"}: {},
+		{Contract: 2, Conn: "d", Channel: "y/"}: {},
+	}
+
+	diff := newDiff(1, 2, before, after)
+	assert.Len(t, diff.Contracts, 2)
+
+	only := diff.Only(2, 1)
+	assert.Len(t, only.Contracts, 1)
+	assert.Equal(t, 2, only.Contracts[0].AddedCount)
+	assert.Equal(t, []Entry{{Contract: 2, Conn: "c", Channel: "y/"}}, only.Contracts[0].Added)
+	assert.Empty(t, only.Contracts[0].Removed)
+	assert.Len(t, diff.Contracts[1].Added, 2)
+}
+
+func TestSnapshot_OnHTTP(t *testing.T) {
+	s, err := New(context.Background(), "", time.Hour, 10)
+	assert.NoError(t, err)
+	s.OnSubscribe(newTestEvent(1, 1, "a/"))
+	assert.NoError(t, s.Take(time.Unix(1000, 0)))
+	s.OnSubscribe(newTestEvent(1, 2, "a/"))
+
+	tests := []struct {
+		method string
+		query  string
+		status int
+		body   string
+	}{
+		{method: "POST", query: "", status: http.StatusNotFound},
+		{method: "GET", query: "", status: http.StatusOK, body: `{"snapshots":[1000]}`},
+		{method: "GET", query: "?from=abc", status: http.StatusBadRequest},
+		{method: "GET", query: "?from=1000&limit=0", status: http.StatusBadRequest},
+		{method: "GET", query: "?from=999", status: http.StatusNotFound},
+		{method: "GET", query: "?from=1000&contract=2", status: http.StatusOK},
+		{method: "GET", query: "?from=1000", status: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		s.OnHTTP(w, httptest.NewRequest(tc.method, "/admin/subscriptions"+tc.query, nil))
+		assert.Equal(t, tc.status, w.Code, tc.query)
+		if tc.body != "" {
+			assert.JSONEq(t, tc.body, w.Body.String())
+		}
+	}
+
+	// The diff lists the subscription added since the snapshot
+	w := httptest.NewRecorder()
+	s.OnHTTP(w, httptest.NewRequest("GET", "/admin/subscriptions?from=1000", nil))
+
+	var diff Diff
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, int64(1000), diff.From)
+	assert.Len(t, diff.Contracts, 1)
+	assert.Equal(t, 1, diff.Contracts[0].AddedCount)
+	assert.Equal(t, "a/", diff.Contracts[0].Added[0].Channel)
+}
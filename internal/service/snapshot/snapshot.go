@@ -0,0 +1,278 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/provider/logging"
+	"github.com/golang/snappy"
+	"github.com/kelindar/binary"
+)
+
+const fileExt = ".snap" // The extension of the persisted snapshots.
+
+var errNotFound = errors.New("snapshot: no snapshot was taken at or before this time")
+
+// Entry represents a direct subscription of a connection, as recorded in a snapshot.
+type Entry struct {
+	Contract uint32 `json:"-"`              // The contract of the subscription.
+	Conn     string `json:"conn"`           // The identifier of the connection.
+	User     string `json:"user,omitempty"` // The username of the connection.
+	Channel  string `json:"channel"`        // The channel subscribed to.
+}
+
+// entryOf creates an entry for a subscription event.
+func entryOf(ev *event.Subscription) Entry {
+	return Entry{
+		Contract: ev.Ssid.Contract(),
+		Conn:     ev.Conn.String(),
+		User:     string(ev.User),
+		Channel:  string(ev.Channel),
+	}
+}
+
+// ------------------------------------------------------------------------------------
+
+// Service represents the periodic snapshots of the direct subscriptions of the node, which
+// can be compared to find out which subscriptions were added or removed in the meantime.
+type Service struct {
+	sync.Mutex
+	live  map[Entry]struct{} // The current subscriptions.
+	times []int64            // The unix time of the snapshots kept, from the oldest.
+	blobs map[int64][]byte   // The encoded snapshots, if not persisted.
+	dir   string             // The directory of the snapshots, if persisted.
+	keep  int                // The maximum number of snapshots kept.
+}
+
+// New creates a new snapshot service, which takes a snapshot of the subscriptions at every
+// interval and keeps the specified number of the most recent ones.
+func New(ctx context.Context, dir string, interval time.Duration, keep int) (*Service, error) {
+	s := &Service{
+		live:  make(map[Entry]struct{}),
+		blobs: make(map[int64][]byte),
+		dir:   dir,
+		keep:  keep,
+	}
+
+	if dir != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	go s.loop(ctx, interval)
+	return s, nil
+}
+
+// loop takes the snapshots at every interval, until the context is cancelled.
+func (s *Service) loop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.Take(now); err != nil {
+				logging.LogError("snapshot", "taking a snapshot", err)
+			}
+		}
+	}
+}
+
+// OnSubscribe records a new direct subscription.
+func (s *Service) OnSubscribe(ev *event.Subscription) {
+	s.Lock()
+	defer s.Unlock()
+	s.live[entryOf(ev)] = struct{}{}
+}
+
+// OnUnsubscribe records the removal of a direct subscription.
+func (s *Service) OnUnsubscribe(ev *event.Subscription) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.live, entryOf(ev))
+}
+
+// Times returns the unix time of the snapshots kept, from the oldest.
+func (s *Service) Times() []int64 {
+	s.Lock()
+	defer s.Unlock()
+	return append([]int64{}, s.times...)
+}
+
+// Take takes a snapshot of the current subscriptions and removes the oldest snapshots.
+func (s *Service) Take(now time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	entries := make([]Entry, 0, len(s.live))
+	for e := range s.live {
+		entries = append(entries, e)
+	}
+
+	buffer, err := binary.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	// A snapshot taken within the same second replaces the previous one
+	at := now.Unix()
+	if n := len(s.times); n > 0 && s.times[n-1] == at {
+		s.times = s.times[:n-1]
+	}
+
+	if err := s.write(at, snappy.Encode(nil, buffer)); err != nil {
+		return err
+	}
+
+	s.times = append(s.times, at)
+	sort.Slice(s.times, func(i, j int) bool { return s.times[i] < s.times[j] })
+	for len(s.times) > s.keep {
+		s.remove(s.times[0])
+		s.times = s.times[1:]
+	}
+	return nil
+}
+
+// Diff compares the newest snapshot taken at or before the first time with the newest one
+// taken at or before the second time. If the second time is zero, the snapshot is compared
+// with the current subscriptions instead.
+func (s *Service) Diff(from, until time.Time) (*Diff, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	t0, before, err := s.lookup(from)
+	if err != nil {
+		return nil, err
+	}
+
+	t1, after := time.Now().Unix(), s.live
+	if !until.IsZero() {
+		if t1, after, err = s.lookup(until); err != nil {
+			return nil, err
+		}
+	}
+
+	return newDiff(t0, t1, before, after), nil
+}
+
+// lookup reads the newest snapshot taken at or before a time, must be called under the lock.
+func (s *Service) lookup(t time.Time) (int64, map[Entry]struct{}, error) {
+	i := sort.Search(len(s.times), func(i int) bool {
+		return s.times[i] > t.Unix()
+	})
+	if i == 0 {
+		return 0, nil, errNotFound
+	}
+
+	at := s.times[i-1]
+	blob, err := s.read(at)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	buffer, err := snappy.Decode(nil, blob)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var entries []Entry
+	if err := binary.Unmarshal(buffer, &entries); err != nil {
+		return 0, nil, err
+	}
+
+	set := make(map[Entry]struct{}, len(entries))
+	for _, e := range entries {
+		set[e] = struct{}{}
+	}
+	return at, set, nil
+}
+
+// ------------------------------------------------------------------------------------
+
+// load lists the snapshots persisted in the directory.
+func (s *Service) load() error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if name := f.Name(); strings.HasSuffix(name, fileExt) {
+			if at, err := strconv.ParseInt(strings.TrimSuffix(name, fileExt), 10, 64); err == nil {
+				s.times = append(s.times, at)
+			}
+		}
+	}
+
+	sort.Slice(s.times, func(i, j int) bool { return s.times[i] < s.times[j] })
+	return nil
+}
+
+// fileOf returns the file of a snapshot.
+func (s *Service) fileOf(at int64) string {
+	return filepath.Join(s.dir, strconv.FormatInt(at, 10)+fileExt)
+}
+
+// write writes an encoded snapshot.
+func (s *Service) write(at int64, blob []byte) error {
+	if s.dir == "" {
+		s.blobs[at] = blob
+		return nil
+	}
+
+	// Write into a temporary file first, so a snapshot is never partially written
+	tmp := s.fileOf(at) + ".tmp"
+	if err := ioutil.WriteFile(tmp, blob, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.fileOf(at))
+}
+
+// read reads an encoded snapshot.
+func (s *Service) read(at int64) ([]byte, error) {
+	if s.dir == "" {
+		return s.blobs[at], nil
+	}
+	return ioutil.ReadFile(s.fileOf(at))
+}
+
+// remove removes an encoded snapshot.
+func (s *Service) remove(at int64) {
+	if s.dir == "" {
+		delete(s.blobs, at)
+		return
+	}
+
+	if err := os.Remove(s.fileOf(at)); err != nil {
+		logging.LogError("snapshot", "removing a snapshot", err)
+	}
+}
@@ -0,0 +1,90 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package snapshot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/kelindar/binary/nocopy"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEvent(contract uint32, conn security.ID, channel string) *event.Subscription {
+	return &event.Subscription{
+		Conn:    conn,
+		Ssid:    message.Ssid{contract, 1},
+		User:    nocopy.String("user"),
+		Channel: nocopy.Bytes(channel),
+	}
+}
+
+func TestSnapshot_Diff(t *testing.T) {
+	for _, dir := range []string{"", t.TempDir()} {
+		s, err := New(context.Background(), dir, time.Hour, 2)
+		assert.NoError(t, err)
+
+		// Without any snapshot, there is nothing to compare
+		_, err = s.Diff(time.Unix(1000, 0), time.Time{})
+		assert.Equal(t, errNotFound, err)
+
+		s.OnSubscribe(newTestEvent(1, 1, "a/"))
+		s.OnSubscribe(newTestEvent(1, 2, "a/"))
+		s.OnSubscribe(newTestEvent(2, 3, "b/"))
+		assert.NoError(t, s.Take(time.Unix(1000, 0)))
+
+		s.OnUnsubscribe(newTestEvent(1, 2, "a/"))
+		s.OnSubscribe(newTestEvent(1, 4, "c/"))
+		assert.NoError(t, s.Take(time.Unix(2000, 0)))
+
+		// Compare the two snapshots
+		diff, err := s.Diff(time.Unix(1500, 0), time.Unix(2500, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1000), diff.From)
+		assert.Equal(t, int64(2000), diff.Until)
+		assert.Len(t, diff.Contracts, 1)
+		assert.Equal(t, uint32(1), diff.Contracts[0].Contract)
+		assert.Equal(t, []Entry{{Contract: 1, Conn: security.ID(4).String(), User: "user", Channel: "c/"}}, diff.Contracts[0].Added)
+		assert.Equal(t, []Entry{{Contract: 1, Conn: security.ID(2).String(), User: "user", Channel: "a/"}}, diff.Contracts[0].Removed)
+
+		// Compare a snapshot with the current subscriptions
+		s.OnUnsubscribe(newTestEvent(2, 3, "b/"))
+		diff, err = s.Diff(time.Unix(2000, 0), time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, diff.Contracts, 1)
+		assert.Equal(t, 1, diff.Contracts[0].RemovedCount)
+
+		// Only the most recent snapshots are kept
+		assert.NoError(t, s.Take(time.Unix(3000, 0)))
+		assert.Equal(t, []int64{2000, 3000}, s.Times())
+		_, err = s.Diff(time.Unix(1500, 0), time.Time{})
+		assert.Equal(t, errNotFound, err)
+
+		// The persisted snapshots are reloaded
+		if dir != "" {
+			reloaded, err := New(context.Background(), dir, time.Hour, 2)
+			assert.NoError(t, err)
+			assert.Equal(t, []int64{2000, 3000}, reloaded.Times())
+
+			diff, err := reloaded.Diff(time.Unix(2000, 0), time.Unix(3000, 0))
+			assert.NoError(t, err)
+			assert.Equal(t, 1, diff.Contracts[0].RemovedCount)
+		}
+	}
+}
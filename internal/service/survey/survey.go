@@ -183,6 +183,11 @@ type queryAwaiter struct {
 	manager *Surveyor   // The query manager used.
 }
 
+// Expected returns the number of responses expected, one from each of the peers.
+func (a *queryAwaiter) Expected() int {
+	return a.maximum
+}
+
 // Gather awaits for the responses to be received, blocking until we're done.
 func (a *queryAwaiter) Gather(timeout time.Duration) (r [][]byte) {
 	defer func() { a.manager.awaiters.Delete(a.id) }()
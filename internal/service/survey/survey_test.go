@@ -86,6 +86,7 @@ func TestQuery_Timeout(t *testing.T) {
 
 	result := awaiter.Gather(1 * time.Millisecond)
 	assert.Len(t, result, 0)
+	assert.Equal(t, 2, awaiter.Expected())
 }
 
 func TestQuery_NoPeers(t *testing.T) {
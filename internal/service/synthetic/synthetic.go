@@ -0,0 +1,211 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package synthetic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/async"
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service"
+)
+
+// The aggregates which can be computed over the source channels.
+const (
+	AggregateCount    = "count"    // The number of messages.
+	AggregateDistinct = "distinct" // The number of distinct partitions (e.g: devices).
+	AggregateBytes    = "bytes"    // The size of the payloads.
+)
+
+const maxDistinct = 100000 // The maximum number of distinct partitions counted per window.
+
+// Result represents the content of a message published on a synthetic channel.
+type Result struct {
+	Source    string `json:"source"`    // The pattern of the source channels.
+	Aggregate string `json:"aggregate"` // The aggregate computed.
+	Value     int64  `json:"value"`     // The value of the aggregate over the window.
+	From      int64  `json:"from"`      // The start of the window, in unix seconds.
+	Until     int64  `json:"until"`     // The end of the window, in unix seconds.
+}
+
+// Service represents the synthetic channels, whose messages are computed by the broker
+// from the messages published on their source channels. The aggregates are updated as the
+// messages are published and published on the synthetic channel of each contract at the
+// end of every window.
+type Service struct {
+	pubsub   service.PubSub // The pub/sub service to publish with.
+	channels []*channel     // The synthetic channels.
+}
+
+// New creates the synthetic channels from their configuration.
+func New(ctx context.Context, pubsub service.PubSub, cfg []config.SyntheticConfig) (*Service, error) {
+	s := &Service{pubsub: pubsub}
+	for _, v := range cfg {
+		c, err := newChannel(v)
+		if err != nil {
+			return nil, err
+		}
+
+		s.channels = append(s.channels, c)
+		async.Repeat(ctx, c.interval, func() {
+			s.flush(c, time.Now())
+		})
+	}
+	return s, nil
+}
+
+// Observe updates the aggregates of the synthetic channels whose source matches the
+// channel of the message.
+func (s *Service) Observe(m *message.Message) {
+	segments := security.SplitChannel(string(m.Channel))
+	for _, c := range s.channels {
+		if c.pattern.Match(segments) {
+			c.observe(m, strings.Join(segments[:len(c.pattern)], "/"))
+		}
+	}
+}
+
+// flush publishes the aggregates of a synthetic channel and starts a new window.
+func (s *Service) flush(c *channel, now time.Time) {
+	from, windows := c.swap(now)
+	for contract, w := range windows {
+		payload, err := json.Marshal(&Result{
+			Source:    c.source,
+			Aggregate: c.aggregate,
+			Value:     w.value(c.aggregate),
+			From:      from.Unix(),
+			Until:     now.Unix(),
+		})
+		if err != nil {
+			continue
+		}
+
+		s.pubsub.Publish(message.New(
+			message.NewSsid(contract, c.query),
+			c.name,
+			payload,
+		), nil)
+	}
+}
+
+// ------------------------------------------------------------------------------------
+
+// channel represents a synthetic channel.
+type channel struct {
+	sync.Mutex
+	name      []byte             // The synthetic channel.
+	query     []uint32           // The query of the synthetic channel.
+	source    string             // The pattern of the source channels.
+	pattern   security.Pattern   // The pattern of the source channels.
+	aggregate string             // The aggregate to compute.
+	interval  time.Duration      // The duration of a window.
+	from      time.Time          // The start of the current window.
+	windows   map[uint32]*window // The current window, by contract.
+}
+
+// newChannel creates a new synthetic channel.
+func newChannel(cfg config.SyntheticConfig) (*channel, error) {
+	target := security.ParseChannel([]byte("emitter/" + cfg.Channel))
+	if target.ChannelType != security.ChannelStatic {
+		return nil, fmt.Errorf("synthetic: the channel '%s' is not a valid static channel", cfg.Channel)
+	}
+
+	if strings.Trim(cfg.Source, "/ ") == "" {
+		return nil, fmt.Errorf("synthetic: the source of '%s' is not specified", cfg.Channel)
+	}
+
+	switch cfg.Aggregate {
+	case AggregateCount, AggregateDistinct, AggregateBytes:
+	default:
+		return nil, fmt.Errorf("synthetic: the aggregate '%s' of '%s' is not supported", cfg.Aggregate, cfg.Channel)
+	}
+
+	return &channel{
+		name:      target.Channel,
+		query:     target.Query,
+		source:    cfg.Source,
+		pattern:   security.ParsePattern(cfg.Source),
+		aggregate: cfg.Aggregate,
+		interval:  cfg.Window(),
+		from:      time.Now(),
+		windows:   make(map[uint32]*window),
+	}, nil
+}
+
+// observe updates the current window of the contract of the message.
+func (c *channel) observe(m *message.Message, partition string) {
+	c.Lock()
+	defer c.Unlock()
+
+	w, ok := c.windows[m.Contract()]
+	if !ok {
+		w = new(window)
+		c.windows[m.Contract()] = w
+	}
+
+	w.count++
+	w.bytes += int64(len(m.Payload))
+	if c.aggregate == AggregateDistinct && len(w.seen) < maxDistinct {
+		if w.seen == nil {
+			w.seen = make(map[string]struct{})
+		}
+		w.seen[partition] = struct{}{}
+	}
+}
+
+// swap starts a new window and returns the previous one. The contracts which were idle
+// during the previous window are forgotten, once their idle window was published.
+func (c *channel) swap(now time.Time) (time.Time, map[uint32]*window) {
+	c.Lock()
+	defer c.Unlock()
+
+	from, windows := c.from, c.windows
+	c.from = now
+	c.windows = make(map[uint32]*window, len(windows))
+	for contract, w := range windows {
+		if w.count > 0 {
+			c.windows[contract] = new(window)
+		}
+	}
+	return from, windows
+}
+
+// ------------------------------------------------------------------------------------
+
+// window represents the aggregates of a contract over a window.
+type window struct {
+	count int64               // The number of messages.
+	bytes int64               // The size of the payloads.
+	seen  map[string]struct{} // The distinct partitions.
+}
+
+// value returns the value of an aggregate.
+func (w *window) value(aggregate string) int64 {
+	switch aggregate {
+	case AggregateDistinct:
+		return int64(len(w.seen))
+	case AggregateBytes:
+		return w.bytes
+	default:
+		return w.count
+	}
+}
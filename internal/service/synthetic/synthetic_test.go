@@ -0,0 +1,101 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package synthetic
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/event"
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/service/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMessage(contract uint32, channel, payload string) *message.Message {
+	ssid := message.NewSsid(contract, security.MakeChannel("key", channel).Query)
+	return message.New(ssid, []byte(channel), []byte(payload))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []config.SyntheticConfig{
+		{Channel: "fleet/+/", Source: "fleet/+/status/", Aggregate: "count"},
+		{Channel: "fleet/summary/", Source: "", Aggregate: "count"},
+		{Channel: "fleet/summary/", Source: "fleet/+/status/", Aggregate: "avg"},
+	}
+
+	for _, tc := range tests {
+		_, err := New(context.Background(), new(fake.PubSub), []config.SyntheticConfig{tc})
+		assert.Error(t, err)
+	}
+}
+
+func TestSynthetic_Observe(t *testing.T) {
+	tests := []struct {
+		aggregate string
+		expected  int64
+	}{
+		{aggregate: AggregateCount, expected: 4},
+		{aggregate: AggregateDistinct, expected: 2},
+		{aggregate: AggregateBytes, expected: 7},
+	}
+
+	for _, tc := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		pubsub := new(fake.PubSub)
+		s, err := New(ctx, pubsub, []config.SyntheticConfig{{
+			Channel:   "fleet/summary/",
+			Source:    "fleet/+/status/",
+			Aggregate: tc.aggregate,
+			Interval:  3600,
+		}})
+		assert.NoError(t, err)
+
+		sub := new(fake.Conn)
+		pubsub.Subscribe(sub, &event.Subscription{
+			Ssid:    message.NewSsid(1, security.MakeChannel("key", "fleet/summary/").Query),
+			Channel: []byte("fleet/summary/"),
+		})
+
+		s.Observe(newTestMessage(1, "fleet/truck1/status/", "a"))
+		s.Observe(newTestMessage(1, "fleet/truck1/status/", "bb"))
+		s.Observe(newTestMessage(1, "fleet/truck2/status/engine/", "ccc"))
+		s.Observe(newTestMessage(1, "fleet/truck2/status/", "d"))
+		s.Observe(newTestMessage(1, "fleet/truck3/position/", "eeeee"))
+		s.Observe(newTestMessage(2, "fleet/truck4/status/", "f"))
+
+		// The aggregates of each contract are published at the end of the window
+		s.flush(s.channels[0], time.Now())
+		assert.Len(t, sub.Outgoing, 1)
+
+		var result Result
+		assert.NoError(t, json.Unmarshal(sub.Outgoing[0].Payload, &result))
+		assert.Equal(t, tc.expected, result.Value, tc.aggregate)
+		assert.Equal(t, "fleet/+/status/", result.Source)
+		assert.Equal(t, tc.aggregate, result.Aggregate)
+
+		// An idle window is published once, then the contract is forgotten
+		s.flush(s.channels[0], time.Now())
+		s.flush(s.channels[0], time.Now())
+		assert.Len(t, sub.Outgoing, 2)
+		assert.NoError(t, json.Unmarshal(sub.Outgoing[1].Payload, &result))
+		assert.Equal(t, int64(0), result.Value)
+		cancel()
+	}
+}
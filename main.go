@@ -19,12 +19,19 @@ import (
 	"os"
 
 	"github.com/emitter-io/config/dynamo"
-	"github.com/emitter-io/config/vault"
 	"github.com/emitter-io/emitter/internal/broker"
+	"github.com/emitter-io/emitter/internal/command/admin"
+	"github.com/emitter-io/emitter/internal/command/archive"
+	"github.com/emitter-io/emitter/internal/command/bench"
+	"github.com/emitter-io/emitter/internal/command/capacity"
+	"github.com/emitter-io/emitter/internal/command/fields"
 	"github.com/emitter-io/emitter/internal/command/license"
 	"github.com/emitter-io/emitter/internal/command/load"
+	"github.com/emitter-io/emitter/internal/command/migrate"
+	"github.com/emitter-io/emitter/internal/command/secret"
 	"github.com/emitter-io/emitter/internal/command/version"
 	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/config/remote"
 	"github.com/emitter-io/emitter/internal/provider/logging"
 	cli "github.com/jawher/mow.cli"
 )
@@ -33,26 +40,51 @@ import (
 
 func main() {
 	app := cli.App("emitter", "Runs the Emitter broker.")
-	app.Spec = "[ -c=<configuration path> ] "
+	app.Spec = "[ -c=<configuration path> ] [ -s=<assignment>... ] "
 	confPath := app.StringOpt("c config", "emitter.conf", "Specifies the configuration path (file) to use for the broker.")
-	app.Action = func() { listen(app, confPath) }
+	assignments := app.StringsOpt("s set", nil, "Overrides a configuration field, e.g: --set limit.readRate=1000 (see 'emitter config').")
+	app.Action = func() { listen(app, confPath, *assignments) }
 
 	// Register sub-commands
 	app.Command("version", "Prints the version of the executable.", version.Print)
 	app.Command("load", "Runs the load testing client for emitter.", load.Run)
+	app.Command("bench", "Benchmarks a broker and reports the throughput and latency percentiles.", bench.Run)
 	app.Command("license", "Manipulates licenses and secret keys.", func(cmd *cli.Cmd) {
 		cmd.Command("new", "Generates a new license and secret key pair.", license.New)
 		// TODO: add more sub-commands for license
 	})
+	app.Command("archive", "Reads the messages archived into an object storage.", func(cmd *cli.Cmd) {
+		cmd.Command("query", "Prints the archived messages of a contract, one JSON record per line.", archive.Query)
+	})
+	app.Command("admin", "Administers a broker through its admin API.", admin.Register)
+	app.Command("config", "Prints the configuration fields, along with how to override them.", fields.Print)
+	app.Command("capacity", "Prints the capacity report of the cluster, per node.", capacity.Report)
+	app.Command("migrate", "Migrates a data directory to the current on-disk format.", migrate.Run)
+	app.Command("secret", "Manipulates the encrypted configuration values.", func(cmd *cli.Cmd) {
+		cmd.Command("key", "Generates a new key for encrypting configuration values.", secret.NewKey)
+		cmd.Command("encrypt", "Encrypts a configuration value, prefixed with 'enc:'.", secret.Encrypt)
+	})
 
 	app.Run(os.Args)
 }
 
 // Listen starts the service.
-func listen(app *cli.Cli, conf *string) {
+func listen(app *cli.Cli, conf *string, assignments []string) {
+
+	// Read the configuration, then apply the assignments of the command line over it. The
+	// key-value stores come first, so they can provide the configuration of the secret stores.
+	cfg, err := config.New(*conf, remote.NewConsul(), remote.NewEtcd(), dynamo.NewProvider(), remote.NewVault(config.VaultUser))
+	if err != nil {
+		logging.LogError("service", "configuration", err)
+		return
+	}
+
+	if err := cfg.Set(assignments...); err != nil {
+		logging.LogError("service", "configuration", err)
+		return
+	}
 
 	// Generate a new license if none was provided
-	cfg := config.New(*conf, dynamo.NewProvider(), vault.NewProvider(config.VaultUser))
 	if cfg.License == "" {
 		logging.LogAction("service", "unable to find a license, make sure 'license' "+
 			"value is set in the config file or EMITTER_LICENSE environment variable")
@@ -68,5 +100,7 @@ func listen(app *cli.Cli, conf *string) {
 	}
 
 	// Listen and serve
-	svc.Listen()
+	if err := svc.Listen(); err != nil {
+		logging.LogError("service", "startup", err)
+	}
 }
@@ -0,0 +1,108 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+// Package broker embeds the emitter broker in another Go program, such as a single binary
+// shipped to the edge or the integration tests of an application. The broker is configured
+// the same way as the one of the emitter binary, then started and stopped by the program,
+// which can also connect to it from within the process.
+package broker
+
+import (
+	"context"
+	"net"
+
+	cfg "github.com/emitter-io/config"
+	"github.com/emitter-io/emitter/internal/broker"
+	"github.com/emitter-io/emitter/internal/config"
+)
+
+// Config represents the configuration of the broker, which has the same fields as the
+// configuration file of the emitter binary.
+type Config = config.Config
+
+// NewConfig creates the configuration of a standalone broker with the license specified,
+// which listens on the port 8080 and keeps the messages in memory.
+func NewConfig(license string) *Config {
+	return &Config{
+		ListenAddr: ":8080",
+		License:    license,
+		Storage: &cfg.ProviderConfig{
+			Provider: "inmemory",
+		},
+	}
+}
+
+// Broker represents a broker embedded in the program.
+type Broker struct {
+	service *broker.Service // The service of the broker.
+}
+
+// New creates a new broker from its configuration, which is not started yet.
+func New(config *Config) (*Broker, error) {
+	service, err := broker.NewService(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Broker{
+		service: service,
+	}, nil
+}
+
+// Start starts the cluster, the federation and the listeners configured, then returns while
+// the broker keeps running in the background until it is stopped. Unlike the emitter binary,
+// the broker does not handle the signals received by the process.
+func (b *Broker) Start() error {
+	return b.service.Start()
+}
+
+// StartOn starts the broker as Start does, except that the listener given, created by the
+// program, replaces the one listening on the address configured. The listener is closed when
+// the broker is stopped.
+func (b *Broker) StartOn(l net.Listener) error {
+	return b.service.StartOn(l)
+}
+
+// Stop stops the listeners, disconnects the clients and releases the resources of the
+// broker, which can not be started again.
+func (b *Broker) Stop() {
+	b.service.Close()
+}
+
+// Serve serves the HTTP and the MQTT connections accepted by a listener of the program, on
+// top of the ones configured. The name of the listener selects its settings in the
+// configuration (e.g: "tcp" for the liveness settings of the default listener). The listener
+// is closed when the broker is stopped.
+func (b *Broker) Serve(name string, l net.Listener) error {
+	return b.service.Serve(name, l)
+}
+
+// Dial opens a raw MQTT connection to the broker from within the process, which bypasses the
+// network and the listeners. Connect returns a client speaking MQTT over such a connection.
+func (b *Broker) Dial() net.Conn {
+	return b.service.Dial()
+}
+
+// Connect connects a client to the broker from within the process, under the client
+// identifier specified. The handler receives the messages of the channels the client
+// subscribes to, along with the responses of the broker to its requests.
+func (b *Broker) Connect(clientID string, handler Handler) (*Client, error) {
+	return newClient(b.Dial(), clientID, handler)
+}
+
+// Peers returns the number of peers of the cluster connected to the broker, which is zero
+// when the broker is not clustered.
+func (b *Broker) Peers() int {
+	return b.service.NumPeers()
+}
@@ -0,0 +1,103 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testLicense = "zT83oDV0DWY5_JysbSTPTDr8KB0AAAAAAAAAAAAAAAI"
+	testKey     = "w07Jv3TMhYTg6lLk6fQoVG2KCe7gjFPk" // on a/b/c/ with 'rwslp'
+)
+
+func newTestBroker(t *testing.T) *Broker {
+	cfg := NewConfig(testLicense)
+	cfg.ListenAddr = "127.0.0.1:0"
+
+	b, err := New(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, b.Start())
+	return b
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New(NewConfig("invalid"))
+	assert.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	b := newTestBroker(t)
+	defer b.Stop()
+
+	received := make(chan Message, 1)
+	c, err := b.Connect("test", func(m Message) {
+		received <- m
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, c.Subscribe(testKey, "a/b/c/"))
+	assert.NoError(t, c.Publish(testKey, "a/b/c/", []byte("hello")))
+
+	select {
+	case m := <-received:
+		assert.Equal(t, "a/b/c/", m.Channel)
+		assert.Equal(t, "hello", string(m.Payload))
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the message was not received")
+	}
+
+	assert.NoError(t, c.Unsubscribe(testKey, "a/b/c/"))
+	assert.NoError(t, c.Close())
+	<-c.Done()
+	assert.Equal(t, ErrClosed, c.Publish(testKey, "a/b/c/", nil))
+}
+
+func TestServe(t *testing.T) {
+	b := newTestBroker(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, b.Serve("tcp", l))
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	conn.Close()
+
+	// The listener is closed along with the broker
+	b.Stop()
+	_, err = net.Dial("tcp", l.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestStartOn(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	// The listener replaces the one of the address configured
+	b, err := New(NewConfig(testLicense))
+	assert.NoError(t, err)
+	assert.NoError(t, b.StartOn(l))
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	conn.Close()
+
+	b.Stop()
+	_, err = net.Dial("tcp", l.Addr().String())
+	assert.Error(t, err)
+}
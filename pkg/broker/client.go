@@ -0,0 +1,263 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package broker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+)
+
+const requestTimeout = 10 * time.Second // The time given to the broker to acknowledge a request.
+
+// ErrClosed is returned when using a client which was closed or disconnected by the broker.
+var ErrClosed = errors.New("broker: the client is closed")
+
+// errTimeout is returned when the broker does not acknowledge a request in time.
+var errTimeout = errors.New("broker: the request was not acknowledged in time")
+
+// Message represents a message received by a client.
+type Message struct {
+	Channel string // The channel the message was published on.
+	Payload []byte // The payload of the message.
+}
+
+// Handler handles the messages received by a client. It is called from a single goroutine,
+// in the order the messages were received, and may use the client. The messages are queued
+// while it runs, so the broker is never held up by a slow handler.
+type Handler func(Message)
+
+// Client represents a client connected to the broker from within the process, which speaks
+// MQTT over an in-memory connection rather than a socket.
+type Client struct {
+	lock    sync.Mutex               // The lock of the acknowledgements and of the inbox.
+	writing sync.Mutex               // The lock of the writes.
+	conn    net.Conn                 // The connection to the broker.
+	next    uint16                   // The identifier of the next request.
+	acks    map[uint16]chan struct{} // The requests waiting to be acknowledged.
+	inbox   []Message                // The messages waiting for the handler.
+	queued  chan struct{}            // Signals that messages were added to the inbox.
+	done    chan struct{}            // Closed once the client is disconnected.
+	handler Handler                  // The handler of the messages received.
+}
+
+// newClient connects a new client over the connection and waits for the broker to accept it.
+func newClient(conn net.Conn, clientID string, handler Handler) (*Client, error) {
+	c := &Client{
+		conn:    conn,
+		acks:    make(map[uint16]chan struct{}),
+		queued:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		handler: handler,
+	}
+
+	// Connect and read the acknowledgement right away, before anything else is received
+	reader := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+	connect := mqtt.Connect{ClientID: []byte(clientID)}
+	if _, err := connect.EncodeTo(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	pkt, err := mqtt.DecodePacket(reader, math.MaxInt32)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if ack, ok := pkt.(*mqtt.Connack); !ok || ack.ReturnCode != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("broker: the connection was refused (%v)", pkt)
+	}
+
+	conn.SetDeadline(time.Time{})
+	go c.read(reader)
+	go c.dispatch()
+	return c, nil
+}
+
+// Publish publishes a message on the channel with the key specified. The channel may carry
+// options, such as a time-to-live (e.g: "sensors/1/?ttl=60").
+func (c *Client) Publish(key, channel string, payload []byte) error {
+	return c.write(&mqtt.Publish{
+		Topic:   []byte(key + "/" + channel),
+		Payload: payload,
+	})
+}
+
+// Subscribe subscribes to the channel with the key specified and waits for the broker to
+// acknowledge it. A subscription which is not authorized is reported to the handler on the
+// "emitter/error/" channel.
+func (c *Client) Subscribe(key, channel string) error {
+	return c.request(func(id uint16) mqtt.Message {
+		return &mqtt.Subscribe{
+			MessageID: id,
+			Subscriptions: []mqtt.TopicQOSTuple{
+				{Topic: []byte(key + "/" + channel)},
+			},
+		}
+	})
+}
+
+// Unsubscribe unsubscribes from the channel with the key specified and waits for the broker
+// to acknowledge it.
+func (c *Client) Unsubscribe(key, channel string) error {
+	return c.request(func(id uint16) mqtt.Message {
+		return &mqtt.Unsubscribe{
+			MessageID: id,
+			Topics: []mqtt.TopicQOSTuple{
+				{Topic: []byte(key + "/" + channel)},
+			},
+		}
+	})
+}
+
+// Close disconnects the client from the broker.
+func (c *Client) Close() error {
+	c.write(new(mqtt.Disconnect))
+	return c.conn.Close()
+}
+
+// Done returns a channel which is closed once the client is disconnected.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// request sends a request to the broker and waits for its acknowledgement.
+func (c *Client) request(packetOf func(id uint16) mqtt.Message) error {
+	c.lock.Lock()
+	c.next++
+	id, ack := c.next, make(chan struct{})
+	c.acks[id] = ack
+	c.lock.Unlock()
+
+	defer func() {
+		c.lock.Lock()
+		delete(c.acks, id)
+		c.lock.Unlock()
+	}()
+
+	if err := c.write(packetOf(id)); err != nil {
+		return err
+	}
+
+	select {
+	case <-ack:
+		return nil
+	case <-c.done:
+		return ErrClosed
+	case <-time.After(requestTimeout):
+		return errTimeout
+	}
+}
+
+// write sends a packet to the broker.
+func (c *Client) write(pkt mqtt.Message) error {
+	c.writing.Lock()
+	defer c.writing.Unlock()
+
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+
+	_, err := pkt.EncodeTo(c.conn)
+	return err
+}
+
+// acknowledge acknowledges the request with the identifier specified.
+func (c *Client) acknowledge(id uint16) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if ack, ok := c.acks[id]; ok {
+		close(ack)
+		delete(c.acks, id)
+	}
+}
+
+// read reads the packets sent by the broker, until the connection is closed.
+func (c *Client) read(reader *bufio.Reader) {
+	defer close(c.done)
+	defer c.conn.Close()
+
+	for {
+		pkt, err := mqtt.DecodePacket(reader, math.MaxInt32)
+		if err != nil {
+			return
+		}
+
+		switch p := pkt.(type) {
+		case *mqtt.Publish:
+			c.enqueue(Message{
+				Channel: string(p.Topic),
+				Payload: append([]byte(nil), p.Payload...),
+			})
+		case *mqtt.Suback:
+			c.acknowledge(p.MessageID)
+		case *mqtt.Unsuback:
+			c.acknowledge(p.MessageID)
+		}
+	}
+}
+
+// enqueue adds a message received to the inbox, waking up the dispatcher.
+func (c *Client) enqueue(m Message) {
+	c.lock.Lock()
+	c.inbox = append(c.inbox, m)
+	c.lock.Unlock()
+
+	select {
+	case c.queued <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch hands the messages received over to the handler, until the client is disconnected
+// and its inbox is empty.
+func (c *Client) dispatch() {
+	for {
+		select {
+		case <-c.queued:
+		case <-c.done:
+			if c.handle() == 0 {
+				return
+			}
+		}
+		c.handle()
+	}
+}
+
+// handle hands the messages of the inbox over to the handler and returns their number.
+func (c *Client) handle() int {
+	c.lock.Lock()
+	inbox := c.inbox
+	c.inbox = nil
+	c.lock.Unlock()
+
+	for _, m := range inbox {
+		if c.handler != nil {
+			c.handler(m)
+		}
+	}
+	return len(inbox)
+}
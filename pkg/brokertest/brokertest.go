@@ -0,0 +1,218 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+// Package brokertest starts the brokers, or a small cluster of them, within the integration
+// tests of an application. Each broker listens on a random port of the loopback interface,
+// with a freshly generated license, keeps the messages in memory and is stopped along with
+// the test, so the tests can run in parallel without any external process.
+package brokertest
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/config"
+	"github.com/emitter-io/emitter/internal/provider/contract"
+	"github.com/emitter-io/emitter/internal/provider/usage"
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/internal/security/license"
+	"github.com/emitter-io/emitter/internal/service/keygen"
+	"github.com/emitter-io/emitter/pkg/broker"
+)
+
+const joinTimeout = 30 * time.Second // The time given to the nodes of a cluster to join.
+
+// Broker represents a broker started for a test.
+type Broker struct {
+	*broker.Broker
+	t       testing.TB      // The test the broker was started for.
+	keygen  *keygen.Service // The key generator of the license.
+	Addr    string          // The address of the listener, for the MQTT and the HTTP clients.
+	License string          // The license of the broker.
+	Secret  string          // The master key of the license.
+}
+
+// New starts a broker for the test, which is stopped once the test and its subtests are
+// complete. The configuration of the broker can be adjusted by the functions specified
+// before it is started.
+func New(t testing.TB, configure ...func(*broker.Config)) *Broker {
+	t.Helper()
+	lic, secret := license.New()
+	return start(t, lic, secret, nil, configure)
+}
+
+// NewCluster starts a cluster of n brokers for the test, sharing the same license, then
+// waits for all of them to be connected to each other. The subscriptions are still gossiped
+// asynchronously across the cluster.
+func NewCluster(t testing.TB, n int, configure ...func(*broker.Config)) []*Broker {
+	t.Helper()
+	lic, secret := license.New()
+	nodes := make([]*Broker, 0, n)
+	seed := ""
+	for i := 0; i < n; i++ {
+		cluster := &config.ClusterConfig{
+			NodeName:  newNodeName(t),
+			Directory: t.TempDir(),
+		}
+
+		// Every node joins the first one
+		cluster.ListenAddr = clusterAddr(t)
+		cluster.AdvertiseAddr = cluster.ListenAddr
+		cluster.Seed = seed
+		if i == 0 {
+			seed = cluster.ListenAddr
+		}
+
+		nodes = append(nodes, start(t, lic, secret, cluster, configure))
+	}
+
+	// Wait for the whole cluster to form
+	deadline := time.Now().Add(joinTimeout)
+	for _, node := range nodes {
+		for node.Peers() < n-1 {
+			if time.Now().After(deadline) {
+				t.Fatalf("brokertest: the cluster did not form, %d of %d peers connected", node.Peers(), n-1)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	return nodes
+}
+
+// start starts a broker with the license and the cluster configuration specified.
+func start(t testing.TB, lic, secret string, cluster *config.ClusterConfig, configure []func(*broker.Config)) *Broker {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("brokertest: %v", err)
+	}
+
+	// The broker serves the listener bound here, so no other process can take its port
+	t.Cleanup(func() { l.Close() })
+	cfg := broker.NewConfig(lic)
+	cfg.ListenAddr = l.Addr().String()
+	cfg.Cluster = cluster
+	for _, f := range configure {
+		f(cfg)
+	}
+
+	parsed, err := license.Parse(cfg.License)
+	if err != nil {
+		t.Fatalf("brokertest: %v", err)
+	}
+
+	cipher, err := parsed.Cipher()
+	if err != nil {
+		t.Fatalf("brokertest: %v", err)
+	}
+
+	b, err := broker.New(cfg)
+	if err != nil {
+		t.Fatalf("brokertest: %v", err)
+	}
+
+	t.Cleanup(b.Stop)
+	if err := b.StartOn(l); err != nil {
+		t.Fatalf("brokertest: %v", err)
+	}
+
+	return &Broker{
+		Broker:  b,
+		t:       t,
+		keygen:  keygen.New(cipher, contract.NewSingleContractProvider(parsed, usage.NewNoop()), nil),
+		Addr:    l.Addr().String(),
+		License: cfg.License,
+		Secret:  secret,
+	}
+}
+
+// Key generates a key for the channel with the access specified as in the key generation
+// requests (e.g: "rwslp"), which does not expire. The test fails if the key can not be
+// generated.
+func (b *Broker) Key(channel, access string) string {
+	b.t.Helper()
+	key, err := b.keygen.CreateKey(b.Secret, channel, accessOf(access), time.Unix(0, 0))
+	if err != nil {
+		b.t.Fatalf("brokertest: generating a key for %s: %v", channel, err)
+	}
+
+	return key
+}
+
+// Connect connects a client to the broker from within the process, which is closed once the
+// test is complete. The test fails if the client can not connect.
+func (b *Broker) Connect(clientID string, handler broker.Handler) *broker.Client {
+	b.t.Helper()
+	c, err := b.Broker.Connect(clientID, handler)
+	if err != nil {
+		b.t.Fatalf("brokertest: connecting %s: %v", clientID, err)
+	}
+
+	b.t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// accessOf parses the access of a key, one letter per permission.
+func accessOf(access string) uint8 {
+	required := security.AllowNone
+	for i := 0; i < len(access); i++ {
+		switch access[i] {
+		case 'r':
+			required |= security.AllowRead
+		case 'w':
+			required |= security.AllowWrite
+		case 's':
+			required |= security.AllowStore
+		case 'l':
+			required |= security.AllowLoad
+		case 'p':
+			required |= security.AllowPresence
+		case 'e':
+			required |= security.AllowExtend
+		case 'x':
+			required |= security.AllowExecute
+		}
+	}
+
+	return required
+}
+
+// clusterAddr picks a random port of the loopback interface for the gossip of a node, which
+// the cluster binds by itself and hence is only released here for it to be bound again.
+func clusterAddr(t testing.TB) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("brokertest: %v", err)
+	}
+
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// newNodeName generates a random name for a node of the cluster, since the nodes running in
+// the same process share the same hardware address.
+func newNodeName(t testing.TB) string {
+	t.Helper()
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("brokertest: %v", err)
+	}
+
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", b[0], b[1], b[2], b[3], b[4], b[5])
+}
@@ -0,0 +1,85 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package brokertest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/security"
+	"github.com/emitter-io/emitter/pkg/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	b := New(t)
+	key := b.Key("a/b/c/", "rw")
+
+	received := make(chan broker.Message, 1)
+	c := b.Connect("test", func(m broker.Message) {
+		received <- m
+	})
+
+	assert.NoError(t, c.Subscribe(key, "a/b/c/"))
+	assert.NoError(t, c.Publish(key, "a/b/c/", []byte("hello")))
+	select {
+	case m := <-received:
+		assert.Equal(t, "hello", string(m.Payload))
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the message was not received")
+	}
+
+	conn, err := net.Dial("tcp", b.Addr)
+	assert.NoError(t, err)
+	conn.Close()
+}
+
+func TestNewCluster(t *testing.T) {
+	nodes := NewCluster(t, 2)
+	assert.Len(t, nodes, 2)
+	assert.Equal(t, nodes[0].License, nodes[1].License)
+	assert.Equal(t, 1, nodes[0].Peers())
+	assert.Equal(t, 1, nodes[1].Peers())
+
+	key := nodes[0].Key("a/", "rw")
+	received := make(chan broker.Message, 10)
+	sub := nodes[1].Connect("sub", func(m broker.Message) {
+		received <- m
+	})
+	pub := nodes[0].Connect("pub", nil)
+	assert.NoError(t, sub.Subscribe(key, "a/"))
+
+	// The subscription is gossiped asynchronously, publish until it reaches the other node
+	deadline := time.After(10 * time.Second)
+	for {
+		assert.NoError(t, pub.Publish(key, "a/", []byte("hello")))
+		select {
+		case m := <-received:
+			assert.Equal(t, "hello", string(m.Payload))
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			assert.Fail(t, "the message was not received")
+			return
+		}
+	}
+}
+
+func Test_accessOf(t *testing.T) {
+	assert.Equal(t, security.AllowNone, accessOf(""))
+	assert.Equal(t, security.AllowReadWrite, accessOf("rw"))
+	assert.Equal(t, security.AllowRead|security.AllowStore|security.AllowLoad, accessOf("rsl"))
+}
@@ -0,0 +1,92 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package emittertest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock represents a clock which only moves when told to, for testing the code which
+// depends on the time without waiting for it.
+type Clock struct {
+	sync.Mutex
+	now     time.Time // The current time of the clock.
+	waiters []waiter  // The pending timers, fired once the clock reaches them.
+}
+
+// waiter represents a pending timer of the clock.
+type waiter struct {
+	at time.Time      // The time the timer fires at.
+	ch chan time.Time // The channel the time is sent to.
+}
+
+// NewClock creates a new clock, set at the specified time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+// UnixNano returns the current time of the clock, in unix nanoseconds.
+func (c *Clock) UnixNano() int64 {
+	return c.Now().UnixNano()
+}
+
+// After returns a channel which receives the time once the clock is advanced by at least
+// the duration specified.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+
+	c.waiters = append(c.waiters, waiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by the duration specified, firing the timers reached.
+func (c *Clock) Advance(d time.Duration) {
+	c.Lock()
+	now := c.now.Add(d)
+	c.Unlock()
+	c.Set(now)
+}
+
+// Set sets the time of the clock, firing the timers reached.
+func (c *Clock) Set(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = now
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- now
+	}
+	c.waiters = pending
+}
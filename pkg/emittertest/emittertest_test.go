@@ -0,0 +1,93 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package emittertest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMessage(channel, payload string) *message.Message {
+	m := message.New(message.Ssid{1, 2, 3}, []byte(channel), []byte(payload))
+	m.Headers = message.Headers{"trace": "abc"}
+	return m
+}
+
+func TestSubscriber(t *testing.T) {
+	s := NewSubscriber("sub")
+	assert.Equal(t, "sub", s.ID())
+	assert.Equal(t, message.SubscriberDirect, s.Type())
+	assert.False(t, s.Wait(1, time.Millisecond))
+
+	go s.Send(newTestMessage("a/b/", "hello"))
+	assert.True(t, s.Wait(1, time.Second))
+
+	deliveries := s.Deliveries()
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, "a/b/", deliveries[0].Channel)
+	assert.Equal(t, []byte("hello"), deliveries[0].Payload)
+	assert.Equal(t, "abc", deliveries[0].Headers["trace"])
+
+	s.Reset()
+	assert.Equal(t, 0, s.Count())
+}
+
+func TestClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := NewClock(start)
+	assert.Equal(t, start, c.Now())
+
+	immediate := c.After(0)
+	later := c.After(time.Minute)
+	assert.Equal(t, start, <-immediate)
+
+	c.Advance(30 * time.Second)
+	select {
+	case <-later:
+		t.Fatal("the timer fired too early")
+	default:
+	}
+
+	c.Advance(30 * time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-later)
+	assert.Equal(t, start.Add(time.Minute).UnixNano(), c.UnixNano())
+}
+
+func TestPeer(t *testing.T) {
+	errDropped := errors.New("dropped")
+	p := NewPeer("peer")
+	assert.Equal(t, message.SubscriberRemote, p.Type())
+
+	p.Script(nil, errDropped)
+	assert.NoError(t, p.Send(newTestMessage("a/", "1")))
+	assert.Equal(t, errDropped, p.Send(newTestMessage("a/", "2")))
+	assert.NoError(t, p.Send(newTestMessage("a/", "3")))
+	assert.Equal(t, 2, p.Count())
+
+	p.Down()
+	assert.False(t, p.IsActive())
+	assert.Equal(t, ErrPeerDown, p.Send(newTestMessage("a/", "4")))
+	p.Up()
+	assert.True(t, p.IsActive())
+
+	p.Subscribe(message.Ssid{1, 2}, "a/")
+	p.Subscribe(message.Ssid{1, 3}, "b/")
+	p.Unsubscribe("b/")
+	assert.Equal(t, map[string]message.Ssid{"a/": {1, 2}}, p.Subscriptions())
+}
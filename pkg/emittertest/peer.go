@@ -0,0 +1,124 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package emittertest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/emitter-io/emitter/internal/message"
+)
+
+// Peer implements message.Subscriber
+var _ message.Subscriber = new(Peer)
+
+// ErrPeerDown is returned when sending to a peer which is down.
+var ErrPeerDown = errors.New("emittertest: the peer is down")
+
+// Peer represents a peer of the cluster whose behaviour is scripted. The messages forwarded
+// to it are captured, unless the script makes the forwarding fail.
+type Peer struct {
+	*Subscriber
+	lock   sync.Mutex
+	down   bool                    // Whether the peer is down.
+	script []error                 // The results of the next sends, in order.
+	subs   map[string]message.Ssid // The subscriptions of the peer, by channel.
+}
+
+// NewPeer creates a new scripted peer, which is up and accepts every message.
+func NewPeer(name string) *Peer {
+	return &Peer{
+		Subscriber: NewSubscriber(name),
+		subs:       make(map[string]message.Ssid),
+	}
+}
+
+// Type returns the type of the subscriber.
+func (p *Peer) Type() message.SubscriberType {
+	return message.SubscriberRemote
+}
+
+// Script sets the results of the next sends, in order. A nil result delivers the message
+// and an error fails the send, while the sends after the script deliver the messages.
+func (p *Peer) Script(results ...error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.script = append(p.script, results...)
+}
+
+// Down makes the peer unreachable, failing every send until it is up again.
+func (p *Peer) Down() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.down = true
+}
+
+// Up makes the peer reachable again.
+func (p *Peer) Up() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.down = false
+}
+
+// IsActive returns whether the peer is up.
+func (p *Peer) IsActive() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return !p.down
+}
+
+// Send forwards the message to the peer, following the script.
+func (p *Peer) Send(m *message.Message) error {
+	p.lock.Lock()
+	var err error
+	switch {
+	case p.down:
+		err = ErrPeerDown
+	case len(p.script) > 0:
+		err, p.script = p.script[0], p.script[1:]
+	}
+	p.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return p.Subscriber.Send(m)
+}
+
+// Subscribe records a subscription of the peer to the channel.
+func (p *Peer) Subscribe(ssid message.Ssid, channel string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.subs[channel] = ssid
+}
+
+// Unsubscribe removes a subscription of the peer to the channel.
+func (p *Peer) Unsubscribe(channel string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.subs, channel)
+}
+
+// Subscriptions returns the subscriptions of the peer, by channel.
+func (p *Peer) Subscriptions() map[string]message.Ssid {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	out := make(map[string]message.Ssid, len(p.subs))
+	for channel, ssid := range p.subs {
+		out[channel] = ssid
+	}
+	return out
+}
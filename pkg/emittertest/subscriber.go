@@ -0,0 +1,131 @@
+/**********************************************************************************
+* Copyright (c) 2009-2019 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+// Package emittertest provides the test doubles for the code embedding the broker or
+// extending it, so that it can be unit-tested against stable fakes: a subscriber capturing
+// the deliveries, a controllable clock and a scriptable peer of the cluster.
+package emittertest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/message"
+)
+
+// Subscriber implements message.Subscriber
+var _ message.Subscriber = new(Subscriber)
+
+// Delivery represents a message delivered to a subscriber.
+type Delivery struct {
+	Channel string            // The channel of the message.
+	Payload []byte            // The payload of the message.
+	Headers map[string]string // The headers of the message, if any.
+	TTL     uint32            // The time-to-live of the message, in seconds.
+	Time    int64             // The unix time of the message.
+}
+
+// deliveryOf returns the delivery of a message, copying its content.
+func deliveryOf(m *message.Message) Delivery {
+	d := Delivery{
+		Channel: string(m.Channel),
+		Payload: append([]byte(nil), m.Payload...),
+		TTL:     m.TTL,
+		Time:    m.Time(),
+	}
+
+	if len(m.Headers) > 0 {
+		d.Headers = make(map[string]string, len(m.Headers))
+		for k, v := range m.Headers {
+			d.Headers[k] = v
+		}
+	}
+	return d
+}
+
+// Subscriber represents an in-memory subscriber which captures the messages delivered to it.
+type Subscriber struct {
+	sync.Mutex
+	id       string        // The identifier of the subscriber.
+	received []Delivery    // The messages delivered.
+	notify   chan struct{} // Signalled on every delivery.
+}
+
+// NewSubscriber creates a new in-memory subscriber.
+func NewSubscriber(id string) *Subscriber {
+	return &Subscriber{
+		id:     id,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// ID returns the unique identifier of the subscriber.
+func (s *Subscriber) ID() string {
+	return s.id
+}
+
+// Type returns the type of the subscriber.
+func (s *Subscriber) Type() message.SubscriberType {
+	return message.SubscriberDirect
+}
+
+// Send captures the message delivered.
+func (s *Subscriber) Send(m *message.Message) error {
+	s.Lock()
+	s.received = append(s.received, deliveryOf(m))
+	s.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Deliveries returns the messages delivered so far, in order.
+func (s *Subscriber) Deliveries() []Delivery {
+	s.Lock()
+	defer s.Unlock()
+	return append([]Delivery(nil), s.received...)
+}
+
+// Count returns the number of messages delivered so far.
+func (s *Subscriber) Count() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.received)
+}
+
+// Wait waits until at least the specified number of messages were delivered, and returns
+// whether they were before the timeout.
+func (s *Subscriber) Wait(count int, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for s.Count() < count {
+		select {
+		case <-s.notify:
+		case <-deadline.C:
+			return s.Count() >= count
+		}
+	}
+	return true
+}
+
+// Reset forgets the messages delivered so far.
+func (s *Subscriber) Reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.received = nil
+}
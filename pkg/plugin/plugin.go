@@ -0,0 +1,182 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+// Package plugin defines the stable interfaces of the plugins extending the broker, which
+// are external binaries run by the broker and served over RPC with hashicorp/go-plugin. A
+// plugin implements any of an authorizer, a store, a connector and a hook, then calls Serve
+// from its main function.
+package plugin
+
+import (
+	goplugin "github.com/hashicorp/go-plugin"
+)
+
+// The kinds of plugins, under which they are dispensed.
+const (
+	KindAuthorizer = "authorizer" // Approves the requests authorized by their key.
+	KindStore      = "store"      // Stores the messages and queries their history.
+	KindConnector  = "connector"  // Sends the messages to an external system.
+	KindHook       = "hook"       // Validates, transforms or refuses the messages published.
+)
+
+// The permissions requested from an authorizer, which are the same bits as the ones of the
+// keys.
+const (
+	PermissionRead     = uint8(1 << 1) // Subscribing to the channel.
+	PermissionWrite    = uint8(1 << 2) // Publishing on the channel.
+	PermissionStore    = uint8(1 << 3) // Storing the messages published on the channel.
+	PermissionLoad     = uint8(1 << 4) // Reading the history of the channel.
+	PermissionPresence = uint8(1 << 5) // Querying the presence on the channel.
+)
+
+// Handshake is the handshake shared by the broker and its plugins, which keeps a plugin from
+// being run by hand or by an incompatible version of the broker.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "EMITTER_PLUGIN",
+	MagicCookieValue: "c8d1f7a2e6b94b0e9a3d5f1c2b7e8a90",
+}
+
+// Message represents a message passed to a plugin.
+type Message struct {
+	ID       []byte            // The identifier of the message, kept as is by the stores.
+	Ssid     []uint32          // The hashed channel of the message, starting with the contract.
+	Contract uint32            // The contract of the message.
+	Channel  string            // The channel of the message.
+	Payload  []byte            // The payload of the message.
+	TTL      uint32            // The time-to-live of the message, in seconds.
+	Headers  map[string]string // The headers of the message.
+	Time     int64             // The time the message was published, in unix seconds.
+	Expires  int64             // The time the message expires, in unix seconds, if stored.
+}
+
+// Query represents a query of the messages of a store.
+type Query struct {
+	Ssid  []uint32 // The hashed channel queried, which may contain wildcards.
+	From  int64    // The start of the time window, in unix seconds.
+	Until int64    // The end of the time window, in unix seconds.
+	Limit int      // The maximum number of messages returned, the newest ones.
+}
+
+// AuthRequest represents a request to an authorizer.
+type AuthRequest struct {
+	Contract   uint32 // The contract of the key used.
+	Channel    string // The channel of the request.
+	Permission uint8  // The permission requested on the channel.
+}
+
+// Authorizer approves the requests which were authorized by their key, so that the access to
+// the channels can also depend on an external system.
+type Authorizer interface {
+	Authorize(req *AuthRequest) (bool, error)
+}
+
+// Store stores the messages and queries their history, as the storage of the broker.
+type Store interface {
+	Configure(config map[string]interface{}) error
+	Store(m *Message) error
+	Query(q *Query) ([]Message, error)
+	Delete(q *Query) error
+}
+
+// Connector sends the messages routed to it to an external system.
+type Connector interface {
+	Send(m *Message) error
+}
+
+// Hook validates, transforms or enriches the messages published, before they are delivered
+// and stored. It may change the payload, the time-to-live and the headers of the message, or
+// refuse it by returning a *Rejection.
+type Hook interface {
+	OnPublish(m *Message) error
+}
+
+// Rejection is returned by a hook which refuses a message, along with the reason given to
+// the publisher.
+type Rejection struct {
+	Reason string
+}
+
+// Error returns the reason of the rejection.
+func (r *Rejection) Error() string {
+	return r.Reason
+}
+
+// Set represents the implementations served by a plugin, each of them being optional.
+type Set struct {
+	Authorizer Authorizer
+	Store      Store
+	Connector  Connector
+	Hook       Hook
+}
+
+// Plugins returns the plugins of the set, by kind. A nil set returns all of the kinds,
+// without any implementation, as needed to dispense them on the side of the broker.
+func (s *Set) Plugins() goplugin.PluginSet {
+	if s == nil {
+		return goplugin.PluginSet{
+			KindAuthorizer: new(authorizerPlugin),
+			KindStore:      new(storePlugin),
+			KindConnector:  new(connectorPlugin),
+			KindHook:       new(hookPlugin),
+		}
+	}
+
+	plugins := make(goplugin.PluginSet, 4)
+	if s.Authorizer != nil {
+		plugins[KindAuthorizer] = &authorizerPlugin{impl: s.Authorizer}
+	}
+	if s.Store != nil {
+		plugins[KindStore] = &storePlugin{impl: s.Store}
+	}
+	if s.Connector != nil {
+		plugins[KindConnector] = &connectorPlugin{impl: s.Connector}
+	}
+	if s.Hook != nil {
+		plugins[KindHook] = &hookPlugin{impl: s.Hook}
+	}
+	return plugins
+}
+
+// Serve serves the implementations of the set to the broker which has run the plugin. This
+// is called from the main function of the plugin and blocks until the broker stops it.
+func Serve(set *Set) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         set.Plugins(),
+	})
+}
+
+// ------------------------------------------------------------------------------------
+
+// The hashes of the wildcards of a query.
+const (
+	wildcard      = uint32(1815237614) // +
+	multiWildcard = uint32(4285801373) // #
+)
+
+// Matches checks whether the message was published on a channel matching the query, within
+// its time window.
+func (q *Query) Matches(m *Message) bool {
+	if len(q.Ssid) > len(m.Ssid) || m.Time < q.From || m.Time > q.Until {
+		return false
+	}
+
+	for i, v := range q.Ssid {
+		if v != m.Ssid[i] && v != wildcard && v != multiWildcard {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPlugin struct {
+	stored []Message
+}
+
+func (p *testPlugin) Authorize(req *AuthRequest) (bool, error) {
+	if req.Contract == 0 {
+		return false, errors.New("no contract")
+	}
+	return req.Channel != "private/" || req.Permission == PermissionRead, nil
+}
+
+func (p *testPlugin) Configure(config map[string]interface{}) error {
+	if config["fail"] == true {
+		return errors.New("invalid configuration")
+	}
+	return nil
+}
+
+func (p *testPlugin) Store(m *Message) error {
+	p.stored = append(p.stored, *m)
+	return nil
+}
+
+func (p *testPlugin) Query(q *Query) (out []Message, err error) {
+	for _, m := range p.stored {
+		if q.Matches(&m) {
+			out = append(out, m)
+		}
+	}
+	return
+}
+
+func (p *testPlugin) Delete(q *Query) error {
+	p.stored = p.stored[:0]
+	return nil
+}
+
+func (p *testPlugin) Send(m *Message) error {
+	return p.Store(m)
+}
+
+func (p *testPlugin) OnPublish(m *Message) error {
+	switch string(m.Payload) {
+	case "bad":
+		return &Rejection{Reason: "bad payload"}
+	case "fail":
+		return errors.New("failed")
+	}
+
+	m.Payload = append(m.Payload, '!')
+	m.Headers = map[string]string{"zone": "eu"}
+	return nil
+}
+
+func dispense(t *testing.T, set *Set, kind string) interface{} {
+	client, _ := goplugin.TestPluginRPCConn(t, set.Plugins(), nil)
+	raw, err := client.Dispense(kind)
+	assert.NoError(t, err)
+	return raw
+}
+
+func TestSet_Plugins(t *testing.T) {
+	var set *Set
+	assert.Len(t, set.Plugins(), 4)
+	assert.Len(t, (&Set{Hook: new(testPlugin)}).Plugins(), 1)
+
+	// A kind which is not served by the plugin can not be dispensed
+	client, _ := goplugin.TestPluginRPCConn(t, (&Set{Hook: new(testPlugin)}).Plugins(), nil)
+	_, err := client.Dispense(KindStore)
+	assert.Error(t, err)
+}
+
+func TestAuthorizer(t *testing.T) {
+	authorizer := dispense(t, &Set{Authorizer: new(testPlugin)}, KindAuthorizer).(Authorizer)
+
+	ok, err := authorizer.Authorize(&AuthRequest{Contract: 1, Channel: "private/", Permission: PermissionRead})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = authorizer.Authorize(&AuthRequest{Contract: 1, Channel: "private/", Permission: PermissionWrite})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = authorizer.Authorize(&AuthRequest{Channel: "private/"})
+	assert.Error(t, err)
+}
+
+func TestStore(t *testing.T) {
+	store := dispense(t, &Set{Store: new(testPlugin)}, KindStore).(Store)
+	assert.NoError(t, store.Configure(map[string]interface{}{"path": "/data"}))
+	assert.Error(t, store.Configure(map[string]interface{}{"fail": true}))
+
+	assert.NoError(t, store.Store(&Message{Ssid: []uint32{1, 2, 3}, Channel: "a/b/", Payload: []byte("x"), Time: 10}))
+	assert.NoError(t, store.Store(&Message{Ssid: []uint32{1, 4, 3}, Channel: "c/b/", Payload: []byte("y"), Time: 20}))
+
+	msgs, err := store.Query(&Query{Ssid: []uint32{1, wildcard, 3}, From: 0, Until: 15, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "a/b/", msgs[0].Channel)
+
+	assert.NoError(t, store.Delete(&Query{Ssid: []uint32{1}}))
+	msgs, err = store.Query(&Query{Ssid: []uint32{1}, Until: 100})
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+}
+
+func TestConnector(t *testing.T) {
+	impl := new(testPlugin)
+	connector := dispense(t, &Set{Connector: impl}, KindConnector).(Connector)
+	assert.NoError(t, connector.Send(&Message{Channel: "a/", Payload: []byte("hello")}))
+	assert.Len(t, impl.stored, 1)
+	assert.Equal(t, "hello", string(impl.stored[0].Payload))
+}
+
+func TestHook(t *testing.T) {
+	hook := dispense(t, &Set{Hook: new(testPlugin)}, KindHook).(Hook)
+
+	msg := &Message{Channel: "a/", Payload: []byte("hello")}
+	assert.NoError(t, hook.OnPublish(msg))
+	assert.Equal(t, "hello!", string(msg.Payload))
+	assert.Equal(t, map[string]string{"zone": "eu"}, msg.Headers)
+
+	err := hook.OnPublish(&Message{Channel: "a/", Payload: []byte("bad")})
+	assert.Equal(t, &Rejection{Reason: "bad payload"}, err)
+
+	err = hook.OnPublish(&Message{Channel: "a/", Payload: []byte("fail")})
+	assert.Error(t, err)
+	assert.NotEqual(t, &Rejection{Reason: "failed"}, err)
+}
+
+func TestQuery_Matches(t *testing.T) {
+	msg := &Message{Ssid: []uint32{1, 2, 3}, Time: 10}
+	assert.True(t, (&Query{Ssid: []uint32{1, 2}, Until: 10}).Matches(msg))
+	assert.True(t, (&Query{Ssid: []uint32{1, multiWildcard}, From: 10, Until: 20}).Matches(msg))
+	assert.False(t, (&Query{Ssid: []uint32{1, 3}, Until: 10}).Matches(msg))
+	assert.False(t, (&Query{Ssid: []uint32{1, 2, 3, 4}, Until: 10}).Matches(msg))
+	assert.False(t, (&Query{Ssid: []uint32{1, 2}, From: 11, Until: 20}).Matches(msg))
+}
@@ -0,0 +1,237 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/rpc"
+
+	goplugin "github.com/hashicorp/go-plugin"
+)
+
+// Verdict represents the outcome of a hook, as it is sent back to the broker.
+type Verdict struct {
+	Message  *Message // The message, as changed by the hook.
+	Rejected bool     // Whether the message was refused.
+	Reason   string   // The reason of the rejection, if any.
+}
+
+// ------------------------------------------------------------------------------------
+
+// authorizerPlugin serves and dispenses an authorizer.
+type authorizerPlugin struct {
+	impl Authorizer
+}
+
+// Server returns the RPC server of the authorizer.
+func (p *authorizerPlugin) Server(*goplugin.MuxBroker) (interface{}, error) {
+	return &authorizerServer{impl: p.impl}, nil
+}
+
+// Client returns the RPC client of the authorizer.
+func (p *authorizerPlugin) Client(_ *goplugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	return &authorizerClient{client: c}, nil
+}
+
+// authorizerServer serves an authorizer over RPC.
+type authorizerServer struct {
+	impl Authorizer
+}
+
+func (s *authorizerServer) Authorize(req *AuthRequest, allowed *bool) (err error) {
+	*allowed, err = s.impl.Authorize(req)
+	return
+}
+
+// authorizerClient calls an authorizer over RPC.
+type authorizerClient struct {
+	client *rpc.Client
+}
+
+func (c *authorizerClient) Authorize(req *AuthRequest) (allowed bool, err error) {
+	err = c.client.Call("Plugin.Authorize", req, &allowed)
+	return
+}
+
+// ------------------------------------------------------------------------------------
+
+// storePlugin serves and dispenses a store.
+type storePlugin struct {
+	impl Store
+}
+
+// Server returns the RPC server of the store.
+func (p *storePlugin) Server(*goplugin.MuxBroker) (interface{}, error) {
+	return &storeServer{impl: p.impl}, nil
+}
+
+// Client returns the RPC client of the store.
+func (p *storePlugin) Client(_ *goplugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	return &storeClient{client: c}, nil
+}
+
+// storeServer serves a store over RPC. The configuration is loosely typed, so it is sent
+// encoded in JSON.
+type storeServer struct {
+	impl Store
+}
+
+func (s *storeServer) Configure(config []byte, ok *bool) error {
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return err
+	}
+
+	*ok = true
+	return s.impl.Configure(cfg)
+}
+
+func (s *storeServer) Store(m *Message, ok *bool) error {
+	*ok = true
+	return s.impl.Store(m)
+}
+
+func (s *storeServer) Query(q *Query, msgs *[]Message) (err error) {
+	*msgs, err = s.impl.Query(q)
+	return
+}
+
+func (s *storeServer) Delete(q *Query, ok *bool) error {
+	*ok = true
+	return s.impl.Delete(q)
+}
+
+// storeClient calls a store over RPC.
+type storeClient struct {
+	client *rpc.Client
+}
+
+func (c *storeClient) Configure(config map[string]interface{}) error {
+	b, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	var ok bool
+	return c.client.Call("Plugin.Configure", b, &ok)
+}
+
+func (c *storeClient) Store(m *Message) error {
+	var ok bool
+	return c.client.Call("Plugin.Store", m, &ok)
+}
+
+func (c *storeClient) Query(q *Query) (msgs []Message, err error) {
+	err = c.client.Call("Plugin.Query", q, &msgs)
+	return
+}
+
+func (c *storeClient) Delete(q *Query) error {
+	var ok bool
+	return c.client.Call("Plugin.Delete", q, &ok)
+}
+
+// ------------------------------------------------------------------------------------
+
+// connectorPlugin serves and dispenses a connector.
+type connectorPlugin struct {
+	impl Connector
+}
+
+// Server returns the RPC server of the connector.
+func (p *connectorPlugin) Server(*goplugin.MuxBroker) (interface{}, error) {
+	return &connectorServer{impl: p.impl}, nil
+}
+
+// Client returns the RPC client of the connector.
+func (p *connectorPlugin) Client(_ *goplugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	return &connectorClient{client: c}, nil
+}
+
+// connectorServer serves a connector over RPC.
+type connectorServer struct {
+	impl Connector
+}
+
+func (s *connectorServer) Send(m *Message, ok *bool) error {
+	*ok = true
+	return s.impl.Send(m)
+}
+
+// connectorClient calls a connector over RPC.
+type connectorClient struct {
+	client *rpc.Client
+}
+
+func (c *connectorClient) Send(m *Message) error {
+	var ok bool
+	return c.client.Call("Plugin.Send", m, &ok)
+}
+
+// ------------------------------------------------------------------------------------
+
+// hookPlugin serves and dispenses a hook.
+type hookPlugin struct {
+	impl Hook
+}
+
+// Server returns the RPC server of the hook.
+func (p *hookPlugin) Server(*goplugin.MuxBroker) (interface{}, error) {
+	return &hookServer{impl: p.impl}, nil
+}
+
+// Client returns the RPC client of the hook.
+func (p *hookPlugin) Client(_ *goplugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	return &hookClient{client: c}, nil
+}
+
+// hookServer serves a hook over RPC. Since the errors lose their type over RPC, the
+// rejections are sent back as part of the verdict.
+type hookServer struct {
+	impl Hook
+}
+
+func (s *hookServer) OnPublish(m *Message, verdict *Verdict) error {
+	err := s.impl.OnPublish(m)
+	if rejection := new(Rejection); errors.As(err, &rejection) {
+		verdict.Rejected = true
+		verdict.Reason = rejection.Reason
+		return nil
+	}
+
+	verdict.Message = m
+	return err
+}
+
+// hookClient calls a hook over RPC.
+type hookClient struct {
+	client *rpc.Client
+}
+
+func (c *hookClient) OnPublish(m *Message) error {
+	var verdict Verdict
+	if err := c.client.Call("Plugin.OnPublish", m, &verdict); err != nil {
+		return err
+	}
+
+	switch {
+	case verdict.Rejected:
+		return &Rejection{Reason: verdict.Reason}
+	case verdict.Message != nil:
+		*m = *verdict.Message
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package shm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+)
+
+// The defaults of the shared memory transport.
+const (
+	DefaultDir  = "/dev/shm/emitter" // The directory watched by the broker by default.
+	DefaultSize = 4 * 1024 * 1024    // The default size of the ring buffer of a client.
+	fileExt     = ".ring"            // The extension of the ring buffer files.
+)
+
+var sequence uint32 // The sequence of the ring buffers created by this process.
+
+// Client represents a publisher running on the same host as the broker, which writes its
+// messages into a ring buffer in shared memory, read by the broker. This is experimental.
+type Client struct {
+	sync.Mutex
+	file *os.File // The file backing the ring buffer.
+	ring *ring    // The ring buffer.
+}
+
+// Dial creates a new ring buffer of the specified size in the directory watched by the
+// broker. The messages published are forwarded by the broker as soon as it picks it up.
+func Dial(dir string, size int) (*Client, error) {
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return nil, err
+	}
+
+	// Initialise the ring under a temporary name so the broker never sees it half-written
+	pid := os.Getpid()
+	name := filepath.Join(dir, fmt.Sprintf("%d-%d", pid, atomic.AddUint32(&sequence, 1)))
+	file, err := os.OpenFile(name+".tmp", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0660)
+	if err != nil {
+		return nil, err
+	}
+
+	mem, err := initFile(file, headerSize+size)
+	if err != nil {
+		file.Close()
+		os.Remove(name + ".tmp")
+		return nil, err
+	}
+
+	c := &Client{file: file, ring: newRing(mem, pid)}
+	if err := os.Rename(name+".tmp", name+fileExt); err != nil {
+		c.release()
+		os.Remove(name + ".tmp")
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// initFile resizes the file and maps it in memory.
+func initFile(file *os.File, size int) ([]byte, error) {
+	if err := file.Truncate(int64(size)); err != nil {
+		return nil, err
+	}
+
+	return mapFile(file, size)
+}
+
+// Publish writes a message for the channel into the ring buffer. The channel may contain
+// the options, such as "a/b/c/?ttl=30". If the broker has not yet consumed enough of the
+// previous messages, ErrFull is returned and the message may be retried.
+func (c *Client) Publish(key, channel string, payload []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.ring == nil {
+		return ErrClosed
+	}
+
+	packet := mqtt.Publish{
+		Topic:   []byte(key + "/" + channel),
+		Payload: payload,
+	}
+
+	_, err := packet.EncodeTo(c)
+	return err
+}
+
+// Write writes an encoded packet into the ring buffer, as a whole.
+func (c *Client) Write(b []byte) (int, error) {
+	if err := c.ring.write(b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the ring buffer. The broker forwards the pending messages and then removes
+// the file.
+func (c *Client) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.ring == nil {
+		return ErrClosed
+	}
+
+	c.ring.close()
+	return c.release()
+}
+
+// release unmaps the memory and closes the file.
+func (c *Client) release() error {
+	err := unmapFile(c.ring.mem)
+	c.ring = nil
+	if cerr := c.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,199 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package shm
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// The waiting strategy of the consumer when the ring buffer is empty.
+const (
+	spinCount     = 64               // The number of times the consumer yields before sleeping.
+	sleepDuration = time.Millisecond // The duration of a sleep of the consumer.
+	checkInterval = 1000             // The number of sleeps between the checks of the producer.
+)
+
+// Addr represents the address of a ring buffer, which is the path of its file.
+type Addr string
+
+// Network returns the name of the network.
+func (a Addr) Network() string {
+	return "shm"
+}
+
+// String returns the path of the ring buffer.
+func (a Addr) String() string {
+	return string(a)
+}
+
+// ------------------------------------------------------------------------------------
+
+// Conn represents the broker side of a ring buffer, which is read as a stream of MQTT
+// packets. Writes are discarded, as the producers do not read from the ring buffer.
+type Conn struct {
+	sync.RWMutex
+	file *os.File // The file backing the ring buffer.
+	ring *ring    // The ring buffer, nil once closed.
+	addr Addr     // The address of the ring buffer.
+}
+
+// List returns the paths of the ring buffers in the directory.
+func List(dir string) ([]string, error) {
+	return filepath.Glob(filepath.Join(dir, "*"+fileExt))
+}
+
+// Open opens an existing ring buffer for reading.
+func Open(path string) (*Conn, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil || info.Size() <= headerSize {
+		file.Close()
+		return nil, ErrInvalid
+	}
+
+	mem, err := mapFile(file, int(info.Size()))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	ring, err := openRing(mem)
+	if err != nil {
+		unmapFile(mem)
+		file.Close()
+		return nil, err
+	}
+
+	return &Conn{file: file, ring: ring, addr: Addr(path)}, nil
+}
+
+// Read reads the pending bytes of the ring buffer, waiting for them if necessary. Once the
+// producer has closed the ring buffer or has exited, io.EOF is returned. If the producer
+// has truncated or corrupted the ring buffer, ErrInvalid is returned.
+func (c *Conn) Read(b []byte) (int, error) {
+	for i := 0; ; i++ {
+		n, err := c.tryRead(b, i)
+		switch {
+		case n > 0:
+			return n, nil
+		case err != nil:
+			return 0, err
+		case i < spinCount:
+			runtime.Gosched()
+		default:
+			time.Sleep(sleepDuration)
+		}
+	}
+}
+
+// tryRead attempts to read the pending bytes and returns io.EOF once the ring buffer is done.
+func (c *Conn) tryRead(b []byte, attempt int) (n int, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	if c.ring == nil {
+		return 0, io.EOF
+	}
+
+	// The file is owned by the producer, which may truncate it. Accessing the mapping past
+	// the end of the file raises a fault, so its size is checked first and a fault which
+	// still occurs if it is truncated in the meantime is reported as an invalid ring.
+	if info, err := c.file.Stat(); err != nil || info.Size() < int64(len(c.ring.mem)) {
+		return 0, ErrInvalid
+	}
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if _, fault := r.(interface{ Addr() uintptr }); !fault {
+				panic(r)
+			}
+			n, err = 0, ErrInvalid
+		}
+	}()
+
+	if n, err = c.ring.read(b); n > 0 || err != nil {
+		return
+	}
+
+	// The producer might have written right before closing, so read once more
+	if c.ring.closed() {
+		if n, err = c.ring.read(b); err == nil {
+			err = io.EOF
+		}
+		return
+	}
+
+	// Periodically check whether the producer is still running
+	if attempt >= spinCount && (attempt-spinCount)%checkInterval == checkInterval-1 && !isAlive(c.ring.pid()) {
+		return 0, io.EOF
+	}
+	return 0, nil
+}
+
+// Write discards the bytes written.
+func (c *Conn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Close unmaps the ring buffer and removes its file.
+func (c *Conn) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.ring == nil {
+		return nil
+	}
+
+	err := unmapFile(c.ring.mem)
+	c.ring = nil
+	c.file.Close()
+	os.Remove(string(c.addr))
+	return err
+}
+
+// LocalAddr returns the address of the ring buffer.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+// RemoteAddr returns the address of the ring buffer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// SetDeadline is a no-op, the ring buffer being closed once its producer is gone.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline is a no-op, the ring buffer being closed once its producer is gone.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline is a no-op, the writes being discarded.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
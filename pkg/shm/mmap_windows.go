@@ -0,0 +1,37 @@
+//go:build windows
+// +build windows
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package shm
+
+import (
+	"os"
+)
+
+// mapFile is not supported on this platform.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// unmapFile is not supported on this platform.
+func unmapFile(mem []byte) error {
+	return ErrUnsupported
+}
+
+// isAlive is not supported on this platform.
+func isAlive(pid int) bool {
+	return false
+}
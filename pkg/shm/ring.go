@@ -0,0 +1,139 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package shm
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"unsafe"
+)
+
+// The layout of the header of a ring, the cursors being kept on their own cache lines so
+// that the producer and the consumer do not contend on them.
+const (
+	offsetMagic    = 0   // The magic number and the version of the layout.
+	offsetCapacity = 8   // The capacity of the data section, in bytes.
+	offsetPid      = 16  // The process identifier of the producer.
+	offsetClosed   = 24  // Whether the producer has closed the ring.
+	offsetWrite    = 64  // The monotonic write cursor, owned by the producer.
+	offsetRead     = 128 // The monotonic read cursor, owned by the consumer.
+	headerSize     = 192 // The size of the header, the data follows it.
+)
+
+const magic = uint64(0x454d49545231) // "EMITR1", the magic number of the layout.
+
+// Errors returned by the rings.
+var (
+	ErrFull        = errors.New("shm: the ring buffer is full")
+	ErrClosed      = errors.New("shm: the ring buffer is closed")
+	ErrTooLarge    = errors.New("shm: the message is larger than the ring buffer")
+	ErrInvalid     = errors.New("shm: the file is not a valid ring buffer")
+	ErrUnsupported = errors.New("shm: shared memory is not supported on this platform")
+)
+
+// ring represents a single-producer, single-consumer byte ring laid over a memory mapped
+// file. The producer only ever moves the write cursor and the consumer the read cursor.
+type ring struct {
+	mem  []byte // The whole mapping, including the header.
+	data []byte // The data section of the mapping.
+}
+
+// newRing initialises a ring over the mapped memory, for the producer.
+func newRing(mem []byte, pid int) *ring {
+	r := &ring{mem: mem, data: mem[headerSize:]}
+	binary.LittleEndian.PutUint64(mem[offsetCapacity:], uint64(len(r.data)))
+	binary.LittleEndian.PutUint64(mem[offsetPid:], uint64(pid))
+	atomic.StoreUint64(r.cursor(offsetMagic), magic)
+	return r
+}
+
+// openRing validates an existing ring over the mapped memory, for the consumer.
+func openRing(mem []byte) (*ring, error) {
+	if len(mem) <= headerSize {
+		return nil, ErrInvalid
+	}
+
+	r := &ring{mem: mem, data: mem[headerSize:]}
+	if atomic.LoadUint64(r.cursor(offsetMagic)) != magic ||
+		binary.LittleEndian.Uint64(mem[offsetCapacity:]) != uint64(len(r.data)) {
+		return nil, ErrInvalid
+	}
+	return r, nil
+}
+
+// cursor returns a pointer to a 64-bit word of the header.
+func (r *ring) cursor(offset int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&r.mem[offset]))
+}
+
+// pid returns the process identifier of the producer.
+func (r *ring) pid() int {
+	return int(binary.LittleEndian.Uint64(r.mem[offsetPid:]))
+}
+
+// close marks the ring as closed by the producer.
+func (r *ring) close() {
+	atomic.StoreUint64(r.cursor(offsetClosed), 1)
+}
+
+// closed returns whether the producer has closed the ring.
+func (r *ring) closed() bool {
+	return atomic.LoadUint64(r.cursor(offsetClosed)) == 1
+}
+
+// write copies the whole buffer into the ring, or fails if there is not enough space.
+func (r *ring) write(b []byte) error {
+	size := uint64(len(r.data))
+	if uint64(len(b)) > size {
+		return ErrTooLarge
+	}
+
+	w := atomic.LoadUint64(r.cursor(offsetWrite))
+	if size-(w-atomic.LoadUint64(r.cursor(offsetRead))) < uint64(len(b)) {
+		return ErrFull
+	}
+
+	// Copy the buffer, wrapping around the end of the data section, before publishing it
+	n := copy(r.data[w%size:], b)
+	copy(r.data, b[n:])
+	atomic.StoreUint64(r.cursor(offsetWrite), w+uint64(len(b)))
+	return nil
+}
+
+// read copies the pending bytes into the buffer and returns the number of bytes read. Since
+// the producer can write anywhere in the mapping, the cursors are checked against the size
+// of the data section and ErrInvalid is returned if they are inconsistent.
+func (r *ring) read(b []byte) (int, error) {
+	size := uint64(len(r.data))
+	rc := atomic.LoadUint64(r.cursor(offsetRead))
+	pending := atomic.LoadUint64(r.cursor(offsetWrite)) - rc
+	switch {
+	case pending == 0:
+		return 0, nil
+	case pending > size:
+		return 0, ErrInvalid
+	}
+
+	if pending < uint64(len(b)) {
+		b = b[:pending]
+	}
+
+	// Copy the pending bytes, wrapping around the end of the data section, then release them
+	n := copy(b, r.data[rc%size:])
+	n += copy(b[n:], r.data)
+	atomic.StoreUint64(r.cursor(offsetRead), rc+uint64(n))
+	return n, nil
+}
@@ -0,0 +1,150 @@
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+package shm
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/emitter-io/emitter/internal/network/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing_Wrap(t *testing.T) {
+	r := newRing(make([]byte, headerSize+10), 1)
+	out := make([]byte, 10)
+
+	assert.NoError(t, r.write([]byte("abcdef")))
+	assert.Equal(t, ErrFull, r.write([]byte("ghijk")))
+	assert.Equal(t, ErrTooLarge, r.write(make([]byte, 11)))
+	n, err := r.read(out[:4])
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, "abcd", string(out[:4]))
+
+	// Wrap around the end of the data section
+	assert.NoError(t, r.write([]byte("ghijklmn")))
+	n, err = r.read(out)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, "efghijklmn", string(out))
+	n, err = r.read(out)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRing_Corrupted(t *testing.T) {
+	r := newRing(make([]byte, headerSize+10), 1)
+	out := make([]byte, 10)
+
+	// A write cursor further than the size of the data section is rejected
+	*r.cursor(offsetWrite) = 11
+	_, err := r.read(out)
+	assert.Equal(t, ErrInvalid, err)
+
+	// So is a write cursor behind the read cursor
+	*r.cursor(offsetRead) = 20
+	_, err = r.read(out)
+	assert.Equal(t, ErrInvalid, err)
+}
+
+func TestRing_Invalid(t *testing.T) {
+	_, err := openRing(make([]byte, headerSize+10))
+	assert.Equal(t, ErrInvalid, err)
+
+	_, err = openRing(make([]byte, 10))
+	assert.Equal(t, ErrInvalid, err)
+}
+
+func TestClient_Publish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shm")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := Dial(dir, 1024)
+	assert.NoError(t, err)
+
+	paths, err := List(dir)
+	assert.NoError(t, err)
+	assert.Len(t, paths, 1)
+
+	conn, err := Open(paths[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "shm", conn.RemoteAddr().Network())
+	assert.Equal(t, paths[0], conn.RemoteAddr().String())
+
+	// Publish until the ring is full
+	assert.NoError(t, c.Publish("key", "a/b/", []byte("hello")))
+	assert.NoError(t, c.Publish("key", "a/c/", []byte("world")))
+	assert.Equal(t, ErrFull, c.Publish("key", "a/d/", make([]byte, 1000)))
+	assert.NoError(t, c.Close())
+	assert.Equal(t, ErrClosed, c.Publish("key", "a/b/", nil))
+
+	// Read the packets back, until the end of the ring
+	reader := bufio.NewReader(conn)
+	for _, expect := range []string{"key/a/b/", "key/a/c/"} {
+		msg, err := mqtt.DecodePacket(reader, 65536)
+		assert.NoError(t, err)
+		assert.Equal(t, expect, string(msg.(*mqtt.Publish).Topic))
+	}
+
+	_, err = mqtt.DecodePacket(reader, 65536)
+	assert.Equal(t, io.EOF, err)
+
+	// Closing the connection removes the ring
+	assert.NoError(t, conn.Close())
+	paths, err = List(dir)
+	assert.NoError(t, err)
+	assert.Len(t, paths, 0)
+}
+
+func TestConn_Truncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shm")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := Dial(dir, 1024)
+	assert.NoError(t, err)
+	defer c.release() // The producer can not close the truncated ring either
+
+	paths, err := List(dir)
+	assert.NoError(t, err)
+	conn, err := Open(paths[0])
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// A ring truncated by its producer is reported as invalid rather than faulting
+	assert.NoError(t, c.Publish("key", "a/b/", []byte("hello")))
+	assert.NoError(t, os.Truncate(paths[0], 0))
+	_, err = conn.Read(make([]byte, 64))
+	assert.Equal(t, ErrInvalid, err)
+}
+
+func TestConn_Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shm")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := dir + "/x" + fileExt
+	assert.NoError(t, ioutil.WriteFile(path, make([]byte, 1024), 0660))
+	_, err = Open(path)
+	assert.Equal(t, ErrInvalid, err)
+
+	_, err = Open(dir + "/missing" + fileExt)
+	assert.Error(t, err)
+}
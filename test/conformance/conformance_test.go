@@ -0,0 +1,159 @@
+//go:build conformance
+// +build conformance
+
+/**********************************************************************************
+* Copyright (c) 2009-2020 Misakai Ltd.
+* This program is free software: you can redistribute it and/or modify it under the
+* terms of the GNU Affero General Public License as published by the  Free Software
+* Foundation, either version 3 of the License, or(at your option) any later version.
+*
+* This program is distributed  in the hope that it  will be useful, but WITHOUT ANY
+* WARRANTY;  without even  the implied warranty of MERCHANTABILITY or FITNESS FOR A
+* PARTICULAR PURPOSE.  See the GNU Affero General Public License  for  more details.
+*
+* You should have  received a copy  of the  GNU Affero General Public License along
+* with this program. If not, see<http://www.gnu.org/licenses/>.
+************************************************************************************/
+
+// Package conformance runs the client libraries used in the wild, such as paho and
+// mqtt.js, against a broker spawned for the purpose. Each library goes through the same
+// scenarios, written in its own language, and the suite fails if any of them does.
+//
+//	go test -tags conformance ./test/conformance/
+//
+// A library is skipped if its runtime or its package is not installed, see the README of
+// the repository for installing them.
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emitter-io/emitter/internal/security/license"
+)
+
+const startTimeout = 30 * time.Second // How long the broker is given to start listening.
+
+// broker represents the broker spawned for the suite.
+var broker struct {
+	addr   string // The address the broker listens on.
+	secret string // The master key of the license of the broker.
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+// run spawns the broker, runs the suite and stops the broker.
+func run(m *testing.M) int {
+	dir, err := ioutil.TempDir("", "emitter-conformance")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	cmd, err := spawn(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	return m.Run()
+}
+
+// spawn builds the broker and starts it with a new license, on a free port.
+func spawn(dir string) (*exec.Cmd, error) {
+	binary := filepath.Join(dir, "emitter")
+	build := exec.Command("go", "build", "-o", binary, "github.com/emitter-io/emitter")
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err := build.Run(); err != nil {
+		return nil, fmt.Errorf("unable to build the broker: %v", err)
+	}
+
+	addr, err := freeAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	lic, secret := license.New()
+	conf, _ := json.Marshal(map[string]interface{}{
+		"listen":  addr,
+		"license": lic,
+		"storage": map[string]string{"provider": "inmemory"},
+	})
+
+	path := filepath.Join(dir, "emitter.conf")
+	if err := ioutil.WriteFile(path, conf, 0600); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(binary, "-c", path)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	for deadline := time.Now().Add(startTimeout); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			broker.addr, broker.secret = addr, secret
+			return cmd, nil
+		}
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	return nil, fmt.Errorf("the broker did not listen on %s within %s", addr, startTimeout)
+}
+
+// freeAddr returns a local address with a free port.
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+// runScenarios runs the scenarios of a client library, which reads the address of the
+// broker and its master key from the environment.
+func runScenarios(t *testing.T, name string, args ...string) {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), "BROKER_ADDR="+broker.addr, "BROKER_SECRET="+broker.secret)
+	out, err := cmd.CombinedOutput()
+	t.Logf("%s", out)
+	if err != nil {
+		t.Fatalf("the scenarios failed: %v", err)
+	}
+}
+
+func TestMQTTJS(t *testing.T) {
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node is not installed")
+	}
+	if _, err := os.Stat("mqttjs/node_modules/mqtt"); err != nil {
+		t.Skip("mqtt.js is not installed, run 'npm install' in test/conformance/mqttjs")
+	}
+
+	runScenarios(t, "node", "mqttjs/conformance.js")
+}
+
+func TestPaho(t *testing.T) {
+	if err := exec.Command("python3", "-c", "import paho.mqtt.client").Run(); err != nil {
+		t.Skip("paho is not installed, run 'pip install -r test/conformance/paho/requirements.txt'")
+	}
+
+	runScenarios(t, "python3", "paho/conformance.py")
+}
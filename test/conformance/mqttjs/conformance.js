@@ -0,0 +1,173 @@
+// Runs the conformance scenarios of emitter with mqtt.js, against the broker whose
+// address and master key are given by the BROKER_ADDR and BROKER_SECRET variables.
+'use strict';
+
+const mqtt = require('mqtt');
+
+const addr = process.env.BROKER_ADDR || '127.0.0.1:8080';
+const secret = process.env.BROKER_SECRET;
+const timeout = 5000;
+
+// connect opens a new connection and waits for it to be acknowledged.
+function connect(options) {
+  return new Promise((resolve, reject) => {
+    const client = mqtt.connect('mqtt://' + addr, Object.assign({
+      protocolVersion: 4,
+      clean: true,
+      reconnectPeriod: 0,
+      connectTimeout: timeout,
+    }, options));
+    client.once('connect', () => resolve(client));
+    client.once('error', reject);
+  });
+}
+
+// receive waits for the next message of a channel, or fails after the timeout.
+function receive(client, channel, wait) {
+  return new Promise((resolve, reject) => {
+    const timer = setTimeout(() => {
+      client.removeListener('message', onMessage);
+      reject(new Error('no message received on ' + channel));
+    }, wait || timeout);
+    function onMessage(topic, payload) {
+      if (topic === channel) {
+        clearTimeout(timer);
+        client.removeListener('message', onMessage);
+        resolve(payload.toString());
+      }
+    }
+    client.on('message', onMessage);
+  });
+}
+
+// nothing checks that no message is received on a channel for a while.
+async function nothing(client, channel) {
+  try {
+    const payload = await receive(client, channel, 500);
+    throw new Error('unexpected message on ' + channel + ': ' + payload);
+  } catch (err) {
+    if (err.message.startsWith('unexpected')) {
+      throw err;
+    }
+  }
+}
+
+// call runs an operation of the client which takes a callback, as a promise.
+function call(client, method, ...args) {
+  return new Promise((resolve, reject) => {
+    client[method](...args, (err, granted) => err ? reject(err) : resolve(granted));
+  });
+}
+
+// equal fails if the value is not the one expected.
+function equal(actual, expected, what) {
+  if (actual !== expected) {
+    throw new Error(what + ' is ' + JSON.stringify(actual) + ' instead of ' + JSON.stringify(expected));
+  }
+}
+
+// keygen creates a key for the channels of the scenarios.
+async function keygen(client) {
+  const reply = receive(client, 'emitter/keygen/');
+  await call(client, 'publish', 'emitter/keygen/', JSON.stringify({
+    key: secret,
+    channel: 'conformance/#/',
+    type: 'rwsl',
+  }), { qos: 0 });
+
+  const response = JSON.parse(await reply);
+  equal(response.status, 200, 'the status of the keygen');
+  return response.key;
+}
+
+const scenarios = {
+  async 'publishes and receives with QoS 0'(ctx) {
+    await call(ctx.client, 'subscribe', ctx.key + '/conformance/a/', { qos: 0 });
+    const msg = receive(ctx.client, 'conformance/a/');
+    await call(ctx.client, 'publish', ctx.key + '/conformance/a/', 'hello', { qos: 0 });
+    equal(await msg, 'hello', 'the payload');
+  },
+
+  async 'publishes and receives with QoS 1'(ctx) {
+    const granted = await call(ctx.client, 'subscribe', ctx.key + '/conformance/b/', { qos: 1 });
+    equal(granted.length, 1, 'the number of subscriptions granted');
+    const msg = receive(ctx.client, 'conformance/b/');
+    await call(ctx.client, 'publish', ctx.key + '/conformance/b/', 'acknowledged', { qos: 1 });
+    equal(await msg, 'acknowledged', 'the payload');
+  },
+
+  async 'receives through a wildcard'(ctx) {
+    await call(ctx.client, 'subscribe', ctx.key + '/conformance/+/c/', { qos: 0 });
+    const msg = receive(ctx.client, 'conformance/x/c/');
+    await call(ctx.client, 'publish', ctx.key + '/conformance/x/c/', 'wildcard', { qos: 0 });
+    equal(await msg, 'wildcard', 'the payload');
+  },
+
+  async 'stops receiving once unsubscribed'(ctx) {
+    await call(ctx.client, 'subscribe', ctx.key + '/conformance/d/', { qos: 0 });
+    await call(ctx.client, 'unsubscribe', ctx.key + '/conformance/d/');
+    const none = nothing(ctx.client, 'conformance/d/');
+    await call(ctx.client, 'publish', ctx.key + '/conformance/d/', 'ignored', { qos: 0 });
+    await none;
+  },
+
+  async 'loads the stored messages'(ctx) {
+    await call(ctx.client, 'publish', ctx.key + '/conformance/e/?ttl=60', 'stored', { qos: 1 });
+    const other = await connect({ clientId: 'conformance-mqttjs-loader' });
+    try {
+      const msg = receive(other, 'conformance/e/');
+      await call(other, 'subscribe', ctx.key + '/conformance/e/?last=1', { qos: 0 });
+      equal(await msg, 'stored', 'the payload');
+    } finally {
+      other.end(true);
+    }
+  },
+
+  async 'delivers the last will'(ctx) {
+    await call(ctx.client, 'subscribe', ctx.key + '/conformance/f/', { qos: 0 });
+    const other = await connect({
+      clientId: 'conformance-mqttjs-will',
+      will: { topic: ctx.key + '/conformance/f/', payload: 'gone', qos: 0, retain: false },
+    });
+
+    const msg = receive(ctx.client, 'conformance/f/');
+    other.stream.destroy();
+    equal(await msg, 'gone', 'the payload');
+  },
+
+  async 'stays connected with keep-alive pings'() {
+    const client = await connect({ clientId: 'conformance-mqttjs-ping', keepalive: 1 });
+    try {
+      let closed = false;
+      client.once('close', () => { closed = true; });
+      await new Promise((resolve) => setTimeout(resolve, 3000));
+      equal(closed, false, 'the connection closed');
+    } finally {
+      client.end(true);
+    }
+  },
+};
+
+async function main() {
+  const client = await connect({ clientId: 'conformance-mqttjs' });
+  const ctx = { client, key: await keygen(client) };
+
+  let failed = 0;
+  for (const [name, scenario] of Object.entries(scenarios)) {
+    try {
+      await scenario(ctx);
+      console.log('ok   ' + name);
+    } catch (err) {
+      failed++;
+      console.log('FAIL ' + name + ': ' + err.message);
+    }
+  }
+
+  client.end(true);
+  process.exit(failed > 0 ? 1 : 0);
+}
+
+main().catch((err) => {
+  console.log('FAIL ' + err.message);
+  process.exit(1);
+});
@@ -0,0 +1,173 @@
+# Runs the conformance scenarios of emitter with paho, against the broker whose address
+# and master key are given by the BROKER_ADDR and BROKER_SECRET variables.
+import json
+import os
+import queue
+import sys
+import time
+
+import paho.mqtt.client as mqtt
+
+ADDR = os.environ.get("BROKER_ADDR", "127.0.0.1:8080")
+SECRET = os.environ.get("BROKER_SECRET", "")
+TIMEOUT = 5
+
+
+class Client:
+    """Wraps a paho client, queuing the messages received per channel."""
+
+    def __init__(self, client_id, keepalive=60, will=None):
+        self.messages = {}
+        self.connected = queue.Queue()
+        self.closed = False
+        self.acks = queue.Queue()
+
+        self.mqtt = mqtt.Client(client_id=client_id, clean_session=True, protocol=mqtt.MQTTv311)
+        self.mqtt.on_connect = lambda c, u, f, rc: self.connected.put(rc)
+        self.mqtt.on_disconnect = lambda c, u, rc: setattr(self, "closed", True)
+        self.mqtt.on_message = lambda c, u, m: self.inbox(m.topic).put(m.payload.decode())
+        self.mqtt.on_subscribe = lambda c, u, mid, granted: self.acks.put(granted)
+        self.mqtt.on_unsubscribe = lambda c, u, mid: self.acks.put(mid)
+        if will:
+            self.mqtt.will_set(will[0], will[1], qos=0, retain=False)
+
+        host, port = ADDR.rsplit(":", 1)
+        self.mqtt.connect(host, int(port), keepalive=keepalive)
+        self.mqtt.loop_start()
+        rc = self.connected.get(timeout=TIMEOUT)
+        if rc != 0:
+            raise AssertionError("the connection was refused with code %d" % rc)
+
+    def inbox(self, channel):
+        return self.messages.setdefault(channel, queue.Queue())
+
+    def subscribe(self, topic, qos=0):
+        self.mqtt.subscribe(topic, qos)
+        return self.acks.get(timeout=TIMEOUT)
+
+    def unsubscribe(self, topic):
+        self.mqtt.unsubscribe(topic)
+        self.acks.get(timeout=TIMEOUT)
+
+    def publish(self, topic, payload, qos=0):
+        self.mqtt.publish(topic, payload, qos=qos).wait_for_publish()
+
+    def receive(self, channel, timeout=TIMEOUT):
+        try:
+            return self.inbox(channel).get(timeout=timeout)
+        except queue.Empty:
+            raise AssertionError("no message received on " + channel)
+
+    def nothing(self, channel):
+        try:
+            payload = self.inbox(channel).get(timeout=0.5)
+        except queue.Empty:
+            return
+        raise AssertionError("unexpected message on %s: %s" % (channel, payload))
+
+    def close(self):
+        self.mqtt.disconnect()
+        self.mqtt.loop_stop()
+
+
+def equal(actual, expected, what):
+    if actual != expected:
+        raise AssertionError("%s is %r instead of %r" % (what, actual, expected))
+
+
+def keygen(client):
+    """Creates a key for the channels of the scenarios."""
+    client.publish("emitter/keygen/", json.dumps({
+        "key": SECRET,
+        "channel": "conformance/#/",
+        "type": "rwsl",
+    }))
+
+    response = json.loads(client.receive("emitter/keygen/"))
+    equal(response.get("status"), 200, "the status of the keygen")
+    return response["key"]
+
+
+def publishes_with_qos0(client, key):
+    client.subscribe(key + "/conformance/a/")
+    client.publish(key + "/conformance/a/", "hello")
+    equal(client.receive("conformance/a/"), "hello", "the payload")
+
+
+def publishes_with_qos1(client, key):
+    granted = client.subscribe(key + "/conformance/b/", qos=1)
+    equal(len(granted), 1, "the number of subscriptions granted")
+    client.publish(key + "/conformance/b/", "acknowledged", qos=1)
+    equal(client.receive("conformance/b/"), "acknowledged", "the payload")
+
+
+def receives_through_wildcard(client, key):
+    client.subscribe(key + "/conformance/+/c/")
+    client.publish(key + "/conformance/x/c/", "wildcard")
+    equal(client.receive("conformance/x/c/"), "wildcard", "the payload")
+
+
+def stops_once_unsubscribed(client, key):
+    client.subscribe(key + "/conformance/d/")
+    client.unsubscribe(key + "/conformance/d/")
+    client.publish(key + "/conformance/d/", "ignored")
+    client.nothing("conformance/d/")
+
+
+def loads_stored_messages(client, key):
+    client.publish(key + "/conformance/e/?ttl=60", "stored", qos=1)
+    other = Client("conformance-paho-loader")
+    try:
+        other.subscribe(key + "/conformance/e/?last=1")
+        equal(other.receive("conformance/e/"), "stored", "the payload")
+    finally:
+        other.close()
+
+
+def delivers_last_will(client, key):
+    client.subscribe(key + "/conformance/f/")
+    other = Client("conformance-paho-will", will=(key + "/conformance/f/", "gone"))
+    other.mqtt.loop_stop()
+    other.mqtt.socket().close()
+    equal(client.receive("conformance/f/"), "gone", "the payload")
+
+
+def stays_connected_with_pings(client, key):
+    other = Client("conformance-paho-ping", keepalive=1)
+    try:
+        time.sleep(3)
+        equal(other.closed, False, "the connection closed")
+    finally:
+        other.close()
+
+
+SCENARIOS = [
+    ("publishes and receives with QoS 0", publishes_with_qos0),
+    ("publishes and receives with QoS 1", publishes_with_qos1),
+    ("receives through a wildcard", receives_through_wildcard),
+    ("stops receiving once unsubscribed", stops_once_unsubscribed),
+    ("loads the stored messages", loads_stored_messages),
+    ("delivers the last will", delivers_last_will),
+    ("stays connected with keep-alive pings", stays_connected_with_pings),
+]
+
+
+def main():
+    client = Client("conformance-paho")
+    key = keygen(client)
+
+    failed = 0
+    for name, scenario in SCENARIOS:
+        try:
+            scenario(client, key)
+            print("ok   " + name)
+        except Exception as err:
+            failed += 1
+            print("FAIL %s: %s" % (name, err))
+
+    client.close()
+    return 1 if failed else 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())